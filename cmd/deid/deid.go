@@ -0,0 +1,319 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary deid de-identifies HL7v2 messages according to a YAML policy, so that real feeds can be
+// turned into test data that can be shared.
+//
+// Usage:
+//
+//	deid -policy_file=policy.yml -salt=$SALT -input=messages.hl7 -output=file -output_file=deid.hl7
+//	deid -policy_file=policy.yml -salt=$SALT -mllp_listen_address=:2575 -output=mllp -mllp_destination=host:2575
+//
+// Messages are read from -input, which can be in any of the formats that Simulated Hospital writes,
+// or from the MLLP connections accepted on -mllp_listen_address, which are acknowledged with an
+// ACK message once the message has been de-identified and sent. Messages that cannot be
+// de-identified are logged and never sent.
+// See configs/deid/policy.yml for the format of the policy.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/google/simhospital/pkg/clock"
+	"github.com/google/simhospital/pkg/config"
+	"github.com/google/simhospital/pkg/deid"
+	"github.com/google/simhospital/pkg/gender"
+	"github.com/google/simhospital/pkg/generator/address"
+	"github.com/google/simhospital/pkg/generator/names"
+	"github.com/google/simhospital/pkg/generator/person"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/logging"
+)
+
+var (
+	localPath  = flag.String("local_path", "", "Absolute path to the directory where Simulated Hospital is located. Set when running locally to use as a prefix to all default paths")
+	policyFile = flag.String("policy_file", "configs/deid/policy.yml", "Path to a YAML file with the de-identification policy. This file can be a local file or a GCS object.")
+	salt       = flag.String("salt", "", "Secret used to hash values and shift dates. If set, it overrides the salt in -policy_file")
+
+	// Input and output.
+	input             = flag.String("input", "", "Path to a file with the messages to de-identify. If neither -input nor -mllp_listen_address are set, messages are read from the standard input")
+	mllpListenAddress = flag.String("mllp_listen_address", "", "Address on which to accept MLLP connections with the messages to de-identify")
+	output            = flag.String("output", "stdout", "Where the de-identified HL7 messages will be sent: [stdout, mllp, file]")
+	outputFile        = flag.String("output_file", "messages.out", "File path to write messages if -output=file")
+	mllpDestination   = flag.String("mllp_destination", "", "Host:Port to which MLLP messages will be sent; only relevant if -output=mllp")
+
+	// Data to generate fake values with; only relevant if the policy has rules with the fake action.
+	hl7ConfigFile          = flag.String("hl7_config_file", "configs/hl7_messages/hl7.yml", "Path to a YAML file with the possible values of HL7 fields related to how the HL7 standard is used. This file can be a local file or a GCS object.")
+	dataConfigFile         = flag.String("data_config_file", "configs/hl7_messages/data.yml", "Path to a YAML file with the configuration for data to populate HL7 fields that are not relevant to the use of the HL7 standard. This file can be a local file or a GCS object.")
+	nounsFile              = flag.String("nouns_file", "configs/hl7_messages/third_party/nouns.txt", "Path to a text file containing english nouns. This file can be a local file or a GCS object.")
+	surnamesFile           = flag.String("surnames_file", "configs/hl7_messages/third_party/surnames.txt", "Path to a text file containing surnames. This file can be a local file or a GCS object.")
+	girlsHistoricNamesFile = flag.String("girls_names", "configs/hl7_messages/third_party/historicname_tcm77-254032-girls.csv", "Path to a CSV file containing historical girls names. This file can be a local file or a GCS object.")
+	boysHistoricNamesFile  = flag.String("boys_names", "configs/hl7_messages/third_party/historicname_tcm77-254032-boys.csv", "Path to a CSV file containing historical boys names. This file can be a local file or a GCS object.")
+	sampleNotesDir         = flag.String("sample_notes_directory", "configs/hl7_messages/third_party/notes", "Path to a directory with the sample notes. This directory can be on the local file system or GCS.")
+	clinicalNoteTypesFile  = flag.String("clinical_note_types_file", "configs/hl7_messages/third_party/note_types.txt", "Path to a text file with the Clinical Note types. This file can be a local file or a GCS object.")
+	diagnosesFile          = flag.String("diagnoses_file", "configs/hl7_messages/diagnoses.csv", "Path to a CSV file with the diagnoses and how often they occur. This file can be a local file or a GCS object.")
+	proceduresFile         = flag.String("procedures_file", "configs/hl7_messages/procedures.csv", "Path to a CSV file with the procedures and how often they occur. This file can be a local file or a GCS object.")
+	allergiesFile          = flag.String("allergies_file", "configs/hl7_messages/allergies.csv", "Path to a CSV file with the allergies and how often they occur. This file can be a local file or a GCS object.")
+	ethnicityFile          = flag.String("ethnicity_file", "configs/hl7_messages/ethnicity.csv", "Path to a CSV file with the ethnicities and how often they occur. This file can be a local file or a GCS object.")
+	patientClassFile       = flag.String("patient_class_file", "configs/hl7_messages/patient_class.csv", "Path to a CSV file with the patient classes and types and how often they occur. This file can be a local file or a GCS object.")
+
+	logLevel = flag.String("log_level", "INFO", "The logging granularity. One of PANIC, FATAL, ERROR, WARN, INFO, DEBUG. Not case sensitive")
+
+	// flagset tracks what flags have been set in the command line.
+	flagset = make(map[string]bool)
+
+	log = logging.ForCallerPackage()
+)
+
+func main() {
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
+	if err := logging.SetLogLevelFromString(*logLevel); err != nil {
+		logrus.WithError(err).WithField("log_level", *logLevel).Fatal("Cannot configure logger")
+	}
+	rand.Seed(time.Now().Unix())
+
+	ctx := context.Background()
+	d, err := newDeidentifier(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Cannot create de-identifier")
+	}
+	sender, err := newSender()
+	if err != nil {
+		log.WithError(err).Fatal("Cannot create sender")
+	}
+	defer sender.Close()
+
+	p := &processor{d: d, sender: sender}
+	if *mllpListenAddress != "" {
+		err = p.listen(*mllpListenAddress)
+	} else {
+		err = p.readFile(*input)
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Cannot de-identify messages")
+	}
+}
+
+// newDeidentifier returns a Deidentifier for the policy in -policy_file.
+func newDeidentifier(ctx context.Context) (*deid.Deidentifier, error) {
+	policy, err := deid.LoadPolicy(ctx, addLocalPathIfNotSet(*policyFile, "policy_file"))
+	if err != nil {
+		return nil, err
+	}
+	if *salt != "" {
+		policy.Salt = *salt
+	}
+	var g deid.PersonGenerator
+	for _, r := range policy.Rules {
+		if r.Action == deid.ActionFake {
+			if g, err = personGenerator(ctx); err != nil {
+				return nil, errors.Wrap(err, "cannot create the generator of fake values")
+			}
+			break
+		}
+	}
+	return deid.New(policy, g)
+}
+
+// personGenerator returns a generator of people like the ones of Simulated Hospital.
+func personGenerator(ctx context.Context) (*person.Generator, error) {
+	hl7Config, err := config.LoadHL7Config(ctx, addLocalPathIfNotSet(*hl7ConfigFile, "hl7_config_file"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := config.LoadData(ctx, config.DataFiles{
+		DataConfig:        addLocalPathIfNotSet(*dataConfigFile, "data_config_file"),
+		Nouns:             addLocalPathIfNotSet(*nounsFile, "nouns_file"),
+		Surnames:          addLocalPathIfNotSet(*surnamesFile, "surnames_file"),
+		Girls:             addLocalPathIfNotSet(*girlsHistoricNamesFile, "girls_names"),
+		Boys:              addLocalPathIfNotSet(*boysHistoricNamesFile, "boys_names"),
+		Procedures:        addLocalPathIfNotSet(*proceduresFile, "procedures_file"),
+		Diagnoses:         addLocalPathIfNotSet(*diagnosesFile, "diagnoses_file"),
+		Allergies:         addLocalPathIfNotSet(*allergiesFile, "allergies_file"),
+		Ethnicities:       addLocalPathIfNotSet(*ethnicityFile, "ethnicity_file"),
+		PatientClass:      addLocalPathIfNotSet(*patientClassFile, "patient_class_file"),
+		SampleNotesDir:    addLocalPathIfNotSet(*sampleNotesDir, "sample_notes_directory"),
+		ClinicalNoteTypes: addLocalPathIfNotSet(*clinicalNoteTypesFile, "clinical_note_types_file"),
+	}, hl7Config)
+	if err != nil {
+		return nil, err
+	}
+	return &person.Generator{
+		Clock:              &clock.RealTimeClock{},
+		NameGenerator:      &names.Generator{Data: data},
+		GenderConvertor:    gender.NewConvertor(hl7Config),
+		EthnicityGenerator: person.NewEthnicityGenerator(data),
+		AddressGenerator:   &address.Generator{Nouns: data.Nouns, Address: data.Address},
+		MRNGenerator:       &mrnGenerator{},
+		Country:            data.Address.Country,
+	}, nil
+}
+
+// mrnGenerator generates random MRNs, like the ones of Simulated Hospital's patients.
+type mrnGenerator struct{}
+
+func (*mrnGenerator) NewID() string {
+	return fmt.Sprintf("%d", rand.Uint32())
+}
+
+func newSender() (hl7.Sender, error) {
+	switch *output {
+	case "stdout":
+		return hl7.NewStdoutSender(), nil
+	case "mllp":
+		return hl7.NewMLLPSender(*mllpDestination, false, 0)
+	case "file":
+		return hl7.NewFileSender(*outputFile)
+	default:
+		return nil, fmt.Errorf("invalid -output %q; valid values are stdout, mllp and file", *output)
+	}
+}
+
+// processor de-identifies messages and sends them.
+type processor struct {
+	d *deid.Deidentifier
+
+	// mu guards sender, which is not safe for concurrent use.
+	mu     sync.Mutex
+	sender hl7.Sender
+}
+
+// process de-identifies and sends a message.
+func (p *processor) process(msg []byte) error {
+	deidentified, err := p.d.Deidentify(msg)
+	if err != nil {
+		return errors.Wrap(err, "cannot de-identify message")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Wrap(p.sender.Send(deidentified), "cannot send message")
+}
+
+// readFile de-identifies the messages in the given file, or in the standard input if fileName is
+// empty. Messages that cannot be de-identified are logged and skipped.
+func (p *processor) readFile(fileName string) error {
+	in := os.Stdin
+	if fileName != "" {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return errors.Wrapf(err, "cannot open input file %s", fileName)
+		}
+		defer f.Close()
+		in = f
+	}
+	r := hl7.NewReader(in, nil)
+	var total, failed int
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot read HL7 messages")
+		}
+		total++
+		if err := p.process(m.Raw); err != nil {
+			failed++
+			log.WithError(err).WithField("index", m.Index).Error("Cannot process message")
+		}
+	}
+	log.Infof("De-identified %d messages out of %d", total-failed, total)
+	if failed > 0 {
+		return fmt.Errorf("%d messages could not be de-identified", failed)
+	}
+	return nil
+}
+
+// listen accepts MLLP connections on the given address and de-identifies the messages received.
+func (p *processor) listen(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return errors.Wrapf(err, "cannot listen on %s", address)
+	}
+	log.Infof("Listening for MLLP connections on %s", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return errors.Wrap(err, "cannot accept connection")
+		}
+		go p.serve(conn)
+	}
+}
+
+// serve de-identifies the messages received on an MLLP connection, and acknowledges them.
+func (p *processor) serve(conn net.Conn) {
+	defer conn.Close()
+	logger := log.WithField("remote_address", conn.RemoteAddr())
+	c := hl7.NewMLLPClient(conn)
+	b := hl7.NewBuilder(nil)
+	for {
+		msg, err := c.Read()
+		if err != nil {
+			if errors.Cause(err) != io.EOF {
+				logger.WithError(err).Error("Cannot read MLLP message")
+			}
+			return
+		}
+		code := "AA"
+		if err := p.process(msg); err != nil {
+			logger.WithError(err).Error("Cannot process message")
+			code = "AE"
+		}
+		ack, err := buildACK(b, msg, code)
+		if err != nil {
+			logger.WithError(err).Error("Cannot build ACK message")
+			return
+		}
+		if err := c.Write(ack); err != nil {
+			logger.WithError(err).Error("Cannot write ACK message")
+			return
+		}
+	}
+}
+
+// buildACK builds the acknowledgment of the given message with the given acknowledgment code.
+func buildACK(b *hl7.Builder, msg []byte, code string) ([]byte, error) {
+	msh := &hl7.MSH{MessageType: &hl7.MSG{MessageCode: hl7.NewID("ACK")}}
+	msa := &hl7.MSA{AcknowledgmentCode: hl7.NewID(hl7.ID(code))}
+	if m, err := hl7.ParseMessage(msg); err == nil {
+		if original, err := m.MSH(); err == nil && original != nil {
+			msh.SendingApplication = original.ReceivingApplication
+			msh.SendingFacility = original.ReceivingFacility
+			msh.ReceivingApplication = original.SendingApplication
+			msh.ReceivingFacility = original.SendingFacility
+			msh.MessageType.TriggerEvent = original.MessageType.TriggerEvent
+			msa.MessageControlID = original.MessageControlID
+		}
+	}
+	return b.Build(msh, msa)
+}
+
+func addLocalPathIfNotSet(f string, n string) string {
+	if flagset[n] {
+		return f
+	}
+	return path.Join(*localPath, f)
+}
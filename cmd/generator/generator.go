@@ -17,6 +17,9 @@
 // the most recent definition of each type. This relies on HL7 maintaining
 // backwards compatibility.
 // For an example of the generated code, see schema.go.
+// Versions 2.7 and above withdraw fields and components, either by omitting them
+// or by keeping them with a withdrawn marker. In both cases, they are generated
+// as deprecated fields so that the position of the remaining fields is kept.
 // TODO:
 // - Represent HL7 null values
 // - Consider using go generate (blog.golang.org/generate)
@@ -66,7 +69,10 @@ type ComplexType struct {
 	// Some schemas use lower-case "type".
 	LowerCaseType string `xml:"annotation>appinfo>type"`
 	LongName      string `xml:"annotation>appinfo>LongName"`
-	Version       string
+	// ConformanceStatements are the conformance statements of segments and
+	// message types, in versions 2.8 and above.
+	ConformanceStatements []string `xml:"annotation>appinfo>ConformanceStatement"`
+	Version               string
 }
 
 // Type returns the type.
@@ -81,6 +87,14 @@ func (c ComplexType) Type() string {
 	return t
 }
 
+// IsWithdrawn returns whether the field or component that c represents has been
+// withdrawn from the specification. Versions 2.7 and above keep some withdrawn
+// elements, with the NULLDT or "-" data type, or with "Withdrawn" in their names.
+func (c ComplexType) IsWithdrawn() bool {
+	t := c.Type()
+	return t == "-" || t == "NULLDT" || strings.Contains(strings.ToLower(c.LongName), "withdrawn")
+}
+
 // IsHL7Segment returns true if this ComplexType represents a HL7 segment.
 func (c ComplexType) IsHL7Segment() bool {
 	// Note that it's a completely arbitrary property of the XML schema mapping
@@ -123,6 +137,35 @@ func GoType(t string) string {
 	return t
 }
 
+// primitiveTypes are the data types implemented in data_types.go, rather than
+// generated from the specification.
+var primitiveTypes = map[string]bool{
+	"Any": true, "CM": true, "Delimiters": true, "DT": true, "DTM": true, "FT": true,
+	"GTS": true, "ID": true, "IS": true, "NM": true, "NUL": true, "SI": true,
+	"SNM": true, "ST": true, "TM": true, "TN": true, "TS": true, "TX": true,
+}
+
+// fieldType returns the Go type name for the field or component f.
+// Data types that are neither primitive nor defined in the specification, e.g.,
+// primitive data types introduced by newer versions, are represented as ST.
+func fieldType(f *ComplexType, spec *Specification) string {
+	t := GoType(f.Type())
+	if _, ok := spec.CompositeTypes[t]; ok || primitiveTypes[t] {
+		return t
+	}
+	log.Printf("Unknown data type %q of %s; using ST", t, f.Name)
+	return "ST"
+}
+
+// outputConformanceStatements writes the conformance statements of c to p as comments.
+func outputConformanceStatements(p *Printer, c *ComplexType) {
+	for _, cs := range c.ConformanceStatements {
+		if cs = strings.Join(strings.Fields(cs), " "); cs != "" {
+			p.P("// Conformance statement: %s", cs)
+		}
+	}
+}
+
 var (
 	nonWordCharacters                 = regexp.MustCompile(`\W+`)           // Not a letter, digit or underscore.
 	nonWordAndNotUnderscoreCharacters = regexp.MustCompile(`[^a-zA-Z0-9]+`) // Neither a letter nor a digit.
@@ -221,7 +264,7 @@ func tag(name string, required bool) string {
 //	}
 //
 // Deprecated types have type *NUL.
-func outputCompositeType(p *Printer, c *ComplexType, fields map[string]*ComplexType) {
+func outputCompositeType(p *Printer, c *ComplexType, spec *Specification) {
 	p.P("")
 	p.P("// %s represents the corresponding HL7 datatype.", c.Name)
 	p.P("// Definition from HL7 %s", c.Version)
@@ -229,15 +272,15 @@ func outputCompositeType(p *Printer, c *ComplexType, fields map[string]*ComplexT
 	{
 		p.In()
 		for _, e := range c.Elements {
-			f, ok := fields[e.Ref+".CONTENT"]
+			f, ok := spec.Fields[e.Ref+".CONTENT"]
 			if ok {
 				if e.MaxOccurs != "1" {
 					log.Fatalf("Datatype %s got e.MaxOccurs=%s, want 1: datatypes shouldn't have repeated components", e.Ref, e.MaxOccurs)
 				}
-				if e.Deprecated {
-					p.P("Deprecated%s *NUL `%s`", toFieldNameWithoutUnderscore(f.LongName), tag(docify(f.LongName), e.MinOccurs != "0"))
+				if e.Deprecated || f.IsWithdrawn() {
+					p.P("Deprecated%s *NUL `%s`", toFieldNameWithoutUnderscore(f.LongName), tag(docify(f.LongName), false))
 				} else {
-					p.P("%s *%s `%s`", toFieldNameWithoutUnderscore(f.LongName), f.Type(), tag(docify(f.LongName), e.MinOccurs != "0"))
+					p.P("%s *%s `%s`", toFieldNameWithoutUnderscore(f.LongName), fieldType(f, spec), tag(docify(f.LongName), e.MinOccurs != "0"))
 				}
 			} else {
 				log.Fatalf("Missing composite data type field: %s", e.Ref)
@@ -296,6 +339,7 @@ func outputMessageType(p *Printer, c *ComplexType, spec *Specification) {
 
 	p.P("// %s represents the corresponding HL7 message type.", name)
 	p.P("// Definition from HL7 %s", c.Version)
+	outputConformanceStatements(p, c)
 	p.P("type %s struct {", name)
 	{
 		p.In()
@@ -342,8 +386,8 @@ func outputMessageType(p *Printer, c *ComplexType, spec *Specification) {
 //	  ...
 //	}
 //
-// Deprecated fields have type *NUL.
-func outputSegment(p *Printer, c *ComplexType, fields map[string]*ComplexType) {
+// Deprecated and withdrawn fields have type *NUL.
+func outputSegment(p *Printer, c *ComplexType, spec *Specification) {
 	name := c.Name[0:3] // HL7 segment names are always the first three characters
 	if !segmentName.MatchString(c.Name) {
 		log.Fatalf("Not a segment name: %s", c.Name)
@@ -352,7 +396,7 @@ func outputSegment(p *Printer, c *ComplexType, fields map[string]*ComplexType) {
 	amendElements(c)
 	fieldNames := make([]string, len(c.Elements))
 	for i, e := range c.Elements {
-		f, ok := fields[e.Ref+".CONTENT"]
+		f, ok := spec.Fields[e.Ref+".CONTENT"]
 		if ok {
 			fieldNames[i] = toFieldName(f.LongName)
 		}
@@ -361,24 +405,29 @@ func outputSegment(p *Printer, c *ComplexType, fields map[string]*ComplexType) {
 
 	p.P("// %s represents the corresponding HL7 segment.", name)
 	p.P("// Definition from HL7 %s", c.Version)
+	outputConformanceStatements(p, c)
 	p.P("type %s struct {", name)
 	{
 		p.In()
 		for i, e := range c.Elements {
-			f, ok := fields[e.Ref+".CONTENT"]
+			f, ok := spec.Fields[e.Ref+".CONTENT"]
 			if ok {
 				// TODO: Find a way to represent HL7 NULLs
-				t := GoType(f.Type())
-				if e.MaxOccurs == "1" {
-					t = "*" + t
-				} else {
-					t = "[]" + t
-				}
-				if e.Deprecated {
-					p.P("Deprecated%s *NUL `%s` // %s-%d", strings.Replace(fieldNames[i], "_", "", -1), tag(docify(f.LongName), e.MinOccurs != "0"), name, i+1)
+				if e.Deprecated || f.IsWithdrawn() {
+					p.P("Deprecated%s *NUL `%s` // %s-%d", strings.Replace(fieldNames[i], "_", "", -1), tag(docify(f.LongName), e.MinOccurs != "0" && !f.IsWithdrawn()), name, i+1)
 				} else {
+					t := fieldType(f, spec)
+					if e.MaxOccurs == "1" {
+						t = "*" + t
+					} else {
+						t = "[]" + t
+					}
 					p.P("%s %s `%s` // %s-%d", strings.Replace(fieldNames[i], "_", "", -1), t, tag(docify(f.LongName), e.MinOccurs != "0"), name, i+1)
 				}
+			} else if e.Ref != "MSH.1" {
+				// Newer versions may reference fields that they no longer define because they
+				// have been withdrawn. Keep the field so that the next fields keep their positions.
+				p.P("Deprecated%s *NUL `%s` // %s-%d", strings.Replace(e.Ref, ".", "", -1), tag(e.Ref, false), name, i+1)
 			} else {
 				p.P("// Missing: %s", e.Ref)
 			}
@@ -1150,18 +1199,18 @@ func (i *sliceFlags) Set(value string) error {
 func main() {
 	schemaDirectory := flag.String("schema", "", "Directory containing the HL7 schema.")
 	extraDirectory := flag.String("extra_dir", "", "Directory containing synthetic message XSD files.")
-	maxVersion := flag.Int("max_hl7_version", 251, "The maximum HL7v2 version to generate schemas from, as a three digit integer: 240 for 2.4, 251 for 2.5.1, etc.")
+	maxVersion := flag.Int("max_hl7_version", 0, "The maximum HL7v2 version to generate schemas from, as a three digit integer: 240 for 2.4, 251 for 2.5.1, 290 for 2.9, etc. If 0, all the versions in --schema are used, up to the most recent one.")
 	var inputBlockListed sliceFlags
 	flag.Var(&inputBlockListed, "block_list", "Segments/messages/types to skip when parsing from xsd.  This flag can be specified multiple times.  i.e. --block_list=PPX --block_list=ORU")
 	flag.Parse()
 
 	blockListed := loadBlocklisted(inputBlockListed)
 
-	s := buildSpecification(blockListed, *maxVersion, *schemaDirectory, *extraDirectory)
+	s, version := buildSpecification(blockListed, *maxVersion, *schemaDirectory, *extraDirectory)
 	p := NewPrinter(os.Stdout)
 
 	log.Println("Generating code...")
-	outputHeader(s, p, *maxVersion)
+	outputHeader(s, p, version)
 	outputSpecification(s, p, blockListed)
 }
 
@@ -1204,21 +1253,26 @@ func loadVersions(schemaDirectory string) []string {
 	return versions
 }
 
-func buildSpecification(blockListed map[string]bool, maxVersion int, schemaDirectory, extraDirectory string) *Specification {
+// buildSpecification builds the specification from the versions in schemaDirectory up to
+// maxVersion, or up to the most recent one if maxVersion is 0. It returns the specification and
+// the most recent version used, as a three digit integer.
+func buildSpecification(blockListed map[string]bool, maxVersion int, schemaDirectory, extraDirectory string) (*Specification, int) {
 	versions := loadVersions(schemaDirectory)
 	sort.Sort(ByVersion(versions))
 	log.Printf("Found versions: %s", versions)
 
 	s := NewSpecification()
+	version := 0
 	for _, v := range versions {
 		sv := sortableVersion(v)
 		f := filepath.Join(schemaDirectory, v)
-		if sv <= maxVersion {
+		if maxVersion == 0 || sv <= maxVersion {
 			log.Printf("Processing version %s from %s", v, f)
 			err := ParseSpecification(f, v, blockListed, s)
 			if err != nil {
 				log.Fatal(err)
 			}
+			version = sv
 		} else {
 			log.Printf("Skipping version %s and above (--max_hl7_version=%d)", v, maxVersion)
 			break
@@ -1236,14 +1290,16 @@ func buildSpecification(blockListed map[string]bool, maxVersion int, schemaDirec
 	}
 	log.Printf("Finished processing. Specification: #CompositeTypes: %d, #Segments: %d, #MessageTypes: %d, #Fields: %d", len(s.CompositeTypes), len(s.Segments), len(s.MessageTypes), len(s.Fields))
 
-	// Correct issues in the specification that hinder code generation
+	// Correct issues in the specification that hinder code generation.
+	// The fields and types below may be missing if only newer versions, which withdraw them,
+	// are processed.
 	// The long name of XTN.1 is a format, that can't be turned into a valid name
-	if maxVersion > 230 {
-		s.Fields["XTN.1.CONTENT"].LongName = "Number"
+	if f, ok := s.Fields["XTN.1.CONTENT"]; ok && version > 230 {
+		f.LongName = "Number"
 	}
 	// ED has two fields named data
-	if maxVersion > 220 {
-		s.Fields["ED.3.CONTENT"].LongName = "Data Subtype"
+	if f, ok := s.Fields["ED.3.CONTENT"]; ok && version > 220 {
+		f.LongName = "Data Subtype"
 	}
 	// The XML schema defines a field for the field separator character (ie |)
 	// which is implicit in the text format
@@ -1253,11 +1309,11 @@ func buildSpecification(blockListed map[string]bool, maxVersion int, schemaDirec
 	s.Fields["MSH.2.CONTENT"].UpperCaseType = "Delimiters"
 	// CNS changed from a datatype to a segment in HL7 2.4, so we rename here to
 	// avoid a conflict.
-	if maxVersion > 230 {
-		s.CompositeTypes["CNS"].Name = "CNS231"
+	if c, ok := s.CompositeTypes["CNS"]; ok && version > 230 {
+		c.Name = "CNS231"
 	}
 
-	return s
+	return s, version
 }
 
 // amendElements fixes schemas that omit fields to indicate that they're deprecated.
@@ -1304,7 +1360,9 @@ func outputHeader(s *Specification, p *Printer, maxVersion int) {
 	p.P("package hl7")
 	p.P("")
 	p.P("import \"reflect\"")
-
+	p.P("")
+	p.P("// SchemaVersion is the HL7v2 version of the schema in this file.")
+	p.P("const SchemaVersion = %q", toHl7VersionName(maxVersion))
 	p.P("")
 }
 
@@ -1312,7 +1370,7 @@ func outputSpecification(s *Specification, p *Printer, blockListed map[string]bo
 	for _, k := range sortedMapKeys(s.CompositeTypes) {
 		c := s.CompositeTypes[k]
 		if !blockListed[c.Name] {
-			outputCompositeType(p, c, s.Fields)
+			outputCompositeType(p, c, s)
 		}
 	}
 
@@ -1320,7 +1378,7 @@ func outputSpecification(s *Specification, p *Printer, blockListed map[string]bo
 	for _, k := range sortedMapKeys(s.Segments) {
 		c := s.Segments[k]
 		if !blockListed[c.Name] {
-			outputSegment(p, c, s.Fields)
+			outputSegment(p, c, s)
 		}
 	}
 
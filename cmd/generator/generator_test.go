@@ -0,0 +1,178 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+// complexType returns the XML schema definition of a complex type with the given annotations and
+// elements, in the layout of the HL7v2 XML schemas.
+func complexType(name string, appinfo string, refs ...string) string {
+	var elements string
+	if len(refs) > 0 {
+		elements = "<xsd:sequence>"
+		for _, ref := range refs {
+			elements += `<xsd:element ref="` + ref + `" minOccurs="0" maxOccurs="1"/>`
+		}
+		elements += "</xsd:sequence>"
+	}
+	return `<xsd:complexType name="` + name + `">
+    <xsd:annotation><xsd:appinfo>` + appinfo + `</xsd:appinfo></xsd:annotation>` + elements + `
+  </xsd:complexType>`
+}
+
+func field(name, dataType, longName string) string {
+	return complexType(name, "<hl7:Type>"+dataType+"</hl7:Type><hl7:LongName>"+longName+"</hl7:LongName>")
+}
+
+func schema(types ...string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:hl7="urn:com.sun:encoder-hl7-1.0">
+  ` + strings.Join(types, "\n  ") + `
+</xsd:schema>`)
+}
+
+// writeSchema writes the XML schemas of a version to dir. The PV1 segment uses the layouts of
+// versions 2.7 and above: withdrawn fields are omitted, kept with the "-" or NULLDT data types, or
+// referenced without being defined, and some data types are not defined in the specification.
+func writeSchema(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string][]byte{
+		"fields.xsd": schema(
+			field("MSH.1.CONTENT", "ST", "Field Separator"),
+			field("MSH.2.CONTENT", "ST", "Encoding Characters"),
+			field("PV1.1.CONTENT", "SI", "Set ID - PV1"),
+			field("PV1.2.CONTENT", "CWE", "Patient Class"),
+			field("PV1.3.CONTENT", "-", "Assigned Patient Location"),
+			field("PV1.5.CONTENT", "NULLDT", "Preadmit Number"),
+			field("PV1.6.CONTENT", "ST", "Prior Patient Location (withdrawn)"),
+			field("PV1.7.CONTENT", "NEWDT", "Attending Doctor"),
+		),
+		"segments.xsd": schema(
+			complexType("MSH.CONTENT", "", "MSH.1", "MSH.2"),
+			complexType("PV1.CONTENT", `<hl7:ConformanceStatement>
+          PV1-1 SHALL be valued
+        </hl7:ConformanceStatement>`, "PV1.1", "PV1.2", "PV1.3", "PV1.5", "PV1.6", "PV1.7", "PV1.8"),
+		),
+		"datatypes.xsd": schema(
+			complexType("CWE", "", "CWE.1", "CWE.2"),
+			field("CWE.1.CONTENT", "ST", "Identifier"),
+			field("CWE.2.CONTENT", "-", "Text"),
+		),
+		"ACK.xsd": schema(complexType("ACK.CONTENT", "", "MSH")),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("os.MkdirAll(%s) failed with %v", dir, err)
+	}
+	for name, b := range files {
+		testwrite.BytesToFileInExistingDir(t, b, dir, name)
+	}
+}
+
+func TestBuildSpecification_Versions(t *testing.T) {
+	dir := testwrite.TempDir(t)
+	writeSchema(t, filepath.Join(dir, "2.8.2"))
+	writeSchema(t, filepath.Join(dir, "2.9"))
+
+	cases := []struct {
+		maxVersion  int
+		wantVersion int
+		wantDir     string
+	}{
+		{maxVersion: 0, wantVersion: 290, wantDir: "2.9"},
+		{maxVersion: 290, wantVersion: 290, wantDir: "2.9"},
+		{maxVersion: 282, wantVersion: 282, wantDir: "2.8.2"},
+	}
+	for _, tc := range cases {
+		s, got := buildSpecification(loadBlocklisted(nil), tc.maxVersion, dir, "")
+		if got != tc.wantVersion {
+			t.Errorf("buildSpecification(maxVersion=%d) got version %d, want %d", tc.maxVersion, got, tc.wantVersion)
+		}
+		if got := s.Segments["PV1.CONTENT"].Version; got != tc.wantDir {
+			t.Errorf("buildSpecification(maxVersion=%d) got PV1 from version %q, want %q", tc.maxVersion, got, tc.wantDir)
+		}
+	}
+}
+
+func TestOutputSegment(t *testing.T) {
+	dir := testwrite.TempDir(t)
+	writeSchema(t, filepath.Join(dir, "2.9"))
+	s, _ := buildSpecification(loadBlocklisted(nil), 0, dir, "")
+
+	var b bytes.Buffer
+	outputSegment(NewPrinter(&b), s.Segments["PV1.CONTENT"], s)
+	want := strings.Join([]string{
+		"// PV1 represents the corresponding HL7 segment.",
+		"// Definition from HL7 2.9",
+		// Conformance statements are written as comments, in a single line.
+		"// Conformance statement: PV1-1 SHALL be valued",
+		"type PV1 struct {",
+		"\tSetIDPV1 *SI `hl7:\"false,Set ID - PV1\"` // PV1-1",
+		"\tPatientClass *CWE `hl7:\"false,Patient Class\"` // PV1-2",
+		// Withdrawn with the "-" data type.
+		"\tDeprecatedAssignedPatientLocation *NUL `hl7:\"false,Assigned Patient Location\"` // PV1-3",
+		// Withdrawn by omitting the field.
+		"\tDeprecatedPV14 *NUL `hl7:\"false,PV1.4\"` // PV1-4",
+		// Withdrawn with the NULLDT data type.
+		"\tDeprecatedPreadmitNumber *NUL `hl7:\"false,Preadmit Number\"` // PV1-5",
+		// Withdrawn with "withdrawn" in its name.
+		"\tDeprecatedPriorPatientLocationWithdrawn *NUL `hl7:\"false,Prior Patient Location (Withdrawn)\"` // PV1-6",
+		// Data types that are not defined in the specification are ST.
+		"\tAttendingDoctor *ST `hl7:\"false,Attending Doctor\"` // PV1-7",
+		// Withdrawn by referencing a field that is not defined.
+		"\tDeprecatedPV18 *NUL `hl7:\"false,PV1.8\"` // PV1-8",
+		"}",
+		"",
+		"func (s *PV1) SegmentName() string {",
+		"\treturn \"PV1\"",
+		"}",
+		"",
+		"",
+	}, "\n")
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("outputSegment() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestOutputCompositeType(t *testing.T) {
+	dir := testwrite.TempDir(t)
+	writeSchema(t, filepath.Join(dir, "2.9"))
+	s, _ := buildSpecification(loadBlocklisted(nil), 0, dir, "")
+
+	var b bytes.Buffer
+	outputCompositeType(NewPrinter(&b), s.CompositeTypes["CWE"], s)
+	want := strings.Join([]string{
+		"",
+		"// CWE represents the corresponding HL7 datatype.",
+		"// Definition from HL7 2.9",
+		"type CWE struct {",
+		"\tIdentifier *ST `hl7:\"false,Identifier\"`",
+		// Withdrawn components are kept, so that the position of the next components does not change.
+		"\tDeprecatedText *NUL `hl7:\"false,Text\"`",
+		"}",
+		"",
+	}, "\n")
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("outputCompositeType() got diff (-want +got):\n%s", diff)
+	}
+}
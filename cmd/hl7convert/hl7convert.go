@@ -0,0 +1,205 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary hl7convert converts HL7v2 messages into JSON or YAML documents, and back.
+//
+// Usage:
+//
+//	hl7convert -from=hl7 -to=json < messages.out > messages.json
+//	hl7convert -from=yaml -to=hl7 -input=fixture.yml
+//
+// The input can contain several messages. HL7 messages can be in any of the formats that
+// Simulated Hospital writes, e.g., one segment per line with messages separated by blank lines, or
+// MLLP-framed. JSON documents are written one after another, and YAML documents are separated by
+// "---" lines. HL7 messages are written with one segment per line and an empty line after each one.
+// Fields are named after the HL7 schema that pkg/hl7 is built with, see hl7.SchemaVersion.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/google/simhospital/pkg/hl7"
+)
+
+const (
+	formatHL7  = "hl7"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+var (
+	from   = flag.String("from", formatHL7, "Format of the input: hl7, json or yaml")
+	to     = flag.String("to", formatJSON, "Format of the output: hl7, json or yaml")
+	input  = flag.String("input", "", "Path to the input file. If not set, the input is read from the standard input")
+	output = flag.String("output", "", "Path to the output file. If not set, the output is written to the standard output")
+
+	// yamlSeparator matches the lines that separate YAML documents.
+	yamlSeparator = regexp.MustCompile(`(?m)^---[ \t]*\r?$`)
+)
+
+func main() {
+	flag.Parse()
+	if err := hl7.TimezoneAndLocation("UTC"); err != nil {
+		logrus.WithError(err).Fatal("Cannot configure HL7 timezone and location")
+	}
+	if err := run(); err != nil {
+		logrus.WithError(err).Fatal("Cannot convert messages")
+	}
+}
+
+func run() error {
+	if *from == *to {
+		return fmt.Errorf("-from and -to must be different, got %q", *from)
+	}
+	in := os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return errors.Wrapf(err, "cannot open input file %s", *input)
+		}
+		defer f.Close()
+		in = f
+	}
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return errors.Wrapf(err, "cannot create output file %s", *output)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	messages, err := readMessages(in)
+	if err != nil {
+		return err
+	}
+	for i, m := range messages {
+		converted, err := convert(m)
+		if err != nil {
+			return errors.Wrapf(err, "message %d", i)
+		}
+		if err := write(w, i, converted); err != nil {
+			return errors.Wrap(err, "cannot write output")
+		}
+	}
+	return nil
+}
+
+// readMessages returns the messages or documents in the input, in the -from format.
+func readMessages(r io.Reader) ([][]byte, error) {
+	switch *from {
+	case formatHL7:
+		var messages [][]byte
+		reader := hl7.NewReader(r, nil)
+		for {
+			m, err := reader.Next()
+			if err == io.EOF {
+				return messages, nil
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot read HL7 messages")
+			}
+			messages = append(messages, m.Raw)
+		}
+	case formatJSON:
+		var messages [][]byte
+		dec := json.NewDecoder(r)
+		for {
+			var doc json.RawMessage
+			err := dec.Decode(&doc)
+			if err == io.EOF {
+				return messages, nil
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot read JSON documents")
+			}
+			messages = append(messages, doc)
+		}
+	case formatYAML:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read YAML documents")
+		}
+		var messages [][]byte
+		for _, doc := range yamlSeparator.Split(string(data), -1) {
+			if len(bytes.TrimSpace([]byte(doc))) > 0 {
+				messages = append(messages, []byte(doc))
+			}
+		}
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("invalid -from format %q; valid formats are hl7, json and yaml", *from)
+	}
+}
+
+// convert converts a message or document from the -from format into the -to format.
+func convert(in []byte) ([]byte, error) {
+	if *from != formatHL7 {
+		var message []byte
+		var err error
+		switch *from {
+		case formatJSON:
+			message, err = hl7.FromJSON(in)
+		case formatYAML:
+			message, err = hl7.FromYAML(in)
+		}
+		if err != nil || *to == formatHL7 {
+			return message, err
+		}
+		in = message
+	}
+	m, err := hl7.ParseMessage(in)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse HL7 message with the HL7 %s schema", hl7.SchemaVersion)
+	}
+	switch *to {
+	case formatJSON:
+		return hl7.ToJSON(m)
+	case formatYAML:
+		return hl7.ToYAML(m)
+	default:
+		return nil, fmt.Errorf("invalid -to format %q; valid formats are hl7, json and yaml", *to)
+	}
+}
+
+// write writes the i-th converted message or document in the -to format.
+func write(w io.Writer, i int, converted []byte) error {
+	var err error
+	switch *to {
+	case formatHL7:
+		_, err = fmt.Fprintf(w, "%s\n\n", bytes.Replace(converted, []byte(hl7.SegmentTerminatorStr), []byte("\n"), -1))
+	case formatJSON:
+		_, err = fmt.Fprintf(w, "%s\n", converted)
+	case formatYAML:
+		if i > 0 {
+			if _, err = fmt.Fprint(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		_, err = w.Write(converted)
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Binary replay re-sends the messages recorded by Simulated Hospital with -recording_file, keeping
+// the time between them.
+//
+// Usage:
+//
+//	replay -recording=recording.jsonl -output=mllp -mllp_destination=host:2575
+//	replay -recording=recording.jsonl -speed=10 -message_types=ADT^A01,ORU -regenerate_header
+//
+// The first message is sent straight away, and the others at the same time relative to the first
+// one as when they were recorded, divided by -speed. Messages are encoded in the character set
+// declared in their MSH-18 field before they are sent, like Simulated Hospital does.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/google/simhospital/pkg/replay"
+)
+
+var (
+	recording = flag.String("recording", "", "Path to the file with the recorded messages, written by Simulated Hospital with -recording_file")
+
+	// Flags that control which messages are replayed and how.
+	speed            = flag.Float64("speed", 1, "How much faster than in the recording messages are replayed, e.g., 2 for twice as fast. If 0, messages are replayed without waiting")
+	messageTypes     = flag.String("message_types", "", "Comma-separated types of the messages to replay, e.g., ADT or ADT^A01. If empty, messages of all types are replayed")
+	mrns             = flag.String("mrns", "", "Comma-separated MRNs of the patients whose messages are replayed. If empty, messages of all patients are replayed")
+	regenerateHeader = flag.Bool("regenerate_header", false, "Whether to set MSH-7 to the time when messages are replayed, and to prefix MSH-10 with -control_id_prefix")
+	controlIDPrefix  = flag.String("control_id_prefix", "", "Prefix of the control IDs of the replayed messages; only relevant if -regenerate_header=true. If empty, a prefix based on the current time is used")
+	hl7Timezone      = flag.String("hl7_timezone", "UTC", "The location for the timezone of MSH-7; only relevant if -regenerate_header=true")
+
+	// Flags for sending HL7 messages.
+	output          = flag.String("output", "stdout", "Where the replayed HL7 messages will be sent: [stdout, mllp, file]")
+	outputFile      = flag.String("output_file", "messages.out", "File path to write messages if -output=file")
+	mllpDestination = flag.String("mllp_destination", "", "Host:Port to which MLLP messages will be sent; only relevant if -output=mllp")
+
+	logLevel = flag.String("log_level", "INFO", "The logging granularity. One of PANIC, FATAL, ERROR, WARN, INFO, DEBUG. Not case sensitive")
+
+	log = logging.ForCallerPackage()
+)
+
+func main() {
+	flag.Parse()
+	if err := logging.SetLogLevelFromString(*logLevel); err != nil {
+		logrus.WithError(err).WithField("log_level", *logLevel).Fatal("Cannot configure logger")
+	}
+	if err := hl7.TimezoneAndLocation(*hl7Timezone); err != nil {
+		log.WithError(err).Fatal("Cannot configure HL7 timezone and location")
+	}
+
+	// Stop replaying on SIGINT and SIGTERM, and close the sender so that the output is complete.
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	if err := run(ctx); err != nil {
+		log.WithError(err).Fatal("Cannot replay messages")
+	}
+}
+
+func run(ctx context.Context) error {
+	if *recording == "" {
+		return errors.New("-recording must be set")
+	}
+	f, err := os.Open(*recording)
+	if err != nil {
+		return errors.Wrapf(err, "cannot open recording %s", *recording)
+	}
+	messages, err := hl7.ReadRecording(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	options := replay.Options{
+		Speed:            *speed,
+		MessageTypes:     split(*messageTypes),
+		MRNs:             split(*mrns),
+		RegenerateHeader: *regenerateHeader,
+		ControlIDPrefix:  *controlIDPrefix,
+	}
+	if options.RegenerateHeader && options.ControlIDPrefix == "" {
+		// MSH-10 is limited to 20 characters, so keep the prefix short. The replay stops at the first
+		// message whose prefixed control ID is longer than that.
+		options.ControlIDPrefix = fmt.Sprintf("R%s-", strconv.FormatInt(time.Now().Unix(), 36))
+		log.Infof("Prefixing the control IDs of the replayed messages with %s", options.ControlIDPrefix)
+	}
+
+	sender, err := newSender()
+	if err != nil {
+		return errors.Wrap(err, "cannot create sender")
+	}
+	// Messages are recorded as UTF-8, and encoded in the character set they declare when sent.
+	sender = hl7.NewEncodingSender(sender)
+	defer sender.Close()
+
+	r, err := replay.New(sender, options)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Replay(ctx, messages); err != nil && errors.Cause(err) != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+func newSender() (hl7.Sender, error) {
+	switch *output {
+	case "stdout":
+		return hl7.NewStdoutSender(), nil
+	case "mllp":
+		return hl7.NewMLLPSender(*mllpDestination, false, 0)
+	case "file":
+		return hl7.NewFileSender(*outputFile)
+	default:
+		return nil, fmt.Errorf("invalid -output %q; valid values are stdout, mllp and file", *output)
+	}
+}
+
+// split returns the comma-separated values in s, or nil if s is empty.
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/google/simhospital/pkg/config"
+	"github.com/google/simhospital/pkg/fault"
 	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/hospital"
 	"github.com/google/simhospital/pkg/hospital/runner"
@@ -58,7 +59,9 @@ var (
 	ethnicityFile          = flag.String("ethnicity_file", "configs/hl7_messages/ethnicity.csv", "Path to a CSV file with the ethnicities and how often they occur. This file can be a local file or a GCS object.")
 	patientClassFile       = flag.String("patient_class_file", "configs/hl7_messages/patient_class.csv", "Path to a CSV file with the patient classes and types and how often they occur. This file can be a local file or a GCS object.")
 	doctorsFile            = flag.String("doctors_file", "configs/hl7_messages/doctors.yml", "Path to a YAML file with the doctors. This file can be a local file or a GCS object.")
+	comorbiditiesFile      = flag.String("comorbidities_file", "configs/hl7_messages/comorbidities.yml", "Path to a YAML file with the comorbidities of new patients and their prevalence. Set to an empty string to create patients without comorbidities. This file can be a local file or a GCS object.")
 	orderProfilesFile      = flag.String("order_profile_file", "configs/hl7_messages/order_profiles.yml", "Path to a YAML file with the definition of the order profiles. This file can be a local file or a GCS object.")
+	zSegmentsFile          = flag.String("z_segments_file", "configs/hl7_messages/z_segments.yml", "Path to a YAML file with the definitions of custom Z-segments, whose fields can be populated from pathways. This file can be a local file or a GCS object.")
 
 	// Flags that control resource generation.
 	resourceOutput    = flag.String("resource_output", "stdout", "Where the generated resources will be written: [stdout, file, cloud]")
@@ -79,14 +82,50 @@ var (
 	// Flags that control logging and monitoring.
 	logLevel             = flag.String("log_level", "INFO", "The logging granularity. One of PANIC, FATAL, ERROR, WARN, INFO, DEBUG. Not case sensitive")
 	metricsListenAddress = flag.String("metrics_listen_address", ":9095", "Address on which to expose an HTTP server with a /metrics endpoint for Prometheus to scrape")
+	tracingOutput        = flag.String("tracing_output", "", "Where the traces of the pathways and their events are exported: [stdout, otlp]. If empty, pathways and events are not traced")
+	tracingOTLPEndpoint  = flag.String("tracing_otlp_endpoint", "http://localhost:4318", "URL of the OpenTelemetry collector that receives traces over OTLP/HTTP; only relevant if -tracing_output=otlp")
+
+	// Flags for exporting the ground truth.
+	groundTruthDir    = flag.String("ground_truth_dir", "", "Directory where the state of the patients after each event is written. If empty, the ground truth is not exported")
+	groundTruthFormat = flag.String("ground_truth_format", "json", "Format of the ground truth: [json, csv]; only relevant if -ground_truth_dir is set")
+
+	// Flags for tagging messages with their provenance.
+	provenanceSegment = flag.String("provenance_segment", "", "Name of the Z-segment with the pathway and step that generated each message, e.g., ZSH. If empty, the segment is not added")
+	provenanceLog     = flag.String("provenance_log", "", "File where the pathway and step that generated each message are written, by message control ID. If empty, the provenance is not logged")
+	provenanceRunID   = flag.String("provenance_run_id", "", "ID of this run in the provenance of the messages. If empty, a random ID is used")
+	provenanceTags    = flag.String("provenance_tags", "", "Comma-separated tags that describe the scenario in the provenance of the messages")
 
 	// Flags for sending HL7 messages.
 	hl7Timezone           = flag.String("hl7_timezone", "UTC", "The location for the timezone for dates in the generated HL7 messages. The specified location must be installed on the operating system")
-	output                = flag.String("output", "stdout", "Where the generated HL7 messages will be sent: [stdout, mllp, file]")
+	output                = flag.String("output", "stdout", "Where the generated HL7 messages will be sent: [stdout, mllp, file, batch_file]")
 	mllpDestination       = flag.String("mllp_destination", "", "Host:Port to which MLLP messages will be sent; only relevant if -output=mllp")
 	mllpKeepAlive         = flag.Bool("mllp_keep_alive", false, "Whether to send keep-alive messages on the MLLP connection; only relevant if -output=mllp")
 	mllpKeepAliveInterval = flag.Duration("mllp_keep_alive_interval", time.Minute, "Interval between keep-alive messages; only relevant if -output=mllp and -mllp_keep_alive=true")
-	outputFile            = flag.String("output_file", "messages.out", "File path to write messages if -output=file")
+	outputFile            = flag.String("output_file", "messages.out", "File path to write messages if -output=file or -output=batch_file")
+	batchMaxMessages      = flag.Int("batch_max_messages", 0, "Maximum number of messages in each batch of the batch file, or 0 for no limit; only relevant if -output=batch_file")
+	batchWindow           = flag.Duration("batch_window", 0, "Maximum time that each batch of the batch file spans, or 0 for no limit; only relevant if -output=batch_file")
+	recordingFile         = flag.String("recording_file", "", "File where the messages sent are recorded with the time when they were sent, to replay them with cmd/replay. If empty, messages are not recorded")
+
+	// Flags for load tests.
+	loadTestConnections = flag.Int("load_test_connections", 0, "Number of MLLP connections to send messages on in parallel in load-test mode. If positive, Simulated Hospital runs in load-test mode: "+
+		"pathways are started regardless of -pathways_per_hour, and events and messages are processed as soon as possible rather than when they are due. Only supported if -output=mllp")
+	loadTestMessagesPerSecond = flag.Float64("load_test_messages_per_second", 0, "Target number of messages sent per second in load-test mode. If 0, messages are sent as fast as they are acknowledged")
+	loadTestReportFile        = flag.String("load_test_report_file", "", "File where the throughput and latency report is written as JSON at the end of a load test. If empty, the report is only logged")
+
+	// Flags for injecting delivery faults into the messages sent.
+	faultDuplicate       = flag.Float64("fault_duplicate", 0, "Probability of sending a message twice")
+	faultReorder         = flag.Float64("fault_reorder", 0, "Probability of holding a message back and sending it after the next message of the same patient")
+	faultDrop            = flag.Float64("fault_drop", 0, "Probability of not sending a message")
+	faultTruncate        = flag.Float64("fault_truncate", 0, "Probability of sending a message cut at a random point after the MSH segment")
+	faultCorrupt         = flag.Float64("fault_corrupt", 0, "Probability of overwriting a few bytes of a segment of a message")
+	faultCloseConnection = flag.Float64("fault_close_connection", 0, "Probability of closing the MLLP connection while sending a message; only relevant if -output=mllp")
+	faultMaxHold         = flag.Duration("fault_max_hold", fault.DefaultMaxHold, "Maximum time that a message is held back by -fault_reorder before it is sent, even if no other message of the same patient has been sent")
+	faultLog             = flag.String("fault_log", "", "File where the faults injected into messages are written as lines of JSON. If empty, faults are only logged")
+	faultSeed            = flag.Int64("fault_seed", 0, "Seed to decide which faults to inject, to reproduce a run. If 0, a random seed is used")
+
+	// Flags that control the validation of the generated HL7 messages.
+	validateOutput       = flag.Bool("validate_output", false, "Whether to validate every generated HL7 message against the HL7 schema and the checks in -validation_config_file before sending it. Messages with validation issues are logged, and sent anyway")
+	validationConfigFile = flag.String("validation_config_file", "configs/hl7_messages/validation.yml", "Path to a YAML file with the HL7 tables and field checks to validate messages with; only relevant if -validate_output=true. This file can be a local file or a GCS object.")
 
 	// Flags that control how pathways run.
 	pathwaysDir        = flag.String("pathways_dir", "configs/pathways", "Path to a directory with YAML files with definitions of pathways. This directory can be on the local file system or GCS.")
@@ -104,6 +143,11 @@ var (
 	dashboardURI     = flag.String("dashboard_uri", "simulated-hospital", "Base URI at which the dashboard and endpoints are available")
 	dashboardAddress = flag.String("dashboard_address", ":8000", "Address for the dashboard to control Simulated Hospital")
 	staticDir        = flag.String("static_dir", "web/static", "Directory for static assets")
+	messageLogSize   = flag.Int("message_log_size", 1000, "Number of the most recent sent messages to keep in memory, to search them from the dashboard and the control API. If 0, sent messages are not kept")
+
+	// Flags that control the authenticated control API.
+	apiAddress = flag.String("api_address", "", "Address on which to serve the authenticated control API. If set, -api_key must also be set")
+	apiKey     = flag.String("api_key", "", "Key that clients of the control API must send in the Authorization header. If set, -api_address must also be set")
 
 	// flagset tracks what flags have been set in the command line.
 	flagset = make(map[string]bool)
@@ -138,6 +182,7 @@ func main() {
 			log.WithError(err).Error("Error when closing Hospital Runner")
 		}
 	}()
+	onControlSignals(hr)
 	hr.Run(ctx)
 }
 
@@ -153,6 +198,27 @@ func onShutdown(cancel context.CancelFunc) {
 	}()
 }
 
+// onControlSignals handles the signals that control the simulation: SIGUSR1 pauses the simulation
+// if it is running and resumes it if it is paused, and SIGUSR2 drains it.
+func onControlSignals(hr *runner.Hospital) {
+	go func() {
+		s := make(chan os.Signal, 1)
+		signal.Notify(s, syscall.SIGUSR1, syscall.SIGUSR2)
+		for sig := range s {
+			switch sig {
+			case syscall.SIGUSR1:
+				if hr.State().Paused {
+					hr.Resume()
+				} else {
+					hr.Pause()
+				}
+			case syscall.SIGUSR2:
+				hr.Drain()
+			}
+		}
+	}()
+}
+
 func createRunner(ctx context.Context) (*runner.Hospital, error) {
 	flag.Visit(func(f *flag.Flag) { flagset[f.Name] = true })
 
@@ -161,6 +227,10 @@ func createRunner(ctx context.Context) (*runner.Hospital, error) {
 		include = strings.Split(*pathwayNames, ",")
 	}
 	exclude := strings.Split(*excludePathwayNames, ",")
+	var provenanceTagList []string
+	if *provenanceTags != "" {
+		provenanceTagList = strings.Split(*provenanceTags, ",")
+	}
 	arguments := hospital.Arguments{
 		LocationsFile:            addLocalPathIfNotSetAndNotNil(locationsFile, "locations_file"),
 		HardcodedMessagesDir:     addLocalPathIfNotSetAndNotNil(hardcodedMessagesDir, "hardcoded_messages_dir"),
@@ -168,7 +238,24 @@ func createRunner(ctx context.Context) (*runner.Hospital, error) {
 		HeaderConfigFile:         addLocalPathIfNotSetAndNotNil(headerConfigFile, "header_config_file"),
 		DoctorsFile:              addLocalPathIfNotSetAndNotNil(doctorsFile, "doctors_file"),
 		OrderProfilesFile:        addLocalPathIfNotSetAndNotNil(orderProfilesFile, "order_profile_file"),
+		ValidationConfigFile:     validationConfig(),
+		ZSegmentsFile:            addLocalPathIfNotSetAndNotNil(zSegmentsFile, "z_segments_file"),
 		DeletePatientsFromMemory: *deletePatientsFromMemory,
+		MessageLogSize:           *messageLogSize,
+		TracingArguments: &hospital.TracingArguments{
+			Output:       *tracingOutput,
+			OTLPEndpoint: *tracingOTLPEndpoint,
+		},
+		GroundTruthArguments: &hospital.GroundTruthArguments{
+			Dir:    *groundTruthDir,
+			Format: *groundTruthFormat,
+		},
+		ProvenanceArguments: &hospital.ProvenanceArguments{
+			Segment: *provenanceSegment,
+			LogFile: *provenanceLog,
+			RunID:   *provenanceRunID,
+			Tags:    provenanceTagList,
+		},
 		PathwayArguments: &hospital.PathwayArguments{
 			Dir:          addLocalPathIfNotSet(*pathwaysDir, "pathways_dir"),
 			Type:         *pathwayManagerType,
@@ -187,9 +274,28 @@ func createRunner(ctx context.Context) (*runner.Hospital, error) {
 		SenderArguments: &hospital.SenderArguments{
 			Output:                *output,
 			OutputFile:            *outputFile,
+			BatchMaxMessages:      *batchMaxMessages,
+			BatchWindow:           *batchWindow,
 			MllpDestination:       *mllpDestination,
 			MllpKeepAlive:         *mllpKeepAlive,
 			MllpKeepAliveInterval: mllpKeepAliveInterval,
+			RecordingFile:         *recordingFile,
+		},
+		FaultArguments: &hospital.FaultArguments{
+			Duplicate:       *faultDuplicate,
+			Reorder:         *faultReorder,
+			Drop:            *faultDrop,
+			Truncate:        *faultTruncate,
+			Corrupt:         *faultCorrupt,
+			CloseConnection: *faultCloseConnection,
+			MaxHold:         *faultMaxHold,
+			LogFile:         *faultLog,
+			Seed:            *faultSeed,
+		},
+		LoadTestArguments: &hospital.LoadTestArguments{
+			Connections:       *loadTestConnections,
+			MessagesPerSecond: *loadTestMessagesPerSecond,
+			ReportFile:        *loadTestReportFile,
 		},
 		DataFiles: &config.DataFiles{
 			Nouns:             addLocalPathIfNotSet(*nounsFile, "nouns_file"),
@@ -204,6 +310,7 @@ func createRunner(ctx context.Context) (*runner.Hospital, error) {
 			PatientClass:      addLocalPathIfNotSet(*patientClassFile, "patient_class_file"),
 			SampleNotesDir:    addLocalPathIfNotSet(*sampleNotesDir, "sample_notes_directory"),
 			ClinicalNoteTypes: addLocalPathIfNotSet(*clinicalNoteTypesFile, "clinical_note_types_file"),
+			Comorbidities:     addLocalPathIfNotSet(*comorbiditiesFile, "comorbidities_file"),
 		},
 	}
 
@@ -225,9 +332,23 @@ func createRunner(ctx context.Context) (*runner.Hospital, error) {
 		SleepFor:           *sleepFor,
 		Clock:              config.Clock,
 		MaxPathways:        *maxPathways,
+		LoadTest:           *loadTestConnections > 0,
+		AuthenticatedAPIConfig: runner.APIConfig{
+			APIPort: *apiAddress,
+			APIKey:  *apiKey,
+		},
 	})
 }
 
+// validationConfig returns the path to the validation configuration if the output needs to be
+// validated, or nil otherwise.
+func validationConfig() *string {
+	if !*validateOutput {
+		return nil
+	}
+	return addLocalPathIfNotSetAndNotNil(validationConfigFile, "validation_config_file")
+}
+
 func addLocalPathIfNotSetAndNotNil(f *string, n string) *string {
 	if f == nil {
 		return nil
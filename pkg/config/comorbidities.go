@@ -0,0 +1,150 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"github.com/google/simhospital/pkg/constants"
+	"github.com/google/simhospital/pkg/files"
+	"github.com/google/simhospital/pkg/ir"
+)
+
+// Sex values that can be used in the prevalence of comorbidities.
+const (
+	sexMale   = "M"
+	sexFemale = "F"
+)
+
+// Comorbidity is a long-term condition that patients may have when they are created, with a prevalence
+// that depends on their sex and age.
+type Comorbidity struct {
+	// Description is the code and description of the condition.
+	Description *ir.CodedElement
+	// Prevalence contains the percentages of people with the condition per sex and age band.
+	Prevalence []Prevalence
+	// AbnormalResults maps the names of the test types whose results are affected by the condition to
+	// the type of abnormal value: ABNORMAL_HIGH or ABNORMAL_LOW.
+	AbnormalResults map[string]string
+}
+
+// Prevalence is the percentage of people of a given sex and age band who have a condition.
+type Prevalence struct {
+	// Gender is the HL7 value of the sex the prevalence applies to, or empty if it applies to all.
+	Gender string
+	// AgeFrom is the age in years from which the prevalence applies, inclusive.
+	AgeFrom int
+	// AgeTo is the age in years until which the prevalence applies, exclusive.
+	// Zero means that there is no upper limit.
+	AgeTo int
+	// Percentage is the percentage of people with the condition, from 0 to 100.
+	Percentage float64
+}
+
+type comorbidity struct {
+	Code             string
+	Description      string
+	AlternateCodings []coding `yaml:"alternate_codings"`
+	Prevalence       []prevalence
+	AbnormalResults  map[string]string `yaml:"abnormal_results"`
+}
+
+type coding struct {
+	ID           string
+	Text         string
+	CodingSystem string `yaml:"coding_system"`
+}
+
+type prevalence struct {
+	Sex        string
+	AgeFrom    int `yaml:"age_from"`
+	AgeTo      int `yaml:"age_to"`
+	Percentage float64
+}
+
+// loadComorbidities loads the comorbidities from the given YAML file. The codes of the comorbidities use
+// the coding system of diagnoses.
+func loadComorbidities(ctx context.Context, fileName string, hc *HL7Config) ([]Comorbidity, error) {
+	data, err := files.Read(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	var cs []comorbidity
+	if err := yaml.UnmarshalStrict(data, &cs); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal comorbidities from file %q", fileName)
+	}
+	comorbidities := make([]Comorbidity, len(cs))
+	for i, c := range cs {
+		comorbidity, err := newComorbidity(c, hc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid comorbidity %q", c.Description)
+		}
+		comorbidities[i] = comorbidity
+	}
+	return comorbidities, nil
+}
+
+func newComorbidity(c comorbidity, hc *HL7Config) (Comorbidity, error) {
+	if c.Code == "" || c.Description == "" {
+		return Comorbidity{}, fmt.Errorf("code and description are required, got code=%q and description=%q", c.Code, c.Description)
+	}
+	ce := &ir.CodedElement{ID: c.Code, Text: c.Description, CodingSystem: hc.Diagnosis.CodingSystem}
+	for _, a := range c.AlternateCodings {
+		if a.ID == "" || a.CodingSystem == "" {
+			return Comorbidity{}, fmt.Errorf("invalid alternate coding %+v: id and coding_system are required", a)
+		}
+		ce.AlternateCodings = append(ce.AlternateCodings, ir.Coding{ID: a.ID, Text: a.Text, CodingSystem: a.CodingSystem})
+	}
+	for testName, v := range c.AbnormalResults {
+		if v != constants.AbnormalHigh && v != constants.AbnormalLow {
+			return Comorbidity{}, fmt.Errorf("invalid abnormal result %q for test type %q; must be one of [%s, %s]", v, testName, constants.AbnormalHigh, constants.AbnormalLow)
+		}
+	}
+	comorbidity := Comorbidity{Description: ce, AbnormalResults: c.AbnormalResults}
+	for _, p := range c.Prevalence {
+		prevalence, err := newPrevalence(p, hc.Gender)
+		if err != nil {
+			return Comorbidity{}, err
+		}
+		comorbidity.Prevalence = append(comorbidity.Prevalence, prevalence)
+	}
+	return comorbidity, nil
+}
+
+func newPrevalence(p prevalence, gender Gender) (Prevalence, error) {
+	pr := Prevalence{AgeFrom: p.AgeFrom, AgeTo: p.AgeTo, Percentage: p.Percentage}
+	switch p.Sex {
+	case "":
+	case sexMale:
+		pr.Gender = gender.Male
+	case sexFemale:
+		pr.Gender = gender.Female
+	default:
+		return Prevalence{}, fmt.Errorf("invalid sex %q in prevalence; must be one of [%s, %s]", p.Sex, sexMale, sexFemale)
+	}
+	if p.Sex != "" && pr.Gender == "" {
+		return Prevalence{}, fmt.Errorf("cannot use sex %q in prevalence: no gender values in the HL7 config", p.Sex)
+	}
+	if p.AgeFrom < 0 || p.AgeTo < 0 || (p.AgeTo != 0 && p.AgeTo <= p.AgeFrom) {
+		return Prevalence{}, fmt.Errorf("invalid age band in prevalence: age_from=%d, age_to=%d", p.AgeFrom, p.AgeTo)
+	}
+	if p.Percentage < 0 || p.Percentage > 100 {
+		return Prevalence{}, fmt.Errorf("invalid percentage %v in prevalence; must be between 0 and 100", p.Percentage)
+	}
+	return pr, nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+func TestLoadComorbidities(t *testing.T) {
+	ctx := context.Background()
+	hl7Config := &HL7Config{
+		Diagnosis: HL7Diagnosis{CodingSystem: "diagnosis-cs"},
+		Gender:    Gender{Male: "M", Female: "F", Unknown: "U"},
+	}
+
+	cases := []struct {
+		name    string
+		yml     string
+		want    []Comorbidity
+		wantErr bool
+	}{{
+		name: "valid",
+		yml: `
+- code: "709044004"
+  description: Chronic kidney disease
+  alternate_codings:
+    - id: N18.9
+      text: Chronic kidney disease, unspecified
+      coding_system: I10
+  prevalence:
+    - sex: M
+      age_from: 40
+      age_to: 65
+      percentage: 5
+    - age_from: 65
+      percentage: 12.5
+  abnormal_results:
+    Creatinine: ABNORMAL_HIGH
+- code: "38341003"
+  description: Hypertension
+  prevalence:
+    - percentage: 10`,
+		want: []Comorbidity{{
+			Description: &ir.CodedElement{
+				ID:               "709044004",
+				Text:             "Chronic kidney disease",
+				CodingSystem:     "diagnosis-cs",
+				AlternateCodings: []ir.Coding{{ID: "N18.9", Text: "Chronic kidney disease, unspecified", CodingSystem: "I10"}},
+			},
+			Prevalence: []Prevalence{
+				{Gender: "M", AgeFrom: 40, AgeTo: 65, Percentage: 5},
+				{AgeFrom: 65, Percentage: 12.5},
+			},
+			AbnormalResults: map[string]string{"Creatinine": "ABNORMAL_HIGH"},
+		}, {
+			Description: &ir.CodedElement{ID: "38341003", Text: "Hypertension", CodingSystem: "diagnosis-cs"},
+			Prevalence:  []Prevalence{{Percentage: 10}},
+		}},
+	}, {
+		name: "missing code",
+		yml: `
+- description: Hypertension`,
+		wantErr: true,
+	}, {
+		name: "invalid sex",
+		yml: `
+- code: "38341003"
+  description: Hypertension
+  prevalence:
+    - sex: X
+      percentage: 10`,
+		wantErr: true,
+	}, {
+		name: "invalid age band",
+		yml: `
+- code: "38341003"
+  description: Hypertension
+  prevalence:
+    - age_from: 65
+      age_to: 40
+      percentage: 10`,
+		wantErr: true,
+	}, {
+		name: "invalid percentage",
+		yml: `
+- code: "38341003"
+  description: Hypertension
+  prevalence:
+    - percentage: 110`,
+		wantErr: true,
+	}, {
+		name: "invalid abnormal result",
+		yml: `
+- code: "709044004"
+  description: Chronic kidney disease
+  abnormal_results:
+    Creatinine: HIGH`,
+		wantErr: true,
+	}, {
+		name: "unknown field",
+		yml: `
+- code: "38341003"
+  description: Hypertension
+  unknown: value`,
+		wantErr: true,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := testwrite.BytesToFile(t, []byte(tc.yml))
+			got, err := loadComorbidities(ctx, f, hl7Config)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("loadComorbidities(%s) got err=%v; want err? %t", tc.yml, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("loadComorbidities(%s) got diff (-want +got):\n%s", tc.yml, diff)
+			}
+		})
+	}
+}
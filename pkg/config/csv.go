@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/google/simhospital/pkg/files"
@@ -36,6 +37,8 @@ const nilKey = "nil"
 type RecordWithFreq struct {
 	Value  map[string]string
 	Weight uint
+	// Extra are the optional columns between the ones in Value and the frequency, if allowed.
+	Extra []string
 }
 
 // loadCSVWithFrequency loads a CSV file where each row is a list of strings and the last
@@ -67,12 +70,22 @@ type RecordWithFreq struct {
 //  (etc).
 //}
 func loadCSVWithFrequency(ctx context.Context, fName string, columnKeys []string) ([]RecordWithFreq, error) {
+	return loadCSVWithFrequencyAndExtraColumns(ctx, fName, columnKeys, false)
+}
+
+// loadCSVWithFrequencyAndExtraColumns works as loadCSVWithFrequency, but if allowExtra is true, rows can have
+// any number of additional columns between the ones for columnKeys and the frequency.
+// The additional columns are set in RecordWithFreq.Extra.
+func loadCSVWithFrequencyAndExtraColumns(ctx context.Context, fName string, columnKeys []string, allowExtra bool) ([]RecordWithFreq, error) {
 	b, err := files.Read(ctx, fName)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot open file %s", fName)
 	}
 	reader := csv.NewReader(bytes.NewReader(b))
 	reader.Comment = '#'
+	if allowExtra {
+		reader.FieldsPerRecord = -1
+	}
 	var records []RecordWithFreq
 	nColumns := len(columnKeys) + 1
 	for record, err := reader.Read(); err != io.EOF; record, err = reader.Read() {
@@ -80,7 +93,10 @@ func loadCSVWithFrequency(ctx context.Context, fName string, columnKeys []string
 			return nil, errors.Wrapf(err, "cannot read file %s", fName)
 		}
 
-		if len(record) != nColumns {
+		switch {
+		case allowExtra && len(record) < nColumns:
+			return nil, fmt.Errorf("cannot load frequencies from file %s: got %d elements in one line, want at least %d", fName, len(record), nColumns)
+		case !allowExtra && len(record) != nColumns:
 			return nil, fmt.Errorf("cannot load frequencies from file %s: got %d elements in one line, want %d", fName, len(record), nColumns)
 		}
 
@@ -95,15 +111,19 @@ func loadCSVWithFrequency(ctx context.Context, fName string, columnKeys []string
 		if countNil == nColumns-1 {
 			m = nil
 		}
-		frequencyField := record[nColumns-1]
+		frequencyField := record[len(record)-1]
 		weight, err := strconv.ParseInt(frequencyField, 10, 32)
 		if err != nil {
 			return nil, errors.Wrapf(err, "cannot load frequencies from file %s: got frequency %s, want int", fName, frequencyField)
 		}
-		records = append(records, RecordWithFreq{
+		r := RecordWithFreq{
 			Value:  m,
 			Weight: uint(weight),
-		})
+		}
+		if len(record) > nColumns {
+			r.Extra = record[nColumns-1 : len(record)-1]
+		}
+		records = append(records, r)
 	}
 	return records, nil
 }
@@ -111,12 +131,15 @@ func loadCSVWithFrequency(ctx context.Context, fName string, columnKeys []string
 // loadCodedElements loads a CSV file where each row contains one coded element and its frequency.
 // The first element of each row is the code of the coded element, the second is its description,
 // and the last one is the frequency.
+// If allowAlternates is true, the rows can have additional columns before the frequency with the codes for
+// the same concept in other coding systems, in the format <code>^<description>^<coding system>, e.g.,
+// "22298006,Myocardial infarction,I21.9^^I10,10". The description of the alternate codes is optional.
 // allowNil specifies whether nil rows are allowed. A nil row is of the form "nil,nil,<frequency>".
-func loadCodedElements(ctx context.Context, fileName string, codingSystem string, allowNil bool) ([]MappableWeightedValue, error) {
+func loadCodedElements(ctx context.Context, fileName string, codingSystem string, allowNil bool, allowAlternates bool) ([]MappableWeightedValue, error) {
 	idKey := "id"
 	textKey := "text"
 
-	recordsWithFrequency, err := loadCSVWithFrequency(ctx, fileName, []string{idKey, textKey})
+	recordsWithFrequency, err := loadCSVWithFrequencyAndExtraColumns(ctx, fileName, []string{idKey, textKey}, allowAlternates)
 	if err != nil {
 		return nil, err
 	}
@@ -128,12 +151,17 @@ func loadCodedElements(ctx context.Context, fileName string, codingSystem string
 		}
 		id := record.Value[idKey]
 		key := record.Value[textKey]
+		alternates, err := alternateCodings(record.Extra)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load coded elements from file %s", fileName)
+		}
 		values = append(values, MappableWeightedValue{
 			WeightedVal: sample.WeightedValue{
 				Value: &ir.CodedElement{
-					ID:           id,
-					Text:         key,
-					CodingSystem: codingSystem,
+					ID:               id,
+					Text:             key,
+					CodingSystem:     codingSystem,
+					AlternateCodings: alternates,
 				},
 				Frequency: record.Weight,
 			},
@@ -143,6 +171,19 @@ func loadCodedElements(ctx context.Context, fileName string, codingSystem string
 	return values, nil
 }
 
+// alternateCodings parses the given alternate codes in the format <code>^<description>^<coding system>.
+func alternateCodings(columns []string) ([]ir.Coding, error) {
+	var codings []ir.Coding
+	for _, c := range columns {
+		parts := strings.Split(c, "^")
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid alternate code %q; want <code>^<description>^<coding system>", c)
+		}
+		codings = append(codings, ir.Coding{ID: parts[0], Text: parts[1], CodingSystem: parts[2]})
+	}
+	return codings, nil
+}
+
 func ethnicities(ctx context.Context, fileName string) ([]sample.WeightedValue, error) {
 	idKey := "id"
 	textKey := "text"
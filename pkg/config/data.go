@@ -23,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 	"github.com/google/simhospital/pkg/files"
+	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/logging"
 	"github.com/google/simhospital/pkg/sample"
 )
@@ -57,6 +58,8 @@ type Data struct {
 	// NotesConfig maps file extensions with available list of sample notes.
 	NotesConfig       map[string][]ClinicalNote
 	ClinicalNoteTypes []string
+	// Comorbidities are the long-term conditions that new patients may have.
+	Comorbidities []Comorbidity
 }
 
 type simpleConfig struct {
@@ -93,6 +96,61 @@ type PatientName struct {
 	// MiddlenamePercentage is a percentage of people with middlenames,
 	// from 0 to 100.
 	MiddlenamePercentage int `yaml:"middlename_percentage"`
+	// Locales contains the names of people from other locales, e.g., with accented or non-Latin
+	// names. People whose names are not from any locale get names from the census data.
+	Locales []NameLocale
+}
+
+// NameLocale contains the names of the people from a locale.
+type NameLocale struct {
+	// Name is the name of the locale, e.g., "es" or "el".
+	Name string `yaml:"name"`
+	// Percentage is a percentage of people with names from this locale, from 0 to 100.
+	// The sum of the percentages of all locales must not be greater than 100.
+	Percentage int `yaml:"percentage"`
+	// FemaleFirstNames contains the first and middle names of female people.
+	FemaleFirstNames []string `yaml:"female_first_names"`
+	// MaleFirstNames contains the first and middle names of male people.
+	MaleFirstNames []string `yaml:"male_first_names"`
+	// Surnames contains the surnames.
+	Surnames []string `yaml:"surnames"`
+}
+
+// validateLocales returns an error if the name locales are not valid.
+func validateLocales(locales []NameLocale) error {
+	total := 0
+	for _, l := range locales {
+		if l.Percentage < 0 {
+			return errors.Errorf("invalid locale %q: percentage %d must not be negative", l.Name, l.Percentage)
+		}
+		if len(l.FemaleFirstNames) == 0 || len(l.MaleFirstNames) == 0 || len(l.Surnames) == 0 {
+			return errors.Errorf("invalid locale %q: female_first_names, male_first_names and surnames are required", l.Name)
+		}
+		total += l.Percentage
+	}
+	if total > 100 {
+		return errors.Errorf("the sum of the percentages of the locales is %d, want at most 100", total)
+	}
+	return nil
+}
+
+// ValidateCharacterSet returns an error if the names of the locales contain characters that cannot
+// be represented in the given character set of the messages, e.g., accented names in ASCII messages.
+// An empty character set is ASCII, which is the character set of messages by default.
+func (d *Data) ValidateCharacterSet(characterSet string) error {
+	if characterSet == "" {
+		characterSet = "ASCII"
+	}
+	for _, l := range d.PatientName.Locales {
+		for _, names := range [][]string{l.FemaleFirstNames, l.MaleFirstNames, l.Surnames} {
+			for _, n := range names {
+				if !hl7.CanEncode(characterSet, n) {
+					return errors.Errorf("the name %q of locale %q cannot be represented in character set %q; set character_set in the header configuration to a character set that can represent it", n, l.Name, characterSet)
+				}
+			}
+		}
+	}
+	return nil
 }
 
 // Address contains data for generating the address.
@@ -112,7 +170,7 @@ type Address struct {
 }
 
 // DataFiles are the files to load data configuration from.
-// All fields are required.
+// All fields are required except Comorbidities.
 type DataFiles struct {
 	DataConfig        string
 	Nouns             string
@@ -126,6 +184,9 @@ type DataFiles struct {
 	PatientClass      string
 	SampleNotesDir    string
 	ClinicalNoteTypes string
+	// Comorbidities is a YAML file with the comorbidities of new patients and their prevalence.
+	// If not set, patients are created without comorbidities.
+	Comorbidities string
 }
 
 // LoadData loads the data configuration from the given data files.
@@ -140,6 +201,9 @@ func LoadData(ctx context.Context, f DataFiles, hc *HL7Config) (*Data, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot unmarshal configuration file %q", f.DataConfig)
 	}
+	if err := validateLocales(c.PatientName.Locales); err != nil {
+		return nil, errors.Wrapf(err, "invalid patient_name in configuration file %q", f.DataConfig)
+	}
 	nouns, err := textFileToList(ctx, f.Nouns)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot load nouns from file %q", f.Nouns)
@@ -152,19 +216,19 @@ func LoadData(ctx context.Context, f DataFiles, hc *HL7Config) (*Data, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot load surnames from file %q", f.Surnames)
 	}
-	allergies, err := loadCodedElements(ctx, f.Allergies, hc.Allergy.CodingSystem, false)
+	allergies, err := loadCodedElements(ctx, f.Allergies, hc.Allergy.CodingSystem, false, false)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot load allergies from file %q", f.Allergies)
 	}
 	log.WithField("file", f.Allergies).Infof("Loaded %d allergies", len(allergies))
 
-	diagnoses, err := loadCodedElements(ctx, f.Diagnoses, hc.Diagnosis.CodingSystem, true)
+	diagnoses, err := loadCodedElements(ctx, f.Diagnoses, hc.Diagnosis.CodingSystem, true, true)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot load diagnoses from file %q", f.Diagnoses)
 	}
 	log.WithField("file", f.Diagnoses).Infof("Loaded %d diagnoses", len(diagnoses))
 
-	procedures, err := loadCodedElements(ctx, f.Procedures, hc.Procedure.CodingSystem, true)
+	procedures, err := loadCodedElements(ctx, f.Procedures, hc.Procedure.CodingSystem, true, true)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cannot load procedures from file %q", f.Procedures)
 	}
@@ -194,6 +258,15 @@ func LoadData(ctx context.Context, f DataFiles, hc *HL7Config) (*Data, error) {
 	}
 	log.WithField("directory", f.SampleNotesDir).Infof("Loaded %d different types of sample clinical notes", len(notesConfig))
 
+	var comorbidities []Comorbidity
+	if f.Comorbidities != "" {
+		comorbidities, err = loadComorbidities(ctx, f.Comorbidities, hc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot load comorbidities from file %q", f.Comorbidities)
+		}
+		log.WithField("file", f.Comorbidities).Infof("Loaded %d comorbidities", len(comorbidities))
+	}
+
 	return &Data{
 		Allergy:           c.Allergy,
 		PatientName:       c.PatientName,
@@ -208,6 +281,7 @@ func LoadData(ctx context.Context, f DataFiles, hc *HL7Config) (*Data, error) {
 		PatientClass:      patientClass,
 		NotesConfig:       notesConfig,
 		ClinicalNoteTypes: noteTypes,
+		Comorbidities:     comorbidities,
 	}, nil
 }
 
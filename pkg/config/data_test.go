@@ -416,8 +416,43 @@ J30.1,Value1,59.5
 J45.0,Value2,2556.6`)
 	tmpCSVNoInt := testwrite.BytesToFile(t, csvNoInt)
 
+	csvWithAlternates := []byte(`
+J30.1,Value1,61582004^^SCT,59
+J45.0,Value2,195967001^Asthma^SCT,J45^^I10,2556`)
+	tmpCSVWithAlternates := testwrite.BytesToFile(t, csvWithAlternates)
+
+	csvInvalidAlternates := []byte(`
+J30.1,Value1,61582004,59`)
+	tmpCSVInvalidAlternates := testwrite.BytesToFile(t, csvInvalidAlternates)
+
 	// Use the same coding system in all cases to make the assertions easier.
 	defaultCS := "coding-system"
+	wantCSVWithAlternates := []MappableWeightedValue{{
+		WeightedVal: sample.WeightedValue{
+			Value: &ir.CodedElement{
+				ID:               "J30.1",
+				Text:             "Value1",
+				CodingSystem:     defaultCS,
+				AlternateCodings: []ir.Coding{{ID: "61582004", CodingSystem: "SCT"}},
+			},
+			Frequency: uint(59),
+		},
+		Mapping: Mapping{Key: "J30.1", Value: "Value1"},
+	}, {
+		WeightedVal: sample.WeightedValue{
+			Value: &ir.CodedElement{
+				ID:           "J45.0",
+				Text:         "Value2",
+				CodingSystem: defaultCS,
+				AlternateCodings: []ir.Coding{
+					{ID: "195967001", Text: "Asthma", CodingSystem: "SCT"},
+					{ID: "J45", CodingSystem: "I10"},
+				},
+			},
+			Frequency: uint(2556),
+		},
+		Mapping: Mapping{Key: "J45.0", Value: "Value2"},
+	}}
 	wantCSVWithNil := []MappableWeightedValue{{
 		WeightedVal: sample.WeightedValue{
 			Value:     &ir.CodedElement{ID: "J30.1", Text: "Value1", CodingSystem: defaultCS},
@@ -500,6 +535,35 @@ J45.0,Value2,2556.6`)
 			return df
 		},
 		wantErr: true,
+	}, {
+		name: "Alternate codes in Diagnoses and Procedures",
+		overrideDataFiles: func(df DataFiles) DataFiles {
+			df.Diagnoses = tmpCSVWithAlternates
+			df.Procedures = tmpCSVWithAlternates
+			df.Allergies = tmpCSV
+			return df
+		},
+		wantDiagnoses:  wantCSVWithAlternates,
+		wantProcedures: wantCSVWithAlternates,
+		wantAllergies:  wantCSVNoNil,
+	}, {
+		name: "Allergies don't support alternate codes",
+		overrideDataFiles: func(df DataFiles) DataFiles {
+			df.Diagnoses = tmpCSV
+			df.Procedures = tmpCSV
+			df.Allergies = tmpCSVWithAlternates
+			return df
+		},
+		wantErr: true,
+	}, {
+		name: "Invalid alternate codes",
+		overrideDataFiles: func(df DataFiles) DataFiles {
+			df.Diagnoses = tmpCSVInvalidAlternates
+			df.Procedures = tmpCSV
+			df.Allergies = tmpCSV
+			return df
+		},
+		wantErr: true,
 	}, {
 		name: "No integers",
 		overrideDataFiles: func(df DataFiles) DataFiles {
@@ -554,3 +618,67 @@ J45.0,Value2,2556.6`)
 		})
 	}
 }
+
+func TestValidateLocales(t *testing.T) {
+	es := NameLocale{
+		Name:             "es",
+		Percentage:       60,
+		FemaleFirstNames: []string{"María"},
+		MaleFirstNames:   []string{"José"},
+		Surnames:         []string{"Núñez"},
+	}
+	withPercentage := func(l NameLocale, p int) NameLocale {
+		l.Percentage = p
+		return l
+	}
+	withoutSurnames := es
+	withoutSurnames.Surnames = nil
+
+	tests := []struct {
+		name    string
+		locales []NameLocale
+		wantErr bool
+	}{
+		{name: "no locales"},
+		{name: "valid", locales: []NameLocale{es, withPercentage(es, 40)}},
+		{name: "sum over 100", locales: []NameLocale{es, withPercentage(es, 41)}, wantErr: true},
+		{name: "negative percentage", locales: []NameLocale{withPercentage(es, -1)}, wantErr: true},
+		{name: "missing names", locales: []NameLocale{withoutSurnames}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := validateLocales(tc.locales); (err != nil) != tc.wantErr {
+				t.Errorf("validateLocales(%+v) got err=%v, want error? %t", tc.locales, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestData_ValidateCharacterSet(t *testing.T) {
+	ascii := NameLocale{Name: "en", FemaleFirstNames: []string{"Mary"}, MaleFirstNames: []string{"John"}, Surnames: []string{"Smith"}}
+	es := NameLocale{Name: "es", FemaleFirstNames: []string{"María"}, MaleFirstNames: []string{"José"}, Surnames: []string{"Núñez"}}
+	el := NameLocale{Name: "el", FemaleFirstNames: []string{"Ελένη"}, MaleFirstNames: []string{"Γιώργος"}, Surnames: []string{"Παπαδόπουλος"}}
+
+	tests := []struct {
+		name         string
+		locales      []NameLocale
+		characterSet string
+		wantErr      bool
+	}{
+		{name: "no locales"},
+		{name: "ASCII names in the default character set", locales: []NameLocale{ascii}},
+		{name: "accented names in the default character set", locales: []NameLocale{es}, wantErr: true},
+		{name: "accented names in ASCII", locales: []NameLocale{es}, characterSet: "ASCII", wantErr: true},
+		{name: "accented names in 8859/1", locales: []NameLocale{es}, characterSet: "8859/1"},
+		{name: "Greek names in 8859/1", locales: []NameLocale{es, el}, characterSet: "8859/1", wantErr: true},
+		{name: "Greek names in UTF-8", locales: []NameLocale{es, el}, characterSet: "UNICODE UTF-8"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &Data{PatientName: PatientName{Locales: tc.locales}}
+			if err := d.ValidateCharacterSet(tc.characterSet); (err != nil) != tc.wantErr {
+				t.Errorf("ValidateCharacterSet(%q) got err=%v, want error? %t", tc.characterSet, err, tc.wantErr)
+			}
+		})
+	}
+}
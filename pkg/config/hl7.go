@@ -20,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 	"github.com/google/simhospital/pkg/files"
+	"github.com/google/simhospital/pkg/hl7"
 )
 
 // HL7Config is the configuration for HL7 messages where the values are important for HL7 compliance or specific uses of the HL7 standard.
@@ -73,6 +74,11 @@ type Header struct {
 	// ORU is the configuration for ORU messages.
 	// Optional. If not present, ORU messages will use the Default.
 	ORU *HeaderForType
+	// CharacterSet is the value to set in MSH-18 Character Set for all messages, e.g., "8859/1" or
+	// "UNICODE UTF-8". Messages are encoded in this character set when they are sent.
+	// Optional. If not present, messages declare the ASCII character set. The names of the locales in
+	// the data configuration must be representable in it; see Data.ValidateCharacterSet.
+	CharacterSet string `yaml:"character_set"`
 }
 
 // HeaderForType contains the fields in the Message Header (MSH segment).
@@ -106,6 +112,9 @@ type HL7Diagnosis struct {
 	// CodingSystem is the diagnosis coding system to be set in the CE.3.NameOfCodingSystem field in the
 	// DG1.3.Diagnosis Code - DG1.
 	CodingSystem string `yaml:"coding_system"`
+	// ProblemType is the type of diagnosis to be set in the DG1.6.DiagnosisType field of the problems in
+	// the problem list. Optional. If not present, problems are sent as final diagnoses, "F".
+	ProblemType string `yaml:"problem_type"`
 }
 
 // HL7Document contains configuration for a TXA segment (document).
@@ -243,6 +252,9 @@ func LoadHeaderConfig(ctx context.Context, fileName string) (*Header, error) {
 			return nil, errors.Wrapf(err, "invalid header configuration %s: invalid oru", fileName)
 		}
 	}
+	if h.CharacterSet != "" && !hl7.IsCharacterSet(h.CharacterSet) {
+		return nil, errors.Errorf("invalid header configuration %s: unknown character_set %q", fileName, h.CharacterSet)
+	}
 
 	return h, nil
 }
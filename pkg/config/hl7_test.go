@@ -67,6 +67,7 @@ func TestLoadHeaderConfig(t *testing.T) {
 		wantErr     bool
 		wantDefault *HeaderForType
 		wantORU     *HeaderForType
+		wantCharset string
 	}{{
 		name: "Default only",
 		header: []byte(`
@@ -219,6 +220,34 @@ default:
   receiving_application: want-ra
   receiving_facility: want-rf
 	unknown_field: unknown-field
+`),
+		wantErr: true,
+	}, {
+		name: "Character set",
+		header: []byte(`
+default:
+  sending_application: want-sa
+  sending_facility: want-sf
+  receiving_application: want-ra
+  receiving_facility: want-rf
+character_set: 8859/1
+`),
+		wantDefault: &HeaderForType{
+			SendingFacility:      "want-sf",
+			SendingApplication:   "want-sa",
+			ReceivingApplication: "want-ra",
+			ReceivingFacility:    "want-rf",
+		},
+		wantCharset: "8859/1",
+	}, {
+		name: "Unknown character set",
+		header: []byte(`
+default:
+  sending_application: want-sa
+  sending_facility: want-sf
+  receiving_application: want-ra
+  receiving_facility: want-rf
+character_set: EBCDIC
 `),
 		wantErr: true,
 	}}
@@ -239,6 +268,9 @@ default:
 			if diff := cmp.Diff(tc.wantORU, h.ORU); diff != "" {
 				t.Errorf("Header.ORU got mismatch (-want, +got):\n%s", diff)
 			}
+			if got, want := h.CharacterSet, tc.wantCharset; got != want {
+				t.Errorf("Header.CharacterSet got %q, want %q", got, want)
+			}
 		})
 	}
 }
@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"github.com/google/simhospital/pkg/files"
+	"github.com/google/simhospital/pkg/hl7"
+)
+
+// fieldRegex matches the fields in the validation configuration, e.g., PID-8.
+var fieldRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]{2}-[1-9][0-9]*$`)
+
+// validation is the validation configuration as defined in the YAML file.
+type validation struct {
+	// Tables maps the IDs of HL7 tables to their values.
+	Tables map[string][]string `yaml:"tables"`
+	// Fields maps fields, e.g., PID-8, to the checks for them.
+	Fields map[string]fieldValidation `yaml:"fields"`
+}
+
+type fieldValidation struct {
+	// Table is the ID of the table that contains the valid values of the field.
+	Table string `yaml:"table"`
+	// MaxLength is the maximum length of each repetition of the field.
+	MaxLength int `yaml:"max_length"`
+}
+
+// LoadValidationConfig loads the configuration to validate HL7 messages from the given YAML file.
+func LoadValidationConfig(ctx context.Context, fileName string) (*hl7.ValidationOptions, error) {
+	data, err := files.Read(ctx, fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read validation configuration file %s", fileName)
+	}
+	var v validation
+	if err := yaml.UnmarshalStrict(data, &v); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal validation configuration file %s", fileName)
+	}
+	o, err := v.options()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid validation configuration %s", fileName)
+	}
+	return o, nil
+}
+
+func (v validation) options() (*hl7.ValidationOptions, error) {
+	o := &hl7.ValidationOptions{
+		Tables:      v.Tables,
+		FieldTables: map[string]string{},
+		MaxLengths:  map[string]int{},
+	}
+	for field, fv := range v.Fields {
+		if !fieldRegex.MatchString(field) {
+			return nil, fmt.Errorf("invalid field %q; fields must be a segment name and a field number, e.g., PID-8", field)
+		}
+		if fv.Table == "" && fv.MaxLength == 0 {
+			return nil, fmt.Errorf("field %s has no checks; table or max_length are required", field)
+		}
+		if fv.Table != "" {
+			if _, ok := v.Tables[fv.Table]; !ok {
+				return nil, fmt.Errorf("field %s uses table %q, which is not defined", field, fv.Table)
+			}
+			o.FieldTables[field] = fv.Table
+		}
+		if fv.MaxLength < 0 {
+			return nil, fmt.Errorf("field %s has negative max_length %d", field, fv.MaxLength)
+		}
+		if fv.MaxLength > 0 {
+			o.MaxLengths[field] = fv.MaxLength
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+func TestLoadValidationConfig(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name    string
+		yml     string
+		want    *hl7.ValidationOptions
+		wantErr bool
+	}{{
+		name: "valid",
+		yml: `
+tables:
+  "0001": ["F", "M", "U"]
+fields:
+  PID-5:
+    max_length: 48
+  PID-8:
+    table: "0001"
+    max_length: 1`,
+		want: &hl7.ValidationOptions{
+			Tables:      map[string][]string{"0001": {"F", "M", "U"}},
+			FieldTables: map[string]string{"PID-8": "0001"},
+			MaxLengths:  map[string]int{"PID-5": 48, "PID-8": 1},
+		},
+	}, {
+		name: "invalid field",
+		yml: `
+fields:
+  PID.5:
+    max_length: 48`,
+		wantErr: true,
+	}, {
+		name: "field without checks",
+		yml: `
+fields:
+  PID-5: {}`,
+		wantErr: true,
+	}, {
+		name: "undefined table",
+		yml: `
+fields:
+  PID-8:
+    table: "0001"`,
+		wantErr: true,
+	}, {
+		name: "negative max length",
+		yml: `
+fields:
+  PID-5:
+    max_length: -1`,
+		wantErr: true,
+	}, {
+		name: "unknown field",
+		yml: `
+fields:
+  PID-5:
+    max_length: 48
+    unknown: value`,
+		wantErr: true,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := testwrite.BytesToFile(t, []byte(tc.yml))
+			got, err := LoadValidationConfig(ctx, f)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("LoadValidationConfig(%s) got err=%v; want err? %t", tc.yml, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("LoadValidationConfig(%s) got diff (-want +got):\n%s", tc.yml, diff)
+			}
+		})
+	}
+}
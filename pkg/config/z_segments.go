@@ -0,0 +1,70 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"github.com/google/simhospital/pkg/files"
+	"github.com/google/simhospital/pkg/hl7"
+)
+
+// zSegment is the definition of a Z-segment as defined in the YAML file.
+type zSegment struct {
+	Name   string   `yaml:"name"`
+	Fields []zField `yaml:"fields"`
+}
+
+type zField struct {
+	Name     string `yaml:"name"`
+	DataType string `yaml:"data_type"`
+	Required bool   `yaml:"required"`
+	Repeated bool   `yaml:"repeated"`
+}
+
+// LoadZSegments loads the definitions of custom Z-segments from the given YAML file.
+// The definitions are not registered; use hl7.RegisterSegment for that.
+func LoadZSegments(ctx context.Context, fileName string) ([]*hl7.SegmentDefinition, error) {
+	data, err := files.Read(ctx, fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read Z-segments file %s", fileName)
+	}
+	var segments []zSegment
+	if err := yaml.UnmarshalStrict(data, &segments); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal Z-segments file %s", fileName)
+	}
+	var definitions []*hl7.SegmentDefinition
+	seen := map[string]bool{}
+	for _, s := range segments {
+		if seen[s.Name] {
+			return nil, fmt.Errorf("invalid Z-segments file %s: segment %s is defined more than once", fileName, s.Name)
+		}
+		seen[s.Name] = true
+		d := &hl7.SegmentDefinition{Name: s.Name}
+		for _, f := range s.Fields {
+			d.Fields = append(d.Fields, hl7.FieldDefinition{
+				Name:     f.Name,
+				DataType: f.DataType,
+				Required: f.Required,
+				Repeated: f.Repeated,
+			})
+		}
+		definitions = append(definitions, d)
+	}
+	return definitions, nil
+}
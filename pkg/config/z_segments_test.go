@@ -0,0 +1,95 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+func TestLoadZSegments(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name    string
+		yml     string
+		want    []*hl7.SegmentDefinition
+		wantErr bool
+	}{{
+		name: "valid",
+		yml: `
+- name: ZPI
+  fields:
+  - name: Set ID
+    data_type: SI
+    required: true
+  - name: Preferred Names
+    data_type: XPN
+    repeated: true
+- name: ZVI
+  fields:
+  - name: VIP Indicator
+    data_type: CE`,
+		want: []*hl7.SegmentDefinition{{
+			Name: "ZPI",
+			Fields: []hl7.FieldDefinition{
+				{Name: "Set ID", DataType: "SI", Required: true},
+				{Name: "Preferred Names", DataType: "XPN", Repeated: true},
+			},
+		}, {
+			Name:   "ZVI",
+			Fields: []hl7.FieldDefinition{{Name: "VIP Indicator", DataType: "CE"}},
+		}},
+	}, {
+		name: "empty",
+		yml:  `[]`,
+	}, {
+		name: "duplicated segment",
+		yml: `
+- name: ZPI
+  fields:
+  - name: Set ID
+    data_type: SI
+- name: ZPI
+  fields:
+  - name: Set ID
+    data_type: SI`,
+		wantErr: true,
+	}, {
+		name: "unknown field",
+		yml: `
+- name: ZPI
+  fields:
+  - name: Set ID
+    type: SI`,
+		wantErr: true,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := testwrite.BytesToFile(t, []byte(tc.yml))
+			got, err := LoadZSegments(ctx, f)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("LoadZSegments(%s) got err=%v; want err? %t", tc.yml, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("LoadZSegments(%s) got diff (-want +got):\n%s", tc.yml, diff)
+			}
+		})
+	}
+}
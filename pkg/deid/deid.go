@@ -0,0 +1,491 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package deid de-identifies HL7v2 messages according to a policy, so that real feeds can be turned
+// into test data that can be shared. Values can be dropped, hashed with a salt, date-shifted
+// consistently for each patient, or replaced with fake values generated like the ones of the
+// synthetic patients of Simulated Hospital.
+package deid
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/pathway"
+)
+
+// hashLength is the number of hexadecimal characters of hashed values.
+const hashLength = 16
+
+var (
+	// dateRegexp matches HL7 dates and date/times: the date/time is in the first group, and the rest
+	// of the value, e.g., fractions of seconds, the timezone or further components, in the second one.
+	dateRegexp = regexp.MustCompile(`^([0-9]{4}(?:[0-9]{2}){0,5})(.*)$`)
+	// dateLayouts are the layouts of HL7 dates and date/times, by length.
+	dateLayouts = map[int]string{
+		4:  "2006",
+		6:  "200601",
+		8:  "20060102",
+		10: "2006010215",
+		12: "200601021504",
+		14: "20060102150405",
+	}
+	// numericRegexp matches the values kept by ActionKeepNumeric.
+	numericRegexp = regexp.MustCompile(`^(?:[<>]=?)?[+-]?[0-9]+(?:\.[0-9]+)?$`)
+
+	// maxFakes is the maximum number of patients whose fake values are kept. When there are more
+	// patients, the fake values of the patient that was seen first are forgotten, so that patient gets
+	// new fake values if they are seen again.
+	maxFakes = 10000
+)
+
+// PersonGenerator generates the people whose data is used for fake values.
+// *person.Generator implements it.
+type PersonGenerator interface {
+	NewPerson(*pathway.Person) *ir.Person
+}
+
+// Deidentifier de-identifies HL7v2 messages according to a policy.
+// Deidentifier is safe for concurrent use.
+type Deidentifier struct {
+	rules         []compiledRule
+	defaultAction Action
+	patientID     location
+	salt          []byte
+	maxShift      int
+	persons       PersonGenerator
+
+	// mu guards fakes and fakeIDs.
+	mu sync.Mutex
+	// fakes contains the people used for the fake values of each patient, by patient identifier.
+	fakes map[string]*ir.Person
+	// fakeIDs are the patient identifiers in fakes, in the order in which they were added.
+	fakeIDs []string
+}
+
+// New returns a Deidentifier for the given policy.
+// The PersonGenerator is only required if the policy has rules with ActionFake.
+func New(p *Policy, g PersonGenerator) (*Deidentifier, error) {
+	rules, err := p.compile()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid de-identification policy")
+	}
+	for _, r := range rules {
+		if r.Action == ActionFake && g == nil {
+			return nil, errors.New("invalid de-identification policy: fake values require a person generator")
+		}
+	}
+	patientID := p.PatientID
+	if patientID == "" {
+		patientID = DefaultPatientID
+	}
+	l, err := parseLocation(patientID)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid patient_id")
+	}
+	maxShift := p.MaxDateShiftDays
+	if maxShift == 0 {
+		maxShift = DefaultMaxDateShiftDays
+	}
+	defaultAction := p.DefaultAction
+	if defaultAction == "" {
+		defaultAction = ActionDrop
+	}
+	return &Deidentifier{
+		rules:         rules,
+		defaultAction: defaultAction,
+		patientID:     l,
+		salt:          []byte(p.Salt),
+		maxShift:      maxShift,
+		persons:       g,
+		fakes:         map[string]*ir.Person{},
+	}, nil
+}
+
+// deidMessage is a message being de-identified.
+type deidMessage struct {
+	d          *hl7.Delimiters
+	patientID  string
+	fake       *ir.Person
+	dateShift  int
+	dateShifts bool
+}
+
+// Deidentify returns a de-identified copy of the given message, whose segments must be separated
+// by hl7.SegmentTerminator, as in the messages returned by hl7.Reader.
+// Deidentify returns an error if a value cannot be de-identified, e.g., if a value to date-shift is
+// not a date, so that messages with identifiable data are never returned.
+func (d *Deidentifier) Deidentify(msg []byte) ([]byte, error) {
+	segments := bytes.Split(bytes.TrimRight(msg, hl7.SegmentTerminatorStr), []byte(hl7.SegmentTerminatorStr))
+	delimiters, err := delimiters(segments[0])
+	if err != nil {
+		return nil, err
+	}
+	m := &deidMessage{d: delimiters}
+	m.patientID = d.patientIDOf(segments, delimiters)
+
+	var out [][]byte
+	for _, s := range segments {
+		if len(s) == 0 {
+			continue
+		}
+		name := strings.SplitN(string(s), string(delimiters.Field), 2)[0]
+		deidentified, keep, err := d.segment(m, name, string(s))
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot de-identify segment %s", name)
+		}
+		if keep {
+			out = append(out, []byte(deidentified))
+		}
+	}
+	return bytes.Join(out, []byte(hl7.SegmentTerminatorStr)), nil
+}
+
+// delimiters returns the delimiters defined in the given MSH segment.
+func delimiters(msh []byte) (*hl7.Delimiters, error) {
+	if !bytes.HasPrefix(msh, []byte("MSH")) || len(msh) < 8 {
+		return nil, errors.New("the message does not start with a valid MSH segment")
+	}
+	d := &hl7.Delimiters{
+		Field:        msh[3],
+		Component:    msh[4],
+		Repetition:   msh[5],
+		Escape:       msh[6],
+		Subcomponent: msh[7],
+	}
+	return d, nil
+}
+
+// segment returns the de-identified segment, and whether it must be kept.
+func (d *Deidentifier) segment(m *deidMessage, name string, s string) (string, bool, error) {
+	var rules []compiledRule
+	keepSegment := false
+	for _, r := range d.rules {
+		if r.loc.segment != name {
+			continue
+		}
+		if r.loc.field == 0 {
+			if r.Action == ActionDrop {
+				return "", false, nil
+			}
+			keepSegment = true
+			continue
+		}
+		rules = append(rules, r)
+	}
+	fields := strings.Split(s, string(m.d.Field))
+	if !keepSegment {
+		first := 1
+		if name == "MSH" {
+			first = 3
+		}
+		for f := first; fieldIndex(name, f) < len(fields); f++ {
+			i := fieldIndex(name, f)
+			l := location{segment: name, field: f}
+			var err error
+			if fields[i], err = d.applyDefault(m, rules, l, fields[i]); err != nil {
+				return "", false, errors.Wrapf(err, "location %s", l)
+			}
+		}
+	}
+	for _, r := range rules {
+		i := fieldIndex(name, r.loc.field)
+		if i >= len(fields) {
+			continue
+		}
+		var err error
+		if fields[i], err = d.field(m, r, fields[i]); err != nil {
+			return "", false, errors.Wrapf(err, "location %s", r.loc)
+		}
+	}
+	return strings.Join(fields, string(m.d.Field)), true, nil
+}
+
+// applyDefault returns the value at l, a field or a component, with the default action applied to
+// the parts of it that no rule applies to.
+func (d *Deidentifier) applyDefault(m *deidMessage, rules []compiledRule, l location, value string) (string, error) {
+	deeper := false
+	for _, r := range rules {
+		if r.loc.contains(l) {
+			return value, nil
+		}
+		if l.contains(r.loc) {
+			deeper = true
+		}
+	}
+	if !deeper {
+		return d.field(m, compiledRule{Rule: Rule{Action: d.defaultAction}, loc: l}, value)
+	}
+	// Some rules apply to parts of the value, so the default action is applied to the other parts.
+	var err error
+	for i := 1; i <= m.parts(l, value); i++ {
+		child := l
+		if l.component == 0 {
+			child.component = i
+		} else {
+			child.subcomponent = i
+		}
+		if value, err = d.applyDefault(m, rules, child, value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// parts returns the maximum number of components, if l is a field, or subcomponents, if l is a
+// component, in the repetitions of the field value.
+func (m *deidMessage) parts(l location, value string) int {
+	n := 0
+	for _, rep := range strings.Split(value, string(m.d.Repetition)) {
+		parts := strings.Split(rep, string(m.d.Component))
+		if l.component != 0 {
+			if l.component > len(parts) {
+				continue
+			}
+			parts = strings.Split(parts[l.component-1], string(m.d.Subcomponent))
+		}
+		if len(parts) > n {
+			n = len(parts)
+		}
+	}
+	return n
+}
+
+// fieldIndex returns the index of the given field in the segment split by the field delimiter.
+// The index of MSH fields is one less than for other segments, because MSH-1 is the field delimiter.
+func fieldIndex(segment string, field int) int {
+	if segment == "MSH" {
+		return field - 1
+	}
+	return field
+}
+
+// field returns the de-identified value of a field, with the rule applied to all its repetitions.
+func (d *Deidentifier) field(m *deidMessage, r compiledRule, value string) (string, error) {
+	repetitions := strings.Split(value, string(m.d.Repetition))
+	for i, rep := range repetitions {
+		var err error
+		repetitions[i], err = apply(rep, string(m.d.Component), r.loc.component, func(c string) (string, error) {
+			return apply(c, string(m.d.Subcomponent), r.loc.subcomponent, func(v string) (string, error) {
+				return d.value(m, r, v)
+			})
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(repetitions, string(m.d.Repetition)), nil
+}
+
+// apply applies f to the i-th part of value split by sep, or to the whole value if i is 0.
+func apply(value string, sep string, i int, f func(string) (string, error)) (string, error) {
+	if i == 0 {
+		return f(value)
+	}
+	parts := strings.Split(value, sep)
+	if i > len(parts) {
+		return value, nil
+	}
+	var err error
+	if parts[i-1], err = f(parts[i-1]); err != nil {
+		return "", err
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// value returns the de-identified value. Empty and null values are never changed.
+func (d *Deidentifier) value(m *deidMessage, r compiledRule, v string) (string, error) {
+	if v == "" || hl7.IsHL7Null([]byte(v)) {
+		return v, nil
+	}
+	switch r.Action {
+	case ActionDrop:
+		return "", nil
+	case ActionHash:
+		return d.hash(v), nil
+	case ActionDateShift:
+		return d.shiftDate(m, v)
+	case ActionFake:
+		return d.fakeValue(m, r, v), nil
+	case ActionKeepNumeric:
+		if numericRegexp.MatchString(v) {
+			return v, nil
+		}
+		return "", nil
+	default:
+		return v, nil
+	}
+}
+
+// hash returns the salted hash of v.
+func (d *Deidentifier) hash(v string) string {
+	h := hmac.New(sha256.New, d.salt)
+	h.Write([]byte(v))
+	return hex.EncodeToString(h.Sum(nil))[:hashLength]
+}
+
+// shiftDate shifts the date or date/time at the beginning of v by the patient's date shift.
+func (d *Deidentifier) shiftDate(m *deidMessage, v string) (string, error) {
+	match := dateRegexp.FindStringSubmatch(v)
+	if match == nil || (match[2] != "" && match[2][0] >= '0' && match[2][0] <= '9') {
+		return "", fmt.Errorf("cannot shift value %q: it is not a date", v)
+	}
+	layout := dateLayouts[len(match[1])]
+	t, err := time.ParseInLocation(layout, match[1], time.UTC)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot shift value %q", v)
+	}
+	if !m.dateShifts {
+		m.dateShift = d.dateShift(m.patientID)
+		m.dateShifts = true
+	}
+	return t.AddDate(0, 0, m.dateShift).Format(layout) + match[2], nil
+}
+
+// dateShift returns the number of days to shift the dates of the given patient by, between
+// -maxShift and maxShift, but never 0.
+// Messages without a patient identifier cannot be linked to the other messages of their patient,
+// so each of them gets a random shift rather than sharing one.
+func (d *Deidentifier) dateShift(patientID string) int {
+	var n int
+	if patientID == "" {
+		n = rand.Intn(2 * d.maxShift)
+	} else {
+		h := hmac.New(sha256.New, d.salt)
+		h.Write([]byte("date_shift:" + patientID))
+		n = int(binary.BigEndian.Uint64(h.Sum(nil)) % uint64(2*d.maxShift))
+	}
+	if n < d.maxShift {
+		return n - d.maxShift
+	}
+	return n - d.maxShift + 1
+}
+
+// fakeValue returns the fake value for v.
+func (d *Deidentifier) fakeValue(m *deidMessage, r compiledRule, v string) string {
+	p := d.fakePerson(m)
+	switch r.Fake {
+	case FakeName:
+		return m.replaceComponents(v, p.Surname, p.FirstName, p.MiddleName, p.Suffix, p.Prefix, p.Degree)
+	case FakeAddress:
+		a := p.Address
+		if a == nil {
+			a = &ir.Address{}
+		}
+		return m.replaceComponents(v, a.FirstLine, a.SecondLine, a.City, "", a.PostalCode, a.Country)
+	case FakeFirstName:
+		return m.escape(p.FirstName)
+	case FakeMiddleName:
+		return m.escape(p.MiddleName)
+	case FakeSurname:
+		return m.escape(p.Surname)
+	case FakePhoneNumber:
+		return m.escape(p.PhoneNumber)
+	case FakeMRN:
+		return m.escape(p.MRN)
+	case FakeNHSNumber:
+		return m.escape(p.NHS)
+	default:
+		panic(fmt.Sprintf("unknown fake value %q", r.Fake))
+	}
+}
+
+// fakePerson returns the person whose data is used for the fake values of the message's patient.
+// Messages without a patient identifier get a new person every time.
+func (d *Deidentifier) fakePerson(m *deidMessage) *ir.Person {
+	if m.fake != nil {
+		return m.fake
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.fakes[m.patientID]
+	if !ok {
+		p = d.persons.NewPerson(nil)
+		if m.patientID != "" {
+			d.fakes[m.patientID] = p
+			d.fakeIDs = append(d.fakeIDs, m.patientID)
+			if len(d.fakeIDs) > maxFakes {
+				delete(d.fakes, d.fakeIDs[0])
+				d.fakeIDs = d.fakeIDs[1:]
+			}
+		}
+	}
+	m.fake = p
+	return p
+}
+
+// replaceComponents replaces the first components of v with the given values, and keeps the rest.
+func (m *deidMessage) replaceComponents(v string, values ...string) string {
+	components := strings.Split(v, string(m.d.Component))
+	if len(components) < len(values) {
+		components = append(components, make([]string, len(values)-len(components))...)
+	}
+	for i, value := range values {
+		components[i] = m.escape(value)
+	}
+	return strings.TrimRight(strings.Join(components, string(m.d.Component)), string(m.d.Component))
+}
+
+// escape escapes the delimiters in v.
+func (m *deidMessage) escape(v string) string {
+	escaped, err := hl7.NewST(hl7.ST(v)).Marshal(&hl7.Context{Delimiters: m.d})
+	if err != nil {
+		// Marshalling an ST value never fails.
+		panic(err)
+	}
+	return string(escaped)
+}
+
+// patientIDOf returns the value that identifies the patient of the message, or "" if there is none.
+func (d *Deidentifier) patientIDOf(segments [][]byte, delimiters *hl7.Delimiters) string {
+	l := d.patientID
+	for _, s := range segments {
+		if !bytes.HasPrefix(s, append([]byte(l.segment), delimiters.Field)) {
+			continue
+		}
+		fields := strings.Split(string(s), string(delimiters.Field))
+		i := fieldIndex(l.segment, l.field)
+		if i >= len(fields) {
+			return ""
+		}
+		v := strings.Split(fields[i], string(delimiters.Repetition))[0]
+		for _, p := range []struct {
+			sep string
+			i   int
+		}{{string(delimiters.Component), l.component}, {string(delimiters.Subcomponent), l.subcomponent}} {
+			if p.i == 0 {
+				break
+			}
+			parts := strings.Split(v, p.sep)
+			if p.i > len(parts) {
+				return ""
+			}
+			v = parts[p.i-1]
+		}
+		return v
+	}
+	return ""
+}
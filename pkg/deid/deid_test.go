@@ -0,0 +1,659 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deid
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v2"
+	"github.com/google/simhospital/pkg/files"
+	"github.com/google/simhospital/pkg/generator/header"
+	"github.com/google/simhospital/pkg/hardcoded"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/pathway"
+	"github.com/google/simhospital/pkg/test"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+// fakePersonGenerator generates people whose values contain the number of people generated so far.
+type fakePersonGenerator struct {
+	count int
+}
+
+func (g *fakePersonGenerator) NewPerson(*pathway.Person) *ir.Person {
+	g.count++
+	return &ir.Person{
+		FirstName: fmt.Sprintf("First%d", g.count),
+		Surname:   fmt.Sprintf("Surname%d", g.count),
+		Address: &ir.Address{
+			FirstLine:  fmt.Sprintf("%d Fake Street", g.count),
+			City:       "London",
+			PostalCode: "N1 1AA",
+			Country:    "GBR",
+		},
+		PhoneNumber: "020 1234 5678",
+		MRN:         fmt.Sprintf("MRN%d", g.count),
+	}
+}
+
+func segments(s ...string) []byte {
+	return []byte(strings.Join(s, hl7.SegmentTerminatorStr))
+}
+
+func TestDeidentify(t *testing.T) {
+	policy := &Policy{
+		Salt: "salt",
+		Rules: []Rule{
+			{Location: "MSH", Action: ActionKeep},
+			{Location: "MSH-4", Action: ActionDrop},
+			{Location: "PID-1", Action: ActionKeep},
+			{Location: "PID-3.1", Action: ActionHash},
+			{Location: "PID-3.4", Action: ActionKeep},
+			{Location: "PID-5", Action: ActionFake, Fake: FakeName},
+			{Location: "PID-7", Action: ActionDateShift},
+			{Location: "PID-8", Action: ActionKeep},
+			{Location: "PID-11", Action: ActionFake, Fake: FakeAddress},
+			{Location: "PID-13.1", Action: ActionFake, Fake: FakePhoneNumber},
+			{Location: "PID-13.2", Action: ActionKeep},
+			{Location: "PV1-1", Action: ActionKeep},
+			{Location: "PV1-2", Action: ActionKeep},
+			{Location: "PV1-7", Action: ActionKeep},
+			{Location: "PV1-7.2", Action: ActionDrop},
+			{Location: "PV1-44", Action: ActionDateShift},
+			{Location: "NK1", Action: ActionDrop},
+			{Location: "NTE-3", Action: ActionKeep},
+		},
+	}
+	d, err := New(policy, &fakePersonGenerator{})
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	in := segments(
+		`MSH|^~\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A01|1|T|2.3`,
+		`PID|1||1234^^^MRN~5678^^^NHS||Smith^John^^^Mr^^L~Smith^Johnny||19800102|M|||1 Main St^^Leeds^^LS1 1AA^GBR^HOME||0113 123 4567^HOME`,
+		`NK1|1|Smith^Jane`,
+		`PV1|1|I|||||1^Osman^Arthur|||||||||||||||||||||||||||||||||||||20200101103000+0100`,
+		`NTE|1||Note`,
+	)
+	got, err := d.Deidentify(in)
+	if err != nil {
+		t.Fatalf("Deidentify(%q) failed with %v", in, err)
+	}
+	shift := d.dateShift("1234")
+	want := segments(
+		`MSH|^~\&|SIMHOSP||RAPP|RFAC|20200101000000||ADT^A01|1|T|2.3`,
+		fmt.Sprintf(`PID|1||%s^^^MRN~%s^^^NHS||Surname1^First1^^^^^L~Surname1^First1||%s|M|||1 Fake Street^^London^^N1 1AA^GBR^HOME||020 1234 5678^HOME`,
+			d.hash("1234"), d.hash("5678"), shiftDate(t, "19800102", "20060102", shift)),
+		`PV1|1|I|||||1^^Arthur|||||||||||||||||||||||||||||||||||||`+shiftDate(t, "20200101103000", "20060102150405", shift)+"+0100",
+		`NTE|||Note`,
+	)
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("Deidentify(%q) got diff (-want +got):\n%s", in, diff)
+	}
+}
+
+func shiftDate(t *testing.T, v string, layout string, days int) string {
+	t.Helper()
+	parsed, err := time.Parse(layout, v)
+	if err != nil {
+		t.Fatalf("time.Parse(%q, %q) failed with %v", layout, v, err)
+	}
+	return parsed.AddDate(0, 0, days).Format(layout)
+}
+
+func TestDeidentify_ConsistentPerPatient(t *testing.T) {
+	policy := &Policy{
+		Salt:             "salt",
+		MaxDateShiftDays: 30,
+		Rules: []Rule{
+			{Location: "PID-5.1", Action: ActionFake, Fake: FakeSurname},
+			{Location: "PID-7", Action: ActionDateShift},
+		},
+	}
+	d, err := New(policy, &fakePersonGenerator{})
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	deidentify := func(patientID string) string {
+		t.Helper()
+		in := segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, fmt.Sprintf("PID|1||%s||Smith||20200115", patientID))
+		got, err := d.Deidentify(in)
+		if err != nil {
+			t.Fatalf("Deidentify(%q) failed with %v", in, err)
+		}
+		return strings.Split(string(got), hl7.SegmentTerminatorStr)[1]
+	}
+
+	first, again, other := deidentify("1"), deidentify("1"), deidentify("2")
+	if first != again {
+		t.Errorf("Deidentify() got %q and %q for the same patient, want the same values", first, again)
+	}
+	if first == other {
+		t.Errorf("Deidentify() got %q for different patients, want different values", first)
+	}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		if shift := d.dateShift(id); shift == 0 || shift < -30 || shift > 30 {
+			t.Errorf("dateShift(%q) = %d, want a non-zero value in [-30, 30]", id, shift)
+		}
+	}
+}
+
+func TestDeidentify_EscapesFakeValues(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{{
+		name: "default delimiters",
+		in:   segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, `PID|1||1234||Smith^John`),
+		want: segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, `PID|1||1234||Smith\S\Jones^John`),
+	}, {
+		name: "custom delimiters",
+		in:   segments(`MSH#*@!%#SIMHOSP####20200101000000##ADT*A01#1#T#2.3`, `PID#1##1234##Smith*John`),
+		want: segments(`MSH#*@!%#SIMHOSP####20200101000000##ADT*A01#1#T#2.3`, `PID#1##1234##Smith^Jones*John`),
+	}}
+	policy := &Policy{Rules: []Rule{
+		{Location: "MSH", Action: ActionKeep},
+		{Location: "PID-1", Action: ActionKeep},
+		{Location: "PID-3", Action: ActionKeep},
+		{Location: "PID-5.1", Action: ActionFake, Fake: FakeSurname},
+		{Location: "PID-5.2", Action: ActionKeep},
+	}}
+	d, err := New(policy, personGeneratorFunc(func() *ir.Person { return &ir.Person{Surname: "Smith^Jones"} }))
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := d.Deidentify(tc.in)
+			if err != nil {
+				t.Fatalf("Deidentify(%q) failed with %v", tc.in, err)
+			}
+			if diff := cmp.Diff(string(tc.want), string(got)); diff != "" {
+				t.Errorf("Deidentify(%q) got diff (-want +got):\n%s", tc.in, diff)
+			}
+		})
+	}
+}
+
+type personGeneratorFunc func() *ir.Person
+
+func (f personGeneratorFunc) NewPerson(*pathway.Person) *ir.Person {
+	return f()
+}
+
+func TestDeidentify_Errors(t *testing.T) {
+	policy := &Policy{Salt: "salt", Rules: []Rule{{Location: "PID-7", Action: ActionDateShift}}}
+	d, err := New(policy, nil)
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	cases := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "no MSH", in: segments(`PID|1||1234||||19800102`)},
+		{name: "not a date", in: segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, `PID|1||1234||||yesterday`)},
+		{name: "invalid date length", in: segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, `PID|1||1234||||198001021`)},
+		{name: "invalid date", in: segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, `PID|1||1234||||19801350`)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := d.Deidentify(tc.in); err == nil {
+				t.Errorf("Deidentify(%q) got %q, want error", tc.in, got)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidPolicy(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy *Policy
+	}{
+		{name: "invalid location", policy: &Policy{Rules: []Rule{{Location: "PID.5", Action: ActionDrop}}}},
+		{name: "MSH segment", policy: &Policy{Rules: []Rule{{Location: "MSH", Action: ActionDrop}}}},
+		{name: "MSH-2", policy: &Policy{Rules: []Rule{{Location: "MSH-2", Action: ActionDrop}}}},
+		{name: "duplicate location", policy: &Policy{Rules: []Rule{{Location: "PID-5", Action: ActionDrop}, {Location: "PID-5", Action: ActionKeep}}}},
+		{name: "unknown action", policy: &Policy{Rules: []Rule{{Location: "PID-5", Action: "encrypt"}}}},
+		{name: "hash without salt", policy: &Policy{Rules: []Rule{{Location: "PID-3", Action: ActionHash}}}},
+		{name: "date shift without salt", policy: &Policy{Rules: []Rule{{Location: "PID-7", Action: ActionDateShift}}}},
+		{name: "hash segment", policy: &Policy{Salt: "salt", Rules: []Rule{{Location: "PID", Action: ActionHash}}}},
+		{name: "unknown fake", policy: &Policy{Rules: []Rule{{Location: "PID-5", Action: ActionFake, Fake: "pet"}}}},
+		{name: "fake name in component", policy: &Policy{Rules: []Rule{{Location: "PID-5.1", Action: ActionFake, Fake: FakeName}}}},
+		{name: "fake without fake action", policy: &Policy{Rules: []Rule{{Location: "PID-5", Action: ActionDrop, Fake: FakeName}}}},
+		{name: "fake without person generator", policy: &Policy{Rules: []Rule{{Location: "PID-5", Action: ActionFake, Fake: FakeName}}}},
+		{name: "negative max date shift", policy: &Policy{MaxDateShiftDays: -1}},
+		{name: "patient ID is a segment", policy: &Policy{PatientID: "PID"}},
+		{name: "unknown default action", policy: &Policy{DefaultAction: ActionKeep}},
+		{name: "hash by default without salt", policy: &Policy{DefaultAction: ActionHash}},
+		{name: "keep numeric segment", policy: &Policy{Rules: []Rule{{Location: "OBX", Action: ActionKeepNumeric}}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(tc.policy, nil); err == nil {
+				t.Errorf("New(%+v) got nil error, want error", tc.policy)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	fileName := testwrite.BytesToFile(t, []byte(`
+salt: secret
+max_date_shift_days: 100
+patient_id: PID-2
+rules:
+- location: PID-5
+  action: fake
+  fake: name
+- location: NK1
+  action: drop
+`))
+	got, err := LoadPolicy(context.Background(), fileName)
+	if err != nil {
+		t.Fatalf("LoadPolicy(%s) failed with %v", fileName, err)
+	}
+	want := &Policy{
+		Salt:             "secret",
+		MaxDateShiftDays: 100,
+		PatientID:        "PID-2",
+		Rules: []Rule{
+			{Location: "PID-5", Action: ActionFake, Fake: FakeName},
+			{Location: "NK1", Action: ActionDrop},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LoadPolicy(%s) got diff (-want +got):\n%s", fileName, diff)
+	}
+
+	fileName = testwrite.BytesToFile(t, []byte("unknown_key: 1"))
+	if _, err := LoadPolicy(context.Background(), fileName); err == nil {
+		t.Errorf("LoadPolicy(%s) got nil error, want error", fileName)
+	}
+}
+
+func TestDeidentify_DefaultAction(t *testing.T) {
+	rules := []Rule{
+		{Location: "MSH", Action: ActionKeep},
+		{Location: "PID-3.1", Action: ActionHash},
+		{Location: "PID-3.4", Action: ActionKeep},
+		{Location: "PID-8", Action: ActionKeep},
+	}
+	in := segments(
+		`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+		`PID|1||1234^^^MRN^MR&X||Smith^John||19800102|M`,
+		`ZPI|1|Smith^John|5678`,
+	)
+	cases := []struct {
+		name          string
+		defaultAction Action
+		want          func(d *Deidentifier) []byte
+	}{{
+		name: "drop",
+		want: func(d *Deidentifier) []byte {
+			return segments(
+				`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+				fmt.Sprintf(`PID|||%s^^^MRN^|||||M`, d.hash("1234")),
+				`ZPI|||`,
+			)
+		},
+	}, {
+		name:          "hash",
+		defaultAction: ActionHash,
+		want: func(d *Deidentifier) []byte {
+			return segments(
+				`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+				fmt.Sprintf(`PID|%s||%s^^^MRN^%s||%s||%s|M`, d.hash("1"), d.hash("1234"), d.hash("MR&X"), d.hash("Smith^John"), d.hash("19800102")),
+				fmt.Sprintf(`ZPI|%s|%s|%s`, d.hash("1"), d.hash("Smith^John"), d.hash("5678")),
+			)
+		},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := &Policy{Salt: "salt", DefaultAction: tc.defaultAction, Rules: rules}
+			d, err := New(policy, nil)
+			if err != nil {
+				t.Fatalf("New(%+v) failed with %v", policy, err)
+			}
+			got, err := d.Deidentify(in)
+			if err != nil {
+				t.Fatalf("Deidentify(%q) failed with %v", in, err)
+			}
+			if diff := cmp.Diff(string(tc.want(d)), string(got)); diff != "" {
+				t.Errorf("Deidentify(%q) got diff (-want +got):\n%s", in, diff)
+			}
+		})
+	}
+}
+
+func TestDeidentify_KeepNumeric(t *testing.T) {
+	policy := &Policy{Rules: []Rule{
+		{Location: "MSH", Action: ActionKeep},
+		{Location: "OBX-1", Action: ActionKeep},
+		{Location: "OBX-2", Action: ActionKeep},
+		{Location: "OBX-5", Action: ActionKeepNumeric},
+	}}
+	d, err := New(policy, nil)
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	for _, v := range []string{"126", "-3.75", "<0.5", ">=10", `""`} {
+		in := segments(`MSH|^~\&|||||20200101000000||ORU^R01|1|T|2.3`, "OBX|1|NM|||"+v)
+		got, err := d.Deidentify(in)
+		if err != nil {
+			t.Fatalf("Deidentify(%q) failed with %v", in, err)
+		}
+		if diff := cmp.Diff(string(in), string(got)); diff != "" {
+			t.Errorf("Deidentify(%q) got diff (-want +got):\n%s", in, diff)
+		}
+	}
+	for _, v := range []string{"Seen by Dr Smith", "12 Main St", "1.2.3"} {
+		in := segments(`MSH|^~\&|||||20200101000000||ORU^R01|1|T|2.3`, "OBX|1|TX|||"+v)
+		want := segments(`MSH|^~\&|||||20200101000000||ORU^R01|1|T|2.3`, "OBX|1|TX|||")
+		got, err := d.Deidentify(in)
+		if err != nil {
+			t.Fatalf("Deidentify(%q) failed with %v", in, err)
+		}
+		if diff := cmp.Diff(string(want), string(got)); diff != "" {
+			t.Errorf("Deidentify(%q) got diff (-want +got):\n%s", in, diff)
+		}
+	}
+}
+
+func TestDeidentify_NoPatientID(t *testing.T) {
+	policy := &Policy{
+		Salt:             "salt",
+		MaxDateShiftDays: 1000,
+		Rules: []Rule{
+			{Location: "MSH", Action: ActionKeep},
+			{Location: "PID-7", Action: ActionDateShift},
+		},
+	}
+	d, err := New(policy, nil)
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	// Messages without a patient identifier don't share a date shift. With 2000 possible shifts, ten
+	// messages all get the same shift with negligible probability.
+	in := segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, `PID|1||||||20200115`)
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		got, err := d.Deidentify(in)
+		if err != nil {
+			t.Fatalf("Deidentify(%q) failed with %v", in, err)
+		}
+		seen[string(got)] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("Deidentify(%q) got the same dates for all the messages without a patient identifier, want different dates", in)
+	}
+}
+
+func TestDeidentify_BoundsFakes(t *testing.T) {
+	defer func(old int) { maxFakes = old }(maxFakes)
+	maxFakes = 2
+
+	policy := &Policy{Rules: []Rule{
+		{Location: "MSH", Action: ActionKeep},
+		{Location: "PID-5.1", Action: ActionFake, Fake: FakeSurname},
+	}}
+	d, err := New(policy, &fakePersonGenerator{})
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+	surname := func(patientID string) string {
+		t.Helper()
+		in := segments(`MSH|^~\&|||||20200101000000||ADT^A01|1|T|2.3`, fmt.Sprintf("PID|1||%s||Smith", patientID))
+		got, err := d.Deidentify(in)
+		if err != nil {
+			t.Fatalf("Deidentify(%q) failed with %v", in, err)
+		}
+		return strings.Split(string(got), hl7.SegmentTerminatorStr)[1]
+	}
+
+	first := surname("1")
+	surname("2")
+	if got := surname("1"); got != first {
+		t.Errorf("Deidentify() got %q for patient 1, want %q", got, first)
+	}
+	surname("3")
+	if got := len(d.fakes); got != maxFakes {
+		t.Errorf("len(fakes) = %d, want %d", got, maxFakes)
+	}
+	// Patient 1 was the first patient seen, so their fake values were forgotten.
+	if got := surname("1"); got == first {
+		t.Errorf("Deidentify() got %q for patient 1 after their fake values were forgotten, want new values", got)
+	}
+}
+
+// TestDeidentify_DefaultPolicy checks that the default policy removes the names, MRNs and visit
+// identifiers of every message type that Simulated Hospital generates, including the hardcoded
+// messages.
+func TestDeidentify_DefaultPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy, err := LoadPolicy(ctx, test.DeidPolicyConfigProd)
+	if err != nil {
+		t.Fatalf("LoadPolicy(%s) failed with %v", test.DeidPolicyConfigProd, err)
+	}
+	policy.Salt = "salt"
+	d, err := New(policy, &fakePersonGenerator{})
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", policy, err)
+	}
+
+	doctor := &ir.Doctor{ID: "D987654", Surname: "Quackenbush", FirstName: "Ottoline", Prefix: "Dr"}
+	p := &ir.PatientInfo{
+		Person: &ir.Person{
+			Prefix:     "Mrs",
+			FirstName:  "Wilhelmina",
+			MiddleName: "Philippa",
+			Surname:    "Featherstonehaugh",
+			Gender:     "F",
+			Birth:      ir.NewValidTime(time.Date(1970, 3, 4, 0, 0, 0, 0, time.UTC)),
+			Address: &ir.Address{
+				FirstLine:  "27 Wisteria Lane",
+				City:       "Little Whinging",
+				PostalCode: "WG1 2XY",
+				Country:    "GBR",
+				Type:       "HOME",
+			},
+			PhoneNumber: "020 7946 0123",
+			MRN:         "918273645",
+			NHS:         "5647382910",
+		},
+		Class:           "INPATIENT",
+		VisitID:         777555333,
+		HospitalService: "180",
+		Location:        &ir.PatientLocation{Poc: "Ward 1", Room: "Bay 1", Bed: "Bed 1", Facility: "Hospital", LocationType: "BED"},
+		PriorLocation:   &ir.PatientLocation{Poc: "Ward 2", Room: "Bay 2", Bed: "Bed 2", Facility: "Hospital", LocationType: "BED"},
+		AttendingDoctor: doctor,
+		AdmissionDate:   ir.NewValidTime(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)),
+		AssociatedParties: []*ir.AssociatedParty{{
+			Person: &ir.Person{
+				FirstName: "Bartholomew",
+				Surname:   "Featherstonehaugh",
+				Address:   &ir.Address{FirstLine: "27 Wisteria Lane", City: "Little Whinging"},
+				MRN:       "564738291",
+			},
+			Relationship: &ir.CodedElement{ID: "S", Text: "SPOUSE"},
+		}},
+		Allergies:       []*ir.Allergy{{Type: "FA", Description: ir.CodedElement{ID: "E", Text: "Egg"}, Severity: "MO", Reaction: "Rash"}},
+		Diagnoses:       []*ir.DiagnosisOrProcedure{{Description: &ir.CodedElement{ID: "A01.0", Text: "Typhoid fever"}, Clinician: doctor}},
+		Procedures:      []*ir.DiagnosisOrProcedure{{Description: &ir.CodedElement{ID: "P01", Text: "Procedure"}, Clinician: doctor}},
+		PrimaryFacility: &ir.PrimaryFacility{Organization: "Ottoline Quackenbush Surgery", ID: "G1234"},
+	}
+	otherP := &ir.PatientInfo{
+		Person:   &ir.Person{FirstName: "Cornelius", Surname: "Throckmorton", MRN: "192837465"},
+		VisitID:  111999777,
+		Location: &ir.PatientLocation{Poc: "Ward 1", Room: "Bay 1", Bed: "Bed 2", Facility: "Hospital", LocationType: "BED"},
+	}
+	mergedMRN := "135792468"
+	o := &ir.Order{
+		OrderProfile:     &ir.CodedElement{ID: "UREA", Text: "UREA AND ELECTROLYTES"},
+		Placer:           "P123",
+		Filler:           "F456",
+		OrderDateTime:    ir.NewValidTime(time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)),
+		OrderControl:     "RE",
+		OrderStatus:      "CM",
+		ResultsStatus:    "F",
+		OrderingProvider: doctor,
+		Results: []*ir.Result{
+			{TestName: &ir.CodedElement{ID: "CRE", Text: "Creatinine"}, Value: "126", Unit: "UMOLL", ValueType: "NM", Status: "F"},
+			{TestName: &ir.CodedElement{ID: "CMT", Text: "Comment"}, Value: "Discussed with Wilhelmina Featherstonehaugh", ValueType: "TX", Status: "F", Notes: []string{"Seen by Dr Quackenbush"}},
+		},
+		NotesForORM: []string{"Called Bartholomew Featherstonehaugh"},
+	}
+	doc := &ir.Document{
+		DocumentType:          "DS",
+		UniqueDocumentNumber:  "DOC1",
+		ObservationIdentifier: &ir.CodedElement{ID: "DS", Text: "Discharge summary"},
+		ContentLine:           []string{"Wilhelmina Featherstonehaugh was discharged"},
+	}
+
+	h := &message.HeaderInfo{SendingApplication: "SIMHOSP", MessageControlID: "1"}
+	now := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	adt := map[string]func(*message.HeaderInfo, *ir.PatientInfo, time.Time, time.Time) (*message.HL7Message, error){
+		"ADT^A01": message.BuildAdmissionADTA01,
+		"ADT^A02": message.BuildTransferADTA02,
+		"ADT^A03": message.BuildDischargeADTA03,
+		"ADT^A04": message.BuildRegistrationADTA04,
+		"ADT^A05": message.BuildPreAdmitADTA05,
+		"ADT^A09": message.BuildTrackDepartureADTA09,
+		"ADT^A10": message.BuildTrackArrivalADTA10,
+		"ADT^A11": message.BuildCancelVisitADTA11,
+		"ADT^A12": message.BuildCancelTransferADTA12,
+		"ADT^A13": message.BuildCancelDischargeADTA13,
+		"ADT^A14": message.BuildPendingAdmissionADTA14,
+		"ADT^A15": message.BuildPendingTransferADTA15,
+		"ADT^A16": message.BuildPendingDischargeADTA16,
+		"ADT^A23": message.BuildDeleteVisitADTA23,
+		"ADT^A25": message.BuildCancelPendingDischargeADTA25,
+		"ADT^A26": message.BuildCancelPendingTransferADTA26,
+		"ADT^A27": message.BuildCancelPendingAdmitADTA27,
+		"ADT^A28": message.BuildAddPersonADTA28,
+		"ADT^A31": message.BuildUpdatePersonADTA31,
+	}
+	orders := map[string]func(*message.HeaderInfo, *ir.PatientInfo, *ir.Order, time.Time) (*message.HL7Message, error){
+		"ORU^R01": message.BuildResultORUR01,
+		"ORU^R03": message.BuildResultORUR03,
+		"ORU^R32": message.BuildResultORUR32,
+		"ORM^O01": message.BuildOrderORMO01,
+		"ORR^O02": message.BuildPathologyORRO02,
+	}
+	msgs := map[string]*message.HL7Message{}
+	build := func(name string, msg *message.HL7Message, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Building %s failed with %v", name, err)
+		}
+		msgs[name] = msg
+	}
+	for name, f := range adt {
+		msg, err := f(h, p, now, now)
+		build(name, msg, err)
+	}
+	for name, f := range orders {
+		msg, err := f(h, p, o, now)
+		build(name, msg, err)
+	}
+	msg, err := message.BuildUpdatePatientADTA08(h, p, true, now, now)
+	build("ADT^A08", msg, err)
+	msg, err = message.BuildBedSwapADTA17(h, p, now, now, otherP)
+	build("ADT^A17", msg, err)
+	msg, err = message.BuildMergeADTA34(h, p, now, now, mergedMRN)
+	build("ADT^A34", msg, err)
+	msg, err = message.BuildMergeADTA40(h, p, now, now, []string{mergedMRN})
+	build("ADT^A40", msg, err)
+	msg, err = message.BuildDocumentNotificationMDMT02(h, p, doc, now, now)
+	build("MDM^T02", msg, err)
+
+	m, err := hardcoded.NewManager(ctx, test.HardcodedMessagesDirProd, &header.MessageControlGenerator{})
+	if err != nil {
+		t.Fatalf("hardcoded.NewManager(%s) failed with %v", test.HardcodedMessagesDirProd, err)
+	}
+	for _, name := range hardcodedMessageNames(ctx, t, test.HardcodedMessagesDirProd) {
+		msg, err := m.Message(fmt.Sprintf("^%s$", name), p, now)
+		build(name, msg, err)
+	}
+
+	names := []string{
+		"Wilhelmina", "Philippa", "Featherstonehaugh", "Bartholomew", "Quackenbush", "Ottoline", "Cornelius", "Throckmorton",
+		"Wisteria", "Whinging", "7946",
+		// The names in the hardcoded messages.
+		"Invalid NHS", "FN20180709162444", "ZZZDOCTOR", "Subel", "Smith", "BLACK",
+	}
+	ids := []string{p.Person.MRN, p.Person.NHS, "564738291", otherP.Person.MRN, mergedMRN, doctor.ID, "G1234"}
+	for name, msg := range msgs {
+		t.Run(name, func(t *testing.T) {
+			identifiers, err := message.ParseIdentifiers(msg.Message)
+			if err != nil {
+				t.Fatalf("message.ParseIdentifiers(%q) failed with %v", msg.Message, err)
+			}
+			var mustNotSurvive []string
+			mustNotSurvive = append(mustNotSurvive, names...)
+			mustNotSurvive = append(mustNotSurvive, ids...)
+			mustNotSurvive = append(mustNotSurvive, identifiers.MRNs...)
+			mustNotSurvive = append(mustNotSurvive, identifiers.VisitIDs...)
+			got, err := d.Deidentify([]byte(msg.Message))
+			if err != nil {
+				t.Fatalf("Deidentify(%q) failed with %v", msg.Message, err)
+			}
+			for _, v := range mustNotSurvive {
+				if strings.Contains(string(got), v) {
+					t.Errorf("Deidentify(%q) got %q, which contains %q", msg.Message, got, v)
+				}
+			}
+		})
+	}
+}
+
+// hardcodedMessageNames returns the names of the hardcoded messages in the given directory.
+func hardcodedMessageNames(ctx context.Context, t *testing.T, dir string) []string {
+	t.Helper()
+	fs, err := files.List(ctx, dir)
+	if err != nil {
+		t.Fatalf("files.List(%s) failed with %v", dir, err)
+	}
+	var names []string
+	for _, f := range fs {
+		data, err := f.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read(%s) failed with %v", f.FullPath(), err)
+		}
+		msgs := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &msgs); err != nil {
+			t.Fatalf("yaml.Unmarshal(%s) failed with %v", f.FullPath(), err)
+		}
+		for name := range msgs {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestMain(m *testing.M) {
+	hl7.TimezoneAndLocation("Europe/London")
+	retCode := m.Run()
+	os.Exit(retCode)
+}
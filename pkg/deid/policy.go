@@ -0,0 +1,277 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deid
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"github.com/google/simhospital/pkg/files"
+)
+
+// Action is what is done with the values at a location.
+type Action string
+
+// The actions that can be set in a policy.
+const (
+	// ActionKeep keeps the values as they are.
+	ActionKeep Action = "keep"
+	// ActionDrop removes the values. Dropping a whole segment, e.g., NK1, removes the segment.
+	ActionDrop Action = "drop"
+	// ActionHash replaces the values with a salted hash. The same value is always replaced with the
+	// same hash, regardless of its location, so identifiers still match across segments and messages.
+	ActionHash Action = "hash"
+	// ActionDateShift shifts dates and date/times by a number of days that is the same for all the
+	// values of the same patient.
+	ActionDateShift Action = "date_shift"
+	// ActionFake replaces the values with values generated like the ones of synthetic patients.
+	// The fake values of the same patient are the same for the lifetime of the Deidentifier.
+	ActionFake Action = "fake"
+	// ActionKeepNumeric keeps the values that are numbers, optionally preceded by a comparator such as
+	// "<" or ">=", and drops the others. It is meant for fields such as OBX-5, where numeric results
+	// are not identifying but free text can be.
+	ActionKeepNumeric Action = "keep_numeric"
+)
+
+// Fake is the kind of value that replaces a value with ActionFake.
+type Fake string
+
+// The kinds of fake values.
+const (
+	// FakeName is a patient name (XPN), e.g., PID-5. Components after the sixth one, e.g., the name
+	// type code, are kept. It can only be used for whole fields.
+	FakeName Fake = "name"
+	// FakeFirstName is a first name.
+	FakeFirstName Fake = "first_name"
+	// FakeMiddleName is a middle name.
+	FakeMiddleName Fake = "middle_name"
+	// FakeSurname is a surname.
+	FakeSurname Fake = "surname"
+	// FakeAddress is an address (XAD), e.g., PID-11. Components after the sixth one, e.g., the
+	// address type, are kept. It can only be used for whole fields.
+	FakeAddress Fake = "address"
+	// FakePhoneNumber is a phone number.
+	FakePhoneNumber Fake = "phone_number"
+	// FakeMRN is a medical record number.
+	FakeMRN Fake = "mrn"
+	// FakeNHSNumber is an NHS number.
+	FakeNHSNumber Fake = "nhs_number"
+)
+
+var fakes = map[Fake]bool{
+	FakeName:        true,
+	FakeFirstName:   true,
+	FakeMiddleName:  true,
+	FakeSurname:     true,
+	FakeAddress:     true,
+	FakePhoneNumber: true,
+	FakeMRN:         true,
+	FakeNHSNumber:   true,
+}
+
+const (
+	// DefaultMaxDateShiftDays is the maximum number of days that dates are shifted by if
+	// Policy.MaxDateShiftDays is not set.
+	DefaultMaxDateShiftDays = 365
+	// DefaultPatientID is the location of the patient identifier if Policy.PatientID is not set.
+	DefaultPatientID = "PID-3.1"
+)
+
+// locationRegexp matches locations such as PID, PID-5, PID-5.1 or PID-5.1.1.
+var locationRegexp = regexp.MustCompile(`^([A-Z][A-Z0-9]{2})(?:-([1-9][0-9]*)(?:\.([1-9][0-9]*)(?:\.([1-9][0-9]*))?)?)?$`)
+
+// Policy is a de-identification policy.
+type Policy struct {
+	// Salt is the secret used to hash values and to compute the date shifts.
+	// It is required if any rule hashes values or shifts dates.
+	Salt string `yaml:"salt"`
+	// MaxDateShiftDays is the maximum number of days, in the past or in the future, that dates are
+	// shifted by. If zero, DefaultMaxDateShiftDays is used.
+	MaxDateShiftDays int `yaml:"max_date_shift_days"`
+	// PatientID is the location of the value that identifies the patient of a message, used to
+	// shift dates and generate fake values consistently for the same patient.
+	// If empty, DefaultPatientID is used.
+	PatientID string `yaml:"patient_id"`
+	// DefaultAction is the action for the values at locations that don't match any rule, including
+	// the fields of unknown segments and Z-segments: ActionDrop or ActionHash. If empty, ActionDrop
+	// is used, so that values are only kept if a rule keeps them.
+	DefaultAction Action `yaml:"default_action"`
+	// Rules are the rules to apply, in order. A rule for a location also applies to the locations
+	// within it, e.g., a rule for PID-5 applies to PID-5.1, unless there is a rule for them too.
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is the action to apply to the values at a location.
+type Rule struct {
+	// Location is a segment, e.g., NK1, a field, e.g., PID-5, a component, e.g., PID-5.1, or a
+	// subcomponent, e.g., PID-5.1.1. The action applies to all the segments with that name and to
+	// all the repetitions of the field.
+	Location string `yaml:"location"`
+	// Action is the action to apply.
+	Action Action `yaml:"action"`
+	// Fake is the kind of value to replace the values with. Only relevant if Action is ActionFake.
+	Fake Fake `yaml:"fake"`
+}
+
+// location is a parsed location.
+type location struct {
+	segment string
+	// field, component and subcomponent are 1-based, or 0 if the location doesn't go that deep.
+	field        int
+	component    int
+	subcomponent int
+}
+
+func (l location) String() string {
+	s := l.segment
+	for i, v := range []int{l.field, l.component, l.subcomponent} {
+		if v == 0 {
+			break
+		}
+		sep := "."
+		if i == 0 {
+			sep = "-"
+		}
+		s += sep + strconv.Itoa(v)
+	}
+	return s
+}
+
+func parseLocation(s string) (location, error) {
+	m := locationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return location{}, fmt.Errorf("invalid location %q; locations are segments (PID), fields (PID-5), components (PID-5.1) or subcomponents (PID-5.1.1)", s)
+	}
+	l := location{segment: m[1]}
+	for i, p := range []*int{&l.field, &l.component, &l.subcomponent} {
+		if m[i+2] != "" {
+			*p, _ = strconv.Atoi(m[i+2])
+		}
+	}
+	if l.segment == "MSH" && l.field != 0 && l.field <= 2 {
+		return location{}, fmt.Errorf("invalid location %q: the MSH-1 and MSH-2 fields cannot be de-identified", s)
+	}
+	return l, nil
+}
+
+// contains returns whether o is l or a location within l, e.g., PID-5 contains PID-5 and PID-5.1.
+func (l location) contains(o location) bool {
+	if l.segment != o.segment {
+		return false
+	}
+	for _, p := range [][2]int{{l.field, o.field}, {l.component, o.component}, {l.subcomponent, o.subcomponent}} {
+		if p[0] == 0 {
+			return true
+		}
+		if p[0] != p[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadPolicy loads a de-identification policy from the given YAML file.
+func LoadPolicy(ctx context.Context, fileName string) (*Policy, error) {
+	data, err := files.Read(ctx, fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read de-identification policy file %s", fileName)
+	}
+	var p Policy
+	if err := yaml.UnmarshalStrict(data, &p); err != nil {
+		return nil, errors.Wrapf(err, "cannot unmarshal de-identification policy file %s", fileName)
+	}
+	return &p, nil
+}
+
+// compiledRule is a Rule with its location parsed.
+type compiledRule struct {
+	Rule
+	loc location
+}
+
+// compile validates the policy and returns its rules with their locations parsed.
+func (p *Policy) compile() ([]compiledRule, error) {
+	if p.MaxDateShiftDays < 0 {
+		return nil, fmt.Errorf("invalid max_date_shift_days %d: it must not be negative", p.MaxDateShiftDays)
+	}
+	if p.PatientID != "" {
+		l, err := parseLocation(p.PatientID)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid patient_id")
+		}
+		if l.field == 0 {
+			return nil, fmt.Errorf("invalid patient_id %q: it must be a field, a component or a subcomponent", p.PatientID)
+		}
+	}
+	switch p.DefaultAction {
+	case "", ActionDrop:
+	case ActionHash:
+		if p.Salt == "" {
+			return nil, fmt.Errorf("invalid default_action %s: it requires a salt", p.DefaultAction)
+		}
+	default:
+		return nil, fmt.Errorf("invalid default_action %q; valid default actions are drop and hash", p.DefaultAction)
+	}
+	var rules []compiledRule
+	seen := map[string]bool{}
+	for i, r := range p.Rules {
+		l, err := parseLocation(r.Location)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid rule %d", i)
+		}
+		if seen[l.String()] {
+			return nil, fmt.Errorf("invalid rule %d: location %s is used in more than one rule", i, l)
+		}
+		seen[l.String()] = true
+		if l.segment == "MSH" && l.field == 0 && r.Action != ActionKeep {
+			return nil, fmt.Errorf("invalid rule %d: the MSH segment can only be kept", i)
+		}
+		switch r.Action {
+		case ActionKeep, ActionDrop:
+		case ActionKeepNumeric:
+			if l.field == 0 {
+				return nil, fmt.Errorf("invalid rule %d: action %s cannot be applied to whole segments", i, r.Action)
+			}
+		case ActionHash, ActionDateShift:
+			if l.field == 0 {
+				return nil, fmt.Errorf("invalid rule %d: action %s cannot be applied to whole segments", i, r.Action)
+			}
+			if p.Salt == "" {
+				return nil, fmt.Errorf("invalid rule %d: action %s requires a salt", i, r.Action)
+			}
+		case ActionFake:
+			if l.field == 0 {
+				return nil, fmt.Errorf("invalid rule %d: action %s cannot be applied to whole segments", i, r.Action)
+			}
+			if !fakes[r.Fake] {
+				return nil, fmt.Errorf("invalid rule %d: unknown fake value %q", i, r.Fake)
+			}
+			if (r.Fake == FakeName || r.Fake == FakeAddress) && l.component != 0 {
+				return nil, fmt.Errorf("invalid rule %d: fake value %s can only be used for whole fields", i, r.Fake)
+			}
+		default:
+			return nil, fmt.Errorf("invalid rule %d: unknown action %q; valid actions are keep, keep_numeric, drop, hash, date_shift and fake", i, r.Action)
+		}
+		if r.Fake != "" && r.Action != ActionFake {
+			return nil, fmt.Errorf("invalid rule %d: fake can only be set with action fake", i)
+		}
+		rules = append(rules, compiledRule{Rule: r, loc: l})
+	}
+	return rules, nil
+}
@@ -0,0 +1,413 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fault injects delivery faults into the HL7 messages sent by a sender, to test how the
+// systems that receive them recover.
+package fault
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/google/simhospital/pkg/message"
+)
+
+var log = logging.ForCallerPackage()
+
+// Kinds of faults.
+const (
+	// Duplicate sends the message twice.
+	Duplicate = "duplicate"
+	// Reorder holds the message back, and sends it after the next message of the same patient, or
+	// once it has been held back for Config.MaxHold.
+	Reorder = "reorder"
+	// Drop doesn't send the message.
+	Drop = "drop"
+	// Truncate sends the message cut at a random point after the MSH segment.
+	Truncate = "truncate"
+	// Corrupt overwrites a few bytes of a random segment other than MSH with delimiters and invalid
+	// characters.
+	Corrupt = "corrupt"
+	// CloseConnection sends the start of the message and closes the connection.
+	CloseConnection = "close_connection"
+)
+
+// DefaultMaxHold is the maximum time that a message is held back by a Reorder fault if
+// Config.MaxHold is not set.
+const DefaultMaxHold = time.Minute
+
+// maxCorruptedBytes is the maximum number of bytes overwritten in a corrupted segment.
+const maxCorruptedBytes = 8
+
+// corruptBytes are the bytes that corrupted segments are overwritten with.
+var corruptBytes = []byte("|^~\\&\x00\xff")
+
+// Config configures the faults to inject.
+// At most one fault is injected into each message, so the probabilities must add up to at most 1.
+type Config struct {
+	// Duplicate is the probability of sending a message twice.
+	Duplicate float64
+	// Reorder is the probability of sending a message after the next message of the same patient.
+	Reorder float64
+	// MaxHold is the maximum time that a message is held back by a Reorder fault. A message held
+	// back for longer is sent before the next message, even if it is of another patient.
+	// If zero, DefaultMaxHold is used.
+	MaxHold time.Duration
+	// Drop is the probability of not sending a message.
+	Drop float64
+	// Truncate is the probability of sending a message cut at a random point after the MSH segment.
+	Truncate float64
+	// Corrupt is the probability of overwriting a few bytes of a segment of a message.
+	Corrupt float64
+	// CloseConnection is the probability of closing the connection while a message is being sent.
+	// It is only supported if the sender implements hl7.Interrupter.
+	CloseConnection float64
+	// LogFile is the file where each fault is written as a line of JSON. If empty, faults are only
+	// logged.
+	LogFile string
+	// Seed is the seed of the random generator that decides which faults to inject. If zero, a random
+	// seed is used.
+	Seed int64
+}
+
+// Record is a fault injected into a message.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Fault     string    `json:"fault"`
+	ControlID string    `json:"control_id"`
+	MRN       string    `json:"mrn,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// heldMessage is a message held back by a Reorder fault.
+type heldMessage struct {
+	msg   []byte
+	since time.Time
+}
+
+type probability struct {
+	fault       string
+	probability float64
+}
+
+// Sender sends HL7 messages with another sender, injecting faults into some of them.
+type Sender struct {
+	sender  hl7.Sender
+	faults  []probability
+	maxHold time.Duration
+	now     func() time.Time
+
+	// mu guards the fields below.
+	mu   sync.Mutex
+	rand *rand.Rand
+	// held are the messages held back by a Reorder fault, keyed by MRN.
+	held  map[string]heldMessage
+	file  *os.File
+	enc   *json.Encoder
+	count map[string]int
+}
+
+// NewSender returns a sender that sends messages with s, injecting faults into them as configured.
+func NewSender(s hl7.Sender, config Config) (*Sender, error) {
+	faults := []probability{
+		{fault: Duplicate, probability: config.Duplicate},
+		{fault: Reorder, probability: config.Reorder},
+		{fault: Drop, probability: config.Drop},
+		{fault: Truncate, probability: config.Truncate},
+		{fault: Corrupt, probability: config.Corrupt},
+		{fault: CloseConnection, probability: config.CloseConnection},
+	}
+	total := 0.0
+	for _, f := range faults {
+		if f.probability < 0 || f.probability > 1 {
+			return nil, errors.Errorf("invalid probability %v of %s faults; must be between 0 and 1", f.probability, f.fault)
+		}
+		total += f.probability
+	}
+	if total > 1 {
+		return nil, errors.Errorf("invalid fault probabilities: they add up to %v, more than 1", total)
+	}
+	if config.MaxHold < 0 {
+		return nil, errors.Errorf("invalid maximum hold time %v; must not be negative", config.MaxHold)
+	}
+	maxHold := config.MaxHold
+	if maxHold == 0 {
+		maxHold = DefaultMaxHold
+	}
+	if _, ok := s.(hl7.Interrupter); config.CloseConnection > 0 && !ok {
+		return nil, errors.Errorf("the sender %T does not support closing the connection while sending a message", s)
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Infof("Injecting faults into messages with seed %d", seed)
+	fs := &Sender{
+		sender:  s,
+		faults:  faults,
+		maxHold: maxHold,
+		now:     time.Now,
+		rand:    rand.New(rand.NewSource(seed)),
+		held:    map[string]heldMessage{},
+		count:   map[string]int{},
+	}
+	if config.LogFile != "" {
+		f, err := os.Create(config.LogFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot create fault log %s", config.LogFile)
+		}
+		fs.file = f
+		fs.enc = json.NewEncoder(f)
+	}
+	return fs, nil
+}
+
+// Send sends the message, possibly injecting a fault into it.
+// Faults are transparent to the caller: Send returns nil for messages that are dropped or held back
+// by a Reorder fault, like for messages sent without faults, so that the message is reported as
+// generated. The faults are only written to the logs and to the fault log.
+// Before the message is sent, Send sends the messages that have been held back for longer than
+// Config.MaxHold. After the message is sent, Send sends the message of the same patient that was
+// held back, if any. Errors sending held messages are logged, since their Send call has already
+// returned.
+func (s *Sender) Send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseExpired()
+	mrn := message.PatientID(string(msg))
+	_, isHeld := s.held[mrn]
+	fault := s.pick()
+	if fault == Reorder {
+		// Only one message of each patient is held back at a time. Messages without a patient are not
+		// held back, since there is no next message of the same patient to send them after.
+		if isHeld || mrn == "" {
+			fault = ""
+		} else {
+			// The caller can reuse the message after Send returns, but it is sent later.
+			s.held[mrn] = heldMessage{msg: append([]byte(nil), msg...), since: s.now()}
+			s.record(Reorder, msg, fmt.Sprintf("held back until the next message of the patient, for at most %v", s.maxHold))
+			return nil
+		}
+	}
+	err := s.inject(fault, msg)
+	if isHeld {
+		s.release(mrn, "after the next message of the patient")
+	}
+	return err
+}
+
+// Close sends the messages that are still held back, and closes the underlying sender and the
+// fault log. Close prints the number of faults of each kind that have been injected.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mrn := range s.heldMRNs(func(heldMessage) bool { return true }) {
+		s.release(mrn, "when the sender was closed")
+	}
+
+	var kinds []string
+	for _, f := range s.faults {
+		kinds = append(kinds, fmt.Sprintf("%s: %d", f.fault, s.count[f.fault]))
+	}
+	log.Infof("Faults injected into messages: %s", strings.Join(kinds, ", "))
+
+	if err := s.sender.Close(); err != nil {
+		if s.file != nil {
+			s.file.Close()
+		}
+		return err
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return errors.Wrap(err, "closing fault log")
+		}
+	}
+	return nil
+}
+
+// releaseExpired sends the messages that have been held back for at least Config.MaxHold.
+func (s *Sender) releaseExpired() {
+	now := s.now()
+	expired := s.heldMRNs(func(h heldMessage) bool { return now.Sub(h.since) >= s.maxHold })
+	for _, mrn := range expired {
+		s.release(mrn, "after the maximum hold time")
+	}
+}
+
+// heldMRNs returns the MRNs of the patients whose held message matches f, in the order in which the
+// messages were held back.
+func (s *Sender) heldMRNs(f func(heldMessage) bool) []string {
+	var mrns []string
+	for mrn, h := range s.held {
+		if f(h) {
+			mrns = append(mrns, mrn)
+		}
+	}
+	sort.Slice(mrns, func(i, j int) bool {
+		hi, hj := s.held[mrns[i]], s.held[mrns[j]]
+		if !hi.since.Equal(hj.since) {
+			return hi.since.Before(hj.since)
+		}
+		return mrns[i] < mrns[j]
+	})
+	return mrns
+}
+
+// release sends the message of the given patient that was held back, and writes when it was sent
+// to the fault log.
+func (s *Sender) release(mrn string, when string) {
+	h := s.held[mrn]
+	delete(s.held, mrn)
+	if err := s.sender.Send(h.msg); err != nil {
+		log.WithError(err).WithField("mrn", mrn).Error("Cannot send the message held back")
+		return
+	}
+	now := s.now()
+	s.write(Record{
+		Time:      now,
+		Fault:     Reorder,
+		ControlID: message.ControlID(string(h.msg)),
+		MRN:       mrn,
+		Detail:    fmt.Sprintf("sent %s, held back for %v", when, now.Sub(h.since)),
+	})
+}
+
+// pick returns the fault to inject into the next message, or an empty string if none.
+func (s *Sender) pick() string {
+	r := s.rand.Float64()
+	for _, f := range s.faults {
+		if r < f.probability {
+			return f.fault
+		}
+		r -= f.probability
+	}
+	return ""
+}
+
+// inject sends the message with the given fault.
+func (s *Sender) inject(fault string, msg []byte) error {
+	switch fault {
+	case Drop:
+		s.record(Drop, msg, "")
+		return nil
+	case Duplicate:
+		if err := s.sender.Send(msg); err != nil {
+			return err
+		}
+		s.record(Duplicate, msg, "")
+		return s.sender.Send(msg)
+	case Truncate:
+		n, ok := s.truncatePoint(msg)
+		if !ok {
+			break
+		}
+		s.record(Truncate, msg, fmt.Sprintf("truncated to %d of %d bytes", n, len(msg)))
+		return s.sender.Send(msg[:n])
+	case Corrupt:
+		corrupted, detail, ok := s.corrupt(msg)
+		if !ok {
+			break
+		}
+		s.record(Corrupt, msg, detail)
+		return s.sender.Send(corrupted)
+	case CloseConnection:
+		if len(msg) < 2 {
+			break
+		}
+		n := 1 + s.rand.Intn(len(msg)-1)
+		s.record(CloseConnection, msg, fmt.Sprintf("connection closed after %d of %d bytes", n, len(msg)))
+		return s.sender.(hl7.Interrupter).Interrupt(msg, n)
+	}
+	return s.sender.Send(msg)
+}
+
+// truncatePoint returns a random length to truncate the message to, which keeps the MSH segment and
+// drops at least one byte, or false if the message only has an MSH segment.
+func (s *Sender) truncatePoint(msg []byte) (int, bool) {
+	msh := strings.Index(string(msg), hl7.SegmentTerminatorStr)
+	// The message can be truncated to any length between the end of the MSH segment and len(msg)-1.
+	if msh < 0 || len(msg)-msh-1 < 1 {
+		return 0, false
+	}
+	return msh + 1 + s.rand.Intn(len(msg)-msh-1), true
+}
+
+// corrupt returns a copy of the message with a few bytes of a random segment other than MSH
+// overwritten, and a description of what was corrupted, or false if there are no segments to
+// corrupt.
+// The segment name and the segment terminators are not corrupted, so the message still has the
+// same segments.
+func (s *Sender) corrupt(msg []byte) ([]byte, string, bool) {
+	segments := strings.Split(string(msg), hl7.SegmentTerminatorStr)
+	// Only segments with something after the segment name and the field separator can be corrupted.
+	var candidates []int
+	for i, segment := range segments {
+		if i > 0 && len(segment) > 4 {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, "", false
+	}
+	i := candidates[s.rand.Intn(len(candidates))]
+	segment := []byte(segments[i])
+	start := 4 + s.rand.Intn(len(segment)-4)
+	end := start + 1 + s.rand.Intn(maxCorruptedBytes)
+	if end > len(segment) {
+		end = len(segment)
+	}
+	for j := start; j < end; j++ {
+		segment[j] = corruptBytes[s.rand.Intn(len(corruptBytes))]
+	}
+	segments[i] = string(segment)
+	detail := fmt.Sprintf("%d bytes of segment %d (%s) overwritten from byte %d", end-start, i, segment[:3], start)
+	return []byte(strings.Join(segments, hl7.SegmentTerminatorStr)), detail, true
+}
+
+// record counts and logs the fault, and writes it to the fault log if there is one.
+func (s *Sender) record(fault string, msg []byte, detail string) {
+	s.count[fault]++
+	r := Record{
+		Time:      s.now(),
+		Fault:     fault,
+		ControlID: message.ControlID(string(msg)),
+		MRN:       message.PatientID(string(msg)),
+		Detail:    detail,
+	}
+	log.WithField("fault", r.Fault).
+		WithField("control_id", r.ControlID).
+		WithField("mrn", r.MRN).
+		Warningf("Injecting fault into message: %s %s", r.Fault, r.Detail)
+	s.write(r)
+}
+
+// write writes the record to the fault log if there is one.
+func (s *Sender) write(r Record) {
+	if s.enc == nil {
+		return
+	}
+	if err := s.enc.Encode(r); err != nil {
+		log.WithError(err).Error("Cannot write the fault to the fault log")
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/test/testhl7"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+var (
+	m1 = testMessage("1", "1111")
+	m2 = testMessage("2", "1111")
+	m3 = testMessage("3", "2222")
+)
+
+func testMessage(controlID, mrn string) string {
+	return strings.Join([]string{
+		"MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A01|" + controlID + "|T|2.3",
+		"EVN|A01|20200101000000",
+		fmt.Sprintf("PID|1||%s^^^SIMULATOR MRN^MRN||Surname^Name", mrn),
+	}, hl7.SegmentTerminatorStr)
+}
+
+// interruptSender is an hl7.Sender that can be interrupted.
+type interruptSender struct {
+	testhl7.Sender
+	interrupted []string
+}
+
+func (s *interruptSender) Interrupt(message []byte, n int) error {
+	s.interrupted = append(s.interrupted, string(message[:n]))
+	return nil
+}
+
+// send sends the messages and closes the sender.
+func send(t *testing.T, s *Sender, messages ...string) {
+	t.Helper()
+	for _, m := range messages {
+		if err := s.Send([]byte(m)); err != nil {
+			t.Fatalf("Send(%q) failed with %v", m, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+}
+
+func TestSender(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+		want   []string
+	}{{
+		name:   "no faults",
+		config: Config{},
+		want:   []string{m1, m2, m3},
+	}, {
+		name:   "duplicate",
+		config: Config{Duplicate: 1},
+		want:   []string{m1, m1, m2, m2, m3, m3},
+	}, {
+		name:   "drop",
+		config: Config{Drop: 1},
+	}, {
+		// m1 is held back until m2 is sent, which is not held back because m1 already is. m3 is held
+		// back until the sender is closed.
+		name:   "reorder",
+		config: Config{Reorder: 1},
+		want:   []string{m2, m1, m3},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := &testhl7.Sender{}
+			s, err := NewSender(inner, tc.config)
+			if err != nil {
+				t.Fatalf("NewSender(%+v) failed with %v", tc.config, err)
+			}
+			send(t, s, m1, m2, m3)
+			if diff := cmp.Diff(tc.want, inner.GetSentMessages()); diff != "" {
+				t.Errorf("sent messages got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSender_Reorder(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	inner := &testhl7.Sender{}
+	s, err := NewSender(inner, Config{Reorder: 1, MaxHold: time.Minute})
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	s.now = func() time.Time { return now }
+	noPatient := strings.Split(m1, hl7.SegmentTerminatorStr)[0]
+
+	send := func(msg string) {
+		t.Helper()
+		if err := s.Send([]byte(msg)); err != nil {
+			t.Fatalf("Send(%q) failed with %v", msg, err)
+		}
+	}
+	send(m1)
+	// Messages without a patient are not held back.
+	send(noPatient)
+	now = now.Add(30 * time.Second)
+	send(m3)
+	// m1 has been held back for MaxHold, so it is sent before the next message. m3 has not.
+	now = now.Add(30 * time.Second)
+	send(noPatient)
+	if diff := cmp.Diff([]string{noPatient, m1, noPatient}, inner.GetSentMessages()); diff != "" {
+		t.Errorf("sent messages got diff (-want +got):\n%s", diff)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+	if diff := cmp.Diff([]string{noPatient, m1, noPatient, m3}, inner.GetSentMessages()); diff != "" {
+		t.Errorf("sent messages after Close() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSender_Truncate(t *testing.T) {
+	inner := &testhl7.Sender{}
+	s, err := NewSender(inner, Config{Truncate: 1, Seed: 1})
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	msh := strings.Split(m1, hl7.SegmentTerminatorStr)[0] + hl7.SegmentTerminatorStr
+	send(t, s, m1, m1, m1)
+	for _, got := range inner.GetSentMessages() {
+		if !strings.HasPrefix(m1, got) || len(got) >= len(m1) || len(got) < len(msh) {
+			t.Errorf("sent message %q, want a prefix of %q that contains the MSH segment", got, m1)
+		}
+	}
+}
+
+func TestSender_Corrupt(t *testing.T) {
+	inner := &testhl7.Sender{}
+	s, err := NewSender(inner, Config{Corrupt: 1, Seed: 1})
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	send(t, s, m1, m1, m1)
+	want := strings.Split(m1, hl7.SegmentTerminatorStr)
+	for _, got := range inner.GetSentMessages() {
+		if got == m1 {
+			t.Errorf("sent message %q, want it corrupted", got)
+		}
+		segments := strings.Split(got, hl7.SegmentTerminatorStr)
+		if len(segments) != len(want) {
+			t.Fatalf("sent message %q has %d segments, want %d", got, len(segments), len(want))
+		}
+		if segments[0] != want[0] {
+			t.Errorf("sent message MSH segment got %q, want %q", segments[0], want[0])
+		}
+		for i, segment := range segments {
+			if len(segment) != len(want[i]) || segment[:4] != want[i][:4] {
+				t.Errorf("sent message segment %d got %q, want the same length and name as %q", i, segment, want[i])
+			}
+		}
+	}
+}
+
+func TestSender_CloseConnection(t *testing.T) {
+	inner := &interruptSender{}
+	s, err := NewSender(inner, Config{CloseConnection: 1})
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	send(t, s, m1)
+	if got := len(inner.GetSentMessages()); got != 0 {
+		t.Errorf("sent %d messages, want 0", got)
+	}
+	if len(inner.interrupted) != 1 {
+		t.Fatalf("interrupted %d messages, want 1", len(inner.interrupted))
+	}
+	if got := inner.interrupted[0]; !strings.HasPrefix(m1, got) || got == "" || got == m1 {
+		t.Errorf("interrupted message got %q, want a non-empty strict prefix of %q", got, m1)
+	}
+}
+
+func TestSender_Log(t *testing.T) {
+	logFile := path.Join(testwrite.TempDir(t), "faults.jsonl")
+	s, err := NewSender(&testhl7.Sender{}, Config{Drop: 1, LogFile: logFile})
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	send(t, s, m1, m3)
+
+	f, err := os.Open(logFile)
+	if err != nil {
+		t.Fatalf("os.Open(%s) failed with %v", logFile, err)
+	}
+	defer f.Close()
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", scanner.Bytes(), err)
+		}
+		got = append(got, r)
+	}
+	want := []Record{
+		{Fault: Drop, ControlID: "1", MRN: "1111"},
+		{Fault: Drop, ControlID: "3", MRN: "2222"},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Record{}, "Time")); diff != "" {
+		t.Errorf("fault log got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewSender_Invalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		config Config
+	}{
+		{name: "negative probability", config: Config{Drop: -0.1}},
+		{name: "probability over 1", config: Config{Duplicate: 1.5}},
+		{name: "probabilities add up to over 1", config: Config{Drop: 0.6, Duplicate: 0.6}},
+		{name: "sender cannot be interrupted", config: Config{CloseConnection: 0.1}},
+		{name: "negative maximum hold time", config: Config{Reorder: 0.1, MaxHold: -time.Second}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewSender(&testhl7.Sender{}, tc.config); err == nil {
+				t.Errorf("NewSender(%+v) got nil error, want error", tc.config)
+			}
+		})
+	}
+}
@@ -47,6 +47,16 @@ const (
 	Collection = "COLLECTION"
 )
 
+const (
+	vitalSignsProfile         = "http://hl7.org/fhir/StructureDefinition/vitalsigns"
+	observationCategorySystem = "http://terminology.hl7.org/CodeSystem/observation-category"
+	vitalSignsCategory        = "vital-signs"
+	ucumSystem                = "http://unitsofmeasure.org"
+	conditionClinicalSystem   = "http://terminology.hl7.org/CodeSystem/condition-clinical"
+	conditionCategorySystem   = "http://terminology.hl7.org/CodeSystem/condition-category"
+	problemListItemCategory   = "problem-list-item"
+)
+
 var (
 	bundleTypes = map[string]cpb.BundleTypeCode_Value{
 		Batch:      cpb.BundleTypeCode_BATCH,
@@ -104,6 +114,9 @@ func (b *Bundler) createBundle(p *ir.PatientInfo) *r4pb.Bundle {
 	allergies := b.allergies(p.Allergies, patientRef)
 	addEntry(bundle, allergies...)
 
+	problems := b.problems(p.Problems, patientRef)
+	addEntry(bundle, problems...)
+
 	for _, ec := range p.Encounters {
 		encounter, encounterRef := b.encounter(ec, p.Class)
 
@@ -225,13 +238,25 @@ func (b *Bundler) allergies(allergies []*ir.Allergy, patientRef *dpb.Reference)
 }
 
 func (b *Bundler) codeableConcept(c ir.CodedElement) *dpb.CodeableConcept {
-	return &dpb.CodeableConcept{
+	cc := &dpb.CodeableConcept{
 		// The Text field should only be used if the code and coding system are unknown.
-		Coding: []*dpb.Coding{{
-			System:  &dpb.Uri{Value: b.cc.HL7ToFHIR(c.CodingSystem)},
-			Code:    &dpb.Code{Value: c.ID},
-			Display: &dpb.String{Value: c.Text},
-		}},
+		Coding: []*dpb.Coding{b.coding(c.ID, c.Text, c.CodingSystem)},
+	}
+	for _, a := range c.AlternateCodings {
+		text := a.Text
+		if text == "" {
+			text = c.Text
+		}
+		cc.Coding = append(cc.Coding, b.coding(a.ID, text, a.CodingSystem))
+	}
+	return cc
+}
+
+func (b *Bundler) coding(code string, text string, codingSystem string) *dpb.Coding {
+	return &dpb.Coding{
+		System:  &dpb.Uri{Value: b.cc.HL7ToFHIR(codingSystem)},
+		Code:    &dpb.Code{Value: code},
+		Display: &dpb.String{Value: text},
 	}
 }
 
@@ -396,6 +421,9 @@ func (b *Bundler) observations(encounterRef *dpb.Reference, patientRef *dpb.Refe
 		if r.TestName != nil {
 			o.Code = b.codeableConcept(*r.TestName)
 		}
+		if order.VitalSigns {
+			vitalSignsObservation(o, r)
+		}
 
 		entry := &r4pb.Bundle_Entry{
 			Resource: &r4pb.ContainedResource{
@@ -408,6 +436,23 @@ func (b *Bundler) observations(encounterRef *dpb.Reference, patientRef *dpb.Refe
 	return observations
 }
 
+// vitalSignsObservation makes the observation conform to the FHIR vital signs profile: it adds the profile and the
+// vital-signs category, and the UCUM code of the unit.
+func vitalSignsObservation(o *observationpb.Observation, r *ir.Result) {
+	o.Meta = &dpb.Meta{Profile: []*dpb.Canonical{{Value: vitalSignsProfile}}}
+	o.Category = []*dpb.CodeableConcept{{
+		Coding: []*dpb.Coding{{
+			System:  &dpb.Uri{Value: observationCategorySystem},
+			Code:    &dpb.Code{Value: vitalSignsCategory},
+			Display: &dpb.String{Value: "Vital Signs"},
+		}},
+	}}
+	if q := o.GetValue().GetQuantity(); q != nil && r.Unit != "" {
+		q.System = &dpb.Uri{Value: ucumSystem}
+		q.Code = &dpb.Code{Value: r.Unit}
+	}
+}
+
 func narrative(paragraphs ...string) *dpb.Narrative {
 	var sb strings.Builder
 	sb.WriteString("<div>")
@@ -538,6 +583,51 @@ func (b *Bundler) condition(diagnosis *ir.DiagnosisOrProcedure, patientRef *dpb.
 	return b.addURL(entry, id, "Condition"), ref
 }
 
+// problems returns a Condition in the problem list of the patient for each of the given problems, with their
+// current clinical status.
+func (b *Bundler) problems(problems []*ir.Problem, patientRef *dpb.Reference) []*r4pb.Bundle_Entry {
+	var entries []*r4pb.Bundle_Entry
+	for _, p := range problems {
+		id := b.idGenerator.NewID()
+		c := &conditionpb.Condition{
+			Id: &dpb.Id{Value: id},
+			ClinicalStatus: &dpb.CodeableConcept{
+				Coding: []*dpb.Coding{{
+					System: &dpb.Uri{Value: conditionClinicalSystem},
+					Code:   &dpb.Code{Value: p.ClinicalStatus},
+				}},
+			},
+			Category: []*dpb.CodeableConcept{{
+				Coding: []*dpb.Coding{{
+					System:  &dpb.Uri{Value: conditionCategorySystem},
+					Code:    &dpb.Code{Value: problemListItemCategory},
+					Display: &dpb.String{Value: "Problem List Item"},
+				}},
+			}},
+			Code:    b.codeableConcept(*p.Description),
+			Text:    narrative(p.Description.Text),
+			Subject: patientRef,
+		}
+		if p.Onset.Valid {
+			c.Onset = &conditionpb.Condition_OnsetX{
+				Choice: &conditionpb.Condition_OnsetX_DateTime{dateTime(p.Onset)},
+			}
+		}
+		if p.Abatement.Valid {
+			c.Abatement = &conditionpb.Condition_AbatementX{
+				Choice: &conditionpb.Condition_AbatementX_DateTime{dateTime(p.Abatement)},
+			}
+		}
+		entry := &r4pb.Bundle_Entry{
+			Resource: &r4pb.ContainedResource{
+				OneofResource: &r4pb.ContainedResource_Condition{c},
+			},
+		}
+		entries = append(entries, b.addURL(entry, id, "Condition"))
+	}
+	return entries
+}
+
 func (b *Bundler) practitioner(doctor *ir.Doctor) (*r4pb.Bundle_Entry, *dpb.Reference) {
 	if doctor == nil {
 		return nil, nil
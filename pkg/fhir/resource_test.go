@@ -176,6 +176,10 @@ func TestGenerate(t *testing.T) {
 							ID:           "TEST_ID_1",
 							Text:         "TEST_NAME_1",
 							CodingSystem: "SYSTEM",
+							AlternateCodings: []ir.Coding{
+								{ID: "ALT_ID_1", CodingSystem: "ALT_SYSTEM"},
+								{ID: "ALT_ID_2", Text: "ALT_NAME_2", CodingSystem: "SYSTEM"},
+							},
 						},
 						Value:        "VALUE",
 						Unit:         "UNIT",
@@ -707,6 +711,14 @@ func TestGenerate(t *testing.T) {
 									Code:    &dpb.Code{Value: "TEST_ID_1"},
 									System:  &dpb.Uri{Value: "SYSTEM_URI"},
 									Display: &dpb.String{Value: "TEST_NAME_1"},
+								}, {
+									Code:    &dpb.Code{Value: "ALT_ID_1"},
+									System:  &dpb.Uri{Value: "ALT_SYSTEM"},
+									Display: &dpb.String{Value: "TEST_NAME_1"},
+								}, {
+									Code:    &dpb.Code{Value: "ALT_ID_2"},
+									System:  &dpb.Uri{Value: "SYSTEM_URI"},
+									Display: &dpb.String{Value: "ALT_NAME_2"},
 								}},
 							},
 							Encounter: &dpb.Reference{
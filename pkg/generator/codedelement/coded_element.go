@@ -72,6 +72,9 @@ type Generator struct {
 	// for efficient lookups.
 	mapping *CodeDescriptionMapping
 
+	// alternateCodings contains the codes in other coding systems of the coded elements, keyed by their codes.
+	alternateCodings map[string][]ir.Coding
+
 	// types contains the list of all possible types, which will be used
 	// to generated the random type in RandomType() function.
 	types []string
@@ -115,19 +118,24 @@ func (g *Generator) nullTimeOrRandom(dt *pathway.DateTime) ir.NullTime {
 func newGenerator(wrappedVals []config.MappableWeightedValue, types []string, c clock.Clock, dg DateGenerator) *Generator {
 	weightVals := make([]sample.WeightedValue, 0, len(wrappedVals))
 	mapping := NewCodeDescriptionMapping()
+	alternateCodings := map[string][]ir.Coding{}
 	for _, wv := range wrappedVals {
 		mapping.Add(wv.Mapping.Key, wv.Mapping.Value)
 		weightVals = append(weightVals, wv.WeightedVal)
+		if ce, ok := wv.WeightedVal.Value.(*ir.CodedElement); ok && ce != nil && len(ce.AlternateCodings) > 0 {
+			alternateCodings[ce.ID] = ce.AlternateCodings
+		}
 	}
 
 	return &Generator{
 		DiscreteDistribution: &sample.DiscreteDistribution{
 			WeightedValues: weightVals,
 		},
-		mapping:       mapping,
-		types:         types,
-		clock:         c,
-		dateGenerator: dg,
+		mapping:          mapping,
+		alternateCodings: alternateCodings,
+		types:            types,
+		clock:            c,
+		dateGenerator:    dg,
 	}
 }
 
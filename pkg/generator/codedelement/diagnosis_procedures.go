@@ -58,7 +58,7 @@ func (g *DiagOrProcGenerator) random(t ir.NullTime) *ir.DiagnosisOrProcedure {
 func (g *DiagOrProcGenerator) fromPathway(t ir.NullTime, p *pathway.DiagnosisOrProcedure) *ir.DiagnosisOrProcedure {
 	code, description := g.DeriveCodeAndDescription(p.Code, p.Description)
 	return &ir.DiagnosisOrProcedure{
-		Description: &ir.CodedElement{ID: code, Text: description},
+		Description: &ir.CodedElement{ID: code, Text: description, AlternateCodings: g.alternateCodings[code]},
 		Type:        p.Type,
 		DateTime:    t,
 	}
@@ -36,7 +36,7 @@ func TestDiagOrProcGenerator_Random(t *testing.T) {
 	rand.Seed(1)
 	diagnosisFilename := testwrite.BytesToFile(t, []byte(`
 A01.1,Diagnosis1,1
-A02.1,Diagnosis2,1
+A02.1,Diagnosis2,4834008^^SCT,1
 A03.1,Diagnosis3,1
 A04.1,Diagnosis4,1
 `))
@@ -87,6 +87,19 @@ P04.1,Procedure4,1
 			DateTime:    ir.NullTime{Valid: true, Time: pathwayDate},
 		},
 		wantTypes: c.Diagnosis.Types,
+	}, {
+		name: "Diagnosis from pathway with alternate codes",
+		g:    NewDiagnosisGenerator(c, data, tclock, dg),
+		input: &pathway.DiagnosisOrProcedure{
+			Type: "some-type",
+			Code: "A02.1",
+		},
+		want: &ir.DiagnosisOrProcedure{
+			Description: &ir.CodedElement{ID: "A02.1", Text: "Diagnosis2", AlternateCodings: []ir.Coding{{ID: "4834008", CodingSystem: "SCT"}}},
+			Type:        "some-type",
+			DateTime:    ir.NullTime{Valid: true, Time: pathwayDate},
+		},
+		wantTypes: c.Diagnosis.Types,
 	}, {
 		name: "Random Diagnosis",
 		g:    NewDiagnosisGenerator(c, data, tclock, dg),
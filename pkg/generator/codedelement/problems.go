@@ -0,0 +1,191 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codedelement
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/google/simhospital/pkg/clock"
+	"github.com/google/simhospital/pkg/config"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/pathway"
+)
+
+// maxComorbidityYears is the maximum number of years before the creation of a patient when their
+// comorbidities started.
+const maxComorbidityYears = 10
+
+// defaultProblemDiagnosisType is the type of diagnosis of problems if the HL7 configuration doesn't
+// set one: final.
+const defaultProblemDiagnosisType = "F"
+
+// ProblemGenerator is a generator of the problems in the problem list of patients: the comorbidities
+// of new patients, and the problems specified in pathways.
+type ProblemGenerator struct {
+	// Generator derives the codes and descriptions of problems from the comorbidities and diagnoses.
+	*Generator
+	comorbidities []config.Comorbidity
+	// abnormalResults contains the results affected by the comorbidities, keyed by their codes.
+	abnormalResults map[string]map[string]string
+	codingSystem    string
+	diagnosisType   string
+}
+
+// NewProblemGenerator creates a new generator of problems.
+func NewProblemGenerator(hc *config.HL7Config, d *config.Data, c clock.Clock) *ProblemGenerator {
+	g := newGenerator(d.Diagnoses, hc.Diagnosis.Types, c, nil)
+	abnormalResults := map[string]map[string]string{}
+	for _, cm := range d.Comorbidities {
+		g.mapping.Add(cm.Description.ID, cm.Description.Text)
+		if len(cm.Description.AlternateCodings) > 0 {
+			g.alternateCodings[cm.Description.ID] = cm.Description.AlternateCodings
+		}
+		abnormalResults[cm.Description.ID] = cm.AbnormalResults
+	}
+	diagnosisType := hc.Diagnosis.ProblemType
+	if diagnosisType == "" {
+		diagnosisType = defaultProblemDiagnosisType
+	}
+	return &ProblemGenerator{
+		Generator:       g,
+		comorbidities:   d.Comorbidities,
+		abnormalResults: abnormalResults,
+		codingSystem:    hc.Diagnosis.CodingSystem,
+		diagnosisType:   diagnosisType,
+	}
+}
+
+// Comorbidities returns a random set of comorbidities for a new patient.
+// Each comorbidity is picked independently, with the probability given by the first of its prevalences
+// that matches the sex and age of the person. Prevalences constrained by sex or age never match people
+// with unknown sex or date of birth.
+func (g *ProblemGenerator) Comorbidities(p *ir.Person) []*ir.Problem {
+	now := g.clock.Now()
+	var problems []*ir.Problem
+	for _, c := range g.comorbidities {
+		pr := prevalenceFor(c.Prevalence, p, now)
+		if pr == nil || rand.Float64()*100 >= pr.Percentage {
+			continue
+		}
+		description := *c.Description
+		problems = append(problems, &ir.Problem{
+			Description:     &description,
+			ClinicalStatus:  ir.ProblemActive,
+			Onset:           ir.NewValidTime(randomOnset(p, pr, now)),
+			AbnormalResults: c.AbnormalResults,
+			DiagnosisType:   g.diagnosisType,
+		})
+	}
+	return problems
+}
+
+func prevalenceFor(prevalence []config.Prevalence, p *ir.Person, now time.Time) *config.Prevalence {
+	for i, pr := range prevalence {
+		if pr.Gender != "" && (p == nil || p.Gender != pr.Gender) {
+			continue
+		}
+		if pr.AgeFrom == 0 && pr.AgeTo == 0 {
+			return &prevalence[i]
+		}
+		if p == nil || !p.Birth.Valid {
+			continue
+		}
+		if p.Birth.AddDate(pr.AgeFrom, 0, 0).After(now) {
+			continue
+		}
+		if pr.AgeTo != 0 && !p.Birth.AddDate(pr.AgeTo, 0, 0).After(now) {
+			continue
+		}
+		return &prevalence[i]
+	}
+	return nil
+}
+
+// randomOnset returns a random time in the last maxComorbidityYears years, but not before the person
+// reached the start of the age band of the prevalence.
+func randomOnset(p *ir.Person, pr *config.Prevalence, now time.Time) time.Time {
+	earliest := now.AddDate(-maxComorbidityYears, 0, 0)
+	if p != nil && p.Birth.Valid {
+		if start := p.Birth.AddDate(pr.AgeFrom, 0, 0); start.After(earliest) {
+			earliest = start
+		}
+	}
+	if d := now.Sub(earliest); d > 0 {
+		return earliest.Add(time.Duration(rand.Int63n(int64(d))))
+	}
+	return now
+}
+
+// UpdateFromPathway updates the given problem list with the problems from the pathway, and returns it.
+// The problems that are already in the list have their status updated. The rest of the problems are added.
+// The abatement of problems is set when they stop being active, and cleared if they become active again.
+func (g *ProblemGenerator) UpdateFromPathway(problems []*ir.Problem, fromPathway []*pathway.Problem) []*ir.Problem {
+	now := g.clock.Now()
+	for _, pp := range fromPathway {
+		code, description := g.DeriveCodeAndDescription(pp.Code, pp.Description)
+		status := pp.Status
+		if status == "" {
+			status = ir.ProblemActive
+		}
+		if existing := findProblem(problems, code, description); existing != nil {
+			setClinicalStatus(existing, status, now)
+			continue
+		}
+		p := &ir.Problem{
+			Description: &ir.CodedElement{
+				ID:               code,
+				Text:             description,
+				CodingSystem:     g.codingSystem,
+				AlternateCodings: g.alternateCodings[code],
+			},
+			Onset:           ir.NewValidTime(now),
+			AbnormalResults: g.abnormalResults[code],
+			DiagnosisType:   g.diagnosisType,
+		}
+		if pp.Onset != nil {
+			p.Onset = ir.NewInvalidTime()
+			if t := pp.Onset.GetDateTime(now); t != nil {
+				p.Onset = ir.NewValidTime(*t)
+			}
+		}
+		setClinicalStatus(p, status, now)
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+func findProblem(problems []*ir.Problem, code string, description string) *ir.Problem {
+	for _, p := range problems {
+		if code != "" && p.Description.ID == code {
+			return p
+		}
+		if code == "" && p.Description.Text == description {
+			return p
+		}
+	}
+	return nil
+}
+
+func setClinicalStatus(p *ir.Problem, status string, now time.Time) {
+	wasActive := p.ClinicalStatus == "" || p.IsActive()
+	p.ClinicalStatus = status
+	switch {
+	case p.IsActive():
+		p.Abatement = ir.NewInvalidTime()
+	case wasActive:
+		p.Abatement = ir.NewValidTime(now)
+	}
+}
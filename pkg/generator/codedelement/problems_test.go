@@ -0,0 +1,204 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codedelement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/config"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/pathway"
+	"github.com/google/simhospital/pkg/sample"
+	"github.com/google/simhospital/pkg/test/testclock"
+)
+
+var (
+	ckd = &ir.CodedElement{
+		ID:               "709044004",
+		Text:             "Chronic kidney disease",
+		CodingSystem:     "SNM3",
+		AlternateCodings: []ir.Coding{{ID: "N18.9", CodingSystem: "I10"}},
+	}
+	hypertension       = &ir.CodedElement{ID: "38341003", Text: "Hypertension", CodingSystem: "SNM3"}
+	ckdAbnormalResults = map[string]string{"Creatinine": "ABNORMAL_HIGH"}
+)
+
+func testProblemGenerator(comorbidities []config.Comorbidity) *ProblemGenerator {
+	hc := &config.HL7Config{Diagnosis: config.HL7Diagnosis{CodingSystem: "SNM3"}}
+	d := &config.Data{
+		Diagnoses: []config.MappableWeightedValue{{
+			WeightedVal: sample.WeightedValue{Value: &ir.CodedElement{ID: "A01.1", Text: "Diagnosis1"}, Frequency: 1},
+			Mapping:     config.Mapping{Key: "A01.1", Value: "Diagnosis1"},
+		}},
+		Comorbidities: comorbidities,
+	}
+	return NewProblemGenerator(hc, d, testclock.New(defaultDate))
+}
+
+func TestProblemGenerator_Comorbidities(t *testing.T) {
+	man65 := &ir.Person{Gender: "M", Birth: ir.NewValidTime(defaultDate.AddDate(-65, 0, 0))}
+	woman30 := &ir.Person{Gender: "F", Birth: ir.NewValidTime(defaultDate.AddDate(-30, 0, 0))}
+	unknown := &ir.Person{}
+
+	comorbidities := []config.Comorbidity{{
+		Description: ckd,
+		Prevalence: []config.Prevalence{
+			{Gender: "M", AgeFrom: 60, Percentage: 100},
+			{AgeFrom: 18, AgeTo: 60, Percentage: 0},
+		},
+		AbnormalResults: ckdAbnormalResults,
+	}, {
+		Description: hypertension,
+		Prevalence:  []config.Prevalence{{Percentage: 100}},
+	}}
+
+	cases := []struct {
+		name   string
+		person *ir.Person
+		want   []*ir.CodedElement
+	}{
+		{name: "matches the first prevalence", person: man65, want: []*ir.CodedElement{ckd, hypertension}},
+		{name: "matches the second prevalence", person: woman30, want: []*ir.CodedElement{hypertension}},
+		{name: "unknown sex and age", person: unknown, want: []*ir.CodedElement{hypertension}},
+		{name: "nil person", person: nil, want: []*ir.CodedElement{hypertension}},
+	}
+	g := testProblemGenerator(comorbidities)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := g.Comorbidities(tc.person)
+			var got []*ir.CodedElement
+			for _, p := range problems {
+				got = append(got, p.Description)
+				if p.ClinicalStatus != ir.ProblemActive {
+					t.Errorf("Comorbidities(%+v) problem %q got status %q, want %q", tc.person, p.Description.Text, p.ClinicalStatus, ir.ProblemActive)
+				}
+				earliest := defaultDate.AddDate(-maxComorbidityYears, 0, 0)
+				if !p.Onset.Valid || p.Onset.Before(earliest) || p.Onset.After(defaultDate) {
+					t.Errorf("Comorbidities(%+v) problem %q got onset %v, want between %v and %v", tc.person, p.Description.Text, p.Onset, earliest, defaultDate)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Comorbidities(%+v) got diff (-want +got):\n%s", tc.person, diff)
+			}
+		})
+	}
+}
+
+func TestProblemGenerator_DiagnosisType(t *testing.T) {
+	hc := &config.HL7Config{Diagnosis: config.HL7Diagnosis{CodingSystem: "SNM3", ProblemType: "W"}}
+	d := &config.Data{Comorbidities: []config.Comorbidity{{Description: hypertension, Prevalence: []config.Prevalence{{Percentage: 100}}}}}
+	g := NewProblemGenerator(hc, d, testclock.New(defaultDate))
+
+	problems := g.Comorbidities(nil)
+	problems = g.UpdateFromPathway(problems, []*pathway.Problem{{Code: "123", Description: "Other"}})
+	for _, p := range problems {
+		if got, want := p.DiagnosisType, "W"; got != want {
+			t.Errorf("problem %q got diagnosis type %q, want %q", p.Description.Text, got, want)
+		}
+	}
+}
+
+func TestProblemGenerator_ComorbiditiesOnsetAfterAgeBand(t *testing.T) {
+	g := testProblemGenerator([]config.Comorbidity{{
+		Description: ckd,
+		Prevalence:  []config.Prevalence{{AgeFrom: 60, Percentage: 100}},
+	}})
+	// The person turned 60 a year ago, so the onset must be in the last year.
+	p := &ir.Person{Birth: ir.NewValidTime(defaultDate.AddDate(-61, 0, 0))}
+	for i := 0; i < 100; i++ {
+		problems := g.Comorbidities(p)
+		if len(problems) != 1 {
+			t.Fatalf("Comorbidities(%+v) got %d problems, want 1", p, len(problems))
+		}
+		if earliest := defaultDate.AddDate(-1, 0, 0); problems[0].Onset.Before(earliest) {
+			t.Errorf("Comorbidities(%+v) got onset %v, want after %v", p, problems[0].Onset, earliest)
+		}
+	}
+}
+
+func TestProblemGenerator_UpdateFromPathway(t *testing.T) {
+	g := testProblemGenerator([]config.Comorbidity{{Description: ckd, AbnormalResults: ckdAbnormalResults}})
+	onset := ir.NewValidTime(defaultDate.AddDate(-2, 0, 0))
+	pathwayOnset := defaultDate.Add(-time.Hour)
+	existing := func() []*ir.Problem {
+		return []*ir.Problem{{Description: hypertension, ClinicalStatus: ir.ProblemActive, Onset: onset}}
+	}
+
+	cases := []struct {
+		name        string
+		problems    []*ir.Problem
+		fromPathway []*pathway.Problem
+		want        []*ir.Problem
+	}{{
+		name:        "add a comorbidity from the description",
+		problems:    existing(),
+		fromPathway: []*pathway.Problem{{Description: "Chronic kidney disease"}},
+		want: []*ir.Problem{
+			{Description: hypertension, ClinicalStatus: ir.ProblemActive, Onset: onset},
+			{Description: ckd, ClinicalStatus: ir.ProblemActive, Onset: ir.NewValidTime(defaultDate), AbnormalResults: ckdAbnormalResults, DiagnosisType: "F"},
+		},
+	}, {
+		name:        "add a diagnosis with an onset",
+		fromPathway: []*pathway.Problem{{Code: "A01.1", Onset: &pathway.DateTime{Time: &pathwayOnset}}},
+		want: []*ir.Problem{
+			{Description: &ir.CodedElement{ID: "A01.1", Text: "Diagnosis1", CodingSystem: "SNM3"}, ClinicalStatus: ir.ProblemActive, Onset: ir.NewValidTime(pathwayOnset), DiagnosisType: "F"},
+		},
+	}, {
+		name:        "add a resolved problem",
+		fromPathway: []*pathway.Problem{{Code: "123", Description: "Other", Status: ir.ProblemResolved}},
+		want: []*ir.Problem{{
+			Description:    &ir.CodedElement{ID: "123", Text: "Other", CodingSystem: "SNM3"},
+			ClinicalStatus: ir.ProblemResolved,
+			Onset:          ir.NewValidTime(defaultDate),
+			Abatement:      ir.NewValidTime(defaultDate),
+			DiagnosisType:  "F",
+		}},
+	}, {
+		name:        "resolve an existing problem",
+		problems:    existing(),
+		fromPathway: []*pathway.Problem{{Code: "38341003", Status: ir.ProblemResolved}},
+		want: []*ir.Problem{
+			{Description: hypertension, ClinicalStatus: ir.ProblemResolved, Onset: onset, Abatement: ir.NewValidTime(defaultDate)},
+		},
+	}, {
+		name: "inactive problem keeps its abatement",
+		problems: []*ir.Problem{
+			{Description: hypertension, ClinicalStatus: ir.ProblemInactive, Onset: onset, Abatement: onset},
+		},
+		fromPathway: []*pathway.Problem{{Code: "38341003", Status: ir.ProblemResolved}},
+		want: []*ir.Problem{
+			{Description: hypertension, ClinicalStatus: ir.ProblemResolved, Onset: onset, Abatement: onset},
+		},
+	}, {
+		name: "problem comes back",
+		problems: []*ir.Problem{
+			{Description: hypertension, ClinicalStatus: ir.ProblemRemission, Onset: onset, Abatement: onset},
+		},
+		fromPathway: []*pathway.Problem{{Description: "Hypertension", Status: ir.ProblemRelapse}},
+		want: []*ir.Problem{
+			{Description: hypertension, ClinicalStatus: ir.ProblemRelapse, Onset: onset},
+		},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := g.UpdateFromPathway(tc.problems, tc.fromPathway)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("UpdateFromPathway(%v, %v) got diff (-want +got):\n%s", tc.problems, tc.fromPathway, diff)
+			}
+		})
+	}
+}
@@ -65,6 +65,7 @@ type Generator struct {
 	personGenerator       *person.Generator
 	patientClassGenerator patientClassGenerator
 	allergyGenerator      *codedelement.AllergyGenerator
+	problemGenerator      *codedelement.ProblemGenerator
 	diagnosisGenerator    diagnosisOrProcedureGenerator
 	procedureGenerator    diagnosisOrProcedureGenerator
 	messageConfig         *config.HL7Config
@@ -96,9 +97,13 @@ func (g Generator) UpdateFromPathway(patientInfo *ir.PatientInfo, updatePerson *
 	g.setDiagnoses(patientInfo, updatePerson.Diagnoses)
 	g.setProcedures(patientInfo, updatePerson.Procedures)
 	g.AddAllergies(patientInfo, updatePerson.Allergies)
+	if len(updatePerson.Problems) > 0 {
+		patientInfo.Problems = g.problemGenerator.UpdateFromPathway(patientInfo.Problems, updatePerson.Problems)
+	}
 }
 
 // NewPatient returns a new patient based on Person information and a doctor provided.
+// The patient has a random set of comorbidities based on their sex and age.
 func (g Generator) NewPatient(person *ir.Person, doctor *ir.Doctor) *state.Patient {
 	p := &state.Patient{
 		PatientInfo: &ir.PatientInfo{
@@ -107,6 +112,7 @@ func (g Generator) NewPatient(person *ir.Person, doctor *ir.Doctor) *state.Patie
 			// The Hospital Service might be overridden later with the doctor's specialty.
 			HospitalService: g.messageConfig.HospitalService,
 			AttendingDoctor: doctor,
+			Problems:        g.problemGenerator.Comorbidities(person),
 		},
 		// The code downstream assumes that Orders exists.
 		Orders:    make(map[string]*ir.Order),
@@ -164,6 +170,9 @@ func (g Generator) ResetPatient(p *state.Patient) *state.Patient {
 	newP.PastVisits = p.PastVisits
 	newP.PatientInfo.PrimaryFacility = p.PatientInfo.PrimaryFacility
 	newP.PatientInfo.Allergies = p.PatientInfo.Allergies
+	newP.PatientInfo.LabTrajectories = p.PatientInfo.LabTrajectories
+	newP.PatientInfo.VitalSigns = p.PatientInfo.VitalSigns
+	newP.PatientInfo.Problems = p.PatientInfo.Problems
 	return newP
 }
 
@@ -200,9 +209,9 @@ func (g Generator) AddAllergies(patientInfo *ir.PatientInfo, allergies []pathway
 // the list, as there is no way of deleting / amending existing pathwayAllergies.
 func (g Generator) getDedupedAllergiesFromPathway(patientInfo *ir.PatientInfo, pathwayAllergies []pathway.Allergy) []*ir.Allergy {
 	var dedupedAllergies []*ir.Allergy
-	existing := make(map[ir.Allergy]bool)
+	existing := make(map[allergyKey]bool)
 	for _, a := range patientInfo.Allergies {
-		existing[*a] = true
+		existing[keyForAllergy(a)] = true
 	}
 
 	for _, a := range pathwayAllergies {
@@ -220,14 +229,40 @@ func (g Generator) getDedupedAllergiesFromPathway(patientInfo *ir.PatientInfo, p
 			Reaction:               a.Reaction,
 			IdentificationDateTime: idt,
 		}
-		if !existing[*allergy] {
-			existing[*allergy] = true
+		if k := keyForAllergy(allergy); !existing[k] {
+			existing[k] = true
 			dedupedAllergies = append(dedupedAllergies, allergy)
 		}
 	}
 	return dedupedAllergies
 }
 
+// allergyKey identifies an allergy for de-duplication purposes.
+// Alternate codings are not taken into account, as allergies don't have them.
+type allergyKey struct {
+	allergyType            string
+	id                     string
+	text                   string
+	codingSystem           string
+	alternateText          string
+	severity               string
+	reaction               string
+	identificationDateTime ir.NullTime
+}
+
+func keyForAllergy(a *ir.Allergy) allergyKey {
+	return allergyKey{
+		allergyType:            a.Type,
+		id:                     a.Description.ID,
+		text:                   a.Description.Text,
+		codingSystem:           a.Description.CodingSystem,
+		alternateText:          a.Description.AlternateText,
+		severity:               a.Severity,
+		reaction:               a.Reaction,
+		identificationDateTime: a.IdentificationDateTime,
+	}
+}
+
 func (g Generator) setDiagnoses(patientInfo *ir.PatientInfo, diagnoses []*pathway.DiagnosisOrProcedure) {
 	patientInfo.Diagnoses = make([]*ir.DiagnosisOrProcedure, len(diagnoses))
 	g.setDiagnosesOrProcedures(patientInfo.Diagnoses, diagnoses, g.diagnosisGenerator)
@@ -265,9 +300,16 @@ func (g Generator) OrderWithClinicalNote(ctx context.Context, o *ir.Order, n *pa
 
 // SetResults sets results on an existing Order based on the results information from the pathway.
 // If order is nil, this also creates an Order using details in pathway.Result.
+// The patientInfo keeps the trajectories followed by the results, if any.
 // Returns an error of the retults cannot be created.
-func (g Generator) SetResults(o *ir.Order, r *pathway.Results, eventTime time.Time) (*ir.Order, error) {
-	return g.orderGenerator.SetResults(o, r, eventTime)
+func (g Generator) SetResults(patientInfo *ir.PatientInfo, o *ir.Order, r *pathway.Results, eventTime time.Time) (*ir.Order, error) {
+	return g.orderGenerator.SetResults(patientInfo, o, r, eventTime)
+}
+
+// VitalSigns creates an order with a set of vital signs observations based on the pathway.
+// The patientInfo keeps the acuity of the patient over time.
+func (g Generator) VitalSigns(patientInfo *ir.PatientInfo, v *pathway.Vitals, eventTime time.Time) *ir.Order {
+	return g.orderGenerator.VitalSigns(patientInfo, v, eventTime)
 }
 
 // NewVisitID generates a new visit identifier.
@@ -373,6 +415,7 @@ func NewGenerator(cfg Config) *Generator {
 		allergyGenerator:      codedelement.NewAllergyGenerator(cfg.HL7Config, cfg.Data, cfg.Clock, dg),
 		diagnosisGenerator:    codedelement.NewDiagnosisGenerator(cfg.HL7Config, cfg.Data, cfg.Clock, dg),
 		procedureGenerator:    codedelement.NewProcedureGenerator(cfg.HL7Config, cfg.Data, cfg.Clock, dg),
+		problemGenerator:      codedelement.NewProblemGenerator(cfg.HL7Config, cfg.Data, cfg.Clock),
 		headerGenerator:       &header.Generator{Header: cfg.Header, MsgCtrlGen: cfg.MsgCtrlGenerator},
 		orderGenerator:        orderGenerator,
 		documentGenerator:     &document.Generator{DocumentConfig: &cfg.HL7Config.Document, TextGenerator: tg},
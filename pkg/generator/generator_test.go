@@ -753,6 +753,43 @@ hospital_service: "180"
 	}
 }
 
+func TestNewPatientComorbidities(t *testing.T) {
+	ctx := context.Background()
+	hl7Config, err := config.LoadHL7Config(ctx, test.MessageConfigTest)
+	if err != nil {
+		t.Fatalf("LoadHL7Config(%s) failed with %v", test.MessageConfigTest, err)
+	}
+	f := test.DataFiles[test.Test]
+	data, err := config.LoadData(ctx, f, hl7Config)
+	if err != nil {
+		t.Fatalf("LoadData(%+v, %+v) failed with %v", f, hl7Config, err)
+	}
+	hypertension := &ir.CodedElement{ID: "38341003", Text: "Hypertension", CodingSystem: hl7Config.Diagnosis.CodingSystem}
+	data.Comorbidities = []config.Comorbidity{{
+		Description: hypertension,
+		Prevalence:  []config.Prevalence{{Percentage: 100}},
+	}}
+	g := testGenerator(ctx, t, Config{HL7Config: hl7Config, Data: data})
+
+	p := g.NewPatient(testperson.New(), nil)
+	var got []*ir.CodedElement
+	for _, pr := range p.PatientInfo.Problems {
+		got = append(got, pr.Description)
+	}
+	if diff := cmp.Diff([]*ir.CodedElement{hypertension}, got); diff != "" {
+		t.Errorf("NewPatient().PatientInfo.Problems got diff (-want +got):\n%s", diff)
+	}
+
+	// The problem list is kept when the patient is updated, and the problems in the pathway update it.
+	g.UpdateFromPathway(p.PatientInfo, &pathway.UpdatePerson{Problems: []*pathway.Problem{{Code: "38341003", Status: ir.ProblemResolved}}})
+	if len(p.PatientInfo.Problems) != 1 {
+		t.Fatalf("UpdateFromPathway() got %d problems, want 1", len(p.PatientInfo.Problems))
+	}
+	if got, want := p.PatientInfo.Problems[0].ClinicalStatus, ir.ProblemResolved; got != want {
+		t.Errorf("UpdateFromPathway() problem status got %q, want %q", got, want)
+	}
+}
+
 func TestNewDoctor(t *testing.T) {
 	ctx := context.Background()
 	hl7Name := testwrite.BytesToFile(t, []byte(`
@@ -1150,7 +1187,7 @@ func TestSetResults(t *testing.T) {
 
 	order := urineOrder(eventTime, hl7Config)
 
-	got, err := g.SetResults(order, pathwayR, eventTime)
+	got, err := g.SetResults(nil, order, pathwayR, eventTime)
 	if err != nil {
 		t.Fatalf("SetResults(%v, %v, %v) failed with %v", order, pathwayR, eventTime, err)
 	}
@@ -1275,6 +1312,7 @@ func TestGeneratorResetPatientInfo(t *testing.T) {
 			VisitID:   2,
 			Location:  &ir.PatientLocation{Poc: "Poc-1", Room: "room-1", Bed: "bed-1"},
 			Allergies: []*ir.Allergy{{Type: "food"}},
+			Problems:  []*ir.Problem{{Description: &ir.CodedElement{ID: "38341003", Text: "Hypertension"}, ClinicalStatus: ir.ProblemActive}},
 			Encounters: []*ir.Encounter{
 				{
 					Status:      constants.EncounterStatusArrived,
@@ -1305,6 +1343,7 @@ func TestGeneratorResetPatientInfo(t *testing.T) {
 			HospitalService: doctor.Specialty,
 			AttendingDoctor: doctor,
 			Allergies:       []*ir.Allergy{{Type: "food"}},
+			Problems:        []*ir.Problem{{Description: &ir.CodedElement{ID: "38341003", Text: "Hypertension"}, ClinicalStatus: ir.ProblemActive}},
 			PrimaryFacility: &ir.PrimaryFacility{
 				Organization: "Test Primary Facility",
 				ID:           "123",
@@ -32,7 +32,7 @@ type Generator struct {
 // The step must be non-nil.
 func (g *Generator) NewHeader(step *pathway.Step) *message.HeaderInfo {
 	header := g.Header.Default
-	if step.StepType() == pathway.StepResults && g.Header.ORU != nil {
+	if t := step.StepType(); (t == pathway.StepResults || t == pathway.StepVitals) && g.Header.ORU != nil {
 		header = *g.Header.ORU
 	}
 	h := &message.HeaderInfo{
@@ -41,6 +41,7 @@ func (g *Generator) NewHeader(step *pathway.Step) *message.HeaderInfo {
 		SendingFacility:      header.SendingFacility,
 		SendingApplication:   header.SendingApplication,
 		MessageControlID:     g.MsgCtrlGen.NewMessageControlID(),
+		CharacterSet:         g.Header.CharacterSet,
 	}
 	params := step.Parameters
 	if params == nil {
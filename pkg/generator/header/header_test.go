@@ -115,6 +115,16 @@ oru:
 			ReceivingFacility:    "oru_rf",
 			MessageControlID:     "1",
 		},
+	}, {
+		name: "Vitals with no overrides",
+		step: &pathway.Step{Vitals: &pathway.Vitals{}},
+		want: &message.HeaderInfo{
+			SendingApplication:   "oru_sa",
+			SendingFacility:      "oru_sf",
+			ReceivingApplication: "oru_ra",
+			ReceivingFacility:    "oru_rf",
+			MessageControlID:     "1",
+		},
 	}, {
 		name: "Non ORU overrides Sending Facility",
 		step: &pathway.Step{
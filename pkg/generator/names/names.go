@@ -25,6 +25,28 @@ import (
 // Generator is a generator of names.
 type Generator struct {
 	Data *config.Data
+	// locale is the locale of the first names, middle names and surnames, or nil if they come from
+	// the census data.
+	locale *config.NameLocale
+}
+
+// WithRandomLocale returns a generator of names from a random locale in Data.PatientName.Locales,
+// picked according to the locales' percentages, or from the census data if no locale is picked.
+// Use the same generator for all the names of a person, so that they are from the same locale.
+func (g Generator) WithRandomLocale() *Generator {
+	g.locale = nil
+	if len(g.Data.PatientName.Locales) == 0 {
+		return &g
+	}
+	n := rand.Intn(100)
+	for i, l := range g.Data.PatientName.Locales {
+		if n < l.Percentage {
+			g.locale = &g.Data.PatientName.Locales[i]
+			break
+		}
+		n -= l.Percentage
+	}
+	return &g
 }
 
 // Prefix returns a random prefix based on the given gender.
@@ -41,6 +63,9 @@ func (g Generator) Prefix(gen gender.Internal) string {
 
 // FirstName returns a random first name based on the given gender and the year the person was born.
 func (g Generator) FirstName(gen gender.Internal, year int) string {
+	if g.locale != nil {
+		return g.localeFirstName(gen)
+	}
 	switch gen {
 	case gender.Male:
 		return randomByYear(g.Data.FirstNames.Boys, year)
@@ -54,6 +79,9 @@ func (g Generator) FirstName(gen gender.Internal, year int) string {
 // MiddleName returns a random middle name based on the given gender.
 func (g Generator) MiddleName(gen gender.Internal) string {
 	if rand.Intn(100) < g.Data.PatientName.MiddlenamePercentage {
+		if g.locale != nil {
+			return g.localeFirstName(gen)
+		}
 		switch gen {
 		case gender.Male:
 			return randomName(g.Data.FirstNames.Boys)
@@ -76,9 +104,25 @@ func (g Generator) Degree() string {
 
 // Surname returns a random surname.
 func (g Generator) Surname() string {
+	if g.locale != nil {
+		return random(g.locale.Surnames)
+	}
 	return random(g.Data.Surnames)
 }
 
+// localeFirstName returns a random first name from the generator's locale based on the given gender.
+// If the gender is neither male nor female, the name is picked from both the female and male names.
+func (g Generator) localeFirstName(gen gender.Internal) string {
+	switch gen {
+	case gender.Male:
+		return random(g.locale.MaleFirstNames)
+	case gender.Female:
+		return random(g.locale.FemaleFirstNames)
+	default:
+		return random(append(append([]string{}, g.locale.FemaleFirstNames...), g.locale.MaleFirstNames...))
+	}
+}
+
 // randomWithProb returns a random item from the slice with the probability p/100, where p is an int between [0, 100),
 // or an empty string otherwise.
 func randomWithProb(s []string, p int) string {
@@ -300,3 +300,68 @@ func contains(str string, strs []string) bool {
 	}
 	return false
 }
+
+func TestWithRandomLocale(t *testing.T) {
+	data := &config.Data{
+		PatientName: config.PatientName{
+			MiddlenamePercentage: 100,
+			Locales: []config.NameLocale{{
+				Name:             "es",
+				Percentage:       30,
+				FemaleFirstNames: []string{"María", "Lucía"},
+				MaleFirstNames:   []string{"José", "Íñigo"},
+				Surnames:         []string{"Núñez", "Peña"},
+			}, {
+				Name:             "el",
+				Percentage:       20,
+				FemaleFirstNames: []string{"Ελένη"},
+				MaleFirstNames:   []string{"Γιώργος"},
+				Surnames:         []string{"Παπαδόπουλος"},
+			}},
+		},
+		FirstNames: &config.FirstNamesByCensus{
+			Girls: &config.Names{All: []string{"Mary"}, ByYear: map[int][]string{2000: {"Mary"}}, MinYear: 2000, MaxYear: 2000},
+			Boys:  &config.Names{All: []string{"John"}, ByYear: map[int][]string{2000: {"John"}}, MinYear: 2000, MaxYear: 2000},
+		},
+		Surnames: []string{"Smith"},
+	}
+	localeOf := map[string]string{
+		"María": "es", "Lucía": "es", "José": "es", "Íñigo": "es", "Núñez": "es", "Peña": "es",
+		"Ελένη": "el", "Γιώργος": "el", "Παπαδόπουλος": "el",
+		"Mary": "census", "John": "census", "Smith": "census",
+	}
+
+	runs := 1000
+	got := map[string]int{}
+	for i := 0; i < runs; i++ {
+		g := Generator{Data: data}.WithRandomLocale()
+		for _, gen := range []gender.Internal{gender.Male, gender.Female} {
+			names := []string{g.FirstName(gen, 2000), g.MiddleName(gen), g.Surname()}
+			locale := localeOf[names[0]]
+			for _, n := range names[1:] {
+				if localeOf[n] != locale {
+					t.Fatalf("WithRandomLocale() generated names %v from different locales, want the same locale", names)
+				}
+			}
+			got[locale]++
+		}
+	}
+
+	// People of unknown gender get first names of any gender from their locale.
+	for i := 0; i < runs; i++ {
+		g := Generator{Data: data}.WithRandomLocale()
+		if g.locale == nil {
+			continue
+		}
+		if name := g.FirstName(gender.Unknown, 2000); localeOf[name] != g.locale.Name {
+			t.Fatalf("FirstName(%v) got %q, want a name from locale %q", gender.Unknown, name, g.locale.Name)
+		}
+	}
+
+	for locale, wantPercentage := range map[string]int{"es": 30, "el": 20, "census": 50} {
+		want := float64(2*runs*wantPercentage) / 100
+		if delta := want / 5; math.Abs(float64(got[locale])-want) > delta {
+			t.Errorf("got %d names from locale %q, want within %v of %v", got[locale], locale, delta, want)
+		}
+	}
+}
@@ -115,7 +115,13 @@ func (g Generator) OrderWithClinicalNote(ctx context.Context, order *ir.Order, n
 // If the Order already has the Results, they are replaced with Results from the pathway as the corrected results,
 // unless another status is explicitly specified in the pathway.
 // In the case of correction, only results specified in the pathway are included.
-func (g Generator) SetResults(o *ir.Order, r *pathway.Results, eventTime time.Time) (*ir.Order, error) {
+//
+// The patientInfo keeps the trajectories that the results follow over time, if any.
+// If patientInfo is nil, the results are generated as if for a new patient.
+func (g Generator) SetResults(patientInfo *ir.PatientInfo, o *ir.Order, r *pathway.Results, eventTime time.Time) (*ir.Order, error) {
+	if patientInfo == nil {
+		patientInfo = &ir.PatientInfo{}
+	}
 	if o == nil {
 		o = g.NewOrder(&pathway.Order{OrderProfile: r.OrderProfile}, eventTime)
 	}
@@ -127,7 +133,7 @@ func (g Generator) SetResults(o *ir.Order, r *pathway.Results, eventTime time.Ti
 	if err := g.setOrderDates(o, r, eventTime); err != nil {
 		return nil, errors.Wrap(err, "cannot set dates on the order")
 	}
-	if err := g.setOrderResults(o, r); err != nil {
+	if err := g.setOrderResults(patientInfo, o, r); err != nil {
 		return nil, errors.Wrap(err, "cannot set results on the order")
 	}
 
@@ -209,24 +215,39 @@ func (g Generator) setOrderDates(o *ir.Order, r *pathway.Results, eventTime time
 // If the results are defined for an existing Order Profile, then:
 //   - if the results are explicitly specified in the pathway, only those are included,
 //   - if the results are not specified explicitly, then random result from the normal range
-//     is included for each test type specified in the Order Profile.
+//     is included for each test type specified in the Order Profile, or from the abnormal range
+//     if the test type is affected by any of the patient's active problems.
 //
 // Otherwise, if the results are defined for non-existing order profile, then
 // only results specified explicitly are included.
-func (g Generator) setOrderResults(o *ir.Order, r *pathway.Results) error {
+//
+// Results that follow a trajectory get their values from the patient's trajectories, which are
+// started or updated first so that results that track other tests can use them.
+func (g Generator) setOrderResults(patientInfo *ir.PatientInfo, o *ir.Order, r *pathway.Results) error {
 	o.Results = make([]*ir.Result, 0)
 	opName := o.OrderProfile.Text
 	op, ok := g.OrderProfiles.Get(opName)
+	if ok {
+		if err := startTrajectories(patientInfo, op, r.Results, resultsTime(o)); err != nil {
+			return errors.Wrap(err, "cannot start trajectories")
+		}
+	}
 
 	switch {
 	case ok && len(r.Results) == 0:
 		// Include a result for each test type specified in the order profile.
+		// The results affected by the patient's active problems are abnormal.
+		abnormal := abnormalResults(patientInfo.Problems)
 		for _, tt := range op.TestTypes {
+			value := constants.NormalValue
+			if v, ok := abnormal[tt.Name.Text]; ok {
+				value = v
+			}
 			placeholder := &pathway.Result{
 				TestName: tt.Name.Text,
-				Value:    constants.NormalValue,
+				Value:    value,
 			}
-			tr, err := g.testResult(op, placeholder, o.ResultsStatus, o.CollectedDateTime)
+			tr, err := g.testResult(patientInfo, op, placeholder, o)
 			if err != nil {
 				return errors.Wrap(err, "cannot generate test result")
 			}
@@ -241,7 +262,7 @@ func (g Generator) setOrderResults(o *ir.Order, r *pathway.Results) error {
 		// If Results are explicitly specified in the pathway, only include those.
 		// Note, that for corrections we currently only include corrected values.
 		for _, result := range r.Results {
-			tr, err := g.testResult(op, result, o.ResultsStatus, o.CollectedDateTime)
+			tr, err := g.testResult(patientInfo, op, result, o)
 			if err != nil {
 				return errors.Wrap(err, "cannot generate test result")
 			}
@@ -251,6 +272,23 @@ func (g Generator) setOrderResults(o *ir.Order, r *pathway.Results) error {
 	return nil
 }
 
+// abnormalResults returns the abnormal values of the test types affected by the given problems while
+// they are active, keyed by test name. If several problems affect the same test type, the first one wins.
+func abnormalResults(problems []*ir.Problem) map[string]string {
+	abnormal := make(map[string]string)
+	for _, p := range problems {
+		if !p.IsActive() {
+			continue
+		}
+		for testName, v := range p.AbnormalResults {
+			if _, ok := abnormal[testName]; !ok {
+				abnormal[testName] = v
+			}
+		}
+	}
+	return abnormal
+}
+
 func overriddenDate(fromPathway string, t ir.NullTime) (ir.NullTime, error) {
 	switch fromPathway {
 	case constants.EmptyString:
@@ -263,18 +301,27 @@ func overriddenDate(fromPathway string, t ir.NullTime) (ir.NullTime, error) {
 	}
 }
 
+// resultsTime returns the time the results of the given order refer to:
+// the time when the sample was collected, or the time when the results were reported if the former is not set.
+func resultsTime(o *ir.Order) time.Time {
+	if o.CollectedDateTime.Valid {
+		return o.CollectedDateTime.Time
+	}
+	return o.ReportedDateTime.Time
+}
+
 // testResult generates the Result from the default values in the Test Type,
 // overridden by values specified in the pathway, if provided.
 // If the Test Type is not provided, creates the Result from values specified in the pathway.
-func (g Generator) testResult(op *orderprofile.OrderProfile, pathwayResult *pathway.Result, orderResultsStatus string, orderCollectedDateTime ir.NullTime) (*ir.Result, error) {
+func (g Generator) testResult(patientInfo *ir.PatientInfo, op *orderprofile.OrderProfile, pathwayResult *pathway.Result, o *ir.Order) (*ir.Result, error) {
 	obsDateTime := ir.NewInvalidTime()
-	if orderCollectedDateTime.Valid {
-		obsDateTime = ir.NewValidTime(orderCollectedDateTime.Add(pathwayResult.ObservationDateTimeOffset))
+	if o.CollectedDateTime.Valid {
+		obsDateTime = ir.NewValidTime(o.CollectedDateTime.Add(pathwayResult.ObservationDateTimeOffset))
 	}
 
 	// Init default Result values.
 	result := &ir.Result{
-		Status:              orderResultsStatus,
+		Status:              o.ResultsStatus,
 		ObservationDateTime: obsDateTime,
 	}
 
@@ -300,6 +347,9 @@ func (g Generator) testResult(op *orderprofile.OrderProfile, pathwayResult *path
 		// This shouldn't happen if the pathway has been validated.
 		return nil, fmt.Errorf("Test name %q not found in order profile", pathwayResult.TestName)
 	}
+	// Use the reference range for the patient's sex and age at the time of the results.
+	at := resultsTime(o).Add(pathwayResult.ObservationDateTimeOffset)
+	tt = tt.ForPerson(patientInfo.Person, at)
 	// Set defaults for Test Type.
 	result.TestName = &tt.Name
 	result.ValueType = tt.ValueType
@@ -308,7 +358,7 @@ func (g Generator) testResult(op *orderprofile.OrderProfile, pathwayResult *path
 		result.TestName.ID = pathwayResult.ID
 	}
 
-	if err := g.setTestResultValue(result, pathwayResult, tt); err != nil {
+	if err := g.setTestResultValue(patientInfo, result, pathwayResult, tt, at); err != nil {
 		return nil, errors.Wrap(err, "cannot set the value on the result")
 	}
 	return result, nil
@@ -350,9 +400,14 @@ func (g Generator) updateResultForCustomOrderProfile(result *ir.Result, pathwayR
 // If the value of the results is set to random but the reference range is not
 // specified in the pathway, then the value is generated based on that reference range
 // specified in the TestType.
+// If the result follows a trajectory, the value is derived from the patient's trajectory at the given time.
 // Otherwise, if the value is explicitly set in the pathway, it is being used.
-func (g Generator) setTestResultValue(result *ir.Result, pathwayResult *pathway.Result, tt *orderprofile.TestType) error {
+func (g Generator) setTestResultValue(patientInfo *ir.PatientInfo, result *ir.Result, pathwayResult *pathway.Result, tt *orderprofile.TestType, at time.Time) error {
 	switch {
+	case pathwayResult.Trajectory != nil || pathwayResult.Tracks != nil:
+		// Derive the value from the trajectory.
+		return g.setValueFromTrajectory(patientInfo, result, pathwayResult, tt, at)
+
 	case pathwayResult.IsValueRandom() && pathwayResult.ReferenceRange != "":
 		// Generate random value from the custom reference range.
 		return g.setRandomValueBasedOnCustomReferenceRange(result, pathwayResult)
@@ -406,7 +406,7 @@ func TestSetResultsOverrideDates(t *testing.T) {
 					},
 				},
 			}
-			got, err := g.SetResults(tc.order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, tc.order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", tc.order, tc.pathwayR, eventTime, err)
 			}
@@ -463,7 +463,7 @@ func TestSetResultsDifferentDates(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			order := ureaOrder(orderTime, hl7Config)
 
-			got, err := g.SetResults(order, tc.pathwayR, reportTime)
+			got, err := g.SetResults(nil, order, tc.pathwayR, reportTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", order, tc.pathwayR, reportTime, err)
 			}
@@ -593,7 +593,7 @@ func TestSetResultsOverrideStatus(t *testing.T) {
 				},
 			}
 			order := ureaOrder(eventTime, hl7Config)
-			got, err := g.SetResults(order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", order, tc.pathwayR, eventTime, err)
 			}
@@ -704,7 +704,7 @@ func TestSetResultsAbnormalFlag(t *testing.T) {
 				},
 			}
 			order := ureaOrder(eventTime, hl7Config)
-			got, err := g.SetResults(order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", order, tc.pathwayR, eventTime, err)
 			}
@@ -715,6 +715,107 @@ func TestSetResultsAbnormalFlag(t *testing.T) {
 	}
 }
 
+func TestSetResultsReferenceRangeForPerson(t *testing.T) {
+	b := []byte(`
+UREA AND ELECTROLYTES:
+  universal_service_id: lpdc-3969
+  test_types:
+    Creatinine:
+      id: lpdc-2012
+      value_type: NM
+      value: 51
+      unit: UMOLL
+      ref_range: 49 - 92
+      ref_ranges:
+        - age_to: 1y
+          ref_range: 14 - 34`)
+	op := testwrite.BytesToFile(t, b)
+	ctx := context.Background()
+	g, hl7Config := testGeneratorWithOrderProfile(ctx, t, op)
+
+	baby := &ir.PatientInfo{Person: &ir.Person{Gender: "F", Birth: ir.NewValidTime(eventTime.AddDate(0, -3, 0))}}
+	adult := &ir.PatientInfo{Person: &ir.Person{Gender: "F", Birth: ir.NewValidTime(eventTime.AddDate(-40, 0, 0))}}
+	r := &pathway.Results{
+		OrderProfile: "UREA AND ELECTROLYTES",
+		Results: []*pathway.Result{{
+			TestName:     "Creatinine",
+			Value:        "40",
+			Unit:         "UMOLL",
+			AbnormalFlag: constants.AbnormalFlagDefault,
+		}},
+	}
+
+	cases := []struct {
+		name             string
+		patientInfo      *ir.PatientInfo
+		wantRange        string
+		wantAbnormalFlag string
+	}{
+		{name: "no patient info", patientInfo: nil, wantRange: "49 - 92", wantAbnormalFlag: hl7Config.AbnormalFlags.BelowLowNormal},
+		{name: "adult", patientInfo: adult, wantRange: "49 - 92", wantAbnormalFlag: hl7Config.AbnormalFlags.BelowLowNormal},
+		{name: "baby", patientInfo: baby, wantRange: "14 - 34", wantAbnormalFlag: hl7Config.AbnormalFlags.AboveHighNormal},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := g.SetResults(tc.patientInfo, ureaOrder(eventTime, hl7Config), r, eventTime)
+			if err != nil {
+				t.Fatalf("SetResults(%+v, %+v) failed with %v", tc.patientInfo, r, err)
+			}
+			if len(got.Results) != 1 {
+				t.Fatalf("SetResults(%+v, %+v) got %d results, want 1", tc.patientInfo, r, len(got.Results))
+			}
+			if got, want := got.Results[0].Range, tc.wantRange; got != want {
+				t.Errorf("SetResults(%+v, %+v) Range got %q, want %q", tc.patientInfo, r, got, want)
+			}
+			if got, want := got.Results[0].AbnormalFlag, tc.wantAbnormalFlag; got != want {
+				t.Errorf("SetResults(%+v, %+v) AbnormalFlag got %q, want %q", tc.patientInfo, r, got, want)
+			}
+		})
+	}
+}
+
+func TestSetResultsAbnormalForActiveProblems(t *testing.T) {
+	op := testwrite.BytesToFile(t, trajectoryOrderProfile)
+	ctx := context.Background()
+	g, hl7Config := testGeneratorWithOrderProfile(ctx, t, op)
+	r := &pathway.Results{OrderProfile: "UREA AND ELECTROLYTES"}
+	ckd := func(status string) *ir.Problem {
+		return &ir.Problem{
+			Description:     &ir.CodedElement{ID: "709044004", Text: "Chronic kidney disease"},
+			ClinicalStatus:  status,
+			AbnormalResults: map[string]string{"Creatinine": constants.AbnormalHigh},
+		}
+	}
+
+	cases := []struct {
+		name           string
+		problems       []*ir.Problem
+		wantCreatinine string
+	}{
+		{name: "no problems", wantCreatinine: ""},
+		{name: "active problem", problems: []*ir.Problem{ckd(ir.ProblemActive)}, wantCreatinine: hl7Config.AbnormalFlags.AboveHighNormal},
+		{name: "relapse", problems: []*ir.Problem{ckd(ir.ProblemRelapse)}, wantCreatinine: hl7Config.AbnormalFlags.AboveHighNormal},
+		{name: "resolved problem", problems: []*ir.Problem{ckd(ir.ProblemResolved)}, wantCreatinine: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			patientInfo := &ir.PatientInfo{Problems: tc.problems}
+			got, err := g.SetResults(patientInfo, ureaOrder(eventTime, hl7Config), r, eventTime)
+			if err != nil {
+				t.Fatalf("SetResults(%+v, %+v) failed with %v", patientInfo, r, err)
+			}
+			flags := map[string]string{}
+			for _, res := range got.Results {
+				flags[res.TestName.Text] = res.AbnormalFlag
+			}
+			want := map[string]string{"Creatinine": tc.wantCreatinine, "Urea": ""}
+			if diff := cmp.Diff(want, flags); diff != "" {
+				t.Errorf("SetResults(%+v, %+v) abnormal flags got diff (-want +got):\n%s", patientInfo, r, diff)
+			}
+		})
+	}
+}
+
 func TestSetResultsSetValueType(t *testing.T) {
 	ctx := context.Background()
 	g, hl7Config := testGeneratorWithOrderProfile(ctx, t, test.ComplexOrderProfilesConfigTest)
@@ -835,7 +936,7 @@ func TestSetResultsSetValueType(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := g.SetResults(tc.order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, tc.order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", tc.order, tc.pathwayR, eventTime, err)
 			}
@@ -969,7 +1070,7 @@ func TestSetResultsRandomValue(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			var order *ir.Order
 
-			got, err := g.SetResults(order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", order, tc.pathwayR, eventTime, err)
 			}
@@ -1051,7 +1152,7 @@ func TestSetResultsWithCompexOrderProfiles(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := g.SetResults(tc.order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, tc.order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", tc.order, tc.pathwayR, eventTime, err)
 			}
@@ -1226,7 +1327,7 @@ func TestSetResultsUnknownTestTypeOrOrderProfile(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			o, err := g.SetResults(tc.order, tc.pathwayR, eventTime)
+			o, err := g.SetResults(nil, tc.order, tc.pathwayR, eventTime)
 			gotErr := err != nil
 			if gotErr != tc.wantErr {
 				t.Errorf("SetResults(%v, %v, %v) got error %v, want error? %t", tc.order, tc.pathwayR, eventTime, err, tc.wantErr)
@@ -1381,7 +1482,7 @@ func TestSetResultsCorrectedResults(t *testing.T) {
 				},
 			}
 
-			got, err := g.SetResults(tc.order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, tc.order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%v, %v, %v) failed with %v", tc.order, tc.pathwayR, eventTime, err)
 			}
@@ -1470,7 +1571,7 @@ func TestSetResultsOverrideNotes(t *testing.T) {
 				Notes:               tc.wantNotes,
 			}
 			var order *ir.Order
-			got, err := g.SetResults(order, tc.pathwayR, eventTime)
+			got, err := g.SetResults(nil, order, tc.pathwayR, eventTime)
 			if err != nil {
 				t.Fatalf("SetResults(%+v, %+v, %+v) failed with %v", order, tc.pathwayR, eventTime, err)
 			}
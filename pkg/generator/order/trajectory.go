@@ -0,0 +1,236 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package order
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/constants"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/orderprofile"
+	"github.com/google/simhospital/pkg/pathway"
+)
+
+const trajectoryValueFormat = "%.2f"
+
+// startTrajectories starts or updates the patient's trajectories for the results that follow a trajectory or
+// track another test.
+// Results with the same trajectory definition as the patient's existing trajectory for the same test continue it.
+// Results with a different definition start a new trajectory from the current value of the existing one, or
+// from a random normal value if there is no such trajectory.
+// Trajectories are started before the tracking results, so that the latter can use them.
+func startTrajectories(patientInfo *ir.PatientInfo, op *orderprofile.OrderProfile, results []*pathway.Result, at time.Time) error {
+	if patientInfo.LabTrajectories == nil {
+		patientInfo.LabTrajectories = map[string]*ir.LabTrajectory{}
+	}
+	trajectories := patientInfo.LabTrajectories
+
+	for _, r := range results {
+		if r.Trajectory == nil {
+			continue
+		}
+		spec := r.Trajectory.String()
+		existing := trajectories[r.TestName]
+		if existing != nil && existing.Spec == spec {
+			continue
+		}
+		baseline, err := startingValue(patientInfo, op, r.TestName, r.Trajectory.Start, at)
+		if err != nil {
+			return err
+		}
+		// The tests that track this one need to continue from their current values.
+		rebaseTrackingTrajectories(trajectories, r.TestName, at)
+
+		t := &ir.LabTrajectory{
+			Spec:         spec,
+			Shape:        r.Trajectory.Shape,
+			Start:        at,
+			Baseline:     baseline,
+			Target:       baseline,
+			NoisePercent: r.Trajectory.GetNoisePercent(),
+		}
+		switch {
+		case r.Trajectory.Target != nil:
+			t.Target = *r.Trajectory.Target
+		case r.Trajectory.TargetFactor != nil:
+			t.Target = baseline * *r.Trajectory.TargetFactor
+		}
+		if r.Trajectory.Over != nil {
+			t.Over = *r.Trajectory.Over
+		}
+		if r.Trajectory.RecoverOver != nil {
+			t.RecoverOver = *r.Trajectory.RecoverOver
+		}
+		trajectories[r.TestName] = t
+	}
+
+	for _, r := range results {
+		if r.Tracks == nil {
+			continue
+		}
+		spec := fmt.Sprintf("tracks=%s factor=%v noise_percent=%v", r.Tracks.TestName, r.Tracks.GetFactor(), r.Tracks.GetNoisePercent())
+		existing := trajectories[r.TestName]
+		if existing != nil && existing.Spec == spec {
+			continue
+		}
+		baseline, err := startingValue(patientInfo, op, r.TestName, nil, at)
+		if err != nil {
+			return err
+		}
+		trajectories[r.TestName] = &ir.LabTrajectory{
+			Spec:         spec,
+			Start:        at,
+			Baseline:     baseline,
+			NoisePercent: r.Tracks.GetNoisePercent(),
+			Tracks:       r.Tracks.TestName,
+			TracksFactor: r.Tracks.GetFactor(),
+		}
+	}
+	return nil
+}
+
+// startingValue returns the value a new trajectory for the given test starts from:
+// - the start value, if specified,
+// - the current value of the existing trajectory for the test, if any,
+// - a random value from the normal range of the test type for the patient otherwise.
+func startingValue(patientInfo *ir.PatientInfo, op *orderprofile.OrderProfile, testName string, start *float64, at time.Time) (float64, error) {
+	if start != nil {
+		return *start, nil
+	}
+	if existing := patientInfo.LabTrajectories[testName]; existing != nil {
+		return trajectoryValue(patientInfo.LabTrajectories, existing, at), nil
+	}
+	tt := op.TestTypes[testName]
+	if tt != nil {
+		tt = tt.ForPerson(patientInfo.Person, at)
+	}
+	if tt == nil || tt.ValueGenerator == nil {
+		// This shouldn't happen if the pathway has been validated.
+		return 0, fmt.Errorf("cannot start a trajectory for test %q: no numerical test type in order profile %q", testName, op.UniversalService.Text)
+	}
+	v, err := tt.ValueGenerator.Normal()
+	if err != nil {
+		return 0, errors.Wrapf(err, "cannot generate the starting value of the trajectory for test %q", testName)
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// rebaseTrackingTrajectories restarts the trajectories that track the given test from their values at the given
+// time, so that they don't jump when the tracked trajectory is replaced by a new one.
+func rebaseTrackingTrajectories(trajectories map[string]*ir.LabTrajectory, testName string, at time.Time) {
+	for _, t := range trajectories {
+		if t.Tracks != testName {
+			continue
+		}
+		t.Baseline = trajectoryValue(trajectories, t, at)
+		t.Start = at
+	}
+}
+
+// trajectoryValue returns the value of the trajectory at the given time, without analytical noise.
+// The values of RISING, FALLING and PEAK_THEN_RECOVER trajectories change linearly between the baseline and
+// the target; after that, they stay at the target, or at the baseline after the recovery.
+// The values of trajectories that track another test change by the relative change of the tracked test
+// since it started, scaled by TracksFactor.
+func trajectoryValue(trajectories map[string]*ir.LabTrajectory, t *ir.LabTrajectory, at time.Time) float64 {
+	return trajectoryValueWithDepth(trajectories, t, at, len(trajectories))
+}
+
+func trajectoryValueWithDepth(trajectories map[string]*ir.LabTrajectory, t *ir.LabTrajectory, at time.Time, depth int) float64 {
+	if t.Tracks != "" {
+		tracked := trajectories[t.Tracks]
+		// The depth protects against trajectories that track each other.
+		if tracked == nil || tracked.Baseline == 0 || depth <= 0 {
+			return t.Baseline
+		}
+		ratio := trajectoryValueWithDepth(trajectories, tracked, at, depth-1) / tracked.Baseline
+		return t.Baseline * (1 + t.TracksFactor*(ratio-1))
+	}
+
+	elapsed := at.Sub(t.Start)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	switch t.Shape {
+	case pathway.TrajectoryRising, pathway.TrajectoryFalling:
+		if elapsed >= t.Over {
+			return t.Target
+		}
+		return interpolate(t.Baseline, t.Target, elapsed, t.Over)
+	case pathway.TrajectoryPeakThenRecover:
+		switch {
+		case elapsed <= t.Over:
+			return interpolate(t.Baseline, t.Target, elapsed, t.Over)
+		case elapsed < t.Over+t.RecoverOver:
+			return interpolate(t.Target, t.Baseline, elapsed-t.Over, t.RecoverOver)
+		default:
+			return t.Baseline
+		}
+	default:
+		return t.Baseline
+	}
+}
+
+func interpolate(from float64, to float64, elapsed time.Duration, total time.Duration) float64 {
+	if total <= 0 {
+		return to
+	}
+	return from + (to-from)*float64(elapsed)/float64(total)
+}
+
+// withNoise returns the value with random analytical noise, normally distributed with the given
+// coefficient of variation. The noise never changes the sign of the value.
+func withNoise(v float64, noisePercent float64) float64 {
+	noisy := v * (1 + rand.NormFloat64()*noisePercent/100)
+	if (v >= 0) != (noisy >= 0) {
+		return 0
+	}
+	return noisy
+}
+
+// setValueFromTrajectory sets Value, Unit, ValueType and AbnormalFlag on the given result from the patient's
+// trajectory for the test at the given time. The abnormal flag is derived from the value and the reference range
+// of the test type.
+func (g Generator) setValueFromTrajectory(patientInfo *ir.PatientInfo, result *ir.Result, pathwayResult *pathway.Result, tt *orderprofile.TestType, at time.Time) error {
+	t := patientInfo.LabTrajectories[pathwayResult.TestName]
+	if t == nil {
+		// This shouldn't happen as the trajectories are started before the values are set.
+		return fmt.Errorf("no trajectory for test %q", pathwayResult.TestName)
+	}
+	result.Value = fmt.Sprintf(trajectoryValueFormat, withNoise(trajectoryValue(patientInfo.LabTrajectories, t, at), t.NoisePercent))
+	// Derive the abnormal flag from the value after formatting, as that's the value that is sent.
+	v, err := strconv.ParseFloat(result.Value, 64)
+	if err != nil {
+		return errors.Wrapf(err, "cannot parse value %q", result.Value)
+	}
+	result.Unit = tt.Unit
+	result.ValueType = constants.NumericalValueType
+
+	abnormalFlag := constants.AbnormalFlagEmpty
+	if vg := tt.ValueGenerator; vg != nil {
+		switch {
+		case vg.IsLow(v):
+			abnormalFlag = constants.AbnormalFlagLow
+		case vg.IsHigh(v):
+			abnormalFlag = constants.AbnormalFlagHigh
+		}
+	}
+	result.AbnormalFlag = g.AbnormalFlagConvertor.ToHL7(abnormalFlag)
+	return nil
+}
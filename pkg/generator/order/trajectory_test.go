@@ -0,0 +1,230 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package order
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/pathway"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+var trajectoryOrderProfile = []byte(`
+UREA AND ELECTROLYTES:
+  universal_service_id: lpdc-3969
+  test_types:
+    Creatinine:
+      id: lpdc-2012
+      value_type: NM
+      value: 51
+      unit: UMOLL
+      ref_range: 49 - 92
+    Urea:
+      id: lpdc-3001
+      value_type: NM
+      value: 5
+      unit: MMOLL
+      ref_range: 2.5 - 7.8`)
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestTrajectoryValue(t *testing.T) {
+	start := time.Date(2019, 1, 20, 0, 0, 0, 0, time.UTC)
+	rising := &ir.LabTrajectory{Shape: pathway.TrajectoryRising, Start: start, Baseline: 100, Target: 300, Over: 48 * time.Hour}
+	peak := &ir.LabTrajectory{Shape: pathway.TrajectoryPeakThenRecover, Start: start, Baseline: 100, Target: 300, Over: 24 * time.Hour, RecoverOver: 48 * time.Hour}
+	stable := &ir.LabTrajectory{Shape: pathway.TrajectoryStable, Start: start, Baseline: 100, Target: 100}
+	tracking := &ir.LabTrajectory{Start: start, Baseline: 5, Tracks: "Creatinine", TracksFactor: 0.5}
+
+	cases := []struct {
+		name       string
+		trajectory *ir.LabTrajectory
+		at         time.Time
+		want       float64
+	}{
+		{name: "rising before start", trajectory: rising, at: start.Add(-time.Hour), want: 100},
+		{name: "rising at start", trajectory: rising, at: start, want: 100},
+		{name: "rising half way", trajectory: rising, at: start.Add(24 * time.Hour), want: 200},
+		{name: "rising after target", trajectory: rising, at: start.Add(72 * time.Hour), want: 300},
+		{name: "peak at peak", trajectory: peak, at: start.Add(24 * time.Hour), want: 300},
+		{name: "peak recovering", trajectory: peak, at: start.Add(48 * time.Hour), want: 200},
+		{name: "peak recovered", trajectory: peak, at: start.Add(96 * time.Hour), want: 100},
+		{name: "stable", trajectory: stable, at: start.Add(96 * time.Hour), want: 100},
+		{name: "tracking", trajectory: tracking, at: start.Add(24 * time.Hour), want: 7.5},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			trajectories := map[string]*ir.LabTrajectory{"Creatinine": rising, "Urea": tracking}
+			if got := trajectoryValue(trajectories, tc.trajectory, tc.at); got != tc.want {
+				t.Errorf("trajectoryValue(%+v, %v) got %v, want %v", tc.trajectory, tc.at, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrajectoryValueTrackingEachOther(t *testing.T) {
+	start := time.Date(2019, 1, 20, 0, 0, 0, 0, time.UTC)
+	trajectories := map[string]*ir.LabTrajectory{
+		"Creatinine": {Start: start, Baseline: 100, Tracks: "Urea", TracksFactor: 1},
+		"Urea":       {Start: start, Baseline: 5, Tracks: "Creatinine", TracksFactor: 1},
+	}
+	// This must terminate.
+	if got, want := trajectoryValue(trajectories, trajectories["Creatinine"], start), 100.0; got != want {
+		t.Errorf("trajectoryValue() got %v, want %v", got, want)
+	}
+}
+
+func TestSetResultsTrajectory(t *testing.T) {
+	ctx := context.Background()
+	op := testwrite.BytesToFile(t, trajectoryOrderProfile)
+	g, hl7Config := testGeneratorWithOrderProfile(ctx, t, op)
+
+	r := &pathway.Results{
+		OrderProfile: "UREA AND ELECTROLYTES",
+		Results: []*pathway.Result{{
+			TestName: "Creatinine",
+			Trajectory: &pathway.Trajectory{
+				Shape:        pathway.TrajectoryRising,
+				Start:        floatPtr(80),
+				Target:       floatPtr(240),
+				Over:         durationPtr(48 * time.Hour),
+				NoisePercent: floatPtr(0),
+			},
+		}, {
+			TestName: "Urea",
+			Tracks:   &pathway.Tracks{TestName: "Creatinine", Factor: 1, NoisePercent: floatPtr(0)},
+		}},
+	}
+
+	cases := []struct {
+		offset           time.Duration
+		wantCreatinine   string
+		wantCreatinineAF string
+		wantUrea         string
+	}{
+		{offset: 0, wantCreatinine: "80.00", wantCreatinineAF: ""},
+		{offset: 24 * time.Hour, wantCreatinine: "160.00", wantCreatinineAF: hl7Config.AbnormalFlags.AboveHighNormal},
+		{offset: 96 * time.Hour, wantCreatinine: "240.00", wantCreatinineAF: hl7Config.AbnormalFlags.AboveHighNormal},
+	}
+
+	patientInfo := &ir.PatientInfo{}
+	var ureaBaseline float64
+	for _, tc := range cases {
+		at := eventTime.Add(tc.offset)
+		got, err := g.SetResults(patientInfo, ureaOrder(at, hl7Config), r, at)
+		if err != nil {
+			t.Fatalf("SetResults(%v) failed with %v", at, err)
+		}
+		if len(got.Results) != 2 {
+			t.Fatalf("SetResults(%v) got %d results, want 2", at, len(got.Results))
+		}
+		creatinine, urea := got.Results[0], got.Results[1]
+		if creatinine.Value != tc.wantCreatinine {
+			t.Errorf("SetResults(%v) Creatinine value got %q, want %q", at, creatinine.Value, tc.wantCreatinine)
+		}
+		if creatinine.AbnormalFlag != tc.wantCreatinineAF {
+			t.Errorf("SetResults(%v) Creatinine abnormal flag got %q, want %q", at, creatinine.AbnormalFlag, tc.wantCreatinineAF)
+		}
+		if creatinine.Unit != "UMOLL" || creatinine.ValueType != "NM" {
+			t.Errorf("SetResults(%v) Creatinine unit and value type got %q, %q, want %q, %q", at, creatinine.Unit, creatinine.ValueType, "UMOLL", "NM")
+		}
+
+		// Urea starts from a random normal value, and then follows the relative change of Creatinine.
+		v, err := strconv.ParseFloat(urea.Value, 64)
+		if err != nil {
+			t.Fatalf("strconv.ParseFloat(%q) failed with %v", urea.Value, err)
+		}
+		if tc.offset == 0 {
+			ureaBaseline = v
+			continue
+		}
+		creatinineValue, err := strconv.ParseFloat(creatinine.Value, 64)
+		if err != nil {
+			t.Fatalf("strconv.ParseFloat(%q) failed with %v", creatinine.Value, err)
+		}
+		want := ureaBaseline * creatinineValue / 80
+		if diff := v - want; diff > 0.01 || diff < -0.01 {
+			t.Errorf("SetResults(%v) Urea value got %v, want %v", at, v, want)
+		}
+	}
+}
+
+func TestSetResultsNewTrajectoryContinuesFromCurrentValue(t *testing.T) {
+	ctx := context.Background()
+	op := testwrite.BytesToFile(t, trajectoryOrderProfile)
+	g, hl7Config := testGeneratorWithOrderProfile(ctx, t, op)
+
+	rising := &pathway.Results{
+		OrderProfile: "UREA AND ELECTROLYTES",
+		Results: []*pathway.Result{{
+			TestName: "Creatinine",
+			Trajectory: &pathway.Trajectory{
+				Shape:        pathway.TrajectoryRising,
+				Start:        floatPtr(80),
+				TargetFactor: floatPtr(3),
+				Over:         durationPtr(48 * time.Hour),
+				NoisePercent: floatPtr(0),
+			},
+		}},
+	}
+	falling := &pathway.Results{
+		OrderProfile: "UREA AND ELECTROLYTES",
+		Results: []*pathway.Result{{
+			TestName: "Creatinine",
+			Trajectory: &pathway.Trajectory{
+				Shape:        pathway.TrajectoryFalling,
+				TargetFactor: floatPtr(0.5),
+				Over:         durationPtr(24 * time.Hour),
+				NoisePercent: floatPtr(0),
+			},
+		}},
+	}
+
+	patientInfo := &ir.PatientInfo{}
+	steps := []struct {
+		r      *pathway.Results
+		offset time.Duration
+		want   string
+	}{
+		{r: rising, offset: 0, want: "80.00"},
+		{r: rising, offset: 24 * time.Hour, want: "160.00"},
+		// The falling trajectory starts from 160, the current value of the rising one.
+		{r: falling, offset: 24 * time.Hour, want: "160.00"},
+		{r: falling, offset: 36 * time.Hour, want: "120.00"},
+		{r: falling, offset: 72 * time.Hour, want: "80.00"},
+	}
+	for _, s := range steps {
+		at := eventTime.Add(s.offset)
+		got, err := g.SetResults(patientInfo, ureaOrder(at, hl7Config), s.r, at)
+		if err != nil {
+			t.Fatalf("SetResults(%v) failed with %v", at, err)
+		}
+		if len(got.Results) != 1 {
+			t.Fatalf("SetResults(%v) got %d results, want 1", at, len(got.Results))
+		}
+		if got.Results[0].Value != s.want {
+			t.Errorf("SetResults(%v) value got %q, want %q", at, got.Results[0].Value, s.want)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package order
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/google/simhospital/pkg/constants"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/pathway"
+)
+
+// Coding systems of the vital signs observations. They can be mapped to FHIR systems with the
+// coding_systems map in the HL7 config.
+const (
+	loincCodingSystem  = "LN"
+	snomedCodingSystem = "SCT"
+)
+
+// Names of the vital signs, used as keys of ir.VitalSigns.Offsets.
+const (
+	heartRate              = "HeartRate"
+	systolicBloodPressure  = "SystolicBloodPressure"
+	diastolicBloodPressure = "DiastolicBloodPressure"
+	respiratoryRate        = "RespiratoryRate"
+	oxygenSaturation       = "OxygenSaturation"
+	bodyTemperature        = "BodyTemperature"
+)
+
+// Thresholds of the Glasgow Coma Scale: the score starts to fall from the maximum when the acuity reaches
+// gcsAcuityThreshold, and it falls by gcsDropAtCritical points for critically ill patients.
+const (
+	gcsMax             = 15
+	gcsMin             = 3
+	gcsAcuityThreshold = 0.6
+	gcsDropAtCritical  = 7
+)
+
+var (
+	vitalSignsPanel = ir.CodedElement{ID: "85353-1", Text: "Vital signs panel", CodingSystem: loincCodingSystem}
+	gcsTotal        = ir.CodedElement{ID: "9269-2", Text: "Glasgow coma score total", CodingSystem: loincCodingSystem}
+	news2Total      = ir.CodedElement{ID: "1104051000000101", Text: "NEWS2 total score", CodingSystem: snomedCodingSystem}
+
+	// acuities are the values of the acuity levels in the pathway, from 0 (well) to 1 (critically ill).
+	acuities = map[string]float64{
+		pathway.AcuityLow:      0,
+		pathway.AcuityMedium:   0.35,
+		pathway.AcuityHigh:     0.65,
+		pathway.AcuityCritical: 1,
+	}
+
+	// vitalSigns are the vital signs in the order they are sent.
+	// The normal ranges are the ranges that score 0 in NEWS2, except for the diastolic blood pressure
+	// that is not part of NEWS2.
+	vitalSigns = []vitalSign{{
+		name:       heartRate,
+		code:       ir.CodedElement{ID: "8867-4", Text: "Heart rate", CodingSystem: loincCodingSystem},
+		unit:       "/min",
+		well:       75,
+		critical:   135,
+		offsetSD:   8,
+		min:        25,
+		max:        220,
+		normalLow:  51,
+		normalHigh: 90,
+	}, {
+		name:       systolicBloodPressure,
+		code:       ir.CodedElement{ID: "8480-6", Text: "Systolic blood pressure", CodingSystem: loincCodingSystem},
+		unit:       "mm[Hg]",
+		well:       122,
+		critical:   82,
+		offsetSD:   10,
+		min:        50,
+		max:        250,
+		normalLow:  111,
+		normalHigh: 219,
+	}, {
+		name:       diastolicBloodPressure,
+		code:       ir.CodedElement{ID: "8462-4", Text: "Diastolic blood pressure", CodingSystem: loincCodingSystem},
+		unit:       "mm[Hg]",
+		well:       76,
+		critical:   48,
+		offsetSD:   6,
+		min:        25,
+		max:        140,
+		normalLow:  60,
+		normalHigh: 90,
+	}, {
+		name:       respiratoryRate,
+		code:       ir.CodedElement{ID: "9279-1", Text: "Respiratory rate", CodingSystem: loincCodingSystem},
+		unit:       "/min",
+		well:       15,
+		critical:   30,
+		offsetSD:   1.5,
+		min:        4,
+		max:        60,
+		normalLow:  12,
+		normalHigh: 20,
+	}, {
+		name:       oxygenSaturation,
+		code:       ir.CodedElement{ID: "59408-5", Text: "Oxygen saturation in Arterial blood by Pulse oximetry", CodingSystem: loincCodingSystem},
+		unit:       "%",
+		well:       97.5,
+		critical:   86,
+		offsetSD:   1,
+		min:        60,
+		max:        100,
+		normalLow:  96,
+		normalHigh: 100,
+	}, {
+		name:       bodyTemperature,
+		code:       ir.CodedElement{ID: "8310-5", Text: "Body temperature", CodingSystem: loincCodingSystem},
+		unit:       "Cel",
+		well:       36.8,
+		critical:   39.3,
+		offsetSD:   0.2,
+		decimals:   1,
+		min:        33,
+		max:        42.5,
+		normalLow:  36.1,
+		normalHigh: 38,
+	}}
+)
+
+// vitalSign is the definition of a vital sign. Its typical value changes linearly with the acuity of the
+// patient, from the value for a well person to the value for a critically ill one.
+type vitalSign struct {
+	name     string
+	code     ir.CodedElement
+	unit     string
+	well     float64
+	critical float64
+	// offsetSD is the standard deviation of the deviation of each patient from the typical values.
+	offsetSD float64
+	// decimals is the number of decimal places of the values.
+	decimals int
+	// min and max are the physiological limits of the values.
+	min float64
+	max float64
+	// normalLow and normalHigh are the limits of the normal range, used to set the abnormal flags.
+	normalLow  float64
+	normalHigh float64
+}
+
+func (v vitalSign) format(f float64) string {
+	return strconv.FormatFloat(f, 'f', v.decimals, 64)
+}
+
+func (v vitalSign) refRange() string {
+	return fmt.Sprintf("%s - %s", v.format(v.normalLow), v.format(v.normalHigh))
+}
+
+// VitalSigns returns a new order with a set of vital signs observations for the patient at the given time, and
+// the NEWS2 score derived from them.
+// The patientInfo keeps the acuity of the patient over time. If patientInfo is nil, the vital signs are
+// generated as if for a new patient.
+func (g Generator) VitalSigns(patientInfo *ir.PatientInfo, v *pathway.Vitals, eventTime time.Time) *ir.Order {
+	if patientInfo == nil {
+		patientInfo = &ir.PatientInfo{}
+	}
+	vs := startVitalSigns(patientInfo, v, eventTime)
+	acuity := acuityAt(vs, eventTime)
+	onOxygen := acuity >= acuities[pathway.AcuityHigh]
+	if vs.SupplementalOxygen != nil {
+		onOxygen = *vs.SupplementalOxygen
+	}
+
+	panel := vitalSignsPanel
+	o := &ir.Order{
+		OrderProfile:          &panel,
+		Placer:                g.PlacerGenerator.NewID(),
+		Filler:                g.FillerGenerator.NewID(),
+		OrderDateTime:         ir.NewValidTime(eventTime),
+		CollectedDateTime:     ir.NewValidTime(eventTime),
+		ReceivedInLabDateTime: ir.NewValidTime(eventTime),
+		ReportedDateTime:      ir.NewValidTime(eventTime),
+		OrderStatus:           g.MessageConfig.OrderStatus.Completed,
+		ResultsStatus:         g.MessageConfig.ResultStatus.Final,
+		VitalSigns:            true,
+	}
+
+	values := vitalSignValues(vs, acuity, onOxygen)
+	for _, sign := range vitalSigns {
+		value := values[sign.name]
+		code := sign.code
+		r := &ir.Result{
+			TestName:            &code,
+			Value:               sign.format(value),
+			Unit:                sign.unit,
+			ValueType:           constants.NumericalValueType,
+			Range:               sign.refRange(),
+			ObservationDateTime: ir.NewValidTime(eventTime),
+			Status:              o.ResultsStatus,
+		}
+		switch {
+		case value < sign.normalLow:
+			r.AbnormalFlag = g.AbnormalFlagConvertor.ToHL7(constants.AbnormalFlagLow)
+		case value > sign.normalHigh:
+			r.AbnormalFlag = g.AbnormalFlagConvertor.ToHL7(constants.AbnormalFlagHigh)
+		}
+		if sign.name == oxygenSaturation && onOxygen {
+			r.Notes = []string{"On supplemental oxygen"}
+		}
+		o.Results = append(o.Results, r)
+	}
+
+	gcs := gcsAt(acuity)
+	gcsCode := gcsTotal
+	gcsResult := &ir.Result{
+		TestName:            &gcsCode,
+		Value:               strconv.Itoa(gcs),
+		Unit:                "{score}",
+		ValueType:           constants.NumericalValueType,
+		Range:               strconv.Itoa(gcsMax),
+		ObservationDateTime: ir.NewValidTime(eventTime),
+		Status:              o.ResultsStatus,
+	}
+	if gcs < gcsMax {
+		gcsResult.AbnormalFlag = g.AbnormalFlagConvertor.ToHL7(constants.AbnormalFlagLow)
+	}
+	o.Results = append(o.Results, gcsResult)
+
+	score, singleParameterScoredThree := news2(values, gcs, onOxygen)
+	news2Code := news2Total
+	news2Result := &ir.Result{
+		TestName:            &news2Code,
+		Value:               strconv.Itoa(score),
+		Unit:                "{score}",
+		ValueType:           constants.NumericalValueType,
+		Range:               "0 - 4",
+		ObservationDateTime: ir.NewValidTime(eventTime),
+		Status:              o.ResultsStatus,
+		Notes:               []string{fmt.Sprintf("Clinical risk: %s", news2ClinicalRisk(score, singleParameterScoredThree))},
+	}
+	if score >= 5 {
+		news2Result.AbnormalFlag = g.AbnormalFlagConvertor.ToHL7(constants.AbnormalFlagHigh)
+	}
+	o.Results = append(o.Results, news2Result)
+	return o
+}
+
+// startVitalSigns starts or updates the patient's vital signs state for the given vitals.
+// Vitals with the same definition as the existing state continue it.
+// Vitals with a different definition start a new trend from the given acuity, or from the current acuity of the
+// patient if not specified. The deviations of the patient from the typical values are kept.
+func startVitalSigns(patientInfo *ir.PatientInfo, v *pathway.Vitals, at time.Time) *ir.VitalSigns {
+	spec := v.String()
+	existing := patientInfo.VitalSigns
+	if existing != nil && existing.Spec == spec {
+		return existing
+	}
+
+	baseline := acuities[pathway.AcuityLow]
+	switch {
+	case v.Acuity != "":
+		baseline = acuities[v.Acuity]
+	case existing != nil:
+		baseline = acuityAt(existing, at)
+	}
+	vs := &ir.VitalSigns{
+		Spec:               spec,
+		Start:              at,
+		Baseline:           baseline,
+		Target:             baseline,
+		SupplementalOxygen: v.SupplementalOxygen,
+		NoisePercent:       v.GetNoisePercent(),
+	}
+	switch v.Trend {
+	case pathway.VitalsDeteriorating:
+		vs.Target = acuities[pathway.AcuityCritical]
+	case pathway.VitalsImproving:
+		vs.Target = acuities[pathway.AcuityLow]
+	}
+	if v.Over != nil {
+		vs.Over = *v.Over
+	}
+	if existing != nil {
+		vs.Offsets = existing.Offsets
+	} else {
+		vs.Offsets = make(map[string]float64)
+		for _, sign := range vitalSigns {
+			vs.Offsets[sign.name] = rand.NormFloat64() * sign.offsetSD
+		}
+	}
+	patientInfo.VitalSigns = vs
+	return vs
+}
+
+// acuityAt returns the acuity of the patient at the given time. It changes linearly from the baseline to the
+// target, and stays at the target after that.
+func acuityAt(vs *ir.VitalSigns, at time.Time) float64 {
+	elapsed := at.Sub(vs.Start)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	if elapsed >= vs.Over {
+		return vs.Target
+	}
+	return interpolate(vs.Baseline, vs.Target, elapsed, vs.Over)
+}
+
+// vitalSignValues returns the values of the vital signs of the patient with the given acuity, keyed by name.
+// All vital signs move together with the acuity, and the patient's own deviations and the measurement noise
+// are added on top. Supplemental oxygen corrects half of the fall in oxygen saturation, and the diastolic blood
+// pressure is always lower than the systolic.
+func vitalSignValues(vs *ir.VitalSigns, acuity float64, onOxygen bool) map[string]float64 {
+	values := make(map[string]float64)
+	for _, sign := range vitalSigns {
+		typical := sign.well + (sign.critical-sign.well)*acuity
+		if sign.name == oxygenSaturation && onOxygen {
+			typical += (sign.well - typical) / 2
+		}
+		noise := rand.NormFloat64() * math.Abs(sign.critical-sign.well) * vs.NoisePercent / 100
+		v := math.Max(sign.min, math.Min(sign.max, typical+vs.Offsets[sign.name]+noise))
+		values[sign.name] = round(v, sign.decimals)
+	}
+	if minPulsePressure := 15.0; values[systolicBloodPressure]-values[diastolicBloodPressure] < minPulsePressure {
+		values[diastolicBloodPressure] = values[systolicBloodPressure] - minPulsePressure
+	}
+	return values
+}
+
+// gcsAt returns the Glasgow Coma Scale of a patient with the given acuity.
+func gcsAt(acuity float64) int {
+	if acuity <= gcsAcuityThreshold {
+		return gcsMax
+	}
+	drop := int(math.Round((acuity - gcsAcuityThreshold) / (1 - gcsAcuityThreshold) * gcsDropAtCritical))
+	if gcsMax-drop < gcsMin {
+		return gcsMin
+	}
+	return gcsMax - drop
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
+
+// news2 returns the National Early Warning Score 2 of the given vital signs, using the SpO2 scale 1, and whether
+// any single parameter scored 3.
+// See https://www.rcplondon.ac.uk/projects/outputs/national-early-warning-score-news-2.
+func news2(values map[string]float64, gcs int, onOxygen bool) (int, bool) {
+	scores := []int{
+		bandScore(values[respiratoryRate], []band{{8, 3}, {11, 1}, {20, 0}, {24, 2}}, 3),
+		bandScore(values[oxygenSaturation], []band{{91, 3}, {93, 2}, {95, 1}}, 0),
+		bandScore(values[systolicBloodPressure], []band{{90, 3}, {100, 2}, {110, 1}, {219, 0}}, 3),
+		bandScore(values[heartRate], []band{{40, 3}, {50, 1}, {90, 0}, {110, 1}, {130, 2}}, 3),
+		bandScore(values[bodyTemperature], []band{{35, 3}, {36, 1}, {38, 0}, {39, 1}}, 2),
+	}
+	if onOxygen {
+		scores = append(scores, 2)
+	}
+	if gcs < gcsMax {
+		// Any new confusion or reduced level of consciousness scores 3.
+		scores = append(scores, 3)
+	}
+	var total int
+	var singleParameterScoredThree bool
+	for _, s := range scores {
+		total += s
+		if s == 3 {
+			singleParameterScoredThree = true
+		}
+	}
+	return total, singleParameterScoredThree
+}
+
+// band is a range of values of a NEWS2 parameter, up to and including upTo, with the given score.
+type band struct {
+	upTo  float64
+	score int
+}
+
+// bandScore returns the score of the first band that includes the value, or the given score if the value is
+// above all of them. The bands must be sorted in increasing order.
+func bandScore(v float64, bands []band, above int) int {
+	for _, b := range bands {
+		if v <= b.upTo {
+			return b.score
+		}
+	}
+	return above
+}
+
+// news2ClinicalRisk returns the clinical risk for the given NEWS2 score.
+func news2ClinicalRisk(score int, singleParameterScoredThree bool) string {
+	switch {
+	case score >= 7:
+		return "High"
+	case score >= 5:
+		return "Medium"
+	case singleParameterScoredThree:
+		return "Low-medium"
+	default:
+		return "Low"
+	}
+}
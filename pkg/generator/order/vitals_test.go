@@ -0,0 +1,231 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/pathway"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// patientWithoutOffsets returns a patient whose vital signs have the typical values, so that the tests are
+// deterministic when there is no noise.
+func patientWithoutOffsets() *ir.PatientInfo {
+	return &ir.PatientInfo{VitalSigns: &ir.VitalSigns{Offsets: map[string]float64{}}}
+}
+
+type vitalsResult struct {
+	id           string
+	value        string
+	abnormalFlag string
+}
+
+func vitalsResults(o *ir.Order) []vitalsResult {
+	var got []vitalsResult
+	for _, r := range o.Results {
+		got = append(got, vitalsResult{id: r.TestName.ID, value: r.Value, abnormalFlag: r.AbnormalFlag})
+	}
+	return got
+}
+
+func TestVitalSigns(t *testing.T) {
+	ctx := context.Background()
+	g, hl7Config := testGenerator(ctx, t)
+	high := hl7Config.AbnormalFlags.AboveHighNormal
+	low := hl7Config.AbnormalFlags.BelowLowNormal
+
+	cases := []struct {
+		name   string
+		vitals *pathway.Vitals
+		want   []vitalsResult
+	}{{
+		name:   "low acuity",
+		vitals: &pathway.Vitals{Acuity: pathway.AcuityLow, NoisePercent: floatPtr(0)},
+		want: []vitalsResult{
+			{id: "8867-4", value: "75"},
+			{id: "8480-6", value: "122"},
+			{id: "8462-4", value: "76"},
+			{id: "9279-1", value: "15"},
+			{id: "59408-5", value: "98"},
+			{id: "8310-5", value: "36.8"},
+			{id: "9269-2", value: "15"},
+			{id: "1104051000000101", value: "0"},
+		},
+	}, {
+		name:   "critical acuity",
+		vitals: &pathway.Vitals{Acuity: pathway.AcuityCritical, NoisePercent: floatPtr(0)},
+		want: []vitalsResult{
+			{id: "8867-4", value: "135", abnormalFlag: high},
+			{id: "8480-6", value: "82", abnormalFlag: low},
+			{id: "8462-4", value: "48", abnormalFlag: low},
+			{id: "9279-1", value: "30", abnormalFlag: high},
+			// Supplemental oxygen corrects half of the fall in oxygen saturation.
+			{id: "59408-5", value: "92", abnormalFlag: low},
+			{id: "8310-5", value: "39.3", abnormalFlag: high},
+			{id: "9269-2", value: "8", abnormalFlag: low},
+			// RR 3 + SpO2 2 + oxygen 2 + SBP 3 + HR 3 + consciousness 3 + temperature 2.
+			{id: "1104051000000101", value: "18", abnormalFlag: high},
+		},
+	}, {
+		name:   "critical acuity without oxygen",
+		vitals: &pathway.Vitals{Acuity: pathway.AcuityCritical, SupplementalOxygen: boolPtr(false), NoisePercent: floatPtr(0)},
+		want: []vitalsResult{
+			{id: "8867-4", value: "135", abnormalFlag: high},
+			{id: "8480-6", value: "82", abnormalFlag: low},
+			{id: "8462-4", value: "48", abnormalFlag: low},
+			{id: "9279-1", value: "30", abnormalFlag: high},
+			{id: "59408-5", value: "86", abnormalFlag: low},
+			{id: "8310-5", value: "39.3", abnormalFlag: high},
+			{id: "9269-2", value: "8", abnormalFlag: low},
+			{id: "1104051000000101", value: "17", abnormalFlag: high},
+		},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := g.VitalSigns(patientWithoutOffsets(), tc.vitals, eventTime)
+			if diff := cmp.Diff(tc.want, vitalsResults(o), cmp.AllowUnexported(vitalsResult{})); diff != "" {
+				t.Errorf("VitalSigns(%v) got diff (-want +got):\n%s", tc.vitals, diff)
+			}
+			if !o.VitalSigns {
+				t.Errorf("VitalSigns(%v).VitalSigns got false, want true", tc.vitals)
+			}
+			if got, want := o.OrderProfile.ID, "85353-1"; got != want {
+				t.Errorf("VitalSigns(%v).OrderProfile.ID got %q, want %q", tc.vitals, got, want)
+			}
+			if got, want := o.ResultsStatus, hl7Config.ResultStatus.Final; got != want {
+				t.Errorf("VitalSigns(%v).ResultsStatus got %q, want %q", tc.vitals, got, want)
+			}
+		})
+	}
+}
+
+func TestVitalSignsTrend(t *testing.T) {
+	ctx := context.Background()
+	g, _ := testGenerator(ctx, t)
+	deteriorating := &pathway.Vitals{Trend: pathway.VitalsDeteriorating, Over: durationPtr(48 * time.Hour), NoisePercent: floatPtr(0)}
+	improving := &pathway.Vitals{Trend: pathway.VitalsImproving, Over: durationPtr(24 * time.Hour), NoisePercent: floatPtr(0)}
+
+	patientInfo := patientWithoutOffsets()
+	steps := []struct {
+		vitals        *pathway.Vitals
+		offset        time.Duration
+		wantHeartRate string
+	}{
+		{vitals: deteriorating, offset: 0, wantHeartRate: "75"},
+		{vitals: deteriorating, offset: 24 * time.Hour, wantHeartRate: "105"},
+		{vitals: deteriorating, offset: 48 * time.Hour, wantHeartRate: "135"},
+		{vitals: deteriorating, offset: 72 * time.Hour, wantHeartRate: "135"},
+		// The improving trend starts from the current acuity.
+		{vitals: improving, offset: 72 * time.Hour, wantHeartRate: "135"},
+		{vitals: improving, offset: 84 * time.Hour, wantHeartRate: "105"},
+		{vitals: improving, offset: 120 * time.Hour, wantHeartRate: "75"},
+	}
+	for _, s := range steps {
+		at := eventTime.Add(s.offset)
+		o := g.VitalSigns(patientInfo, s.vitals, at)
+		if got := o.Results[0].Value; got != s.wantHeartRate {
+			t.Errorf("VitalSigns(%v, %v) heart rate got %q, want %q", s.vitals, at, got, s.wantHeartRate)
+		}
+	}
+}
+
+func TestVitalSignsKeepsPatientOffsets(t *testing.T) {
+	ctx := context.Background()
+	g, _ := testGenerator(ctx, t)
+	patientInfo := &ir.PatientInfo{}
+	g.VitalSigns(patientInfo, &pathway.Vitals{Acuity: pathway.AcuityLow}, eventTime)
+	offsets := patientInfo.VitalSigns.Offsets
+	if len(offsets) != len(vitalSigns) {
+		t.Fatalf("VitalSigns() got %d offsets, want %d", len(offsets), len(vitalSigns))
+	}
+	g.VitalSigns(patientInfo, &pathway.Vitals{Acuity: pathway.AcuityHigh}, eventTime.Add(time.Hour))
+	if diff := cmp.Diff(offsets, patientInfo.VitalSigns.Offsets); diff != "" {
+		t.Errorf("VitalSigns() with a new acuity changed the offsets (-want +got):\n%s", diff)
+	}
+}
+
+func TestVitalSignsDiastolicBelowSystolic(t *testing.T) {
+	ctx := context.Background()
+	g, _ := testGenerator(ctx, t)
+	patientInfo := &ir.PatientInfo{VitalSigns: &ir.VitalSigns{Offsets: map[string]float64{
+		systolicBloodPressure:  -30,
+		diastolicBloodPressure: 30,
+	}}}
+	o := g.VitalSigns(patientInfo, &pathway.Vitals{NoisePercent: floatPtr(0)}, eventTime)
+	if got, want := o.Results[2].Value, "77"; got != want {
+		t.Errorf("VitalSigns() diastolic blood pressure got %q, want %q", got, want)
+	}
+}
+
+func TestNEWS2(t *testing.T) {
+	normal := map[string]float64{
+		respiratoryRate:       16,
+		oxygenSaturation:      97,
+		systolicBloodPressure: 120,
+		heartRate:             70,
+		bodyTemperature:       37,
+	}
+	with := func(name string, v float64) map[string]float64 {
+		m := make(map[string]float64)
+		for k, v := range normal {
+			m[k] = v
+		}
+		m[name] = v
+		return m
+	}
+
+	cases := []struct {
+		name      string
+		values    map[string]float64
+		gcs       int
+		onOxygen  bool
+		want      int
+		wantThree bool
+		wantRisk  string
+	}{
+		{name: "normal", values: normal, gcs: 15, want: 0, wantRisk: "Low"},
+		{name: "on oxygen", values: normal, gcs: 15, onOxygen: true, want: 2, wantRisk: "Low"},
+		{name: "confused", values: normal, gcs: 14, want: 3, wantThree: true, wantRisk: "Low-medium"},
+		{name: "RR 8", values: with(respiratoryRate, 8), gcs: 15, want: 3, wantThree: true, wantRisk: "Low-medium"},
+		{name: "RR 21", values: with(respiratoryRate, 21), gcs: 15, want: 2, wantRisk: "Low"},
+		{name: "SpO2 93", values: with(oxygenSaturation, 93), gcs: 15, want: 2, wantRisk: "Low"},
+		{name: "SBP 220", values: with(systolicBloodPressure, 220), gcs: 15, want: 3, wantThree: true, wantRisk: "Low-medium"},
+		{name: "HR 111", values: with(heartRate, 111), gcs: 15, want: 2, wantRisk: "Low"},
+		{name: "HR 131", values: with(heartRate, 131), gcs: 15, want: 3, wantThree: true, wantRisk: "Low-medium"},
+		{name: "temperature 35.1", values: with(bodyTemperature, 35.1), gcs: 15, want: 1, wantRisk: "Low"},
+		{name: "temperature 39.1", values: with(bodyTemperature, 39.1), gcs: 15, want: 2, wantRisk: "Low"},
+		{name: "medium", values: with(heartRate, 131), gcs: 15, onOxygen: true, want: 5, wantThree: true, wantRisk: "Medium"},
+		{name: "high", values: with(heartRate, 131), gcs: 14, onOxygen: true, want: 8, wantThree: true, wantRisk: "High"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotThree := news2(tc.values, tc.gcs, tc.onOxygen)
+			if got != tc.want || gotThree != tc.wantThree {
+				t.Errorf("news2(%v, %d, %t) got (%d, %t), want (%d, %t)", tc.values, tc.gcs, tc.onOxygen, got, gotThree, tc.want, tc.wantThree)
+			}
+			if gotRisk := news2ClinicalRisk(got, gotThree); gotRisk != tc.wantRisk {
+				t.Errorf("news2ClinicalRisk(%d, %t) got %q, want %q", got, gotThree, gotRisk, tc.wantRisk)
+			}
+		})
+	}
+}
@@ -89,6 +89,9 @@ func (g Generator) UpdatePersonFromPathway(person *ir.Person, pathwayPerson *pat
 		person.Birth = ir.NewValidTime(pathway.RandomBirthdate(g.Clock))
 	}
 
+	// All the names of the person are generated from the same locale.
+	names := g.NameGenerator.WithRandomLocale()
+
 	// For gender, if there is no gender set in the pathway then we need to randomly generate one
 	// for use in generating future variables.
 	// If it is set in pathway, then we need to use to pathway gender to generate the other variables
@@ -101,14 +104,14 @@ func (g Generator) UpdatePersonFromPathway(person *ir.Person, pathwayPerson *pat
 		// The Middlename and Prefix depend on the gender, so if the gender changes we need to change
 		// those too, otherwise we might have inconsistent names such as a person with gender Female
 		// and a prefix "Mr.".
-		person.MiddleName = g.NameGenerator.MiddleName(internalGender)
-		person.Prefix = g.NameGenerator.Prefix(internalGender)
+		person.MiddleName = names.MiddleName(internalGender)
+		person.Prefix = names.Prefix(internalGender)
 	}
 
 	// Fields that are set in the pathway's person always override the original person's.
-	person.FirstName = chooseValue(pathwayPerson.FirstName, g.NameGenerator.FirstName(internalGender,
+	person.FirstName = chooseValue(pathwayPerson.FirstName, names.FirstName(internalGender,
 		person.Birth.Year()), person.FirstName)
-	person.Surname = chooseOptionalValue(pathwayPerson.Surname, g.NameGenerator.Surname(),
+	person.Surname = chooseOptionalValue(pathwayPerson.Surname, names.Surname(),
 		person.Surname)
 	person.Address = g.mergeAddressFromPathway(pathwayPerson.Address, person.Address)
 	person.NHS = chooseValue(pathwayPerson.NHS, newNHSNumber(), person.NHS)
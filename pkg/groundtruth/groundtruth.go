@@ -0,0 +1,232 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package groundtruth exports the state of the simulated patients after each event, so that the
+// state that downstream systems reconstruct from the messages can be compared against the state
+// that Simulated Hospital intended.
+package groundtruth
+
+import (
+	"time"
+
+	"github.com/google/simhospital/pkg/ir"
+)
+
+// Tags identify the event after which a snapshot was taken.
+type Tags struct {
+	PathwayName string `json:"pathway_name"`
+	// StepIndex is the index of the step in the pathway, starting at 0. Historical steps come first.
+	StepIndex  int       `json:"step_index"`
+	StepType   string    `json:"step_type"`
+	Historical bool      `json:"historical,omitempty"`
+	EventTime  time.Time `json:"event_time"`
+	// ControlIDs are the message control IDs (MSH-10) of the messages generated by the event.
+	ControlIDs []string `json:"control_ids,omitempty"`
+}
+
+// Snapshot is the state of a patient after an event.
+type Snapshot struct {
+	Tags
+	MRN           string     `json:"mrn"`
+	Class         string     `json:"class,omitempty"`
+	VisitID       uint64     `json:"visit_id,omitempty"`
+	Location      *Location  `json:"location,omitempty"`
+	AdmissionTime *time.Time `json:"admission_time,omitempty"`
+	DischargeTime *time.Time `json:"discharge_time,omitempty"`
+	// Encounters are all the encounters of the patient, in the order in which they started.
+	Encounters []Encounter `json:"encounters,omitempty"`
+}
+
+// Encounter is an encounter of a patient, with its locations, orders, diagnoses and procedures.
+type Encounter struct {
+	// Index is the position of the encounter in the patient's encounters, starting at 1.
+	Index      int         `json:"index"`
+	Status     string      `json:"status"`
+	Pending    bool        `json:"pending,omitempty"`
+	Start      *time.Time  `json:"start,omitempty"`
+	End        *time.Time  `json:"end,omitempty"`
+	Locations  []Location  `json:"locations,omitempty"`
+	Orders     []Order     `json:"orders,omitempty"`
+	Diagnoses  []Diagnosis `json:"diagnoses,omitempty"`
+	Procedures []Diagnosis `json:"procedures,omitempty"`
+}
+
+// Location is a location where a patient is or has been. Start and End are only set for the
+// locations of encounters.
+type Location struct {
+	PointOfCare string     `json:"point_of_care,omitempty"`
+	Room        string     `json:"room,omitempty"`
+	Bed         string     `json:"bed,omitempty"`
+	Facility    string     `json:"facility,omitempty"`
+	Building    string     `json:"building,omitempty"`
+	Floor       string     `json:"floor,omitempty"`
+	Type        string     `json:"type,omitempty"`
+	Start       *time.Time `json:"start,omitempty"`
+	End         *time.Time `json:"end,omitempty"`
+}
+
+// Code is a coded value, e.g., the code of a diagnosis.
+type Code struct {
+	ID           string `json:"id"`
+	Text         string `json:"text,omitempty"`
+	CodingSystem string `json:"coding_system,omitempty"`
+}
+
+// Order is an order and its results.
+type Order struct {
+	Placer        string     `json:"placer,omitempty"`
+	Filler        string     `json:"filler,omitempty"`
+	Profile       *Code      `json:"profile,omitempty"`
+	OrderControl  string     `json:"order_control,omitempty"`
+	OrderStatus   string     `json:"order_status,omitempty"`
+	ResultsStatus string     `json:"results_status,omitempty"`
+	OrderTime     *time.Time `json:"order_time,omitempty"`
+	CollectedTime *time.Time `json:"collected_time,omitempty"`
+	ReportedTime  *time.Time `json:"reported_time,omitempty"`
+	Results       []Result   `json:"results,omitempty"`
+}
+
+// Result is a result of an order.
+type Result struct {
+	Test            *Code      `json:"test,omitempty"`
+	Value           string     `json:"value,omitempty"`
+	Unit            string     `json:"unit,omitempty"`
+	ValueType       string     `json:"value_type,omitempty"`
+	Range           string     `json:"range,omitempty"`
+	AbnormalFlag    string     `json:"abnormal_flag,omitempty"`
+	Status          string     `json:"status,omitempty"`
+	ObservationTime *time.Time `json:"observation_time,omitempty"`
+}
+
+// Diagnosis is a diagnosis or a procedure.
+type Diagnosis struct {
+	Code *Code      `json:"code,omitempty"`
+	Type string     `json:"type,omitempty"`
+	Time *time.Time `json:"time,omitempty"`
+	// Clinician is the ID of the doctor who made the diagnosis or performed the procedure.
+	Clinician string `json:"clinician,omitempty"`
+}
+
+// NewSnapshot returns the snapshot of the given patient, tagged with the given tags.
+func NewSnapshot(p *ir.PatientInfo, tags Tags) Snapshot {
+	s := Snapshot{
+		Tags:          tags,
+		Class:         p.Class,
+		VisitID:       p.VisitID,
+		Location:      location(p.Location),
+		AdmissionTime: timePtr(p.AdmissionDate),
+		DischargeTime: timePtr(p.DischargeDate),
+	}
+	if p.Person != nil {
+		s.MRN = p.Person.MRN
+	}
+	for i, ec := range p.Encounters {
+		s.Encounters = append(s.Encounters, encounter(i+1, ec))
+	}
+	return s
+}
+
+func encounter(index int, ec *ir.Encounter) Encounter {
+	e := Encounter{
+		Index:      index,
+		Status:     ec.Status,
+		Pending:    ec.IsPending,
+		Start:      timePtr(ec.Start),
+		End:        timePtr(ec.End),
+		Diagnoses:  diagnoses(ec.Diagnoses),
+		Procedures: diagnoses(ec.Procedures),
+	}
+	for _, lh := range ec.LocationHistory {
+		l := location(lh.Location)
+		if l == nil {
+			l = &Location{}
+		}
+		l.Start = timePtr(lh.Start)
+		l.End = timePtr(lh.End)
+		e.Locations = append(e.Locations, *l)
+	}
+	for _, o := range ec.Orders {
+		e.Orders = append(e.Orders, order(o))
+	}
+	return e
+}
+
+func location(l *ir.PatientLocation) *Location {
+	if l == nil {
+		return nil
+	}
+	return &Location{
+		PointOfCare: l.Poc,
+		Room:        l.Room,
+		Bed:         l.Bed,
+		Facility:    l.Facility,
+		Building:    l.Building,
+		Floor:       l.Floor,
+		Type:        l.LocationType,
+	}
+}
+
+func order(o *ir.Order) Order {
+	order := Order{
+		Placer:        o.Placer,
+		Filler:        o.Filler,
+		Profile:       code(o.OrderProfile),
+		OrderControl:  o.OrderControl,
+		OrderStatus:   o.OrderStatus,
+		ResultsStatus: o.ResultsStatus,
+		OrderTime:     timePtr(o.OrderDateTime),
+		CollectedTime: timePtr(o.CollectedDateTime),
+		ReportedTime:  timePtr(o.ReportedDateTime),
+	}
+	for _, r := range o.Results {
+		order.Results = append(order.Results, Result{
+			Test:            code(r.TestName),
+			Value:           r.Value,
+			Unit:            r.Unit,
+			ValueType:       r.ValueType,
+			Range:           r.Range,
+			AbnormalFlag:    r.AbnormalFlag,
+			Status:          r.Status,
+			ObservationTime: timePtr(r.ObservationDateTime),
+		})
+	}
+	return order
+}
+
+func diagnoses(ds []*ir.DiagnosisOrProcedure) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, d := range ds {
+		diagnosis := Diagnosis{Code: code(d.Description), Type: d.Type, Time: timePtr(d.DateTime)}
+		if d.Clinician != nil {
+			diagnosis.Clinician = d.Clinician.ID
+		}
+		diagnoses = append(diagnoses, diagnosis)
+	}
+	return diagnoses
+}
+
+func code(ce *ir.CodedElement) *Code {
+	if ce == nil {
+		return nil
+	}
+	return &Code{ID: ce.ID, Text: ce.Text, CodingSystem: ce.CodingSystem}
+}
+
+func timePtr(t ir.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
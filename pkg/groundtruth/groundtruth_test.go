@@ -0,0 +1,136 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groundtruth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/ir"
+)
+
+var (
+	admitted    = time.Date(2020, 2, 12, 10, 0, 0, 0, time.UTC)
+	transferred = admitted.Add(time.Hour)
+	ordered     = admitted.Add(2 * time.Hour)
+	reported    = admitted.Add(3 * time.Hour)
+	discharged  = admitted.Add(4 * time.Hour)
+
+	tags = Tags{
+		PathwayName: "pathway",
+		StepIndex:   3,
+		StepType:    "Discharge",
+		EventTime:   discharged,
+		ControlIDs:  []string{"1", "2"},
+	}
+)
+
+func nullTime(t time.Time) ir.NullTime {
+	return ir.NullTime{Time: t, Valid: true}
+}
+
+func testPatient() *ir.PatientInfo {
+	ward := &ir.PatientLocation{Poc: "ED", Room: "Room-1", Bed: "Bed-1", Facility: "Simulated Hospital", LocationType: "BED"}
+	bay := &ir.PatientLocation{Poc: "Ward-1", Bed: "Bed-2"}
+	doctor := &ir.Doctor{ID: "C001"}
+	return &ir.PatientInfo{
+		Person:        &ir.Person{MRN: "1234"},
+		Class:         "INPATIENT",
+		VisitID:       5678,
+		Location:      bay,
+		AdmissionDate: nullTime(admitted),
+		DischargeDate: nullTime(discharged),
+		Encounters: []*ir.Encounter{{
+			Status: "finished",
+			Start:  nullTime(admitted),
+			End:    nullTime(discharged),
+			LocationHistory: []*ir.LocationHistory{
+				{Location: ward, Start: nullTime(admitted), End: nullTime(transferred)},
+				{Location: bay, Start: nullTime(transferred), End: nullTime(discharged)},
+			},
+			Orders: []*ir.Order{{
+				OrderProfile:     &ir.CodedElement{ID: "lpdc-3969", Text: "UREA AND ELECTROLYTES"},
+				Placer:           "placer-1",
+				Filler:           "filler-1",
+				OrderStatus:      "CM",
+				ResultsStatus:    "F",
+				OrderDateTime:    nullTime(ordered),
+				ReportedDateTime: nullTime(reported),
+				Results: []*ir.Result{{
+					TestName:            &ir.CodedElement{ID: "lpdc-2012", Text: "Creatinine"},
+					Value:               "52",
+					Unit:                "UMOLL",
+					ObservationDateTime: nullTime(reported),
+				}},
+			}},
+			Diagnoses:  []*ir.DiagnosisOrProcedure{{Description: &ir.CodedElement{ID: "A01.1", Text: "Paratyphoid Fever A", CodingSystem: "ICD-10"}, Type: "FINAL", Clinician: doctor, DateTime: nullTime(admitted)}},
+			Procedures: []*ir.DiagnosisOrProcedure{{Description: &ir.CodedElement{ID: "P1", Text: "Procedure"}, DateTime: nullTime(ordered)}},
+		}},
+	}
+}
+
+func timePtrOf(t time.Time) *time.Time {
+	return &t
+}
+
+func TestNewSnapshot(t *testing.T) {
+	want := Snapshot{
+		Tags:          tags,
+		MRN:           "1234",
+		Class:         "INPATIENT",
+		VisitID:       5678,
+		Location:      &Location{PointOfCare: "Ward-1", Bed: "Bed-2"},
+		AdmissionTime: timePtrOf(admitted),
+		DischargeTime: timePtrOf(discharged),
+		Encounters: []Encounter{{
+			Index:  1,
+			Status: "finished",
+			Start:  timePtrOf(admitted),
+			End:    timePtrOf(discharged),
+			Locations: []Location{
+				{PointOfCare: "ED", Room: "Room-1", Bed: "Bed-1", Facility: "Simulated Hospital", Type: "BED", Start: timePtrOf(admitted), End: timePtrOf(transferred)},
+				{PointOfCare: "Ward-1", Bed: "Bed-2", Start: timePtrOf(transferred), End: timePtrOf(discharged)},
+			},
+			Orders: []Order{{
+				Placer:        "placer-1",
+				Filler:        "filler-1",
+				Profile:       &Code{ID: "lpdc-3969", Text: "UREA AND ELECTROLYTES"},
+				OrderStatus:   "CM",
+				ResultsStatus: "F",
+				OrderTime:     timePtrOf(ordered),
+				ReportedTime:  timePtrOf(reported),
+				Results: []Result{{
+					Test:            &Code{ID: "lpdc-2012", Text: "Creatinine"},
+					Value:           "52",
+					Unit:            "UMOLL",
+					ObservationTime: timePtrOf(reported),
+				}},
+			}},
+			Diagnoses:  []Diagnosis{{Code: &Code{ID: "A01.1", Text: "Paratyphoid Fever A", CodingSystem: "ICD-10"}, Type: "FINAL", Time: timePtrOf(admitted), Clinician: "C001"}},
+			Procedures: []Diagnosis{{Code: &Code{ID: "P1", Text: "Procedure"}, Time: timePtrOf(ordered)}},
+		}},
+	}
+	if diff := cmp.Diff(want, NewSnapshot(testPatient(), tags)); diff != "" {
+		t.Errorf("NewSnapshot() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewSnapshot_Empty(t *testing.T) {
+	want := Snapshot{Tags: tags, MRN: "1234"}
+	if diff := cmp.Diff(want, NewSnapshot(&ir.PatientInfo{Person: &ir.Person{MRN: "1234"}}, tags)); diff != "" {
+		t.Errorf("NewSnapshot() got diff (-want +got):\n%s", diff)
+	}
+}
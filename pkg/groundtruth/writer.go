@@ -0,0 +1,263 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groundtruth
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Formats of the export.
+const (
+	// FormatJSON writes each snapshot as a line of JSON to the file JSONFile.
+	FormatJSON = "json"
+	// FormatCSV writes each entity of the snapshots to its own CSV file, e.g., the encounters to
+	// encounters.csv and the orders to orders.csv. Each row starts with the tags of the snapshot.
+	FormatCSV = "csv"
+)
+
+// JSONFile is the name of the file that snapshots are written to in the JSON format.
+const JSONFile = "snapshots.jsonl"
+
+// Writer writes snapshots.
+type Writer interface {
+	Write(Snapshot) error
+	Close() error
+}
+
+// NewWriter returns a writer that writes snapshots in the given format to files in dir.
+// The directory is created if it does not exist, and existing files are overwritten.
+func NewWriter(dir string, format string) (Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "cannot create the ground truth directory %s", dir)
+	}
+	switch format {
+	case FormatJSON:
+		f, err := os.Create(filepath.Join(dir, JSONFile))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create the ground truth file")
+		}
+		return &jsonWriter{f: f, enc: json.NewEncoder(f)}, nil
+	case FormatCSV:
+		return newCSVWriter(dir)
+	default:
+		return nil, errors.Errorf("unsupported ground truth format %q", format)
+	}
+}
+
+type jsonWriter struct {
+	// mu guards enc.
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// Write writes the snapshot as a line of JSON.
+func (w *jsonWriter) Write(s Snapshot) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Wrapf(w.enc.Encode(s), "cannot write the snapshot of patient %s", s.MRN)
+}
+
+// Close closes the file.
+func (w *jsonWriter) Close() error {
+	return w.f.Close()
+}
+
+// entity describes a CSV file: its name, its columns after the tag columns, and how to get its rows
+// from a snapshot.
+type entity struct {
+	file    string
+	columns []string
+	rows    func(Snapshot) [][]string
+}
+
+// tagColumns are the columns that all CSV files start with.
+var tagColumns = []string{"event_time", "pathway_name", "step_index", "step_type", "historical", "control_ids", "mrn"}
+
+var entities = []entity{{
+	file:    "patients.csv",
+	columns: []string{"class", "visit_id", "point_of_care", "room", "bed", "admission_time", "discharge_time"},
+	rows: func(s Snapshot) [][]string {
+		l := s.Location
+		if l == nil {
+			l = &Location{}
+		}
+		return [][]string{{s.Class, strconv.FormatUint(s.VisitID, 10), l.PointOfCare, l.Room, l.Bed, formatTime(s.AdmissionTime), formatTime(s.DischargeTime)}}
+	},
+}, {
+	file:    "encounters.csv",
+	columns: []string{"encounter", "status", "pending", "start", "end"},
+	rows: func(s Snapshot) [][]string {
+		var rows [][]string
+		for _, e := range s.Encounters {
+			rows = append(rows, []string{strconv.Itoa(e.Index), e.Status, strconv.FormatBool(e.Pending), formatTime(e.Start), formatTime(e.End)})
+		}
+		return rows
+	},
+}, {
+	file:    "locations.csv",
+	columns: []string{"encounter", "point_of_care", "room", "bed", "facility", "building", "floor", "type", "start", "end"},
+	rows: func(s Snapshot) [][]string {
+		var rows [][]string
+		for _, e := range s.Encounters {
+			for _, l := range e.Locations {
+				rows = append(rows, []string{strconv.Itoa(e.Index), l.PointOfCare, l.Room, l.Bed, l.Facility, l.Building, l.Floor, l.Type, formatTime(l.Start), formatTime(l.End)})
+			}
+		}
+		return rows
+	},
+}, {
+	file:    "orders.csv",
+	columns: []string{"encounter", "placer", "filler", "profile_id", "profile_text", "order_control", "order_status", "results_status", "order_time", "collected_time", "reported_time"},
+	rows: func(s Snapshot) [][]string {
+		var rows [][]string
+		for _, e := range s.Encounters {
+			for _, o := range e.Orders {
+				id, text, _ := codeColumns(o.Profile)
+				rows = append(rows, []string{strconv.Itoa(e.Index), o.Placer, o.Filler, id, text, o.OrderControl, o.OrderStatus, o.ResultsStatus, formatTime(o.OrderTime), formatTime(o.CollectedTime), formatTime(o.ReportedTime)})
+			}
+		}
+		return rows
+	},
+}, {
+	file:    "results.csv",
+	columns: []string{"encounter", "placer", "filler", "test_id", "test_text", "value", "unit", "value_type", "range", "abnormal_flag", "status", "observation_time"},
+	rows: func(s Snapshot) [][]string {
+		var rows [][]string
+		for _, e := range s.Encounters {
+			for _, o := range e.Orders {
+				for _, r := range o.Results {
+					id, text, _ := codeColumns(r.Test)
+					rows = append(rows, []string{strconv.Itoa(e.Index), o.Placer, o.Filler, id, text, r.Value, r.Unit, r.ValueType, r.Range, r.AbnormalFlag, r.Status, formatTime(r.ObservationTime)})
+				}
+			}
+		}
+		return rows
+	},
+}, {
+	file:    "diagnoses.csv",
+	columns: []string{"encounter", "kind", "code_id", "code_text", "coding_system", "type", "time", "clinician"},
+	rows: func(s Snapshot) [][]string {
+		var rows [][]string
+		for _, e := range s.Encounters {
+			for _, kind := range []struct {
+				name      string
+				diagnoses []Diagnosis
+			}{{"diagnosis", e.Diagnoses}, {"procedure", e.Procedures}} {
+				for _, d := range kind.diagnoses {
+					id, text, system := codeColumns(d.Code)
+					rows = append(rows, []string{strconv.Itoa(e.Index), kind.name, id, text, system, d.Type, formatTime(d.Time), d.Clinician})
+				}
+			}
+		}
+		return rows
+	},
+}}
+
+type csvWriter struct {
+	// mu guards the writers.
+	mu      sync.Mutex
+	files   []*os.File
+	writers []*csv.Writer
+}
+
+func newCSVWriter(dir string) (*csvWriter, error) {
+	w := &csvWriter{}
+	for _, e := range entities {
+		f, err := os.Create(filepath.Join(dir, e.file))
+		if err != nil {
+			w.Close()
+			return nil, errors.Wrap(err, "cannot create the ground truth file")
+		}
+		w.files = append(w.files, f)
+		cw := csv.NewWriter(f)
+		w.writers = append(w.writers, cw)
+		if err := cw.Write(append(append([]string{}, tagColumns...), e.columns...)); err != nil {
+			w.Close()
+			return nil, errors.Wrapf(err, "cannot write the header of %s", e.file)
+		}
+	}
+	return w, nil
+}
+
+// Write writes the rows of the snapshot to the file of each entity.
+func (w *csvWriter) Write(s Snapshot) error {
+	tags := []string{
+		formatTime(&s.EventTime),
+		s.PathwayName,
+		strconv.Itoa(s.StepIndex),
+		s.StepType,
+		strconv.FormatBool(s.Historical),
+		strings.Join(s.ControlIDs, ";"),
+		s.MRN,
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, e := range entities {
+		for _, row := range e.rows(s) {
+			if err := w.writers[i].Write(append(append([]string{}, tags...), row...)); err != nil {
+				return errors.Wrapf(err, "cannot write the snapshot of patient %s to %s", s.MRN, e.file)
+			}
+		}
+		// Flush after every snapshot so that the files can be read while the simulation runs.
+		w.writers[i].Flush()
+		if err := w.writers[i].Error(); err != nil {
+			return errors.Wrapf(err, "cannot write the snapshot of patient %s to %s", s.MRN, e.file)
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the files.
+func (w *csvWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var firstErr error
+	for _, cw := range w.writers {
+		cw.Flush()
+		if err := cw.Error(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, f := range w.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func codeColumns(c *Code) (id, text, system string) {
+	if c == nil {
+		return "", "", ""
+	}
+	return c.ID, c.Text, c.CodingSystem
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
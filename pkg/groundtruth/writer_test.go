@@ -0,0 +1,146 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groundtruth
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+func TestWriter_JSON(t *testing.T) {
+	dir := testwrite.TempDir(t)
+	w, err := NewWriter(dir, FormatJSON)
+	if err != nil {
+		t.Fatalf("NewWriter(%q, %q) failed with %v", dir, FormatJSON, err)
+	}
+	want := []Snapshot{NewSnapshot(testPatient(), tags), {Tags: tags, MRN: "5678"}}
+	for _, s := range want {
+		if err := w.Write(s); err != nil {
+			t.Fatalf("Write() failed with %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, JSONFile))
+	if err != nil {
+		t.Fatalf("ReadFile(%q) failed with %v", JSONFile, err)
+	}
+	var got []Snapshot
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var s Snapshot
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", line, err)
+		}
+		got = append(got, s)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("%s got diff (-want +got):\n%s", JSONFile, diff)
+	}
+}
+
+func TestWriter_CSV(t *testing.T) {
+	dir := testwrite.TempDir(t)
+	w, err := NewWriter(dir, FormatCSV)
+	if err != nil {
+		t.Fatalf("NewWriter(%q, %q) failed with %v", dir, FormatCSV, err)
+	}
+	if err := w.Write(NewSnapshot(testPatient(), tags)); err != nil {
+		t.Fatalf("Write() failed with %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+
+	header := []string{"event_time", "pathway_name", "step_index", "step_type", "historical", "control_ids", "mrn"}
+	tagValues := []string{"2020-02-12T14:00:00Z", "pathway", "3", "Discharge", "false", "1;2", "1234"}
+	row := func(values ...string) []string {
+		return append(append([]string{}, tagValues...), values...)
+	}
+	tests := []struct {
+		file string
+		want [][]string
+	}{{
+		file: "patients.csv",
+		want: [][]string{
+			append(header, "class", "visit_id", "point_of_care", "room", "bed", "admission_time", "discharge_time"),
+			row("INPATIENT", "5678", "Ward-1", "", "Bed-2", "2020-02-12T10:00:00Z", "2020-02-12T14:00:00Z"),
+		},
+	}, {
+		file: "encounters.csv",
+		want: [][]string{
+			append(header, "encounter", "status", "pending", "start", "end"),
+			row("1", "finished", "false", "2020-02-12T10:00:00Z", "2020-02-12T14:00:00Z"),
+		},
+	}, {
+		file: "locations.csv",
+		want: [][]string{
+			append(header, "encounter", "point_of_care", "room", "bed", "facility", "building", "floor", "type", "start", "end"),
+			row("1", "ED", "Room-1", "Bed-1", "Simulated Hospital", "", "", "BED", "2020-02-12T10:00:00Z", "2020-02-12T11:00:00Z"),
+			row("1", "Ward-1", "", "Bed-2", "", "", "", "", "2020-02-12T11:00:00Z", "2020-02-12T14:00:00Z"),
+		},
+	}, {
+		file: "orders.csv",
+		want: [][]string{
+			append(header, "encounter", "placer", "filler", "profile_id", "profile_text", "order_control", "order_status", "results_status", "order_time", "collected_time", "reported_time"),
+			row("1", "placer-1", "filler-1", "lpdc-3969", "UREA AND ELECTROLYTES", "", "CM", "F", "2020-02-12T12:00:00Z", "", "2020-02-12T13:00:00Z"),
+		},
+	}, {
+		file: "results.csv",
+		want: [][]string{
+			append(header, "encounter", "placer", "filler", "test_id", "test_text", "value", "unit", "value_type", "range", "abnormal_flag", "status", "observation_time"),
+			row("1", "placer-1", "filler-1", "lpdc-2012", "Creatinine", "52", "UMOLL", "", "", "", "", "2020-02-12T13:00:00Z"),
+		},
+	}, {
+		file: "diagnoses.csv",
+		want: [][]string{
+			append(header, "encounter", "kind", "code_id", "code_text", "coding_system", "type", "time", "clinician"),
+			row("1", "diagnosis", "A01.1", "Paratyphoid Fever A", "ICD-10", "FINAL", "2020-02-12T10:00:00Z", "C001"),
+			row("1", "procedure", "P1", "Procedure", "", "", "2020-02-12T12:00:00Z", ""),
+		},
+	}}
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join(dir, tc.file))
+			if err != nil {
+				t.Fatalf("os.Open(%q) failed with %v", tc.file, err)
+			}
+			defer f.Close()
+			got, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll() failed with %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s got diff (-want +got):\n%s", tc.file, diff)
+			}
+		})
+	}
+}
+
+func TestNewWriter_InvalidFormat(t *testing.T) {
+	dir := testwrite.TempDir(t)
+	if _, err := NewWriter(dir, "xml"); err == nil {
+		t.Errorf("NewWriter(%q, %q) got nil error, want error", dir, "xml")
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the segments that delimit files and batches in HL7 batch files,
+// defined in section 2.10.3 of the HL7 2.3 specification.
+const (
+	fileHeaderSegment   = "FHS"
+	fileTrailerSegment  = "FTS"
+	batchHeaderSegment  = "BHS"
+	batchTrailerSegment = "BTS"
+)
+
+// messageHeaderSegment is the name of the segment that starts each message.
+const messageHeaderSegment = "MSH"
+
+// batchTimeFormat is the format of the date/time fields in FHS-7 and BHS-7.
+const batchTimeFormat = "20060102150405"
+
+// BatchOptions contains the parameters of the batches written by a batch file sender.
+type BatchOptions struct {
+	// MaxMessages is the maximum number of messages in a batch.
+	// Zero means that there is no limit.
+	MaxMessages int
+	// Window is the maximum time between the start of a batch and the last message added to it.
+	// Zero means that there is no limit.
+	Window time.Duration
+	// SendingApplication is the value to set in FHS-3 and BHS-3.
+	SendingApplication string
+	// SendingFacility is the value to set in FHS-4 and BHS-4.
+	SendingFacility string
+	// ReceivingApplication is the value to set in FHS-5 and BHS-5.
+	ReceivingApplication string
+	// ReceivingFacility is the value to set in FHS-6 and BHS-6.
+	ReceivingFacility string
+	// Now returns the current time, which is used for the window and to set FHS-7 and BHS-7, e.g.,
+	// the time of the simulation. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// batchFileSender sends HL7 messages to an HL7 batch file.
+type batchFileSender struct {
+	file    *os.File
+	name    string
+	options BatchOptions
+	now     func() time.Time
+	// batches is the number of batches that have been started.
+	batches int
+	// inBatch is whether there is an open batch, i.e., one with a BHS segment but no BTS segment yet.
+	inBatch      bool
+	batchStart   time.Time
+	batchCount   int
+	messageCount int
+}
+
+// NewBatchFileSender creates a sender that sends HL7 messages to an HL7 batch file.
+// The file starts with an FHS segment and ends with an FTS segment with the number of batches,
+// which is written when the sender is closed. Messages are grouped in batches that start with a
+// BHS segment and end with a BTS segment with the number of messages in the batch. A new batch is
+// started when the current one reaches options.MaxMessages messages, or when options.Window has
+// elapsed since the current batch started, according to options.Now.
+func NewBatchFileSender(destFilename string, options BatchOptions) (Sender, error) {
+	if destFilename == "" {
+		return nil, errors.New("output filename must be nonempty if outputting to a batch file")
+	}
+	if options.MaxMessages < 0 || options.Window < 0 {
+		return nil, fmt.Errorf("invalid batch options %+v: MaxMessages and Window must not be negative", options)
+	}
+	now := options.Now
+	if now == nil {
+		now = time.Now
+	}
+	file, err := os.Create(destFilename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create output file %s", destFilename)
+	}
+	s := &batchFileSender{file: file, name: filepath.Base(destFilename), options: options, now: now}
+	if err := s.writeSegment(s.header(fileHeaderSegment, s.name)); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "cannot write the file header")
+	}
+	return s, nil
+}
+
+// header returns an FHS or BHS segment. Both segments have the same fields.
+func (s *batchFileSender) header(segment string, controlID string) string {
+	return strings.Join([]string{
+		segment,
+		`^~\&`,
+		s.options.SendingApplication,
+		s.options.SendingFacility,
+		s.options.ReceivingApplication,
+		s.options.ReceivingFacility,
+		s.now().Format(batchTimeFormat),
+		"",
+		s.name,
+		"",
+		controlID,
+	}, "|")
+}
+
+func (s *batchFileSender) writeSegment(segment string) error {
+	_, err := s.file.WriteString(segment + SegmentTerminatorStr)
+	return err
+}
+
+func (s *batchFileSender) startBatch() error {
+	s.batches++
+	if err := s.writeSegment(s.header(batchHeaderSegment, strconv.Itoa(s.batches))); err != nil {
+		return errors.Wrap(err, "cannot write a batch header")
+	}
+	s.inBatch = true
+	s.batchStart = s.now()
+	s.batchCount = 0
+	return nil
+}
+
+func (s *batchFileSender) endBatch() error {
+	if err := s.writeSegment(fmt.Sprintf("%s|%d", batchTrailerSegment, s.batchCount)); err != nil {
+		return errors.Wrap(err, "cannot write a batch trailer")
+	}
+	s.inBatch = false
+	return nil
+}
+
+func (s *batchFileSender) batchFull() bool {
+	if s.options.MaxMessages > 0 && s.batchCount >= s.options.MaxMessages {
+		return true
+	}
+	return s.options.Window > 0 && s.now().Sub(s.batchStart) >= s.options.Window
+}
+
+// Send adds a message to the current batch, starting a new batch if needed.
+func (s *batchFileSender) Send(message []byte) error {
+	if s.inBatch && s.batchFull() {
+		if err := s.endBatch(); err != nil {
+			return err
+		}
+	}
+	if !s.inBatch {
+		if err := s.startBatch(); err != nil {
+			return err
+		}
+	}
+	if !bytes.HasSuffix(message, []byte(SegmentTerminatorStr)) {
+		message = append(message[:len(message):len(message)], SegmentTerminator)
+	}
+	if _, err := s.file.Write(message); err != nil {
+		return errors.Wrap(err, "cannot write a message")
+	}
+	s.batchCount++
+	s.messageCount++
+	return nil
+}
+
+// Close writes the trailers of the current batch and the file, and closes the underlying file.
+// It should be called when the batchFileSender is not needed anymore or at the program exit.
+// Close prints the number of messages that have been sent.
+func (s *batchFileSender) Close() error {
+	log.Infof("Messages successfully sent by the batchFileSender: %d in %d batches", s.messageCount, s.batches)
+	if s.inBatch {
+		if err := s.endBatch(); err != nil {
+			s.file.Close()
+			return err
+		}
+	}
+	if err := s.writeSegment(fmt.Sprintf("%s|%d", fileTrailerSegment, s.batches)); err != nil {
+		s.file.Close()
+		return errors.Wrap(err, "cannot write the file trailer")
+	}
+	if err := s.file.Close(); err != nil {
+		return errors.Wrap(err, "closing batch file sender")
+	}
+	return nil
+}
+
+// BatchFile is the content of an HL7 batch file.
+type BatchFile struct {
+	// Header is the FHS segment, or nil if the file doesn't have one.
+	Header []byte
+	// Trailer is the FTS segment, or nil if the file doesn't have one.
+	Trailer []byte
+	// Batches are the batches in the file. Messages that are not enclosed in BHS and BTS segments
+	// are returned in a batch without Header or Trailer.
+	Batches []*Batch
+}
+
+// Batch is a batch of messages in an HL7 batch file.
+type Batch struct {
+	// Header is the BHS segment, or nil if the batch doesn't have one.
+	Header []byte
+	// Trailer is the BTS segment, or nil if the batch doesn't have one.
+	Trailer []byte
+	// Messages are the messages in the batch.
+	Messages []*BatchMessage
+}
+
+// BatchMessage is a message in an HL7 batch file.
+type BatchMessage struct {
+	// Index is the position of the message in the file, starting at 0.
+	Index int
+	// Raw is the message as found in the file, with segments terminated by SegmentTerminator.
+	Raw []byte
+	// Message is the parsed message, or nil if the message cannot be parsed.
+	Message *Message
+	// Err is the error returned when parsing the message, if any.
+	Err error
+}
+
+// Messages returns the messages in all the batches of the file, in order.
+func (f *BatchFile) Messages() []*BatchMessage {
+	var messages []*BatchMessage
+	for _, b := range f.Batches {
+		messages = append(messages, b.Messages...)
+	}
+	return messages
+}
+
+// ParseBatchFile splits an HL7 batch file into messages and parses them.
+// See ParseBatchFileWithOptions.
+func ParseBatchFile(input []byte) (*BatchFile, error) {
+	return ParseBatchFileWithOptions(input, NewParseMessageOptions())
+}
+
+// ParseBatchFileWithOptions splits an HL7 batch file into messages and parses them with the given
+// options. Segments can be terminated by \r, \n or \r\n, and empty lines are ignored, so files with
+// messages separated by blank lines can also be read. The FHS, BHS, BTS and FTS segments are optional.
+// Errors parsing individual messages are reported in BatchMessage.Err and don't stop the parsing of
+// the rest of the file. An error is returned only if the structure of the file is invalid, e.g., if
+// there are segments outside of messages or the counts in the trailers don't match the content.
+// options.SegmentTerminator is ignored.
+func ParseBatchFileWithOptions(input []byte, options *ParseMessageOptions) (*BatchFile, error) {
+	mo := *options
+	mo.SegmentTerminator = []byte{SegmentTerminator}
+	p := &batchParser{options: &mo, file: &BatchFile{}, separator: DefaultDelimiters.Field}
+	for i, segment := range splitLines(input) {
+		if err := p.add(segment); err != nil {
+			return nil, errors.Wrapf(err, "invalid batch file: segment %d", i+1)
+		}
+	}
+	if err := p.endFile(); err != nil {
+		return nil, errors.Wrap(err, "invalid batch file")
+	}
+	return p.file, nil
+}
+
+// splitLines splits the input in segments terminated by \r, \n or \r\n, and discards empty segments.
+func splitLines(input []byte) [][]byte {
+	fields := bytes.FieldsFunc(input, func(r rune) bool { return r == '\r' || r == '\n' })
+	segments := make([][]byte, 0, len(fields))
+	for _, f := range fields {
+		if len(bytes.TrimSpace(f)) > 0 {
+			segments = append(segments, f)
+		}
+	}
+	return segments
+}
+
+type batchParser struct {
+	options *ParseMessageOptions
+	file    *BatchFile
+	// batch is the batch being read, or nil if there isn't one.
+	batch *Batch
+	// message contains the segments of the message being read.
+	message [][]byte
+	// messages is the number of messages read so far.
+	messages int
+	// fileEnded is whether the FTS segment has been read.
+	fileEnded bool
+	// separator is the field separator declared by the last FHS, BHS or MSH segment read.
+	separator byte
+}
+
+func (p *batchParser) add(segment []byte) error {
+	if p.fileEnded {
+		return errors.New("segment found after the FTS segment")
+	}
+	switch {
+	case isHeaderSegment(segment, fileHeaderSegment):
+		if p.file.Header != nil || p.messages > 0 || p.message != nil || p.batch != nil {
+			return errors.New("unexpected FHS segment: it must be the first segment in the file")
+		}
+		p.file.Header = segment
+		p.separator = segment[len(fileHeaderSegment)]
+	case isHeaderSegment(segment, batchHeaderSegment):
+		if err := p.endBatch(); err != nil {
+			return err
+		}
+		p.batch = &Batch{Header: segment}
+		p.separator = segment[len(batchHeaderSegment)]
+	case isTrailerSegment(segment, batchTrailerSegment, p.separator):
+		if p.batch == nil || p.batch.Header == nil {
+			return errors.New("BTS segment without a BHS segment")
+		}
+		p.endMessage()
+		p.batch.Trailer = segment
+		return p.endBatch()
+	case isTrailerSegment(segment, fileTrailerSegment, p.separator):
+		if err := p.endBatch(); err != nil {
+			return err
+		}
+		p.file.Trailer = segment
+		p.fileEnded = true
+	case isHeaderSegment(segment, messageHeaderSegment):
+		p.endMessage()
+		p.message = [][]byte{segment}
+		p.separator = segment[len(messageHeaderSegment)]
+	default:
+		if p.message == nil {
+			return fmt.Errorf("segment %q outside of a message", segment)
+		}
+		p.message = append(p.message, segment)
+	}
+	return nil
+}
+
+// isHeaderSegment returns whether segment is an FHS, BHS or MSH segment with the given name.
+// Header segments declare the field separator in the character that follows their name, which
+// cannot be alphanumeric.
+func isHeaderSegment(segment []byte, name string) bool {
+	return len(segment) > len(name) && bytes.HasPrefix(segment, []byte(name)) && !isAlphanumeric(segment[len(name)])
+}
+
+// isTrailerSegment returns whether segment is an FTS or BTS segment with the given name, i.e., the
+// name followed by the field separator of the file, or only the name if the trailer has no fields.
+func isTrailerSegment(segment []byte, name string, separator byte) bool {
+	return bytes.HasPrefix(segment, []byte(name)) && (len(segment) == len(name) || segment[len(name)] == separator)
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// endMessage parses the message being read, if any, and adds it to the current batch.
+func (p *batchParser) endMessage() {
+	if p.message == nil {
+		return
+	}
+	raw := append(bytes.Join(p.message, []byte(SegmentTerminatorStr)), SegmentTerminator)
+	m := &BatchMessage{Index: p.messages, Raw: raw}
+	m.Message, m.Err = ParseMessageWithOptions(raw, p.options)
+	if m.Err != nil {
+		m.Message = nil
+	}
+	if p.batch == nil {
+		p.batch = &Batch{}
+	}
+	p.batch.Messages = append(p.batch.Messages, m)
+	p.messages++
+	p.message = nil
+}
+
+// endBatch finishes the current batch, if any, and checks its message count.
+func (p *batchParser) endBatch() error {
+	p.endMessage()
+	if p.batch == nil {
+		return nil
+	}
+	if err := checkCount(p.batch.Trailer, len(p.batch.Messages)); err != nil {
+		return errors.Wrapf(err, "invalid batch %d", len(p.file.Batches)+1)
+	}
+	p.file.Batches = append(p.file.Batches, p.batch)
+	p.batch = nil
+	return nil
+}
+
+func (p *batchParser) endFile() error {
+	if err := p.endBatch(); err != nil {
+		return err
+	}
+	return checkCount(p.file.Trailer, len(p.file.Batches))
+}
+
+// checkCount checks that the count in the first field of a BTS or FTS trailer matches the given count.
+// Missing trailers and empty counts are not checked.
+func checkCount(trailer []byte, count int) error {
+	// The field separator is the character that follows the segment name.
+	if len(trailer) <= 3 {
+		return nil
+	}
+	fields := bytes.Split(trailer, trailer[3:4])
+	if len(fields) < 2 || len(fields[1]) == 0 {
+		return nil
+	}
+	want, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return errors.Wrapf(err, "invalid count in trailer %q", trailer)
+	}
+	if want != count {
+		return fmt.Errorf("trailer %q has count %d, but found %d", trailer, want, count)
+	}
+	return nil
+}
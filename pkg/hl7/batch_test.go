@@ -0,0 +1,296 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+const (
+	batchMessage1 = "MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A01|1|T|2.3|||AL||44|ASCII\rPID|1||1234"
+	batchMessage2 = "MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A03|2|T|2.3|||AL||44|ASCII\rPID|1||5678"
+)
+
+func TestBatchFileSender(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	options := BatchOptions{
+		SendingApplication:   "SIMHOSP",
+		SendingFacility:      "SFAC",
+		ReceivingApplication: "RAPP",
+		ReceivingFacility:    "RFAC",
+	}
+	fileHeader := "FHS|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||output||output\r"
+	batchHeader := func(n string, ts string) string {
+		return "BHS|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|" + ts + "||output||" + n + "\r"
+	}
+
+	cases := []struct {
+		name        string
+		maxMessages int
+		window      time.Duration
+		// delays contains how long to wait before sending each message.
+		delays []time.Duration
+		want   string
+	}{{
+		name: "no messages",
+		want: fileHeader + "FTS|0\r",
+	}, {
+		name:   "single batch",
+		delays: []time.Duration{0, time.Minute, time.Minute},
+		want: fileHeader +
+			batchHeader("1", "20200101000000") + batchMessage1 + "\r" + batchMessage1 + "\r" + batchMessage1 + "\r" + "BTS|3\r" +
+			"FTS|1\r",
+	}, {
+		name:        "max messages",
+		maxMessages: 2,
+		delays:      []time.Duration{0, 0, 0},
+		want: fileHeader +
+			batchHeader("1", "20200101000000") + batchMessage1 + "\r" + batchMessage1 + "\r" + "BTS|2\r" +
+			batchHeader("2", "20200101000000") + batchMessage1 + "\r" + "BTS|1\r" +
+			"FTS|2\r",
+	}, {
+		name:   "window",
+		window: time.Hour,
+		delays: []time.Duration{0, 30 * time.Minute, 30 * time.Minute, time.Minute},
+		want: fileHeader +
+			batchHeader("1", "20200101000000") + batchMessage1 + "\r" + batchMessage1 + "\r" + "BTS|2\r" +
+			batchHeader("2", "20200101010000") + batchMessage1 + "\r" + batchMessage1 + "\r" + "BTS|2\r" +
+			"FTS|2\r",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := path.Join(testwrite.TempDir(t), "output")
+			now := start
+			opts := options
+			opts.MaxMessages = tc.maxMessages
+			opts.Window = tc.window
+			opts.Now = func() time.Time { return now }
+			s, err := NewBatchFileSender(filename, opts)
+			if err != nil {
+				t.Fatalf("NewBatchFileSender(%s, %+v) failed with %v", filename, opts, err)
+			}
+
+			for _, d := range tc.delays {
+				now = now.Add(d)
+				if err := s.Send([]byte(batchMessage1)); err != nil {
+					t.Fatalf("Send(%q) failed with %v", batchMessage1, err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close() failed with %v", err)
+			}
+			got, err := ioutil.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("ReadFile(%s) failed with %v", filename, err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("ReadFile(%s) got diff (-want +got):\n%s", filename, diff)
+			}
+		})
+	}
+}
+
+func TestNewBatchFileSender_Error(t *testing.T) {
+	filename := path.Join(testwrite.TempDir(t), "output")
+	cases := []struct {
+		name     string
+		filename string
+		options  BatchOptions
+	}{
+		{name: "empty filename", filename: ""},
+		{name: "negative max messages", filename: filename, options: BatchOptions{MaxMessages: -1}},
+		{name: "negative window", filename: filename, options: BatchOptions{Window: -time.Second}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewBatchFileSender(tc.filename, tc.options); err == nil {
+				t.Errorf("NewBatchFileSender(%q, %+v) got nil error, want error", tc.filename, tc.options)
+			}
+		})
+	}
+}
+
+func TestBatchFileSender_RoundTrip(t *testing.T) {
+	filename := path.Join(testwrite.TempDir(t), "output")
+	s, err := NewBatchFileSender(filename, BatchOptions{MaxMessages: 1})
+	if err != nil {
+		t.Fatalf("NewBatchFileSender(%s) failed with %v", filename, err)
+	}
+	for _, m := range []string{batchMessage1, batchMessage2} {
+		if err := s.Send([]byte(m)); err != nil {
+			t.Fatalf("Send(%q) failed with %v", m, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) failed with %v", filename, err)
+	}
+	f, err := ParseBatchFile(content)
+	if err != nil {
+		t.Fatalf("ParseBatchFile(%q) failed with %v", content, err)
+	}
+	if got, want := len(f.Batches), 2; got != want {
+		t.Errorf("ParseBatchFile(%q) got %d batches, want %d", content, got, want)
+	}
+	var got []string
+	for _, m := range f.Messages() {
+		if m.Err != nil {
+			t.Errorf("ParseBatchFile(%q) message %d got err %v, want nil", content, m.Index, m.Err)
+		}
+		got = append(got, strings.TrimSuffix(string(m.Raw), SegmentTerminatorStr))
+	}
+	if diff := cmp.Diff([]string{batchMessage1, batchMessage2}, got); diff != "" {
+		t.Errorf("ParseBatchFile(%q) got diff (-want +got):\n%s", content, diff)
+	}
+}
+
+func TestParseBatchFile(t *testing.T) {
+	m1 := strings.Replace(batchMessage1, "\r", "\n", -1)
+	m2 := strings.Replace(batchMessage2, "\r", "\r\n", -1)
+	hash1 := strings.Replace(batchMessage1, "|", "#", -1)
+
+	cases := []struct {
+		name  string
+		input string
+		// wantBatches contains the message control IDs of the messages in each batch.
+		wantBatches [][]string
+		wantHeader  bool
+		wantTrailer bool
+	}{{
+		name:        "file with batches",
+		input:       "FHS|^~\\&\rBHS|^~\\&\r" + batchMessage1 + "\rBTS|1\rBHS|^~\\&\r" + batchMessage2 + "\rBTS|1\rFTS|2\r",
+		wantBatches: [][]string{{"1"}, {"2"}},
+		wantHeader:  true,
+		wantTrailer: true,
+	}, {
+		name:        "newline separators and blank lines",
+		input:       "FHS|^~\\&\nBHS|^~\\&\n" + m1 + "\n\n" + m2 + "\r\n\r\nBTS|2\nFTS|1\n",
+		wantBatches: [][]string{{"1", "2"}},
+		wantHeader:  true,
+		wantTrailer: true,
+	}, {
+		name:        "messages without batch segments",
+		input:       batchMessage1 + "\n\n" + batchMessage2 + "\n\n",
+		wantBatches: [][]string{{"1", "2"}},
+	}, {
+		name:        "trailers without counts",
+		input:       "BHS|^~\\&\r" + batchMessage1 + "\rBTS\rFTS|\r",
+		wantBatches: [][]string{{"1"}},
+		wantTrailer: true,
+	}, {
+		name:        "custom field separator",
+		input:       "FHS#^~\\&\rBHS#^~\\&\r" + hash1 + "\rBTS#1\rFTS#1\r",
+		wantBatches: [][]string{{"1"}},
+		wantHeader:  true,
+		wantTrailer: true,
+	}, {
+		name:        "segments whose names start with the names of trailers",
+		input:       "BHS|^~\\&\r" + batchMessage1 + "\rBTSX|1\rBTS|1\r",
+		wantBatches: [][]string{{"1"}},
+	}, {
+		name:        "empty file",
+		input:       "FHS|^~\\&\rFTS|0\r",
+		wantHeader:  true,
+		wantTrailer: true,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ParseBatchFile([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("ParseBatchFile(%q) failed with %v", tc.input, err)
+			}
+			if got := f.Header != nil; got != tc.wantHeader {
+				t.Errorf("ParseBatchFile(%q) got header %q, want header? %t", tc.input, f.Header, tc.wantHeader)
+			}
+			if got := f.Trailer != nil; got != tc.wantTrailer {
+				t.Errorf("ParseBatchFile(%q) got trailer %q, want trailer? %t", tc.input, f.Trailer, tc.wantTrailer)
+			}
+			var got [][]string
+			for _, b := range f.Batches {
+				var ids []string
+				for _, m := range b.Messages {
+					if m.Err != nil {
+						t.Fatalf("ParseBatchFile(%q) message %d got err %v, want nil", tc.input, m.Index, m.Err)
+					}
+					msh, err := m.Message.MSH()
+					if err != nil {
+						t.Fatalf("MSH() failed with %v", err)
+					}
+					ids = append(ids, msh.MessageControlID.String())
+				}
+				got = append(got, ids)
+			}
+			if diff := cmp.Diff(tc.wantBatches, got); diff != "" {
+				t.Errorf("ParseBatchFile(%q) got diff (-want +got):\n%s", tc.input, diff)
+			}
+		})
+	}
+}
+
+func TestParseBatchFile_MessageErrors(t *testing.T) {
+	input := batchMessage1 + "\rMSH|\r" + batchMessage2 + "\r"
+	f, err := ParseBatchFile([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseBatchFile(%q) failed with %v", input, err)
+	}
+	messages := f.Messages()
+	if got, want := len(messages), 3; got != want {
+		t.Fatalf("ParseBatchFile(%q) got %d messages, want %d", input, got, want)
+	}
+	for i, wantErr := range []bool{false, true, false} {
+		m := messages[i]
+		if m.Index != i {
+			t.Errorf("messages[%d].Index got %d, want %d", i, m.Index, i)
+		}
+		if gotErr := m.Err != nil; gotErr != wantErr {
+			t.Errorf("messages[%d].Err got %v; want err? %t", i, m.Err, wantErr)
+		}
+		if gotMessage := m.Message != nil; gotMessage == wantErr {
+			t.Errorf("messages[%d].Message got %v; want message? %t", i, m.Message, !wantErr)
+		}
+	}
+}
+
+func TestParseBatchFile_Error(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{name: "segment outside of a message", input: "PID|1\r" + batchMessage1},
+		{name: "wrong batch count", input: "BHS|^~\\&\r" + batchMessage1 + "\rBTS|2\r"},
+		{name: "wrong file count", input: "FHS|^~\\&\rBHS|^~\\&\r" + batchMessage1 + "\rBTS|1\rFTS|3\r"},
+		{name: "invalid count", input: "BHS|^~\\&\r" + batchMessage1 + "\rBTS|one\r"},
+		{name: "BTS without BHS", input: batchMessage1 + "\rBTS|1\r"},
+		{name: "FHS after messages", input: batchMessage1 + "\rFHS|^~\\&\r"},
+		{name: "segments after FTS", input: "FHS|^~\\&\rFTS|0\r" + batchMessage1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseBatchFile([]byte(tc.input)); err == nil {
+				t.Errorf("ParseBatchFile(%q) got nil error, want error", tc.input)
+			}
+		})
+	}
+}
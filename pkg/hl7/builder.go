@@ -0,0 +1,235 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BuilderOptions contains optional parameters to NewBuilder.
+type BuilderOptions struct {
+	// Delimiters are the delimiters used in the messages, unless the MSH segment sets its own
+	// encoding characters. If nil, DefaultDelimiters is used.
+	Delimiters *Delimiters
+	// TimezoneLoc is the location that TS and DTM values are marshalled in. If nil, Location is used,
+	// or UTC if Location is not set.
+	TimezoneLoc *time.Location
+	// IncludeTimezone is whether TS values include the timezone offset.
+	IncludeTimezone bool
+	// Now returns the time used for MSH-7 Date/Time Of Message when it is not set.
+	// If nil, time.Now is used.
+	Now func() time.Time
+	// MessageControlID returns the value used for MSH-10 Message Control ID when it is not set.
+	// If nil, the builder generates incremental integer numbers starting with 1.
+	MessageControlID func() string
+	// MSH contains default values for the fields of the MSH segment, e.g., MSH-3 Sending Application.
+	// The fields of the MSH segment that is being built take precedence over these.
+	MSH *MSH
+}
+
+// Builder builds HL7v2 messages from the Go structs that represent segments and messages, e.g.,
+// *MSH, *PID or *ADT_A01, instead of concatenating strings.
+// Builder takes care of the delimiters and of escaping the values that contain them, and sets the
+// following fields of the MSH segment if they are not set:
+//
+//   - MSH-2 Encoding Characters: the encoding characters of the delimiters in BuilderOptions.
+//   - MSH-7 Date/Time Of Message: the current time, with a precision of seconds.
+//   - MSH-10 Message Control ID: see BuilderOptions.MessageControlID.
+//   - MSH-11 Processing ID: "T", for training.
+//   - MSH-12 Version ID: the version of the schema, see SchemaVersion.
+//
+// Segments that are not defined in the schema, e.g., Z-segments, can be built by defining a struct
+// with one pointer or slice field per HL7 field and a SegmentName method, like ZCM.
+// Builder is safe for concurrent use.
+type Builder struct {
+	opts BuilderOptions
+
+	mu     sync.Mutex
+	nextID uint64
+}
+
+// NewBuilder returns a new Builder with the given options, which can be nil.
+func NewBuilder(opts *BuilderOptions) *Builder {
+	b := &Builder{}
+	if opts != nil {
+		b.opts = *opts
+	}
+	if b.opts.Delimiters == nil {
+		b.opts.Delimiters = DefaultDelimiters
+	}
+	if b.opts.TimezoneLoc == nil {
+		b.opts.TimezoneLoc = Location
+	}
+	if b.opts.TimezoneLoc == nil {
+		b.opts.TimezoneLoc = time.UTC
+	}
+	if b.opts.Now == nil {
+		b.opts.Now = time.Now
+	}
+	if b.opts.MessageControlID == nil {
+		b.opts.MessageControlID = b.newMessageControlID
+	}
+	return b
+}
+
+// Build builds a message with the given MSH segment followed by the given segments, in order.
+// The MSH segment is not modified: the default values are set in a copy of it.
+// MSH-9 Message Type is required.
+func (b *Builder) Build(msh *MSH, segments ...Segment) ([]byte, error) {
+	if msh == nil {
+		return nil, errors.New("the MSH segment is required")
+	}
+	header, c, err := b.header(msh)
+	if err != nil {
+		return nil, err
+	}
+	if header.MessageType == nil {
+		return nil, errors.New("MSH-9 Message Type is required")
+	}
+	all := append([]Segment{header}, segments...)
+	for i, s := range all {
+		if s == nil || (reflect.ValueOf(s).Kind() == reflect.Ptr && reflect.ValueOf(s).IsNil()) {
+			return nil, fmt.Errorf("segment %d is nil", i)
+		}
+		if s.SegmentName() == "MSH" && i > 0 {
+			return nil, fmt.Errorf("segment %d is an MSH segment; only the first segment can be an MSH segment", i)
+		}
+	}
+	return MarshalSegments(all, c)
+}
+
+// BuildMessage builds a message from a message structure, e.g., *ADT_A01, whose MSH field must be
+// set. If MSH-9 Message Type is not set, it is derived from the name of the message structure, e.g.,
+// ADT^A01^ADT_A01. The message is not modified.
+func (b *Builder) BuildMessage(m MessageType) ([]byte, error) {
+	v := reflect.ValueOf(m)
+	if m == nil || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("invalid message %v: want a pointer to a message struct", m)
+	}
+	f := v.Elem().FieldByName("MSH")
+	if !f.IsValid() || f.Type() != reflect.TypeOf(&MSH{}) {
+		return nil, fmt.Errorf("message %s does not have an MSH segment", m.MessageTypeName())
+	}
+	if f.IsNil() {
+		return nil, fmt.Errorf("message %s: the MSH segment is required", m.MessageTypeName())
+	}
+	header, c, err := b.header(f.Interface().(*MSH))
+	if err != nil {
+		return nil, err
+	}
+	if header.MessageType == nil {
+		header.MessageType = messageTypeFromName(m.MessageTypeName())
+	}
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	cp.Elem().FieldByName("MSH").Set(reflect.ValueOf(header))
+	return MarshalMessage(cp.Interface().(MessageType), c)
+}
+
+// header returns a copy of msh with the default values set, and the context to marshal the message
+// with.
+func (b *Builder) header(msh *MSH) (*MSH, *Context, error) {
+	header := *msh
+	if defaults := b.opts.MSH; defaults != nil {
+		hv := reflect.ValueOf(&header).Elem()
+		dv := reflect.ValueOf(defaults).Elem()
+		for i := 0; i < hv.NumField(); i++ {
+			if hv.Field(i).IsNil() {
+				hv.Field(i).Set(dv.Field(i))
+			}
+		}
+	}
+	d := *b.opts.Delimiters
+	if header.EncodingCharacters != nil {
+		d.Component = header.EncodingCharacters.Component
+		d.Repetition = header.EncodingCharacters.Repetition
+		d.Escape = header.EncodingCharacters.Escape
+		d.Subcomponent = header.EncodingCharacters.Subcomponent
+	}
+	if err := d.validate(); err != nil {
+		return nil, nil, err
+	}
+	header.EncodingCharacters = &d
+	if header.DateTimeOfMessage == nil {
+		// MSH-7 is a TS in the schemas before 2.6 and a DTM afterwards.
+		setTime(reflect.ValueOf(&header.DateTimeOfMessage).Elem(), b.opts.Now(), SecondPrecision)
+	}
+	if header.MessageControlID == nil {
+		header.MessageControlID = NewST(ST(b.opts.MessageControlID()))
+	}
+	if header.ProcessingID == nil {
+		header.ProcessingID = &PT{ProcessingID: NewID("T")}
+	}
+	if header.VersionID == nil {
+		header.VersionID = &VID{VersionID: NewID(SchemaVersion)}
+	}
+	c := &Context{
+		Delimiters:      &d,
+		TimezoneLoc:     b.opts.TimezoneLoc,
+		IncludeTimezone: b.opts.IncludeTimezone,
+	}
+	return &header, c, nil
+}
+
+// setTime sets v, which is a *TS or *DTM, to a new value with the given time and precision.
+func setTime(v reflect.Value, t time.Time, precision TSPrecision) {
+	tv := reflect.New(v.Type().Elem())
+	tv.Elem().FieldByName("Time").Set(reflect.ValueOf(t))
+	tv.Elem().FieldByName("Precision").Set(reflect.ValueOf(precision))
+	v.Set(tv)
+}
+
+// newMessageControlID returns incremental integer numbers starting with 1.
+func (b *Builder) newMessageControlID() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	return strconv.FormatUint(b.nextID, 10)
+}
+
+// validate returns an error if the delimiters are not all different.
+func (d *Delimiters) validate() error {
+	all := []byte{d.Field, d.Component, d.Repetition, d.Escape, d.Subcomponent}
+	for i, x := range all {
+		if x == 0 || x == SegmentTerminator {
+			return fmt.Errorf("invalid delimiters %q", all)
+		}
+		for _, y := range all[i+1:] {
+			if x == y {
+				return fmt.Errorf("invalid delimiters %q: delimiters must be different", all)
+			}
+		}
+	}
+	return nil
+}
+
+// messageTypeFromName returns the MSH-9 Message Type for the given message structure name, e.g.,
+// ADT^A01^ADT_A01 for ADT_A01.
+func messageTypeFromName(name string) *MSG {
+	parts := strings.SplitN(name, "_", 2)
+	msg := &MSG{MessageCode: NewID(ID(parts[0]))}
+	if len(parts) == 2 {
+		msg.TriggerEvent = NewID(ID(parts[1]))
+		msg.MessageStructure = NewID(ID(name))
+	}
+	return msg
+}
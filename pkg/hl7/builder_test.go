@@ -0,0 +1,186 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var builderTime = time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+
+func testBuilder(opts *BuilderOptions) *Builder {
+	if opts == nil {
+		opts = &BuilderOptions{}
+	}
+	opts.TimezoneLoc = time.UTC
+	opts.Now = func() time.Time { return builderTime }
+	return NewBuilder(opts)
+}
+
+func TestBuilder_Build(t *testing.T) {
+	msh := &MSH{
+		SendingApplication: &HD{NamespaceID: NewIS("SIMHOSP")},
+		MessageType:        &MSG{MessageCode: NewID("ADT"), TriggerEvent: NewID("A01")},
+	}
+	pid := &PID{
+		SetIDPID:              &SI{Value: 1, Valid: true},
+		PatientIdentifierList: []CX{{IDNumber: NewST("1234"), AssigningAuthority: &HD{NamespaceID: NewIS("MRN")}}},
+		PatientName:           []XPN{{FamilyName: &FN{Surname: NewST("Smith & Sons")}, GivenName: NewST("John^Paul|Jr")}},
+	}
+	zcm := &ZCM{SetIDZCM: &SI{Value: 1, Valid: true}, OrderDiscipline: NewST(`RADIOLOGY\ONCOLOGY`)}
+
+	got, err := testBuilder(nil).Build(msh, pid, zcm)
+	if err != nil {
+		t.Fatalf("Build() failed with %v", err)
+	}
+	want := strings.Join([]string{
+		`MSH|^~\&|SIMHOSP||||20200101103000||ADT^A01|1|T|` + SchemaVersion,
+		`PID|1||1234^^^MRN||Smith \T\ Sons^John\S\Paul\F\Jr`,
+		`ZCM|1|RADIOLOGY\E\ONCOLOGY`,
+	}, SegmentTerminatorStr)
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Build() got diff (-want +got):\n%s", diff)
+	}
+	if msh.EncodingCharacters != nil || msh.MessageControlID != nil {
+		t.Errorf("Build() modified the MSH segment: %+v", msh)
+	}
+
+	m, err := ParseMessage(got)
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", got, err)
+	}
+	parsed, err := m.PID()
+	if err != nil {
+		t.Fatalf("PID() failed with %v", err)
+	}
+	if diff := cmp.Diff(pid.PatientName, parsed.PatientName); diff != "" {
+		t.Errorf("PID-5 got diff after parsing (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuilder_Build_Options(t *testing.T) {
+	b := testBuilder(&BuilderOptions{
+		Delimiters:       &Delimiters{Field: '#', Component: '*', Repetition: '@', Escape: '!', Subcomponent: '%'},
+		MessageControlID: func() string { return "control-id" },
+		MSH: &MSH{
+			SendingApplication: &HD{NamespaceID: NewIS("DEFAULT")},
+			ReceivingFacility:  &HD{NamespaceID: NewIS("RFAC")},
+			ProcessingID:       &PT{ProcessingID: NewID("P")},
+			VersionID:          &VID{VersionID: NewID("2.3")},
+		},
+	})
+	msh := &MSH{
+		SendingApplication: &HD{NamespaceID: NewIS("SIMHOSP")},
+		MessageType:        &MSG{MessageCode: NewID("ORU"), TriggerEvent: NewID("R01")},
+	}
+	nte := &NTE{Comment: []FT{"a#b*c"}}
+
+	got, err := b.Build(msh, nte)
+	if err != nil {
+		t.Fatalf("Build() failed with %v", err)
+	}
+	want := "MSH#*@!%#SIMHOSP###RFAC#20200101103000##ORU*R01#control-id#P#2.3\rNTE###a!F!b!S!c"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Build() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuilder_Build_MessageControlIDs(t *testing.T) {
+	b := testBuilder(nil)
+	msh := &MSH{MessageType: &MSG{MessageCode: NewID("ADT"), TriggerEvent: NewID("A01")}}
+	var got []string
+	for i := 0; i < 3; i++ {
+		message, err := b.Build(msh)
+		if err != nil {
+			t.Fatalf("Build() failed with %v", err)
+		}
+		got = append(got, strings.Split(string(message), "|")[9])
+	}
+	if diff := cmp.Diff([]string{"1", "2", "3"}, got); diff != "" {
+		t.Errorf("Build() message control IDs got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuilder_BuildMessage(t *testing.T) {
+	m := &ADT_A01{
+		MSH: &MSH{MessageControlID: NewST("1")},
+		EVN: &EVN{RecordedDateTime: &TS{Time: builderTime, Precision: MinutePrecision}},
+		PID: &PID{PatientName: []XPN{{GivenName: NewST("John")}}},
+		PV1: &PV1{PatientClass: NewIS("I")},
+	}
+	got, err := testBuilder(nil).BuildMessage(m)
+	if err != nil {
+		t.Fatalf("BuildMessage() failed with %v", err)
+	}
+	want := strings.Join([]string{
+		`MSH|^~\&|||||20200101103000||ADT^A01^ADT_A01|1|T|` + SchemaVersion,
+		`EVN||202001011030`,
+		`PID|||||^John`,
+		`PV1||I`,
+	}, SegmentTerminatorStr)
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("BuildMessage() got diff (-want +got):\n%s", diff)
+	}
+	if m.MSH.MessageType != nil {
+		t.Errorf("BuildMessage() modified the MSH segment: %+v", m.MSH)
+	}
+}
+
+func TestBuilder_Build_Errors(t *testing.T) {
+	adt := &MSG{MessageCode: NewID("ADT"), TriggerEvent: NewID("A01")}
+	cases := []struct {
+		name     string
+		msh      *MSH
+		segments []Segment
+	}{
+		{name: "no MSH"},
+		{name: "no message type", msh: &MSH{}},
+		{name: "nil segment", msh: &MSH{MessageType: adt}, segments: []Segment{(*PID)(nil)}},
+		{name: "second MSH", msh: &MSH{MessageType: adt}, segments: []Segment{&MSH{}}},
+		{
+			name: "repeated encoding characters",
+			msh:  &MSH{MessageType: adt, EncodingCharacters: &Delimiters{Component: '^', Repetition: '^', Escape: '\\', Subcomponent: '&'}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := testBuilder(nil).Build(tc.msh, tc.segments...); err == nil {
+				t.Errorf("Build() got %q, want error", got)
+			}
+		})
+	}
+}
+
+func TestSetTime(t *testing.T) {
+	// MSH-7 is a *TS or a *DTM depending on the schema.
+	var header struct {
+		TS  *TS
+		DTM *DTM
+	}
+	v := reflect.ValueOf(&header).Elem()
+	setTime(v.FieldByName("TS"), builderTime, SecondPrecision)
+	setTime(v.FieldByName("DTM"), builderTime, SecondPrecision)
+	if diff := cmp.Diff(&TS{Time: builderTime, Precision: SecondPrecision}, header.TS); diff != "" {
+		t.Errorf("setTime(*TS) got diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&DTM{Time: builderTime, Precision: SecondPrecision}, header.DTM); diff != "" {
+		t.Errorf("setTime(*DTM) got diff (-want +got):\n%s", diff)
+	}
+}
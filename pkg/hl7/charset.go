@@ -0,0 +1,183 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// charsetSwitch is a character set that the text of a field can switch to with a \Cxxyy\ or
+// \Mxxyyzz\ escape sequence.
+type charsetSwitch struct {
+	// enc is the encoding of the text after the escape sequence, or nil if the text is in the
+	// character set of the message.
+	enc encoding.Encoding
+	// iso2022 is whether enc is an ISO 2022 encoding that needs the escape sequence itself, e.g.,
+	// ESC $ B, to know which of its character sets the text is in.
+	iso2022 bool
+}
+
+// charsetSwitches maps the escape sequences that switch character sets, as defined in section 2.7.4
+// of the HL7 2.5 specification, to the character sets they switch to. The escape sequences contain
+// the hexadecimal representation of the ISO 2022 escape sequence without the ESC character.
+var charsetSwitches = map[string]charsetSwitch{
+	"C2842":   {},                                       // ISO-IR6 G0, ASCII.
+	"C2D41":   {enc: charmap.ISO8859_1},                 // ISO-IR100 G1, 8859/1.
+	"C2D42":   {enc: charmap.ISO8859_2},                 // ISO-IR101 G1, 8859/2.
+	"C2D43":   {enc: charmap.ISO8859_3},                 // ISO-IR109 G1, 8859/3.
+	"C2D44":   {enc: charmap.ISO8859_4},                 // ISO-IR110 G1, 8859/4.
+	"C2D4C":   {enc: charmap.ISO8859_5},                 // ISO-IR144 G1, 8859/5.
+	"C2D47":   {enc: charmap.ISO8859_6},                 // ISO-IR127 G1, 8859/6.
+	"C2D46":   {enc: charmap.ISO8859_7},                 // ISO-IR126 G1, 8859/7.
+	"C2D48":   {enc: charmap.ISO8859_8},                 // ISO-IR138 G1, 8859/8.
+	"C2D4D":   {enc: charmap.ISO8859_9},                 // ISO-IR148 G1, 8859/9.
+	"C284A":   {enc: japanese.ISO2022JP, iso2022: true}, // ISO-IR14 G0, JIS X 0201 Romaji.
+	"M2442":   {enc: japanese.ISO2022JP, iso2022: true}, // ISO-IR87 G0, JIS X 0208 Kanji.
+	"M242844": {enc: japanese.ISO2022JP, iso2022: true}, // ISO-IR159 G0, JIS X 0212 supplementary Kanji.
+}
+
+// IsCharacterSet returns whether name is a character set that can be used in MSH-18, e.g.,
+// "8859/1" or "UNICODE UTF-8".
+func IsCharacterSet(name string) bool {
+	_, ok := encodings[name]
+	return ok
+}
+
+// CanEncode returns whether the given UTF-8 text can be represented in the character set, e.g.,
+// "8859/1". Messages that declare ASCII are sent as they are, but only ASCII characters can be
+// represented in it.
+func CanEncode(characterSet string, text string) bool {
+	enc, ok := encodings[characterSet]
+	if !ok {
+		return false
+	}
+	if characterSet == "ASCII" {
+		for _, r := range text {
+			if r >= utf8.RuneSelf {
+				return false
+			}
+		}
+		return true
+	}
+	_, err := enc.NewEncoder().String(text)
+	return err == nil
+}
+
+// decodeText unescapes the text field src and decodes it into a UTF-8 string.
+// The text is decoded with c.Decoder, i.e., in the character set of the message, except for the
+// parts that follow an escape sequence that switches the character set, e.g., \C2D41\ or \M2442\,
+// which are decoded in the character set that the escape sequence switches to.
+func decodeText(src []byte, c *Context, isST bool) (string, error) {
+	var b strings.Builder
+	var current charsetSwitch
+	var iso2022Escape []byte
+	start := 0
+	decode := func(end int) error {
+		unescaped, err := UnescapeText(src[start:end], c.Delimiters, isST)
+		if err != nil {
+			return err
+		}
+		var decoded string
+		if current.enc == nil {
+			decoded, err = c.Decoder.String(string(unescaped))
+		} else {
+			decoded, err = current.enc.NewDecoder().String(string(append(iso2022Escape, unescaped...)))
+		}
+		if err != nil {
+			return err
+		}
+		b.WriteString(decoded)
+		return nil
+	}
+	for i := 0; i < len(src); i++ {
+		if src[i] != c.Delimiters.Escape {
+			continue
+		}
+		end := bytes.IndexByte(src[i+1:], c.Delimiters.Escape)
+		if end < 0 {
+			break
+		}
+		end += i + 1
+		sequence := strings.ToUpper(string(src[i+1 : end]))
+		if s, ok := charsetSwitches[sequence]; ok {
+			if err := decode(i); err != nil {
+				return "", err
+			}
+			current = s
+			iso2022Escape = nil
+			if s.iso2022 {
+				escape, err := hex.DecodeString(sequence[1:])
+				if err != nil {
+					// The keys of charsetSwitches are valid hexadecimal strings after the first character.
+					panic(err)
+				}
+				iso2022Escape = append([]byte{0x1b}, escape...)
+			}
+			start = end + 1
+		}
+		i = end
+	}
+	if err := decode(len(src)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// characterSet returns the first character set in the MSH-18 field of the given message, or an
+// empty string if the message doesn't declare any.
+func characterSet(message []byte) string {
+	if len(message) < 8 || !bytes.HasPrefix(message, []byte("MSH")) {
+		return ""
+	}
+	msh := message
+	if i := bytes.IndexAny(msh, SegmentTerminatorStr+"\n"); i >= 0 {
+		msh = msh[:i]
+	}
+	// The first element is the segment name and the second one is MSH-2, so MSH-18 is the 18th.
+	fields := bytes.Split(msh, msh[3:4])
+	if len(fields) < 18 {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.SplitN(fields[17], msh[5:6], 2)[0]))
+}
+
+// EncodeMessage encodes the given UTF-8 message in the character set declared in its MSH-18 field.
+// Messages that don't declare a character set, or that declare ASCII or Unicode, are not changed.
+// It returns an error if the character set is not supported, or if the message contains characters
+// that cannot be represented in it.
+func EncodeMessage(message []byte) ([]byte, error) {
+	cs := characterSet(message)
+	if cs == "" {
+		return message, nil
+	}
+	enc, ok := encodings[cs]
+	if !ok {
+		return nil, fmt.Errorf("bad character set: %q", cs)
+	}
+	encoded, err := enc.NewEncoder().Bytes(message)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot encode message in character set %q", cs)
+	}
+	return encoded, nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMessage_CharacterSetSwitches(t *testing.T) {
+	cases := []struct {
+		name      string
+		charset   string
+		givenName string
+		want      string
+	}{{
+		name:      "no switch",
+		charset:   "UNICODE UTF-8",
+		givenName: "José",
+		want:      "José",
+	}, {
+		name:      "8859/1 in a UTF-8 message",
+		charset:   "UNICODE UTF-8",
+		givenName: "\\C2D41\\Jos\xe9\\C2842\\ Luis",
+		want:      "José Luis",
+	}, {
+		name:      "8859/7 in an ASCII message",
+		charset:   "ASCII",
+		givenName: "\\C2D46\\\xc1\xe8\xde\xed\xe1",
+		want:      "Αθήνα",
+	}, {
+		name:      "8859/7 in an 8859/1 message",
+		charset:   "8859/1",
+		givenName: "Jos\xe9 \\C2D46\\\xc1\xe8\xde\xed\xe1\\C2842\\ Jos\xe9",
+		want:      "José Αθήνα José",
+	}, {
+		name:      "JIS X 0208",
+		charset:   "ASCII",
+		givenName: "\\M2442\\;3ED\\C2842\\ Taro",
+		want:      "山田 Taro",
+	}, {
+		name:      "lowercase escape sequence",
+		charset:   "ASCII",
+		givenName: "\\c2d41\\Jos\xe9",
+		want:      "José",
+	}, {
+		name:      "with other escape sequences",
+		charset:   "ASCII",
+		givenName: "\\C2D41\\Jos\xe9\\T\\Mar\xeda",
+		want:      "José&María",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			msh := []byte("MSH|^~\\&|||||||ADT^A01||T|2.3||||||" + tc.charset)
+			pid := []byte("PID|1||||Smith^" + tc.givenName + "|")
+			m, err := ParseMessage(bytes.Join([][]byte{msh, pid}, segmentTerminatorBytes))
+			if err != nil {
+				t.Fatalf("ParseMessage() failed with %v", err)
+			}
+			p, err := m.PID()
+			if err != nil {
+				t.Fatalf("PID() failed with %v", err)
+			}
+			if got := p.PatientName[0].GivenName.String(); got != tc.want {
+				t.Errorf("PID().PatientName[0].GivenName got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnescapeText_CharacterSetSwitches(t *testing.T) {
+	for _, isST := range []bool{true, false} {
+		got, err := UnescapeText([]byte(`\C2D41\abc\C2842\def\M2442\ghi`), DefaultDelimiters, isST)
+		if err != nil {
+			t.Fatalf("UnescapeText(isST=%t) failed with %v", isST, err)
+		}
+		if got, want := string(got), "abcdefghi"; got != want {
+			t.Errorf("UnescapeText(isST=%t) got %q, want %q", isST, got, want)
+		}
+	}
+}
+
+func TestCanEncode(t *testing.T) {
+	tests := []struct {
+		characterSet string
+		text         string
+		want         bool
+	}{
+		{characterSet: "ASCII", text: "Smith", want: true},
+		{characterSet: "ASCII", text: "Núñez", want: false},
+		{characterSet: "8859/1", text: "Núñez", want: true},
+		{characterSet: "8859/1", text: "Παπαδόπουλος", want: false},
+		{characterSet: "8859/7", text: "Παπαδόπουλος", want: true},
+		{characterSet: "UNICODE UTF-8", text: "Παπαδόπουλος", want: true},
+		{characterSet: "unknown", text: "Smith", want: false},
+	}
+	for _, tc := range tests {
+		if got := CanEncode(tc.characterSet, tc.text); got != tc.want {
+			t.Errorf("CanEncode(%q, %q) got %t, want %t", tc.characterSet, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{{
+		name: "no character set",
+		in:   "MSH|^~\\&|||||||ADT^A01||T|2.3\rPID|1||||Smith^José",
+		want: "MSH|^~\\&|||||||ADT^A01||T|2.3\rPID|1||||Smith^José",
+	}, {
+		name: "ASCII",
+		in:   "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|ASCII\rPID|1||||Smith^José",
+		want: "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|ASCII\rPID|1||||Smith^José",
+	}, {
+		name: "UTF-8",
+		in:   "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|UNICODE UTF-8\rPID|1||||Smith^José",
+		want: "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|UNICODE UTF-8\rPID|1||||Smith^José",
+	}, {
+		name: "8859/1",
+		in:   "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/1\rPID|1||||Smith^José",
+		want: "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/1\rPID|1||||Smith^Jos\xe9",
+	}, {
+		name: "repeated character set",
+		in:   "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/7~8859/1\rPID|1||||Smith^Αθήνα",
+		want: "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/7~8859/1\rPID|1||||Smith^\xc1\xe8\xde\xed\xe1",
+	}, {
+		name:    "character not in the character set",
+		in:      "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/1\rPID|1||||Smith^Αθήνα",
+		wantErr: true,
+	}, {
+		name:    "unknown character set",
+		in:      "MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|EBCDIC\rPID|1||||Smith^John",
+		wantErr: true,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EncodeMessage([]byte(tc.in))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("EncodeMessage(%q) got err=%v, want error? %t", tc.in, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("EncodeMessage(%q) got diff (-want +got):\n%s", tc.in, diff)
+			}
+		})
+	}
+}
+
+// listSender is a Sender that keeps the messages sent, or fails to send them if err is set.
+type listSender struct {
+	sent   [][]byte
+	err    error
+	closed bool
+}
+
+func (s *listSender) Send(message []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, message)
+	return nil
+}
+
+func (s *listSender) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestEncodingSender(t *testing.T) {
+	r := &listSender{}
+	s := NewEncodingSender(r)
+	valid := []byte("MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/1\rPID|1||||Smith^José")
+	if err := s.Send(valid); err != nil {
+		t.Errorf("Send(%q) failed with %v", valid, err)
+	}
+	invalid := []byte("MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/1\rPID|1||||Smith^Αθήνα")
+	if err := s.Send(invalid); err == nil {
+		t.Errorf("Send(%q) got err=<nil>, want error", invalid)
+	}
+	want := [][]byte{[]byte("MSH|^~\\&|||||||ADT^A01||T|2.3|||AL||44|8859/1\rPID|1||||Smith^Jos\xe9")}
+	if diff := cmp.Diff(want, r.sent); diff != "" {
+		t.Errorf("Send() sent messages diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// SegmentDefinition is the definition of a custom segment, e.g., a Z-segment, that is not defined
+// in Go code like ZCM.
+type SegmentDefinition struct {
+	// Name is the name of the segment, e.g., ZPI. Custom segments must start with Z.
+	Name string
+	// Fields are the fields of the segment, in order: the first one is <Name>-1.
+	Fields []FieldDefinition
+}
+
+// FieldDefinition is the definition of a field of a custom segment.
+type FieldDefinition struct {
+	// Name is the name of the field, e.g., "VIP Indicator".
+	Name string
+	// DataType is the HL7 data type of the field, e.g., ST or CE. It must be one of the data types
+	// used by the segments in the schema.
+	DataType string
+	// Required is whether the field is required.
+	Required bool
+	// Repeated is whether the field can repeat.
+	Repeated bool
+}
+
+var (
+	customSegmentNameRegex = regexp.MustCompile(`^Z[A-Z0-9]{2}$`)
+
+	// customSegments contains the definitions of the registered custom segments, by name.
+	customSegments = map[string]*SegmentDefinition{}
+
+	// dataTypes maps the names of the data types used in the schema to their types.
+	// Use schemaDataTypes to access it.
+	dataTypes     map[string]reflect.Type
+	dataTypesOnce sync.Once
+)
+
+// RegisterSegment adds a custom segment to the schema, so that it can be parsed like the segments
+// defined in Go code, e.g., with Message.Parse. The parsed segments are pointers to structs with one
+// field per field in the definition, in the same order.
+// Registering a segment with the name of a segment that was already registered with RegisterSegment
+// replaces it. Segments defined in Go code cannot be replaced.
+// RegisterSegment is not safe for concurrent use with the parsing of messages, so custom segments
+// should be registered at start-up.
+func RegisterSegment(d *SegmentDefinition) error {
+	if !customSegmentNameRegex.MatchString(d.Name) {
+		return fmt.Errorf("invalid custom segment name %q; custom segment names must be a Z followed by two letters or digits", d.Name)
+	}
+	if _, ok := Types[d.Name]; ok && customSegments[d.Name] == nil {
+		return fmt.Errorf("segment %s is already defined", d.Name)
+	}
+	if len(d.Fields) == 0 {
+		return fmt.Errorf("segment %s has no fields", d.Name)
+	}
+	types := schemaDataTypes()
+	fields := make([]reflect.StructField, len(d.Fields))
+	for i, f := range d.Fields {
+		location := fmt.Sprintf("%s-%d", d.Name, i+1)
+		if f.Name == "" {
+			return fmt.Errorf("field %s has no name", location)
+		}
+		t, ok := types[f.DataType]
+		if !ok {
+			return fmt.Errorf("field %s has unknown data type %q", location, f.DataType)
+		}
+		if f.Repeated {
+			t = reflect.SliceOf(t)
+		} else {
+			t = reflect.PtrTo(t)
+		}
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Field%d", i+1),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf(`hl7:"%t,%s"`, f.Required, f.Name)),
+		}
+	}
+	Types[d.Name] = reflect.StructOf(fields)
+	customSegments[d.Name] = d
+	return nil
+}
+
+// UnregisterSegment removes the custom segment with the given name, registered with
+// RegisterSegment, from the schema. It does nothing if no custom segment has that name.
+// Like RegisterSegment, UnregisterSegment is not safe for concurrent use with the parsing of
+// messages; it is meant for tests.
+func UnregisterSegment(name string) {
+	if _, ok := customSegments[name]; !ok {
+		return
+	}
+	delete(Types, name)
+	delete(customSegments, name)
+}
+
+// CustomSegment returns the definition of the custom segment with the given name, and whether the
+// segment has been registered with RegisterSegment.
+func CustomSegment(name string) (*SegmentDefinition, bool) {
+	d, ok := customSegments[name]
+	return d, ok
+}
+
+// schemaDataTypes returns the data types used by the segments in the schema, by name.
+func schemaDataTypes() map[string]reflect.Type {
+	dataTypesOnce.Do(func() {
+		dataTypes = map[string]reflect.Type{}
+		for _, t := range Types {
+			if t.Kind() == reflect.Struct && reflect.PtrTo(t).Implements(reflect.TypeOf((*Segment)(nil)).Elem()) {
+				addDataTypes(t, dataTypes)
+			}
+		}
+	})
+	return dataTypes
+}
+
+// addDataTypes adds the data types of the fields of t to types, recursively.
+func addDataTypes(t reflect.Type, types map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		if ft.Kind() == reflect.Slice && !reflect.PtrTo(ft).Implements(reflect.TypeOf((*Primitive)(nil)).Elem()) {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if _, ok := types[ft.Name()]; ok || ft.Name() == "" {
+			continue
+		}
+		types[ft.Name()] = ft
+		if isComposite(ft) {
+			addDataTypes(ft, types)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// registerSegment registers the custom segment d for the duration of the test.
+func registerSegment(t *testing.T, d *SegmentDefinition) {
+	t.Helper()
+	if err := RegisterSegment(d); err != nil {
+		t.Fatalf("RegisterSegment(%+v) failed with %v", d, err)
+	}
+	t.Cleanup(func() { UnregisterSegment(d.Name) })
+}
+
+var zpiDefinition = &SegmentDefinition{
+	Name: "ZPI",
+	Fields: []FieldDefinition{
+		{Name: "Set ID", DataType: "SI", Required: true},
+		{Name: "VIP Indicator", DataType: "CE"},
+		{Name: "Preferred Names", DataType: "XPN", Repeated: true},
+	},
+}
+
+func TestRegisterSegment_Parse(t *testing.T) {
+	registerSegment(t, zpiDefinition)
+
+	message := strings.Join([]string{
+		`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+		`ZPI|1|VIP^Very Important Person|Smith^John~Smith^Johnny`,
+	}, SegmentTerminatorStr)
+	m, err := ParseMessage([]byte(message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", message, err)
+	}
+	got, err := m.Parse("ZPI")
+	if err != nil {
+		t.Fatalf("Parse(ZPI) failed with %v", err)
+	}
+	v := reflect.ValueOf(got).Elem()
+	if got, want := v.NumField(), 3; got != want {
+		t.Fatalf("Parse(ZPI) got %d fields, want %d", got, want)
+	}
+	if got, want := *v.Field(0).Interface().(*SI), (SI{Value: 1, Valid: true}); got != want {
+		t.Errorf("ZPI-1 got %v, want %v", got, want)
+	}
+	if diff := cmp.Diff(&CE{Identifier: NewST("VIP"), Text: NewST("Very Important Person")}, v.Field(1).Interface()); diff != "" {
+		t.Errorf("ZPI-2 got diff (-want +got):\n%s", diff)
+	}
+	names := v.Field(2).Interface().([]XPN)
+	if got, want := len(names), 2; got != want {
+		t.Errorf("ZPI-3 got %d repetitions, want %d", got, want)
+	}
+}
+
+func TestRegisterSegment_ValidateAndConvert(t *testing.T) {
+	registerSegment(t, zpiDefinition)
+
+	message := strings.Join([]string{
+		`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+		`ZPI||VIP`,
+	}, SegmentTerminatorStr)
+	m, err := ParseMessage([]byte(message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", message, err)
+	}
+	var locations []string
+	for _, i := range Validate(m, nil) {
+		if i.Type == IssueMissingField {
+			locations = append(locations, i.Location)
+		}
+	}
+	if diff := cmp.Diff([]string{"ZPI-1"}, locations); diff != "" {
+		t.Errorf("Validate() missing fields got diff (-want +got):\n%s", diff)
+	}
+
+	doc, err := ToJSON(m)
+	if err != nil {
+		t.Fatalf("ToJSON() failed with %v", err)
+	}
+	if want := `"VIP Indicator": {`; !strings.Contains(string(doc), want) {
+		t.Errorf("ToJSON() got %s, want it to contain %s", doc, want)
+	}
+}
+
+func TestRegisterSegment_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		d    *SegmentDefinition
+	}{
+		{name: "not a Z-segment", d: &SegmentDefinition{Name: "XPI", Fields: []FieldDefinition{{Name: "A", DataType: "ST"}}}},
+		{name: "invalid name", d: &SegmentDefinition{Name: "Zpi", Fields: []FieldDefinition{{Name: "A", DataType: "ST"}}}},
+		{name: "segment defined in code", d: &SegmentDefinition{Name: "ZCM", Fields: []FieldDefinition{{Name: "A", DataType: "ST"}}}},
+		{name: "no fields", d: &SegmentDefinition{Name: "ZPI"}},
+		{name: "field without name", d: &SegmentDefinition{Name: "ZPI", Fields: []FieldDefinition{{DataType: "ST"}}}},
+		{name: "unknown data type", d: &SegmentDefinition{Name: "ZPI", Fields: []FieldDefinition{{Name: "A", DataType: "XYZ"}}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := RegisterSegment(tc.d); err == nil {
+				t.Errorf("RegisterSegment(%+v) got nil error, want error", tc.d)
+			}
+			if _, ok := CustomSegment(tc.d.Name); ok {
+				t.Errorf("CustomSegment(%q) got ok=true, want false", tc.d.Name)
+			}
+		})
+	}
+}
+
+func TestRegisterSegment_Replace(t *testing.T) {
+	registerSegment(t, zpiDefinition)
+	replacement := &SegmentDefinition{Name: "ZPI", Fields: []FieldDefinition{{Name: "Code", DataType: "ST"}}}
+	registerSegment(t, replacement)
+
+	got, ok := CustomSegment("ZPI")
+	if !ok {
+		t.Fatal("CustomSegment(ZPI) got ok=false, want true")
+	}
+	if diff := cmp.Diff(replacement, got); diff != "" {
+		t.Errorf("CustomSegment(ZPI) got diff (-want +got):\n%s", diff)
+	}
+	if got, want := Types["ZPI"].NumField(), 1; got != want {
+		t.Errorf("Types[ZPI].NumField() got %d, want %d", got, want)
+	}
+}
+
+func TestRegisterSegment_All(t *testing.T) {
+	registerSegment(t, zpiDefinition)
+
+	message := strings.Join([]string{
+		`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+		`ZPI|1|VIP^Very Important Person`,
+		`ZXX|1`,
+	}, SegmentTerminatorStr)
+	m, err := ParseMessage([]byte(message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", message, err)
+	}
+	segments, err := m.All()
+	if err != nil {
+		t.Fatalf("All() failed with %v", err)
+	}
+	if got, want := len(segments), 3; got != want {
+		t.Fatalf("All() got %d segments, want %d", got, want)
+	}
+	// Registered segments are parsed like the segments defined in Go code, and unregistered
+	// Z-segments are returned as they are.
+	if got, want := reflect.TypeOf(segments[1]), reflect.PtrTo(Types["ZPI"]); got != want {
+		t.Errorf("All() got segment of type %v for ZPI, want %v", got, want)
+	}
+	if _, ok := segments[2].(*GenericHL7Segment); !ok {
+		t.Errorf("All() got segment of type %T for ZXX, want *GenericHL7Segment", segments[2])
+	}
+}
+
+func TestUnregisterSegment(t *testing.T) {
+	if err := RegisterSegment(zpiDefinition); err != nil {
+		t.Fatalf("RegisterSegment(%+v) failed with %v", zpiDefinition, err)
+	}
+	UnregisterSegment("ZPI")
+	if _, ok := CustomSegment("ZPI"); ok {
+		t.Error("CustomSegment(ZPI) got ok=true, want false")
+	}
+	if _, ok := Types["ZPI"]; ok {
+		t.Error("Types[ZPI] is set, want unset")
+	}
+	// Segments defined in Go code cannot be unregistered.
+	UnregisterSegment("ZCM")
+	if _, ok := Types["ZCM"]; !ok {
+		t.Error("Types[ZCM] is unset, want set")
+	}
+}
@@ -37,8 +37,8 @@ func NewST(st ST) *ST {
 }
 
 // Marshal marshals the ST value.
-func (st *ST) Marshal(_ *Context) ([]byte, error) {
-	return []byte(string(*st)), nil
+func (st *ST) Marshal(c *Context) ([]byte, error) {
+	return marshalText([]byte(*st), c), nil
 }
 
 // Unmarshal unmarshals the ST value.
@@ -565,8 +565,8 @@ func NewTX(tx TX) *TX {
 }
 
 // Marshal marshals the TX value.
-func (tx *TX) Marshal(_ *Context) ([]byte, error) {
-	return []byte(string(*tx)), nil
+func (tx *TX) Marshal(c *Context) ([]byte, error) {
+	return marshalText([]byte(*tx), c), nil
 }
 
 // Unmarshal unmarshals the TX value.
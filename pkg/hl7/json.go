@@ -0,0 +1,640 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// This file converts HL7 messages to structured documents in JSON or YAML, and back.
+//
+// A document contains the list of segments of the message in order. Each segment is an object
+// with a single key, the segment name, whose value is an object with the fields of the segment,
+// keyed by the field names in the schema, e.g.:
+//
+//	{
+//	  "segments": [
+//	    {"MSH": {"Field Separator": "|", "Encoding Characters": "^~\\&", ...}},
+//	    {"PID": {"Patient Name": [{"Family Name": {"Surname": "Smith"}, "Given Name": "John"}], ...}},
+//	    ...
+//	  ]
+//	}
+//
+// Fields with composite data types are objects keyed by the component names in the schema.
+// Fields that can repeat, or that have more than one repetition, are lists. Empty fields and
+// components are omitted.
+// Fields that are not in the schema, e.g., the fields of Z-segments that are not defined, are
+// keyed by the segment name and the field number, e.g., "ZXX-1", and contain the value as it
+// appears in the message. Values that do not match their data type, e.g., with more components than
+// the data type defines, are also kept as they appear in the message.
+// Values are not unescaped: escape sequences such as \T\ appear as they do in the message.
+//
+// When converting a document back into an HL7 message, fields can also be keyed by the segment
+// name and the field number, and composite values can also be given as they would appear in the
+// message, e.g., "Smith^John". Trailing empty fields and components are not kept, so the
+// conversion from HL7 to a document and back returns the same message except for trailing
+// delimiters.
+
+const (
+	documentSegmentsKey = "segments"
+	fieldSeparatorName  = "Field Separator"
+	encodingCharsName   = "Encoding Characters"
+)
+
+var (
+	segmentNameRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]{2}$`)
+	fieldNumberRegex = regexp.MustCompile(`^([A-Z][A-Z0-9]{2})-([1-9][0-9]*)$`)
+)
+
+// ToJSON converts the message into an indented JSON document.
+func ToJSON(m *Message) ([]byte, error) {
+	d, err := toDocument(m)
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(d, "  ")
+}
+
+// ToYAML converts the message into a YAML document.
+func ToYAML(m *Message) ([]byte, error) {
+	d, err := toDocument(m)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(d.yaml())
+}
+
+// FromJSON converts a JSON document, as returned by ToJSON, into an HL7 message.
+// The segments of the message are separated by SegmentTerminator.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal JSON document")
+	}
+	return fromDocument(v)
+}
+
+// FromYAML converts a YAML document, as returned by ToYAML, into an HL7 message.
+// The segments of the message are separated by SegmentTerminator.
+func FromYAML(data []byte) ([]byte, error) {
+	var n yamlNode
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal YAML document")
+	}
+	return fromDocument(n.v)
+}
+
+// object is a JSON or YAML object whose keys are kept in order.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON marshals the object with its keys in order.
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := marshalJSON(m.key, "")
+		if err != nil {
+			return nil, err
+		}
+		v, err := marshalJSON(m.value, "")
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshalJSON marshals v without escaping HTML characters, which are common in HL7, e.g., the
+// subcomponent separator &.
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// yaml returns the object as a yaml.MapSlice, so that its keys are marshalled in order.
+func (o object) yaml() yaml.MapSlice {
+	s := make(yaml.MapSlice, len(o))
+	for i, m := range o {
+		s[i] = yaml.MapItem{Key: m.key, Value: toYAMLValue(m.value)}
+	}
+	return s
+}
+
+func toYAMLValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case object:
+		return v.yaml()
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = toYAMLValue(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// yamlNode is a YAML value where all scalars are decoded as strings as they appear in the document,
+// so that values such as 5.0 or 0001 are not changed when they are converted into HL7.
+type yamlNode struct {
+	v interface{}
+}
+
+// UnmarshalYAML unmarshals a YAML value.
+func (n *yamlNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		n.v = s
+		return nil
+	}
+	var l []yamlNode
+	if err := unmarshal(&l); err == nil {
+		values := make([]interface{}, len(l))
+		for i, e := range l {
+			values[i] = e.v
+		}
+		n.v = values
+		return nil
+	}
+	var m map[string]yamlNode
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+	values := make(map[string]interface{}, len(m))
+	for k, e := range m {
+		values[k] = e.v
+	}
+	n.v = values
+	return nil
+}
+
+// schemaField is a field of a segment or a component of a composite data type in the schema.
+type schemaField struct {
+	name string
+	// t is the type of the field; for fields that can repeat, the type of each repetition.
+	t        reflect.Type
+	repeated bool
+}
+
+// schemaFields returns the fields of the given segment or data type, or nil if t is nil.
+// The names of the fields that are empty or duplicated in the schema are left empty.
+func schemaFields(t reflect.Type) []schemaField {
+	if t == nil {
+		return nil
+	}
+	fields := make([]schemaField, t.NumField())
+	count := map[string]int{}
+	for i := range fields {
+		sf := t.Field(i)
+		name, _ := parseTag(sf)
+		count[name]++
+		ft := sf.Type
+		repeated := ft.Kind() == reflect.Slice
+		if repeated {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		fields[i] = schemaField{name: name, t: ft, repeated: repeated}
+	}
+	for i := range fields {
+		if count[fields[i].name] > 1 {
+			fields[i].name = ""
+		}
+	}
+	return fields
+}
+
+// isComposite returns whether t is a composite data type, i.e., a type whose values have components.
+func isComposite(t reflect.Type) bool {
+	primitive := reflect.TypeOf((*Primitive)(nil)).Elem()
+	return t != nil && t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(primitive)
+}
+
+// segmentType returns the type of the segment with the given name, or nil if the segment is not in
+// the schema.
+func segmentType(name string) reflect.Type {
+	if !isKnownSegment(name) {
+		return nil
+	}
+	return Types[name]
+}
+
+// fieldKey returns the key of a field in a document, given its index in the segment.
+func fieldKey(segment string, fields []schemaField, i int) string {
+	if i < len(fields) && fields[i].name != "" {
+		return fields[i].name
+	}
+	return fmt.Sprintf("%s-%d", segment, fieldNumber(segment, i))
+}
+
+// fieldNumber returns the HL7 number of a field given its index in the segment.
+// The first field of MSH is the field separator itself, so the fields of MSH start at MSH-2.
+func fieldNumber(segment string, i int) int {
+	if segment == "MSH" {
+		return i + 2
+	}
+	return i + 1
+}
+
+type document struct {
+	segments []interface{}
+}
+
+func (d *document) MarshalJSON() ([]byte, error) {
+	return object{{key: documentSegmentsKey, value: d.segments}}.MarshalJSON()
+}
+
+func (d *document) yaml() yaml.MapSlice {
+	return object{{key: documentSegmentsKey, value: d.segments}}.yaml()
+}
+
+func toDocument(m *Message) (*document, error) {
+	d := m.Delimiters
+	doc := &document{}
+	for _, s := range m.Segments {
+		if len(s.Value) == 0 {
+			continue
+		}
+		name, perr := segmentName(s, d)
+		if perr != nil {
+			return nil, perr
+		}
+		fields := schemaFields(segmentType(name))
+		var o object
+		if name == "MSH" {
+			o = append(o, member{key: fieldSeparatorName, value: string(d.Field)})
+		}
+		for i, f := range d.splitFields(s)[1:] {
+			if len(f.Value) == 0 {
+				continue
+			}
+			key := fieldKey(name, fields, i)
+			if name == "MSH" && i == 0 {
+				// The encoding characters include the repetition and component separators.
+				o = append(o, member{key: key, value: string(f.Value)})
+				continue
+			}
+			var sf schemaField
+			if i < len(fields) {
+				sf = fields[i]
+			}
+			o = append(o, member{key: key, value: fieldToDocument(f.Value, sf, d)})
+		}
+		doc.segments = append(doc.segments, object{{key: name, value: o}})
+	}
+	if len(doc.segments) == 0 {
+		return nil, errors.New("the message has no segments")
+	}
+	return doc, nil
+}
+
+func fieldToDocument(value []byte, sf schemaField, d *Delimiters) interface{} {
+	repetitions := bytes.Split(value, []byte{d.Repetition})
+	if len(repetitions) == 1 && !sf.repeated {
+		return valueToDocument(value, sf.t, d, 0)
+	}
+	l := make([]interface{}, len(repetitions))
+	for i, r := range repetitions {
+		l[i] = valueToDocument(r, sf.t, d, 0)
+	}
+	return l
+}
+
+// valueToDocument returns the value of a field or a component, of type t, at the given nesting
+// level: 0 for fields, 1 for components. Subcomponents are never split further.
+func valueToDocument(value []byte, t reflect.Type, d *Delimiters, nesting int) interface{} {
+	if !isComposite(t) || nesting > 1 {
+		return string(value)
+	}
+	separator := d.Component
+	if nesting == 1 {
+		separator = d.Subcomponent
+	}
+	components := bytes.Split(value, []byte{separator})
+	fields := schemaFields(t)
+	if len(components) > len(fields) {
+		return string(value)
+	}
+	var o object
+	for i, c := range components {
+		if len(c) == 0 {
+			continue
+		}
+		if fields[i].name == "" {
+			// The component cannot be keyed by name.
+			return string(value)
+		}
+		o = append(o, member{key: fields[i].name, value: valueToDocument(c, fields[i].t, d, nesting+1)})
+	}
+	if len(o) == 0 {
+		return string(value)
+	}
+	return o
+}
+
+func fromDocument(v interface{}) ([]byte, error) {
+	top, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the document must be an object")
+	}
+	for k := range top {
+		if k != documentSegmentsKey {
+			return nil, fmt.Errorf("unknown key %q in the document", k)
+		}
+	}
+	list, ok := top[documentSegmentsKey].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("the document must have a non-empty list of %q", documentSegmentsKey)
+	}
+	var d *Delimiters
+	segments := make([][]byte, len(list))
+	for i, s := range list {
+		name, fields, err := segmentFromDocument(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "segment %d", i)
+		}
+		if i == 0 {
+			if name != "MSH" {
+				return nil, fmt.Errorf("the first segment must be MSH, got %s", name)
+			}
+			if d, err = delimitersFromDocument(fields); err != nil {
+				return nil, errors.Wrap(err, "segment 0 (MSH)")
+			}
+		}
+		segment, err := encodeSegment(name, fields, d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "segment %d (%s)", i, name)
+		}
+		segments[i] = segment
+	}
+	return bytes.Join(segments, []byte{SegmentTerminator}), nil
+}
+
+// segmentFromDocument returns the name and fields of a segment in a document.
+func segmentFromDocument(v interface{}) (string, map[string]interface{}, error) {
+	o, ok := v.(map[string]interface{})
+	if !ok || len(o) != 1 {
+		return "", nil, errors.New("each segment must be an object with a single key, the segment name")
+	}
+	for name, f := range o {
+		if !segmentNameRegex.MatchString(name) {
+			return "", nil, fmt.Errorf("invalid segment name %q", name)
+		}
+		if f == nil {
+			return name, nil, nil
+		}
+		fields, ok := f.(map[string]interface{})
+		if !ok {
+			return "", nil, fmt.Errorf("the fields of segment %s must be an object", name)
+		}
+		return name, fields, nil
+	}
+	panic("unreachable")
+}
+
+// delimitersFromDocument returns the delimiters defined by the fields of the MSH segment.
+// If the field separator or the encoding characters are not set, the default ones are used.
+func delimitersFromDocument(fields map[string]interface{}) (*Delimiters, error) {
+	d := *DefaultDelimiters
+	fs, err := stringField(fields, fieldSeparatorName, "MSH-1")
+	if err != nil {
+		return nil, err
+	}
+	if fs != "" {
+		if len(fs) != 1 {
+			return nil, fmt.Errorf("invalid field separator %q", fs)
+		}
+		d.Field = fs[0]
+	}
+	ec, err := stringField(fields, encodingCharsName, "MSH-2")
+	if err != nil {
+		return nil, err
+	}
+	if ec != "" {
+		if len(ec) != 4 {
+			return nil, fmt.Errorf("invalid encoding characters %q", ec)
+		}
+		d.Component, d.Repetition, d.Escape, d.Subcomponent = ec[0], ec[1], ec[2], ec[3]
+	}
+	return &d, nil
+}
+
+// stringField returns the value of the field with any of the given keys, which must be a string,
+// or "" if it is not set.
+func stringField(fields map[string]interface{}, keys ...string) (string, error) {
+	for _, k := range keys {
+		v, ok := fields[k]
+		if !ok || v == nil {
+			continue
+		}
+		s, ok := scalar(v)
+		if !ok {
+			return "", fmt.Errorf("field %s must be a string", k)
+		}
+		return s, nil
+	}
+	return "", nil
+}
+
+func encodeSegment(name string, fields map[string]interface{}, d *Delimiters) ([]byte, error) {
+	schema := schemaFields(segmentType(name))
+	byName := map[string]int{}
+	for i, f := range schema {
+		if f.name != "" {
+			byName[f.name] = i
+		}
+	}
+	values := map[int][]byte{}
+	end := 0
+	// Iterate in order, so that errors are deterministic.
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name == "MSH" && (k == fieldSeparatorName || k == "MSH-1") {
+			continue
+		}
+		i, err := fieldIndex(name, k, byName)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := values[i]; ok {
+			return nil, fmt.Errorf("field %s-%d is set more than once", name, fieldNumber(name, i))
+		}
+		var sf schemaField
+		if i < len(schema) {
+			sf = schema[i]
+		}
+		var v []byte
+		if name == "MSH" && i == 0 {
+			v = d.encodingCharacters()
+		} else if v, err = encodeField(fields[k], sf, d); err != nil {
+			return nil, errors.Wrapf(err, "field %s", k)
+		}
+		values[i] = v
+		if len(v) > 0 && i+1 > end {
+			end = i + 1
+		}
+	}
+	if name == "MSH" {
+		// The encoding characters are always required.
+		values[0] = d.encodingCharacters()
+		if end == 0 {
+			end = 1
+		}
+	}
+	out := make([][]byte, end+1)
+	out[0] = []byte(name)
+	for i := 0; i < end; i++ {
+		out[i+1] = values[i]
+	}
+	return d.joinFields(out), nil
+}
+
+func (d *Delimiters) encodingCharacters() []byte {
+	return []byte{d.Component, d.Repetition, d.Escape, d.Subcomponent}
+}
+
+// fieldIndex returns the index within the segment of the field with the given key.
+func fieldIndex(segment string, key string, byName map[string]int) (int, error) {
+	if i, ok := byName[key]; ok {
+		return i, nil
+	}
+	match := fieldNumberRegex.FindStringSubmatch(key)
+	if match == nil || match[1] != segment {
+		return 0, fmt.Errorf("unknown field %q in segment %s", key, segment)
+	}
+	n, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid field %q", key)
+	}
+	i := n - 1
+	if segment == "MSH" {
+		i = n - 2
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("invalid field %q", key)
+	}
+	return i, nil
+}
+
+func encodeField(v interface{}, sf schemaField, d *Delimiters) ([]byte, error) {
+	l, ok := v.([]interface{})
+	if !ok {
+		return encodeValue(v, sf.t, d, 0)
+	}
+	repetitions := make([][]byte, len(l))
+	for i, r := range l {
+		var err error
+		if repetitions[i], err = encodeValue(r, sf.t, d, 0); err != nil {
+			return nil, errors.Wrapf(err, "repetition %d", i)
+		}
+	}
+	return d.joinRepeated(repetitions), nil
+}
+
+// encodeValue returns the HL7 representation of the value of a field or a component, of type t, at
+// the given nesting level.
+func encodeValue(v interface{}, t reflect.Type, d *Delimiters, nesting int) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if s, ok := scalar(v); ok {
+		return []byte(s), nil
+	}
+	o, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("values must be strings or objects")
+	}
+	if !isComposite(t) || nesting > 1 {
+		return nil, errors.New("the data type has no components; the value must be a string")
+	}
+	schema := schemaFields(t)
+	byName := map[string]int{}
+	for i, f := range schema {
+		if f.name != "" {
+			byName[f.name] = i
+		}
+	}
+	components := make([][]byte, len(schema))
+	end := 0
+	for k, c := range o {
+		i, ok := byName[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown component %q", k)
+		}
+		var err error
+		if components[i], err = encodeValue(c, schema[i].t, d, nesting+1); err != nil {
+			return nil, errors.Wrapf(err, "component %s", k)
+		}
+		if len(components[i]) > 0 && i+1 > end {
+			end = i + 1
+		}
+	}
+	if end == 0 {
+		return nil, nil
+	}
+	separator := d.Component
+	if nesting == 1 {
+		separator = d.Subcomponent
+	}
+	return bytes.Join(components[:end], []byte{separator}), nil
+}
+
+// scalar returns the string representation of v if it is a scalar value: a string or a number.
+func scalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var documentMessage = strings.Join([]string{
+	`MSH|^~\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A01|1|T|2.3|||AL||44|ASCII`,
+	`EVN|A01|20200101000000|||216865551019^Osman^Arthur^^^Dr^^^DRNBR^PRSNL^^^ORGDR`,
+	`PID|1|2590157853^^^SIMULATOR MRN^MRN|2590157853^^^SIMULATOR MRN^MRN~2478684691^^^NHSNMBR^NHSNMBR||Smith^John^^^Mr^^CURRENT||19800101|M|||1 Main St^^London^^N1 1AA^GBR^HOME||020 1234 5678^HOME|||||||||R^Other - Chinese^^^||||||||`,
+	`PD1|||FAMILY PRACTICE^^12345|`,
+	`PV1|1|I|RAL 12 West^Bay01^Bed01^Simulated Hospital^^BED^Main Building^5|28b|||216865551019^Osman^Arthur^^^Dr^^^DRNBR^PRSNL^^^ORGDR|||MED|||||||||2590157853^^^^visitid||||||||||||||||||||||ARRIVED|||20200101000000||`,
+	`OBX|1|NM|lpdc-2012^Creatinine^WinPath||0.8|mg/dL|0.6 - 1.2|N|||F|||20200101000000||`,
+	`NTE|0||Escaped \T\ value|`,
+	`ZCM|1|RADIOLOGY`,
+	`ZXX|first^component|second`,
+}, SegmentTerminatorStr)
+
+// trimTrailingDelimiters removes the trailing empty fields and components from each segment.
+func trimTrailingDelimiters(message string) string {
+	segments := strings.Split(message, SegmentTerminatorStr)
+	for i, s := range segments {
+		segments[i] = strings.TrimRight(s, "|^&~")
+	}
+	return strings.Join(segments, SegmentTerminatorStr)
+}
+
+func TestToJSON(t *testing.T) {
+	message := strings.Join([]string{
+		`MSH|^~\&|SIMHOSP|SFAC|||20200101000000||ADT^A01|1|T|2.3`,
+		`PID|1||1234^^^SIMULATOR MRN^MRN~5678||Smith^John||19800101|M`,
+		`ZXX|a^b`,
+	}, SegmentTerminatorStr)
+	m, err := ParseMessage([]byte(message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", message, err)
+	}
+	got, err := ToJSON(m)
+	if err != nil {
+		t.Fatalf("ToJSON() failed with %v", err)
+	}
+	want := `{
+  "segments": [
+    {
+      "MSH": {
+        "Field Separator": "|",
+        "Encoding Characters": "^~\\&",
+        "Sending Application": {
+          "Namespace ID": "SIMHOSP"
+        },
+        "Sending Facility": {
+          "Namespace ID": "SFAC"
+        },
+        "Date/Time Of Message": "20200101000000",
+        "Message Type": {
+          "Message Code": "ADT",
+          "Trigger Event": "A01"
+        },
+        "Message Control ID": "1",
+        "Processing ID": {
+          "Processing ID": "T"
+        },
+        "Version ID": {
+          "Version ID": "2.3"
+        }
+      }
+    },
+    {
+      "PID": {
+        "Set ID - PID": "1",
+        "Patient Identifier List": [
+          {
+            "ID Number": "1234",
+            "Assigning Authority": {
+              "Namespace ID": "SIMULATOR MRN"
+            },
+            "Identifier Type Code": "MRN"
+          },
+          {
+            "ID Number": "5678"
+          }
+        ],
+        "Patient Name": [
+          {
+            "Family Name": {
+              "Surname": "Smith"
+            },
+            "Given Name": "John"
+          }
+        ],
+        "Date/Time Of Birth": "19800101",
+        "Administrative Sex": "M"
+      }
+    },
+    {
+      "ZXX": {
+        "ZXX-1": "a^b"
+      }
+    }
+  ]
+}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("ToJSON() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		to   func(*Message) ([]byte, error)
+		from func([]byte) ([]byte, error)
+	}{
+		{name: "JSON", to: ToJSON, from: FromJSON},
+		{name: "YAML", to: ToYAML, from: FromYAML},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseMessage([]byte(documentMessage))
+			if err != nil {
+				t.Fatalf("ParseMessage(%q) failed with %v", documentMessage, err)
+			}
+			doc, err := tc.to(m)
+			if err != nil {
+				t.Fatalf("%s conversion failed with %v", tc.name, err)
+			}
+			got, err := tc.from(doc)
+			if err != nil {
+				t.Fatalf("%s conversion back from %s failed with %v", tc.name, doc, err)
+			}
+			if diff := cmp.Diff(trimTrailingDelimiters(documentMessage), string(got)); diff != "" {
+				t.Errorf("%s round trip got diff (-want +got):\n%s", tc.name, diff)
+			}
+		})
+	}
+}
+
+func TestRoundTrip_CustomDelimiters(t *testing.T) {
+	message := "MSH#*@!%#SIMHOSP####20200101000000##ADT*A01#1#T#2.3\rPID#1##1234*~*~SIMULATOR MRN%X@5678"
+	m, err := ParseMessage([]byte(message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", message, err)
+	}
+	doc, err := ToJSON(m)
+	if err != nil {
+		t.Fatalf("ToJSON() failed with %v", err)
+	}
+	got, err := FromJSON(doc)
+	if err != nil {
+		t.Fatalf("FromJSON(%s) failed with %v", doc, err)
+	}
+	if diff := cmp.Diff(message, string(got)); diff != "" {
+		t.Errorf("JSON round trip got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	doc := `{
+  "segments": [
+    {"MSH": {"MSH-9": "ADT^A01", "Message Control ID": 12, "Version ID": {"Version ID": "2.3"}}},
+    {"PID": {"PID-5": [{"Family Name": "Smith", "Given Name": "John"}, "Smith^Johnny"], "Administrative Sex": "M"}},
+    {"ZXX": {"ZXX-2": "value"}},
+    {"NTE": null}
+  ]
+}`
+	got, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatalf("FromJSON(%s) failed with %v", doc, err)
+	}
+	want := strings.Join([]string{
+		`MSH|^~\&|||||||ADT^A01|12||2.3`,
+		`PID|||||Smith^John~Smith^Johnny|||M`,
+		`ZXX||value`,
+		`NTE`,
+	}, SegmentTerminatorStr)
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("FromJSON(%s) got diff (-want +got):\n%s", doc, diff)
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	doc := `
+segments:
+- MSH:
+    Message Type: {Message Code: ADT, Trigger Event: A01}
+    Version ID: {Version ID: 2.30}
+- OBX:
+    Set ID - OBX: 1
+    Observation Value: [5.0]
+    Observation Result Status: F`
+	got, err := FromYAML([]byte(doc))
+	if err != nil {
+		t.Fatalf("FromYAML(%s) failed with %v", doc, err)
+	}
+	want := "MSH|^~\\&|||||||ADT^A01|||2.30\rOBX|1||||5.0||||||F"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("FromYAML(%s) got diff (-want +got):\n%s", doc, diff)
+	}
+}
+
+func TestFromJSON_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		doc  string
+	}{
+		{name: "not JSON", doc: `MSH|^~\&|`},
+		{name: "not an object", doc: `[]`},
+		{name: "unknown key", doc: `{"segments": [{"MSH": {}}], "other": 1}`},
+		{name: "no segments", doc: `{"segments": []}`},
+		{name: "first segment is not MSH", doc: `{"segments": [{"PID": {}}]}`},
+		{name: "segment with several keys", doc: `{"segments": [{"MSH": {}, "PID": {}}]}`},
+		{name: "invalid segment name", doc: `{"segments": [{"MSH": {}}, {"pid": {}}]}`},
+		{name: "unknown field", doc: `{"segments": [{"MSH": {}}, {"PID": {"Unknown": "1"}}]}`},
+		{name: "field number of another segment", doc: `{"segments": [{"MSH": {}}, {"PID": {"PV1-2": "1"}}]}`},
+		{name: "field set twice", doc: `{"segments": [{"MSH": {}}, {"PID": {"PID-8": "M", "Administrative Sex": "F"}}]}`},
+		{name: "unknown component", doc: `{"segments": [{"MSH": {}}, {"PID": {"Patient Name": {"Unknown": "1"}}}]}`},
+		{name: "components of a primitive type", doc: `{"segments": [{"MSH": {}}, {"PID": {"Administrative Sex": {"Code": "M"}}}]}`},
+		{name: "boolean value", doc: `{"segments": [{"MSH": {}}, {"PID": {"Administrative Sex": true}}]}`},
+		{name: "invalid encoding characters", doc: `{"segments": [{"MSH": {"Encoding Characters": "^~"}}]}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := FromJSON([]byte(tc.doc)); err == nil {
+				t.Errorf("FromJSON(%s) got %q, want error", tc.doc, got)
+			}
+		})
+	}
+}
+
+func TestToJSON_IsValidJSON(t *testing.T) {
+	m, err := ParseMessage([]byte(documentMessage))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", documentMessage, err)
+	}
+	got, err := ToJSON(m)
+	if err != nil {
+		t.Fatalf("ToJSON() failed with %v", err)
+	}
+	if !json.Valid(got) {
+		t.Errorf("ToJSON() got invalid JSON %s", got)
+	}
+}
@@ -176,6 +176,9 @@ type ParseMessageOptions struct {
 	SegmentTerminator []byte
 	Rewrites          *[]Rewrite
 	AllowNullHeader   bool
+	// Strict makes ParseMessageV2WithOptions return an error if any segment cannot be parsed.
+	// If not set, such segments are skipped and reported instead. ParseMessageWithOptions ignores it.
+	Strict bool
 }
 
 // NewParseMessageOptions returns a ParseMessageOptions, which can be used to
@@ -738,31 +741,16 @@ func (m *Message) All() ([]interface{}, error) {
 		if len(s.Value) == 0 {
 			continue
 		}
-		name, pe := segmentName(s, m.Context.Delimiters)
-		if pe != nil {
-			errs = append(errs, *pe)
-			continue
-		}
-		if strings.HasPrefix(name, "Z") {
-			v = append(v, &GenericHL7Segment{s.Value})
-			continue
-		}
-		t, ok := Types[name]
-		if !ok {
-			errs = append(errs, *s.Error(&BadSegmentError{name}))
-			continue
-		}
-		ps := reflect.New(t)
-		rwRes, err := parseSegmentValue(s, m.Context, ps.Elem())
+		segment, err := m.parseToken(s)
 		if err != nil {
-			if perr, ok := err.(ParseErrors); ok {
-				errs = append(errs, perr...)
-			} else {
+			perr, ok := err.(ParseErrors)
+			if !ok {
 				return nil, err
 			}
+			errs = append(errs, perr...)
 		}
-		if rwRes.action != deleteToken {
-			v = append(v, ps.Interface())
+		if segment != nil {
+			v = append(v, segment)
 		}
 	}
 	if len(errs) > 0 {
@@ -771,6 +759,36 @@ func (m *Message) All() ([]interface{}, error) {
 	return v, nil
 }
 
+// parseToken parses the segment in s. It returns a nil segment if the segment was deleted by a
+// rewrite, or if it cannot be parsed because its name is not valid or its type is unknown.
+// If some fields cannot be parsed, it returns the partially parsed segment along with ParseErrors.
+// Z-segments are returned as GenericHL7Segment, unless they have been registered with
+// RegisterSegment.
+func (m *Message) parseToken(s Token) (interface{}, error) {
+	name, pe := segmentName(s, m.Context.Delimiters)
+	if pe != nil {
+		return nil, ParseErrors{*pe}
+	}
+	if _, custom := CustomSegment(name); strings.HasPrefix(name, "Z") && !custom {
+		return &GenericHL7Segment{s.Value}, nil
+	}
+	t, ok := Types[name]
+	if !ok {
+		return nil, s.Errors(&BadSegmentError{name})
+	}
+	ps := reflect.New(t)
+	rwRes, err := parseSegmentValue(s, m.Context, ps.Elem())
+	if err != nil {
+		if _, ok := err.(ParseErrors); !ok {
+			return nil, err
+		}
+	}
+	if rwRes.action == deleteToken {
+		return nil, err
+	}
+	return ps.Interface(), err
+}
+
 // endOfFieldsWithValues returns the index of the last field within v for which
 // that and all subsequent fields have a nil value.
 func endOfFieldsWithValues(v reflect.Value) int {
@@ -942,35 +960,32 @@ func parseText(field []byte, c *Context, isST bool) (string, error) {
 	if c.Decoder == nil {
 		panic("nil decoder")
 	}
-	unescaped, err := UnescapeText(field, c.Delimiters, isST)
-	if err != nil {
-		return "", err
-	}
-	decoded, err := c.Decoder.String(string(unescaped))
-	if err != nil {
-		return "", err
-	}
-	return decoded, nil
+	return decodeText(field, c, isST)
 }
 
 // marshalText marshals a text field.
 // The returned slice will contain escaped characters.
 func marshalText(field []byte, c *Context) []byte {
 	dst := make([]byte, 0, len(field))
+	escape := func(sequence string) {
+		dst = append(dst, c.Delimiters.Escape)
+		dst = append(dst, sequence...)
+		dst = append(dst, c.Delimiters.Escape)
+	}
 	for _, b := range field {
 		switch b {
 		case c.Delimiters.Field:
-			dst = append(dst, []byte("\\F\\")...)
+			escape("F")
 		case c.Delimiters.Component:
-			dst = append(dst, []byte("\\S\\")...)
+			escape("S")
 		case c.Delimiters.Subcomponent:
-			dst = append(dst, []byte("\\T\\")...)
+			escape("T")
 		case c.Delimiters.Repetition:
-			dst = append(dst, []byte("\\R\\")...)
+			escape("R")
 		case c.Delimiters.Escape:
-			dst = append(dst, []byte("\\E\\")...)
+			escape("E")
 		case asciiNewLine:
-			dst = append(dst, []byte("\\.br\\")...)
+			escape(".br")
 		default:
 			dst = append(dst, b)
 		}
@@ -20,28 +20,91 @@ import (
 )
 
 // ParseMessageV2 parses a message, and returns a V2 type.
-// TODO: Support Rewriting.
+// It returns an error if any segment cannot be parsed. Segments that cannot be placed in the
+// structure of the message type are discarded.
 func ParseMessageV2(input []byte) (interface{}, error) {
-	m, err := ParseMessage(input)
+	options := NewParseMessageOptions()
+	options.Strict = true
+	m, _, err := ParseMessageV2WithOptions(input, options)
+	return m, err
+}
+
+// ParseReport describes the segments that ParseMessageV2WithOptions did not place in the message.
+type ParseReport struct {
+	// Skipped are the segments that could not be parsed, for instance because their type is
+	// unknown or some of their fields are not valid.
+	Skipped []SkippedSegment
+	// Unplaced are the segments that were parsed but could not be placed in the structure of the
+	// message type, for instance because they are out of order or are Z-segments.
+	Unplaced []SkippedSegment
+}
+
+// SkippedSegment is a segment that was not placed in the message.
+type SkippedSegment struct {
+	// Index is the position of the segment in the message, starting at 0.
+	Index int
+	// Name is the name of the segment, e.g., "OBX", or empty if the segment has no valid name.
+	Name string
+	// Err is the reason why the segment could not be parsed. It is nil for unplaced segments.
+	Err error
+}
+
+// ParseMessageV2WithOptions parses a message with the given options, and returns a V2 type and a
+// report of the segments that were not placed in it.
+// The rewrites and the timezone in options are applied as in ParseMessageWithOptions.
+// If options.Strict is set, an error is returned if any segment cannot be parsed; otherwise, such
+// segments are skipped and added to the report.
+func ParseMessageV2WithOptions(input []byte, options *ParseMessageOptions) (interface{}, *ParseReport, error) {
+	m, err := ParseMessageWithOptions(input, options)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	name, err := m.messageTypeName()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	t, ok := Types[name+"v2"]
 	if !ok {
-		return nil, &BadMessageTypeError{Name: name}
+		return nil, nil, &BadMessageTypeError{Name: name}
 	}
-	segments, err := m.All()
-	if err != nil {
-		return nil, err
+
+	report := &ParseReport{}
+	var segments []interface{}
+	// positions contains the index and name of each parsed segment, to report unplaced segments.
+	positions := make(map[interface{}]SkippedSegment)
+	errs := ParseErrors{}
+	for i, s := range m.Segments {
+		if len(s.Value) == 0 {
+			continue
+		}
+		name, _ := segmentName(s, m.Context.Delimiters)
+		segment, err := m.parseToken(s)
+		if err != nil {
+			perr, ok := err.(ParseErrors)
+			if !ok {
+				return nil, nil, err
+			}
+			errs = append(errs, perr...)
+			report.Skipped = append(report.Skipped, SkippedSegment{Index: i, Name: name, Err: err})
+			continue
+		}
+		if segment != nil {
+			segments = append(segments, segment)
+			positions[segment] = SkippedSegment{Index: i, Name: name}
+		}
+	}
+	if options.Strict && len(errs) > 0 {
+		return nil, nil, errs
 	}
 
 	result := reflect.New(t)
-	fillGroup(result, segments)
-	return result.Interface(), nil
+	unplaced := func(segment interface{}) {
+		report.Unplaced = append(report.Unplaced, positions[segment])
+	}
+	for _, segment := range fillGroup(result, segments, unplaced) {
+		unplaced(segment)
+	}
+	return result.Interface(), report, nil
 }
 
 // fillGroup takes an empty struct representing a group of HL7 segments, g, and
@@ -51,10 +114,10 @@ func ParseMessageV2(input []byte) (interface{}, error) {
 // doesn't match the current field, we consult the follow set for that field
 // to decide whether that segment can be assigned to a following field - in
 // which case, the current field is skipped, as the segment eventually assigned.
-// If the segment can't be assigned to any following field, it's discarded.
+// If the segment can't be assigned to any following field, it's discarded, and
+// passed to discard.
 // TODO: Return an error if required segments are missing
-// TODO: Communicate skipped segments to the caller
-func fillGroup(g reflect.Value, segments []interface{}) []interface{} {
+func fillGroup(g reflect.Value, segments []interface{}, discard func(interface{})) []interface{} {
 	g = g.Elem()
 	for i := 0; i < g.NumField() && len(segments) > 0; {
 		f := g.Field(i)
@@ -76,6 +139,7 @@ func fillGroup(g reflect.Value, segments []interface{}) []interface{} {
 			} else {
 				fs, ok := FollowSets[followSetKey(g, i)]
 				if !ok || !fs[st.Elem().Name()] {
+					discard(segments[0])
 					segments = segments[1:]
 				} else {
 					i++
@@ -83,7 +147,7 @@ func fillGroup(g reflect.Value, segments []interface{}) []interface{} {
 			}
 		} else if f.Type().Kind() == reflect.Slice {
 			new := reflect.New(f.Type().Elem().Elem()) // Elem.Elem -> []*Group to Group
-			remaining := fillGroup(new, segments)
+			remaining := fillGroup(new, segments, discard)
 			if len(remaining) < len(segments) {
 				f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
 				existing := f
@@ -97,7 +161,7 @@ func fillGroup(g reflect.Value, segments []interface{}) []interface{} {
 			}
 		} else {
 			new := reflect.New(f.Type().Elem()) // Elem -> *Group to Group
-			remaining := fillGroup(new, segments)
+			remaining := fillGroup(new, segments, discard)
 			if len(remaining) < len(segments) {
 				f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
 				f.Set(new)
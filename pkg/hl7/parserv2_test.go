@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -165,3 +166,114 @@ func TestParseMessageV2_WithError(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMessageV2WithOptions_Rewrite(t *testing.T) {
+	badPid := []byte("PID|1||||||||||||^^^^NOT A NUMBER|")
+	input := bytes.Join([][]byte{mshOru, badPid, obr, obx1}, []byte("\r"))
+	if _, err := ParseMessageV2(input); err == nil {
+		t.Fatal("ParseMessageV2() got err=<nil>, want error")
+	}
+
+	rewrite := func(t Token) *RewriteResult {
+		if t.Location == "PID-13-Phone Number - Home/XTN-5-Country Code" {
+			return RewriteResultReplaceValue([]byte("1"))
+		}
+		return RewriteResultNoop()
+	}
+	mo := NewParseMessageOptions()
+	mo.Rewrites = &[]Rewrite{rewrite}
+	mo.Strict = true
+	m, report, err := ParseMessageV2WithOptions(input, mo)
+	if err != nil {
+		t.Fatalf("ParseMessageV2WithOptions() failed with %v", err)
+	}
+	if diff := cmp.Diff(&ParseReport{}, report); diff != "" {
+		t.Errorf("ParseMessageV2WithOptions() report got diff (-want +got):\n%s", diff)
+	}
+	pids := m.(*ORU_R01v2).GroupByPID()
+	if got, want := len(pids), 1; got != want {
+		t.Fatalf("len(GroupByPID) = %d, want %d", got, want)
+	}
+	if got, want := pids[0].PID().PhoneNumberHome[0].CountryCode.Value, float64(1); got != want {
+		t.Errorf("PID.PhoneNumberHome.CountryCode got %v, want %v", got, want)
+	}
+}
+
+func TestParseMessageV2WithOptions_DeletedSegmentsAreNotReported(t *testing.T) {
+	rewrite := func(t Token) *RewriteResult {
+		if bytes.HasPrefix(t.Value, []byte("NK1")) {
+			return RewriteResultDeleteToken()
+		}
+		return RewriteResultNoop()
+	}
+	mo := NewParseMessageOptions()
+	mo.Rewrites = &[]Rewrite{rewrite}
+	m, report, err := ParseMessageV2WithOptions(bytes.Join([][]byte{msh, evn, pid, nk1}, []byte("\r")), mo)
+	if err != nil {
+		t.Fatalf("ParseMessageV2WithOptions() failed with %v", err)
+	}
+	if got := m.(*ADT_A01v2).AllNK1(); got != nil {
+		t.Errorf("AllNK1() got %v, want <nil>", got)
+	}
+	if diff := cmp.Diff(&ParseReport{}, report); diff != "" {
+		t.Errorf("ParseMessageV2WithOptions() report got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseMessageV2WithOptions_Timezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("time.LoadLocation() failed with %v", err)
+	}
+	mo := NewParseMessageOptions()
+	mo.TimezoneLoc = loc
+	m, _, err := ParseMessageV2WithOptions(bytes.Join([][]byte{msh, evn, pid}, []byte("\r")), mo)
+	if err != nil {
+		t.Fatalf("ParseMessageV2WithOptions() failed with %v", err)
+	}
+	want := time.Date(2014, 11, 28, 0, 16, 35, 0, loc)
+	if got := m.(*ADT_A01v2).MSH().DateTimeOfMessage.Time; !got.Equal(want) {
+		t.Errorf("MSH.DateTimeOfMessage got %v, want %v", got, want)
+	}
+}
+
+func TestParseMessageV2WithOptions_Report(t *testing.T) {
+	unknown := []byte("XYZ|1|")
+	badOBX := []byte("OBX|NOT A NUMBER|CD|PASSITECODE||8")
+	input := bytes.Join([][]byte{msh, evn, pid, unknown, nk1, badOBX, obx1, zal}, []byte("\r"))
+
+	mo := NewParseMessageOptions()
+	mo.Strict = true
+	if _, _, err := ParseMessageV2WithOptions(input, mo); err == nil {
+		t.Error("ParseMessageV2WithOptions() with Strict got err=<nil>, want error")
+	}
+
+	m, report, err := ParseMessageV2WithOptions(input, NewParseMessageOptions())
+	if err != nil {
+		t.Fatalf("ParseMessageV2WithOptions() failed with %v", err)
+	}
+	adt := m.(*ADT_A01v2)
+	if adt.PID() == nil {
+		t.Error("PID() is <nil>, want not nil")
+	}
+	if got, want := len(adt.AllNK1()), 1; got != want {
+		t.Errorf("len(AllNK1) = %d, want %d", got, want)
+	}
+	if got, want := len(adt.AllOBX()), 1; got != want {
+		t.Errorf("len(AllOBX) = %d, want %d", got, want)
+	}
+
+	var gotSkipped []string
+	for _, s := range report.Skipped {
+		if s.Err == nil {
+			t.Errorf("Skipped segment %s at index %d has err=<nil>, want error", s.Name, s.Index)
+		}
+		gotSkipped = append(gotSkipped, fmt.Sprintf("%d:%s", s.Index, s.Name))
+	}
+	if diff := cmp.Diff([]string{"3:XYZ", "5:OBX"}, gotSkipped); diff != "" {
+		t.Errorf("ParseMessageV2WithOptions() skipped segments got diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]SkippedSegment{{Index: 7, Name: "ZAL"}}, report.Unplaced); diff != "" {
+		t.Errorf("ParseMessageV2WithOptions() unplaced segments got diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Framing is the way in which messages are delimited in a stream.
+type Framing int
+
+const (
+	// FramingAuto detects the framing from the first byte of the stream that is not white space:
+	// FramingMLLP if it is the MLLP start block, FramingText otherwise.
+	FramingAuto Framing = iota
+	// FramingText is for text files in which segments are terminated by \r, \n or \r\n.
+	// A message ends with a blank line or when the next MSH segment starts, so this covers files with
+	// messages separated by blank lines (as written by the file and stdout senders), files with one
+	// message per line and segments separated by \r, and HL7 batch files. The FHS, BHS, BTS and FTS
+	// segments of batch files are skipped; use ParseBatchFile to check the counts in the trailers.
+	FramingText
+	// FramingMLLP is for captures of MLLP traffic, in which each message is preceded by the start
+	// block (0x0B) and followed by the end block (0x1C) and a carriage return.
+	// White space between messages is ignored.
+	FramingMLLP
+)
+
+// DefaultMaxMessageSize is the default maximum size of a message read by a Reader, in bytes.
+const DefaultMaxMessageSize = 16 * 1024 * 1024
+
+// ReaderOptions contains optional parameters to NewReader.
+type ReaderOptions struct {
+	// Framing is the way in which messages are delimited. The default is FramingAuto.
+	Framing Framing
+	// ParseOptions are the options used to parse messages. If nil, NewParseMessageOptions() is used.
+	// ParseOptions.SegmentTerminator is ignored: the segments of the messages returned by the Reader
+	// are always terminated by SegmentTerminator.
+	ParseOptions *ParseMessageOptions
+	// MaxMessageSize is the maximum size of a message in bytes. Reading a bigger message fails.
+	// If zero, DefaultMaxMessageSize is used.
+	MaxMessageSize int
+	// Parallelism is the number of messages that are parsed concurrently.
+	// Messages are always returned in the order in which they appear in the stream.
+	// Values lower than 2 mean that messages are parsed sequentially in the goroutine that calls Next.
+	Parallelism int
+}
+
+// ReadMessage is a message read by a Reader.
+type ReadMessage struct {
+	// Index is the position of the message in the stream, starting at 0.
+	Index int
+	// Offset is the position in the stream of the first byte of the message.
+	Offset int64
+	// Raw is the message with its segments separated by SegmentTerminator.
+	Raw []byte
+	// Message is the parsed message, or nil if the message cannot be parsed.
+	Message *Message
+	// Err is the error returned when parsing the message, if any.
+	Err error
+}
+
+// Reader reads HL7 messages from a stream. The memory used by a Reader is bounded by
+// ReaderOptions.MaxMessageSize and ReaderOptions.Parallelism, regardless of the size of the stream,
+// so it can be used to process big files.
+// A Reader is not safe for concurrent use.
+type Reader struct {
+	r            *bufio.Reader
+	framing      Framing
+	parseOptions *ParseMessageOptions
+	maxSize      int
+	parallelism  int
+
+	// scanner reads the segments of the stream in text framing.
+	scanner *bufio.Scanner
+	// offset is the number of bytes consumed from r, and segmentStart the offset of the last segment
+	// returned by scanner.
+	offset       int64
+	segmentStart int64
+	// index is the index of the next message to be read from r.
+	index int
+	// segments and segmentsStart contain the segments of the message being read in text framing,
+	// and the offset at which the message started.
+	segments      [][]byte
+	segmentsSize  int
+	segmentsStart int64
+	// separator is the field separator declared by the last FHS, BHS or MSH segment read in text
+	// framing.
+	separator byte
+	// pending contains the messages that have been read and parsed but not returned yet.
+	pending []*ReadMessage
+	// err is the error that stopped the reading, to be returned once pending is empty.
+	err error
+}
+
+// NewReader returns a Reader that reads messages from r.
+// If options is nil, the default options are used.
+func NewReader(r io.Reader, options *ReaderOptions) *Reader {
+	if options == nil {
+		options = &ReaderOptions{}
+	}
+	po := NewParseMessageOptions()
+	if options.ParseOptions != nil {
+		copied := *options.ParseOptions
+		po = &copied
+	}
+	po.SegmentTerminator = []byte{SegmentTerminator}
+	maxSize := options.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxMessageSize
+	}
+	parallelism := options.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &Reader{
+		r:            bufio.NewReader(r),
+		framing:      options.Framing,
+		parseOptions: po,
+		maxSize:      maxSize,
+		parallelism:  parallelism,
+		separator:    DefaultDelimiters.Field,
+	}
+}
+
+// Next returns the next message in the stream, or io.EOF if there are no more messages.
+// Messages that cannot be parsed are returned with ReadMessage.Err set, and don't stop the reading.
+// Errors reading from the stream, errors in the framing and messages bigger than the maximum size
+// are returned as errors, and no more messages can be read after them.
+func (r *Reader) Next() (*ReadMessage, error) {
+	if len(r.pending) == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		r.fill()
+		if len(r.pending) == 0 {
+			return nil, r.err
+		}
+	}
+	m := r.pending[0]
+	r.pending[0] = nil
+	r.pending = r.pending[1:]
+	return m, nil
+}
+
+// fill reads and parses up to r.parallelism messages.
+func (r *Reader) fill() {
+	for len(r.pending) < r.parallelism {
+		m, err := r.readRaw()
+		if err != nil {
+			r.err = err
+			break
+		}
+		r.pending = append(r.pending, m)
+	}
+	if len(r.pending) == 1 {
+		r.parse(r.pending[0])
+		return
+	}
+	var wg sync.WaitGroup
+	for _, m := range r.pending {
+		wg.Add(1)
+		go func(m *ReadMessage) {
+			defer wg.Done()
+			r.parse(m)
+		}(m)
+	}
+	wg.Wait()
+}
+
+func (r *Reader) parse(m *ReadMessage) {
+	m.Message, m.Err = ParseMessageWithOptions(m.Raw, r.parseOptions)
+	if m.Err != nil {
+		m.Message = nil
+	}
+}
+
+// readRaw reads the next message from the stream without parsing it.
+func (r *Reader) readRaw() (*ReadMessage, error) {
+	if r.framing == FramingAuto {
+		f, err := r.detectFraming()
+		if err != nil {
+			return nil, err
+		}
+		r.framing = f
+	}
+	var m *ReadMessage
+	var err error
+	switch r.framing {
+	case FramingText:
+		m, err = r.readText()
+	case FramingMLLP:
+		m, err = r.readMLLP()
+	default:
+		return nil, fmt.Errorf("unknown framing %d", r.framing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.Index = r.index
+	r.index++
+	return m, nil
+}
+
+func (r *Reader) detectFraming() (Framing, error) {
+	for i := 1; i <= r.r.Size(); i++ {
+		b, err := r.r.Peek(i)
+		if err == io.EOF {
+			// Empty streams, or streams with only white space, have no messages in any framing.
+			return FramingText, nil
+		}
+		if err != nil {
+			return FramingAuto, errors.Wrap(err, "cannot detect the framing")
+		}
+		if c := b[i-1]; !isSpace(c) {
+			if c == mllpStartBlock {
+				return FramingMLLP, nil
+			}
+			return FramingText, nil
+		}
+	}
+	return FramingText, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// splitSegments is a bufio.SplitFunc that returns the segments in the stream, terminated by \r, \n
+// or \r\n. Blank lines are returned as empty segments.
+func (r *Reader) splitSegments(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	i := bytes.IndexAny(data, "\r\n")
+	if i < 0 {
+		if !atEOF {
+			return 0, nil, nil
+		}
+		i = len(data)
+	}
+	advance := i + 1
+	if i < len(data) && data[i] == '\r' {
+		if i+1 == len(data) && !atEOF {
+			// Wait until it is known whether the segment is terminated by \r\n.
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			advance++
+		}
+	}
+	if advance > len(data) {
+		advance = len(data)
+	}
+	r.segmentStart = r.offset
+	r.offset += int64(advance)
+	return advance, data[:i], nil
+}
+
+// readText reads the next message in text framing.
+func (r *Reader) readText() (*ReadMessage, error) {
+	if r.scanner == nil {
+		r.scanner = bufio.NewScanner(r.r)
+		r.scanner.Buffer(make([]byte, 0, 64*1024), r.maxSize+2)
+		r.scanner.Split(r.splitSegments)
+	}
+	for r.scanner.Scan() {
+		s, offset := r.scanner.Bytes(), r.segmentStart
+		if len(bytes.TrimSpace(s)) == 0 {
+			// Blank lines end messages.
+			if m := r.flushSegments(); m != nil {
+				return m, nil
+			}
+			continue
+		}
+		var m *ReadMessage
+		batchSegment := r.isBatchSegment(s)
+		if batchSegment || isHeaderSegment(s, messageHeaderSegment) {
+			m = r.flushSegments()
+		}
+		if !batchSegment {
+			if err := r.addSegment(s, offset); err != nil {
+				return nil, err
+			}
+		}
+		if m != nil {
+			return m, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return nil, fmt.Errorf("segment at offset %d is bigger than the maximum message size %d", r.offset, r.maxSize)
+		}
+		return nil, errors.Wrapf(err, "cannot read at offset %d", r.offset)
+	}
+	if m := r.flushSegments(); m != nil {
+		return m, nil
+	}
+	return nil, io.EOF
+}
+
+// isBatchSegment returns whether s is an FHS, FTS, BHS or BTS segment, and keeps track of the field
+// separator declared by the header segments.
+func (r *Reader) isBatchSegment(s []byte) bool {
+	for _, name := range []string{fileHeaderSegment, batchHeaderSegment, messageHeaderSegment} {
+		if isHeaderSegment(s, name) {
+			r.separator = s[len(name)]
+			return name != messageHeaderSegment
+		}
+	}
+	return isTrailerSegment(s, fileTrailerSegment, r.separator) || isTrailerSegment(s, batchTrailerSegment, r.separator)
+}
+
+func (r *Reader) addSegment(s []byte, offset int64) error {
+	if r.segments == nil {
+		r.segmentsStart = offset
+	}
+	r.segmentsSize += len(s) + 1
+	if r.segmentsSize > r.maxSize {
+		return fmt.Errorf("message at offset %d is bigger than the maximum message size %d", r.segmentsStart, r.maxSize)
+	}
+	// The segment needs to be copied because the line it belongs to is reused by the bufio.Reader.
+	r.segments = append(r.segments, append([]byte(nil), s...))
+	return nil
+}
+
+// flushSegments returns the message formed by the segments read so far, or nil if there are none.
+func (r *Reader) flushSegments() *ReadMessage {
+	if r.segments == nil {
+		return nil
+	}
+	m := &ReadMessage{Offset: r.segmentsStart, Raw: bytes.Join(r.segments, []byte{SegmentTerminator})}
+	r.segments = nil
+	r.segmentsSize = 0
+	return m
+}
+
+// readMLLP reads the next message in MLLP framing.
+func (r *Reader) readMLLP() (*ReadMessage, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read at offset %d", r.offset)
+		}
+		r.offset++
+		if b == mllpStartBlock {
+			break
+		}
+		if !isSpace(b) {
+			return nil, fmt.Errorf("mllp: protocol error, missing Start Block at offset %d", r.offset-1)
+		}
+	}
+	start := r.offset
+	var payload []byte
+	for {
+		chunk, err := r.r.ReadSlice(mllpEndBlock)
+		r.offset += int64(len(chunk))
+		if len(payload)+len(chunk) > r.maxSize+1 {
+			return nil, fmt.Errorf("message at offset %d is bigger than the maximum message size %d", start, r.maxSize)
+		}
+		payload = append(payload, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("mllp: protocol error, missing End Block for the message at offset %d", start)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read the message at offset %d", start)
+		}
+		break
+	}
+	// The carriage return after the end block is optional, to be lenient with captures.
+	if b, err := r.r.Peek(1); err == nil && b[0] == mllpCarriageReturn {
+		r.r.ReadByte()
+		r.offset++
+	}
+	payload = payload[:len(payload)-1]
+	segments := bytes.FieldsFunc(payload, func(c rune) bool { return c == '\r' || c == '\n' })
+	return &ReadMessage{Offset: start, Raw: bytes.Join(segments, []byte{SegmentTerminator})}, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readAll reads all messages with a Reader, and returns them and the error that stopped the reading,
+// or nil if the reading stopped with io.EOF.
+func readAll(t *testing.T, input string, options *ReaderOptions) ([]*ReadMessage, error) {
+	t.Helper()
+	r := NewReader(strings.NewReader(input), options)
+	var messages []*ReadMessage
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, m)
+	}
+}
+
+func TestReader(t *testing.T) {
+	mllp := func(m string) string { return "\x0b" + m + "\x1c\r" }
+	stdout := func(m string) string { return strings.Replace(m, "\r", "\n", -1) + "\n" }
+
+	cases := []struct {
+		name    string
+		input   string
+		framing Framing
+	}{
+		{name: "blank lines", input: batchMessage1 + "\n\n" + batchMessage2 + "\n\n"},
+		{name: "stdout", input: stdout(batchMessage1) + stdout(batchMessage2)},
+		{name: "windows line endings", input: strings.Replace(stdout(batchMessage1)+"\n"+stdout(batchMessage2), "\n", "\r\n", -1)},
+		{name: "one message per line", input: batchMessage1 + "\n" + batchMessage2 + "\n"},
+		{name: "no separators", input: batchMessage1 + "\r" + batchMessage2},
+		{name: "batch file", input: "FHS|^~\\&\rBHS|^~\\&\r" + batchMessage1 + "\r" + batchMessage2 + "\rBTS|2\rFTS|1\r"},
+		{name: "file header with another field separator", input: "FHS#^~\\&\r" + batchMessage1 + "\r" + batchMessage2 + "\rFTS|0\r"},
+		{name: "mllp", input: mllp(batchMessage1) + mllp(batchMessage2)},
+		{name: "mllp with white space", input: "\n" + mllp(batchMessage1) + "\n" + mllp(batchMessage2+"\r") + "\n"},
+		{name: "explicit text framing", input: batchMessage1 + "\n\n" + batchMessage2, framing: FramingText},
+		{name: "explicit mllp framing", input: mllp(batchMessage1) + mllp(batchMessage2), framing: FramingMLLP},
+	}
+	for _, tc := range cases {
+		for _, parallelism := range []int{0, 4} {
+			t.Run(fmt.Sprintf("%s_parallelism_%d", tc.name, parallelism), func(t *testing.T) {
+				messages, err := readAll(t, tc.input, &ReaderOptions{Framing: tc.framing, Parallelism: parallelism})
+				if err != nil {
+					t.Fatalf("Next() failed with %v", err)
+				}
+				var got []string
+				for i, m := range messages {
+					if m.Err != nil {
+						t.Errorf("Next() message %d got err %v, want nil", i, m.Err)
+					}
+					if m.Index != i {
+						t.Errorf("Next() message %d got Index %d, want %d", i, m.Index, i)
+					}
+					if m.Message == nil {
+						t.Errorf("Next() message %d got nil Message, want parsed message", i)
+					}
+					got = append(got, string(m.Raw))
+				}
+				if diff := cmp.Diff([]string{batchMessage1, batchMessage2}, got); diff != "" {
+					t.Errorf("Next() got diff (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestReader_Empty(t *testing.T) {
+	for _, input := range []string{"", "\n\n", "  \r\n"} {
+		messages, err := readAll(t, input, nil)
+		if err != nil {
+			t.Errorf("Next() for input %q failed with %v", input, err)
+		}
+		if len(messages) != 0 {
+			t.Errorf("Next() for input %q got %d messages, want 0", input, len(messages))
+		}
+	}
+}
+
+func TestReader_Offsets(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []int64
+	}{{
+		name:  "text",
+		input: "\n" + batchMessage1 + "\n\n\n" + batchMessage2,
+		want:  []int64{1, int64(1 + len(batchMessage1) + 3)},
+	}, {
+		name:  "mllp",
+		input: "\x0b" + batchMessage1 + "\x1c\r\n\x0b" + batchMessage2 + "\x1c\r",
+		want:  []int64{1, int64(len(batchMessage1) + 5)},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages, err := readAll(t, tc.input, nil)
+			if err != nil {
+				t.Fatalf("Next() failed with %v", err)
+			}
+			var got []int64
+			for _, m := range messages {
+				got = append(got, m.Offset)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Next() offsets got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReader_MessageErrors(t *testing.T) {
+	input := batchMessage1 + "\n\nMSH|\n\nPID|1\n\n" + batchMessage2
+	messages, err := readAll(t, input, &ReaderOptions{Parallelism: 2})
+	if err != nil {
+		t.Fatalf("Next() failed with %v", err)
+	}
+	var got []bool
+	for _, m := range messages {
+		got = append(got, m.Err != nil)
+		if (m.Err != nil) == (m.Message != nil) {
+			t.Errorf("Next() message %d got Message=%v and Err=%v, want exactly one of them", m.Index, m.Message, m.Err)
+		}
+	}
+	if diff := cmp.Diff([]bool{false, true, true, false}, got); diff != "" {
+		t.Errorf("Next() errors got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReader_Errors(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		options *ReaderOptions
+		// wantMessages is the number of messages that are read before the error.
+		wantMessages int
+	}{{
+		name:         "message too big",
+		input:        batchMessage1 + "\n\n" + batchMessage2 + "\rPID|" + strings.Repeat("a", 100),
+		options:      &ReaderOptions{MaxMessageSize: 100},
+		wantMessages: 1,
+	}, {
+		name:         "segment too big",
+		input:        "MSH|" + strings.Repeat("a", 200),
+		options:      &ReaderOptions{MaxMessageSize: 100},
+		wantMessages: 0,
+	}, {
+		name:         "mllp message too big",
+		input:        "\x0b" + batchMessage1 + "\x1c\r\x0b" + batchMessage2 + strings.Repeat("a", 100) + "\x1c\r",
+		options:      &ReaderOptions{MaxMessageSize: 100},
+		wantMessages: 1,
+	}, {
+		name:         "missing mllp start block",
+		input:        "\x0b" + batchMessage1 + "\x1c\r" + batchMessage2,
+		wantMessages: 1,
+	}, {
+		name:         "missing mllp end block",
+		input:        "\x0b" + batchMessage1 + "\x1c\r\x0b" + batchMessage2,
+		wantMessages: 1,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages, err := readAll(t, tc.input, tc.options)
+			if err == nil {
+				t.Fatal("Next() got nil error, want error")
+			}
+			if got := len(messages); got != tc.wantMessages {
+				t.Errorf("Next() got %d messages before the error, want %d", got, tc.wantMessages)
+			}
+		})
+	}
+}
+
+func TestReader_ParallelOrder(t *testing.T) {
+	var want []string
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		m := strings.Replace(batchMessage1, "|ADT^A01|1|", fmt.Sprintf("|ADT^A01|%d|", i), 1)
+		want = append(want, fmt.Sprint(i))
+		b.WriteString(m + "\n\n")
+	}
+	messages, err := readAll(t, b.String(), &ReaderOptions{Parallelism: 8})
+	if err != nil {
+		t.Fatalf("Next() failed with %v", err)
+	}
+	var got []string
+	for _, m := range messages {
+		if m.Err != nil {
+			t.Fatalf("Next() message %d got err %v, want nil", m.Index, m.Err)
+		}
+		msh, err := m.Message.MSH()
+		if err != nil {
+			t.Fatalf("MSH() failed with %v", err)
+		}
+		got = append(got, msh.MessageControlID.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Next() message control IDs got diff (-want +got):\n%s", diff)
+	}
+}
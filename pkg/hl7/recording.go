@@ -0,0 +1,124 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRecordedMessageSize is the maximum size of a line of a recording.
+const maxRecordedMessageSize = 16 * 1024 * 1024
+
+// RecordedMessage is a message sent by a recording sender.
+type RecordedMessage struct {
+	// Time is when the message was sent.
+	Time time.Time `json:"time"`
+	// Destination is where the message was sent, e.g., "mllp:localhost:6661".
+	Destination string `json:"destination,omitempty"`
+	// Message is the message, with the segments separated by SegmentTerminatorStr.
+	Message string `json:"message"`
+}
+
+// recordingSender sends HL7 messages with another sender and records the messages sent.
+type recordingSender struct {
+	Sender
+	destination string
+	file        *os.File
+	enc         *json.Encoder
+	now         func() time.Time
+	count       int
+}
+
+// NewRecordingSender returns a sender that sends HL7 messages with s, and records the messages that
+// are sent successfully in a file, with the time when they were sent and the destination, as lines
+// of JSON. Recordings can be read with ReadRecording.
+// Messages are recorded as they are passed to Send, so the messages to record should be UTF-8,
+// i.e., s should be the sender returned by NewEncodingSender rather than the sender it wraps.
+func NewRecordingSender(s Sender, destFilename string, destination string) (Sender, error) {
+	return newRecordingSender(s, destFilename, destination, time.Now)
+}
+
+func newRecordingSender(s Sender, destFilename string, destination string, now func() time.Time) (*recordingSender, error) {
+	if destFilename == "" {
+		return nil, errors.New("recording filename must be nonempty")
+	}
+	file, err := os.Create(destFilename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create recording file %s", destFilename)
+	}
+	return &recordingSender{
+		Sender:      s,
+		destination: destination,
+		file:        file,
+		enc:         json.NewEncoder(file),
+		now:         now,
+	}, nil
+}
+
+// Send sends the message and, if it was sent successfully, records it.
+func (s *recordingSender) Send(message []byte) error {
+	sent := s.now()
+	if err := s.Sender.Send(message); err != nil {
+		return err
+	}
+	m := RecordedMessage{Time: sent, Destination: s.destination, Message: string(message)}
+	if err := s.enc.Encode(m); err != nil {
+		return errors.Wrap(err, "cannot record a message")
+	}
+	s.count++
+	return nil
+}
+
+// Close closes the underlying sender and the recording file.
+// Close prints the number of messages that have been recorded.
+func (s *recordingSender) Close() error {
+	log.Infof("Messages successfully recorded by the recordingSender: %d", s.count)
+	if err := s.Sender.Close(); err != nil {
+		s.file.Close()
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return errors.Wrap(err, "closing recording file")
+	}
+	return nil
+}
+
+// ReadRecording reads the messages recorded by a recording sender, in the order in which they were
+// sent.
+func ReadRecording(r io.Reader) ([]RecordedMessage, error) {
+	var messages []RecordedMessage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxRecordedMessageSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var m RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, errors.Wrapf(err, "invalid recorded message in line %d", line)
+		}
+		messages = append(messages, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot read the recording")
+	}
+	return messages, nil
+}
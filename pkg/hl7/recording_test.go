@@ -0,0 +1,90 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+func TestRecordingSender(t *testing.T) {
+	filename := path.Join(testwrite.TempDir(t), "recording.jsonl")
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	inner := &listSender{}
+	s, err := newRecordingSender(inner, filename, "mllp:localhost:6661", func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("newRecordingSender(%s) failed with %v", filename, err)
+	}
+	if err := s.Send([]byte(batchMessage1)); err != nil {
+		t.Fatalf("Send(%q) failed with %v", batchMessage1, err)
+	}
+	now = now.Add(time.Minute)
+	inner.err = errors.New("cannot send")
+	if err := s.Send([]byte(batchMessage2)); err == nil {
+		t.Errorf("Send(%q) got nil error, want error", batchMessage2)
+	}
+	now = now.Add(time.Minute)
+	inner.err = nil
+	if err := s.Send([]byte(batchMessage2)); err != nil {
+		t.Fatalf("Send(%q) failed with %v", batchMessage2, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+	if !inner.closed {
+		t.Error("Close() did not close the underlying sender")
+	}
+	if diff := cmp.Diff([][]byte{[]byte(batchMessage1), []byte(batchMessage2)}, inner.sent); diff != "" {
+		t.Errorf("sent messages got diff (-want +got):\n%s", diff)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("os.Open(%s) failed with %v", filename, err)
+	}
+	defer f.Close()
+	got, err := ReadRecording(f)
+	if err != nil {
+		t.Fatalf("ReadRecording() failed with %v", err)
+	}
+	want := []RecordedMessage{
+		{Time: start, Destination: "mllp:localhost:6661", Message: batchMessage1},
+		{Time: start.Add(2 * time.Minute), Destination: "mllp:localhost:6661", Message: batchMessage2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadRecording() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewRecordingSender_EmptyFilename(t *testing.T) {
+	if _, err := NewRecordingSender(&listSender{}, "", "stdout"); err == nil {
+		t.Error("NewRecordingSender(\"\") got nil error, want error")
+	}
+}
+
+func TestReadRecording_Invalid(t *testing.T) {
+	recording := `{"time":"2020-01-01T00:00:00Z","message":"MSH|^~\\&"}` + "\n" + "not json\n"
+	if _, err := ReadRecording(strings.NewReader(recording)); err == nil {
+		t.Errorf("ReadRecording(%q) got nil error, want error", recording)
+	}
+}
@@ -19,6 +19,9 @@ package hl7
 
 import "reflect"
 
+// SchemaVersion is the HL7v2 version of the schema in this file.
+const SchemaVersion = "2.3.0"
+
 
 // AD represents the corresponding HL7 datatype.
 // Definition from HL7 2.3
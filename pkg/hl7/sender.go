@@ -31,6 +31,14 @@ type Sender interface {
 	Close() error
 }
 
+// Interrupter is implemented by senders that can be interrupted while sending a message, to
+// simulate connections that drop.
+type Interrupter interface {
+	// Interrupt sends the first n bytes of the message and closes the connection, without waiting for
+	// an acknowledgement. The next message is sent on a new connection.
+	Interrupt(message []byte, n int) error
+}
+
 // stdoutSender sends HL7 messages to the standard output.
 type stdoutSender struct {
 	count int
@@ -55,6 +63,27 @@ func (s *stdoutSender) Close() error {
 	return nil
 }
 
+// encodingSender encodes HL7 messages in the character set they declare before sending them.
+type encodingSender struct {
+	Sender
+}
+
+// NewEncodingSender returns a sender that encodes the messages in the character set declared in
+// their MSH-18 field, e.g., 8859/1, before sending them with s. The messages to send must be UTF-8.
+// Messages that cannot be encoded are not sent, and an error is returned.
+func NewEncodingSender(s Sender) Sender {
+	return &encodingSender{Sender: s}
+}
+
+// Send encodes the message and sends it.
+func (s *encodingSender) Send(message []byte) error {
+	encoded, err := EncodeMessage(message)
+	if err != nil {
+		return errors.Wrap(err, "cannot send message")
+	}
+	return s.Sender.Send(encoded)
+}
+
 var recoverableErrs = map[syscall.Errno]bool{syscall.EPIPE: true, syscall.ECONNRESET: true}
 
 // mllpSender sends HL7 messages via the MLLP protocol.
@@ -141,6 +170,25 @@ func (s *mllpSender) Send(message []byte) error {
 	return nil
 }
 
+// Interrupt writes the MLLP start block and the first n bytes of the message, and closes the
+// connection. It then establishes a new connection for the next message.
+func (s *mllpSender) Interrupt(message []byte, n int) error {
+	if n > len(message) {
+		n = len(message)
+	}
+	_, writeErr := s.conn.Write(append([]byte{mllpStartBlock}, message[:n]...))
+	if err := s.conn.Close(); err != nil {
+		log.WithError(err).Warning("Cannot close the interrupted mllp connection")
+	}
+	if err := s.establishConnection(); err != nil {
+		return errors.Wrap(err, "cannot re-establish connection after interrupting a message")
+	}
+	if writeErr != nil {
+		return errors.Wrap(writeErr, "cannot write the interrupted message")
+	}
+	return nil
+}
+
 // Close closes the underlying TCP connection.
 // It should be called, when the mllpSender is not needed anymore or at the program exit.
 // Close prints the number of messages that have been sent.
@@ -205,6 +205,64 @@ func TestMllpSender_ReEstablishConn(t *testing.T) {
 	<-done
 }
 
+func TestMllpSender_Interrupt(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf(`net.Listen("tcp", ":0") failed with %v`, err)
+	}
+	defer ln.Close()
+
+	sender, err := NewMLLPSender(ln.Addr().String(), false, 0)
+	if err != nil {
+		t.Fatalf("NewMLLPSender(%s, %t, %v) failed with %v", ln.Addr().String(), false, 0, err)
+	}
+	defer sender.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("ln.Accept() failed with %v", err)
+	}
+	defer conn.Close()
+
+	interrupted := "hl7_message"
+	if err := sender.(Interrupter).Interrupt([]byte(interrupted), 3); err != nil {
+		t.Fatalf("Interrupt(%q, 3) failed with %v", interrupted, err)
+	}
+	// The connection is closed after the first bytes of the message.
+	got, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ioutil.ReadAll() failed with %v", err)
+	}
+	if want := "\x0bhl7"; string(got) != want {
+		t.Errorf("ioutil.ReadAll() got %q, want %q", got, want)
+	}
+
+	// The next message is sent on a new connection.
+	done := make(chan bool, 1)
+	defer close(done)
+	want := "next_message"
+	go func() {
+		if err := sender.Send([]byte(want)); err != nil {
+			t.Errorf("sender.Send(%s) failed with %v", want, err)
+		}
+		done <- true
+	}()
+	newConn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("ln.Accept() failed with %v", err)
+	}
+	defer newConn.Close()
+	mllpClient := NewMLLPClient(newConn)
+	gotB, err := mllpClient.Read()
+	if err != nil {
+		t.Fatalf("mllpClient.Read() failed with %v", err)
+	}
+	if got := string(gotB); got != want {
+		t.Errorf("mllpClient.Read() got %q, want %q", got, want)
+	}
+	mllpClient.Write([]byte("MSH|^~\\&|"))
+	<-done
+}
+
 func TestStdoutSender(t *testing.T) {
 	// Capture stdout.
 	oldStdout := os.Stdout
@@ -27,6 +27,8 @@ var (
 	hexEscapeSeq   = regexp.MustCompile(`X[A-Fa-f0-9]+`)
 	localEscapeSeq = regexp.MustCompile(`Z.+`)
 	spEscapeSeq    = regexp.MustCompile(`^\.sp\+?([0-9]*)$`)
+	// charsetEscapeSeq matches the escape sequences that switch character sets, e.g., \C2D41\.
+	charsetEscapeSeq = regexp.MustCompile(`^(C[A-Fa-f0-9]{4}|M[A-Fa-f0-9]{4}([A-Fa-f0-9]{2})?)$`)
 
 	// ErrUnrecognizedEscapeSequence symbolizes an unknown or invalid HL7 escape sequence.
 	ErrUnrecognizedEscapeSequence = errors.New("Unrecognized HL7 escape sequence")
@@ -55,7 +57,8 @@ func unescapeSP(escape string) ([]byte, error) {
 
 // UnescapeText unescapes the text field src using the rules from section 2.9.1 of the
 // specification, eg \F\ for the field separator (usually |).
-// Unknown escape sequences cause an ErrUnrecognizedEscapeSequence.
+// Unknown escape sequences cause an ErrUnrecognizedEscapeSequence. Escape sequences that switch the
+// character set, e.g., \C2D41\, are removed, but the text is not decoded.
 // TX, FT and CF fields can include any of the escape sequences defined in section 2.9.1.
 // ST fields can include only a subset. If the parameter `isST` is set, only such subset is
 // considered valid.
@@ -100,6 +103,9 @@ func UnescapeText(src []byte, d *Delimiters, isST bool) ([]byte, error) {
 			case !isST && hexEscapeSeq.MatchString(v):
 			case !isST && localEscapeSeq.MatchString(v):
 				// Ignore locally defined escape sequences.
+			case charsetEscapeSeq.MatchString(v):
+				// Ignore character set switches; parsed text fields are decoded in the character set
+				// that they switch to.
 			case !isST && v == ".br":
 				dst = append(dst, 0xa) // ASCII new line
 			case isST && v == ".br":
@@ -0,0 +1,377 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// IssueType is the type of a problem found when validating a message.
+type IssueType string
+
+// Types of validation issues.
+const (
+	// IssueUnknownMessageType means that the message structure cannot be found in the schema.
+	IssueUnknownMessageType IssueType = "unknown_message_type"
+	// IssueUnknownSegment means that the segment is not defined in the schema.
+	IssueUnknownSegment IssueType = "unknown_segment"
+	// IssueUnexpectedSegment means that the segment is not allowed in its position of the message
+	// structure, either because it is out of order or because it repeats when it cannot.
+	IssueUnexpectedSegment IssueType = "unexpected_segment"
+	// IssueMissingSegment means that a required segment or group is missing.
+	IssueMissingSegment IssueType = "missing_segment"
+	// IssueMissingField means that a required field is empty.
+	IssueMissingField IssueType = "missing_field"
+	// IssueRepeatedField means that a field that cannot repeat has more than one repetition.
+	IssueRepeatedField IssueType = "repeated_field"
+	// IssueInvalidValue means that the value of a field cannot be parsed as its data type.
+	IssueInvalidValue IssueType = "invalid_value"
+	// IssueFieldTooLong means that a repetition of a field is longer than its maximum length.
+	IssueFieldTooLong IssueType = "field_too_long"
+	// IssueValueNotInTable means that the value of a field is not one of the values of its table.
+	IssueValueNotInTable IssueType = "value_not_in_table"
+)
+
+// ValidationIssue is a problem found when validating a message.
+type ValidationIssue struct {
+	Type IssueType
+	// Location is where the issue was found: the path to a segment or group within the message
+	// structure for structure issues, e.g., "ORU_R01.PATIENT_RESULT.ORDER_OBSERVATION.OBR",
+	// or the field, e.g., "PID-8".
+	Location string
+	// Segment is the index of the segment where the issue was found, starting at 0, or -1 if the
+	// issue is not about a segment in the message, e.g., for missing segments.
+	Segment int
+	// Description is a human-readable description of the issue.
+	Description string
+}
+
+func (i *ValidationIssue) String() string {
+	if i.Segment < 0 {
+		return fmt.Sprintf("%s at %s: %s", i.Type, i.Location, i.Description)
+	}
+	return fmt.Sprintf("%s at %s (segment %d): %s", i.Type, i.Location, i.Segment, i.Description)
+}
+
+// ValidationIssues are the problems found when validating a message.
+// ValidationIssues implements error so that it can be returned as such.
+type ValidationIssues []*ValidationIssue
+
+func (i ValidationIssues) Error() string {
+	s := make([]string, len(i))
+	for j, issue := range i {
+		s[j] = issue.String()
+	}
+	return fmt.Sprintf("validation issues (%d): %s", len(i), strings.Join(s, ", "))
+}
+
+// ValidationOptions contains the checks that Validate runs in addition to the ones derived from the
+// schema. Fields are identified by the segment name and the field number, e.g., "PID-8".
+type ValidationOptions struct {
+	// Tables maps the IDs of HL7 tables, e.g., "0001", to their values.
+	Tables map[string][]string
+	// FieldTables maps fields to the IDs of the tables that contain their valid values.
+	// For fields with composite data types, the first component is checked.
+	FieldTables map[string]string
+	// MaxLengths maps fields to the maximum length of each of their repetitions.
+	MaxLengths map[string]int
+}
+
+// Validate checks a message against the schema of its message type and the given options,
+// and returns the problems found, or nil if there are none. If options is nil, only the schema
+// checks are run.
+// The schema checks are:
+//   - The message structure: the order, cardinality and presence of required segments and groups.
+//     Z-segments are allowed anywhere.
+//   - That the required fields are not empty, and that fields that can't repeat don't repeat.
+//   - That the fields can be parsed according to their data types.
+func Validate(m *Message, options *ValidationOptions) ValidationIssues {
+	if options == nil {
+		options = &ValidationOptions{}
+	}
+	v := &validator{m: m, options: options}
+	for _, s := range m.Segments {
+		if len(s.Value) == 0 {
+			continue
+		}
+		name, err := segmentName(s, m.Delimiters)
+		if err != nil {
+			name = ""
+		}
+		v.segments = append(v.segments, s)
+		v.names = append(v.names, name)
+	}
+	v.validateStructure()
+	for i := range v.segments {
+		v.validateSegment(i)
+	}
+	return v.issues
+}
+
+type validator struct {
+	m        *Message
+	options  *ValidationOptions
+	segments []Token
+	names    []string
+	// next is the index of the next segment to match against the message structure.
+	next   int
+	issues ValidationIssues
+}
+
+func (v *validator) addIssue(t IssueType, location string, segment int, format string, args ...interface{}) {
+	v.issues = append(v.issues, &ValidationIssue{Type: t, Location: location, Segment: segment, Description: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validateStructure() {
+	name, err := v.m.messageTypeName()
+	if err != nil {
+		v.addIssue(IssueUnknownMessageType, "MSH-9", 0, "%v", err)
+		return
+	}
+	t, ok := Types[name]
+	if !ok || t.Kind() != reflect.Struct || !reflect.PtrTo(t).Implements(reflect.TypeOf((*MessageType)(nil)).Elem()) {
+		v.addIssue(IssueUnknownMessageType, "MSH-9", 0, "unknown message structure %q", name)
+		return
+	}
+	v.matchGroup(t, name, nil)
+	for ; v.next < len(v.names); v.next++ {
+		v.unexpected(name)
+	}
+}
+
+func (v *validator) unexpected(path string) {
+	name := v.names[v.next]
+	if name == "" {
+		v.addIssue(IssueUnknownSegment, path, v.next, "invalid segment name in %q", v.segments[v.next].Value)
+		return
+	}
+	if !isZSegment(name) && !isKnownSegment(name) {
+		v.addIssue(IssueUnknownSegment, path, v.next, "unknown segment %s", name)
+		return
+	}
+	v.addIssue(IssueUnexpectedSegment, path, v.next, "segment %s is not allowed here", name)
+}
+
+// matchGroup matches the segments from v.next onwards against the fields of the given group or
+// message type. follow contains the names of the segments that can appear after the group.
+func (v *validator) matchGroup(t reflect.Type, path string, follow StringSet) {
+	fields := structureFields(t)
+	for k, f := range fields {
+		// Required segments may be missing, so any of the following fields can come next.
+		after := follow
+		for _, next := range fields[k+1:] {
+			after = union(after, next.first)
+		}
+		count := 0
+		for v.next < len(v.names) {
+			name := v.names[v.next]
+			if isZSegment(name) {
+				v.next++
+				continue
+			}
+			if f.first[name] && (count == 0 || f.repeated) {
+				count++
+				if f.group == nil {
+					v.next++
+					continue
+				}
+				groupFollow := after
+				if f.repeated {
+					groupFollow = union(after, f.first)
+				}
+				v.matchGroup(f.group, path+"."+f.name, groupFollow)
+				continue
+			}
+			if after[name] {
+				break
+			}
+			v.unexpected(path)
+			v.next++
+		}
+		if count == 0 && f.required {
+			v.addIssue(IssueMissingSegment, path+"."+f.name, -1, "required %s %s is missing", f.kind(), f.name)
+		}
+	}
+}
+
+func isZSegment(name string) bool {
+	return strings.HasPrefix(name, "Z")
+}
+
+func isKnownSegment(name string) bool {
+	if _, ok := customSegments[name]; ok {
+		return true
+	}
+	t, ok := Types[name]
+	return ok && reflect.PtrTo(t).Implements(reflect.TypeOf((*Segment)(nil)).Elem())
+}
+
+func union(a, b StringSet) StringSet {
+	u := make(StringSet, len(a)+len(b))
+	for k := range a {
+		u[k] = true
+	}
+	for k := range b {
+		u[k] = true
+	}
+	return u
+}
+
+// structureField is a segment or group within a message structure.
+type structureField struct {
+	name     string
+	required bool
+	repeated bool
+	// group is the type of the group, or nil if the field is a segment.
+	group reflect.Type
+	// first contains the names of the segments that can start the field.
+	first StringSet
+}
+
+func (f structureField) kind() string {
+	if f.group == nil {
+		return "segment"
+	}
+	return "group"
+}
+
+// structureFieldsCache caches the result of structureFields, keyed by type.
+var structureFieldsCache sync.Map
+
+// structureFields returns the segments and groups of a message structure or group type.
+func structureFields(t reflect.Type) []structureField {
+	if fields, ok := structureFieldsCache.Load(t); ok {
+		return fields.([]structureField)
+	}
+	var fields []structureField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if _, ok := sf.Tag.Lookup("hl7"); !ok {
+			// Other.
+			continue
+		}
+		name, required := parseTag(sf)
+		f := structureField{name: name, required: required, repeated: sf.Type.Kind() == reflect.Slice}
+		elem := sf.Type.Elem()
+		if isSegmentType(sf.Type) {
+			f.name = elem.Name()
+			f.first = StringSet{f.name: true}
+		} else {
+			f.group = elem
+			f.first = firstSegments(structureFields(elem))
+		}
+		fields = append(fields, f)
+	}
+	structureFieldsCache.Store(t, fields)
+	return fields
+}
+
+// firstSegments returns the names of the segments that can appear first in the given fields.
+func firstSegments(fields []structureField) StringSet {
+	first := StringSet{}
+	for _, f := range fields {
+		for name := range f.first {
+			first[name] = true
+		}
+		if f.required {
+			break
+		}
+	}
+	return first
+}
+
+// validateSegment checks the fields of the i-th segment.
+func (v *validator) validateSegment(i int) {
+	name := v.names[i]
+	if name == "" || !isKnownSegment(name) {
+		return
+	}
+	t := Types[name]
+	s := v.segments[i]
+	d := v.m.Delimiters
+	if _, err := parseSegmentValue(s, v.m.Context, reflect.New(t).Elem()); err != nil {
+		if perrs, ok := err.(ParseErrors); ok {
+			for _, pe := range perrs {
+				v.addIssue(IssueInvalidValue, pe.Location, i, "%v", pe.Cause)
+			}
+		} else {
+			v.addIssue(IssueInvalidValue, name, i, "%v", err)
+		}
+	}
+	values := bytes.Split(s.Value, []byte{d.Field})
+	for k := 0; k < t.NumField(); k++ {
+		sf := t.Field(k)
+		if _, ok := sf.Tag.Lookup("hl7"); !ok {
+			continue
+		}
+		// The first value is the segment name. In MSH, it is followed by MSH-2, as MSH-1 is the
+		// field separator itself.
+		number := k + 1
+		if name == "MSH" {
+			number++
+		}
+		location := fmt.Sprintf("%s-%d", name, number)
+		var value []byte
+		if k+1 < len(values) {
+			value = values[k+1]
+		}
+		_, required := parseTag(sf)
+		if len(value) == 0 {
+			if required {
+				v.addIssue(IssueMissingField, location, i, "required field %s is empty", location)
+			}
+			continue
+		}
+		if location == "MSH-2" {
+			// The encoding characters include the repetition and component separators.
+			continue
+		}
+		repetitions := bytes.Split(value, []byte{d.Repetition})
+		if len(repetitions) > 1 && sf.Type.Kind() != reflect.Slice {
+			v.addIssue(IssueRepeatedField, location, i, "field %s has %d repetitions, but it cannot repeat", location, len(repetitions))
+		}
+		v.validateOptions(location, i, repetitions)
+	}
+}
+
+func (v *validator) validateOptions(location string, segment int, repetitions [][]byte) {
+	maxLength, hasMaxLength := v.options.MaxLengths[location]
+	tableID, hasTable := v.options.FieldTables[location]
+	for _, r := range repetitions {
+		if hasMaxLength && len(r) > maxLength {
+			v.addIssue(IssueFieldTooLong, location, segment, "field %s has length %d, but the maximum is %d", location, len(r), maxLength)
+		}
+		if !hasTable || IsHL7Null(r) {
+			continue
+		}
+		code := string(bytes.SplitN(r, []byte{v.m.Delimiters.Component}, 2)[0])
+		if code != "" && !inTable(v.options.Tables[tableID], code) {
+			v.addIssue(IssueValueNotInTable, location, segment, "value %q of field %s is not in table %s", code, location, tableID)
+		}
+	}
+}
+
+func inTable(table []string, value string) bool {
+	for _, t := range table {
+		if t == value {
+			return true
+		}
+	}
+	return false
+}
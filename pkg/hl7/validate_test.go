@@ -0,0 +1,148 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hl7
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	validateMSH = "MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||%s|1|T|2.3|||AL||44|ASCII"
+	validatePID = "PID|1||1234^^^SIMULATOR MRN^MRN||Smith^John||19800101|M"
+	validatePV1 = "PV1|1|I"
+	validateOBR = "OBR|1|||lpdc-3969^UREA AND ELECTROLYTES^WinPath"
+	validateOBX = "OBX|1|NM|tt-3^Urea^WinPath||5.0|mmol/L|||||F"
+)
+
+func validateMessage(messageType string, segments ...string) string {
+	return strings.Join(append([]string{strings.Replace(validateMSH, "%s", messageType, 1)}, segments...), SegmentTerminatorStr)
+}
+
+func TestValidate(t *testing.T) {
+	options := &ValidationOptions{
+		Tables:      map[string][]string{"0001": {"F", "M", "U"}, "0004": {"I", "O"}},
+		FieldTables: map[string]string{"PID-8": "0001", "PV1-2": "0004"},
+		MaxLengths:  map[string]int{"PID-5": 12},
+	}
+
+	cases := []struct {
+		name    string
+		message string
+		want    ValidationIssues
+	}{{
+		name:    "valid ADT",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", validatePID, "ZCM|1", validatePV1),
+	}, {
+		name:    "valid ORU with repeated groups",
+		message: validateMessage("ORU^R01", validatePID, validatePV1, "ORC|RE", validateOBR, validateOBX, "NTE|1", validateOBX, validateOBR, validateOBX),
+	}, {
+		name:    "missing required segment",
+		message: validateMessage("ADT^A01", validatePID, validatePV1),
+		want: ValidationIssues{
+			{Type: IssueMissingSegment, Location: "ADT_A01.EVN", Segment: -1, Description: "required segment EVN is missing"},
+		},
+	}, {
+		name:    "missing required group",
+		message: validateMessage("ORU^R01"),
+		want: ValidationIssues{
+			{Type: IssueMissingSegment, Location: "ORU_R01.PATIENT_RESULT", Segment: -1, Description: "required group PATIENT_RESULT is missing"},
+		},
+	}, {
+		name:    "segment out of order",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", validatePV1, validatePID),
+		want: ValidationIssues{
+			{Type: IssueMissingSegment, Location: "ADT_A01.PID", Segment: -1, Description: "required segment PID is missing"},
+			{Type: IssueUnexpectedSegment, Location: "ADT_A01", Segment: 3, Description: "segment PID is not allowed here"},
+		},
+	}, {
+		name:    "segment that cannot repeat",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", validatePID, validatePID, validatePV1),
+		want: ValidationIssues{
+			{Type: IssueUnexpectedSegment, Location: "ADT_A01", Segment: 3, Description: "segment PID is not allowed here"},
+		},
+	}, {
+		name:    "unknown segment",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", validatePID, "XYZ|1", validatePV1),
+		want: ValidationIssues{
+			{Type: IssueUnknownSegment, Location: "ADT_A01", Segment: 3, Description: "unknown segment XYZ"},
+		},
+	}, {
+		name:    "unknown message type",
+		message: validateMessage("XYZ^A01", validatePID),
+		want: ValidationIssues{
+			{Type: IssueUnknownMessageType, Location: "MSH-9", Segment: 0, Description: `unknown message structure "XYZ_A01"`},
+		},
+	}, {
+		name:    "missing required field",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", "PID|1||1234", validatePV1),
+		want: ValidationIssues{
+			{Type: IssueMissingField, Location: "PID-5", Segment: 2, Description: "required field PID-5 is empty"},
+		},
+	}, {
+		name:    "repeated field",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", validatePID+"~F", validatePV1),
+		want: ValidationIssues{
+			{Type: IssueRepeatedField, Location: "PID-8", Segment: 2, Description: "field PID-8 has 2 repetitions, but it cannot repeat"},
+		},
+	}, {
+		name:    "invalid value",
+		message: validateMessage("ADT^A01", "EVN|A01|not-a-date", validatePID, validatePV1),
+		want: ValidationIssues{
+			{Type: IssueInvalidValue, Location: "EVN-2-Recorded Date/Time", Segment: 1, Description: "bad TS value: invalid length"},
+		},
+	}, {
+		name:    "field too long",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", "PID|1||1234||Smith^Johnathan~Smith^John||19800101|M", validatePV1),
+		want: ValidationIssues{
+			{Type: IssueFieldTooLong, Location: "PID-5", Segment: 2, Description: "field PID-5 has length 15, but the maximum is 12"},
+		},
+	}, {
+		name:    "value not in table",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", "PID|1||1234||Smith^John||19800101|X", "PV1|1|E^Emergency"),
+		want: ValidationIssues{
+			{Type: IssueValueNotInTable, Location: "PID-8", Segment: 2, Description: `value "X" of field PID-8 is not in table 0001`},
+			{Type: IssueValueNotInTable, Location: "PV1-2", Segment: 3, Description: `value "E" of field PV1-2 is not in table 0004`},
+		},
+	}, {
+		name:    "null value is not checked against the table",
+		message: validateMessage("ADT^A01", "EVN|A01|20200101000000", `PID|1||1234||Smith^John||19800101|""`, validatePV1),
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseMessage([]byte(tc.message))
+			if err != nil {
+				t.Fatalf("ParseMessage(%q) failed with %v", tc.message, err)
+			}
+			got := Validate(m, options)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Validate(%q) got diff (-want +got):\n%s", tc.message, diff)
+			}
+		})
+	}
+}
+
+func TestValidate_NilOptions(t *testing.T) {
+	message := validateMessage("ADT^A01", "EVN|A01|20200101000000", "PID|1||1234||Smith^John||19800101|X", validatePV1)
+	m, err := ParseMessage([]byte(message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", message, err)
+	}
+	if got := Validate(m, nil); got != nil {
+		t.Errorf("Validate(%q, nil) got %v, want nil", message, got)
+	}
+}
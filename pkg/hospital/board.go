@@ -0,0 +1,164 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hospital
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/simhospital/pkg/location"
+	"github.com/google/simhospital/pkg/state"
+)
+
+// Board is a snapshot of the wards of the hospital, the patients in their beds, and a census of the
+// patients in the hospital.
+type Board struct {
+	Time   time.Time `json:"time"`
+	Wards  []Ward    `json:"wards"`
+	Census Census    `json:"census"`
+}
+
+// Ward is a location from the locations file, and its beds.
+// Beds are only known once they have been occupied, so Free is the number of beds that have been
+// occupied in the past and are free now.
+type Ward struct {
+	Name     string `json:"name"`
+	Poc      string `json:"poc"`
+	Type     string `json:"type"`
+	Beds     []Bed  `json:"beds"`
+	Occupied int    `json:"occupied"`
+	Free     int    `json:"free"`
+}
+
+// Bed is a bed in a ward, and the patient in it if it is occupied.
+type Bed struct {
+	Name     string      `json:"name"`
+	Occupied bool        `json:"occupied"`
+	Patient  *BedPatient `json:"patient,omitempty"`
+}
+
+// BedPatient is a patient in a bed.
+type BedPatient struct {
+	MRN       string `json:"mrn"`
+	FirstName string `json:"first_name"`
+	Surname   string `json:"surname"`
+	Class     string `json:"class"`
+	// PathwayName is the name of the pathway of the patient's next event, if any.
+	PathwayName string          `json:"pathway_name,omitempty"`
+	NextEvent   *ScheduledEvent `json:"next_event,omitempty"`
+}
+
+// ScheduledEvent is an event in the event queue.
+type ScheduledEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+}
+
+// Census is the number of active patients, i.e., patients that are in a location or that have
+// pending events, by class.
+// Patients in the ED location are counted as ED patients regardless of their class. The rest are
+// counted as inpatients if they have the inpatient class, and as outpatients otherwise.
+type Census struct {
+	Total      int `json:"total"`
+	Inpatient  int `json:"inpatient"`
+	ED         int `json:"ed"`
+	Outpatient int `json:"outpatient"`
+	// ByClass is the number of active patients by the value of their patient class.
+	ByClass map[string]int `json:"by_class"`
+}
+
+// Board returns a snapshot of the wards and patients of the hospital.
+// Board reads the state of patients and locations that events modify, so it must not be called
+// concurrently with running events.
+func (h *Hospital) Board() Board {
+	nextEvents := map[string]state.Event{}
+	for _, e := range h.Events() {
+		mrns := []string{e.PatientMRN}
+		for _, mrn := range e.PatientIDs {
+			mrns = append(mrns, mrn)
+		}
+		for _, mrn := range mrns {
+			if _, ok := nextEvents[mrn]; !ok && mrn != "" {
+				nextEvents[mrn] = e
+			}
+		}
+	}
+
+	board := Board{
+		Time:   h.clock.Now(),
+		Census: Census{ByClass: map[string]int{}},
+	}
+	// inBeds is the patient in each occupied bed, by ward name and bed name.
+	inBeds := map[string]map[string]*BedPatient{}
+	for _, p := range h.patients.All() {
+		info := p.PatientInfo
+		mrn := info.Person.MRN
+		e, hasEvents := nextEvents[mrn]
+		if info.Location == nil && !hasEvents {
+			continue
+		}
+
+		board.Census.Total++
+		board.Census.ByClass[info.Class]++
+		switch {
+		case h.locationManager.IsAAndELocation(info.Location):
+			board.Census.ED++
+		case info.Class == h.messageConfig.PatientClass.Inpatient:
+			board.Census.Inpatient++
+		default:
+			board.Census.Outpatient++
+		}
+
+		if info.Location == nil || !location.IsBed(info.Location) {
+			continue
+		}
+		bp := &BedPatient{
+			MRN:       mrn,
+			FirstName: info.Person.FirstName,
+			Surname:   info.Person.Surname,
+			Class:     info.Class,
+		}
+		if hasEvents {
+			bp.PathwayName = e.PathwayName
+			bp.NextEvent = &ScheduledEvent{Type: e.Step.StepType(), Time: e.EventTime}
+		}
+		for name := range h.locationManager.RoomManagers {
+			if matches, err := h.locationManager.Matches(name, info.Location); err == nil && matches {
+				if inBeds[name] == nil {
+					inBeds[name] = map[string]*BedPatient{}
+				}
+				inBeds[name][info.Location.Bed] = bp
+				break
+			}
+		}
+	}
+
+	for name, rm := range h.locationManager.RoomManagers {
+		w := Ward{Name: name, Poc: rm.Poc, Type: rm.Type, Beds: []Bed{}}
+		for _, b := range rm.Beds() {
+			bed := Bed{Name: b.Name, Occupied: b.Occupied}
+			if b.Occupied {
+				w.Occupied++
+				bed.Patient = inBeds[name][b.Name]
+			} else {
+				w.Free++
+			}
+			w.Beds = append(w.Beds, bed)
+		}
+		board.Wards = append(board.Wards, w)
+	}
+	sort.Slice(board.Wards, func(i, j int) bool { return board.Wards[i].Name < board.Wards[j].Name })
+	return board
+}
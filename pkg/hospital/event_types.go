@@ -80,7 +80,7 @@ func (h *Hospital) processAdmission(e *state.Event, logLocal *logging.SimulatedH
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A01 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) processOrder(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -105,7 +105,7 @@ func (h *Hospital) processOrder(e *state.Event, logLocal *logging.SimulatedHospi
 	if err != nil {
 		return errors.Wrap(err, "cannot build ORM^O01 message")
 	}
-	if err := h.queueMessage(logLocal, msg, e); err != nil {
+	if err := h.queueStepMessage(logLocal, msg, e); err != nil {
 		return err
 	}
 	if e.Step.Order.NoAcknowledgementMessage {
@@ -120,6 +120,7 @@ func (h *Hospital) processOrder(e *state.Event, logLocal *logging.SimulatedHospi
 		return errors.Wrap(err, "cannot build ORR^O02 message")
 	}
 	e.MessageTime = orderAckMessageTime
+	// The acknowledgement is not the message of the step, so it doesn't have its Z-segments.
 	return h.queueMessage(logLocal, msg, e)
 }
 
@@ -129,7 +130,7 @@ func (h *Hospital) processResults(e *state.Event, logLocal *logging.SimulatedHos
 	patientInfo := patient.PatientInfo
 
 	h.setAdmissionDetailsIfMissing(patientInfo, e.EventTime)
-	o, err := h.generator.SetResults(patient.GetOrder(e.Step.Result.OrderID), e.Step.Result, e.EventTime)
+	o, err := h.generator.SetResults(patientInfo, patient.GetOrder(e.Step.Result.OrderID), e.Step.Result, e.EventTime)
 	if err != nil {
 		return errors.Wrap(err, "cannot set results in Results event")
 	}
@@ -153,7 +154,26 @@ func (h *Hospital) processResults(e *state.Event, logLocal *logging.SimulatedHos
 	if !e.Step.Result.ExpectCorrection {
 		o.NumberOfPreviousResults += len(o.Results)
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
+}
+
+func (h *Hospital) processVitals(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
+	msgHeader := h.generator.NewHeader(&e.Step)
+	patient := h.patients.Get(e.PatientMRN)
+	patientInfo := patient.PatientInfo
+
+	h.setAdmissionDetailsIfMissing(patientInfo, e.EventTime)
+	o := h.generator.VitalSigns(patientInfo, e.Step.Vitals, e.EventTime)
+	o.OrderControl = h.messageConfig.OrderControl.WithObservations
+	patient.AddOrder("", o)
+	h.updateDeathInfo(logLocal, now, e.PathwayName, patientInfo, e.Step.Parameters)
+
+	msg, err := message.BuildResultORUR01(msgHeader, patientInfo, o, e.MessageTime)
+	if err != nil {
+		return errors.Wrap(err, "cannot build ORU^R01 message")
+	}
+	o.NumberOfPreviousResults += len(o.Results)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) processClinicalNote(ctx context.Context, e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -173,7 +193,7 @@ func (h *Hospital) processClinicalNote(ctx context.Context, e *state.Event, logL
 		return errors.Wrapf(err, "cannot build ORU^R01 message")
 	}
 	o.NumberOfPreviousResults += len(o.Results)
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) processDocument(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -205,7 +225,7 @@ func (h *Hospital) processDocument(e *state.Event, logLocal *logging.SimulatedHo
 	if err != nil {
 		return errors.Wrap(err, "cannot build MDM^T02 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) processDischarge(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -246,7 +266,7 @@ func (h *Hospital) processDischarge(e *state.Event, logLocal *logging.SimulatedH
 	patient.PushPastVisit(patientInfo.VisitID)
 	patient = h.resetPatient(logLocal, pathwayName, patient, mrn)
 	h.patients.Put(patient)
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) processDischargeInError(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -266,7 +286,7 @@ func (h *Hospital) processDischargeInError(e *state.Event, logLocal *logging.Sim
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A03 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) processTransferOrTransferInError(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -324,7 +344,7 @@ func (h *Hospital) processTransferOrTransferInError(e *state.Event, logLocal *lo
 		return errors.Wrap(err, "cannot build ADT^A02 message")
 	}
 	patientInfo.PriorLocation = nil
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) cancelVisit(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -339,7 +359,7 @@ func (h *Hospital) cancelVisit(e *state.Event, logLocal *logging.SimulatedHospit
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A11 message")
 	}
-	if err := h.queueMessage(logLocal, msg, e); err != nil {
+	if err := h.queueStepMessage(logLocal, msg, e); err != nil {
 		return err
 	}
 	patient.PushPastVisit(patientInfo.VisitID)
@@ -364,7 +384,7 @@ func (h *Hospital) cancelTransfer(e *state.Event, logLocal *logging.SimulatedHos
 	patientInfo.TransferDate = ir.NewInvalidTime()
 	patientInfo.PriorLocation = nil
 	patientInfo.PriorLocationForCancelTransfer = nil
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) cancelDischarge(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -376,7 +396,7 @@ func (h *Hospital) cancelDischarge(e *state.Event, logLocal *logging.SimulatedHo
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A13 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) pendingAdmission(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -401,7 +421,7 @@ func (h *Hospital) pendingAdmission(e *state.Event, logLocal *logging.SimulatedH
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A14 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) pendingDischarge(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -422,7 +442,7 @@ func (h *Hospital) pendingDischarge(e *state.Event, logLocal *logging.SimulatedH
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A16 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) pendingTransfer(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -443,7 +463,7 @@ func (h *Hospital) pendingTransfer(e *state.Event, logLocal *logging.SimulatedHo
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A15 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) registration(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -468,7 +488,7 @@ func (h *Hospital) registration(e *state.Event, logLocal *logging.SimulatedHospi
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A04 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) preadmission(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -488,7 +508,7 @@ func (h *Hospital) preadmission(e *state.Event, logLocal *logging.SimulatedHospi
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A05 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) usePatient(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -532,7 +552,7 @@ func (h *Hospital) merge(e *state.Event, logLocal *logging.SimulatedHospitalLogg
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A34 or ADT^A40 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) bedSwap(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -562,7 +582,7 @@ func (h *Hospital) bedSwap(e *state.Event, logLocal *logging.SimulatedHospitalLo
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A17 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) addPerson(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -574,7 +594,7 @@ func (h *Hospital) addPerson(e *state.Event, logLocal *logging.SimulatedHospital
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A28 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) updatePerson(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -593,7 +613,7 @@ func (h *Hospital) updatePerson(e *state.Event, logLocal *logging.SimulatedHospi
 		return errors.Wrap(err, "cannot build ADT^A08 or ADT^A31 message")
 	}
 
-	if err := h.queueMessage(logLocal, msg, e); err != nil {
+	if err := h.queueStepMessage(logLocal, msg, e); err != nil {
 		return err
 	}
 
@@ -619,7 +639,7 @@ func (h *Hospital) cancelPendingAdmission(e *state.Event, logLocal *logging.Simu
 	h.freeSpecificLocation(logLocal, patientInfo.PriorPendingLocation, pathwayName)
 	patientInfo.PriorPendingLocation = nil
 	patientInfo.ExpectedAdmitDateTime = ir.NewInvalidTime()
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) cancelPendingTransfer(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -636,7 +656,7 @@ func (h *Hospital) cancelPendingTransfer(e *state.Event, logLocal *logging.Simul
 	h.freeSpecificLocation(logLocal, patientInfo.PriorPendingLocation, pathwayName)
 	patientInfo.PriorPendingLocation = nil
 	patientInfo.ExpectedTransferDateTime = ir.NewInvalidTime()
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) cancelPendingDischarge(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -648,7 +668,7 @@ func (h *Hospital) cancelPendingDischarge(e *state.Event, logLocal *logging.Simu
 		return errors.Wrap(err, "cannot build ADT^A25 message")
 	}
 	patientInfo.ExpectedDischargeDateTime = ir.NewInvalidTime()
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) deleteVisit(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -667,7 +687,7 @@ func (h *Hospital) deleteVisit(e *state.Event, logLocal *logging.SimulatedHospit
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A23 message")
 	}
-	if err := h.queueMessage(logLocal, msg, e); err != nil {
+	if err := h.queueStepMessage(logLocal, msg, e); err != nil {
 		return err
 	}
 	patientInfo.VisitID = thisVisitID
@@ -713,7 +733,7 @@ func (h *Hospital) trackDeparture(e *state.Event, logLocal *logging.SimulatedHos
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A09 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) trackArrival(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -771,7 +791,7 @@ func (h *Hospital) trackArrival(e *state.Event, logLocal *logging.SimulatedHospi
 	if err != nil {
 		return errors.Wrap(err, "cannot build ADT^A10 message")
 	}
-	return h.queueMessage(logLocal, msg, e)
+	return h.queueStepMessage(logLocal, msg, e)
 }
 
 func (h *Hospital) hardcodedMessage(e *state.Event, logLocal *logging.SimulatedHospitalLogger, now time.Time) error {
@@ -781,6 +801,7 @@ func (h *Hospital) hardcodedMessage(e *state.Event, logLocal *logging.SimulatedH
 	if err != nil {
 		return errors.Wrap(err, "cannot process HardcodedMessage event")
 	}
+	// Hardcoded messages are sent as they are defined, without the Z-segments of the step.
 	return h.queueMessage(logLocal, msg, e)
 }
 
@@ -814,6 +835,8 @@ func (h *Hospital) processEventType(ctx context.Context, e *state.Event, logLoca
 		return h.processOrder(e, logLocal, now)
 	case pathway.StepResults:
 		return h.processResults(e, logLocal, now)
+	case pathway.StepVitals:
+		return h.processVitals(e, logLocal, now)
 	case pathway.StepClinicalNote:
 		return h.processClinicalNote(ctx, e, logLocal, now)
 	case pathway.StepDocument:
@@ -24,6 +24,7 @@ import (
 	"github.com/google/simhospital/pkg/pathway"
 	"github.com/google/simhospital/pkg/processor"
 	"github.com/google/simhospital/pkg/state"
+	"github.com/google/simhospital/pkg/tracing"
 )
 
 // HasEvents returns whether there are events in the Event queue, independently of when they are due.
@@ -31,6 +32,47 @@ func (h *Hospital) HasEvents() bool {
 	return !h.eventQ.Empty()
 }
 
+// Events returns the events in the Event queue, in the order in which they will run.
+func (h *Hospital) Events() []state.Event {
+	var events []state.Event
+	for _, i := range h.eventQ.Items() {
+		if e, ok := i.(state.Event); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// CancelEvents removes the events of the patient with the given MRN from the Event queue, so that
+// the pathways of the patient don't progress any further, and returns the number of events removed.
+// Events of pathways with several patients are removed if any of the patients has the given MRN.
+// Messages that are already in the Message queue are not affected.
+func (h *Hospital) CancelEvents(mrn string) (int, error) {
+	n, err := h.eventQ.Remove(func(i state.MarshallableQueueItem) bool {
+		e, ok := i.(state.Event)
+		return ok && eventHasPatient(e, mrn)
+	})
+	if err != nil {
+		return n, errors.Wrapf(err, "cannot cancel the events of patient %s", mrn)
+	}
+	h.updateQueueLengths()
+	log.WithField(keyPatientID, mrn).Infof("Cancelled %d event(s)", n)
+	return n, nil
+}
+
+// eventHasPatient returns whether the given event refers to the patient with the given MRN.
+func eventHasPatient(e state.Event, mrn string) bool {
+	if e.PatientMRN == mrn {
+		return true
+	}
+	for _, m := range e.PatientIDs {
+		if m == mrn {
+			return true
+		}
+	}
+	return false
+}
+
 // runNextEvent consumes the next event from the Events queue and runs it.
 // runNextEvent returns an error if the queue is empty or there was any problem running the event.
 func (h *Hospital) runNextEvent(ctx context.Context) error {
@@ -63,6 +105,7 @@ func (h *Hospital) runNextEvent(ctx context.Context) error {
 	}
 
 	h.runEvent(ctx, event)
+	h.updateQueueLengths()
 
 	if consistentAfter := h.eventQ.IsConsistent(); !consistentAfter && consistentBefore {
 		counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
@@ -105,10 +148,12 @@ func (h *Hospital) queueFirstEvent(p pathway.Pathway, patientIDs map[pathway.Pat
 		IsHistorical:   len(p.History) > 0,
 		Index:          0,
 		PatientIDs:     patientIDs,
+		Trace:          h.tracer.NewTrace(),
 	}
 	if err := h.eventQ.Put(event); err != nil {
 		return err
 	}
+	h.updateQueueLengths()
 	if consistentAfter := h.eventQ.IsConsistent(); !consistentAfter && consistentBefore {
 		counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
 			"pathway_name": event.PathwayName,
@@ -118,14 +163,57 @@ func (h *Hospital) queueFirstEvent(p pathway.Pathway, patientIDs map[pathway.Pat
 	return nil
 }
 
-// runEvent: the default processing functionality builds the related HL7 msg and adds it
+// runEvent runs the event, and records the metrics and the spans of the event and, if the pathway
+// stops after this event, of the pathway.
+func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
+	start := h.clock.Now()
+	stepType := e.Step.StepType()
+	counters.SimulatedHospital.EventsTotal.With(prometheus.Labels{
+		"pathway_name": e.PathwayName,
+		"step_type":    stepType,
+	}).Inc()
+	if !e.IsHistorical {
+		lag := start.Sub(e.EventTime).Seconds()
+		if lag < 0 {
+			lag = 0
+		}
+		counters.SimulatedHospital.EventLagSeconds.With(prometheus.Labels{"step_type": stepType}).Observe(lag)
+	}
+
+	span := h.tracer.StartSpan(e.Trace, stepType, start)
+	span.SetAttributes(
+		tracing.String(keyPatientID, e.PatientMRN),
+		tracing.String(keyPathwayName, e.PathwayName),
+		tracing.Int(keyIndex, e.Index),
+		tracing.Bool(keyIsHistorical, e.IsHistorical))
+
+	finished, err := h.processEvent(ctx, &e)
+	// The control IDs are only taken when the ground truth is written, which doesn't happen if the
+	// event fails.
+	h.takeControlIDs(&e)
+	end := h.clock.Now()
+	span.SetError(err)
+	span.Finish(end)
+	if finished || err != nil {
+		pathwaySpan := h.tracer.ResumeSpan(e.Trace, e.PathwayName, e.PathwayStarted)
+		pathwaySpan.SetAttributes(
+			tracing.String(keyPatientID, e.PatientMRN),
+			tracing.String(keyPathwayName, e.PathwayName))
+		pathwaySpan.SetError(err)
+		pathwaySpan.Finish(end)
+	}
+}
+
+// processEvent: the default processing functionality builds the related HL7 msg and adds it
 // to the Message queue. This can be overridden with custom processing, and additionally, custom pre/post
 // processing logic can run before/after the override or the default processing. Finally, this method queues
 // the next event to be run as part of the pathway.
 // If there's an error (e.g. event pre/override/default/post processing logic fails, the message cannot be added
 // to the queue, etc.), the next event isn't added to the queue, and thus the entire pathway is stopped. In that
 // case the patient is deleted from the internal map.
-func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
+// processEvent returns whether the pathway has finished, and the error that stopped the pathway, if any.
+// e is updated with the changes made by the processing logic.
+func (h *Hospital) processEvent(ctx context.Context, e *state.Event) (bool, error) {
 	pathwayName := e.PathwayName
 	mrn := e.PatientMRN
 	logLocal := log.WithField(keyPathwayName, pathwayName).
@@ -137,7 +225,7 @@ func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
 			"pathway_name": e.PathwayName,
 			"reason":       "unknown_mrn",
 		}).Inc()
-		return
+		return false, errors.Errorf("unknown MRN %s in event", mrn)
 	}
 	patientInfo := patient.PatientInfo
 	// Advance the current time in the pathway, if needed.
@@ -153,51 +241,52 @@ func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
 		now = now.Add(e.Step.Delay.Random())
 	}
 
-	if _, err := h.runEventProcessors(logLocal, &e, patientInfo, h.processors.EventPre); err != nil {
+	if _, err := h.runEventProcessors(logLocal, e, patientInfo, h.processors.EventPre); err != nil {
 		logLocal.WithError(err).Error("event pre processing failed")
 		counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
 			"pathway_name": e.PathwayName,
 			"reason":       "event_pre_processor",
 		}).Inc()
-		return
+		return false, errors.Wrap(err, "event pre processing failed")
 	}
 
-	processed, err := h.runEventProcessors(logLocal, &e, patientInfo, h.processors.EventOverride)
+	processed, err := h.runEventProcessors(logLocal, e, patientInfo, h.processors.EventOverride)
 	if err != nil {
 		logLocal.WithError(err).Error("event override processing failed")
 		counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
 			"pathway_name": e.PathwayName,
 			"reason":       "event_override_processor",
 		}).Inc()
-		return
+		return false, errors.Wrap(err, "event override processing failed")
 	}
 
 	if !processed {
-		if err := h.processEventType(ctx, &e, logLocal, now); err != nil {
+		if err := h.processEventType(ctx, e, logLocal, now); err != nil {
 			logLocal.WithError(err).Errorf("cannot process event type %v, deleting patient", e.Step.StepType())
 			counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
 				"pathway_name": pathwayName,
 				"reason":       err.Error(),
 			}).Inc()
 			h.patients.Delete(e.PatientMRN)
-			return
+			return false, errors.Wrapf(err, "cannot process event type %v", e.Step.StepType())
 		}
 		// We make sure to persist the data in the internal map into the internal database before deleting it.
 		// If we don't do this, then the internal map and internal database get out of sync.
 		h.patients.Put(h.patients.Get(e.PatientMRN))
 	}
 
-	if _, err := h.runEventProcessors(logLocal, &e, patientInfo, h.processors.EventPost); err != nil {
+	if _, err := h.runEventProcessors(logLocal, e, patientInfo, h.processors.EventPost); err != nil {
 		logLocal.WithError(err).Error("event post processing failed")
 		counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
 			"pathway_name": e.PathwayName,
 			"reason":       "event_post_processor",
 		}).Inc()
-		return
+		return false, errors.Wrap(err, "event post processing failed")
 	}
 
 	// Event processing might have changed the patient's MRN.
 	mrn = e.PatientMRN
+	h.writeGroundTruth(logLocal, e)
 
 	// Queue the next event, if any.
 	first, history, pathwaySteps := getNextEvents(e.History, e.Pathway)
@@ -224,6 +313,7 @@ func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
 			IsHistorical:   len(e.History) > 0,
 			Index:          e.Index + 1,
 			PatientIDs:     e.PatientIDs,
+			Trace:          e.Trace,
 		}
 		if err := h.eventQ.Put(event); err != nil {
 			logLocal.WithError(err).Error("Failed to put the next event on the priority queue")
@@ -231,6 +321,7 @@ func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
 				"pathway_name": pathwayName,
 				"reason":       "Failed to put the next event on the priority queue",
 			}).Inc()
+			return false, errors.Wrap(err, "cannot queue the next event")
 		}
 		if consistentAfter := h.eventQ.IsConsistent(); !consistentAfter && consistentBefore {
 			counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
@@ -255,6 +346,7 @@ func (h *Hospital) runEvent(ctx context.Context, e state.Event) {
 			}).Observe(now.Sub(e.PathwayStarted).Minutes())
 		}
 	}
+	return first == nil, nil
 }
 
 // getNextEvents gets the first event to be run, either from the historical steps or the pathway (if
@@ -0,0 +1,98 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hospital
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/google/simhospital/pkg/groundtruth"
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/state"
+)
+
+// controlIDs keeps the control IDs of the messages queued by the events that are running, so that
+// they can be included in the ground truth.
+type controlIDs struct {
+	mu      sync.Mutex
+	byEvent map[*state.Event][]string
+}
+
+// recordControlID keeps the control ID of a message queued by the given event.
+func (h *Hospital) recordControlID(msg *message.HL7Message, e *state.Event) {
+	if h.groundTruth == nil {
+		return
+	}
+	if id := message.ControlID(msg.Message); id != "" {
+		h.controlIDs.mu.Lock()
+		defer h.controlIDs.mu.Unlock()
+		h.controlIDs.byEvent[e] = append(h.controlIDs.byEvent[e], id)
+	}
+}
+
+// takeControlIDs returns the control IDs of the messages queued by the given event, and forgets them.
+func (h *Hospital) takeControlIDs(e *state.Event) []string {
+	h.controlIDs.mu.Lock()
+	defer h.controlIDs.mu.Unlock()
+	ids := h.controlIDs.byEvent[e]
+	delete(h.controlIDs.byEvent, e)
+	return ids
+}
+
+// writeGroundTruth writes the snapshots of the patients of the event that has just run.
+// Errors are logged, but they don't stop the pathway.
+func (h *Hospital) writeGroundTruth(logLocal *logging.SimulatedHospitalLogger, e *state.Event) {
+	if h.groundTruth == nil {
+		return
+	}
+	tags := groundtruth.Tags{
+		PathwayName: e.PathwayName,
+		StepIndex:   e.Index,
+		StepType:    e.Step.StepType(),
+		Historical:  e.IsHistorical,
+		EventTime:   e.EventTime,
+		ControlIDs:  h.takeControlIDs(e),
+	}
+	for _, mrn := range eventMRNs(e) {
+		p := h.patients.Get(mrn)
+		if p == nil {
+			continue
+		}
+		if err := h.groundTruth.Write(groundtruth.NewSnapshot(p.PatientInfo, tags)); err != nil {
+			logLocal.WithError(err).Error("Cannot write the ground truth")
+			counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
+				"pathway_name": e.PathwayName,
+				"reason":       "ground_truth",
+			}).Inc()
+		}
+	}
+}
+
+// eventMRNs returns the MRNs of the patients of the event, starting with the current patient.
+func eventMRNs(e *state.Event) []string {
+	mrns := []string{e.PatientMRN}
+	seen := map[string]bool{e.PatientMRN: true}
+	for _, mrn := range e.PatientIDs {
+		if !seen[mrn] {
+			seen[mrn] = true
+			mrns = append(mrns, mrn)
+		}
+	}
+	// PatientIDs is a map, so sort the other patients for the output to be deterministic.
+	sort.Strings(mrns[1:])
+	return mrns
+}
@@ -17,11 +17,14 @@ package hospital
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/logging"
 	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/provenance"
 	"github.com/google/simhospital/pkg/state"
 )
 
@@ -30,6 +33,17 @@ func (h *Hospital) HasMessages() bool {
 	return !h.messageQ.Empty()
 }
 
+// Messages returns the messages in the Message queue, in the order in which they will be processed.
+func (h *Hospital) Messages() []state.HL7Message {
+	var messages []state.HL7Message
+	for _, i := range h.messageQ.Items() {
+		if m, ok := i.(state.HL7Message); ok {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
 // processNextMessage consumes the next message from the Message queue and processes it.
 // processNextMessage returns an error if the queue is empty or there was any problem processing the message.
 func (h *Hospital) processNextMessage() error {
@@ -47,6 +61,7 @@ func (h *Hospital) processNextMessage() error {
 		}).Inc()
 		return errors.Wrap(err, "failed to get message from queue")
 	}
+	h.updateQueueLengths()
 	item := *i
 	m, ok := item.(state.HL7Message)
 	if !ok {
@@ -98,7 +113,13 @@ func (h *Hospital) processMessage(m state.HL7Message) error {
 	if !processed {
 		logLocal.Info("Sending message")
 		logLocal.WithField(keyMessage, m).Debug("Sending message")
-		if err := h.sender.Send([]byte(m.Message.Message)); err != nil {
+		if h.validation != nil {
+			h.validateMessage(logLocal, m)
+		}
+		sendStart := time.Now()
+		err := h.sender.Send([]byte(m.Message.Message))
+		counters.SimulatedHospital.SendLatencySeconds.Observe(time.Since(sendStart).Seconds())
+		if err != nil {
 			counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
 				"pathway_name": m.PathwayName,
 				"reason":       "send_message",
@@ -107,10 +128,14 @@ func (h *Hospital) processMessage(m state.HL7Message) error {
 		}
 		counters.SimulatedHospital.MessagesTotal.With(prometheus.Labels{
 			"pathway_name":  m.PathwayName,
+			"step_type":     messageStepType(m),
 			"message_type":  strings.ToLower(m.Message.Type.MessageType),
 			"trigger_event": m.Message.Type.TriggerEvent,
 		}).Inc()
 		counters.SimulatedHospital.MessageDelaySeconds.Observe(h.clock.Now().UTC().Sub(m.MessageTime.UTC()).Seconds())
+		if h.messageLog != nil {
+			h.messageLog.Add(h.clock.Now(), m)
+		}
 	}
 
 	if _, err := runMessageProcessors(logLocal, &m, h.processors.MessagePost); err != nil {
@@ -123,6 +148,33 @@ func (h *Hospital) processMessage(m state.HL7Message) error {
 	return nil
 }
 
+// messageStepType returns the type of the step that created the message.
+func messageStepType(m state.HL7Message) string {
+	if m.Event == nil {
+		return unknown
+	}
+	return m.Event.Step.StepType()
+}
+
+// validateMessage validates the message and logs the validation issues, if any.
+func (h *Hospital) validateMessage(logLocal *logging.SimulatedHospitalLogger, m state.HL7Message) {
+	labels := prometheus.Labels{
+		"pathway_name":  m.PathwayName,
+		"message_type":  strings.ToLower(m.Message.Type.MessageType),
+		"trigger_event": m.Message.Type.TriggerEvent,
+	}
+	parsed, err := hl7.ParseMessage([]byte(m.Message.Message))
+	if err != nil {
+		logLocal.WithError(err).Warning("Invalid message: the message cannot be parsed")
+		counters.SimulatedHospital.InvalidMessagesTotal.With(labels).Inc()
+		return
+	}
+	if issues := hl7.Validate(parsed, h.validation); len(issues) > 0 {
+		logLocal.WithError(issues).Warningf("Invalid message: %d validation issues", len(issues))
+		counters.SimulatedHospital.InvalidMessagesTotal.With(labels).Inc()
+	}
+}
+
 func runMessageProcessors(logLocal *logging.SimulatedHospitalLogger, m *state.HL7Message, ps []MessageProcessor) (bool, error) {
 	processed := false
 	for _, p := range ps {
@@ -138,7 +190,46 @@ func runMessageProcessors(logLocal *logging.SimulatedHospitalLogger, m *state.HL
 	return processed, nil
 }
 
+// queueStepMessage queues the message generated by the step of the event, with the Z-segments set
+// in the parameters of the step.
+func (h *Hospital) queueStepMessage(logLocal *logging.SimulatedHospitalLogger, msg *message.HL7Message, e *state.Event) error {
+	segments, err := message.BuildZSegments(e.Step.Parameters.ZSegmentFields())
+	if err != nil {
+		return errors.Wrap(err, "cannot build the Z-segments of the step")
+	}
+	if len(segments) > 0 {
+		withZSegments := *msg
+		withZSegments.Message = strings.Join(append([]string{msg.Message}, segments...), message.SegmentTerminator)
+		msg = &withZSegments
+	}
+	return h.queueMessage(logLocal, msg, e)
+}
+
 func (h *Hospital) queueMessage(logLocal *logging.SimulatedHospitalLogger, msg *message.HL7Message, e *state.Event) error {
+	if h.provenance != nil {
+		source := provenance.Source{
+			PathwayName: e.PathwayName,
+			StepIndex:   e.Index,
+			StepType:    e.Step.StepType(),
+			Historical:  e.IsHistorical,
+		}
+		var err error
+		if e.Step.HardcodedMessage != nil {
+			// Hardcoded messages are sent as they are defined, and may be invalid on purpose, so they
+			// are not tagged with the provenance segment; only their provenance is logged.
+			err = h.provenance.Log(msg, e.PatientMRN, source)
+		} else {
+			msg, err = h.provenance.Tag(msg, e.PatientMRN, source)
+		}
+		if err != nil {
+			// The message is sent anyway, tagged if possible: only the provenance is incomplete.
+			logLocal.WithError(err).Error("Cannot tag or log the provenance of the message")
+			counters.SimulatedHospital.ErrorsTotal.With(prometheus.Labels{
+				"pathway_name": e.PathwayName,
+				"reason":       "provenance",
+			}).Inc()
+		}
+	}
 	name := fmt.Sprintf("%s^%s-%s", msg.Type.MessageType, msg.Type.TriggerEvent, e.PatientMRN)
 	*logLocal = *logLocal.
 		WithField(keyMessageName, name).
@@ -153,6 +244,7 @@ func (h *Hospital) queueMessage(logLocal *logging.SimulatedHospitalLogger, msg *
 		Message:      msg,
 		MessageTime:  e.MessageTime,
 		IsHistorical: e.IsHistorical,
+		Event:        e,
 	})
 	if err != nil {
 		logLocal.WithError(err).Error("Failed to put the message on the priority queue")
@@ -162,5 +254,6 @@ func (h *Hospital) queueMessage(logLocal *logging.SimulatedHospitalLogger, msg *
 		}).Inc()
 		return errors.New("failed to put the message on the priority queue")
 	}
+	h.recordControlID(msg, e)
 	return nil
 }
@@ -0,0 +1,607 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v2"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/messagelog"
+	"github.com/google/simhospital/pkg/starter"
+	"github.com/google/simhospital/pkg/state"
+)
+
+// apiVersion is the version of the control API, which is part of the path of all of its endpoints.
+const apiVersion = "v1"
+
+// Patient statuses.
+const (
+	statusRegistered = "registered"
+	statusAdmitted   = "admitted"
+	statusDischarged = "discharged"
+)
+
+// Run statuses.
+const (
+	runRunning  = "running"
+	runFinished = "finished"
+)
+
+// startRequest is the body of a request to start a pathway.
+// Exactly one of PathwayName and Definition must be set.
+type startRequest struct {
+	PathwayName string `json:"pathway_name"`
+	// Definition is a pathway in YAML or JSON format, as in the pathway config files.
+	Definition string `json:"definition"`
+	MRN        string `json:"mrn"`
+	FirstName  string `json:"first_name"`
+	Surname    string `json:"surname"`
+}
+
+// run is a pathway started through the control API.
+type run struct {
+	ID          string        `json:"run_id"`
+	PathwayName string        `json:"pathway_name"`
+	Started     time.Time     `json:"started"`
+	Patients    []runPatient  `json:"patients"`
+	Status      string        `json:"status,omitempty"`
+	Pending     *pendingItems `json:"pending,omitempty"`
+}
+
+// runPatient is a patient a run was started for.
+type runPatient struct {
+	MRN       string `json:"mrn"`
+	FirstName string `json:"first_name"`
+	Surname   string `json:"surname"`
+}
+
+// pendingItems are the number of events and messages that are queued.
+type pendingItems struct {
+	Events   int `json:"events"`
+	Messages int `json:"messages"`
+}
+
+// pathwayResponse is the definition of a pathway.
+type pathwayResponse struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// patientResponse is a patient with their current location and status.
+type patientResponse struct {
+	MRN             string     `json:"mrn"`
+	FirstName       string     `json:"first_name"`
+	Surname         string     `json:"surname"`
+	Gender          string     `json:"gender,omitempty"`
+	Class           string     `json:"class,omitempty"`
+	Status          string     `json:"status"`
+	Location        string     `json:"location,omitempty"`
+	PendingLocation string     `json:"pending_location,omitempty"`
+	AdmissionDate   *time.Time `json:"admission_date,omitempty"`
+	DischargeDate   *time.Time `json:"discharge_date,omitempty"`
+	PendingEvents   int        `json:"pending_events"`
+}
+
+// eventResponse is an event in the event queue.
+type eventResponse struct {
+	EventTime   time.Time `json:"event_time"`
+	MessageTime time.Time `json:"message_time"`
+	PathwayName string    `json:"pathway_name"`
+	MRN         string    `json:"mrn"`
+	StepType    string    `json:"step_type"`
+	StepIndex   int       `json:"step_index"`
+	Historical  bool      `json:"historical"`
+}
+
+// messageResponse is a message in the message queue.
+type messageResponse struct {
+	Name        string    `json:"name"`
+	MessageTime time.Time `json:"message_time"`
+	PathwayName string    `json:"pathway_name"`
+	MRN         string    `json:"mrn,omitempty"`
+	MessageType string    `json:"message_type,omitempty"`
+	Historical  bool      `json:"historical"`
+	Message     string    `json:"message"`
+}
+
+// rateResponse is the rate at which pathways are started.
+type rateResponse struct {
+	PathwaysPerHour *float64 `json:"pathways_per_hour"`
+}
+
+// stepResponse is the result of stepping through a paused simulation.
+type stepResponse struct {
+	// Event is the event that ran, or nil if there were no events.
+	Event        *eventResponse `json:"event"`
+	MessagesSent int            `json:"messages_sent"`
+}
+
+// errorResponse is the body of the responses of requests that fail.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// maxRuns is the maximum number of runs that are kept. When more runs are started, the oldest ones
+// are forgotten and cannot be retrieved anymore.
+var maxRuns = 1000
+
+// controlAPI implements a JSON API to control the Simulated Hospital programmatically.
+type controlAPI struct {
+	h *Hospital
+	// mu guards runs and runIDs.
+	mu   sync.Mutex
+	runs map[string]*run
+	// runIDs are the IDs of the runs, from oldest to newest.
+	runIDs []string
+}
+
+// endpoints returns the endpoints of the control API, relative to the API root path.
+func (a *controlAPI) endpoints() []APIEndpointAndHandler {
+	endpoint := func(method, path string, handler func(http.ResponseWriter, *http.Request)) APIEndpointAndHandler {
+		return APIEndpointAndHandler{
+			EndpointAndHandler: EndpointAndHandler{Endpoint: fmt.Sprintf("%s/%s", apiVersion, path), Handler: handler},
+			HTTPMethod:         method,
+		}
+	}
+	return []APIEndpointAndHandler{
+		endpoint(http.MethodPost, "runs", a.startRun),
+		endpoint(http.MethodGet, "runs/{id}", a.getRun),
+		endpoint(http.MethodGet, "pathways", a.listPathways),
+		endpoint(http.MethodGet, "pathways/{name}", a.getPathway),
+		endpoint(http.MethodGet, "patients", a.listPatients),
+		endpoint(http.MethodGet, "patients/{mrn}", a.getPatient),
+		endpoint(http.MethodDelete, "patients/{mrn}/events", a.cancelEvents),
+		endpoint(http.MethodGet, "patients/{mrn}/messages", a.listPatientMessages),
+		endpoint(http.MethodGet, "events", a.listEvents),
+		endpoint(http.MethodGet, "messages", a.listMessages),
+		endpoint(http.MethodGet, "messages/sent", a.searchSentMessages),
+		endpoint(http.MethodGet, "messages/sent/{id}", a.getSentMessage),
+		endpoint(http.MethodGet, "rate", a.getRate),
+		endpoint(http.MethodPut, "rate", a.setRate),
+		endpoint(http.MethodGet, "simulation", a.getSimulation),
+		endpoint(http.MethodPost, "simulation/pause", a.pause),
+		endpoint(http.MethodPost, "simulation/resume", a.resume),
+		endpoint(http.MethodPost, "simulation/step", a.step),
+		endpoint(http.MethodPost, "simulation/drain", a.drain),
+		endpoint(http.MethodGet, "board", a.getBoard),
+	}
+}
+
+// startRun starts a pathway and returns the run, including the MRNs of its patients.
+func (a *controlAPI) startRun(w http.ResponseWriter, r *http.Request) {
+	if a.h.pathwayStarter == nil {
+		writeError(w, http.StatusNotImplemented, "pathways cannot be started: no pathway starter is configured")
+		return
+	}
+	var req startRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot decode request: %v", err))
+		return
+	}
+	name, persons, err := a.h.pathwayStarter.StartPathway(starter.PathwayRequest{
+		Name:       req.PathwayName,
+		Definition: req.Definition,
+		MRN:        req.MRN,
+		FirstName:  req.FirstName,
+		Surname:    req.Surname,
+	})
+	if err != nil {
+		log.WithError(err).Error("Cannot start pathway from the control API")
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	started := &run{
+		ID:          uuid.New().String(),
+		PathwayName: name,
+		Started:     a.h.clock.Now(),
+		Patients:    runPatients(persons),
+	}
+	a.addRun(started)
+	log.WithField("run_id", started.ID).WithField("pathway_name", name).Info("Pathway started from the control API")
+	writeJSON(w, http.StatusCreated, a.withStatus(started))
+}
+
+// getRun returns a run started with startRun, and whether it is still running.
+func (a *controlAPI) getRun(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	a.mu.Lock()
+	found, ok := a.runs[id]
+	a.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("run %q not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, a.withStatus(found))
+}
+
+// addRun adds a run, and forgets the oldest run if there are more than maxRuns.
+func (a *controlAPI) addRun(r *run) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.runs[r.ID] = r
+	a.runIDs = append(a.runIDs, r.ID)
+	if len(a.runIDs) > maxRuns {
+		delete(a.runs, a.runIDs[0])
+		a.runIDs = a.runIDs[1:]
+	}
+}
+
+// withStatus returns a copy of the given run with its status and the number of its pending events
+// and messages. The events and messages of a run are the ones of the run's pathway for the run's
+// patients, so runs of the same pathway for the same patients that overlap are not distinguished.
+func (a *controlAPI) withStatus(r *run) *run {
+	mrns := map[string]bool{}
+	for _, p := range r.Patients {
+		mrns[p.MRN] = true
+	}
+	pending := &pendingItems{}
+	for _, e := range a.h.hospital.Events() {
+		if e.PathwayName == r.PathwayName && eventHasPatient(e, mrns) {
+			pending.Events++
+		}
+	}
+	for _, m := range a.h.hospital.Messages() {
+		if m.PathwayName == r.PathwayName && m.Event != nil && eventHasPatient(*m.Event, mrns) {
+			pending.Messages++
+		}
+	}
+	withStatus := *r
+	withStatus.Pending = pending
+	withStatus.Status = runFinished
+	if pending.Events > 0 || pending.Messages > 0 {
+		withStatus.Status = runRunning
+	}
+	return &withStatus
+}
+
+// listPathways returns the names of the pathways that can be started by name.
+func (a *controlAPI) listPathways(w http.ResponseWriter, r *http.Request) {
+	names := a.h.hospital.PathwayNames()
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"pathways": names})
+}
+
+// getPathway returns the definition of a pathway in YAML format.
+func (a *controlAPI) getPathway(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	p, err := a.h.hospital.GetPathway(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pathway %q not found", name))
+		return
+	}
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("cannot marshal pathway %q: %v", name, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, pathwayResponse{Name: name, Definition: string(b)})
+}
+
+// listPatients returns the patients in memory with their current location and status.
+func (a *controlAPI) listPatients(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]patientResponse{"patients": a.patients("")})
+}
+
+// getPatient returns a patient with their current location and status.
+func (a *controlAPI) getPatient(w http.ResponseWriter, r *http.Request) {
+	mrn := mux.Vars(r)["mrn"]
+	patients := a.patients(mrn)
+	if len(patients) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("patient %q not found", mrn))
+		return
+	}
+	writeJSON(w, http.StatusOK, patients[0])
+}
+
+// cancelEvents removes the remaining events of a patient from the event queue.
+// The events are cancelled while no events are running, so that a running event of the patient
+// cannot queue the patient's next event after they are cancelled.
+func (a *controlAPI) cancelEvents(w http.ResponseWriter, r *http.Request) {
+	mrn := mux.Vars(r)["mrn"]
+	a.h.control.processing.Lock()
+	exists := a.h.hospital.PatientExists(mrn)
+	var n int
+	var err error
+	if exists {
+		n, err = a.h.hospital.CancelEvents(mrn)
+	}
+	a.h.control.processing.Unlock()
+	switch {
+	case !exists:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("patient %q not found", mrn))
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, map[string]int{"cancelled_events": n})
+	}
+}
+
+// listEvents returns the events in the event queue, in the order in which they will run.
+func (a *controlAPI) listEvents(w http.ResponseWriter, r *http.Request) {
+	events := []eventResponse{}
+	for _, e := range a.h.hospital.Events() {
+		events = append(events, toEventResponse(e))
+	}
+	writeJSON(w, http.StatusOK, map[string][]eventResponse{"events": events})
+}
+
+// listMessages returns the messages in the message queue, in the order in which they will be sent.
+func (a *controlAPI) listMessages(w http.ResponseWriter, r *http.Request) {
+	messages := []messageResponse{}
+	for _, m := range a.h.hospital.Messages() {
+		resp := messageResponse{
+			Name:        m.Name,
+			MessageTime: m.MessageTime,
+			PathwayName: m.PathwayName,
+			Historical:  m.IsHistorical,
+		}
+		if m.Event != nil {
+			resp.MRN = m.Event.PatientMRN
+		}
+		if m.Message != nil {
+			resp.Message = m.Message.Message
+			if m.Message.Type != nil {
+				resp.MessageType = fmt.Sprintf("%s^%s", m.Message.Type.MessageType, m.Message.Type.TriggerEvent)
+			}
+		}
+		messages = append(messages, resp)
+	}
+	writeJSON(w, http.StatusOK, map[string][]messageResponse{"messages": messages})
+}
+
+// searchSentMessages returns the sent messages that match the parameters of the request, in the
+// order in which they were sent.
+func (a *controlAPI) searchSentMessages(w http.ResponseWriter, r *http.Request) {
+	l := a.h.hospital.MessageLog()
+	if l == nil {
+		writeError(w, http.StatusNotImplemented, errNoMessageLog.Error())
+		return
+	}
+	q, err := messageLogQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, searchMessageLog(l, q))
+}
+
+// getSentMessage returns a sent message, in the format in the "format" parameter of the request.
+func (a *controlAPI) getSentMessage(w http.ResponseWriter, r *http.Request) {
+	l := a.h.hospital.MessageLog()
+	if l == nil {
+		writeError(w, http.StatusNotImplemented, errNoMessageLog.Error())
+		return
+	}
+	e, code, err := sentMessage(l, mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, code, err.Error())
+		return
+	}
+	writeSentMessage(w, e, r.FormValue("format"), writeError)
+}
+
+// listPatientMessages returns the timeline of the messages sent for a patient, in the order in
+// which they were sent.
+func (a *controlAPI) listPatientMessages(w http.ResponseWriter, r *http.Request) {
+	l := a.h.hospital.MessageLog()
+	if l == nil {
+		writeError(w, http.StatusNotImplemented, errNoMessageLog.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, searchMessageLog(l, messagelog.Query{MRN: mux.Vars(r)["mrn"]}))
+}
+
+// getRate returns the number of pathways started per hour.
+func (a *controlAPI) getRate(w http.ResponseWriter, r *http.Request) {
+	rate := a.h.pathwayRateController.Rate()
+	writeJSON(w, http.StatusOK, rateResponse{PathwaysPerHour: &rate})
+}
+
+// setRate sets the number of pathways started per hour.
+func (a *controlAPI) setRate(w http.ResponseWriter, r *http.Request) {
+	var req rateResponse
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot decode request: %v", err))
+		return
+	}
+	if req.PathwaysPerHour == nil {
+		writeError(w, http.StatusBadRequest, "pathways_per_hour must be set")
+		return
+	}
+	if err := a.h.pathwayRateController.SetRate(*req.PathwaysPerHour); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.getRate(w, r)
+}
+
+// getSimulation returns the state of the simulation loop.
+func (a *controlAPI) getSimulation(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.h.State())
+}
+
+// pause pauses the simulation.
+func (a *controlAPI) pause(w http.ResponseWriter, r *http.Request) {
+	a.h.Pause()
+	a.getSimulation(w, r)
+}
+
+// resume resumes the simulation.
+func (a *controlAPI) resume(w http.ResponseWriter, r *http.Request) {
+	a.h.Resume()
+	a.getSimulation(w, r)
+}
+
+// drain stops starting pathways, and ends the simulation once the queues are empty.
+func (a *controlAPI) drain(w http.ResponseWriter, r *http.Request) {
+	a.h.Drain()
+	a.getSimulation(w, r)
+}
+
+// getBoard returns a snapshot of the wards, the patients in their beds and the census.
+func (a *controlAPI) getBoard(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.h.board())
+}
+
+// step runs the next event of a paused simulation, and sends its messages.
+func (a *controlAPI) step(w http.ResponseWriter, r *http.Request) {
+	e, n, err := a.h.Step(r.Context())
+	switch {
+	case err == ErrNotPaused:
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := stepResponse{MessagesSent: n}
+	if e != nil {
+		event := toEventResponse(*e)
+		resp.Event = &event
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// patients returns the patients in memory with their current location and status, or only the
+// patient with the given MRN if it is not empty. The patients are read while no events are running,
+// since events modify them.
+func (a *controlAPI) patients(mrn string) []patientResponse {
+	a.h.control.processing.Lock()
+	defer a.h.control.processing.Unlock()
+	pending := a.pendingEventsPerPatient()
+	patients := []patientResponse{}
+	for _, p := range a.h.hospital.Patients() {
+		if mrn == "" || p.PatientInfo.Person.MRN == mrn {
+			patients = append(patients, toPatientResponse(p, pending))
+		}
+	}
+	return patients
+}
+
+// pendingEventsPerPatient returns the number of queued events per patient MRN.
+func (a *controlAPI) pendingEventsPerPatient() map[string]int {
+	pending := map[string]int{}
+	for _, e := range a.h.hospital.Events() {
+		mrns := map[string]bool{e.PatientMRN: true}
+		for _, mrn := range e.PatientIDs {
+			mrns[mrn] = true
+		}
+		for mrn := range mrns {
+			pending[mrn]++
+		}
+	}
+	return pending
+}
+
+// eventHasPatient returns whether the given event refers to any of the given MRNs.
+func eventHasPatient(e state.Event, mrns map[string]bool) bool {
+	if mrns[e.PatientMRN] {
+		return true
+	}
+	for _, mrn := range e.PatientIDs {
+		if mrns[mrn] {
+			return true
+		}
+	}
+	return false
+}
+
+func runPatients(persons []*ir.Person) []runPatient {
+	patients := make([]runPatient, len(persons))
+	for i, p := range persons {
+		patients[i] = runPatient{MRN: p.MRN, FirstName: p.FirstName, Surname: p.Surname}
+	}
+	return patients
+}
+
+func toPatientResponse(p *state.Patient, pendingEvents map[string]int) patientResponse {
+	info := p.PatientInfo
+	resp := patientResponse{
+		MRN:           info.Person.MRN,
+		FirstName:     info.Person.FirstName,
+		Surname:       info.Person.Surname,
+		Gender:        info.Person.Gender,
+		Class:         info.Class,
+		Status:        patientStatus(p),
+		AdmissionDate: optionalTime(info.AdmissionDate),
+		DischargeDate: optionalTime(info.DischargeDate),
+		PendingEvents: pendingEvents[info.Person.MRN],
+	}
+	if info.Location != nil {
+		resp.Location = info.Location.Name()
+	}
+	if info.PendingLocation != nil {
+		resp.PendingLocation = info.PendingLocation.Name()
+	}
+	return resp
+}
+
+// patientStatus returns whether the patient has been admitted, discharged after their last
+// admission, or neither.
+// Discharging a patient resets their visit and moves it to the past visits, so patients without a
+// current admission that have past visits are reported as discharged.
+func patientStatus(p *state.Patient) string {
+	info := p.PatientInfo
+	switch {
+	case info.DischargeDate.Valid && (!info.AdmissionDate.Valid || !info.DischargeDate.Before(info.AdmissionDate.Time)):
+		return statusDischarged
+	case info.AdmissionDate.Valid:
+		return statusAdmitted
+	case len(p.PastVisits) > 0:
+		return statusDischarged
+	default:
+		return statusRegistered
+	}
+}
+
+func toEventResponse(e state.Event) eventResponse {
+	return eventResponse{
+		EventTime:   e.EventTime,
+		MessageTime: e.MessageTime,
+		PathwayName: e.PathwayName,
+		MRN:         e.PatientMRN,
+		StepType:    e.Step.StepType(),
+		StepIndex:   e.Index,
+		Historical:  e.IsHistorical,
+	}
+}
+
+func optionalTime(t ir.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("Cannot write control API response")
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
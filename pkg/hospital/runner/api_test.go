@@ -0,0 +1,489 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/hospital"
+	"github.com/google/simhospital/pkg/messagelog"
+	"github.com/google/simhospital/pkg/starter"
+	"github.com/google/simhospital/pkg/test/testclock"
+	"github.com/google/simhospital/pkg/test/testhospital"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+const testAPIKey = "test-key"
+
+// apiClient does requests to the control API.
+type apiClient struct {
+	t    *testing.T
+	url  string
+	auth string
+}
+
+// do does a request with the given method, path and body, decodes the response into resp if it is
+// not nil, and returns the status code.
+func (c *apiClient) do(method string, path string, body interface{}, resp interface{}) int {
+	c.t.Helper()
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			c.t.Fatalf("json.Marshal(%v) failed with %v", body, err)
+		}
+	}
+	url := fmt.Sprintf("%s/uri/api/v1/%s", c.url, path)
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		c.t.Fatalf("http.NewRequest(%s, %s) failed with %v", method, url, err)
+	}
+	req.Header.Add("Authorization", c.auth)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("http.DefaultClient.Do(%v) failed with %v", req, err)
+	}
+	defer res.Body.Close()
+	if resp != nil {
+		if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+			c.t.Fatalf("Decode() response of %s %s failed with %v", method, url, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func newTestAPI(ctx context.Context, t *testing.T) (*testhospital.Hospital, *apiClient) {
+	t.Helper()
+	b := []byte(`
+test_pathway:
+  pathway:
+    - admission:
+        loc: Renal
+    - discharge: {}`)
+	hl7.TimezoneAndLocation("Europe/London")
+	args := testhospital.Arguments
+	args.PathwayArguments = &hospital.PathwayArguments{Dir: testwrite.BytesToDir(t, b, "pathway.yml"), Type: "distribution"}
+	args.MessageLogSize = 10
+	h := testhospital.New(ctx, t, testhospital.Config{Arguments: args})
+
+	r, err := New(h.Hospital, Config{
+		DashboardURI:           "uri",
+		DashboardAddress:       ":0000",
+		DashboardStaticDir:     "static",
+		AuthenticatedAPIConfig: APIConfig{APIPort: ":0000", APIKey: testAPIKey},
+		PathwayStarter:         &starter.PathwayStarter{Hospital: h.Hospital, Parser: h.Parser, PathwayManager: h.PathwayManager, Sender: h.Sender},
+		Clock:                  testclock.New(time.Now()),
+	})
+	if err != nil {
+		t.Fatalf("New() failed with %v", err)
+	}
+	ts := httptest.NewServer(r.setupAuthenticatedEndpoints())
+	t.Cleanup(ts.Close)
+	return h, &apiClient{t: t, url: ts.URL, auth: testAPIKey}
+}
+
+func TestControlAPI_Runs(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	var pathways map[string][]string
+	if code := c.do(http.MethodGet, "pathways", nil, &pathways); code != http.StatusOK {
+		t.Fatalf("GET pathways got code %d, want %d", code, http.StatusOK)
+	}
+	if diff := cmp.Diff(map[string][]string{"pathways": {"test_pathway"}}, pathways); diff != "" {
+		t.Errorf("GET pathways got diff (-want +got):\n%s", diff)
+	}
+
+	var started run
+	req := startRequest{PathwayName: "test_pathway", FirstName: "Jane", Surname: "Doe"}
+	if code := c.do(http.MethodPost, "runs", req, &started); code != http.StatusCreated {
+		t.Fatalf("POST runs got code %d, want %d", code, http.StatusCreated)
+	}
+	if started.ID == "" {
+		t.Error("POST runs got empty run ID")
+	}
+	if got, want := len(started.Patients), 1; got != want {
+		t.Fatalf("POST runs got %d patients, want %d", got, want)
+	}
+	mrn := started.Patients[0].MRN
+	if mrn == "" {
+		t.Error("POST runs got empty MRN")
+	}
+	if diff := cmp.Diff(runPatient{MRN: mrn, FirstName: "Jane", Surname: "Doe"}, started.Patients[0]); diff != "" {
+		t.Errorf("POST runs got patient diff (-want +got):\n%s", diff)
+	}
+	if got, want := started.Status, runRunning; got != want {
+		t.Errorf("POST runs got status %q, want %q", got, want)
+	}
+
+	var patient patientResponse
+	if code := c.do(http.MethodGet, "patients/"+mrn, nil, &patient); code != http.StatusOK {
+		t.Fatalf("GET patients/%s got code %d, want %d", mrn, code, http.StatusOK)
+	}
+	if got, want := patient.Status, statusRegistered; got != want {
+		t.Errorf("GET patients/%s got status %q, want %q", mrn, got, want)
+	}
+	if got, want := patient.PendingEvents, 1; got != want {
+		t.Errorf("GET patients/%s got %d pending events, want %d", mrn, got, want)
+	}
+
+	var events map[string][]eventResponse
+	if code := c.do(http.MethodGet, "events", nil, &events); code != http.StatusOK {
+		t.Fatalf("GET events got code %d, want %d", code, http.StatusOK)
+	}
+	if got, want := len(events["events"]), 1; got != want {
+		t.Fatalf("GET events got %d events, want %d", got, want)
+	}
+	if got, want := events["events"][0].StepType, "Admission"; got != want {
+		t.Errorf("GET events got step type %q, want %q", got, want)
+	}
+
+	// Running the admission queues the admission message and the discharge event.
+	if ran, err := h.RunNextEventIfDue(ctx); !ran || err != nil {
+		t.Fatalf("RunNextEventIfDue() got (%v, %v), want (true, nil)", ran, err)
+	}
+	var messages map[string][]messageResponse
+	if code := c.do(http.MethodGet, "messages", nil, &messages); code != http.StatusOK {
+		t.Fatalf("GET messages got code %d, want %d", code, http.StatusOK)
+	}
+	if got, want := len(messages["messages"]), 1; got != want {
+		t.Fatalf("GET messages got %d messages, want %d", got, want)
+	}
+	if got, want := messages["messages"][0].MessageType, "ADT^A01"; got != want {
+		t.Errorf("GET messages got message type %q, want %q", got, want)
+	}
+	if got, want := messages["messages"][0].MRN, mrn; got != want {
+		t.Errorf("GET messages got MRN %q, want %q", got, want)
+	}
+	var patients map[string][]patientResponse
+	if code := c.do(http.MethodGet, "patients", nil, &patients); code != http.StatusOK {
+		t.Fatalf("GET patients got code %d, want %d", code, http.StatusOK)
+	}
+	if got, want := len(patients["patients"]), 1; got != want {
+		t.Fatalf("GET patients got %d patients, want %d", got, want)
+	}
+	if got, want := patients["patients"][0].Status, statusAdmitted; got != want {
+		t.Errorf("GET patients got status %q, want %q", got, want)
+	}
+	if patients["patients"][0].Location == "" {
+		t.Error("GET patients got empty location, want the admission location")
+	}
+
+	h.ConsumeQueues(ctx, t)
+	var got run
+	if code := c.do(http.MethodGet, "runs/"+started.ID, nil, &got); code != http.StatusOK {
+		t.Fatalf("GET runs/%s got code %d, want %d", started.ID, code, http.StatusOK)
+	}
+	if got, want := got.Status, runFinished; got != want {
+		t.Errorf("GET runs/%s got status %q, want %q", started.ID, got, want)
+	}
+	if code := c.do(http.MethodGet, "patients/"+mrn, nil, &patient); code != http.StatusOK {
+		t.Fatalf("GET patients/%s got code %d, want %d", mrn, code, http.StatusOK)
+	}
+	if got, want := patient.Status, statusDischarged; got != want {
+		t.Errorf("GET patients/%s got status %q, want %q", mrn, got, want)
+	}
+}
+
+func TestControlAPI_Runs_Limit(t *testing.T) {
+	defer func(n int) { maxRuns = n }(maxRuns)
+	maxRuns = 2
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		var started run
+		if code := c.do(http.MethodPost, "runs", startRequest{PathwayName: "test_pathway"}, &started); code != http.StatusCreated {
+			t.Fatalf("POST runs got code %d, want %d", code, http.StatusCreated)
+		}
+		ids = append(ids, started.ID)
+	}
+	// The oldest run is forgotten.
+	for i, want := range []int{http.StatusNotFound, http.StatusOK, http.StatusOK} {
+		if got := c.do(http.MethodGet, "runs/"+ids[i], nil, nil); got != want {
+			t.Errorf("GET runs/%s of run %d got code %d, want %d", ids[i], i, got, want)
+		}
+	}
+}
+
+func TestControlAPI_CancelEvents(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	var started run
+	if code := c.do(http.MethodPost, "runs", startRequest{PathwayName: "test_pathway"}, &started); code != http.StatusCreated {
+		t.Fatalf("POST runs got code %d, want %d", code, http.StatusCreated)
+	}
+	mrn := started.Patients[0].MRN
+
+	var cancelled map[string]int
+	if code := c.do(http.MethodDelete, fmt.Sprintf("patients/%s/events", mrn), nil, &cancelled); code != http.StatusOK {
+		t.Fatalf("DELETE patients/%s/events got code %d, want %d", mrn, code, http.StatusOK)
+	}
+	if diff := cmp.Diff(map[string]int{"cancelled_events": 1}, cancelled); diff != "" {
+		t.Errorf("DELETE patients/%s/events got diff (-want +got):\n%s", mrn, diff)
+	}
+	var got run
+	if code := c.do(http.MethodGet, "runs/"+started.ID, nil, &got); code != http.StatusOK {
+		t.Fatalf("GET runs/%s got code %d, want %d", started.ID, code, http.StatusOK)
+	}
+	if got, want := got.Status, runFinished; got != want {
+		t.Errorf("GET runs/%s got status %q, want %q", started.ID, got, want)
+	}
+	if _, messages := h.ConsumeQueues(ctx, t); len(messages) != 0 {
+		t.Errorf("ConsumeQueues() got %d messages, want 0", len(messages))
+	}
+}
+
+func TestControlAPI_Rate(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	rate := 5.5
+	var got rateResponse
+	if code := c.do(http.MethodPut, "rate", rateResponse{PathwaysPerHour: &rate}, &got); code != http.StatusOK {
+		t.Fatalf("PUT rate got code %d, want %d", code, http.StatusOK)
+	}
+	if code := c.do(http.MethodGet, "rate", nil, &got); code != http.StatusOK {
+		t.Fatalf("GET rate got code %d, want %d", code, http.StatusOK)
+	}
+	if got.PathwaysPerHour == nil || *got.PathwaysPerHour != rate {
+		t.Errorf("GET rate got %v, want %v", got.PathwaysPerHour, rate)
+	}
+
+	negative := -1.0
+	if code := c.do(http.MethodPut, "rate", rateResponse{PathwaysPerHour: &negative}, nil); code != http.StatusBadRequest {
+		t.Errorf("PUT rate with a negative rate got code %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := c.do(http.MethodPut, "rate", map[string]string{}, nil); code != http.StatusBadRequest {
+		t.Errorf("PUT rate without a rate got code %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestControlAPI_Simulation(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	var sim SimulationState
+	if code := c.do(http.MethodPost, "simulation/pause", nil, &sim); code != http.StatusOK {
+		t.Fatalf("POST simulation/pause got code %d, want %d", code, http.StatusOK)
+	}
+	if diff := cmp.Diff(SimulationState{Paused: true}, sim); diff != "" {
+		t.Errorf("POST simulation/pause got diff (-want +got):\n%s", diff)
+	}
+
+	if code := c.do(http.MethodPost, "runs", startRequest{PathwayName: "test_pathway"}, nil); code != http.StatusCreated {
+		t.Fatalf("POST runs got code %d, want %d", code, http.StatusCreated)
+	}
+	var step stepResponse
+	if code := c.do(http.MethodPost, "simulation/step", nil, &step); code != http.StatusOK {
+		t.Fatalf("POST simulation/step got code %d, want %d", code, http.StatusOK)
+	}
+	if step.Event == nil {
+		t.Fatal("POST simulation/step got nil event, want the admission")
+	}
+	if got, want := step.Event.StepType, "Admission"; got != want {
+		t.Errorf("POST simulation/step got event %q, want %q", got, want)
+	}
+	if got, want := step.MessagesSent, 1; got != want {
+		t.Errorf("POST simulation/step sent %d messages, want %d", got, want)
+	}
+
+	if code := c.do(http.MethodPost, "simulation/drain", nil, &sim); code != http.StatusOK {
+		t.Fatalf("POST simulation/drain got code %d, want %d", code, http.StatusOK)
+	}
+	if code := c.do(http.MethodPost, "simulation/resume", nil, &sim); code != http.StatusOK {
+		t.Fatalf("POST simulation/resume got code %d, want %d", code, http.StatusOK)
+	}
+	if code := c.do(http.MethodGet, "simulation", nil, &sim); code != http.StatusOK {
+		t.Fatalf("GET simulation got code %d, want %d", code, http.StatusOK)
+	}
+	if diff := cmp.Diff(SimulationState{Draining: true}, sim); diff != "" {
+		t.Errorf("GET simulation got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestControlAPI_Board(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	if code := c.do(http.MethodPost, "simulation/pause", nil, nil); code != http.StatusOK {
+		t.Fatalf("POST simulation/pause got code %d, want %d", code, http.StatusOK)
+	}
+	if code := c.do(http.MethodPost, "runs", startRequest{PathwayName: "test_pathway"}, nil); code != http.StatusCreated {
+		t.Fatalf("POST runs got code %d, want %d", code, http.StatusCreated)
+	}
+	if code := c.do(http.MethodPost, "simulation/step", nil, nil); code != http.StatusOK {
+		t.Fatalf("POST simulation/step got code %d, want %d", code, http.StatusOK)
+	}
+
+	var board hospital.Board
+	if code := c.do(http.MethodGet, "board", nil, &board); code != http.StatusOK {
+		t.Fatalf("GET board got code %d, want %d", code, http.StatusOK)
+	}
+	if diff := cmp.Diff(1, board.Census.Inpatient); diff != "" {
+		t.Errorf("GET board census inpatients got diff (-want +got):\n%s", diff)
+	}
+	var occupied []hospital.Bed
+	for _, w := range board.Wards {
+		for _, b := range w.Beds {
+			if b.Occupied {
+				occupied = append(occupied, b)
+			}
+		}
+	}
+	if len(occupied) != 1 || occupied[0].Patient == nil {
+		t.Fatalf("GET board got occupied beds %+v, want one bed with a patient", occupied)
+	}
+	if got, want := occupied[0].Patient.NextEvent.Type, "Discharge"; got != want {
+		t.Errorf("GET board got next event %q, want %q", got, want)
+	}
+}
+
+func TestControlAPI_SentMessages(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	var started run
+	if code := c.do(http.MethodPost, "runs", startRequest{PathwayName: "test_pathway"}, &started); code != http.StatusCreated {
+		t.Fatalf("POST runs got code %d, want %d", code, http.StatusCreated)
+	}
+	h.ConsumeQueues(ctx, t)
+	mrn := started.Patients[0].MRN
+
+	var timeline sentMessages
+	if code := c.do(http.MethodGet, "patients/"+mrn+"/messages", nil, &timeline); code != http.StatusOK {
+		t.Fatalf("GET patients/%s/messages got code %d, want %d", mrn, code, http.StatusOK)
+	}
+	var types []string
+	for _, m := range timeline.Messages {
+		types = append(types, m.MessageType)
+	}
+	if diff := cmp.Diff([]string{"ADT^A01", "ADT^A03"}, types); diff != "" {
+		t.Errorf("GET patients/%s/messages got message types diff (-want +got):\n%s", mrn, diff)
+	}
+
+	var found sentMessages
+	if code := c.do(http.MethodGet, "messages/sent?type=A03&mrn="+mrn, nil, &found); code != http.StatusOK {
+		t.Fatalf("GET messages/sent got code %d, want %d", code, http.StatusOK)
+	}
+	if got, want := len(found.Messages), 1; got != want {
+		t.Fatalf("GET messages/sent?type=A03 got %d messages, want %d", got, want)
+	}
+	discharge := found.Messages[0]
+
+	var byID messagelog.Entry
+	path := fmt.Sprintf("messages/sent/%d", discharge.ID)
+	if code := c.do(http.MethodGet, path, nil, &byID); code != http.StatusOK {
+		t.Fatalf("GET %s got code %d, want %d", path, code, http.StatusOK)
+	}
+	if diff := cmp.Diff(discharge, byID); diff != "" {
+		t.Errorf("GET %s got diff (-want +got):\n%s", path, diff)
+	}
+	if code := c.do(http.MethodGet, "messages/sent/100", nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET messages/sent/100 got code %d, want %d", code, http.StatusNotFound)
+	}
+	if code := c.do(http.MethodGet, "messages/sent?limit=-1", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("GET messages/sent?limit=-1 got code %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestControlAPI_Errors(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestAPI(ctx, t)
+	defer h.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     interface{}
+		auth     string
+		wantCode int
+	}{{
+		name:     "no authorization",
+		method:   http.MethodGet,
+		path:     "patients",
+		wantCode: http.StatusBadRequest,
+	}, {
+		name:     "wrong authorization",
+		method:   http.MethodGet,
+		path:     "patients",
+		auth:     "wrong",
+		wantCode: http.StatusUnauthorized,
+	}, {
+		name:     "unknown pathway",
+		method:   http.MethodPost,
+		path:     "runs",
+		body:     startRequest{PathwayName: "unknown"},
+		auth:     testAPIKey,
+		wantCode: http.StatusBadRequest,
+	}, {
+		name:     "unknown run",
+		method:   http.MethodGet,
+		path:     "runs/unknown",
+		auth:     testAPIKey,
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "unknown patient",
+		method:   http.MethodGet,
+		path:     "patients/unknown",
+		auth:     testAPIKey,
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "cancel events of unknown patient",
+		method:   http.MethodDelete,
+		path:     "patients/unknown/events",
+		auth:     testAPIKey,
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "unknown pathway definition",
+		method:   http.MethodGet,
+		path:     "pathways/unknown",
+		auth:     testAPIKey,
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "step while running",
+		method:   http.MethodPost,
+		path:     "simulation/step",
+		auth:     testAPIKey,
+		wantCode: http.StatusConflict,
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &apiClient{t: t, url: c.url, auth: tc.auth}
+			if code := client.do(tc.method, tc.path, tc.body, nil); code != tc.wantCode {
+				t.Errorf("%s %s got code %d, want %d", tc.method, tc.path, code, tc.wantCode)
+			}
+		})
+	}
+}
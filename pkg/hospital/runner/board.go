@@ -0,0 +1,114 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/simhospital/pkg/hospital"
+)
+
+// boardInterval is how often the bed board is checked for changes while it is streamed.
+var boardInterval = time.Second
+
+// board returns a snapshot of the bed board. The snapshot is taken while no events are running,
+// so that it is consistent.
+func (h *Hospital) board() hospital.Board {
+	h.control.processing.Lock()
+	defer h.control.processing.Unlock()
+	return h.hospital.Board()
+}
+
+// boardSnapshot is a snapshot of the bed board shared by all the clients that stream it.
+type boardSnapshot struct {
+	mu    sync.Mutex
+	board hospital.Board
+	taken time.Time
+}
+
+// sharedBoard returns a snapshot of the bed board taken at most boardInterval ago. Clients that
+// stream the board share the snapshot, so the processing lock is taken at most once per interval
+// regardless of how many clients are connected.
+func (h *Hospital) sharedBoard() hospital.Board {
+	h.boardSnapshot.mu.Lock()
+	defer h.boardSnapshot.mu.Unlock()
+	if now := time.Now(); h.boardSnapshot.taken.IsZero() || now.Sub(h.boardSnapshot.taken) >= boardInterval {
+		h.boardSnapshot.board = h.board()
+		h.boardSnapshot.taken = now
+	}
+	return h.boardSnapshot.board
+}
+
+// serveBoard handles the requests for a snapshot of the bed board, in JSON.
+func (h *Hospital) serveBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, fmt.Sprintf("Method %q not implemented", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.board()); err != nil {
+		log.WithError(err).Error("Cannot write the bed board")
+	}
+}
+
+// serveBoardEvents streams the bed board as server-sent events. The board is sent as soon as the
+// client connects, and then every time that it changes, until the client disconnects.
+func (h *Hospital) serveBoardEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(boardInterval)
+	defer ticker.Stop()
+	var last []byte
+	for {
+		board := h.sharedBoard()
+		// The time of the board changes every time, so it is not taken into account to decide
+		// whether the board changed.
+		t := board.Time
+		board.Time = time.Time{}
+		current, err := json.Marshal(board)
+		if err != nil {
+			log.WithError(err).Error("Cannot marshal the bed board")
+			return
+		}
+		if !bytes.Equal(current, last) {
+			board.Time = t
+			b, err := json.Marshal(board)
+			if err != nil {
+				log.WithError(err).Error("Cannot marshal the bed board")
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			flusher.Flush()
+			last = current
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
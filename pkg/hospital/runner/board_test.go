@@ -0,0 +1,135 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hospital"
+)
+
+func TestServeBoard(t *testing.T) {
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	r.Pause()
+	if _, _, err := r.Step(ctx); err != nil {
+		t.Fatalf("Step() failed with %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.serveBoard(w, httptest.NewRequest(http.MethodGet, "/bedBoard", nil))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("serveBoard() got code %d, want %d", got, want)
+	}
+	var board hospital.Board
+	if err := json.Unmarshal(w.Body.Bytes(), &board); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed with %v", w.Body.String(), err)
+	}
+	if diff := cmp.Diff(1, board.Census.Inpatient); diff != "" {
+		t.Errorf("serveBoard() census inpatients got diff (-want +got):\n%s", diff)
+	}
+
+	w = httptest.NewRecorder()
+	r.serveBoard(w, httptest.NewRequest(http.MethodPost, "/bedBoard", nil))
+	if got, want := w.Code, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("serveBoard() with POST got code %d, want %d", got, want)
+	}
+}
+
+func TestServeBoardEvents(t *testing.T) {
+	defer func(d time.Duration) { boardInterval = d }(boardInterval)
+	boardInterval = 10 * time.Millisecond
+
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(r.serveBoardEvents))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("http.Get(%q) failed with %v", ts.URL, err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.Header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("Content-Type got %q, want %q", got, want)
+	}
+
+	events := bufio.NewReader(resp.Body)
+	nextBoard := func() hospital.Board {
+		t.Helper()
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() failed with %v", err)
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var board hospital.Board
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &board); err != nil {
+				t.Fatalf("json.Unmarshal(%s) failed with %v", line, err)
+			}
+			return board
+		}
+	}
+
+	if got, want := nextBoard().Census.Total, 0; got != want {
+		t.Errorf("first board census got %d patients, want %d", got, want)
+	}
+	// Starting a pathway changes the board, so another event is sent.
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	if got, want := nextBoard().Census.Total, 1; got != want {
+		t.Errorf("board census after starting a pathway got %d patients, want %d", got, want)
+	}
+}
+
+func TestSharedBoard(t *testing.T) {
+	defer func(d time.Duration) { boardInterval = d }(boardInterval)
+	boardInterval = time.Hour
+
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	if got, want := r.sharedBoard().Census.Total, 0; got != want {
+		t.Errorf("sharedBoard() census got %d patients, want %d", got, want)
+	}
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	// The snapshot is reused until boardInterval passes.
+	if got, want := r.sharedBoard().Census.Total, 0; got != want {
+		t.Errorf("sharedBoard() census within the interval got %d patients, want %d", got, want)
+	}
+	if got, want := r.board().Census.Total, 1; got != want {
+		t.Errorf("board() census got %d patients, want %d", got, want)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/state"
+)
+
+// Simulation actions that can be requested from the dashboard.
+const (
+	actionPause  = "pause"
+	actionResume = "resume"
+	actionStep   = "step"
+	actionDrain  = "drain"
+)
+
+// ErrNotPaused is returned when stepping through a simulation that is not paused.
+var ErrNotPaused = errors.New("the simulation must be paused to step through it")
+
+// SimulationState is the state of the simulation loop.
+type SimulationState struct {
+	// Paused is whether the simulation is paused. A paused simulation does not start pathways, run
+	// events or send messages, except when stepping through it.
+	Paused bool `json:"paused"`
+	// Draining is whether the simulation is draining. A draining simulation does not start any more
+	// pathways, and ends once the events and messages that are already queued are processed.
+	Draining bool `json:"draining"`
+}
+
+// control holds the state of the simulation loop that can be changed while it runs.
+type control struct {
+	// mu guards paused and draining.
+	mu       sync.Mutex
+	paused   bool
+	draining bool
+	// changed is notified when the state changes, so that the loop that starts pathways does not need
+	// to wait for its next heartbeat to notice.
+	changed chan bool
+	// processing is held for reading while the loop runs events or sends messages, and for writing
+	// while stepping, taking a snapshot of the bed board or the patients, or cancelling events, so
+	// that none of them runs concurrently with the loop.
+	processing sync.RWMutex
+}
+
+func newControl() *control {
+	return &control{changed: make(chan bool, 1)}
+}
+
+func (c *control) state() SimulationState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return SimulationState{Paused: c.paused, Draining: c.draining}
+}
+
+func (c *control) set(f func()) {
+	c.mu.Lock()
+	f()
+	c.mu.Unlock()
+	select {
+	case c.changed <- true:
+	default:
+		// A notification is already pending.
+	}
+}
+
+// State returns the state of the simulation loop.
+func (h *Hospital) State() SimulationState {
+	return h.control.state()
+}
+
+// Pause pauses the simulation: no pathways are started, and no events are run or messages sent
+// until Resume is called. Pathways can still be started from the dashboard or the API, and their
+// events are queued.
+// Note that pausing does not stop the hospital clock, so the events and messages that become due
+// while the simulation is paused are processed as soon as it is resumed.
+func (h *Hospital) Pause() {
+	h.control.set(func() { h.control.paused = true })
+	log.Info("Simulation paused")
+}
+
+// Resume resumes a paused simulation.
+func (h *Hospital) Resume() {
+	h.control.set(func() { h.control.paused = false })
+	log.Info("Simulation resumed")
+}
+
+// Drain stops starting new pathways, and ends Run once all queued events and messages are
+// processed. A paused simulation does not drain until it is resumed.
+func (h *Hospital) Drain() {
+	h.control.set(func() { h.control.draining = true })
+	log.Info("Simulation draining: no more pathways will be started")
+}
+
+// Step runs the next event on the event queue, even if it is not due yet, and then sends the messages
+// whose message time is not after the event's, which include the messages that the event generated.
+// Returns the event that ran, or nil if there were no events, and the number of messages sent.
+// Returns ErrNotPaused if the simulation is not paused.
+func (h *Hospital) Step(ctx context.Context) (*state.Event, int, error) {
+	h.control.processing.Lock()
+	defer h.control.processing.Unlock()
+	if !h.control.state().Paused {
+		return nil, 0, ErrNotPaused
+	}
+	e, err := h.hospital.RunNextEvent(ctx)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot run the next event")
+	}
+	if e == nil {
+		return nil, 0, nil
+	}
+	n, err := h.hospital.ProcessMessagesDueBy(e.MessageTime)
+	if err != nil {
+		return e, n, errors.Wrap(err, "cannot process the messages of the event")
+	}
+	log.WithField("pathway_name", e.PathwayName).WithField("messages", n).Info("Stepped through one event")
+	return e, n, nil
+}
+
+// serveSimulation handles the requests made from the simulation controls on the dashboard.
+// GET requests return the state of the simulation. POST requests need to be in the format
+// "action=X", where X is one of pause, resume, step or drain, and return the new state.
+func (h *Hospital) serveSimulation(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		prefix := "action="
+		if !strings.HasPrefix(string(body), prefix) {
+			http.Error(w, `Error extracting action: the request must be in the format "action=X"`, http.StatusBadRequest)
+			return
+		}
+		if err := h.doAction(r.Context(), strings.TrimPrefix(string(body), prefix)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Method %q not implemented", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.State()); err != nil {
+		log.WithError(err).Error("Cannot write the simulation state")
+	}
+}
+
+func (h *Hospital) doAction(ctx context.Context, action string) error {
+	switch action {
+	case actionPause:
+		h.Pause()
+	case actionResume:
+		h.Resume()
+	case actionStep:
+		_, _, err := h.Step(ctx)
+		return err
+	case actionDrain:
+		h.Drain()
+	default:
+		return fmt.Errorf("unknown action %q, want one of [%s, %s, %s, %s]", action, actionPause, actionResume, actionStep, actionDrain)
+	}
+	return nil
+}
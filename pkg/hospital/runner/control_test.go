@@ -0,0 +1,198 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/hospital"
+	"github.com/google/simhospital/pkg/test/testclock"
+	"github.com/google/simhospital/pkg/test/testhospital"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+// newTestRunner returns a test hospital with a pathway that sends two messages, and a runner that
+// does not start any pathways by itself.
+func newTestRunner(ctx context.Context, t *testing.T) (*testhospital.Hospital, *Hospital) {
+	t.Helper()
+	b := []byte(`
+test_pathway:
+  pathway:
+    - admission:
+        loc: Renal
+    - discharge: {}`)
+	hl7.TimezoneAndLocation("Europe/London")
+	args := testhospital.Arguments
+	args.PathwayArguments = &hospital.PathwayArguments{Dir: testwrite.BytesToDir(t, b, "pathway.yml"), Type: "distribution"}
+	args.MessageLogSize = 10
+	clock := testclock.New(time.Date(2020, 2, 12, 0, 0, 0, 0, time.UTC))
+	h := testhospital.New(ctx, t, testhospital.Config{
+		Config:    hospital.Config{Clock: clock},
+		Arguments: args,
+	})
+
+	config := Config{
+		DashboardURI:       "uri",
+		DashboardAddress:   ":0000",
+		DashboardStaticDir: "static",
+		MaxPathways:        -1,
+		SleepFor:           10 * time.Millisecond,
+		Clock:              clock,
+	}
+	r, err := New(h.Hospital, config)
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", config, err)
+	}
+	return h, r
+}
+
+func TestStep(t *testing.T) {
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	if _, _, err := r.Step(ctx); err != ErrNotPaused {
+		t.Fatalf("Step() before Pause() got err %v, want %v", err, ErrNotPaused)
+	}
+
+	r.Pause()
+	for _, wantStep := range []string{"Admission", "Discharge"} {
+		e, n, err := r.Step(ctx)
+		if err != nil {
+			t.Fatalf("Step() failed with %v", err)
+		}
+		if e == nil {
+			t.Fatalf("Step() got nil event, want %s", wantStep)
+		}
+		if got := e.Step.StepType(); got != wantStep {
+			t.Errorf("Step() got event %s, want %s", got, wantStep)
+		}
+		if got, want := n, 1; got != want {
+			t.Errorf("Step() sent %d messages, want %d", got, want)
+		}
+	}
+
+	e, n, err := r.Step(ctx)
+	if err != nil {
+		t.Fatalf("Step() failed with %v", err)
+	}
+	if e != nil || n != 0 {
+		t.Errorf("Step() on empty queues got event %v and %d messages, want nil event and 0 messages", e, n)
+	}
+	if got, want := len(h.Sender.GetSentMessages()), 2; got != want {
+		t.Errorf("h.Sender.GetSentMessages() got %d messages, want %d", got, want)
+	}
+}
+
+func TestRunner_Run_Drain(t *testing.T) {
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	r.Drain()
+	// Run() returns after the events and messages that were queued before draining are processed.
+	r.Run(ctx)
+
+	if got, want := len(h.Sender.GetSentMessages()), 2; got != want {
+		t.Errorf("h.Sender.GetSentMessages() got %d messages, want %d", got, want)
+	}
+	if h.HasEvents() || h.HasMessages() {
+		t.Errorf("HasEvents()=%t, HasMessages()=%t after draining, want false and false", h.HasEvents(), h.HasMessages())
+	}
+}
+
+func TestRunner_Run_PauseResume(t *testing.T) {
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	r.Pause()
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	done := make(chan bool)
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	// Give the loop the chance to process the items, which it must not do while paused.
+	time.Sleep(100 * time.Millisecond)
+	if got, want := len(h.Sender.GetSentMessages()), 0; got != want {
+		t.Fatalf("h.Sender.GetSentMessages() while paused got %d messages, want %d", got, want)
+	}
+
+	r.Drain()
+	r.Resume()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() did not return after resuming a draining simulation")
+	}
+	if got, want := len(h.Sender.GetSentMessages()), 2; got != want {
+		t.Errorf("h.Sender.GetSentMessages() got %d messages, want %d", got, want)
+	}
+}
+
+func TestServeSimulation(t *testing.T) {
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	tests := []struct {
+		method   string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{method: http.MethodGet, wantCode: http.StatusOK, wantBody: `{"paused":false,"draining":false}`},
+		{method: http.MethodPost, body: "action=pause", wantCode: http.StatusOK, wantBody: `{"paused":true,"draining":false}`},
+		{method: http.MethodPost, body: "action=step", wantCode: http.StatusOK, wantBody: `{"paused":true,"draining":false}`},
+		{method: http.MethodPost, body: "action=drain", wantCode: http.StatusOK, wantBody: `{"paused":true,"draining":true}`},
+		{method: http.MethodPost, body: "action=resume", wantCode: http.StatusOK, wantBody: `{"paused":false,"draining":true}`},
+		{method: http.MethodPost, body: "action=step", wantCode: http.StatusBadRequest},
+		{method: http.MethodPost, body: "action=unknown", wantCode: http.StatusBadRequest},
+		{method: http.MethodPost, body: "pause", wantCode: http.StatusBadRequest},
+		{method: http.MethodPut, wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.body, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.serveSimulation(w, httptest.NewRequest(tc.method, "/simulation", strings.NewReader(tc.body)))
+			if got, want := w.Code, tc.wantCode; got != want {
+				t.Errorf("serveSimulation() got code %d, want %d", got, want)
+			}
+			if tc.wantBody == "" {
+				return
+			}
+			if diff := cmp.Diff(tc.wantBody, strings.TrimSpace(w.Body.String())); diff != "" {
+				t.Errorf("serveSimulation() got body diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
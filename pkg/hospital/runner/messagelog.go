@@ -0,0 +1,144 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/messagelog"
+)
+
+// Formats in which a sent message can be rendered.
+const (
+	formatJSON   = "json"
+	formatRaw    = "raw"
+	formatPretty = "pretty"
+)
+
+// errNoMessageLog is returned when sent messages are searched, but they are not logged.
+var errNoMessageLog = errors.New("sent messages are not logged: set a positive message log size")
+
+// sentMessages is the response to a search of sent messages.
+type sentMessages struct {
+	Messages []messagelog.Entry `json:"messages"`
+}
+
+// serveMessageLog handles the requests to search the sent messages from the dashboard.
+// If the request has an "id" parameter, it returns the message with that ID in the format in the
+// "format" parameter. Otherwise, it returns the messages that match the parameters of the request,
+// in JSON. See messageLogQuery for the parameters.
+func (h *Hospital) serveMessageLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, fmt.Sprintf("Method %q not implemented", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	l := h.hospital.MessageLog()
+	if l == nil {
+		http.Error(w, errNoMessageLog.Error(), http.StatusNotImplemented)
+		return
+	}
+	if id := r.FormValue("id"); id != "" {
+		e, code, err := sentMessage(l, id)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		writeSentMessage(w, e, r.FormValue("format"), writeTextError)
+		return
+	}
+	q, err := messageLogQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(searchMessageLog(l, q)); err != nil {
+		log.WithError(err).Error("Cannot write the sent messages")
+	}
+}
+
+// messageLogQuery returns the query to search the message log with, from the "mrn", "visit_id",
+// "type", "control_id" and "limit" parameters of the request.
+func messageLogQuery(r *http.Request) (messagelog.Query, error) {
+	q := messagelog.Query{
+		MRN:         r.FormValue("mrn"),
+		VisitID:     r.FormValue("visit_id"),
+		MessageType: r.FormValue("type"),
+		ControlID:   r.FormValue("control_id"),
+	}
+	if limit := r.FormValue("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return messagelog.Query{}, errors.Errorf("invalid limit %q: must be a non-negative integer", limit)
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// searchMessageLog returns the messages in the log that match the query.
+func searchMessageLog(l *messagelog.Log, q messagelog.Query) sentMessages {
+	messages := l.Search(q)
+	if messages == nil {
+		messages = []messagelog.Entry{}
+	}
+	return sentMessages{Messages: messages}
+}
+
+// sentMessage returns the message with the given ID. If the message cannot be returned, it also
+// returns the HTTP status code for the error.
+func sentMessage(l *messagelog.Log, id string) (messagelog.Entry, int, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return messagelog.Entry{}, http.StatusBadRequest, errors.Errorf("invalid message ID %q", id)
+	}
+	e, ok := l.Get(n)
+	if !ok {
+		return messagelog.Entry{}, http.StatusNotFound, errors.Errorf("message %d not found: it does not exist or it was removed from the log", n)
+	}
+	return e, http.StatusOK, nil
+}
+
+// writeSentMessage writes the message in the given format: the entry in JSON, which is the
+// default, the raw message with a segment per line, or the message in YAML keyed by field name.
+// Errors are written with writeErr.
+func writeSentMessage(w http.ResponseWriter, e messagelog.Entry, format string, writeErr func(http.ResponseWriter, int, string)) {
+	switch format {
+	case "", formatJSON:
+		writeJSON(w, http.StatusOK, e)
+	case formatRaw:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, e.Raw())
+	case formatPretty:
+		pretty, err := e.Pretty()
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, pretty)
+	default:
+		writeErr(w, http.StatusBadRequest, fmt.Sprintf("unknown format %q: must be one of %s, %s or %s", format, formatJSON, formatRaw, formatPretty))
+	}
+}
+
+// writeTextError writes an error in plain text, as the dashboard endpoints do.
+func writeTextError(w http.ResponseWriter, code int, msg string) {
+	http.Error(w, msg, code)
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMessageLog(t *testing.T) {
+	ctx := context.Background()
+	h, r := newTestRunner(ctx, t)
+	defer h.Close()
+
+	if err := h.StartNextPathway(); err != nil {
+		t.Fatalf("StartNextPathway() failed with %v", err)
+	}
+	h.ConsumeQueues(ctx, t)
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		wantCode     int
+		wantMessages int
+		wantContains string
+	}{
+		{name: "all", url: "/messageLog", wantCode: http.StatusOK, wantMessages: 2},
+		{name: "by type", url: "/messageLog?type=ADT^A03", wantCode: http.StatusOK, wantMessages: 1},
+		{name: "with limit", url: "/messageLog?limit=1", wantCode: http.StatusOK, wantMessages: 1},
+		{name: "unknown MRN", url: "/messageLog?mrn=unknown", wantCode: http.StatusOK, wantMessages: 0},
+		{name: "invalid limit", url: "/messageLog?limit=x", wantCode: http.StatusBadRequest},
+		{name: "raw", url: "/messageLog?id=1&format=raw", wantCode: http.StatusOK, wantContains: "\nPID|"},
+		{name: "pretty", url: "/messageLog?id=1&format=pretty", wantCode: http.StatusOK, wantContains: "Message Control ID"},
+		{name: "unknown format", url: "/messageLog?id=1&format=xml", wantCode: http.StatusBadRequest},
+		{name: "invalid ID", url: "/messageLog?id=x", wantCode: http.StatusBadRequest},
+		{name: "unknown ID", url: "/messageLog?id=3", wantCode: http.StatusNotFound},
+		{name: "POST", method: http.MethodPost, url: "/messageLog", wantCode: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			r.serveMessageLog(w, httptest.NewRequest(method, tc.url, nil))
+			if got, want := w.Code, tc.wantCode; got != want {
+				t.Fatalf("serveMessageLog(%s) got code %d, want %d; body: %s", tc.url, got, want, w.Body.String())
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			if tc.wantContains != "" {
+				if !strings.Contains(w.Body.String(), tc.wantContains) {
+					t.Errorf("serveMessageLog(%s) got %q, want it to contain %q", tc.url, w.Body.String(), tc.wantContains)
+				}
+				return
+			}
+			var got sentMessages
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("json.Unmarshal(%s) failed with %v", w.Body.String(), err)
+			}
+			if got, want := len(got.Messages), tc.wantMessages; got != want {
+				t.Errorf("serveMessageLog(%s) got %d messages, want %d", tc.url, got, want)
+			}
+		})
+	}
+}
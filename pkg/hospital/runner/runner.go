@@ -42,6 +42,10 @@ var (
 	dashboardAddressRegex = regexp.MustCompile(`^:\d{4}$`)
 )
 
+// loadTestQueuedItems is the number of events and messages that are kept queued in load-test mode.
+// New pathways are started while fewer items are queued.
+const loadTestQueuedItems = 10000
+
 // EndpointAndHandler defines a Simulated Hospital endpoint and its handler.
 type EndpointAndHandler struct {
 	Endpoint string
@@ -69,12 +73,17 @@ type Hospital struct {
 	sleepFor                     time.Duration
 	clock                        clock.Clock
 	maxPathways                  int
+	loadTest                     bool
+	control                      *control
 	creatingPathways             chan bool
 	processingEvents             chan bool
 	processingMessages           chan bool
+	boardSnapshot                boardSnapshot
 }
 
 // APIConfig contains base configuration for authenticated endpoints.
+// If both the port and the key are set, the control API is served on the API port, in addition to
+// any other authenticated endpoints.
 type APIConfig struct {
 	APIPort string
 	APIKey  string
@@ -113,6 +122,11 @@ type Config struct {
 	SleepFor time.Duration
 	// Clock is the clock for the hospital.
 	Clock clock.Clock
+	// LoadTest is whether to run in load-test mode, to generate messages as fast as they can be sent.
+	// In load-test mode, pathways are started whenever few events and messages are queued, regardless
+	// of PathwaysPerHour, and events and messages are processed as soon as they are queued, rather than
+	// when they are due. The times in the messages are still the ones of the simulation.
+	LoadTest bool
 }
 
 func (c Config) isValid() error {
@@ -128,6 +142,9 @@ func (c Config) isValid() error {
 	if len(c.AuthenticatedEndpoints) != 0 && (c.AuthenticatedAPIConfig.APIKey == "" || c.AuthenticatedAPIConfig.APIPort == "") {
 		return errors.New("must provide API key and port if API endpoints are configured")
 	}
+	if (c.AuthenticatedAPIConfig.APIKey == "") != (c.AuthenticatedAPIConfig.APIPort == "") {
+		return errors.New("must provide both the API key and port, or neither")
+	}
 	return nil
 }
 
@@ -152,6 +169,8 @@ func New(h *hospital.Hospital, config Config) (*Hospital, error) {
 		sleepFor:                     config.SleepFor,
 		clock:                        config.Clock,
 		maxPathways:                  config.MaxPathways,
+		loadTest:                     config.LoadTest,
+		control:                      newControl(),
 	}, nil
 }
 
@@ -162,7 +181,8 @@ func New(h *hospital.Hospital, config Config) (*Hospital, error) {
 //    hospital, test results, etc.).
 // 2. Run those events at the appropriate time, which generates HL7 messages.
 // 3. Process HL7 messages at the appropriate time.
-// The processing of pathways, events and messages can finish if Hospital.maxPathways is negative, otherwise Run() runs forever.
+// The processing of pathways, events and messages can finish if Hospital.maxPathways is not negative
+// or if the simulation is drained with Drain(), otherwise Run() runs forever.
 // When the creation of pathways finishes, we can stop processing events after all our current events
 // are processed. When processing events finishes, we can stop processing messages after all our current
 // messages are processed.
@@ -205,24 +225,24 @@ func (h *Hospital) Run(ctx context.Context) {
 		})
 	}
 
-	if h.maxPathways >= 0 {
-		// We use the creatingPathways, processingEvents and processingMessages channels
-		// to communicate whether pathways, events and messages are still being processed.
-		h.creatingPathways = make(chan bool)
-		h.processingEvents = make(chan bool)
-		h.processingMessages = make(chan bool)
-		go func() {
-			processing := true
-			for processing {
-				select {
-				case processing = <-h.processingMessages:
-				}
+	// We use the creatingPathways, processingEvents and processingMessages channels
+	// to communicate whether pathways, events and messages are still being processed.
+	h.creatingPathways = make(chan bool)
+	h.processingEvents = make(chan bool)
+	h.processingMessages = make(chan bool)
+	go func() {
+		processing := true
+		for processing {
+			select {
+			case <-groupCtx.Done():
+				return
+			case processing = <-h.processingMessages:
 			}
-			// Cancelling the context exits the Run() method.
-			defer cancel()
-			logLocal.Info("Simulated Hospital stopped processing, will exit")
-		}()
-	}
+		}
+		// Cancelling the context exits the Run() method.
+		defer cancel()
+		logLocal.Info("Simulated Hospital stopped processing, will exit")
+	}()
 
 	// 1. Start the pathways that create the events.
 	eg.Go(func() error {
@@ -268,10 +288,14 @@ func createHTTPServer(ctx context.Context, addr string, handler http.Handler) *h
 }
 
 // startPathways starts pathways that create events.
-// If h.maxPathways is negative, it runs indefinitely. Otherwise, it stops when
+// If h.maxPathways is negative, it runs until the simulation is drained. Otherwise, it also stops when
 // the number of created pathways is equal to h.maxPathways.
+// While the simulation is paused, no pathways are started, and the time spent paused does not
+// count towards the delay until the next pathway.
 // When startPathways stops, it writes "false" in the h.creatingPathways channel and closes the channel.
-// The delay between running consecutive pathways is derived by the rate Controller,
+// In load-test mode, pathways are started whenever fewer than loadTestQueuedItems events and
+// messages are queued, and the rate is ignored.
+// Otherwise, the delay between running consecutive pathways is derived by the rate Controller,
 // based on the rate.
 // If the rate is initially set to value != 0, then the first pathway
 // is started immediately.
@@ -299,6 +323,36 @@ func (h *Hospital) startPathways(ctx context.Context) error {
 	}
 
 	for h.maxPathways < 0 || nCreated < h.maxPathways {
+		sim := h.control.state()
+		if sim.Draining {
+			break
+		}
+		if sim.Paused {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-h.control.changed:
+			}
+			continue
+		}
+		if h.loadTest {
+			// Keep enough events and messages queued for the sender to send messages at its own rate.
+			if h.hospital.EventsLen()+h.hospital.MessagesLen() < loadTestQueuedItems {
+				nCreated++
+				err := h.hospital.StartNextPathway()
+				if err == nil {
+					continue
+				}
+				logLocal.WithError(err).Error("cannot start new pathway")
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-h.control.changed:
+			case <-time.After(h.sleepFor):
+			}
+			continue
+		}
 		start := h.clock.Now()
 		delay := h.pathwayRateController.Heartbeat() - elapsed
 		select {
@@ -308,6 +362,10 @@ func (h *Hospital) startPathways(ctx context.Context) error {
 			// The rate was changed; we might need to generate a new pathway sooner.
 			elapsed += h.clock.Now().Sub(start)
 			continue
+		case <-h.control.changed:
+			// The simulation was paused or drained.
+			elapsed += h.clock.Now().Sub(start)
+			continue
 		case <-time.After(delay):
 			elapsed = time.Duration(0)
 			nCreated++
@@ -317,17 +375,28 @@ func (h *Hospital) startPathways(ctx context.Context) error {
 		}
 	}
 	if h.creatingPathways != nil {
-		h.creatingPathways <- false
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case h.creatingPathways <- false:
+		}
 		close(h.creatingPathways)
 	}
 	logLocal.Info("Pathway generation finished")
 	return nil
 }
 
-// RunEvents runs the events as they are due.
+// RunEvents runs the events as they are due, or as soon as they are queued in load-test mode.
 // Returns an error if the context is Done.
 func (h *Hospital) RunEvents(ctx context.Context) error {
-	err := h.processItems(ctx, h.hospital.RunNextEventIfDue, h.hospital.HasEvents, h.creatingPathways, h.processingEvents, "Failed to run the due event")
+	f := h.hospital.RunNextEventIfDue
+	if h.loadTest {
+		f = func(ctx context.Context) (bool, error) {
+			e, err := h.hospital.RunNextEvent(ctx)
+			return e != nil && err == nil, err
+		}
+	}
+	err := h.processItems(ctx, f, h.hospital.HasEvents, h.creatingPathways, h.processingEvents, "Failed to run the due event")
 	if err != nil {
 		return err
 	}
@@ -335,10 +404,14 @@ func (h *Hospital) RunEvents(ctx context.Context) error {
 	return nil
 }
 
-// ProcessMessages processes (e.g. sends) the HL7 messages.
+// ProcessMessages processes (e.g. sends) the HL7 messages as they are due, or as soon as they are
+// queued in load-test mode.
 // Returns an error if the context is Done.
 func (h *Hospital) ProcessMessages(ctx context.Context) error {
 	f := func(_ context.Context) (bool, error) {
+		if h.loadTest {
+			return h.hospital.ProcessNextMessage()
+		}
 		return h.hospital.ProcessNextMessageIfDue()
 	}
 	err := h.processItems(ctx, f, h.hospital.HasMessages, h.processingEvents, h.processingMessages, "Failed to process the due message")
@@ -357,6 +430,7 @@ func (h *Hospital) ProcessMessages(ctx context.Context) error {
 // creatingItems is a channel that signals whether items are still being created outside this method.
 // After all items are processed, processItems writes "false" in the processingItems channel and closes the channel.
 // Send a nil creatingItems channel to run indefinitely.
+// While the simulation is paused, no items are processed.
 func (h *Hospital) processItems(ctx context.Context, f func(context.Context) (bool, error), hasItems func() bool, creatingItems <-chan bool, processingItems chan bool, errMsg string) error {
 	stillCreating := true
 	for stillCreating || hasItems() {
@@ -365,30 +439,45 @@ func (h *Hospital) processItems(ctx context.Context, f func(context.Context) (bo
 			return ctx.Err()
 		case <-time.After(h.sleepFor):
 			// Process everything that is due now.
-			for {
-				ran, err := f(ctx)
-				if err != nil {
-					log.WithContext(ctx).WithError(err).Error(errMsg)
-				}
-				if !ran {
-					break
-				}
+			for h.processNextItem(ctx, f, errMsg) {
 			}
 		}
 		if creatingItems != nil {
 			select {
 			case stillCreating = <-creatingItems:
+			default:
+				// Items are still being created.
 			}
 		}
 	}
 	if processingItems != nil {
-		processingItems <- false
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case processingItems <- false:
+		}
 		close(processingItems)
 	}
 	return nil
 }
 
-// setupEndpoints sets up the regular endpoints (pathway rate and pathway starter)
+// processNextItem runs the function f unless the simulation is paused.
+// Returns whether an item was processed.
+func (h *Hospital) processNextItem(ctx context.Context, f func(context.Context) (bool, error), errMsg string) bool {
+	h.control.processing.RLock()
+	defer h.control.processing.RUnlock()
+	if h.control.state().Paused {
+		return false
+	}
+	ran, err := f(ctx)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error(errMsg)
+	}
+	return ran
+}
+
+// setupEndpoints sets up the regular endpoints (pathway rate, pathway starter, simulation controls,
+// bed board and message log)
 // plus any additional endpoints in additionalDashboardEndpoints, and returns the http.ServeMux.
 // This method always returns a non-nil item.
 func (h *Hospital) setupEndpoints() *http.ServeMux {
@@ -397,6 +486,10 @@ func (h *Hospital) setupEndpoints() *http.ServeMux {
 	endpoints := append([]EndpointAndHandler{
 		{Endpoint: "pathwayRate", Handler: h.pathwayRateController.ServeHTTP},
 		{Endpoint: "pathwayStarter", Handler: h.pathwayStarter.ServeHTTP},
+		{Endpoint: "simulation", Handler: h.serveSimulation},
+		{Endpoint: "bedBoard", Handler: h.serveBoard},
+		{Endpoint: "bedBoardEvents", Handler: h.serveBoardEvents},
+		{Endpoint: "messageLog", Handler: h.serveMessageLog},
 	}, h.additionalDashboardEndpoints...)
 	for _, e := range endpoints {
 		log.WithField("root_path", h.dashboardURI).WithField("endpoint", e.Endpoint).Info("Setting up endpoint")
@@ -405,15 +498,21 @@ func (h *Hospital) setupEndpoints() *http.ServeMux {
 	return m
 }
 
-// setupAuthenticatedEndpoints sets up the authenticated endpoints and returns the mux.Router.
-// If there are no authenticated endpoints, this method returns nil.
+// setupAuthenticatedEndpoints sets up the authenticated endpoints and the control API, and returns
+// the mux.Router.
+// If there are no authenticated endpoints and the control API is not enabled, this method returns nil.
 func (h *Hospital) setupAuthenticatedEndpoints() *mux.Router {
-	if len(h.authenticatedEndpoints) == 0 {
+	endpoints := h.authenticatedEndpoints
+	if h.authenticatedAPIConfig.APIKey != "" && h.authenticatedAPIConfig.APIPort != "" {
+		api := &controlAPI{h: h, runs: map[string]*run{}}
+		endpoints = append(api.endpoints(), endpoints...)
+	}
+	if len(endpoints) == 0 {
 		log.Info("No authenticated endpoints to set up")
 		return nil
 	}
 	r := mux.NewRouter()
-	for _, e := range h.authenticatedEndpoints {
+	for _, e := range endpoints {
 		log.WithField("root_path", h.apiRootPath()).
 			WithField("endpoint", e.Endpoint).
 			WithField("key_is_set", h.authenticatedAPIConfig.APIKey != "").
@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/hospital"
 	. "github.com/google/simhospital/pkg/hospital/runner"
@@ -224,3 +225,74 @@ test_pathway:
 		})
 	}
 }
+
+func TestRunner_Run_LoadTest(t *testing.T) {
+	ctx := context.Background()
+	// The pathway takes a day, and the pathway rate is zero, so the messages are only sent before the
+	// test times out if the pathways are started and run regardless of the rate and the delays.
+	b := []byte(`
+test_pathway:
+  pathway:
+    - admission:
+        loc: Renal
+    - delay:
+        from: 24h
+        to: 24h
+    - discharge: {}`)
+	mainDir := testwrite.BytesToDir(t, b, "pathway.yml")
+
+	hl7.TimezoneAndLocation("Europe/London")
+	now := time.Date(2020, 2, 12, 0, 0, 0, 0, time.UTC)
+	clock := testclock.WithTick(now, time.Second)
+
+	args := testhospital.Arguments
+	args.PathwayArguments.Dir = mainDir
+	args.PathwayArguments.Names = []string{"test_pathway"}
+	h := testhospital.New(ctx, t, testhospital.Config{
+		Config:    hospital.Config{Clock: clock},
+		Arguments: args,
+	})
+	defer h.Close()
+
+	config := Config{
+		DashboardURI:       nonEmptyString,
+		DashboardAddress:   ":0000",
+		DashboardStaticDir: nonEmptyString,
+		MaxPathways:        3,
+		PathwaysPerHour:    0,
+		Clock:              clock,
+		LoadTest:           true,
+	}
+	runner, err := New(h.Hospital, config)
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", config, err)
+	}
+	runner.Run(ctx)
+
+	// Trigger events of the messages sent for each patient, in order.
+	got := map[string][]string{}
+	for _, m := range h.Sender.GetSentMessages() {
+		msg, err := hl7.ParseMessage([]byte(m))
+		if err != nil {
+			t.Fatalf("ParseMessage(%q) failed with %v", m, err)
+		}
+		msh, err := msg.MSH()
+		if err != nil {
+			t.Fatalf("MSH() failed with %v", err)
+		}
+		pid, err := msg.PID()
+		if err != nil {
+			t.Fatalf("PID() failed with %v", err)
+		}
+		mrn := pid.PatientIdentifierList[0].IDNumber.String()
+		got[mrn] = append(got[mrn], msh.MessageType.TriggerEvent.String())
+	}
+	if got, want := len(got), config.MaxPathways; got != want {
+		t.Errorf("h.Sender.GetSentMessages() got messages for %d patients, want %d", got, want)
+	}
+	for mrn, events := range got {
+		if diff := cmp.Diff([]string{"A01", "A03"}, events); diff != "" {
+			t.Errorf("trigger events of the messages of patient %s got diff (-want +got):\n%s", mrn, diff)
+		}
+	}
+}
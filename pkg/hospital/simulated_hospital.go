@@ -17,6 +17,8 @@ package hospital
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/pkg/errors"
@@ -25,6 +27,7 @@ import (
 	"github.com/google/simhospital/pkg/clock"
 	"github.com/google/simhospital/pkg/config"
 	"github.com/google/simhospital/pkg/doctor"
+	"github.com/google/simhospital/pkg/fault"
 	"github.com/google/simhospital/pkg/fhir/cloud"
 	"github.com/google/simhospital/pkg/fhir"
 	fhirmarshaller "github.com/google/simhospital/pkg/fhir/marshaller"
@@ -33,18 +36,23 @@ import (
 	"github.com/google/simhospital/pkg/generator/header"
 	"github.com/google/simhospital/pkg/generator/id"
 	"github.com/google/simhospital/pkg/generator/person"
+	"github.com/google/simhospital/pkg/groundtruth"
 	"github.com/google/simhospital/pkg/hardcoded"
 	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/loadtest"
 	"github.com/google/simhospital/pkg/location"
 	"github.com/google/simhospital/pkg/logging"
 	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/messagelog"
 	"github.com/google/simhospital/pkg/monitoring"
 	"github.com/google/simhospital/pkg/orderprofile"
 	"github.com/google/simhospital/pkg/pathway"
 	"github.com/google/simhospital/pkg/processor"
+	"github.com/google/simhospital/pkg/provenance"
 	"github.com/google/simhospital/pkg/state/persist"
 	"github.com/google/simhospital/pkg/state"
+	"github.com/google/simhospital/pkg/tracing"
 )
 
 const (
@@ -69,6 +77,9 @@ const (
 	inconsistentQueueError = "inconsistent event queue"
 
 	unknown = "unknown"
+
+	// tracingServiceName is the name of the service that the spans exported to OTLP come from.
+	tracingServiceName = "simulated-hospital"
 )
 
 var (
@@ -82,11 +93,17 @@ var (
 	counters struct {
 		SimulatedHospital struct {
 			PathwaysTotal            *prometheus.CounterVec   `help:"Number of pathways that were successfully started" labels:"pathway_name"`
-			MessagesTotal            *prometheus.CounterVec   `help:"Number of messages sent" labels:"pathway_name,message_type,trigger_event"`
+			MessagesTotal            *prometheus.CounterVec   `help:"Number of messages sent" labels:"pathway_name,step_type,message_type,trigger_event"`
+			EventsTotal              *prometheus.CounterVec   `help:"Number of events processed" labels:"pathway_name,step_type"`
 			ErrorsTotal              *prometheus.CounterVec   `help:"Number of errors" labels:"pathway_name,reason"`
 			PathwayDurationMinutes   *prometheus.HistogramVec `help:"Duration (minutes) of the generated pathway, by pathway name" labels:"pathway_name" buckets:"1,5,10,30,60,180,720,1440,2880"`
 			AdmissionDurationMinutes *prometheus.HistogramVec `help:"Duration (minutes) of the admissions in the generated pathways, by pathway name" labels:"pathway_name" buckets:"1,5,10,30,60,180,720,1440,2880"`
 			MessageDelaySeconds      prometheus.Histogram     `help:"Difference, in seconds, between the time a message was expected to be sent, and the time when it was really sent" buckets:"1,5,10,30,60,180"`
+			InvalidMessagesTotal     *prometheus.CounterVec   `help:"Number of messages with validation issues" labels:"pathway_name,message_type,trigger_event"`
+			EventLagSeconds          *prometheus.HistogramVec `help:"Difference, in seconds, between the time an event was due, and the time when it was really processed" labels:"step_type" buckets:"0.1,0.5,1,5,10,30,60,180"`
+			SendLatencySeconds       prometheus.Histogram     `help:"Time, in seconds, that the sender took to send a message" buckets:"0.001,0.005,0.01,0.05,0.1,0.5,1,5"`
+			EventQueueLength         prometheus.Gauge         `help:"Number of events waiting to be processed"`
+			MessageQueueLength       prometheus.Gauge         `help:"Number of messages waiting to be sent"`
 		}
 	}
 )
@@ -138,18 +155,50 @@ type Arguments struct {
 	// Also required to create Config.PathwayParser and Config.PathwayManager.
 	OrderProfilesFile *string
 
+	// ValidationConfigFile to create Config.Validation.
+	// If not set, messages are not validated.
+	ValidationConfigFile *string
+
+	// ZSegmentsFile with the definitions of custom Z-segments to register with hl7.RegisterSegment.
+	// The segments need to be registered before the pathways that populate them are parsed.
+	ZSegmentsFile *string
+
 	// ResourceArguments to create ResourceWriter.
 	ResourceArguments *ResourceArguments
 
 	// DeletePatientsFromMemory to set as Config.DeletePatientsFromMemory.
 	DeletePatientsFromMemory bool
 
+	// MessageLogSize is the number of sent messages that Config.MessageLog keeps.
+	// If zero, sent messages are not logged.
+	MessageLogSize int
+
+	// GroundTruthArguments to create Config.GroundTruth.
+	// If not set, the state of the patients is not exported.
+	GroundTruthArguments *GroundTruthArguments
+
+	// TracingArguments to create Config.Tracer.
+	// If not set, pathways and events are not traced.
+	TracingArguments *TracingArguments
+
+	// ProvenanceArguments to create Config.Provenance.
+	// If not set, messages are not tagged with their provenance.
+	ProvenanceArguments *ProvenanceArguments
+
 	// PathwayArguments to create Config.PathwayManager.
 	PathwayArguments *PathwayArguments
 
 	// SenderArguments to create Config.Sender.
 	SenderArguments *SenderArguments
 
+	// LoadTestArguments to create Config.Sender in load-test mode.
+	// If not set, messages are sent on a single connection.
+	LoadTestArguments *LoadTestArguments
+
+	// FaultArguments to inject delivery faults into the messages sent by Config.Sender.
+	// If not set, no faults are injected.
+	FaultArguments *FaultArguments
+
 	// DataFiles to set as Config.DataFiles.
 	DataFiles *config.DataFiles
 
@@ -180,9 +229,17 @@ type SenderArguments struct {
 	// Output specified where the generated HL7 messages will be sent.
 	Output string
 
-	// OutputFile is a file path to write messages if Output=file.
+	// OutputFile is a file path to write messages if Output=file or Output=batch_file.
 	OutputFile string
 
+	// BatchMaxMessages is the maximum number of messages in each batch of the batch file.
+	// Zero means that there is no limit. Only relevant if Output=batch_file.
+	BatchMaxMessages int
+
+	// BatchWindow is the maximum time that each batch of the batch file spans.
+	// Zero means that there is no limit. Only relevant if Output=batch_file.
+	BatchWindow time.Duration
+
 	// MllpDestination is Host:Port to which MLLP messages will be sent if Output=mllp.
 	MllpDestination string
 
@@ -193,6 +250,89 @@ type SenderArguments struct {
 	// MllpKeepAliveInterval is an interval between keep-alive messages.
 	// Only relevant if Output=mllp and MllpKeepAlive=true.
 	MllpKeepAliveInterval *time.Duration
+
+	// RecordingFile is a file to record the messages sent to, so that they can be replayed.
+	// If empty, messages are not recorded.
+	RecordingFile string
+}
+
+// LoadTestArguments contains arguments to send messages on several MLLP connections in parallel.
+// Messages are sent in parallel if Connections is positive. Only relevant if SenderArguments.Output=mllp.
+type LoadTestArguments struct {
+	// Connections is the number of MLLP connections that messages are sent on.
+	Connections int
+
+	// MessagesPerSecond is the target number of messages sent per second.
+	// If zero, messages are sent as fast as the receiver acknowledges them.
+	MessagesPerSecond float64
+
+	// ReportFile is the file where the throughput and latency report is written at the end of the run.
+	// If empty, the report is only logged.
+	ReportFile string
+}
+
+// FaultArguments contains arguments to inject delivery faults into the messages sent.
+// Each field is the probability of injecting a kind of fault into a message; see the fault package
+// for what each fault does. Faults are injected if at least one of the probabilities is positive.
+type FaultArguments struct {
+	Duplicate       float64
+	Reorder         float64
+	Drop            float64
+	Truncate        float64
+	Corrupt         float64
+	CloseConnection float64
+
+	// MaxHold is the maximum time that a message is held back by a Reorder fault.
+	// If zero, fault.DefaultMaxHold is used.
+	MaxHold time.Duration
+
+	// LogFile is the file where the faults injected are written.
+	// If empty, faults are only logged.
+	LogFile string
+
+	// Seed is the seed to decide which faults to inject. If zero, a random seed is used.
+	Seed int64
+}
+
+func (a FaultArguments) enabled() bool {
+	return a.Duplicate > 0 || a.Reorder > 0 || a.Drop > 0 || a.Truncate > 0 || a.Corrupt > 0 || a.CloseConnection > 0
+}
+
+// GroundTruthArguments contains arguments to create a ground truth writer.
+type GroundTruthArguments struct {
+	// Dir is the directory to write the snapshots of the patients to.
+	// If empty, the state of the patients is not exported.
+	Dir string
+
+	// Format is the format of the snapshots: either "json" or "csv".
+	Format string
+}
+
+// ProvenanceArguments contains arguments to create a provenance tagger.
+// Messages are tagged if at least one of Segment and LogFile is set.
+type ProvenanceArguments struct {
+	// Segment is the name of the Z-segment with the provenance that is appended to every message.
+	Segment string
+
+	// LogFile is the file where the provenance of every message is written.
+	LogFile string
+
+	// RunID identifies the run in the provenance. If empty, a random ID is used.
+	RunID string
+
+	// Tags describe the scenario being simulated.
+	Tags []string
+}
+
+// TracingArguments contains arguments to create a Tracer.
+type TracingArguments struct {
+	// Output specifies where the spans are exported: either "stdout" or "otlp".
+	// If empty, pathways and events are not traced.
+	Output string
+
+	// OTLPEndpoint is the URL of the OpenTelemetry collector to export the spans to, e.g.,
+	// "http://localhost:4318". Only relevant if Output=otlp.
+	OTLPEndpoint string
 }
 
 // ResourceArguments contains arguments to create a ResourceWriter.
@@ -252,6 +392,27 @@ type Config struct {
 	// Sender contains the sender of HL7 messages.
 	Sender hl7.Sender
 
+	// Validation contains the checks to run on every message before it is sent, in addition to the
+	// checks derived from the HL7 schema. Messages with validation issues are logged, and sent anyway.
+	// Optional. If nil, messages are not validated.
+	Validation *hl7.ValidationOptions
+
+	// MessageLog keeps the most recent messages that have been sent, so that they can be searched.
+	// Optional. If nil, sent messages are not kept.
+	MessageLog *messagelog.Log
+
+	// GroundTruth writes a snapshot of the state of the patients of each event after the event runs.
+	// Optional. If nil, the state of the patients is not exported.
+	GroundTruth groundtruth.Writer
+
+	// Provenance tags every message with the pathway and step that generated it.
+	// Optional. If nil, messages are not tagged.
+	Provenance *provenance.Tagger
+
+	// Tracer records a trace for each pathway run, with a span for each of its events.
+	// Optional. If nil, pathways and events are not traced.
+	Tracer *tracing.Tracer
+
 	// Whether patients are deleted from the in-memory map after their pathways finish.
 	// Deleting patients saves memory, but patients cannot be reused for other pathways.
 	DeletePatientsFromMemory bool
@@ -353,10 +514,87 @@ func DefaultConfig(ctx context.Context, arguments Arguments) (Config, error) {
 		}
 	}
 
+	if arguments.ValidationConfigFile != nil {
+		if c.Validation, err = config.LoadValidationConfig(ctx, *arguments.ValidationConfigFile); err != nil {
+			return Config{}, errors.Wrap(err, "cannot load the validation configuration")
+		}
+	}
+
+	if arguments.ZSegmentsFile != nil {
+		segments, err := config.LoadZSegments(ctx, *arguments.ZSegmentsFile)
+		if err != nil {
+			return Config{}, errors.Wrap(err, "cannot load the Z-segments")
+		}
+		for _, s := range segments {
+			if err := hl7.RegisterSegment(s); err != nil {
+				return Config{}, errors.Wrapf(err, "cannot register Z-segment %s", s.Name)
+			}
+		}
+	}
+
 	if arguments.SenderArguments != nil {
-		if c.Sender, err = hl7Sender(*arguments.SenderArguments); err != nil {
+		if a := arguments.LoadTestArguments; a != nil && a.Connections > 0 {
+			c.Sender, err = loadTestSender(*arguments.SenderArguments, *a)
+		} else {
+			c.Sender, err = hl7Sender(*arguments.SenderArguments, c.Header, c.Clock)
+		}
+		if err != nil {
 			return Config{}, errors.Wrap(err, "cannot create the sender")
 		}
+		// Faults are injected into the messages as they are sent, after they are encoded.
+		if a := arguments.FaultArguments; a != nil && a.enabled() {
+			c.Sender, err = fault.NewSender(c.Sender, fault.Config{
+				Duplicate:       a.Duplicate,
+				Reorder:         a.Reorder,
+				Drop:            a.Drop,
+				Truncate:        a.Truncate,
+				Corrupt:         a.Corrupt,
+				CloseConnection: a.CloseConnection,
+				MaxHold:         a.MaxHold,
+				LogFile:         a.LogFile,
+				Seed:            a.Seed,
+			})
+			if err != nil {
+				return Config{}, errors.Wrap(err, "cannot create the fault injection sender")
+			}
+		}
+		// Messages are built as UTF-8, and encoded in the character set they declare when sent.
+		c.Sender = hl7.NewEncodingSender(c.Sender)
+		if file := arguments.SenderArguments.RecordingFile; file != "" {
+			if c.Sender, err = hl7.NewRecordingSender(c.Sender, file, senderDestination(*arguments.SenderArguments)); err != nil {
+				return Config{}, errors.Wrap(err, "cannot create the recording sender")
+			}
+		}
+	}
+
+	if arguments.MessageLogSize != 0 {
+		if c.MessageLog, err = messagelog.New(arguments.MessageLogSize); err != nil {
+			return Config{}, errors.Wrap(err, "cannot create the message log")
+		}
+	}
+
+	if arguments.GroundTruthArguments != nil && arguments.GroundTruthArguments.Dir != "" {
+		if c.GroundTruth, err = groundtruth.NewWriter(arguments.GroundTruthArguments.Dir, arguments.GroundTruthArguments.Format); err != nil {
+			return Config{}, errors.Wrap(err, "cannot create the ground truth writer")
+		}
+	}
+
+	if a := arguments.ProvenanceArguments; a != nil && (a.Segment != "" || a.LogFile != "") {
+		c.Provenance, err = provenance.NewTagger(provenance.Config{
+			Segment: a.Segment,
+			LogFile: a.LogFile,
+			RunID:   a.RunID,
+			Tags:    a.Tags,
+		})
+		if err != nil {
+			return Config{}, errors.Wrap(err, "cannot create the provenance tagger")
+		}
+	}
+
+	if arguments.TracingArguments != nil {
+		if c.Tracer, err = tracer(*arguments.TracingArguments); err != nil {
+			return Config{}, errors.Wrap(err, "cannot create the tracer")
+		}
 	}
 
 	if arguments.ResourceArguments != nil && c.HL7Config != nil {
@@ -432,7 +670,7 @@ func resourceMarshaller(arguments ResourceArguments) (fhir.Marshaller, error) {
 	}
 }
 
-func hl7Sender(arguments SenderArguments) (hl7.Sender, error) {
+func hl7Sender(arguments SenderArguments, header *config.Header, clock clock.Clock) (hl7.Sender, error) {
 	switch arguments.Output {
 	case "stdout":
 		return hl7.NewStdoutSender(), nil
@@ -440,11 +678,65 @@ func hl7Sender(arguments SenderArguments) (hl7.Sender, error) {
 		return hl7.NewMLLPSender(arguments.MllpDestination, arguments.MllpKeepAlive, *arguments.MllpKeepAliveInterval)
 	case "file":
 		return hl7.NewFileSender(arguments.OutputFile)
+	case "batch_file":
+		options := hl7.BatchOptions{MaxMessages: arguments.BatchMaxMessages, Window: arguments.BatchWindow, Now: clock.Now}
+		if header != nil {
+			options.SendingApplication = header.Default.SendingApplication
+			options.SendingFacility = header.Default.SendingFacility
+			options.ReceivingApplication = header.Default.ReceivingApplication
+			options.ReceivingFacility = header.Default.ReceivingFacility
+		}
+		return hl7.NewBatchFileSender(arguments.OutputFile, options)
 	default:
 		return nil, errors.Errorf("unsupported output type %q", arguments.Output)
 	}
 }
 
+// senderDestination describes where the sender created with the given arguments sends messages,
+// e.g., "mllp:localhost:6661".
+func senderDestination(arguments SenderArguments) string {
+	switch arguments.Output {
+	case "mllp":
+		return fmt.Sprintf("%s:%s", arguments.Output, arguments.MllpDestination)
+	case "file", "batch_file":
+		return fmt.Sprintf("%s:%s", arguments.Output, arguments.OutputFile)
+	default:
+		return arguments.Output
+	}
+}
+
+// loadTestSender returns a sender that sends messages on several MLLP connections in parallel.
+func loadTestSender(arguments SenderArguments, loadTest LoadTestArguments) (hl7.Sender, error) {
+	if arguments.Output != "mllp" {
+		return nil, errors.Errorf("unsupported output type %q for load tests; only mllp is supported", arguments.Output)
+	}
+	newMLLPSender := func() (hl7.Sender, error) {
+		return hl7.NewMLLPSender(arguments.MllpDestination, arguments.MllpKeepAlive, *arguments.MllpKeepAliveInterval)
+	}
+	return loadtest.NewSender(loadtest.Config{
+		Connections:       loadTest.Connections,
+		MessagesPerSecond: loadTest.MessagesPerSecond,
+		ReportFile:        loadTest.ReportFile,
+	}, newMLLPSender)
+}
+
+func tracer(arguments TracingArguments) (*tracing.Tracer, error) {
+	switch arguments.Output {
+	case "":
+		return nil, nil
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	case "otlp":
+		e, err := tracing.NewOTLPExporter(arguments.OTLPEndpoint, tracingServiceName)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.NewTracer(e), nil
+	default:
+		return nil, errors.Errorf("unsupported tracing output %q", arguments.Output)
+	}
+}
+
 func pathwayManager(ctx context.Context, p *pathway.Parser, arguments PathwayArguments) (pathway.Manager, error) {
 	pathways, err := p.ParsePathways(ctx, arguments.Dir)
 	if err != nil {
@@ -503,6 +795,12 @@ type Hospital struct {
 	resourceWriter          ResourceWriter
 	messageConfig           *config.HL7Config
 	orderAckDelay           *pathway.Delay
+	validation              *hl7.ValidationOptions
+	messageLog              *messagelog.Log
+	tracer                  *tracing.Tracer
+	groundTruth             groundtruth.Writer
+	controlIDs              *controlIDs
+	provenance              *provenance.Tagger
 }
 
 func init() {
@@ -533,6 +831,57 @@ func (h *Hospital) ProcessNextMessageIfDue() (bool, error) {
 	return err == nil, err
 }
 
+// ProcessNextMessage processes the next message on the message queue, even if it is not due yet.
+// Returns true if there was a message for processing and the processing was successful, false otherwise.
+func (h *Hospital) ProcessNextMessage() (bool, error) {
+	if !h.HasMessages() {
+		return false, nil
+	}
+	err := h.processNextMessage()
+	return err == nil, err
+}
+
+// RunNextEvent runs the next event on the event queue, even if it is not due yet.
+// Returns the event that ran, or nil if the event queue is empty.
+func (h *Hospital) RunNextEvent(ctx context.Context) (*state.Event, error) {
+	i := h.eventQ.Peek()
+	if i == nil {
+		return nil, nil
+	}
+	e, ok := i.(state.Event)
+	if !ok {
+		return nil, errors.Errorf("unknown item type %T, want state.Event", i)
+	}
+	if err := h.runNextEvent(ctx); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ProcessMessagesDueBy processes the messages on the message queue whose message time is not after t,
+// even if they are not due yet.
+// Returns the number of messages that were processed.
+func (h *Hospital) ProcessMessagesDueBy(t time.Time) (int, error) {
+	n := 0
+	for {
+		i := h.messageQ.Peek()
+		if i == nil {
+			return n, nil
+		}
+		m, ok := i.(state.HL7Message)
+		if !ok {
+			return n, errors.Errorf("unknown item type %T, want state.HL7Message", i)
+		}
+		if m.MessageTime.Unix() > t.Unix() {
+			return n, nil
+		}
+		if err := h.processNextMessage(); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
 func (h Hospital) hasDueEvent() bool {
 	i := h.eventQ.Peek()
 	if i == nil {
@@ -710,6 +1059,12 @@ func NewHospital(ctx context.Context, c Config) (*Hospital, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to load the message data configuration")
 	}
+	if err := dataConfig.ValidateCharacterSet(c.Header.CharacterSet); err != nil {
+		return nil, errors.Wrap(err, "invalid message data configuration")
+	}
+	if err := c.OrderProfiles.ValidateAbnormalResults(dataConfig.Comorbidities); err != nil {
+		return nil, errors.Wrap(err, "invalid comorbidities")
+	}
 
 	genConfig := generator.Config{
 		Clock:            c.Clock,
@@ -732,7 +1087,7 @@ func NewHospital(ctx context.Context, c Config) (*Hospital, error) {
 	if ac.OrderAckDelay == nil {
 		ac.OrderAckDelay = defaultOrderAckDelay
 	}
-	return &Hospital{
+	h := &Hospital{
 		clock:                   c.Clock,
 		sender:                  c.Sender,
 		generator:               generator.NewGenerator(genConfig),
@@ -746,7 +1101,15 @@ func NewHospital(ctx context.Context, c Config) (*Hospital, error) {
 		resourceWriter:          c.ResourceWriter,
 		messageConfig:           c.HL7Config,
 		orderAckDelay:           ac.OrderAckDelay,
-	}, nil
+		validation:              c.Validation,
+		messageLog:              c.MessageLog,
+		tracer:                  c.Tracer,
+		groundTruth:             c.GroundTruth,
+		controlIDs:              &controlIDs{byEvent: map[*state.Event][]string{}},
+		provenance:              c.Provenance,
+	}
+	h.updateQueueLengths()
+	return h, nil
 }
 
 // Close closes resources held by the Hospital.
@@ -758,6 +1121,19 @@ func (h *Hospital) Close() error {
 	if err := h.resourceWriter.Close(); err != nil {
 		return errors.Wrap(err, "error closing fhir resource writer")
 	}
+	if err := h.tracer.Close(); err != nil {
+		return errors.Wrap(err, "error closing tracer")
+	}
+	if h.groundTruth != nil {
+		if err := h.groundTruth.Close(); err != nil {
+			return errors.Wrap(err, "error closing ground truth writer")
+		}
+	}
+	if h.provenance != nil {
+		if err := h.provenance.Close(); err != nil {
+			return errors.Wrap(err, "error closing provenance tagger")
+		}
+	}
 	return nil
 }
 
@@ -785,6 +1161,12 @@ func newEventQueue(syncer persist.ItemSyncer) *state.WrappedQueue {
 	return eventQ
 }
 
+// updateQueueLengths sets the metrics with the number of items in the queues.
+func (h *Hospital) updateQueueLengths() {
+	counters.SimulatedHospital.EventQueueLength.Set(float64(h.eventQ.Len()))
+	counters.SimulatedHospital.MessageQueueLength.Set(float64(h.messageQ.Len()))
+}
+
 // PatientsLen returns the number of patients in the internal patients map.
 func (h *Hospital) PatientsLen() int {
 	return h.patients.Len()
@@ -800,7 +1182,27 @@ func (h *Hospital) MessagesLen() int {
 	return h.messageQ.Len()
 }
 
+// MessageLog returns the log of the messages that have been sent, or nil if sent messages are
+// not logged.
+func (h *Hospital) MessageLog() *messagelog.Log {
+	return h.messageLog
+}
+
 // PatientExists returns whether the patient with the given id is a known patient.
 func (h *Hospital) PatientExists(id string) bool {
 	return h.patients.Get(id) != nil
 }
+
+// Patients returns the patients in the internal patients map, sorted by MRN.
+func (h *Hospital) Patients() []*state.Patient {
+	return h.patients.All()
+}
+
+// PathwayNames returns the names of the pathways that can be started by name, alphabetically
+// sorted, or nil if the pathway manager cannot list them.
+func (h *Hospital) PathwayNames() []string {
+	if l, ok := h.pathwayManager.(interface{ PathwayNames() []string }); ok {
+		return l.PathwayNames()
+	}
+	return nil
+}
@@ -16,11 +16,14 @@ package hospital_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -29,15 +32,19 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/testing/protocmp"
+	"github.com/google/simhospital/pkg/constants"
 	"github.com/google/simhospital/pkg/generator/header"
+	"github.com/google/simhospital/pkg/groundtruth"
 	"github.com/google/simhospital/pkg/hardcoded"
 	"github.com/google/simhospital/pkg/hl7"
 	. "github.com/google/simhospital/pkg/hospital"
 	"github.com/google/simhospital/pkg/ir"
 	"github.com/google/simhospital/pkg/logging"
 	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/messagelog"
 	"github.com/google/simhospital/pkg/pathway"
 	"github.com/google/simhospital/pkg/processor"
+	"github.com/google/simhospital/pkg/provenance"
 	"github.com/google/simhospital/pkg/state/persist"
 	"github.com/google/simhospital/pkg/state"
 	"github.com/google/simhospital/pkg/test"
@@ -47,6 +54,7 @@ import (
 	"github.com/google/simhospital/pkg/test/testmetrics"
 	"github.com/google/simhospital/pkg/test/teststate"
 	"github.com/google/simhospital/pkg/test/testwrite"
+	"github.com/google/simhospital/pkg/tracing"
 )
 
 var (
@@ -548,6 +556,61 @@ func TestRunPathwayWithMultipleHeaderFields(t *testing.T) {
 	}
 }
 
+func TestRunPathwayWithZSegments(t *testing.T) {
+	ctx := context.Background()
+	d := &hl7.SegmentDefinition{
+		Name:   "ZHT",
+		Fields: []hl7.FieldDefinition{{Name: "Set ID", DataType: "SI"}, {Name: "VIP Indicator", DataType: "CE"}},
+	}
+	if err := hl7.RegisterSegment(d); err != nil {
+		t.Fatalf("RegisterSegment(%+v) failed with %v", d, err)
+	}
+	defer hl7.UnregisterSegment(d.Name)
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{
+				Admission:  &pathway.Admission{Loc: testLoc},
+				Parameters: &pathway.Parameters{Custom: map[string]string{"ZHT-2": "VIP^Very Important Person"}},
+			},
+			{
+				Order:      &pathway.Order{OrderProfile: "UREA AND ELECTROLYTES"},
+				Parameters: &pathway.Parameters{Custom: map[string]string{"ZHT-2": "Comment with a | bar"}},
+			},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+
+	hospital := newHospital(ctx, t, Config{}, pathways)
+	defer hospital.Close()
+	startPathway(t, hospital, testPathwayName)
+	_, messages := hospital.ConsumeQueues(ctx, t)
+
+	// The Z-segments are only added to the message of the step, not to the order acknowledgement.
+	got := map[string]string{}
+	for _, m := range messages {
+		var zSegments []string
+		for _, s := range strings.Split(m, message.SegmentTerminator) {
+			if strings.HasPrefix(s, "ZHT") {
+				zSegments = append(zSegments, s)
+			}
+		}
+		ids, err := message.ParseIdentifiers(m)
+		if err != nil {
+			t.Fatalf("message.ParseIdentifiers(%q) failed with %v", m, err)
+		}
+		got[ids.MessageType] = strings.Join(zSegments, ",")
+	}
+	want := map[string]string{
+		"ADT^A01": "ZHT||VIP^Very Important Person",
+		"ORM^O01": `ZHT||Comment with a \F\ bar`,
+		"ORR^O02": "",
+		"ADT^A03": "",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Z-segments got diff (-want, +got)\n%s", diff)
+	}
+}
+
 func TestRunPathway_StepTypes(t *testing.T) {
 	ctx := context.Background()
 	type metric struct {
@@ -3825,6 +3888,338 @@ func TestRunPathwayWithHardcodedMessage(t *testing.T) {
 	}
 }
 
+func TestRunEvent_MetricsByStepType(t *testing.T) {
+	ctx := context.Background()
+	mr := testmetrics.NewRetrieverFromGatherer(t)
+	pathwayName := "pathway-metrics-by-step-type"
+	pathways := map[string]pathway.Pathway{
+		pathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	hospital := newHospital(ctx, t, Config{}, pathways)
+	defer hospital.Close()
+
+	startPathway(t, hospital, pathwayName)
+	hospital.ConsumeQueues(ctx, t)
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+	}{{
+		name:   "simulated_hospital_events_total",
+		labels: map[string]string{"pathway_name": pathwayName, "step_type": pathway.StepAdmission},
+	}, {
+		name:   "simulated_hospital_events_total",
+		labels: map[string]string{"pathway_name": pathwayName, "step_type": pathway.StepDischarge},
+	}, {
+		name:   "simulated_hospital_messages_total",
+		labels: map[string]string{"pathway_name": pathwayName, "step_type": pathway.StepAdmission, "message_type": "adt", "trigger_event": "A01"},
+	}, {
+		name:   "simulated_hospital_messages_total",
+		labels: map[string]string{"pathway_name": pathwayName, "step_type": pathway.StepDischarge, "message_type": "adt", "trigger_event": "A03"},
+	}} {
+		initial, final := mr.GetCounterValues(t, tc.name, tc.labels)
+		if got, want := final-initial, 1.0; got != want {
+			t.Errorf("%s%v got %v, want %v", tc.name, tc.labels, got, want)
+		}
+	}
+	if got, want := hospital.EventsLen()+hospital.MessagesLen(), 0; got != want {
+		t.Errorf("EventsLen()+MessagesLen() got %d, want %d", got, want)
+	}
+}
+
+func TestRunEvent_GroundTruth(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	dir := testwrite.TempDir(t)
+	w, err := groundtruth.NewWriter(dir, groundtruth.FormatJSON)
+	if err != nil {
+		t.Fatalf("groundtruth.NewWriter(%q, %q) failed with %v", dir, groundtruth.FormatJSON, err)
+	}
+	hospital := newHospital(ctx, t, Config{GroundTruth: w}, pathways)
+
+	startPathway(t, hospital, testPathwayName)
+	_, messages := hospital.ConsumeQueues(ctx, t)
+	if err := hospital.Close(); err != nil {
+		t.Fatalf("hospital.Close() failed with %v", err)
+	}
+	if got, want := len(messages), 2; got != want {
+		t.Fatalf("len(messages) got %d, want %d", got, want)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, groundtruth.JSONFile))
+	if err != nil {
+		t.Fatalf("ReadFile(%q) failed with %v", groundtruth.JSONFile, err)
+	}
+	var snapshots []groundtruth.Snapshot
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var s groundtruth.Snapshot
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", line, err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	if got, want := len(snapshots), 2; got != want {
+		t.Fatalf("len(snapshots) got %d, want %d", got, want)
+	}
+
+	type summary struct {
+		StepIndex  int
+		StepType   string
+		ControlIDs []string
+		Status     string
+		Ended      bool
+	}
+	var got []summary
+	for _, s := range snapshots {
+		if s.PathwayName != testPathwayName {
+			t.Errorf("PathwayName got %q, want %q", s.PathwayName, testPathwayName)
+		}
+		if got, want := len(s.Encounters), 1; got != want {
+			t.Fatalf("len(Encounters) got %d, want %d", got, want)
+		}
+		ec := s.Encounters[0]
+		got = append(got, summary{StepIndex: s.StepIndex, StepType: s.StepType, ControlIDs: s.ControlIDs, Status: ec.Status, Ended: ec.End != nil})
+	}
+	want := []summary{{
+		StepIndex:  0,
+		StepType:   pathway.StepAdmission,
+		ControlIDs: []string{testhl7.MessageControlIDFromMSH(t, messages[0])},
+		Status:     constants.EncounterStatusArrived,
+	}, {
+		StepIndex:  1,
+		StepType:   pathway.StepDischarge,
+		ControlIDs: []string{testhl7.MessageControlIDFromMSH(t, messages[1])},
+		Status:     constants.EncounterStatusFinished,
+		Ended:      true,
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("snapshots got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunEvent_Provenance(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	logFile := filepath.Join(testwrite.TempDir(t), "provenance.jsonl")
+	tagger, err := provenance.NewTagger(provenance.Config{Segment: "ZSH", LogFile: logFile, RunID: "run-1", Tags: []string{"test"}})
+	if err != nil {
+		t.Fatalf("provenance.NewTagger() failed with %v", err)
+	}
+	hospital := newHospital(ctx, t, Config{Provenance: tagger}, pathways)
+
+	startPathway(t, hospital, testPathwayName)
+	_, messages := hospital.ConsumeQueues(ctx, t)
+	if err := hospital.Close(); err != nil {
+		t.Fatalf("hospital.Close() failed with %v", err)
+	}
+	if got, want := len(messages), 2; got != want {
+		t.Fatalf("len(messages) got %d, want %d", got, want)
+	}
+
+	var segments []string
+	for _, m := range messages {
+		s := strings.Split(strings.TrimSpace(m), message.SegmentTerminator)
+		segments = append(segments, s[len(s)-1])
+	}
+	wantSegments := []string{
+		fmt.Sprintf("ZSH|%s|0|%s|run-1|test|N", testPathwayName, pathway.StepAdmission),
+		fmt.Sprintf("ZSH|%s|1|%s|run-1|test|N", testPathwayName, pathway.StepDischarge),
+	}
+	if diff := cmp.Diff(wantSegments, segments); diff != "" {
+		t.Errorf("last segments got diff (-want +got):\n%s", diff)
+	}
+
+	b, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("ReadFile(%q) failed with %v", logFile, err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var r provenance.Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", line, err)
+		}
+		got = append(got, fmt.Sprintf("%s %s %d", r.ControlID, r.StepType, r.StepIndex))
+	}
+	want := []string{
+		fmt.Sprintf("%s %s 0", testhl7.MessageControlIDFromMSH(t, messages[0]), pathway.StepAdmission),
+		fmt.Sprintf("%s %s 1", testhl7.MessageControlIDFromMSH(t, messages[1]), pathway.StepDischarge),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("provenance log got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunEvent_Provenance_HardcodedMessage(t *testing.T) {
+	ctx := context.Background()
+	mr := testmetrics.NewRetrieverFromGatherer(t)
+	pathwayName := "pathway-provenance-hardcoded"
+	pathways := map[string]pathway.Pathway{
+		pathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{HardcodedMessage: &pathway.HardcodedMessage{Regex: "DischargeHardcodedMessage"}},
+		}},
+	}
+	dir := testwrite.BytesToDir(t, []byte(hardcodedMessageYml), "hardcoded_messages.yml")
+	msgControlGen := &header.MessageControlGenerator{}
+	hardcodedMessagesManager, err := hardcoded.NewManager(ctx, dir, msgControlGen)
+	if err != nil {
+		t.Fatalf("NewManager(%s) failed with %v", hardcodedMessageYml, err)
+	}
+	logFile := filepath.Join(testwrite.TempDir(t), "provenance.jsonl")
+	tagger, err := provenance.NewTagger(provenance.Config{Segment: "ZSH", LogFile: logFile, RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("provenance.NewTagger() failed with %v", err)
+	}
+	hospital := newHospital(ctx, t, Config{Provenance: tagger, MessagesManager: hardcodedMessagesManager, MessageControlGenerator: msgControlGen}, pathways)
+
+	startPathway(t, hospital, pathwayName)
+	_, messages := hospital.ConsumeQueues(ctx, t)
+	if err := hospital.Close(); err != nil {
+		t.Fatalf("hospital.Close() failed with %v", err)
+	}
+	if got, want := len(messages), 2; got != want {
+		t.Fatalf("len(messages) got %d, want %d", got, want)
+	}
+	// The hardcoded message is sent as it is defined, without the provenance segment.
+	if strings.Contains(messages[1], message.SegmentTerminator+"ZSH|") {
+		t.Errorf("hardcoded message got provenance segment, want none: %q", messages[1])
+	}
+
+	b, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("ReadFile(%q) failed with %v", logFile, err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var r provenance.Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", line, err)
+		}
+		got = append(got, fmt.Sprintf("%s %s %d", r.ControlID, r.StepType, r.StepIndex))
+	}
+	want := []string{
+		fmt.Sprintf("%s %s 0", testhl7.MessageControlIDFromMSH(t, messages[0]), pathway.StepAdmission),
+		fmt.Sprintf("%s %s 1", testhl7.MessageControlIDFromMSH(t, messages[1]), pathway.StepHardcodedMessage),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("provenance log got diff (-want +got):\n%s", diff)
+	}
+
+	metric := "simulated_hospital_errors_total"
+	labels := map[string]string{"pathway_name": pathwayName, "reason": "provenance"}
+	initial, final := mr.GetCounterValues(t, metric, labels)
+	if got, want := final-initial, 0.0; got != want {
+		t.Errorf("Metric %s[%v] is incremented by %f (initial=%f, final=%f); want %f", metric, labels, got, initial, final, want)
+	}
+}
+
+// spanExporter keeps the spans exported.
+type spanExporter struct {
+	spans []tracing.Span
+}
+
+func (e *spanExporter) Export(spans []tracing.Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *spanExporter) Close() error {
+	return nil
+}
+
+func TestRunEvent_Tracing(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	e := &spanExporter{}
+	tracer := tracing.NewTracer(e)
+	hospital := newHospital(ctx, t, Config{Tracer: tracer}, pathways)
+	defer hospital.Close()
+
+	startPathway(t, hospital, testPathwayName)
+	hospital.ConsumeQueues(ctx, t)
+	// Closing the tracer exports all the spans.
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("tracer.Close() failed with %v", err)
+	}
+
+	patients := hospital.Patients()
+	if got, want := len(patients), 1; got != want {
+		t.Fatalf("len(hospital.Patients()) got %d, want %d", got, want)
+	}
+	mrn := patients[0].PatientInfo.Person.MRN
+
+	type span struct {
+		Name       string
+		Root       bool
+		Attributes []tracing.Attribute
+	}
+	var got []span
+	var root tracing.SpanContext
+	for _, s := range e.spans {
+		got = append(got, span{Name: s.Name, Root: s.Parent == tracing.SpanID{}, Attributes: s.Attributes})
+		if s.Parent == (tracing.SpanID{}) {
+			root = s.Context
+		}
+	}
+	want := []span{{
+		Name: pathway.StepAdmission,
+		Attributes: []tracing.Attribute{
+			tracing.String("mrn", mrn),
+			tracing.String("pathway_name", testPathwayName),
+			tracing.Int("step_index", 0),
+			tracing.Bool("is_historical", false),
+		},
+	}, {
+		Name: pathway.StepDischarge,
+		Attributes: []tracing.Attribute{
+			tracing.String("mrn", mrn),
+			tracing.String("pathway_name", testPathwayName),
+			tracing.Int("step_index", 1),
+			tracing.Bool("is_historical", false),
+		},
+	}, {
+		Name: testPathwayName,
+		Root: true,
+		Attributes: []tracing.Attribute{
+			tracing.String("mrn", mrn),
+			tracing.String("pathway_name", testPathwayName),
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("exported spans got diff (-want +got):\n%s", diff)
+	}
+	for _, s := range e.spans {
+		if s.Context.TraceID != root.TraceID {
+			t.Errorf("span %q got trace ID %v, want %v", s.Name, s.Context.TraceID, root.TraceID)
+		}
+		if s.Parent != (tracing.SpanID{}) && s.Parent != root.SpanID {
+			t.Errorf("span %q got parent %v, want %v", s.Name, s.Parent, root.SpanID)
+		}
+		if s.Error != "" {
+			t.Errorf("span %q got error %q, want no error", s.Name, s.Error)
+		}
+	}
+}
+
 func newHospital(ctx context.Context, t *testing.T, cfg Config, pathways map[string]pathway.Pathway) *testhospital.Hospital {
 	t.Helper()
 	return hospitalWithTime(ctx, t, cfg, pathways, now)
@@ -4301,3 +4696,158 @@ func TestStartNextPathway(t *testing.T) {
 		}
 	}
 }
+
+func TestEvents_Messages_Patients_CancelEvents(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	hospital := newHospital(ctx, t, Config{}, pathways)
+	defer hospital.Close()
+
+	if diff := cmp.Diff([]string{testPathwayName}, hospital.PathwayNames()); diff != "" {
+		t.Errorf("hospital.PathwayNames() got diff (-want +got):\n%s", diff)
+	}
+
+	startPathway(t, hospital, testPathwayName, testPathwayName)
+	patients := hospital.Patients()
+	if got, want := len(patients), 2; got != want {
+		t.Fatalf("len(hospital.Patients()) got %d, want %d", got, want)
+	}
+	events := hospital.Events()
+	if got, want := len(events), 2; got != want {
+		t.Fatalf("len(hospital.Events()) got %d, want %d", got, want)
+	}
+	if got, want := len(hospital.Messages()), 0; got != want {
+		t.Errorf("len(hospital.Messages()) got %d, want %d", got, want)
+	}
+
+	cancelled := patients[0].PatientInfo.Person.MRN
+	n, err := hospital.CancelEvents(cancelled)
+	if err != nil {
+		t.Fatalf("hospital.CancelEvents(%q) failed with %v", cancelled, err)
+	}
+	if got, want := n, 1; got != want {
+		t.Errorf("hospital.CancelEvents(%q) got %d, want %d", cancelled, got, want)
+	}
+	events = hospital.Events()
+	if got, want := len(events), 1; got != want {
+		t.Fatalf("len(hospital.Events()) got %d, want %d", got, want)
+	}
+	if got, notWant := events[0].PatientMRN, cancelled; got == notWant {
+		t.Errorf("hospital.Events()[0].PatientMRN got %q, want a different patient", got)
+	}
+
+	// Only the pathway of the other patient runs.
+	_, messages := hospital.ConsumeQueues(ctx, t)
+	if got, want := len(messages), 2; got != want {
+		t.Errorf("hospital.ConsumeQueues() got %d messages, want %d", got, want)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Delay: &pathway.Delay{From: time.Hour, To: time.Hour}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	hospital := newHospital(ctx, t, Config{}, pathways)
+	defer hospital.Close()
+
+	startPathway(t, hospital, testPathwayName, testPathwayName)
+	board := hospital.Board()
+	if diff := cmp.Diff(Census{Total: 2, Outpatient: 2, ByClass: map[string]int{"OUTPATIENT": 2}}, board.Census); diff != "" {
+		t.Errorf("hospital.Board().Census before admission got diff (-want +got):\n%s", diff)
+	}
+
+	// Run the admissions.
+	for i := 0; i < 2; i++ {
+		if _, err := hospital.RunNextEventIfDue(ctx); err != nil {
+			t.Fatalf("hospital.RunNextEventIfDue() failed with %v", err)
+		}
+	}
+	board = hospital.Board()
+	if diff := cmp.Diff(Census{Total: 2, Inpatient: 2, ByClass: map[string]int{"INPATIENT": 2}}, board.Census); diff != "" {
+		t.Errorf("hospital.Board().Census after admission got diff (-want +got):\n%s", diff)
+	}
+	var ward *Ward
+	for i, w := range board.Wards {
+		if w.Name == testLoc {
+			ward = &board.Wards[i]
+		}
+	}
+	if ward == nil {
+		t.Fatalf("hospital.Board().Wards got %v, want ward %q", board.Wards, testLoc)
+	}
+	if got, want := ward.Occupied, 2; got != want {
+		t.Errorf("ward.Occupied got %d, want %d", got, want)
+	}
+	if got, want := len(ward.Beds), 2; got != want {
+		t.Fatalf("len(ward.Beds) got %d, want %d", got, want)
+	}
+	p := ward.Beds[0].Patient
+	if p == nil {
+		t.Fatalf("ward.Beds[0].Patient got nil, want a patient")
+	}
+	if got, want := p.PathwayName, testPathwayName; got != want {
+		t.Errorf("ward.Beds[0].Patient.PathwayName got %q, want %q", got, want)
+	}
+	if p.NextEvent == nil {
+		t.Fatal("ward.Beds[0].Patient.NextEvent got nil, want the next event")
+	}
+
+	hospital.ConsumeQueues(ctx, t)
+	board = hospital.Board()
+	if diff := cmp.Diff(Census{ByClass: map[string]int{}}, board.Census); diff != "" {
+		t.Errorf("hospital.Board().Census after discharge got diff (-want +got):\n%s", diff)
+	}
+	for _, w := range board.Wards {
+		if w.Occupied != 0 {
+			t.Errorf("ward %q got %d occupied beds after discharge, want 0", w.Name, w.Occupied)
+		}
+	}
+}
+
+func TestProcessMessage_MessageLog(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		testPathwayName: {Pathway: []pathway.Step{
+			{Admission: &pathway.Admission{Loc: testLoc}},
+			{Discharge: &pathway.Discharge{}},
+		}},
+	}
+	l, err := messagelog.New(10)
+	if err != nil {
+		t.Fatalf("messagelog.New(10) failed with %v", err)
+	}
+	hospital := newHospital(ctx, t, Config{MessageLog: l}, pathways)
+	defer hospital.Close()
+
+	startPathway(t, hospital, testPathwayName, testPathwayName)
+	hospital.ConsumeQueues(ctx, t)
+
+	if got, want := l.Len(), 4; got != want {
+		t.Fatalf("l.Len() got %d, want %d", got, want)
+	}
+	patients := hospital.Patients()
+	if got, want := len(patients), 2; got != want {
+		t.Fatalf("len(hospital.Patients()) got %d, want %d", got, want)
+	}
+	mrn := patients[0].PatientInfo.Person.MRN
+	var got []string
+	for _, e := range l.Search(messagelog.Query{MRN: mrn}) {
+		got = append(got, e.MessageType)
+		if e.PathwayName != testPathwayName {
+			t.Errorf("entry.PathwayName got %q, want %q", e.PathwayName, testPathwayName)
+		}
+	}
+	if diff := cmp.Diff([]string{"ADT^A01", "ADT^A03"}, got); diff != "" {
+		t.Errorf("l.Search(MRN: %q) got message types diff (-want +got):\n%s", mrn, diff)
+	}
+}
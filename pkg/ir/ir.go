@@ -60,6 +60,15 @@ type CodedElement struct {
 	Text          string
 	CodingSystem  string
 	AlternateText string
+	// AlternateCodings are the codes for the same concept in other coding systems, e.g., LOINC or ICD-10.
+	AlternateCodings []Coding
+}
+
+// Coding is a code in a coding system.
+type Coding struct {
+	ID           string
+	Text         string
+	CodingSystem string
 }
 
 // Order represents a clinical order.
@@ -108,6 +117,8 @@ type Order struct {
 	// DiagnosticServID is the value to be set in the Diagnostic Serv Sect ID (OBR.24) field.
 	// If the value matches DiagnosticServIDMDOC, the order is for a document/clinical note.
 	DiagnosticServID string
+	// VitalSigns indicates that the results of the order are vital signs observations.
+	VitalSigns bool
 	// NumberOfPreviousResults is used to keep track of how many results were already sent for this order.
 	// This allows for starting with the correct OBX SetID when sending new results linked to that order.
 	NumberOfPreviousResults int
@@ -307,11 +318,103 @@ type PatientInfo struct {
 	Procedures      []*DiagnosisOrProcedure
 	Encounters      []*Encounter
 	PrimaryFacility *PrimaryFacility
+	// LabTrajectories are the trajectories followed by the values of numerical test results for this
+	// patient, keyed by test name. They persist across encounters.
+	LabTrajectories map[string]*LabTrajectory
+	// VitalSigns is the state of the vital signs of this patient. It persists across encounters.
+	VitalSigns *VitalSigns
+	// Problems is the problem list of this patient, i.e., their long-term conditions such as comorbidities.
+	// Unlike Diagnoses, problems persist across encounters.
+	Problems []*Problem
 	// AdditionalData allows users to enter arbitrary information about a patient's medical record.
 	// It is up to the user to decide what data is stored here.
 	AdditionalData interface{}
 }
 
+// Clinical statuses of problems.
+// Values: https://www.hl7.org/fhir/valueset-condition-clinical.html
+const (
+	ProblemActive     = "active"
+	ProblemRecurrence = "recurrence"
+	ProblemRelapse    = "relapse"
+	ProblemInactive   = "inactive"
+	ProblemRemission  = "remission"
+	ProblemResolved   = "resolved"
+)
+
+// Problem is a condition in the problem list of a patient, e.g., a comorbidity such as chronic kidney disease.
+type Problem struct {
+	Description *CodedElement
+	// ClinicalStatus is the clinical status of the problem, e.g., active or resolved.
+	ClinicalStatus string
+	Onset          NullTime
+	// Abatement is when the problem stopped being active, if it is not active.
+	Abatement NullTime
+	// AbnormalResults maps the names of the test types whose results are affected by the problem while it
+	// is active to the type of abnormal value: ABNORMAL_HIGH or ABNORMAL_LOW.
+	AbnormalResults map[string]string
+	// DiagnosisType is the type of diagnosis of the problem when it is sent as a diagnosis, e.g., "F".
+	DiagnosisType string
+}
+
+// IsActive returns whether the problem is active, including when it has come back.
+func (p *Problem) IsActive() bool {
+	switch p.ClinicalStatus {
+	case ProblemActive, ProblemRecurrence, ProblemRelapse:
+		return true
+	default:
+		return false
+	}
+}
+
+// LabTrajectory is the state of the trajectory followed by the values of a numerical test for a patient,
+// e.g., a creatinine that rises over two days. The values are derived from the trajectory at the time
+// of each observation, so that consecutive results are consistent with each other.
+type LabTrajectory struct {
+	// Spec identifies the definition of the trajectory in the pathway. Results with the same definition
+	// continue the trajectory, and results with a different one start a new trajectory.
+	Spec string
+	// Shape is the shape of the trajectory, e.g., RISING or PEAK_THEN_RECOVER.
+	Shape string
+	// Start is the time when the trajectory started.
+	Start time.Time
+	// Baseline is the value at Start.
+	Baseline float64
+	// Target is the value reached after Over, or the value of the peak.
+	Target      float64
+	Over        time.Duration
+	RecoverOver time.Duration
+	// NoisePercent is the coefficient of variation of the analytical noise added to each value.
+	NoisePercent float64
+	// Tracks is the name of the test whose trajectory this one follows, if any.
+	// If set, the values follow the relative changes of that trajectory, scaled by TracksFactor,
+	// and Shape, Target, Over and RecoverOver are not used.
+	Tracks       string
+	TracksFactor float64
+}
+
+// VitalSigns is the state of the vital signs of a patient. The vital signs are derived from the acuity of the
+// patient, which goes from 0 (well) to 1 (critically ill) and changes linearly over time from Baseline to Target.
+type VitalSigns struct {
+	// Spec identifies the definition of the vital signs in the pathway. Vitals with the same definition
+	// continue the trend, and vitals with a different one start a new trend from the current acuity.
+	Spec string
+	// Start is the time when the trend started.
+	Start time.Time
+	// Baseline is the acuity at Start.
+	Baseline float64
+	// Target is the acuity reached after Over.
+	Target float64
+	Over   time.Duration
+	// SupplementalOxygen is whether the patient is on supplemental oxygen, or nil if it depends on the acuity.
+	SupplementalOxygen *bool
+	// NoisePercent is the coefficient of variation of the measurement noise added to each value.
+	NoisePercent float64
+	// Offsets are the deviations of this patient from the typical values of a well person, keyed by
+	// vital sign. They are chosen when the patient has vital signs for the first time.
+	Offsets map[string]float64
+}
+
 // LatestEncounter retrieves the latest encounter from PatientInfo.
 func (p *PatientInfo) LatestEncounter() *Encounter {
 	if len(p.Encounters) == 0 {
@@ -0,0 +1,307 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadtest contains a sender to load test the systems that receive HL7 messages.
+package loadtest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/google/simhospital/pkg/message"
+)
+
+var log = logging.ForCallerPackage()
+
+// queueSize is the number of messages that can be waiting to be sent on each connection. Send
+// blocks while the queue of the connection is full.
+const queueSize = 100
+
+// Config configures a load test sender.
+type Config struct {
+	// Connections is the number of connections that messages are sent on in parallel.
+	Connections int
+	// MessagesPerSecond is the target number of messages sent per second across all connections.
+	// If zero, messages are sent as fast as the connections allow.
+	MessagesPerSecond float64
+	// ReportFile is the file where the report is written as JSON when the sender is closed.
+	// If empty, the report is only logged.
+	ReportFile string
+}
+
+// Report contains the throughput and latency of a load test.
+type Report struct {
+	Connections       int     `json:"connections"`
+	TargetRate        float64 `json:"target_messages_per_second,omitempty"`
+	Sent              int     `json:"sent"`
+	Failed            int     `json:"failed"`
+	DurationSeconds   float64 `json:"duration_seconds"`
+	MessagesPerSecond float64 `json:"messages_per_second"`
+	// LatencyMillis is the time between a message starting to be sent and its acknowledgement
+	// being received, in milliseconds.
+	LatencyMillis     Latency `json:"latency_ms"`
+	SentPerConnection []int   `json:"sent_per_connection"`
+}
+
+// Latency summarizes a set of latencies.
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Sender sends HL7 messages on several connections in parallel, at a target rate, and reports the
+// throughput and latency when it is closed.
+// The messages of a patient are always sent on the same connection, in the order in which they
+// are passed to Send, so that the receiver gets them in order.
+type Sender struct {
+	config      Config
+	connections []*connection
+	limiter     *limiter
+	now         func() time.Time
+	wg          sync.WaitGroup
+
+	// mu guards closed. It is held for reading while messages are queued, and for writing while the
+	// queues are closed.
+	mu     sync.RWMutex
+	closed bool
+
+	// timesMu guards started and finished, the times when the first message was queued and when the
+	// last message was sent.
+	timesMu  sync.Mutex
+	started  time.Time
+	finished time.Time
+}
+
+// connection is a connection and the messages waiting to be sent on it.
+// Only the goroutine that sends the messages of the connection accesses it, until the sender is
+// closed.
+type connection struct {
+	sender    hl7.Sender
+	queue     chan []byte
+	latencies []time.Duration
+	failed    int
+}
+
+// NewSender returns a sender that opens config.Connections connections with newSender, e.g., a
+// function that returns a new MLLP sender.
+func NewSender(config Config, newSender func() (hl7.Sender, error)) (*Sender, error) {
+	if config.Connections <= 0 {
+		return nil, errors.Errorf("invalid number of connections %d; must be positive", config.Connections)
+	}
+	if config.MessagesPerSecond < 0 {
+		return nil, errors.Errorf("invalid messages per second %v; must not be negative", config.MessagesPerSecond)
+	}
+	s := &Sender{config: config, now: time.Now}
+	if config.MessagesPerSecond > 0 {
+		s.limiter = &limiter{
+			interval: time.Duration(float64(time.Second) / config.MessagesPerSecond),
+			now:      time.Now,
+			sleep:    time.Sleep,
+		}
+	}
+	for i := 0; i < config.Connections; i++ {
+		sender, err := newSender()
+		if err != nil {
+			for _, c := range s.connections {
+				c.sender.Close()
+			}
+			return nil, errors.Wrapf(err, "cannot open connection %d", i)
+		}
+		s.connections = append(s.connections, &connection{sender: sender, queue: make(chan []byte, queueSize)})
+	}
+	for _, c := range s.connections {
+		s.wg.Add(1)
+		go s.run(c)
+	}
+	log.Infof("Sending messages on %d connections", config.Connections)
+	return s, nil
+}
+
+// Send queues the message to be sent on the connection of its patient, and returns once it is
+// queued. Errors sending the message are logged, and counted in the report, but they are not
+// returned: the metrics, message log and recording of the caller describe when messages are
+// queued, and only the report describes when they are delivered.
+func (s *Sender) Send(message []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errors.New("cannot send a message: the sender is closed")
+	}
+	s.timesMu.Lock()
+	if s.started.IsZero() {
+		s.started = s.now()
+	}
+	s.timesMu.Unlock()
+	// The caller can reuse the message after Send returns, but it is sent later.
+	s.connectionFor(message).queue <- append([]byte(nil), message...)
+	return nil
+}
+
+// Close sends the messages that are queued, closes the connections, and logs the report.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for _, c := range s.connections {
+		close(c.queue)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	var closeErr error
+	for i, c := range s.connections {
+		if err := c.sender.Close(); err != nil && closeErr == nil {
+			closeErr = errors.Wrapf(err, "cannot close connection %d", i)
+		}
+	}
+
+	r := s.Report()
+	log.Infof("Load test finished: %d messages sent and %d failed in %.1fs (%.1f messages per second); latency p50 %.1fms, p99 %.1fms",
+		r.Sent, r.Failed, r.DurationSeconds, r.MessagesPerSecond, r.LatencyMillis.P50, r.LatencyMillis.P99)
+	if s.config.ReportFile != "" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "cannot marshal the load test report")
+		}
+		if err := ioutil.WriteFile(s.config.ReportFile, b, 0644); err != nil {
+			return errors.Wrapf(err, "cannot write the load test report to %s", s.config.ReportFile)
+		}
+	}
+	return closeErr
+}
+
+// Report returns the report of the messages sent. It must only be called after the sender is
+// closed.
+func (s *Sender) Report() Report {
+	r := Report{
+		Connections:       len(s.connections),
+		TargetRate:        s.config.MessagesPerSecond,
+		SentPerConnection: make([]int, len(s.connections)),
+	}
+	var latencies []time.Duration
+	for i, c := range s.connections {
+		r.Sent += len(c.latencies)
+		r.Failed += c.failed
+		r.SentPerConnection[i] = len(c.latencies)
+		latencies = append(latencies, c.latencies...)
+	}
+	r.LatencyMillis = newLatency(latencies)
+	s.timesMu.Lock()
+	defer s.timesMu.Unlock()
+	if !s.started.IsZero() && s.finished.After(s.started) {
+		d := s.finished.Sub(s.started)
+		r.DurationSeconds = d.Seconds()
+		r.MessagesPerSecond = float64(r.Sent) / d.Seconds()
+	}
+	return r
+}
+
+// run sends the messages queued on the connection until the queue is closed.
+func (s *Sender) run(c *connection) {
+	defer s.wg.Done()
+	for message := range c.queue {
+		s.limiter.wait()
+		start := s.now()
+		err := c.sender.Send(message)
+		end := s.now()
+		s.timesMu.Lock()
+		if end.After(s.finished) {
+			s.finished = end
+		}
+		s.timesMu.Unlock()
+		if err != nil {
+			log.WithError(err).Error("Cannot send message")
+			c.failed++
+			continue
+		}
+		c.latencies = append(c.latencies, end.Sub(start))
+	}
+}
+
+// connectionFor returns the connection that the messages of the patient of msg are sent on.
+func (s *Sender) connectionFor(msg []byte) *connection {
+	h := fnv.New32a()
+	h.Write([]byte(message.PatientID(string(msg))))
+	return s.connections[h.Sum32()%uint32(len(s.connections))]
+}
+
+// newLatency summarizes the latencies, in milliseconds.
+// The percentiles are computed with the nearest-rank method.
+func newLatency(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	millis := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	percentile := func(p float64) float64 {
+		return millis(sorted[int(math.Ceil(p*float64(len(sorted))))-1])
+	}
+	return Latency{
+		Min:  millis(sorted[0]),
+		Mean: millis(total) / float64(len(sorted)),
+		P50:  percentile(0.5),
+		P90:  percentile(0.9),
+		P99:  percentile(0.99),
+		Max:  millis(sorted[len(sorted)-1]),
+	}
+}
+
+// limiter spaces out the messages sent on all connections so that they are sent at a target rate.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// next is the earliest time when the next message can be sent.
+	next  time.Time
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// wait waits until the next message can be sent. Time when no messages were sent is not made up
+// for later with bursts of messages. A nil limiter never waits.
+func (l *limiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if d := at.Sub(now); d > 0 {
+		l.sleep(d)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/test/testhl7"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+func testMessage(mrn string, i int) string {
+	return strings.Join([]string{
+		fmt.Sprintf("MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A01|%s-%d|T|2.3", mrn, i),
+		fmt.Sprintf("PID|1||%s^^^SIMULATOR MRN^MRN~%d^^^NHSNBR^NHSNMBR", mrn, i),
+	}, hl7.SegmentTerminatorStr)
+}
+
+// newTestSenders returns a function that creates the given senders in order.
+func newTestSenders(senders ...*testhl7.Sender) func() (hl7.Sender, error) {
+	i := 0
+	return func() (hl7.Sender, error) {
+		s := senders[i]
+		i++
+		return s, nil
+	}
+}
+
+func TestSender_PerPatientOrder(t *testing.T) {
+	connections := []*testhl7.Sender{{}, {}, {}}
+	s, err := NewSender(Config{Connections: len(connections)}, newTestSenders(connections...))
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	mrns := []string{"1111", "2222", "3333", "4444", "5555", "6666"}
+	want := map[string][]string{}
+	for i := 0; i < 20; i++ {
+		for _, mrn := range mrns {
+			msg := testMessage(mrn, i)
+			want[mrn] = append(want[mrn], msg)
+			if err := s.Send([]byte(msg)); err != nil {
+				t.Fatalf("Send(%q) failed with %v", msg, err)
+			}
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+
+	got := map[string][]string{}
+	for i, c := range connections {
+		for _, msg := range c.GetSentMessages() {
+			mrn := message.PatientID(msg)
+			if j, ok := connectionOf(connections, mrn); ok && j != i {
+				t.Errorf("messages of MRN %s sent on connections %d and %d, want one connection", mrn, j, i)
+			}
+			got[mrn] = append(got[mrn], msg)
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("sent messages per MRN got diff (-want +got):\n%s", diff)
+	}
+
+	r := s.Report()
+	if got, want := r.Sent, len(mrns)*20; got != want {
+		t.Errorf("Report().Sent got %d, want %d", got, want)
+	}
+	if got, want := r.Failed, 0; got != want {
+		t.Errorf("Report().Failed got %d, want %d", got, want)
+	}
+	var perConnection []int
+	for _, c := range connections {
+		perConnection = append(perConnection, len(c.GetSentMessages()))
+	}
+	if diff := cmp.Diff(perConnection, r.SentPerConnection); diff != "" {
+		t.Errorf("Report().SentPerConnection got diff (-want +got):\n%s", diff)
+	}
+}
+
+// connectionOf returns the first connection that sent a message for the given MRN.
+func connectionOf(connections []*testhl7.Sender, mrn string) (int, bool) {
+	for i, c := range connections {
+		for _, msg := range c.GetSentMessages() {
+			if message.PatientID(msg) == mrn {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestSender_Errors(t *testing.T) {
+	connections := []*testhl7.Sender{testhl7.SenderWithError(errors.New("cannot send")), testhl7.SenderWithError(errors.New("cannot send"))}
+	reportFile := path.Join(testwrite.TempDir(t), "report.json")
+	s, err := NewSender(Config{Connections: len(connections), ReportFile: reportFile}, newTestSenders(connections...))
+	if err != nil {
+		t.Fatalf("NewSender() failed with %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.Send([]byte(testMessage("1111", i))); err != nil {
+			t.Fatalf("Send() failed with %v, want errors to be counted in the report", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+	if err := s.Send([]byte(testMessage("1111", 5))); err == nil {
+		t.Error("Send() after Close() got nil error, want error")
+	}
+
+	b, err := ioutil.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(%s) failed with %v", reportFile, err)
+	}
+	var got Report
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed with %v", b, err)
+	}
+	want := Report{Connections: 2, Failed: 5, SentPerConnection: []int{0, 0}}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Report{}, "DurationSeconds")); diff != "" {
+		t.Errorf("report got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewSender_Invalid(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    Config
+		newSender func() (hl7.Sender, error)
+	}{{
+		name:      "no connections",
+		config:    Config{Connections: 0},
+		newSender: newTestSenders(&testhl7.Sender{}),
+	}, {
+		name:      "negative rate",
+		config:    Config{Connections: 1, MessagesPerSecond: -1},
+		newSender: newTestSenders(&testhl7.Sender{}),
+	}, {
+		name:      "cannot connect",
+		config:    Config{Connections: 1},
+		newSender: func() (hl7.Sender, error) { return nil, errors.New("cannot connect") },
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewSender(tc.config, tc.newSender); err == nil {
+				t.Errorf("NewSender(%+v) got nil error, want error", tc.config)
+			}
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	l := &limiter{
+		interval: 100 * time.Millisecond,
+		now:      func() time.Time { return now },
+		sleep:    func(d time.Duration) { slept = append(slept, d) },
+	}
+	l.wait()
+	l.wait()
+	l.wait()
+	// Nothing is sent for a while, which is not made up for with a burst of messages.
+	now = now.Add(time.Second)
+	l.wait()
+	l.wait()
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 100 * time.Millisecond}
+	if diff := cmp.Diff(want, slept); diff != "" {
+		t.Errorf("wait() slept got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewLatency(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	want := Latency{Min: 1, Mean: 50.5, P50: 50, P90: 90, P99: 99, Max: 100}
+	if diff := cmp.Diff(want, newLatency(latencies)); diff != "" {
+		t.Errorf("newLatency() got diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(Latency{}, newLatency(nil)); diff != "" {
+		t.Errorf("newLatency(nil) got diff (-want +got):\n%s", diff)
+	}
+}
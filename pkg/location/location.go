@@ -18,6 +18,7 @@ package location
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -61,6 +62,12 @@ type RoomManager struct {
 	isBedOccupied map[string]bool
 }
 
+// Bed is a bed in a room, and whether it is occupied.
+type Bed struct {
+	Name     string
+	Occupied bool
+}
+
 func init() {
 	if err := monitoring.CreateAndRegisterMetricsFromStruct(&counters); err != nil {
 		log.WithError(err).Fatal("Cannot register metrics from the 'location' package")
@@ -135,6 +142,15 @@ func (m *Manager) OccupyAvailableBed(locationName string) (*ir.PatientLocation,
 	}
 }
 
+// IsAAndELocation returns whether the patient location is the ED location.
+func (m *Manager) IsAAndELocation(pl *ir.PatientLocation) bool {
+	if _, ok := m.RoomManagers[aAndEID]; !ok || pl == nil {
+		return false
+	}
+	ed := m.GetAAndELocation()
+	return pl.Poc == ed.Poc && pl.Facility == ed.Facility && pl.Building == ed.Building
+}
+
 // OccupySpecificBed occupies the given bed in the given location.
 // Returns an error if the location doesn't exist, or the bed is already occupied.
 func (m *Manager) OccupySpecificBed(locationName string, bedName string) (*ir.PatientLocation, error) {
@@ -210,6 +226,24 @@ func (r *RoomManager) OccupiedBeds() int {
 	return r.occupiedBeds
 }
 
+// Beds returns the beds in the room that have ever been occupied, sorted by name so that "Bed 2"
+// comes before "Bed 10".
+// Beds are only known to the RoomManager once they are occupied, so the beds that have never been
+// occupied are not returned.
+func (r *RoomManager) Beds() []Bed {
+	beds := make([]Bed, 0, len(r.isBedOccupied))
+	for name, occupied := range r.isBedOccupied {
+		beds = append(beds, Bed{Name: name, Occupied: occupied})
+	}
+	sort.Slice(beds, func(i, j int) bool {
+		if len(beds[i].Name) != len(beds[j].Name) {
+			return len(beds[i].Name) < len(beds[j].Name)
+		}
+		return beds[i].Name < beds[j].Name
+	})
+	return beds
+}
+
 func (r *RoomManager) equalToPatientLocation(pl *ir.PatientLocation) bool {
 	return r.Poc == pl.Poc && r.Facility == pl.Facility &&
 		r.Building == pl.Building && r.Floor == pl.Floor && r.Room == pl.Room
@@ -506,6 +506,77 @@ func TestManagerMatches(t *testing.T) {
 	}
 }
 
+func TestManagerIsAAndELocation(t *testing.T) {
+	ctx := context.Background()
+	locationManager := testlocation.NewLocationManager(ctx, t, aAndEID)
+	cases := []struct {
+		name string
+		pl   *ir.PatientLocation
+		want bool
+	}{
+		{
+			name: "ED location",
+			pl:   locationManager.GetAAndELocation(),
+			want: true,
+		}, {
+			name: "ED bed",
+			pl:   aAndEBed1,
+			want: true,
+		}, {
+			name: "other location",
+			pl: &ir.PatientLocation{
+				Poc:      "Renal",
+				Facility: "Simulated Hospital",
+				Building: "Building-1",
+			},
+			want: false,
+		}, {
+			name: "nil location",
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := locationManager.IsAAndELocation(tc.pl); got != tc.want {
+				t.Errorf("IsAAndELocation(%v)=%t, want %t", tc.pl, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRoomManagerBeds(t *testing.T) {
+	ctx := context.Background()
+	locationManager := testlocation.NewLocationManager(ctx, t, aAndEID)
+	roomManager := locationManager.RoomManagers[aAndEID]
+	if got := roomManager.Beds(); len(got) != 0 {
+		t.Errorf("Beds() before occupying any beds got %v, want no beds", got)
+	}
+
+	for _, bed := range []string{"Bed 10", "Bed 2", "Bed 1"} {
+		if _, err := locationManager.OccupySpecificBed(aAndEID, bed); err != nil {
+			t.Fatalf("OccupySpecificBed(%s, %s) failed with %v", aAndEID, bed, err)
+		}
+	}
+	bed3, err := locationManager.OccupySpecificBed(aAndEID, "Bed 3")
+	if err != nil {
+		t.Fatalf("OccupySpecificBed(%s, %s) failed with %v", aAndEID, "Bed 3", err)
+	}
+	if err := locationManager.FreeBed(bed3); err != nil {
+		t.Fatalf("FreeBed(%v) failed with %v", bed3, err)
+	}
+
+	want := []Bed{
+		{Name: "Bed 1", Occupied: true},
+		{Name: "Bed 2", Occupied: true},
+		{Name: "Bed 3", Occupied: false},
+		{Name: "Bed 10", Occupied: true},
+	}
+	if diff := cmp.Diff(want, roomManager.Beds()); diff != "" {
+		t.Errorf("Beds() got diff (-want, +got):\n%s", diff)
+	}
+}
+
 func TestIsBed(t *testing.T) {
 	cases := []struct {
 		name string
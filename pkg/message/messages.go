@@ -17,6 +17,7 @@ package message
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -80,6 +81,19 @@ type HeaderInfo struct {
 	ReceivingFacility    string
 	// MessageControlID is the MSH -> Message Control ID.
 	MessageControlID string
+	// CharacterSet is the MSH -> Character Set. If empty, DefaultCharacterSet is used.
+	CharacterSet string
+}
+
+// DefaultCharacterSet is the character set of messages whose HeaderInfo doesn't set one.
+const DefaultCharacterSet = "ASCII"
+
+// characterSet returns the character set to set in MSH-18.
+func (h *HeaderInfo) characterSet() string {
+	if h.CharacterSet == "" {
+		return DefaultCharacterSet
+	}
+	return h.CharacterSet
 }
 
 var (
@@ -209,7 +223,12 @@ var (
 
 	// ceTmpl represents the data type CE: Coded Element
 	// http://hl7-definition.caristix.com:9010/HL7%20v2.3.1/segment/PID?version=HL7%20v2.3.1&dataType=CE
-	ceTmpl = "{{escape_HL7 .ID}}^{{escape_HL7 .Text}}^{{.CodingSystem}}^^{{escape_HL7 .AlternateText}}"
+	// CE has a single set of alternate components, so only the first alternate coding, if any, populates the
+	// alternate identifier, text and coding system components. The other alternate codings are not sent in HL7v2.
+	// The AlternateText takes precedence over the text of the alternate coding.
+	ceTmpl = "{{escape_HL7 .ID}}^{{escape_HL7 .Text}}^{{.CodingSystem}}^" +
+		"{{with .AlternateCodings}}{{with index . 0}}{{escape_HL7 .ID}}^{{escape_HL7 (or $.AlternateText .Text)}}^{{.CodingSystem}}{{end}}" +
+		"{{else}}^{{escape_HL7 $.AlternateText}}{{end}}"
 	// ceNoteTmpl is the CE template for notes.
 	// When the OBX.Observation Identifier field is used to send Notes, this is the Document Type; e.g. ECG/Discharge Summary.
 	ceNoteTmpl = "{{.DocumentType}}^{{.DocumentType}}"
@@ -232,7 +251,7 @@ var (
 )
 
 var templates = map[string]*template.Template{
-	MSH: mustParseTemplate(MSH, "MSH|^~\\&|{{.Header.SendingApplication}}|{{.Header.SendingFacility}}|{{.Header.ReceivingApplication}}|{{.Header.ReceivingFacility}}|{{HL7_date .T}}||{{.MsgType.MessageType}}^{{.MsgType.TriggerEvent}}|{{.Header.MessageControlID}}|T|2.3|||AL||44|ASCII"),
+	MSH: mustParseTemplate(MSH, "MSH|^~\\&|{{.Header.SendingApplication}}|{{.Header.SendingFacility}}|{{.Header.ReceivingApplication}}|{{.Header.ReceivingFacility}}|{{HL7_date .T}}||{{.MsgType.MessageType}}^{{.MsgType.TriggerEvent}}|{{.Header.MessageControlID}}|T|2.3|||AL||44|{{.CharacterSet}}"),
 	MSA: mustParseTemplate(MSA, "MSA|AA|{{.OrderMessageControlID}}"),
 	EVN: mustParseTemplates(EVN, map[string]string{
 		doctorTemplate: doctorTmpl,
@@ -631,6 +650,11 @@ func BuildAdmissionADTA01(h *HeaderInfo, p *ir.PatientInfo, eventTime time.Time,
 		}
 		segments = append(segments, al1)
 	}
+	dg1s, err := buildDG1s(p)
+	if err != nil {
+		return nil, err
+	}
+	segments = append(segments, dg1s...)
 
 	return &HL7Message{
 		Type:    msgType,
@@ -772,6 +796,11 @@ func BuildRegistrationADTA04(h *HeaderInfo, p *ir.PatientInfo, eventTime time.Ti
 		}
 		segments = append(segments, al1)
 	}
+	dg1s, err := buildDG1s(p)
+	if err != nil {
+		return nil, err
+	}
+	segments = append(segments, dg1s...)
 
 	return &HL7Message{
 		Type:    msgType,
@@ -830,13 +859,11 @@ func BuildPreAdmitADTA05(h *HeaderInfo, p *ir.PatientInfo, eventTime time.Time,
 		}
 		segments = append(segments, nk1)
 	}
-	for id, d := range p.Diagnoses {
-		dg1, err := BuildDG1(id, d)
-		if err != nil {
-			return nil, errors.Wrap(err, "cannot build DG1 segment")
-		}
-		segments = append(segments, dg1)
+	dg1s, err := buildDG1s(p)
+	if err != nil {
+		return nil, err
 	}
+	segments = append(segments, dg1s...)
 	return &HL7Message{
 		Type:    msgType,
 		Message: strings.Join(segments, SegmentTerminator),
@@ -882,13 +909,11 @@ func BuildUpdatePatientADTA08(h *HeaderInfo, p *ir.PatientInfo, includeFullPV1 b
 		}
 		segments = append(segments, al1)
 	}
-	for id, d := range p.Diagnoses {
-		dg1, err := BuildDG1(id, d)
-		if err != nil {
-			return nil, errors.Wrap(err, "cannot build DG1 segment")
-		}
-		segments = append(segments, dg1)
+	dg1s, err := buildDG1s(p)
+	if err != nil {
+		return nil, err
 	}
+	segments = append(segments, dg1s...)
 	for id, p := range p.Procedures {
 		pr1, err := BuildPR1(id, p)
 		if err != nil {
@@ -1147,13 +1172,11 @@ func BuildUpdatePersonADTA31(h *HeaderInfo, p *ir.PatientInfo, eventTime time.Ti
 		}
 		segments = append(segments, al1)
 	}
-	for id, d := range p.Diagnoses {
-		dg1, err := BuildDG1(id, d)
-		if err != nil {
-			return nil, errors.Wrap(err, "cannot build DG1 segment")
-		}
-		segments = append(segments, dg1)
+	dg1s, err := buildDG1s(p)
+	if err != nil {
+		return nil, err
 	}
+	segments = append(segments, dg1s...)
 	for id, p := range p.Procedures {
 		pr1, err := BuildPR1(id, p)
 		if err != nil {
@@ -1630,13 +1653,48 @@ func BuildMergeADTA40(h *HeaderInfo, p *ir.PatientInfo, eventTime time.Time, msg
 	}, nil
 }
 
+// BuildMessage builds and returns a HL7 message of the given type with the given segments, e.g.,
+// *hl7.PID or *hl7.OBX, after an MSH segment with the same values as the MSH segments of the
+// messages that Simulated Hospital builds. This is useful to build messages that Simulated
+// Hospital doesn't support, e.g., in an EventProcessor. The values of the segments are escaped.
+func BuildMessage(h *HeaderInfo, msgType *Type, msgTime time.Time, segments ...hl7.Segment) (*HL7Message, error) {
+	m, err := hl7.NewBuilder(nil).Build(NewMSH(msgTime, msgType, h), segments...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot build %s^%s message", msgType.MessageType, msgType.TriggerEvent)
+	}
+	return &HL7Message{
+		Type:    msgType,
+		Message: string(m),
+	}, nil
+}
+
+// NewMSH returns an MSH segment with the same values as the one built by BuildMSH, to be used
+// with hl7.Builder.
+func NewMSH(t time.Time, messageType *Type, header *HeaderInfo) *hl7.MSH {
+	return &hl7.MSH{
+		SendingApplication:       &hl7.HD{NamespaceID: hl7.NewIS(hl7.IS(header.SendingApplication))},
+		SendingFacility:          &hl7.HD{NamespaceID: hl7.NewIS(hl7.IS(header.SendingFacility))},
+		ReceivingApplication:     &hl7.HD{NamespaceID: hl7.NewIS(hl7.IS(header.ReceivingApplication))},
+		ReceivingFacility:        &hl7.HD{NamespaceID: hl7.NewIS(hl7.IS(header.ReceivingFacility))},
+		DateTimeOfMessage:        &hl7.TS{Time: t, Precision: hl7.SecondPrecision},
+		MessageType:              &hl7.MSG{MessageCode: hl7.NewID(hl7.ID(messageType.MessageType)), TriggerEvent: hl7.NewID(hl7.ID(messageType.TriggerEvent))},
+		MessageControlID:         hl7.NewST(hl7.ST(header.MessageControlID)),
+		ProcessingID:             &hl7.PT{ProcessingID: hl7.NewID("T")},
+		VersionID:                &hl7.VID{VersionID: hl7.NewID("2.3")},
+		AcceptAcknowledgmentType: hl7.NewID("AL"),
+		CountryCode:              hl7.NewID("44"),
+		CharacterSet:             []hl7.ID{hl7.ID(header.characterSet())},
+	}
+}
+
 // BuildMSH builds and returns a HL7 MSH segment.
 func BuildMSH(t time.Time, messageType *Type, header *HeaderInfo) (string, error) {
 	return executeTemplate(templates[MSH], struct {
-		T       *time.Time
-		MsgType *Type
-		Header  *HeaderInfo
-	}{&t, messageType, header})
+		T            *time.Time
+		MsgType      *Type
+		Header       *HeaderInfo
+		CharacterSet string
+	}{&t, messageType, header, header.characterSet()})
 }
 
 // BuildMSA builds and returns a HL7 MSA segment.
@@ -1769,6 +1827,181 @@ func BuildMRG(mrns []string) (string, error) {
 	}{mrns})
 }
 
+// zSegmentValueEscaper escapes the characters of Z-segment values that would end the field or the
+// segment.
+var zSegmentValueEscaper = strings.NewReplacer("|", `\F\`, "\r", `\X0D\`, "\n", `\.br\`)
+
+// BuildZSegments builds and returns custom Z-segments, sorted by name.
+// fields maps the names of the segments to the values of their fields by field number, as returned
+// by pathway.Parameters.ZSegmentFields. The segments must have been registered with
+// hl7.RegisterSegment, and their required fields must have values.
+// The values are used verbatim, so they can contain components and repetitions, except for field
+// separators and line breaks, which are escaped. The fields without values are left empty.
+func BuildZSegments(fields map[string]map[int]string) ([]string, error) {
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	segments := make([]string, 0, len(names))
+	for _, name := range names {
+		d, ok := hl7.CustomSegment(name)
+		if !ok {
+			return nil, fmt.Errorf("segment %s is not defined", name)
+		}
+		for i, f := range d.Fields {
+			if f.Required && fields[name][i+1] == "" {
+				return nil, fmt.Errorf("field %s-%d (%s) is required", name, i+1, f.Name)
+			}
+		}
+		max := 0
+		for n := range fields[name] {
+			if n > max {
+				max = n
+			}
+		}
+		values := make([]string, max+1)
+		values[0] = name
+		for n, v := range fields[name] {
+			values[n] = zSegmentValueEscaper.Replace(v)
+		}
+		segments = append(segments, strings.Join(values, "|"))
+	}
+	return segments, nil
+}
+
+// ControlID returns the message control ID in MSH-10 of the given message, or an empty string if the
+// message does not start with an MSH segment. The message is split with the delimiters in its MSH
+// segment.
+func ControlID(msg string) string {
+	d, ok := Delimiters(msg)
+	if !ok {
+		return ""
+	}
+	msh := strings.SplitN(msg, SegmentTerminator, 2)[0]
+	fields := strings.Split(msh, string(d.Field))
+	if len(fields) < 10 {
+		return ""
+	}
+	return fields[9]
+}
+
+// PatientID returns the first identifier in PID-3 of the given message, or an empty string if the
+// message does not start with an MSH segment or does not have a PID segment with an identifier.
+// The message is split with the delimiters in its MSH segment.
+func PatientID(msg string) string {
+	d, ok := Delimiters(msg)
+	if !ok {
+		return ""
+	}
+	for _, segment := range strings.Split(msg, SegmentTerminator) {
+		fields := strings.Split(segment, string(d.Field))
+		if fields[0] != PID {
+			continue
+		}
+		if len(fields) < 4 {
+			return ""
+		}
+		id := fields[3]
+		if i := strings.IndexAny(id, string([]byte{d.Component, d.Repetition})); i >= 0 {
+			id = id[:i]
+		}
+		return id
+	}
+	return ""
+}
+
+// Delimiters returns the delimiters in MSH-1 and MSH-2 of the given message, or false if the message
+// does not start with an MSH segment.
+func Delimiters(msg string) (hl7.Delimiters, bool) {
+	if !strings.HasPrefix(msg, MSH) || len(msg) < 8 {
+		return hl7.Delimiters{}, false
+	}
+	return hl7.Delimiters{
+		Field:        msg[3],
+		Component:    msg[4],
+		Repetition:   msg[5],
+		Escape:       msg[6],
+		Subcomponent: msg[7],
+	}, true
+}
+
+// Identifiers are the identifiers in an HL7 message.
+type Identifiers struct {
+	// MessageType is the message type and trigger event in MSH-9, e.g., "ADT^A01".
+	MessageType string `json:"message_type"`
+	// ControlID is the message control ID in MSH-10.
+	ControlID string `json:"control_id"`
+	// MRNs are the identifiers of the patients in the message, from the PID-3 and MRG-1 fields.
+	MRNs []string `json:"mrns,omitempty"`
+	// VisitIDs are the visit numbers in the message, from the PV1-19 and MRG-5 fields.
+	VisitIDs []string `json:"visit_ids,omitempty"`
+}
+
+// ParseIdentifiers parses the given message and returns its identifiers, without duplicates.
+func ParseIdentifiers(msg string) (Identifiers, error) {
+	var ids Identifiers
+	parsed, err := hl7.ParseMessageWithOptions([]byte(msg), hl7.NewParseMessageOptions())
+	if err != nil {
+		return ids, errors.Wrap(err, "cannot parse the message")
+	}
+	if msh, err := parsed.MSH(); err == nil && msh != nil {
+		ids.ControlID = msh.MessageControlID.String()
+		if msh.MessageType != nil {
+			ids.MessageType = fmt.Sprintf("%s^%s", msh.MessageType.MessageCode.String(), msh.MessageType.TriggerEvent.String())
+		}
+	}
+	// Segments that fail to parse are returned anyway, so the errors are ignored.
+	pids, _ := parsed.AllPID()
+	for _, pid := range pids {
+		ids.MRNs = appendIDs(ids.MRNs, pid.PatientIdentifierList...)
+	}
+	mrgs, _ := parsed.AllMRG()
+	for _, mrg := range mrgs {
+		ids.MRNs = appendIDs(ids.MRNs, mrg.PriorPatientIdentifierList...)
+		if mrg.PriorVisitNumber != nil {
+			ids.VisitIDs = appendIDs(ids.VisitIDs, *mrg.PriorVisitNumber)
+		}
+	}
+	pv1s, _ := parsed.AllPV1()
+	for _, pv1 := range pv1s {
+		if pv1.VisitNumber != nil {
+			ids.VisitIDs = appendIDs(ids.VisitIDs, *pv1.VisitNumber)
+		}
+	}
+	return ids, nil
+}
+
+// HasMRN returns whether any of the given MRNs is in the message.
+func (ids Identifiers) HasMRN(mrns ...string) bool {
+	return containsAny(ids.MRNs, mrns)
+}
+
+// HasVisitID returns whether any of the given visit IDs is in the message.
+func (ids Identifiers) HasVisitID(visitIDs ...string) bool {
+	return containsAny(ids.VisitIDs, visitIDs)
+}
+
+func appendIDs(ids []string, cxs ...hl7.CX) []string {
+	for _, cx := range cxs {
+		if id := cx.IDNumber.String(); id != "" && !containsAny(ids, []string{id}) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func containsAny(values []string, vs []string) bool {
+	for _, value := range values {
+		for _, v := range vs {
+			if value == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // BuildDG1 builds and returns a HL7 DG1 segment.
 func BuildDG1(id int, diagnose *ir.DiagnosisOrProcedure) (string, error) {
 	return executeTemplate(templates[DG1], struct {
@@ -1777,6 +2010,32 @@ func BuildDG1(id int, diagnose *ir.DiagnosisOrProcedure) (string, error) {
 	}{DiagnosisOrProcedure: diagnose, ID: id})
 }
 
+// buildDG1s builds the DG1 segments for the diagnoses of the given patient, followed by the active
+// problems in their problem list. The problems are dated at their onset, and have their diagnosis type.
+func buildDG1s(p *ir.PatientInfo) ([]string, error) {
+	var segments []string
+	for id, d := range p.Diagnoses {
+		dg1, err := BuildDG1(id, d)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build DG1 segment")
+		}
+		segments = append(segments, dg1)
+	}
+	id := len(p.Diagnoses)
+	for _, pr := range p.Problems {
+		if !pr.IsActive() {
+			continue
+		}
+		dg1, err := BuildDG1(id, &ir.DiagnosisOrProcedure{Description: pr.Description, Type: pr.DiagnosisType, DateTime: pr.Onset})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build DG1 segment for problem")
+		}
+		segments = append(segments, dg1)
+		id++
+	}
+	return segments, nil
+}
+
 // BuildPR1 builds and returns a HL7 PR1 segment.
 func BuildPR1(id int, procedure *ir.DiagnosisOrProcedure) (string, error) {
 	return executeTemplate(templates[PR1], struct {
@@ -16,6 +16,7 @@ package message
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -116,6 +117,45 @@ func TestBuildMSH(t *testing.T) {
 	}
 }
 
+func TestBuildMSH_CharacterSet(t *testing.T) {
+	now := time.Date(2018, 1, 26, 15, 24, 21, 0, time.UTC)
+	header := testHeader()
+	header.CharacterSet = "UNICODE UTF-8"
+	mt := &Type{"ORU", "R01"}
+
+	want := "MSH|^~\\&|CERNER|RAL1|STREAMS|RAL|20180126152421||ORU^R01|1|T|2.3|||AL||44|UNICODE UTF-8"
+	got, err := BuildMSH(now, mt, header)
+	if err != nil {
+		t.Fatalf("BuildMSH(%v, %v, %v) failed with %v", now, mt, header, err)
+	}
+	if got != want {
+		t.Errorf("BuildMSH(%v, %v, %v)=%v, want %v", now, mt, header, got, want)
+	}
+	if got, want := NewMSH(now, mt, header).CharacterSet, []hl7.ID{"UNICODE UTF-8"}; !cmp.Equal(got, want) {
+		t.Errorf("NewMSH(%v, %v, %v).CharacterSet=%v, want %v", now, mt, header, got, want)
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	now := time.Date(2018, 1, 26, 15, 24, 21, 0, time.UTC)
+	header := testHeader()
+	mt := &Type{"ZZZ", "Z01"}
+	nte := &hl7.NTE{SetIDNTE: &hl7.SI{Value: 1, Valid: true}, Comment: []hl7.FT{"Value with ^ and &\nin two lines"}}
+
+	msh, err := BuildMSH(now, mt, header)
+	if err != nil {
+		t.Fatalf("BuildMSH(%v, %v, %v) failed with %v", now, mt, header, err)
+	}
+	want := msh + SegmentTerminator + `NTE|1||Value with \S\ and \T\\.br\in two lines`
+	got, err := BuildMessage(header, mt, now, nte)
+	if err != nil {
+		t.Fatalf("BuildMessage(%v, %v, %v, %v) failed with %v", header, mt, now, nte, err)
+	}
+	if diff := cmp.Diff(&HL7Message{Type: mt, Message: want}, got); diff != "" {
+		t.Errorf("BuildMessage(%v, %v, %v, %v) got diff (-want +got):\n%s", header, mt, now, nte, diff)
+	}
+}
+
 func TestBuildMSA(t *testing.T) {
 	want := "MSA|AA|1"
 	got, err := BuildMSA("1")
@@ -362,6 +402,26 @@ func TestBuildOBX(t *testing.T) {
 			return o
 		},
 		want: "OBX|1|NM|Urea \\T\\ Electrolytes^Creatinine \\T\\ Glucose^& not escaped^^Some text with \\T\\||700|UML|39.00 - 308.00|HIGH|||F|||||",
+	}, {
+		name: "TestName with alternate codings",
+		setup: func() *ir.Order {
+			o := testOrderWithResult(now)
+			o.Results[0].TestName.AlternateCodings = []ir.Coding{
+				{ID: "2160-0", Text: "Creatinine [Mass/volume] in Serum or Plasma", CodingSystem: "LN"},
+				{ID: "113075003", CodingSystem: "SCT"},
+			}
+			return o
+		},
+		want: "OBX|1|NM|lpdc-2011^Creatinine^WinPath^2160-0^Creatinine [Mass/volume] in Serum or Plasma^LN||700|UML|39.00 - 308.00|HIGH|||F|||||",
+	}, {
+		name: "Alternate text takes precedence over the text of the alternate coding",
+		setup: func() *ir.Order {
+			o := testOrderWithResult(now)
+			o.Results[0].TestName.AlternateText = "Creat & more"
+			o.Results[0].TestName.AlternateCodings = []ir.Coding{{ID: "2160-0", Text: "Creatinine", CodingSystem: "LN"}}
+			return o
+		},
+		want: "OBX|1|NM|lpdc-2011^Creatinine^WinPath^2160-0^Creat \\T\\ more^LN||700|UML|39.00 - 308.00|HIGH|||F|||||",
 	}, {
 		name: "Replace New Line",
 		setup: func() *ir.Order {
@@ -550,6 +610,180 @@ func TestBuildPV2(t *testing.T) {
 	}
 }
 
+func TestBuildZSegments(t *testing.T) {
+	for _, d := range []*hl7.SegmentDefinition{
+		{Name: "ZVI", Fields: []hl7.FieldDefinition{{Name: "VIP Indicator", DataType: "ST"}}},
+		{Name: "ZPI", Fields: []hl7.FieldDefinition{
+			{Name: "Set ID", DataType: "SI", Required: true},
+			{Name: "Comment", DataType: "ST"},
+			{Name: "Preferred Names", DataType: "XPN", Repeated: true},
+		}},
+	} {
+		if err := hl7.RegisterSegment(d); err != nil {
+			t.Fatalf("hl7.RegisterSegment(%+v) failed with %v", d, err)
+		}
+		defer hl7.UnregisterSegment(d.Name)
+	}
+
+	cases := []struct {
+		name    string
+		fields  map[string]map[int]string
+		want    []string
+		wantErr bool
+	}{{
+		name: "segments",
+		fields: map[string]map[int]string{
+			"ZVI": {1: "Y"},
+			"ZPI": {1: "1", 3: "Smith^John~Smith^Johnny"},
+		},
+		want: []string{"ZPI|1||Smith^John~Smith^Johnny", "ZVI|Y"},
+	}, {
+		name:   "field separators and line breaks",
+		fields: map[string]map[int]string{"ZPI": {1: "1", 2: "a|b\rc\nd"}},
+		want:   []string{`ZPI|1|a\F\b\X0D\c\.br\d`},
+	}, {
+		name:    "missing required field",
+		fields:  map[string]map[int]string{"ZPI": {2: "comment"}},
+		wantErr: true,
+	}, {
+		name:    "unknown segment",
+		fields:  map[string]map[int]string{"ZXX": {1: "1"}},
+		wantErr: true,
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := BuildZSegments(tc.fields)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("BuildZSegments(%v) got err %v, want err? %t", tc.fields, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("BuildZSegments(%v) got diff (-want +got):\n%s", tc.fields, diff)
+			}
+		})
+	}
+}
+
+func TestControlID(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  string
+		want string
+	}{{
+		name: "message",
+		msg:  strings.Join([]string{"MSH|^~\\&|CERNER|RAL1|STREAMS|RAL|20180126152421||ADT^A01|123|T|2.3", "PID|1"}, SegmentTerminator),
+		want: "123",
+	}, {
+		name: "custom delimiters",
+		msg:  strings.Join([]string{"MSH#^~\\&#CERNER#RAL1#STREAMS#RAL#20180126152421##ADT^A01#1|2#T#2.3", "PID#1"}, SegmentTerminator),
+		want: "1|2",
+	}, {
+		name: "no control ID",
+		msg:  "MSH|^~\\&|CERNER|RAL1|STREAMS|RAL|20180126152421||ADT^A01",
+		want: "",
+	}, {
+		name: "no MSH",
+		msg:  "PID|1|2|3|4|5|6|7|8|9|10",
+		want: "",
+	}, {
+		name: "empty",
+		msg:  "",
+		want: "",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ControlID(tc.msg); got != tc.want {
+				t.Errorf("ControlID(%q) got %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPatientID(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  string
+		want string
+	}{{
+		name: "message",
+		msg:  strings.Join([]string{"MSH|^~\\&|CERNER|RAL1|STREAMS|RAL|20180126152421||ADT^A01|123|T|2.3", "PID|1||1234^^^SIMULATOR MRN^MRN~5678^^^NHSNBR^NHSNMBR"}, SegmentTerminator),
+		want: "1234",
+	}, {
+		name: "no components",
+		msg:  strings.Join([]string{"MSH|^~\\&|CERNER", "PID|1||1234"}, SegmentTerminator),
+		want: "1234",
+	}, {
+		name: "no patient identifier",
+		msg:  strings.Join([]string{"MSH|^~\\&|CERNER", "PID|1"}, SegmentTerminator),
+		want: "",
+	}, {
+		name: "custom delimiters",
+		msg:  strings.Join([]string{"MSH#*@!%#CERNER", "PID#1##1234*5|6@5678"}, SegmentTerminator),
+		want: "1234",
+	}, {
+		name: "no PID",
+		msg:  strings.Join([]string{"MSH|^~\\&|CERNER", "EVN|A01"}, SegmentTerminator),
+		want: "",
+	}, {
+		name: "no MSH",
+		msg:  "PID|1||1234",
+		want: "",
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := PatientID(tc.msg); got != tc.want {
+				t.Errorf("PatientID(%q) got %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseIdentifiers(t *testing.T) {
+	cases := []struct {
+		name string
+		msg  string
+		want Identifiers
+	}{{
+		name: "admission",
+		msg: strings.Join([]string{
+			"MSH|^~\\&|CERNER|RAL1|STREAMS|RAL|20180126152421||ADT^A01|123|T|2.3",
+			"PID|1||1234^^^SIMULATOR MRN^MRN~5678^^^NHSNBR^NHSNMBR",
+			"PV1|1|I" + strings.Repeat("|", 17) + "visit1",
+		}, SegmentTerminator),
+		want: Identifiers{MessageType: "ADT^A01", ControlID: "123", MRNs: []string{"1234", "5678"}, VisitIDs: []string{"visit1"}},
+	}, {
+		name: "merge",
+		msg: strings.Join([]string{
+			"MSH|^~\\&|CERNER|RAL1|STREAMS|RAL|20180126152421||ADT^A34|123|T|2.3",
+			"PID|1||1234^^^SIMULATOR MRN^MRN",
+			"MRG|5678^^^SIMULATOR MRN^MRN~1234^^^SIMULATOR MRN^MRN||||visit2",
+		}, SegmentTerminator),
+		want: Identifiers{MessageType: "ADT^A34", ControlID: "123", MRNs: []string{"1234", "5678"}, VisitIDs: []string{"visit2"}},
+	}, {
+		name: "no identifiers",
+		msg:  strings.Join([]string{"MSH|^~\\&|CERNER", "EVN|A01"}, SegmentTerminator),
+		want: Identifiers{},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseIdentifiers(tc.msg)
+			if err != nil {
+				t.Fatalf("ParseIdentifiers(%q) failed with %v", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ParseIdentifiers(%q) got diff (-want +got):\n%s", tc.msg, diff)
+			}
+			for _, mrn := range tc.want.MRNs {
+				if !got.HasMRN("other", mrn) {
+					t.Errorf("ParseIdentifiers(%q).HasMRN(%q, %q) got false, want true", tc.msg, "other", mrn)
+				}
+			}
+			if got.HasMRN("other") {
+				t.Errorf("ParseIdentifiers(%q).HasMRN(%q) got true, want false", tc.msg, "other")
+			}
+		})
+	}
+}
+
 func TestBuildNK1(t *testing.T) {
 	p := &ir.AssociatedParty{
 		Person: &ir.Person{
@@ -707,6 +941,36 @@ func TestBuildDG1(t *testing.T) {
 	}
 }
 
+func TestBuildDG1sWithProblems(t *testing.T) {
+	onset := time.Date(2015, 3, 4, 0, 0, 0, 0, time.UTC)
+	p := &ir.PatientInfo{
+		Diagnoses: []*ir.DiagnosisOrProcedure{testDiagnosis()},
+		Problems: []*ir.Problem{{
+			Description:    &ir.CodedElement{ID: "38341003", Text: "Hypertension", CodingSystem: "SNM3"},
+			ClinicalStatus: ir.ProblemActive,
+			Onset:          ir.NewValidTime(onset),
+			DiagnosisType:  "F",
+		}, {
+			Description:    &ir.CodedElement{ID: "195967001", Text: "Asthma", CodingSystem: "SNM3"},
+			ClinicalStatus: ir.ProblemResolved,
+			Onset:          ir.NewValidTime(onset),
+			Abatement:      ir.NewValidTime(onset.AddDate(1, 0, 0)),
+		}},
+	}
+	want := []string{
+		"DG1|0|SNMCT|A01.0^Typhoid fever^^^|Typhoid fever|20170128152424|Admitting|||||||||0|216865551019^Osman^Arthur^^^Dr^^^DRNBR^PRSNL^^^ORGDR",
+		// Only active problems are included.
+		"DG1|1|SNMCT|38341003^Hypertension^SNM3^^|Hypertension|20150304000000|F|||||||||0|",
+	}
+	got, err := buildDG1s(p)
+	if err != nil {
+		t.Fatalf("buildDG1s(%+v) failed with %v", p, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("buildDG1s(%+v) got diff (-want +got):\n%s", p, diff)
+	}
+}
+
 func TestBuildPR1(t *testing.T) {
 	procedure := testProcedure()
 	want := "PR1|2|SNMCT|A01.1^Hemispherectomy^^^|Hemispherectomy|20170129152424|A||||||216865551019^Osman^Arthur^^^Dr^^^DRNBR^PRSNL^^^ORGDR||0||"
@@ -0,0 +1,285 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package messagelog keeps the most recent HL7 messages sent by Simulated Hospital in memory, and
+// indexes them so that they can be searched.
+package messagelog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/state"
+)
+
+// Entry is a message in the log.
+type Entry struct {
+	// ID identifies the entry in the log. IDs increase in the order in which messages are sent,
+	// starting at 1.
+	ID          int       `json:"id"`
+	SentTime    time.Time `json:"sent_time"`
+	MessageTime time.Time `json:"message_time"`
+	Name        string    `json:"name,omitempty"`
+	PathwayName string    `json:"pathway_name,omitempty"`
+	// Identifiers are read from the message.
+	message.Identifiers
+	Message string `json:"message"`
+}
+
+// Raw returns the message with each segment in a separate line.
+func (e Entry) Raw() string {
+	return strings.TrimSpace(strings.ReplaceAll(e.Message, hl7.SegmentTerminatorStr, "\n")) + "\n"
+}
+
+// Pretty returns the message in YAML, with the fields keyed by their names in the HL7 schema.
+func (e Entry) Pretty() (string, error) {
+	m, err := hl7.ParseMessageWithOptions([]byte(e.Message), hl7.NewParseMessageOptions())
+	if err != nil {
+		return "", errors.Wrap(err, "cannot parse the message")
+	}
+	b, err := hl7.ToYAML(m)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot convert the message to YAML")
+	}
+	return string(b), nil
+}
+
+// Query contains the criteria to search the log with. Empty criteria match all messages.
+type Query struct {
+	MRN     string
+	VisitID string
+	// MessageType matches the message type, the trigger event, or both, e.g., "ADT", "A01" or
+	// "ADT^A01". It is not case sensitive.
+	MessageType string
+	ControlID   string
+	// Limit is the maximum number of messages to return. If there are more matching messages, the
+	// most recent ones are returned. Zero means that there is no limit.
+	Limit int
+}
+
+// Log is a bounded log of sent messages. When the log is full, the oldest messages are removed to
+// make room for new ones.
+// Log is safe for concurrent use.
+type Log struct {
+	mu sync.RWMutex
+	// entries is a ring buffer with the entries in the log. The entry with ID n is in the position
+	// (n-1) % len(entries).
+	entries []Entry
+	// lastID is the ID of the most recent entry, or zero if no messages have been logged.
+	lastID int
+	// The indexes contain the IDs of the entries in the log for each key, in increasing order.
+	byMRN       map[string][]int
+	byVisitID   map[string][]int
+	byType      map[string][]int
+	byControlID map[string][]int
+}
+
+// New returns a log that keeps the most recent size messages.
+func New(size int) (*Log, error) {
+	if size <= 0 {
+		return nil, errors.Errorf("invalid message log size %d: must be positive", size)
+	}
+	return &Log{
+		entries:     make([]Entry, size),
+		byMRN:       map[string][]int{},
+		byVisitID:   map[string][]int{},
+		byType:      map[string][]int{},
+		byControlID: map[string][]int{},
+	}, nil
+}
+
+// Add adds a message sent at the given time to the log.
+// The identifiers of the message are read from the message itself. If the message cannot be parsed,
+// the message type comes from m.Message.Type and the MRN from the event that created the message.
+func (l *Log) Add(sent time.Time, m state.HL7Message) Entry {
+	e := newEntry(sent, m)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	e.ID = l.lastID
+	i := l.index(e.ID)
+	if old := l.entries[i]; old.ID != 0 {
+		l.unindex(old)
+	}
+	l.entries[i] = e
+	for _, k := range e.MRNs {
+		l.byMRN[k] = append(l.byMRN[k], e.ID)
+	}
+	for _, k := range e.VisitIDs {
+		l.byVisitID[k] = append(l.byVisitID[k], e.ID)
+	}
+	l.byType[e.MessageType] = append(l.byType[e.MessageType], e.ID)
+	l.byControlID[e.ControlID] = append(l.byControlID[e.ControlID], e.ID)
+	return e
+}
+
+// Get returns the entry with the given ID, and whether it is in the log.
+func (l *Log) Get(id int) (Entry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if !l.contains(id) {
+		return Entry{}, false
+	}
+	return l.entries[l.index(id)], true
+}
+
+// Search returns the messages in the log that match the query, in the order in which they were
+// sent.
+func (l *Log) Search(q Query) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// Start with the IDs in the smallest index that applies to the query, if any.
+	var candidates []int
+	all := true
+	narrow := func(index map[string][]int, key string) {
+		if key == "" {
+			return
+		}
+		if ids := index[key]; all || len(ids) < len(candidates) {
+			candidates = ids
+			all = false
+		}
+	}
+	narrow(l.byMRN, q.MRN)
+	narrow(l.byVisitID, q.VisitID)
+	narrow(l.byControlID, q.ControlID)
+	if strings.Contains(q.MessageType, "^") {
+		narrow(l.byType, strings.ToUpper(q.MessageType))
+	}
+	if all {
+		for id := l.oldestID(); id <= l.lastID; id++ {
+			candidates = append(candidates, id)
+		}
+	}
+
+	var matches []Entry
+	// Go through the candidates from the most recent, so that the search can stop at the limit.
+	for i := len(candidates) - 1; i >= 0; i-- {
+		e := l.entries[l.index(candidates[i])]
+		if !q.matches(e) {
+			continue
+		}
+		matches = append(matches, e)
+		if q.Limit > 0 && len(matches) == q.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// Len returns the number of messages in the log.
+func (l *Log) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastID - l.oldestID() + 1
+}
+
+func (l *Log) index(id int) int {
+	return (id - 1) % len(l.entries)
+}
+
+func (l *Log) oldestID() int {
+	if l.lastID < len(l.entries) {
+		return 1
+	}
+	return l.lastID - len(l.entries) + 1
+}
+
+func (l *Log) contains(id int) bool {
+	return id >= l.oldestID() && id <= l.lastID && id > 0
+}
+
+// unindex removes the entry from the indexes. The entry must be the oldest one in the log, so it
+// is the first ID for each of its keys.
+func (l *Log) unindex(e Entry) {
+	removeFirst := func(index map[string][]int, key string) {
+		ids := index[key]
+		if len(ids) == 0 || ids[0] != e.ID {
+			return
+		}
+		if len(ids) == 1 {
+			delete(index, key)
+			return
+		}
+		index[key] = ids[1:]
+	}
+	for _, k := range e.MRNs {
+		removeFirst(l.byMRN, k)
+	}
+	for _, k := range e.VisitIDs {
+		removeFirst(l.byVisitID, k)
+	}
+	removeFirst(l.byType, e.MessageType)
+	removeFirst(l.byControlID, e.ControlID)
+}
+
+func (q Query) matches(e Entry) bool {
+	if q.MRN != "" && !e.HasMRN(q.MRN) {
+		return false
+	}
+	if q.VisitID != "" && !e.HasVisitID(q.VisitID) {
+		return false
+	}
+	if q.ControlID != "" && e.ControlID != q.ControlID {
+		return false
+	}
+	if q.MessageType != "" {
+		t := strings.ToUpper(q.MessageType)
+		parts := strings.SplitN(e.MessageType, "^", 2)
+		if t != e.MessageType && t != parts[0] && (len(parts) < 2 || t != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// newEntry returns the entry for a message, without an ID.
+func newEntry(sent time.Time, m state.HL7Message) Entry {
+	e := Entry{
+		SentTime:    sent,
+		MessageTime: m.MessageTime,
+		Name:        m.Name,
+		PathwayName: m.PathwayName,
+	}
+	if m.Message == nil {
+		return e
+	}
+	e.Message = m.Message.Message
+	if m.Message.Type != nil {
+		e.MessageType = fmt.Sprintf("%s^%s", m.Message.Type.MessageType, m.Message.Type.TriggerEvent)
+	}
+
+	ids, err := message.ParseIdentifiers(m.Message.Message)
+	if err != nil {
+		if m.Event != nil && m.Event.PatientMRN != "" {
+			e.MRNs = []string{m.Event.PatientMRN}
+		}
+		return e
+	}
+	if ids.MessageType == "" {
+		ids.MessageType = e.MessageType
+	}
+	e.Identifiers = ids
+	return e
+}
@@ -0,0 +1,211 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messagelog
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/state"
+)
+
+var sentTime = time.Date(2020, 2, 12, 0, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	hl7.TimezoneAndLocation("Europe/London")
+	os.Exit(m.Run())
+}
+
+// testMessage returns a message with the given type, control ID, MRN and visit ID.
+func testMessage(triggerEvent, controlID, mrn, visitID string) state.HL7Message {
+	segments := []string{
+		fmt.Sprintf("MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200212000000||ADT^%s|%s|T|2.3", triggerEvent, controlID),
+		fmt.Sprintf("PID|1||%s^^^SIMULATOR MRN^MRN||Smith^John", mrn),
+		fmt.Sprintf("PV1|1|I%s%s", strings.Repeat("|", 17), visitID),
+	}
+	return state.HL7Message{
+		Name:        triggerEvent,
+		PathwayName: "pathway",
+		MessageTime: sentTime,
+		Message: &message.HL7Message{
+			Type:    &message.Type{MessageType: "ADT", TriggerEvent: triggerEvent},
+			Message: strings.Join(segments, "\r"),
+		},
+	}
+}
+
+func ids(entries []Entry) []int {
+	var got []int
+	for _, e := range entries {
+		got = append(got, e.ID)
+	}
+	return got
+}
+
+func TestNew_InvalidSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		if _, err := New(size); err == nil {
+			t.Errorf("New(%d) got nil error, want error", size)
+		}
+	}
+}
+
+func TestLogAdd(t *testing.T) {
+	l, err := New(10)
+	if err != nil {
+		t.Fatalf("New(10) failed with %v", err)
+	}
+	got := l.Add(sentTime, testMessage("A01", "1", "mrn1", "visit1"))
+	want := Entry{
+		ID:          1,
+		SentTime:    sentTime,
+		MessageTime: sentTime,
+		Name:        "A01",
+		PathwayName: "pathway",
+		Identifiers: message.Identifiers{
+			MessageType: "ADT^A01",
+			ControlID:   "1",
+			MRNs:        []string{"mrn1"},
+			VisitIDs:    []string{"visit1"},
+		},
+		Message: testMessage("A01", "1", "mrn1", "visit1").Message.Message,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Add() got diff (-want +got):\n%s", diff)
+	}
+	if e, ok := l.Get(1); !ok || e.ControlID != "1" {
+		t.Errorf("Get(1) got (%+v, %t), want the added entry", e, ok)
+	}
+}
+
+func TestLogAdd_Merge(t *testing.T) {
+	l, err := New(10)
+	if err != nil {
+		t.Fatalf("New(10) failed with %v", err)
+	}
+	m := testMessage("A34", "1", "mrn1", "visit1")
+	m.Message.Message += "\rMRG|mrn2^^^SIMULATOR MRN^MRN||||visit2"
+	e := l.Add(sentTime, m)
+	if diff := cmp.Diff([]string{"mrn1", "mrn2"}, e.MRNs); diff != "" {
+		t.Errorf("Add() MRNs got diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"visit2", "visit1"}, e.VisitIDs); diff != "" {
+		t.Errorf("Add() visit IDs got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogAdd_UnparsableMessage(t *testing.T) {
+	l, err := New(10)
+	if err != nil {
+		t.Fatalf("New(10) failed with %v", err)
+	}
+	m := state.HL7Message{
+		Message: &message.HL7Message{Type: &message.Type{MessageType: "ORU", TriggerEvent: "R01"}, Message: "not a message"},
+		Event:   &state.Event{PatientMRN: "mrn1"},
+	}
+	e := l.Add(sentTime, m)
+	if got, want := e.MessageType, "ORU^R01"; got != want {
+		t.Errorf("Add() message type got %q, want %q", got, want)
+	}
+	if diff := cmp.Diff([]string{"mrn1"}, e.MRNs); diff != "" {
+		t.Errorf("Add() MRNs got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogSearch(t *testing.T) {
+	l, err := New(10)
+	if err != nil {
+		t.Fatalf("New(10) failed with %v", err)
+	}
+	l.Add(sentTime, testMessage("A01", "1", "mrn1", "visit1"))
+	l.Add(sentTime, testMessage("A02", "2", "mrn1", "visit1"))
+	l.Add(sentTime, testMessage("A01", "3", "mrn2", "visit2"))
+	l.Add(sentTime, testMessage("A03", "4", "mrn1", "visit3"))
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int
+	}{
+		{name: "empty", query: Query{}, want: []int{1, 2, 3, 4}},
+		{name: "MRN", query: Query{MRN: "mrn1"}, want: []int{1, 2, 4}},
+		{name: "visit ID", query: Query{VisitID: "visit1"}, want: []int{1, 2}},
+		{name: "control ID", query: Query{ControlID: "3"}, want: []int{3}},
+		{name: "message type and trigger event", query: Query{MessageType: "adt^a01"}, want: []int{1, 3}},
+		{name: "trigger event", query: Query{MessageType: "A02"}, want: []int{2}},
+		{name: "message type", query: Query{MessageType: "ADT"}, want: []int{1, 2, 3, 4}},
+		{name: "MRN and message type", query: Query{MRN: "mrn1", MessageType: "A01"}, want: []int{1}},
+		{name: "limit returns the most recent", query: Query{MRN: "mrn1", Limit: 2}, want: []int{2, 4}},
+		{name: "unknown MRN", query: Query{MRN: "unknown"}},
+		{name: "unknown message type", query: Query{MessageType: "ORU^R01"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, ids(l.Search(tc.query))); diff != "" {
+				t.Errorf("Search(%+v) got diff (-want +got):\n%s", tc.query, diff)
+			}
+		})
+	}
+}
+
+func TestLog_RemovesOldestMessages(t *testing.T) {
+	l, err := New(2)
+	if err != nil {
+		t.Fatalf("New(2) failed with %v", err)
+	}
+	l.Add(sentTime, testMessage("A01", "1", "mrn1", "visit1"))
+	l.Add(sentTime, testMessage("A02", "2", "mrn1", "visit1"))
+	l.Add(sentTime, testMessage("A03", "3", "mrn1", "visit1"))
+
+	if got, want := l.Len(), 2; got != want {
+		t.Errorf("Len() got %d, want %d", got, want)
+	}
+	if _, ok := l.Get(1); ok {
+		t.Error("Get(1) got ok=true for a removed message, want false")
+	}
+	if diff := cmp.Diff([]int{2, 3}, ids(l.Search(Query{MRN: "mrn1"}))); diff != "" {
+		t.Errorf("Search() got diff (-want +got):\n%s", diff)
+	}
+	if got := l.Search(Query{ControlID: "1"}); len(got) != 0 {
+		t.Errorf("Search() by the control ID of a removed message got %v, want no messages", got)
+	}
+}
+
+func TestEntryRawAndPretty(t *testing.T) {
+	l, err := New(1)
+	if err != nil {
+		t.Fatalf("New(1) failed with %v", err)
+	}
+	e := l.Add(sentTime, testMessage("A01", "1", "mrn1", "visit1"))
+
+	if got, want := strings.Count(e.Raw(), "\n"), 3; got != want {
+		t.Errorf("Raw() got %d lines, want %d:\n%s", got, want, e.Raw())
+	}
+	pretty, err := e.Pretty()
+	if err != nil {
+		t.Fatalf("Pretty() failed with %v", err)
+	}
+	for _, want := range []string{"Message Control ID", "mrn1", "visit1"} {
+		if !strings.Contains(pretty, want) {
+			t.Errorf("Pretty() got %q, want it to contain %q", pretty, want)
+		}
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -64,6 +66,9 @@ type TestType struct {
 	valuePrefix    string
 	RefRange       string
 	ValueGenerator *ValueGenerator
+	// refRanges are the reference ranges that apply to people of a specific sex or age band
+	// instead of RefRange. See ForPerson.
+	refRanges []*referenceRange
 }
 
 type validString struct {
@@ -98,6 +103,38 @@ func (op *OrderProfiles) Get(name string) (*OrderProfile, bool) {
 	return v, ok
 }
 
+// ValidateAbnormalResults returns an error if the abnormal results of any of the given comorbidities
+// refer to a test type that is not defined in any Order Profile. Such results would never be
+// affected by the comorbidity, so they are most likely a typo in the comorbidities file.
+func (op *OrderProfiles) ValidateAbnormalResults(comorbidities []config.Comorbidity) error {
+	var errs []string
+	for _, c := range comorbidities {
+		var unknown []string
+		for name := range c.AbnormalResults {
+			if !op.hasTestType(name) {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			errs = append(errs, fmt.Sprintf("comorbidity %q refers to unknown test types %q", c.Description.Text, unknown))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (op *OrderProfiles) hasTestType(name string) bool {
+	for _, p := range op.op {
+		if _, ok := p.TestTypes[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Generate returns a CodedElement for the given name.
 // If the name is constants.RandomString, it returns a CodedElement for a random Order Profile.
 // If the name is a name of any existing Order Profile, the CodedElement for that Order Profile
@@ -135,6 +172,24 @@ func (tt *TestType) RandomisedValueWithFlag(randomType string) (string, constant
 	return fmt.Sprintf("%s%s", tt.valuePrefix, v), abnormalFlag, nil
 }
 
+// coding is a code in a coding system other than the main one of the order profile or test type.
+type coding struct {
+	ID           string
+	Text         string
+	CodingSystem string `yaml:"coding_system"`
+}
+
+func alternateCodings(codings []coding) []ir.Coding {
+	if len(codings) == 0 {
+		return nil
+	}
+	alternates := make([]ir.Coding, len(codings))
+	for i, c := range codings {
+		alternates[i] = ir.Coding{ID: c.ID, Text: c.Text, CodingSystem: c.CodingSystem}
+	}
+	return alternates
+}
+
 type tt struct {
 	ID           string
 	CodingSystem string `yaml:"coding_system"`
@@ -142,12 +197,19 @@ type tt struct {
 	Value        string
 	Unit         string
 	RefRange     string `yaml:"ref_range"`
+	// RefRanges are the reference ranges specific to sex or age bands. RefRange is used for
+	// people who don't match any of them.
+	RefRanges []refRange `yaml:"ref_ranges"`
+	// AlternateCodings are the codes of the test type in other coding systems, e.g., LOINC.
+	AlternateCodings []coding `yaml:"alternate_codings"`
 }
 
 type op struct {
 	UniversalServiceID string        `yaml:"universal_service_id"`
 	CodingSystem       string        `yaml:"coding_system"`
 	TestTypes          map[string]tt `yaml:"test_types"`
+	// AlternateCodings are the codes of the universal service in other coding systems, e.g., LOINC.
+	AlternateCodings []coding `yaml:"alternate_codings"`
 }
 
 func testType(ttName string, ttValue tt, codingSystem string) *TestType {
@@ -155,7 +217,7 @@ func testType(ttName string, ttValue tt, codingSystem string) *TestType {
 		codingSystem = ttValue.CodingSystem
 	}
 	testType := &TestType{
-		Name:      ir.CodedElement{ID: ttValue.ID, Text: ttName, CodingSystem: codingSystem},
+		Name:      ir.CodedElement{ID: ttValue.ID, Text: ttName, CodingSystem: codingSystem, AlternateCodings: alternateCodings(ttValue.AlternateCodings)},
 		Unit:      ttValue.Unit,
 		ValueType: ttValue.ValueType,
 		RefRange:  ttValue.RefRange,
@@ -214,6 +276,13 @@ func Load(ctx context.Context, filename string, hl7Config *config.HL7Config) (*O
 		testTypes := map[string]*TestType{}
 		for ttName, ttValue := range v.TestTypes {
 			testTypes[ttName] = testType(ttName, ttValue, hl7Config.CodingSystem)
+			for _, r := range ttValue.RefRanges {
+				rr, err := newReferenceRange(ttName, ttValue, r, hl7Config.CodingSystem, hl7Config.Gender)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid order profile %s", k)
+				}
+				testTypes[ttName].refRanges = append(testTypes[ttName].refRanges, rr)
+			}
 		}
 
 		codingSystem := hl7Config.CodingSystem
@@ -221,7 +290,7 @@ func Load(ctx context.Context, filename string, hl7Config *config.HL7Config) (*O
 			codingSystem = v.CodingSystem
 		}
 		orderProfiles[k] = &OrderProfile{
-			UniversalService: ir.CodedElement{ID: v.UniversalServiceID, Text: k, CodingSystem: codingSystem},
+			UniversalService: ir.CodedElement{ID: v.UniversalServiceID, Text: k, CodingSystem: codingSystem, AlternateCodings: alternateCodings(v.AlternateCodings)},
 			TestTypes:        testTypes,
 		}
 		log.Infof(" - %s", k)
@@ -134,6 +134,28 @@ Vital Signs:
       value: 37.5
       value_type: NM`)
 
+	lipidOPAlternateCodings = []byte(`
+LIPID:
+  universal_service_id: 57698-3
+  coding_system: LN
+  alternate_codings:
+    - id: us-0001
+      coding_system: WinPath
+  test_types:
+    Cholesterol:
+      id: 2093-3
+      coding_system: LN
+      ref_range: '[ < 4.5]'
+      unit: 'mmol/L'
+      value: '6.3'
+      value_type: NM
+      alternate_codings:
+        - id: tt-0001-01
+          coding_system: WinPath
+        - id: '22569'
+          text: Cholesterol Total
+          coding_system: LOCAL`)
+
 	invalidOP = []byte(`
 17-OH Prog:
   service_id: OHPROG
@@ -192,6 +214,31 @@ func TestLoad(t *testing.T) {
 				ValueType: "NM",
 				RefRange:  "36-38",
 			},
+		}, {
+			name:          "Alternate codings",
+			opFileContent: lipidOPAlternateCodings,
+			opName:        "LIPID",
+			ttName:        "Cholesterol",
+			wantUS: ir.CodedElement{
+				ID:               "57698-3",
+				Text:             "LIPID",
+				CodingSystem:     "LN",
+				AlternateCodings: []ir.Coding{{ID: "us-0001", CodingSystem: "WinPath"}},
+			},
+			wantTT: &TestType{
+				Name: ir.CodedElement{
+					ID:           "2093-3",
+					Text:         "Cholesterol",
+					CodingSystem: "LN",
+					AlternateCodings: []ir.Coding{
+						{ID: "tt-0001-01", CodingSystem: "WinPath"},
+						{ID: "22569", Text: "Cholesterol Total", CodingSystem: "LOCAL"},
+					},
+				},
+				Unit:      "mmol/L",
+				ValueType: "NM",
+				RefRange:  "[ < 4.5]",
+			},
 		}, {
 			name:          "Invalid Order Profile",
 			opFileContent: invalidOP,
@@ -463,6 +510,87 @@ func TestRandomisedValueWithFlagRange_Error(t *testing.T) {
 	}
 }
 
+func TestLoad_LOINCProfilesMatchDefaultProfiles(t *testing.T) {
+	ctx := context.Background()
+	hl7Config, err := config.LoadHL7Config(ctx, test.MessageConfigProd)
+	if err != nil {
+		t.Fatalf("LoadHL7Config(%s) failed with %v", test.MessageConfigProd, err)
+	}
+	testTypes := func(fName string) map[string][]string {
+		t.Helper()
+		ops, err := Load(ctx, fName, hl7Config)
+		if err != nil {
+			t.Fatalf("Load(%s, %+v) failed with %v", fName, hl7Config, err)
+		}
+		m := map[string][]string{}
+		for name, op := range ops.op {
+			for ttName := range op.TestTypes {
+				m[name] = append(m[name], ttName)
+			}
+		}
+		return m
+	}
+
+	want := testTypes(test.OrderProfilesConfigProd)
+	got := testTypes(test.OrderProfilesLOINCConfigProd)
+	sortStrings := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+	if diff := cmp.Diff(want, got, sortStrings); diff != "" {
+		t.Errorf("Load(%s) got order profiles and test types different from %s, diff (-want +got):\n%s", test.OrderProfilesLOINCConfigProd, test.OrderProfilesConfigProd, diff)
+	}
+}
+
+func TestValidateAbnormalResults(t *testing.T) {
+	ctx := context.Background()
+	hl7Config := loadHL7Config(ctx, t)
+	fName := testwrite.BytesToFile(t, ureaOP)
+	op, err := Load(ctx, fName, hl7Config)
+	if err != nil {
+		t.Fatalf("Load(%s, %+v) failed with %v", fName, hl7Config, err)
+	}
+
+	cases := []struct {
+		name            string
+		abnormalResults map[string]string
+		wantErr         bool
+	}{
+		{name: "known test type", abnormalResults: map[string]string{"Creatinine": constants.AbnormalHigh}},
+		{name: "no abnormal results"},
+		{name: "unknown test type", abnormalResults: map[string]string{"Creatinine": constants.AbnormalHigh, "Unknown": constants.AbnormalLow}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			comorbidities := []config.Comorbidity{{
+				Description:     &ir.CodedElement{ID: "N18", Text: "Chronic kidney disease"},
+				AbnormalResults: tc.abnormalResults,
+			}}
+			if err := op.ValidateAbnormalResults(comorbidities); (err != nil) != tc.wantErr {
+				t.Errorf("ValidateAbnormalResults(%+v) got err %v, want err? %t", comorbidities, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAbnormalResults_ProdConfig(t *testing.T) {
+	ctx := context.Background()
+	hl7Config, err := config.LoadHL7Config(ctx, test.MessageConfigProd)
+	if err != nil {
+		t.Fatalf("LoadHL7Config(%s) failed with %v", test.MessageConfigProd, err)
+	}
+	data, err := config.LoadData(ctx, test.DataFiles[test.Prod], hl7Config)
+	if err != nil {
+		t.Fatalf("LoadData(%+v) failed with %v", test.DataFiles[test.Prod], err)
+	}
+	for _, fName := range []string{test.OrderProfilesConfigProd, test.OrderProfilesLOINCConfigProd} {
+		op, err := Load(ctx, fName, hl7Config)
+		if err != nil {
+			t.Fatalf("Load(%s, %+v) failed with %v", fName, hl7Config, err)
+		}
+		if err := op.ValidateAbnormalResults(data.Comorbidities); err != nil {
+			t.Errorf("ValidateAbnormalResults() with order profiles %s got err %v, want <nil>", fName, err)
+		}
+	}
+}
+
 func TestGenerate(t *testing.T) {
 	ctx := context.Background()
 	hl7Config := loadHL7Config(ctx, t)
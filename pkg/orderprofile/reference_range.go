@@ -0,0 +1,159 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orderprofile
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/config"
+	"github.com/google/simhospital/pkg/ir"
+)
+
+// Sex values that can be used in the reference ranges of test types.
+const (
+	sexMale   = "M"
+	sexFemale = "F"
+)
+
+var ageRegExp = regexp.MustCompile(`^([0-9]+) ?([dwmy]?)$`)
+
+// age is an age expressed in years, months, weeks or days, e.g., "18y", "6m", "2w" or "28d".
+// A number without unit is a number of years.
+type age struct {
+	years  int
+	months int
+	days   int
+}
+
+// parseAge parses an age from the given string.
+func parseAge(s string) (age, error) {
+	m := ageRegExp.FindStringSubmatch(s)
+	if m == nil {
+		return age{}, fmt.Errorf("invalid age %q; must be a number followed by an optional unit: d, w, m or y", s)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return age{}, errors.Wrapf(err, "invalid age %q", s)
+	}
+	switch m[2] {
+	case "d":
+		return age{days: n}, nil
+	case "w":
+		return age{days: 7 * n}, nil
+	case "m":
+		return age{months: n}, nil
+	default:
+		return age{years: n}, nil
+	}
+}
+
+// reached returns whether a person born at the given time has reached this age at the given time.
+func (a age) reached(birth time.Time, at time.Time) bool {
+	return !birth.AddDate(a.years, a.months, a.days).After(at)
+}
+
+// referenceRange is a reference range of a test type that only applies to people of the given sex and
+// within the given age band.
+type referenceRange struct {
+	// gender is the HL7 value of the sex the range applies to, or empty if it applies to all.
+	gender string
+	// ageFrom is the age from which the range applies, inclusive.
+	ageFrom *age
+	// ageTo is the age until which the range applies, exclusive.
+	ageTo *age
+	// testType is the test type with the reference range, value generator and default value of this range.
+	testType *TestType
+}
+
+// matches returns whether the reference range applies to the given person at the given time.
+// Ranges constrained by sex or age never apply to people with unknown sex or date of birth.
+func (r *referenceRange) matches(p *ir.Person, at time.Time) bool {
+	if r.gender != "" && (p == nil || p.Gender != r.gender) {
+		return false
+	}
+	if r.ageFrom == nil && r.ageTo == nil {
+		return true
+	}
+	if p == nil || !p.Birth.Valid {
+		return false
+	}
+	if r.ageFrom != nil && !r.ageFrom.reached(p.Birth.Time, at) {
+		return false
+	}
+	if r.ageTo != nil && r.ageTo.reached(p.Birth.Time, at) {
+		return false
+	}
+	return true
+}
+
+type refRange struct {
+	Sex      string
+	AgeFrom  string `yaml:"age_from"`
+	AgeTo    string `yaml:"age_to"`
+	RefRange string `yaml:"ref_range"`
+}
+
+func newReferenceRange(ttName string, ttValue tt, r refRange, codingSystem string, gender config.Gender) (*referenceRange, error) {
+	rr := &referenceRange{}
+	switch r.Sex {
+	case "":
+	case sexMale:
+		rr.gender = gender.Male
+	case sexFemale:
+		rr.gender = gender.Female
+	default:
+		return nil, fmt.Errorf("invalid sex %q in reference range for test type %q; must be one of [%s, %s]", r.Sex, ttName, sexMale, sexFemale)
+	}
+	if r.Sex != "" && rr.gender == "" {
+		return nil, fmt.Errorf("cannot use sex %q in reference range for test type %q: no gender values in the HL7 config", r.Sex, ttName)
+	}
+	if r.AgeFrom != "" {
+		a, err := parseAge(r.AgeFrom)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid age_from in reference range for test type %q", ttName)
+		}
+		rr.ageFrom = &a
+	}
+	if r.AgeTo != "" {
+		a, err := parseAge(r.AgeTo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid age_to in reference range for test type %q", ttName)
+		}
+		rr.ageTo = &a
+	}
+	if r.RefRange == "" {
+		return nil, fmt.Errorf("missing ref_range in reference range for test type %q", ttName)
+	}
+	ttValue.RefRange = r.RefRange
+	rr.testType = testType(ttName, ttValue, codingSystem)
+	return rr, nil
+}
+
+// ForPerson returns the test type with the reference range that applies to the given person at the given time.
+// The reference ranges are checked in the order they were defined, and the first one that matches is used.
+// If none of them matches, or the person is nil, the test type with the default reference range is returned.
+// The returned test type must not be modified.
+func (tt *TestType) ForPerson(p *ir.Person, at time.Time) *TestType {
+	for _, r := range tt.refRanges {
+		if r.matches(p, at) {
+			return r.testType
+		}
+	}
+	return tt
+}
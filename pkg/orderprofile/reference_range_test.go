@@ -0,0 +1,147 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orderprofile
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/simhospital/pkg/config"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+var (
+	hl7ConfigWithGender = []byte(`
+coding_system: "WinPath"
+gender:
+  male: "M"
+  female: "F"
+`)
+
+	fbcOP = []byte(`
+FULL BLOOD COUNT:
+  universal_service_id: FBC
+  test_types:
+    Haemoglobin:
+      id: HB
+      value_type: NM
+      value: 140
+      unit: g/L
+      ref_range: 130 - 170
+      ref_ranges:
+        - age_to: 28d
+          ref_range: 140 - 220
+        - age_from: 28d
+          age_to: 18y
+          ref_range: 105 - 140
+        - sex: F
+          ref_range: 115 - 150`)
+)
+
+func TestForPerson(t *testing.T) {
+	ctx := context.Background()
+	fConfig := testwrite.BytesToFile(t, hl7ConfigWithGender)
+	hl7Config, err := config.LoadHL7Config(ctx, fConfig)
+	if err != nil {
+		t.Fatalf("LoadHL7Config(%s) failed with %v", fConfig, err)
+	}
+	fName := testwrite.BytesToFile(t, fbcOP)
+	ops, err := Load(ctx, fName, hl7Config)
+	if err != nil {
+		t.Fatalf("Load(%s, %+v) failed with %v", fName, hl7Config, err)
+	}
+	op, ok := ops.Get("FULL BLOOD COUNT")
+	if !ok {
+		t.Fatalf("Get(%q) got ok = %t, want true", "FULL BLOOD COUNT", ok)
+	}
+	tt := op.TestTypes["Haemoglobin"]
+
+	now := time.Date(2020, 2, 12, 10, 0, 0, 0, time.UTC)
+	bornAgo := func(years, months, days int) ir.NullTime {
+		return ir.NewValidTime(now.AddDate(-years, -months, -days))
+	}
+	cases := []struct {
+		name         string
+		person       *ir.Person
+		wantRefRange string
+		wantHigh     float64
+	}{
+		{name: "nil person", person: nil, wantRefRange: "130 - 170", wantHigh: 171},
+		{name: "adult man", person: &ir.Person{Gender: "M", Birth: bornAgo(40, 0, 0)}, wantRefRange: "130 - 170", wantHigh: 171},
+		{name: "adult woman", person: &ir.Person{Gender: "F", Birth: bornAgo(40, 0, 0)}, wantRefRange: "115 - 150", wantHigh: 151},
+		{name: "woman with unknown date of birth", person: &ir.Person{Gender: "F"}, wantRefRange: "115 - 150", wantHigh: 151},
+		{name: "newborn", person: &ir.Person{Gender: "F", Birth: bornAgo(0, 0, 3)}, wantRefRange: "140 - 220", wantHigh: 221},
+		{name: "exactly 28 days", person: &ir.Person{Gender: "M", Birth: bornAgo(0, 0, 28)}, wantRefRange: "105 - 140", wantHigh: 141},
+		{name: "child", person: &ir.Person{Gender: "M", Birth: bornAgo(10, 0, 0)}, wantRefRange: "105 - 140", wantHigh: 141},
+		{name: "exactly 18 years", person: &ir.Person{Gender: "M", Birth: bornAgo(18, 0, 0)}, wantRefRange: "130 - 170", wantHigh: 171},
+		{name: "unknown sex and date of birth", person: &ir.Person{}, wantRefRange: "130 - 170", wantHigh: 171},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tt.ForPerson(tc.person, now)
+			if got.RefRange != tc.wantRefRange {
+				t.Errorf("ForPerson(%+v, %v).RefRange got %q, want %q", tc.person, now, got.RefRange, tc.wantRefRange)
+			}
+			if got.ValueGenerator == nil {
+				t.Fatalf("ForPerson(%+v, %v).ValueGenerator got nil, want not nil", tc.person, now)
+			}
+			if !got.ValueGenerator.IsHigh(tc.wantHigh) {
+				t.Errorf("ForPerson(%+v, %v).ValueGenerator.IsHigh(%v) got false, want true", tc.person, now, tc.wantHigh)
+			}
+			if got.Unit != "g/L" || got.Name.ID != "HB" {
+				t.Errorf("ForPerson(%+v, %v) got unit %q and ID %q, want %q and %q", tc.person, now, got.Unit, got.Name.ID, "g/L", "HB")
+			}
+		})
+	}
+}
+
+func TestLoadInvalidReferenceRanges(t *testing.T) {
+	ctx := context.Background()
+	fConfig := testwrite.BytesToFile(t, hl7ConfigWithGender)
+	hl7Config, err := config.LoadHL7Config(ctx, fConfig)
+	if err != nil {
+		t.Fatalf("LoadHL7Config(%s) failed with %v", fConfig, err)
+	}
+	cases := []struct {
+		name      string
+		refRanges string
+	}{
+		{name: "invalid sex", refRanges: "- sex: X\n          ref_range: 1 - 2"},
+		{name: "invalid age", refRanges: "- age_from: 3 years\n          ref_range: 1 - 2"},
+		{name: "missing range", refRanges: "- sex: M"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := []byte(`
+FULL BLOOD COUNT:
+  universal_service_id: FBC
+  test_types:
+    Haemoglobin:
+      id: HB
+      value_type: NM
+      value: 140
+      unit: g/L
+      ref_range: 130 - 170
+      ref_ranges:
+        ` + tc.refRanges)
+			fName := testwrite.BytesToFile(t, b)
+			if _, err := Load(ctx, fName, hl7Config); err == nil {
+				t.Errorf("Load(%s) got nil error, want error", b)
+			}
+		})
+	}
+}
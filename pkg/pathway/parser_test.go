@@ -1209,6 +1209,7 @@ func TestParseAutogenerate(t *testing.T) {
 	threeHoursAgo := -3 * time.Hour
 	twoHoursAgo := -2 * time.Hour
 	oneHourAgo := -1 * time.Hour
+	twoHours := 2 * time.Hour
 
 	customParams := &Parameters{
 		SendingApplication:   "sa",
@@ -1498,6 +1499,32 @@ random_pathway:
 					Step{Result: &Results{OrderProfile: "Vital Signs"}, Parameters: customParams},
 				},
 			},
+		}, {
+			name: "vitals",
+			pathwayDefinition: []byte(`
+random_pathway:
+  pathway:
+    - admission:
+        loc: Renal
+    - autogenerate:
+        vitals:
+          acuity: MEDIUM
+          trend: DETERIORATING
+          over: 2h
+        from: -1h
+        to: 0h
+        every: 1h
+`),
+			want: Pathway{
+				Persons: &Persons{defaultPatientID: {}},
+				History: []Step{
+					Step{Vitals: &Vitals{Acuity: AcuityMedium, Trend: VitalsDeteriorating, Over: &twoHours}, Parameters: &Parameters{TimeFromNow: &oneHourAgo}},
+				},
+				Pathway: []Step{
+					Step{Admission: &Admission{Loc: "Renal"}},
+					Step{Vitals: &Vitals{Acuity: AcuityMedium, Trend: VitalsDeteriorating, Over: &twoHours}},
+				},
+			},
 		}, {
 			name: "with use_patient",
 			pathwayDefinition: []byte(`
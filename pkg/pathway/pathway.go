@@ -38,6 +38,7 @@ const (
 	StepAdmission              = "Admission"
 	StepOrder                  = "Order"
 	StepResults                = "Result"
+	StepVitals                 = "Vitals"
 	StepDischarge              = "Discharge"
 	StepRegistration           = "Registration"
 	StepPreAdmission           = "PreAdmission"
@@ -88,6 +89,36 @@ const (
 	TemporaryMode = "temporary"
 )
 
+// Constants for the shapes of a result Trajectory.
+const (
+	// TrajectoryRising is a trajectory where the value rises from its baseline to the target.
+	TrajectoryRising = "RISING"
+	// TrajectoryFalling is a trajectory where the value falls from its baseline to the target.
+	TrajectoryFalling = "FALLING"
+	// TrajectoryStable is a trajectory where the value stays at its baseline, with analytical noise.
+	TrajectoryStable = "STABLE"
+	// TrajectoryPeakThenRecover is a trajectory where the value reaches a peak and then returns to its baseline.
+	TrajectoryPeakThenRecover = "PEAK_THEN_RECOVER"
+)
+
+// Constants for the acuity of a patient in a Vitals step, from a well patient to a critically ill one.
+const (
+	AcuityLow      = "LOW"
+	AcuityMedium   = "MEDIUM"
+	AcuityHigh     = "HIGH"
+	AcuityCritical = "CRITICAL"
+)
+
+// Constants for the trend of the acuity of a patient in a Vitals step.
+const (
+	// VitalsStable is a trend where the acuity of the patient doesn't change.
+	VitalsStable = "STABLE"
+	// VitalsDeteriorating is a trend where the acuity of the patient rises to CRITICAL.
+	VitalsDeteriorating = "DETERIORATING"
+	// VitalsImproving is a trend where the acuity of the patient falls to LOW.
+	VitalsImproving = "IMPROVING"
+)
+
 // Constants for the possible update types in a Document step.
 const (
 	Append    = "append"
@@ -100,6 +131,10 @@ var (
 	randomValues = map[string]bool{constants.NormalValue: true, constants.AbnormalHigh: true, constants.AbnormalLow: true}
 
 	extractDecimalsRegexp = regexp.MustCompile(`[0-9]+.([0-9]+)`)
+
+	// zSegmentFieldRegexp matches the keys of Parameters.Custom that set fields of Z-segments,
+	// e.g., ZPI-2.
+	zSegmentFieldRegexp = regexp.MustCompile(`^(Z[A-Z0-9]{2})-([1-9][0-9]*)$`)
 )
 
 // Person represents a person in the pathway.
@@ -140,6 +175,8 @@ type UpdatePerson struct {
 	Diagnoses  []*DiagnosisOrProcedure
 	Procedures []*DiagnosisOrProcedure
 	Allergies  []Allergy
+	// Problems are changes to the problem list of the patient.
+	Problems       []*Problem
 	IncludeFullPV1 bool   `yaml:"include_full_pv1,omitempty"`
 }
 
@@ -204,9 +241,41 @@ type Parameters struct {
 	// ReceivingFacility to use for this message, if different from the default.
 	ReceivingFacility string `yaml:"receiving_facility,omitempty"`
 	// Custom are other parameters that can be used for custom processing.
+	// Keys with the form <segment>-<field>, e.g., ZPI-2, set fields of custom Z-segments, which are
+	// added to the message generated by the step, but not to order acknowledgements or hardcoded
+	// messages. The values are used verbatim, so they can contain components and repetitions; field
+	// separators and line breaks are escaped.
 	Custom map[string]string `yaml:"custom,omitempty"`
 }
 
+// ZSegmentFields returns the values of the fields of Z-segments set in Custom, by segment name and
+// field number, or nil if Custom does not set any.
+func (p *Parameters) ZSegmentFields() map[string]map[int]string {
+	if p == nil {
+		return nil
+	}
+	var fields map[string]map[int]string
+	for k, v := range p.Custom {
+		match := zSegmentFieldRegexp.FindStringSubmatch(k)
+		if match == nil {
+			continue
+		}
+		n, err := strconv.Atoi(match[2])
+		if err != nil {
+			// Cannot happen: the regular expression only matches numbers.
+			continue
+		}
+		if fields == nil {
+			fields = map[string]map[int]string{}
+		}
+		if fields[match[1]] == nil {
+			fields[match[1]] = map[int]string{}
+		}
+		fields[match[1]][n] = v
+	}
+	return fields
+}
+
 // Order is a step to place an order. It produces an ORM message followed by
 // Order acknowledgement message (ORR^O02).
 type Order struct {
@@ -318,6 +387,171 @@ type Result struct {
 	// Notes are the notes that will be used to populate the NTE segments associated with this result.
 	// Optional.
 	Notes []string
+	// Trajectory makes the value of this result follow a trajectory over time for the patient, instead
+	// of being generated independently every time.
+	// Optional.
+	// If specified, Value and AbnormalFlag cannot be specified: the value is derived from the
+	// trajectory, and the abnormal flag from the value and the reference range.
+	Trajectory *Trajectory
+	// Tracks makes the value of this result follow the relative changes of the trajectory of another test,
+	// e.g., Urea tracking Creatinine.
+	// Optional.
+	// Only one of Trajectory and Tracks can be specified.
+	Tracks *Tracks
+}
+
+// Trajectory describes how the values of a numerical test evolve over time for a patient.
+// Simulated Hospital keeps the state of the trajectory per patient and per test, so that all results
+// with the same trajectory, e.g., the ones inserted by an AutoGenerate step, follow the same curve.
+// A result with a different trajectory for the same test starts a new trajectory from the current value.
+type Trajectory struct {
+	// Shape is the shape of the trajectory: RISING, FALLING, STABLE or PEAK_THEN_RECOVER.
+	// Required.
+	Shape string
+	// Start is the value at the start of the trajectory.
+	// Optional.
+	// If not specified, the trajectory starts from the current value of the previous trajectory for the
+	// same test, or from a random value in the normal range if there is no such trajectory.
+	Start *float64
+	// Target is the value reached after Over for RISING and FALLING trajectories, or the value of the
+	// peak for PEAK_THEN_RECOVER trajectories.
+	// Only one of Target and TargetFactor can be specified, and one of them is required unless the
+	// Shape is STABLE.
+	Target *float64
+	// TargetFactor is the Target expressed as a multiple of the starting value, e.g., 2 to double it.
+	TargetFactor *float64 `yaml:"target_factor"`
+	// Over is the time it takes to reach the Target.
+	// Required unless the Shape is STABLE.
+	Over *time.Duration
+	// RecoverOver is the time it takes to return to the starting value after the peak.
+	// Required for PEAK_THEN_RECOVER trajectories only.
+	RecoverOver *time.Duration `yaml:"recover_over"`
+	// NoisePercent is the coefficient of variation of the analytical noise, as a percentage of the value.
+	// Optional.
+	// If not specified, defaults to DefaultNoisePercent.
+	NoisePercent *float64 `yaml:"noise_percent"`
+}
+
+// DefaultNoisePercent is the default coefficient of variation of the analytical noise added to the values
+// that follow a Trajectory, as a percentage of the value.
+const DefaultNoisePercent = 3.0
+
+// GetNoisePercent returns the NoisePercent of the trajectory, or DefaultNoisePercent if not set.
+func (t *Trajectory) GetNoisePercent() float64 {
+	if t.NoisePercent == nil {
+		return DefaultNoisePercent
+	}
+	return *t.NoisePercent
+}
+
+// String returns a representation of the trajectory that identifies its definition.
+func (t *Trajectory) String() string {
+	return fmt.Sprintf("shape=%s start=%s target=%s target_factor=%s over=%s recover_over=%s noise_percent=%v",
+		t.Shape, optionalFloat(t.Start), optionalFloat(t.Target), optionalFloat(t.TargetFactor),
+		optionalDuration(t.Over), optionalDuration(t.RecoverOver), t.GetNoisePercent())
+}
+
+// Tracks specifies that the value of a result follows the relative changes of the trajectory of another test.
+type Tracks struct {
+	// TestName is the name of the test whose trajectory is followed.
+	// Required.
+	TestName string `yaml:"test_name"`
+	// Factor scales the relative change of the followed test: with 1, a 50% rise of the followed test
+	// causes a 50% rise of this result; with 0.5, it causes a 25% rise.
+	// Optional.
+	// If not specified, defaults to 1.
+	Factor float64
+	// NoisePercent is the coefficient of variation of the analytical noise, as a percentage of the value.
+	// Optional.
+	// If not specified, defaults to DefaultNoisePercent.
+	NoisePercent *float64 `yaml:"noise_percent"`
+}
+
+// GetFactor returns the Factor, or 1 if not set.
+func (t *Tracks) GetFactor() float64 {
+	if t.Factor == 0 {
+		return 1
+	}
+	return t.Factor
+}
+
+// GetNoisePercent returns the NoisePercent, or DefaultNoisePercent if not set.
+func (t *Tracks) GetNoisePercent() float64 {
+	if t.NoisePercent == nil {
+		return DefaultNoisePercent
+	}
+	return *t.NoisePercent
+}
+
+// Vitals is a step to generate a set of vital signs observations: heart rate, blood pressure, respiratory rate,
+// oxygen saturation, temperature and Glasgow Coma Scale, plus the NEWS2 early warning score derived from them.
+// The values are consistent with each other and with the acuity of the patient, and each patient has their own
+// baseline values.
+// It produces an ORU^R01 message with one LOINC-coded OBX segment per observation.
+// Simulated Hospital keeps the acuity of the patient over time, so that all Vitals steps with the same definition,
+// e.g., the ones inserted by an AutoGenerate step, follow the same trend.
+// A Vitals step with a different definition starts a new trend from the current acuity.
+type Vitals struct {
+	// Acuity is the acuity of the patient at the start of the trend: LOW, MEDIUM, HIGH or CRITICAL.
+	// Optional.
+	// If not specified, the trend starts from the current acuity of the patient, or LOW if there is none.
+	Acuity string
+	// Trend is how the acuity of the patient evolves over time: STABLE, DETERIORATING or IMPROVING.
+	// Optional.
+	// If not specified, defaults to STABLE.
+	Trend string
+	// Over is the time it takes for a DETERIORATING patient to become critically ill, or for an IMPROVING
+	// patient to recover.
+	// Required if Trend is DETERIORATING or IMPROVING.
+	Over *time.Duration
+	// SupplementalOxygen is whether the patient is on supplemental oxygen, which contributes to the NEWS2 score.
+	// Optional.
+	// If not specified, patients with HIGH acuity or above are on supplemental oxygen.
+	SupplementalOxygen *bool `yaml:"supplemental_oxygen"`
+	// NoisePercent is the standard deviation of the measurement noise of each vital sign, as a percentage of
+	// the difference between its typical values for a well and a critically ill patient.
+	// Optional.
+	// If not specified, defaults to DefaultVitalsNoisePercent.
+	NoisePercent *float64 `yaml:"noise_percent"`
+}
+
+// DefaultVitalsNoisePercent is the default standard deviation of the measurement noise of the vital signs, as a
+// percentage of the difference between their typical values for a well and a critically ill patient.
+const DefaultVitalsNoisePercent = 10.0
+
+// GetNoisePercent returns the NoisePercent of the vitals, or DefaultVitalsNoisePercent if not set.
+func (v *Vitals) GetNoisePercent() float64 {
+	if v.NoisePercent == nil {
+		return DefaultVitalsNoisePercent
+	}
+	return *v.NoisePercent
+}
+
+// String returns a representation of the vitals that identifies their definition.
+func (v *Vitals) String() string {
+	return fmt.Sprintf("acuity=%s trend=%s over=%s supplemental_oxygen=%s noise_percent=%v",
+		v.Acuity, v.Trend, optionalDuration(v.Over), optionalBool(v.SupplementalOxygen), v.GetNoisePercent())
+}
+
+func optionalBool(b *bool) string {
+	if b == nil {
+		return "-"
+	}
+	return strconv.FormatBool(*b)
+}
+
+func optionalFloat(f *float64) string {
+	if f == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func optionalDuration(d *time.Duration) string {
+	if d == nil {
+		return "-"
+	}
+	return d.String()
 }
 
 // Admission is a step to admit the patient to the hospital. It produces an ADT^A01 message.
@@ -710,6 +944,23 @@ type Allergy struct {
 	IdentificationDateTime *DateTime `yaml:"identification_datetime,omitempty"`
 }
 
+// Problem represents a change to the problem list of a patient, i.e., to their long-term conditions.
+// If the patient already has the problem, its status is updated. Otherwise, the problem is added.
+type Problem struct {
+	// Code is the code of the problem.
+	// Either Code or Description (or both) is required.
+	// If Description is missing and the Code is on the list of comorbidities or diagnoses loaded from
+	// the config files, the Description will be derived from the Code, and vice versa.
+	Code        string
+	Description string
+	// Status is the clinical status of the problem: active, recurrence, relapse, inactive, remission
+	// or resolved. Defaults to active.
+	Status string
+	// Onset is when the problem started. It is only used when the problem is added.
+	// Defaults to the time of the event.
+	Onset *DateTime
+}
+
 // DiagnosisOrProcedure represents a Diagnosis or Procedure.
 type DiagnosisOrProcedure struct {
 	// Type is a type of diagnosis or procedure.
@@ -744,18 +995,21 @@ type DiagnosisOrProcedure struct {
 // It produces an ADT^A23 message.
 type DeleteVisit struct{}
 
-// AutoGenerate step inserts n Results steps into the pathway,
+// AutoGenerate step inserts n Results or Vitals steps into the pathway,
 // where n is determined by time interval From -> To and period Every.
 // From and To are absolute time differences from time = 0.
-// If From < 0 and To > 0, Results steps will start in History at time = From,
+// If From < 0 and To > 0, the steps will start in History at time = From,
 // with the last one generated in Pathway at time = To.
-// If Results are not specified, they will be generated for a random OrderProfile.
+// Only one of Result and Vitals can be specified.
+// If neither is specified, Results will be generated for a random OrderProfile.
 // AutoGenerate step cannot be defined in the History.
 // If From and To are the same, Every cannot be set, and there will be a single
 // autogenerated Results step.
 type AutoGenerate struct {
 	// Result represents the results that should be generated.
 	Result *Results
+	// Vitals represents the vital signs that should be generated.
+	Vitals *Vitals
 	From   *time.Duration
 	To     *time.Duration
 	Every  *time.Duration
@@ -955,6 +1209,7 @@ type Step struct {
 	Admission              *Admission              `yaml:",omitempty"`
 	Order                  *Order                  `yaml:",omitempty"`
 	Result                 *Results                `yaml:",omitempty"`
+	Vitals                 *Vitals                 `yaml:",omitempty"`
 	Discharge              *Discharge              `yaml:",omitempty"`
 	Registration           *Registration           `yaml:",omitempty"`
 	PreAdmission           *PreAdmission           `yaml:"pre_admission,omitempty"`
@@ -1342,11 +1597,15 @@ func (p *Pathway) parseAutoGenerate() error {
 		}
 	}
 
-	// Add Results steps to the pathway.
+	// Add Results or Vitals steps to the pathway.
 	for _, s := range agSteps {
 		resultTime := *s.AutoGenerate.From
 		for resultTime <= *s.AutoGenerate.To {
-			if err := p.insertAtTime(Step{Result: s.AutoGenerate.Result, Parameters: s.Parameters}, resultTime); err != nil {
+			step := Step{Result: s.AutoGenerate.Result, Parameters: s.Parameters}
+			if s.AutoGenerate.Vitals != nil {
+				step = Step{Vitals: s.AutoGenerate.Vitals, Parameters: s.Parameters}
+			}
+			if err := p.insertAtTime(step, resultTime); err != nil {
 				return errors.Wrapf(err, "cannot insert at time %v", resultTime)
 			}
 
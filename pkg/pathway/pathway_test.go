@@ -623,3 +623,30 @@ func TestInitCalledMultipleTimes(t *testing.T) {
 		t.Errorf("[%+v].MessageCount()=%d, want %d", pathway, got, want)
 	}
 }
+
+func TestParametersZSegmentFields(t *testing.T) {
+	cases := []struct {
+		name   string
+		params *Parameters
+		want   map[string]map[int]string
+	}{{
+		name: "nil parameters",
+	}, {
+		name:   "no Z-segment fields",
+		params: &Parameters{Custom: map[string]string{"key": "value", "ZPI": "value", "ZPI-0": "value", "PID-3": "value"}},
+	}, {
+		name:   "Z-segment fields",
+		params: &Parameters{Custom: map[string]string{"key": "value", "ZPI-1": "1", "ZPI-12": "a^b~c", "ZV1-2": "X"}},
+		want: map[string]map[int]string{
+			"ZPI": {1: "1", 12: "a^b~c"},
+			"ZV1": {2: "X"},
+		},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.params.ZSegmentFields()); diff != "" {
+				t.Errorf("ZSegmentFields() got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/google/simhospital/pkg/clock"
 	"github.com/google/simhospital/pkg/constants"
 	"github.com/google/simhospital/pkg/doctor"
+	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/ir"
 	"github.com/google/simhospital/pkg/location"
 	"github.com/google/simhospital/pkg/orderprofile"
@@ -203,7 +204,10 @@ func (a *AutoGenerate) valid() error {
 	if a == nil {
 		return nil
 	}
-	if a.Result == nil {
+	if a.Result != nil && a.Vitals != nil {
+		return errors.New("autogenerate cannot have both Result and Vitals set")
+	}
+	if a.Result == nil && a.Vitals == nil {
 		a.Result = &Results{OrderProfile: constants.RandomString}
 	}
 	if a.From == nil || a.To == nil {
@@ -221,9 +225,42 @@ func (a *AutoGenerate) valid() error {
 	if a.Every != nil && a.Every.Seconds() <= 0 {
 		return errors.New("autogenerate requires a positive Every")
 	}
+	if a.Vitals != nil {
+		return a.Vitals.valid()
+	}
 	return a.Result.valid()
 }
 
+func (v *Vitals) valid() error {
+	if v == nil {
+		return nil
+	}
+	var ec error
+	switch v.Acuity {
+	case "", AcuityLow, AcuityMedium, AcuityHigh, AcuityCritical:
+	default:
+		ec = combineErrors(ec, fmt.Errorf("invalid acuity %q; must be one of [%s, %s, %s, %s]",
+			v.Acuity, AcuityLow, AcuityMedium, AcuityHigh, AcuityCritical))
+	}
+	switch v.Trend {
+	case "", VitalsStable:
+		if v.Over != nil {
+			ec = combineErrors(ec, fmt.Errorf("vitals with trend %s cannot have Over", VitalsStable))
+		}
+	case VitalsDeteriorating, VitalsImproving:
+		if v.Over == nil || *v.Over <= 0 {
+			ec = combineErrors(ec, fmt.Errorf("vitals with trend %s require a positive Over", v.Trend))
+		}
+	default:
+		ec = combineErrors(ec, fmt.Errorf("invalid vitals trend %q; must be one of [%s, %s, %s]",
+			v.Trend, VitalsStable, VitalsDeteriorating, VitalsImproving))
+	}
+	if v.NoisePercent != nil && *v.NoisePercent < 0 {
+		ec = combineErrors(ec, fmt.Errorf("vitals NoisePercent cannot be negative, got %v", *v.NoisePercent))
+	}
+	return ec
+}
+
 func (n *ClinicalNote) valid() error {
 	if n == nil {
 		return nil
@@ -362,6 +399,9 @@ func (r *Result) valid(orderProfile *orderprofile.OrderProfile) error {
 	if r.TestName == "" {
 		ec = combineErrors(ec, fmt.Errorf("parameter TestName is missing in result: %v", r))
 	}
+	if r.Trajectory != nil || r.Tracks != nil {
+		return combineErrors(ec, r.validTrajectory(orderProfile))
+	}
 	if r.AbnormalFlag == constants.AbnormalFlagDefault && (r.Value == constants.EmptyString || r.GetValueType() == constants.TextualValueType) {
 		// If the value is textual or set to empty string, it doesn't matter what the ref range is set to; all values:
 		// HIGH / LOW / NORMAL for abnormal flag are acceptable, as this is the only way to indicate whether the value
@@ -382,6 +422,118 @@ func (r *Result) valid(orderProfile *orderprofile.OrderProfile) error {
 	return ec
 }
 
+// validTrajectory validates a result whose value is derived from a Trajectory or that Tracks another test.
+// Such results need a numerical test type in the order profile, so that the values can be generated
+// and the abnormal flags derived from the reference range.
+func (r *Result) validTrajectory(orderProfile *orderprofile.OrderProfile) error {
+	var ec error
+	if r.Trajectory != nil && r.Tracks != nil {
+		ec = combineErrors(ec, errors.New("only one of Trajectory and Tracks can be specified"))
+	}
+	if r.Value != "" || r.Unit != "" || r.AbnormalFlag != "" {
+		ec = combineErrors(ec, errors.New("parameters Value, Unit and AbnormalFlag cannot be specified for results with a Trajectory or Tracks; "+
+			"they are derived from the trajectory and the order profile"))
+	}
+	if r.ReferenceRange != "" {
+		ec = combineErrors(ec, errors.New("parameter ReferenceRange cannot be specified for results with a Trajectory or Tracks"))
+	}
+	if r.Trajectory != nil {
+		ec = combineErrors(ec, r.Trajectory.valid())
+	}
+	if r.Tracks != nil {
+		ec = combineErrors(ec, r.Tracks.valid(r.TestName))
+	}
+
+	if orderProfile == nil {
+		return combineErrors(ec, errors.New("results with a Trajectory or Tracks require a matching order profile"))
+	}
+	tt, ok := orderProfile.TestTypes[r.TestName]
+	if !ok {
+		return combineErrors(ec, fmt.Errorf("test type %q doesn't exist in the order profile %s", r.TestName, orderProfile.UniversalService.Text))
+	}
+	if tt.ValueGenerator == nil {
+		return combineErrors(ec, fmt.Errorf("test type %q doesn't have a numerical reference range; cannot generate values from a trajectory", r.TestName))
+	}
+	if r.Tracks != nil {
+		if _, ok := orderProfile.TestTypes[r.Tracks.TestName]; !ok {
+			ec = combineErrors(ec, fmt.Errorf("tracked test type %q doesn't exist in the order profile %s", r.Tracks.TestName, orderProfile.UniversalService.Text))
+		}
+	}
+	return ec
+}
+
+func (t *Trajectory) valid() error {
+	var ec error
+	switch t.Shape {
+	case TrajectoryStable:
+		if t.Target != nil || t.TargetFactor != nil || t.Over != nil || t.RecoverOver != nil {
+			ec = combineErrors(ec, fmt.Errorf("trajectory with shape %s cannot have Target, TargetFactor, Over or RecoverOver", t.Shape))
+		}
+	case TrajectoryRising, TrajectoryFalling, TrajectoryPeakThenRecover:
+		if (t.Target == nil) == (t.TargetFactor == nil) {
+			ec = combineErrors(ec, fmt.Errorf("trajectory with shape %s requires exactly one of Target and TargetFactor", t.Shape))
+		}
+		if t.TargetFactor != nil && *t.TargetFactor <= 0 {
+			ec = combineErrors(ec, fmt.Errorf("trajectory TargetFactor must be positive, got %v", *t.TargetFactor))
+		}
+		if t.Over == nil || *t.Over <= 0 {
+			ec = combineErrors(ec, fmt.Errorf("trajectory with shape %s requires a positive Over", t.Shape))
+		}
+		if t.Shape == TrajectoryPeakThenRecover && (t.RecoverOver == nil || *t.RecoverOver <= 0) {
+			ec = combineErrors(ec, fmt.Errorf("trajectory with shape %s requires a positive RecoverOver", t.Shape))
+		}
+		if t.Shape != TrajectoryPeakThenRecover && t.RecoverOver != nil {
+			ec = combineErrors(ec, fmt.Errorf("trajectory with shape %s cannot have RecoverOver", t.Shape))
+		}
+		ec = combineErrors(ec, t.validDirection())
+	default:
+		ec = combineErrors(ec, fmt.Errorf("invalid trajectory shape %q; must be one of [%s, %s, %s, %s]",
+			t.Shape, TrajectoryRising, TrajectoryFalling, TrajectoryStable, TrajectoryPeakThenRecover))
+	}
+	if t.NoisePercent != nil && *t.NoisePercent < 0 {
+		ec = combineErrors(ec, fmt.Errorf("trajectory NoisePercent cannot be negative, got %v", *t.NoisePercent))
+	}
+	return ec
+}
+
+// validDirection checks that RISING trajectories go up and FALLING trajectories go down,
+// whenever that can be known from the pathway definition.
+func (t *Trajectory) validDirection() error {
+	var up, known bool
+	switch {
+	case t.TargetFactor != nil:
+		up, known = *t.TargetFactor > 1, *t.TargetFactor != 1
+	case t.Target != nil && t.Start != nil:
+		up, known = *t.Target > *t.Start, *t.Target != *t.Start
+	default:
+		return nil
+	}
+	if !known {
+		return fmt.Errorf("trajectory with shape %s has the same Start and Target values", t.Shape)
+	}
+	if t.Shape == TrajectoryFalling && up {
+		return fmt.Errorf("trajectory with shape %s has a Target higher than its start", t.Shape)
+	}
+	if t.Shape == TrajectoryRising && !up {
+		return fmt.Errorf("trajectory with shape %s has a Target lower than its start", t.Shape)
+	}
+	return nil
+}
+
+func (t *Tracks) valid(testName string) error {
+	var ec error
+	if t.TestName == "" {
+		ec = combineErrors(ec, errors.New("tracks requires TestName to be set"))
+	}
+	if t.TestName == testName {
+		ec = combineErrors(ec, fmt.Errorf("result for test %q cannot track itself", testName))
+	}
+	if t.NoisePercent != nil && *t.NoisePercent < 0 {
+		ec = combineErrors(ec, fmt.Errorf("tracks NoisePercent cannot be negative, got %v", *t.NoisePercent))
+	}
+	return ec
+}
+
 func (r *Result) validValueAndRefRange(refRange string) error {
 	g, err := orderprofile.ValueGeneratorFromRange(refRange)
 	if err != nil {
@@ -632,6 +784,9 @@ func (s Step) valid(now time.Time, lm *location.Manager) error {
 	if err := s.Result.valid(); err != nil {
 		return errors.Wrap(err, "invalid Result step")
 	}
+	if err := s.Vitals.valid(); err != nil {
+		return errors.Wrap(err, "invalid Vitals step")
+	}
 	if err := s.Admission.valid(lm); err != nil {
 		return errors.Wrap(err, "invalid Admission step")
 	}
@@ -655,6 +810,9 @@ func (s Step) valid(now time.Time, lm *location.Manager) error {
 		if s.Parameters.Status != nil && s.Parameters.Status.TimeOfDeath != nil && s.Parameters.Status.TimeSinceDeath != nil {
 			return errors.New("only one of TimeOfDeath and TimeSinceDeath may be set in the same step")
 		}
+		if err := validZSegmentFields(s.Parameters.ZSegmentFields()); err != nil {
+			return errors.Wrap(err, "invalid Z-segment fields in parameters.custom")
+		}
 	}
 	if s.Merge != nil {
 		if len(s.Merge.Children) == 0 {
@@ -730,9 +888,30 @@ func (up *UpdatePerson) valid(now time.Time) error {
 			ec = combineErrors(ec, errors.Wrap(err, "invalid procedure"))
 		}
 	}
+	for _, p := range up.Problems {
+		if err := p.valid(now); err != nil {
+			ec = combineErrors(ec, errors.Wrap(err, "invalid problem"))
+		}
+	}
 	return ec
 }
 
+func (p *Problem) valid(now time.Time) error {
+	if p.Code == "" && p.Description == "" {
+		return errors.New("neither Code nor Description specified")
+	}
+	switch p.Status {
+	case "", ir.ProblemActive, ir.ProblemRecurrence, ir.ProblemRelapse, ir.ProblemInactive, ir.ProblemRemission, ir.ProblemResolved:
+	default:
+		return fmt.Errorf("invalid status %q; must be one of [%s, %s, %s, %s, %s, %s]", p.Status,
+			ir.ProblemActive, ir.ProblemRecurrence, ir.ProblemRelapse, ir.ProblemInactive, ir.ProblemRemission, ir.ProblemResolved)
+	}
+	if p.Onset != nil && (!p.Onset.valid() || !p.Onset.IsBefore(now)) {
+		return fmt.Errorf("invalid or future onset provided: %v", *p.Onset)
+	}
+	return nil
+}
+
 func (d *DateTime) valid() bool {
 	timeWasProvided := d.Time != nil
 	timeFromNowWasProvided := d.TimeFromNow != nil
@@ -1029,3 +1208,26 @@ func combineErrors(otherErrors ...error) error {
 	}
 	return nil
 }
+
+// validZSegmentFields checks that the given Z-segment fields belong to Z-segments registered with
+// hl7.RegisterSegment, are within their definitions, and set all the required fields of the
+// segments.
+func validZSegmentFields(fields map[string]map[int]string) error {
+	for name, values := range fields {
+		d, ok := hl7.CustomSegment(name)
+		if !ok {
+			return fmt.Errorf("segment %s is not defined", name)
+		}
+		for n := range values {
+			if n > len(d.Fields) {
+				return fmt.Errorf("field %s-%d is not defined; segment %s has %d fields", name, n, name, len(d.Fields))
+			}
+		}
+		for i, f := range d.Fields {
+			if f.Required && values[i+1] == "" {
+				return fmt.Errorf("field %s-%d (%s) is required", name, i+1, f.Name)
+			}
+		}
+	}
+	return nil
+}
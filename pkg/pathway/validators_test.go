@@ -25,6 +25,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/google/simhospital/pkg/constants"
 	"github.com/google/simhospital/pkg/doctor"
+	"github.com/google/simhospital/pkg/hl7"
 	"github.com/google/simhospital/pkg/ir"
 	"github.com/google/simhospital/pkg/orderprofile"
 	"github.com/google/simhospital/pkg/test"
@@ -246,6 +247,150 @@ func TestResultValidReferenceRange(t *testing.T) {
 	}
 }
 
+func TestResultValidTrajectory(t *testing.T) {
+	creatinineVG, err := orderprofile.ValueGeneratorFromRange("49 - 92")
+	if err != nil {
+		t.Fatalf("ValueGeneratorFromRange(%q) failed with %v", "49 - 92", err)
+	}
+	ureaVG, err := orderprofile.ValueGeneratorFromRange("2.5 - 7.8")
+	if err != nil {
+		t.Fatalf("ValueGeneratorFromRange(%q) failed with %v", "2.5 - 7.8", err)
+	}
+	op := orderprofile.New(map[string]*orderprofile.OrderProfile{
+		"UREA AND ELECTROLYTES": {
+			UniversalService: ir.CodedElement{ID: "lpdc-3969", Text: "UREA AND ELECTROLYTES", CodingSystem: "WinPath"},
+			TestTypes: map[string]*orderprofile.TestType{
+				"Creatinine": {
+					Name:           ir.CodedElement{ID: "lpdc-2012", Text: "Creatinine", CodingSystem: "WinPath"},
+					Unit:           "UMOLL",
+					ValueType:      "NM",
+					RefRange:       "49 - 92",
+					ValueGenerator: creatinineVG,
+				},
+				"Urea": {
+					Name:           ir.CodedElement{ID: "lpdc-3001", Text: "Urea", CodingSystem: "WinPath"},
+					Unit:           "MMOLL",
+					ValueType:      "NM",
+					RefRange:       "2.5 - 7.8",
+					ValueGenerator: ureaVG,
+				},
+				"Comment": {
+					Name:      ir.CodedElement{ID: "lpdc-0001", Text: "Comment", CodingSystem: "WinPath"},
+					ValueType: "TX",
+				},
+			},
+		},
+	})
+	f := func(v float64) *float64 { return &v }
+	d := func(v time.Duration) *time.Duration { return &v }
+
+	cases := []struct {
+		name    string
+		r       *Result
+		op      *orderprofile.OrderProfiles
+		wantErr bool
+	}{
+		{
+			name: "valid: rising with target",
+			r:    &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryRising, Target: f(300), Over: d(48 * time.Hour)}},
+			op:   op,
+		}, {
+			name: "valid: rising with target factor and start",
+			r:    &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryRising, Start: f(80), TargetFactor: f(3), Over: d(48 * time.Hour)}},
+			op:   op,
+		}, {
+			name: "valid: peak then recover",
+			r: &Result{TestName: "Creatinine", Trajectory: &Trajectory{
+				Shape: TrajectoryPeakThenRecover, TargetFactor: f(2), Over: d(24 * time.Hour), RecoverOver: d(72 * time.Hour),
+			}},
+			op: op,
+		}, {
+			name: "valid: stable",
+			r:    &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryStable, NoisePercent: f(0)}},
+			op:   op,
+		}, {
+			name: "valid: tracks",
+			r:    &Result{TestName: "Urea", Tracks: &Tracks{TestName: "Creatinine", Factor: 0.8}},
+			op:   op,
+		}, {
+			name:    "invalid: unknown shape",
+			r:       &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: "ZIGZAG"}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: both target and target factor",
+			r:       &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryRising, Target: f(300), TargetFactor: f(3), Over: d(time.Hour)}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: missing over",
+			r:       &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryRising, Target: f(300)}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: falling going up",
+			r:       &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryFalling, TargetFactor: f(2), Over: d(time.Hour)}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: peak without recover over",
+			r:       &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryPeakThenRecover, TargetFactor: f(2), Over: d(time.Hour)}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: value and trajectory",
+			r:       &Result{TestName: "Creatinine", Value: "100", Unit: "UMOLL", Trajectory: &Trajectory{Shape: TrajectoryStable}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name: "invalid: trajectory and tracks",
+			r: &Result{
+				TestName:   "Urea",
+				Trajectory: &Trajectory{Shape: TrajectoryStable},
+				Tracks:     &Tracks{TestName: "Creatinine"},
+			},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: tracks itself",
+			r:       &Result{TestName: "Urea", Tracks: &Tracks{TestName: "Urea"}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: tracks unknown test",
+			r:       &Result{TestName: "Urea", Tracks: &Tracks{TestName: "Potassium"}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: non numerical test type",
+			r:       &Result{TestName: "Comment", Trajectory: &Trajectory{Shape: TrajectoryStable}},
+			op:      op,
+			wantErr: true,
+		}, {
+			name:    "invalid: order profile does not exist",
+			r:       &Result{TestName: "Creatinine", Trajectory: &Trajectory{Shape: TrajectoryStable}},
+			op:      emptyOP,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Pathway{
+				Pathway: []Step{
+					{Result: &Results{OrderProfile: "UREA AND ELECTROLYTES", Results: []*Result{tc.r}}},
+				},
+			}
+			p.Init(pathwayName)
+
+			err := p.Valid(defaultClock, tc.op, emptyDoctors, defaultLocationManager, defaultValid)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("[%+v].Valid(_, %+v, _, _) got err %v; want err? %t", p, tc.op, err, tc.wantErr)
+			}
+		})
+	}
+}
+
 func TestResultValidAbnormalFlag(t *testing.T) {
 	noRefRange := &orderprofile.OrderProfile{
 		UniversalService: ir.CodedElement{ID: "lpdc-3969", Text: "UREA AND ELECTROLYTES", CodingSystem: "WinPath"},
@@ -740,6 +885,13 @@ func TestPathwayValidStep(t *testing.T) {
 		{step: Step{UpdatePerson: &UpdatePerson{Diagnoses: []*DiagnosisOrProcedure{{Code: "RANDOM", DateTime: &DateTime{TimeFromNow: &negative}}}}}},
 		{step: Step{UpdatePerson: &UpdatePerson{Diagnoses: []*DiagnosisOrProcedure{{Code: "RANDOM", DateTime: &DateTime{TimeFromNow: &twoHours}}}}}, wantErr: true},
 		{step: Step{UpdatePerson: &UpdatePerson{Diagnoses: []*DiagnosisOrProcedure{{Description: "RANDOM", Type: "some type"}}}}, wantErr: true},
+		// An UpdatePerson must have valid Problems: at least one from Description or Code; a valid status; optional onset in the past.
+		{step: Step{UpdatePerson: &UpdatePerson{Problems: []*Problem{{Code: "38341003"}}}}},
+		{step: Step{UpdatePerson: &UpdatePerson{Problems: []*Problem{{Description: "Hypertension", Status: "resolved"}}}}},
+		{step: Step{UpdatePerson: &UpdatePerson{Problems: []*Problem{{Code: "38341003", Onset: &DateTime{TimeFromNow: &negative}}}}}},
+		{step: Step{UpdatePerson: &UpdatePerson{Problems: []*Problem{{Status: "active"}}}}, wantErr: true},
+		{step: Step{UpdatePerson: &UpdatePerson{Problems: []*Problem{{Code: "38341003", Status: "cured"}}}}, wantErr: true},
+		{step: Step{UpdatePerson: &UpdatePerson{Problems: []*Problem{{Code: "38341003", Onset: &DateTime{TimeFromNow: &twoHours}}}}}, wantErr: true},
 		// An UpdatePerson must have a valid Procedures: optional DateTime in the past; at least one from: Description or Code.
 		{step: Step{UpdatePerson: &UpdatePerson{Procedures: []*DiagnosisOrProcedure{{Description: "Procedure", DateTime: &DateTime{TimeFromNow: &negative}}}}}},
 		{step: Step{UpdatePerson: &UpdatePerson{Procedures: []*DiagnosisOrProcedure{{Description: "Procedure", DateTime: &DateTime{Time: &fifteenHoursAgo}}}}}},
@@ -822,6 +974,41 @@ func TestPathwayValidStep(t *testing.T) {
 	}
 }
 
+func TestPathwayValidZSegmentFields(t *testing.T) {
+	d := &hl7.SegmentDefinition{
+		Name:   "ZVT",
+		Fields: []hl7.FieldDefinition{{Name: "Set ID", DataType: "SI", Required: true}, {Name: "Code", DataType: "CE"}},
+	}
+	if err := hl7.RegisterSegment(d); err != nil {
+		t.Fatalf("RegisterSegment(%+v) failed with %v", d, err)
+	}
+	defer hl7.UnregisterSegment(d.Name)
+
+	cases := []struct {
+		name    string
+		custom  map[string]string
+		wantErr bool
+	}{
+		{name: "no Z-segment fields", custom: map[string]string{"key": "value", "ZVT": "value", "zvt-1": "value"}},
+		{name: "registered segment", custom: map[string]string{"ZVT-1": "1", "ZVT-2": "CODE^Text"}},
+		{name: "unknown segment", custom: map[string]string{"ZXX-1": "1"}, wantErr: true},
+		{name: "segment defined in code", custom: map[string]string{"ZCM-1": "1"}, wantErr: true},
+		{name: "field beyond the definition", custom: map[string]string{"ZVT-1": "1", "ZVT-3": "1"}, wantErr: true},
+		{name: "missing required field", custom: map[string]string{"ZVT-2": "CODE^Text"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Pathway{Pathway: []Step{{Admission: &Admission{Loc: "ED"}, Parameters: &Parameters{Custom: tc.custom}}}}
+			p.Init(pathwayName)
+
+			err := p.Valid(defaultClock, emptyOP, emptyDoctors, defaultLocationManager, defaultValid)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("[%+v].Valid() got err %v; want err? %t", p, err, tc.wantErr)
+			}
+		})
+	}
+}
+
 func TestPathwayValidPathway(t *testing.T) {
 	twoHoursAgo := -2 * time.Hour
 	oneHourAgo := -time.Hour
@@ -1253,3 +1440,57 @@ func TestPathwayValidConsultant(t *testing.T) {
 		})
 	}
 }
+
+func TestVitalsValid(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	d := func(v time.Duration) *time.Duration { return &v }
+
+	cases := []struct {
+		name    string
+		v       *Vitals
+		wantErr bool
+	}{
+		{name: "valid: empty", v: &Vitals{}},
+		{name: "valid: stable", v: &Vitals{Acuity: AcuityHigh, Trend: VitalsStable}},
+		{name: "valid: deteriorating", v: &Vitals{Acuity: AcuityLow, Trend: VitalsDeteriorating, Over: d(24 * time.Hour)}},
+		{name: "valid: improving", v: &Vitals{Trend: VitalsImproving, Over: d(24 * time.Hour), NoisePercent: f(0)}},
+		{name: "invalid: unknown acuity", v: &Vitals{Acuity: "VERY HIGH"}, wantErr: true},
+		{name: "invalid: unknown trend", v: &Vitals{Trend: "UP"}, wantErr: true},
+		{name: "invalid: deteriorating without over", v: &Vitals{Trend: VitalsDeteriorating}, wantErr: true},
+		{name: "invalid: stable with over", v: &Vitals{Trend: VitalsStable, Over: d(time.Hour)}, wantErr: true},
+		{name: "invalid: negative noise", v: &Vitals{NoisePercent: f(-1)}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.v.valid()
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("[%+v].valid() got err %v; want err? %t", tc.v, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAutoGenerateValidVitals(t *testing.T) {
+	d := func(v time.Duration) *time.Duration { return &v }
+
+	cases := []struct {
+		name    string
+		a       *AutoGenerate
+		wantErr bool
+	}{
+		{name: "valid: vitals", a: &AutoGenerate{Vitals: &Vitals{}, From: d(0), To: d(time.Hour), Every: d(time.Hour)}},
+		{name: "invalid: result and vitals", a: &AutoGenerate{Result: &Results{OrderProfile: "RANDOM"}, Vitals: &Vitals{}, From: d(0), To: d(0)}, wantErr: true},
+		{name: "invalid: invalid vitals", a: &AutoGenerate{Vitals: &Vitals{Trend: "UP"}, From: d(0), To: d(0)}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.a.valid()
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("[%+v].valid() got err %v; want err? %t", tc.a, err, tc.wantErr)
+			}
+			if tc.a.Result != nil && tc.a.Vitals != nil && !tc.wantErr {
+				t.Errorf("[%+v].valid() set both Result and Vitals", tc.a)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package provenance tags the messages that Simulated Hospital generates with the pathway and the
+// step that generated them, so that the messages that downstream systems receive can be traced back
+// to the pathway definitions.
+//
+// Messages can be tagged in two ways, which can be combined: with a Z-segment appended to each
+// message, and with a log that records the provenance of each message by message control ID.
+package provenance
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/google/simhospital/pkg/message"
+)
+
+var log = logging.ForCallerPackage()
+
+// fields are the fields of the provenance segment, in order.
+var fields = []hl7.FieldDefinition{
+	{Name: "Pathway Name", DataType: "ST", Required: true},
+	{Name: "Step Index", DataType: "NM", Required: true},
+	{Name: "Step Type", DataType: "ST", Required: true},
+	{Name: "Run ID", DataType: "ST", Required: true},
+	{Name: "Tags", DataType: "ST", Repeated: true},
+	{Name: "Historical", DataType: "ID"},
+}
+
+// segment is the provenance segment, with the fields in the same order as in fields.
+type segment struct {
+	PathwayName *hl7.ST  `hl7:"true,Pathway Name"`
+	StepIndex   *hl7.NM  `hl7:"true,Step Index"`
+	StepType    *hl7.ST  `hl7:"true,Step Type"`
+	RunID       *hl7.ST  `hl7:"true,Run ID"`
+	Tags        []hl7.ST `hl7:"false,Tags"`
+	Historical  *hl7.ID  `hl7:"false,Historical"`
+}
+
+// SegmentName returns an empty name. The name of the provenance segment is configurable, so the
+// tagger adds it in front of the marshalled segment.
+func (s *segment) SegmentName() string {
+	return ""
+}
+
+// SegmentDefinition returns the definition of the provenance segment with the given name.
+func SegmentDefinition(name string) *hl7.SegmentDefinition {
+	return &hl7.SegmentDefinition{Name: name, Fields: fields}
+}
+
+// Source identifies the step that generated a message.
+type Source struct {
+	PathwayName string `json:"pathway_name"`
+	// StepIndex is the index of the step in the pathway, starting at 0. Historical steps come first.
+	StepIndex  int    `json:"step_index"`
+	StepType   string `json:"step_type"`
+	Historical bool   `json:"historical,omitempty"`
+}
+
+// Record is the provenance of a message, as written to the provenance log.
+type Record struct {
+	// ControlID is the message control ID in MSH-10.
+	ControlID string `json:"control_id"`
+	// MessageType is the message type and trigger event, e.g., "ADT^A01".
+	MessageType string `json:"message_type"`
+	MRN         string `json:"mrn,omitempty"`
+	Source
+	RunID string   `json:"run_id"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// Config configures a Tagger.
+type Config struct {
+	// Segment is the name of the Z-segment with the provenance that is appended to every message,
+	// e.g., ZSH. If empty, the segment is not appended.
+	Segment string
+	// LogFile is the file where the provenance of every message is written, as a line of JSON.
+	// If empty, the provenance is not logged.
+	LogFile string
+	// RunID identifies the run of Simulated Hospital. If empty, a random ID is used.
+	RunID string
+	// Tags describe the scenario being simulated, e.g., "load-test".
+	Tags []string
+}
+
+// Tagger tags messages with their provenance.
+type Tagger struct {
+	segment string
+	runID   string
+	tags    []string
+
+	// mu guards enc.
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewTagger returns a tagger configured with c.
+// If c sets a segment, the segment is registered with hl7.RegisterSegment so that it can be parsed
+// and validated, unless a custom segment with the same name is already registered, e.g., from the
+// Z-segments file.
+func NewTagger(c Config) (*Tagger, error) {
+	t := &Tagger{segment: c.Segment, runID: c.RunID, tags: c.Tags}
+	if t.runID == "" {
+		t.runID = uuid.New().String()
+	}
+	if t.segment != "" {
+		if _, ok := hl7.CustomSegment(t.segment); !ok {
+			if err := hl7.RegisterSegment(SegmentDefinition(t.segment)); err != nil {
+				return nil, errors.Wrapf(err, "cannot register the provenance segment %s", t.segment)
+			}
+		}
+	}
+	if c.LogFile != "" {
+		f, err := os.Create(c.LogFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create the provenance log")
+		}
+		t.f = f
+		t.enc = json.NewEncoder(f)
+	}
+	log.Infof("Tagging messages with the provenance of run %s", t.runID)
+	return t, nil
+}
+
+// RunID returns the ID of the run that messages are tagged with.
+func (t *Tagger) RunID() string {
+	return t.runID
+}
+
+// Tag returns a copy of the message with the provenance segment appended, if the tagger appends one,
+// and writes the provenance of the message to the log, if the tagger has one.
+// mrn is the MRN of the patient of the message. If the message cannot be parsed to append the
+// segment, Tag returns the message untagged and an error. If the provenance cannot be logged, Tag
+// returns the tagged message and an error.
+func (t *Tagger) Tag(msg *message.HL7Message, mrn string, s Source) (*message.HL7Message, error) {
+	if t.segment == "" {
+		return msg, t.Log(msg, mrn, s)
+	}
+	seg, controlID, err := t.buildSegment(msg.Message, s)
+	if err != nil {
+		return msg, errors.Wrapf(err, "cannot tag message %s", message.ControlID(msg.Message))
+	}
+	tagged := *msg
+	tagged.Message = strings.Join([]string{msg.Message, seg}, message.SegmentTerminator)
+	return &tagged, t.log(msg, controlID, mrn, s)
+}
+
+// Log writes the provenance of the message to the log, if the tagger has one, without appending the
+// provenance segment. It is meant for the messages that must be sent as they are.
+// mrn is the MRN of the patient of the message.
+func (t *Tagger) Log(msg *message.HL7Message, mrn string, s Source) error {
+	return t.log(msg, message.ControlID(msg.Message), mrn, s)
+}
+
+// log writes the provenance of the message with the given control ID to the log, if the tagger has
+// one.
+func (t *Tagger) log(msg *message.HL7Message, controlID string, mrn string, s Source) error {
+	if t.enc == nil {
+		return nil
+	}
+	r := Record{
+		ControlID: controlID,
+		MRN:       mrn,
+		Source:    s,
+		RunID:     t.runID,
+		Tags:      t.tags,
+	}
+	if msg.Type != nil {
+		r.MessageType = msg.Type.MessageType + "^" + msg.Type.TriggerEvent
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.enc.Encode(r); err != nil {
+		return errors.Wrapf(err, "cannot log the provenance of message %s", r.ControlID)
+	}
+	return nil
+}
+
+// Close closes the log, if any.
+func (t *Tagger) Close() error {
+	if t.f == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+// buildSegment returns the provenance segment for a message, with the delimiters of the message, and
+// the message control ID in MSH-10 of the message.
+func (t *Tagger) buildSegment(msg string, s Source) (string, string, error) {
+	m, err := hl7.ParseMessageWithOptions([]byte(msg), hl7.NewParseMessageOptions())
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot parse the message")
+	}
+	msh, err := m.MSH()
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot parse the MSH segment")
+	}
+	if msh == nil {
+		return "", "", errors.New("the message does not have an MSH segment")
+	}
+	seg := &segment{
+		PathwayName: hl7.NewST(hl7.ST(s.PathwayName)),
+		StepIndex:   hl7.NewNM(float64(s.StepIndex)),
+		StepType:    hl7.NewST(hl7.ST(s.StepType)),
+		RunID:       hl7.NewST(hl7.ST(t.runID)),
+		Historical:  hl7.NewID("N"),
+	}
+	for _, tag := range t.tags {
+		seg.Tags = append(seg.Tags, hl7.ST(tag))
+	}
+	if s.Historical {
+		seg.Historical = hl7.NewID("Y")
+	}
+	b, err := hl7.MarshalSegment(seg, m.Context)
+	if err != nil {
+		return "", "", errors.Wrap(err, "cannot marshal the provenance segment")
+	}
+	return t.segment + string(b), msh.MessageControlID.String(), nil
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provenance
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/test/testwrite"
+)
+
+var (
+	msh = `MSH|^~\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT^A01|1|T|2.3`
+	pid = "PID|1"
+	msg = &message.HL7Message{
+		Type:    &message.Type{MessageType: "ADT", TriggerEvent: "A01"},
+		Message: strings.Join([]string{msh, pid}, message.SegmentTerminator),
+	}
+	source = Source{PathwayName: "admission|discharge", StepIndex: 2, StepType: "admission"}
+)
+
+func TestMain(m *testing.M) {
+	hl7.TimezoneAndLocation("UTC")
+	os.Exit(m.Run())
+}
+
+func TestTagger_Segment(t *testing.T) {
+	tagger, err := NewTagger(Config{Segment: "ZSH", RunID: "run-1", Tags: []string{"load", "a^b"}})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	defer tagger.Close()
+
+	got, err := tagger.Tag(msg, "1234", source)
+	if err != nil {
+		t.Fatalf("Tag() failed with %v", err)
+	}
+	want := strings.Join([]string{msh, pid, `ZSH|admission\F\discharge|2|admission|run-1|load~a\S\b|N`}, message.SegmentTerminator)
+	if diff := cmp.Diff(want, got.Message); diff != "" {
+		t.Errorf("Tag() got diff (-want +got):\n%s", diff)
+	}
+	if got.Type != msg.Type {
+		t.Errorf("Tag().Type got %v, want %v", got.Type, msg.Type)
+	}
+	if strings.Contains(msg.Message, "ZSH") {
+		t.Errorf("Tag() modified the original message: %q", msg.Message)
+	}
+
+	parsed, err := hl7.ParseMessage([]byte(got.Message))
+	if err != nil {
+		t.Fatalf("ParseMessage(%q) failed with %v", got.Message, err)
+	}
+	for _, i := range hl7.Validate(parsed, nil) {
+		if strings.HasPrefix(i.Location, "ZSH") {
+			t.Errorf("Validate(%q) got issue %v in the provenance segment, want none", got.Message, i)
+		}
+	}
+	zsh, err := parsed.Parse("ZSH")
+	if err != nil {
+		t.Fatalf("Parse(ZSH) failed with %v", err)
+	}
+	pathwayName := reflect.ValueOf(zsh).Elem().Field(0).Interface().(*hl7.ST)
+	if got, want := string(*pathwayName), source.PathwayName; got != want {
+		t.Errorf("ZSH-1 got %q, want %q", got, want)
+	}
+}
+
+func TestTagger_Segment_MessageDelimiters(t *testing.T) {
+	tagger, err := NewTagger(Config{Segment: "ZSH", RunID: "run-1", Tags: []string{"a^b$c", "d"}})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	defer tagger.Close()
+
+	// The message uses $ as the component separator and # as the repetition separator.
+	m := &message.HL7Message{Message: strings.Join([]string{`MSH|$#\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||ADT$A01|1|T|2.3`, pid}, message.SegmentTerminator)}
+	got, err := tagger.Tag(m, "1234", source)
+	if err != nil {
+		t.Fatalf("Tag() failed with %v", err)
+	}
+	want := strings.Join([]string{m.Message, `ZSH|admission\F\discharge|2|admission|run-1|a^b\S\c#d|N`}, message.SegmentTerminator)
+	if diff := cmp.Diff(want, got.Message); diff != "" {
+		t.Errorf("Tag() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestTagger_Segment_InvalidMessage(t *testing.T) {
+	tagger, err := NewTagger(Config{Segment: "ZSH", RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	defer tagger.Close()
+
+	m := &message.HL7Message{Message: "not a message"}
+	got, err := tagger.Tag(m, "1234", source)
+	if err == nil {
+		t.Errorf("Tag(%q) got nil error, want error", m.Message)
+	}
+	if diff := cmp.Diff(m, got); diff != "" {
+		t.Errorf("Tag(%q) got diff (-want +got):\n%s", m.Message, diff)
+	}
+}
+
+func TestTagger_Log(t *testing.T) {
+	file := filepath.Join(testwrite.TempDir(t), "provenance.jsonl")
+	tagger, err := NewTagger(Config{LogFile: file, RunID: "run-1", Tags: []string{"load"}})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	got, err := tagger.Tag(msg, "1234", source)
+	if err != nil {
+		t.Fatalf("Tag() failed with %v", err)
+	}
+	if diff := cmp.Diff(msg, got); diff != "" {
+		t.Errorf("Tag() without segment got diff (-want +got):\n%s", diff)
+	}
+	historical := Source{PathwayName: "admission|discharge", StepIndex: 0, StepType: "admission", Historical: true}
+	if _, err := tagger.Tag(msg, "1234", historical); err != nil {
+		t.Fatalf("Tag() failed with %v", err)
+	}
+	if err := tagger.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("os.Open(%q) failed with %v", file, err)
+	}
+	defer f.Close()
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	want := []Record{{
+		ControlID:   "1",
+		MessageType: "ADT^A01",
+		MRN:         "1234",
+		Source:      source,
+		RunID:       "run-1",
+		Tags:        []string{"load"},
+	}, {
+		ControlID:   "1",
+		MessageType: "ADT^A01",
+		MRN:         "1234",
+		Source:      historical,
+		RunID:       "run-1",
+		Tags:        []string{"load"},
+	}}
+	if diff := cmp.Diff(want, records); diff != "" {
+		t.Errorf("provenance log got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestTagger_LogOnly(t *testing.T) {
+	file := filepath.Join(testwrite.TempDir(t), "provenance.jsonl")
+	tagger, err := NewTagger(Config{Segment: "ZSH", LogFile: file, RunID: "run-1"})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	// Log does not parse the message, so it logs the provenance of messages that cannot be tagged.
+	m := &message.HL7Message{Message: "MSH#^~\\&#SIMHOSP#SFAC#RAPP#RFAC#20200101000000##ADT^A01#1|2", Type: msg.Type}
+	if err := tagger.Log(m, "1234", source); err != nil {
+		t.Fatalf("Log() failed with %v", err)
+	}
+	if err := tagger.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ReadFile(%q) failed with %v", file, err)
+	}
+	var got Record
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed with %v", b, err)
+	}
+	want := Record{ControlID: "1|2", MessageType: "ADT^A01", MRN: "1234", Source: source, RunID: "run-1"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("provenance log got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewTagger_RandomRunID(t *testing.T) {
+	t1, err := NewTagger(Config{})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	t2, err := NewTagger(Config{})
+	if err != nil {
+		t.Fatalf("NewTagger() failed with %v", err)
+	}
+	if t1.RunID() == "" || t1.RunID() == t2.RunID() {
+		t.Errorf("RunID() got %q and %q, want two different non-empty IDs", t1.RunID(), t2.RunID())
+	}
+}
+
+func TestNewTagger_InvalidSegment(t *testing.T) {
+	for _, segment := range []string{"XSH", "ZCM"} {
+		t.Run(segment, func(t *testing.T) {
+			if _, err := NewTagger(Config{Segment: segment}); err == nil {
+				t.Errorf("NewTagger(Segment: %q) got nil error, want error", segment)
+			}
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/simhospital/pkg/logging"
@@ -30,6 +31,8 @@ var log = logging.ForCallerPackage()
 
 // Controller is a rate controller.
 type Controller struct {
+	// mu guards rate, which is read and written from different goroutines.
+	mu          sync.Mutex
 	rate        float64
 	per         time.Duration
 	rateChanged chan bool
@@ -37,10 +40,12 @@ type Controller struct {
 
 // NewController creates a new Controller.
 func NewController(rate float64, per time.Duration) *Controller {
+	// The rateChanged channel is buffered so that setting the rate doesn't block if nobody is
+	// waiting for changes; a pending notification is enough to signal any number of changes.
 	return &Controller{
 		rate:        rate,
 		per:         per,
-		rateChanged: make(chan bool),
+		rateChanged: make(chan bool, 1),
 	}
 }
 
@@ -48,7 +53,7 @@ func NewController(rate float64, per time.Duration) *Controller {
 func (c *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		s := strconv.FormatFloat(c.rate, 'f', -1, 64)
+		s := strconv.FormatFloat(c.Rate(), 'f', -1, 64)
 		w.Write([]byte(s))
 	case "POST":
 		c.handlePost(w, r)
@@ -84,33 +89,55 @@ func (c *Controller) handlePost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error parsing value to float", http.StatusInternalServerError)
 		return
 	}
-	if f < 0 {
-		msg := fmt.Sprintf("Invalid value: rate per minute must be greater that zero, but was: %v", f)
-		log.Warningf("%s: %s", errStr, msg)
-		http.Error(w, msg, http.StatusInternalServerError)
+	if err := c.SetRate(f); err != nil {
+		log.Warningf("%s: %v", errStr, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// Rate returns the current rate.
+func (c *Controller) Rate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate
+}
+
+// SetRate sets the rate to the given value, and notifies the RateChanged channel if the value
+// changed. It returns an error if the rate is negative.
+func (c *Controller) SetRate(rate float64) error {
+	if rate < 0 {
+		return fmt.Errorf("Invalid value: rate per minute must be greater that zero, but was: %v", rate)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	// Sometimes we get a POST message even if the value didn't change.
-	if c.rate != f {
-		c.rate = f
-		c.rateChanged <- true
+	if c.rate != rate {
+		c.rate = rate
+		select {
+		case c.rateChanged <- true:
+		default:
+			// There is a notification pending already.
+		}
 	}
+	return nil
 }
 
-func (c *Controller) heartbeat() time.Duration {
-	return time.Duration(float64(c.per) / c.rate)
+func (c *Controller) heartbeat(rate float64) time.Duration {
+	return time.Duration(float64(c.per) / rate)
 }
 
 // Heartbeat returns a duration between two pathways based on rate and per values.
 // If the rate is set to zero, returns the maximum duration value.
 func (c *Controller) Heartbeat() time.Duration {
-	if c.rate == 0 {
-		log.Infof("Rate set to %v / %v. Not generating pathway", c.rate, c.per)
+	rate := c.Rate()
+	if rate == 0 {
+		log.Infof("Rate set to %v / %v. Not generating pathway", rate, c.per)
 		// Max Duration value.
 		return time.Duration(1<<63 - 1)
 	}
-	h := c.heartbeat()
-	log.Debugf("Rate set to %v / %v. Generating one pathway every %v", c.rate, c.per, h)
+	h := c.heartbeat(rate)
+	log.Debugf("Rate set to %v / %v. Generating one pathway every %v", rate, c.per, h)
 	return h
 }
 
@@ -122,8 +149,8 @@ func (c *Controller) RateChanged() <-chan bool {
 // InitialElapsed returns a value of the heartbeat, if the rate is not zero.
 // Otherwise, returns zero.
 func (c *Controller) InitialElapsed() time.Duration {
-	if c.rate > 0 {
-		return c.heartbeat()
+	if rate := c.Rate(); rate > 0 {
+		return c.heartbeat(rate)
 	}
 	return 0
 }
@@ -216,3 +216,33 @@ func TestMessageRateHandlerPOSTError(t *testing.T) {
 		})
 	}
 }
+
+func TestSetRate(t *testing.T) {
+	c := NewController(1, time.Hour)
+
+	if err := c.SetRate(3); err != nil {
+		t.Fatalf("c.SetRate(3) failed with %v", err)
+	}
+	// Setting the rate again before the change is received doesn't block.
+	if err := c.SetRate(4); err != nil {
+		t.Fatalf("c.SetRate(4) failed with %v", err)
+	}
+	select {
+	case got := <-c.RateChanged():
+		if !got {
+			t.Errorf("c.RateChanged() got %v; want true", got)
+		}
+	default:
+		t.Error("c.RateChanged() returned no value")
+	}
+	if got, want := c.Rate(), 4.0; got != want {
+		t.Errorf("c.Rate() got %v; want %v", got, want)
+	}
+
+	if err := c.SetRate(-1); err == nil {
+		t.Error("c.SetRate(-1) got err=<nil>, want error")
+	}
+	if got, want := c.Rate(), 4.0; got != want {
+		t.Errorf("c.Rate() got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replay re-sends the messages recorded by a recording sender, see hl7.NewRecordingSender,
+// keeping the time between them.
+package replay
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/ir"
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/google/simhospital/pkg/message"
+)
+
+var log = logging.ForCallerPackage()
+
+// maxControlIDLength is the maximum length of the message control ID in MSH-10.
+const maxControlIDLength = 20
+
+// Options configures how messages are replayed.
+type Options struct {
+	// Speed is how much faster than in the recording messages are replayed, e.g., 2 replays a
+	// recording of an hour in 30 minutes. If zero or negative, messages are replayed without waiting.
+	Speed float64
+	// MessageTypes are the types of the messages to replay, either a message type, e.g., "ADT", or a
+	// message type and trigger event, e.g., "ADT^A01". If empty, messages of all types are replayed.
+	MessageTypes []string
+	// MRNs are the MRNs of the patients whose messages are replayed, as found in PID-3 and MRG-1.
+	// If empty, messages of all patients are replayed.
+	MRNs []string
+	// RegenerateHeader is whether to set MSH-7 to the time when messages are replayed, and to prefix
+	// MSH-10 with ControlIDPrefix, so that the control IDs of the replayed messages don't collide
+	// with the ones of the recording.
+	RegenerateHeader bool
+	// ControlIDPrefix is the prefix of the new control IDs; only relevant if RegenerateHeader is true.
+	ControlIDPrefix string
+}
+
+// Replayer replays recorded messages.
+type Replayer struct {
+	sender  hl7.Sender
+	options Options
+	now     func() time.Time
+	sleep   func(context.Context, time.Duration) error
+}
+
+// New returns a replayer that replays messages with the given sender.
+func New(sender hl7.Sender, options Options) (*Replayer, error) {
+	if options.RegenerateHeader && options.ControlIDPrefix == "" {
+		return nil, errors.New("the control ID prefix must be set to regenerate headers")
+	}
+	if options.RegenerateHeader && len(options.ControlIDPrefix) >= maxControlIDLength {
+		return nil, errors.Errorf("the control ID prefix %q must be shorter than %d characters", options.ControlIDPrefix, maxControlIDLength)
+	}
+	return &Replayer{sender: sender, options: options, now: time.Now, sleep: sleep}, nil
+}
+
+// Replay sends the messages that match the options in order. The first message is sent straight
+// away, and the others at the same time relative to the first one as in the recording, divided by
+// the speed. Messages that cannot be parsed to check whether they match the options are skipped.
+// Replay returns the number of messages sent, and stops at the first message that cannot be sent or
+// when ctx is done.
+func (r *Replayer) Replay(ctx context.Context, messages []hl7.RecordedMessage) (int, error) {
+	var start, first time.Time
+	sent := 0
+	for i, m := range messages {
+		ok, err := r.matches(m.Message)
+		if err != nil {
+			log.WithError(err).Warningf("Skipping message %d, which cannot be parsed", i)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		var wait time.Duration
+		if sent == 0 {
+			start, first = r.now(), m.Time
+		} else if r.options.Speed > 0 {
+			due := start.Add(time.Duration(float64(m.Time.Sub(first)) / r.options.Speed))
+			wait = due.Sub(r.now())
+		}
+		if err := r.sleep(ctx, wait); err != nil {
+			return sent, err
+		}
+		msg := m.Message
+		if r.options.RegenerateHeader {
+			if msg, err = r.regenerateHeader(msg); err != nil {
+				return sent, errors.Wrapf(err, "message %d", i)
+			}
+		}
+		if err := r.sender.Send([]byte(msg)); err != nil {
+			return sent, errors.Wrapf(err, "cannot send message %d", i)
+		}
+		sent++
+	}
+	log.Infof("Replayed %d of %d messages", sent, len(messages))
+	return sent, nil
+}
+
+// matches returns whether the message matches the message types and MRNs of the options.
+func (r *Replayer) matches(msg string) (bool, error) {
+	if len(r.options.MessageTypes) == 0 && len(r.options.MRNs) == 0 {
+		return true, nil
+	}
+	ids, err := message.ParseIdentifiers(msg)
+	if err != nil {
+		return false, err
+	}
+	if len(r.options.MRNs) > 0 && !ids.HasMRN(r.options.MRNs...) {
+		return false, nil
+	}
+	if len(r.options.MessageTypes) == 0 {
+		return true, nil
+	}
+	code := strings.SplitN(ids.MessageType, "^", 2)[0]
+	for _, t := range r.options.MessageTypes {
+		if t == code || t == ids.MessageType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// regenerateHeader sets MSH-7 to now, and prefixes MSH-10 with the control ID prefix. The MSH segment
+// is split with the delimiters of the message.
+func (r *Replayer) regenerateHeader(msg string) (string, error) {
+	d, ok := message.Delimiters(msg)
+	if !ok {
+		return "", errors.New("the message does not start with an MSH segment")
+	}
+	end := strings.IndexAny(msg, "\r\n")
+	if end < 0 {
+		end = len(msg)
+	}
+	fields := strings.Split(msg[:end], string(d.Field))
+	if len(fields) < 10 {
+		return "", errors.New("the MSH segment does not have a control ID")
+	}
+	now, err := message.ToHL7Date(ir.NewValidTime(r.now().UTC()))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot format the message time")
+	}
+	controlID := r.options.ControlIDPrefix + fields[9]
+	if len(controlID) > maxControlIDLength {
+		return "", errors.Errorf("the control ID %q is longer than %d characters; use a shorter prefix", controlID, maxControlIDLength)
+	}
+	// MSH-1 is the field separator, so MSH-n is the field n-1 of the segment.
+	fields[6] = now
+	fields[9] = controlID
+	return strings.Join(fields, string(d.Field)) + msg[end:], nil
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
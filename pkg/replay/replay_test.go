@@ -0,0 +1,263 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/simhospital/pkg/hl7"
+	"github.com/google/simhospital/pkg/message"
+	"github.com/google/simhospital/pkg/test/testhl7"
+)
+
+var (
+	recorded = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	replayed = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	a01 = testMessage("ADT^A01", "1", "PID|1||1111^^^SIMULATOR MRN^MRN")
+	r01 = testMessage("ORU^R01", "2", "PID|1||1111^^^SIMULATOR MRN^MRN")
+	a03 = testMessage("ADT^A03", "3", "PID|1||2222^^^SIMULATOR MRN^MRN")
+	a34 = testMessage("ADT^A34", "4", "PID|1||3333^^^SIMULATOR MRN^MRN", "MRG|2222^^^SIMULATOR MRN^MRN")
+
+	recording = []hl7.RecordedMessage{
+		{Time: recorded, Message: a01},
+		{Time: recorded.Add(time.Minute), Message: r01},
+		{Time: recorded.Add(3 * time.Minute), Message: a03},
+		{Time: recorded.Add(7 * time.Minute), Message: a34},
+	}
+)
+
+func TestMain(m *testing.M) {
+	hl7.TimezoneAndLocation("UTC")
+	os.Exit(m.Run())
+}
+
+func testMessage(messageType, controlID string, segments ...string) string {
+	msh := "MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20200101000000||" + messageType + "|" + controlID + "|T|2.3"
+	return strings.Join(append([]string{msh}, segments...), message.SegmentTerminator)
+}
+
+// newTestReplayer returns a replayer with a clock that only advances when the replayer sleeps, and
+// the list of the times at which the messages were sent, relative to the start of the replay.
+func newTestReplayer(t *testing.T, sender hl7.Sender, options Options) (*Replayer, *[]time.Duration) {
+	t.Helper()
+	r, err := New(sender, options)
+	if err != nil {
+		t.Fatalf("New(%+v) failed with %v", options, err)
+	}
+	now := replayed
+	var times []time.Duration
+	r.now = func() time.Time { return now }
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		if d > 0 {
+			now = now.Add(d)
+		}
+		times = append(times, now.Sub(replayed))
+		return nil
+	}
+	return r, &times
+}
+
+func TestReplay_Timing(t *testing.T) {
+	cases := []struct {
+		name  string
+		speed float64
+		want  []time.Duration
+	}{{
+		name:  "original speed",
+		speed: 1,
+		want:  []time.Duration{0, time.Minute, 3 * time.Minute, 7 * time.Minute},
+	}, {
+		name:  "twice as fast",
+		speed: 2,
+		want:  []time.Duration{0, 30 * time.Second, 90 * time.Second, 210 * time.Second},
+	}, {
+		name:  "no waiting",
+		speed: 0,
+		want:  []time.Duration{0, 0, 0, 0},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &testhl7.Sender{}
+			r, times := newTestReplayer(t, sender, Options{Speed: tc.speed})
+			sent, err := r.Replay(context.Background(), recording)
+			if err != nil {
+				t.Fatalf("Replay() failed with %v", err)
+			}
+			if got, want := sent, len(recording); got != want {
+				t.Errorf("Replay() got %d messages sent, want %d", got, want)
+			}
+			if diff := cmp.Diff(tc.want, *times); diff != "" {
+				t.Errorf("Replay() send times got diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]string{a01, r01, a03, a34}, sender.GetSentMessages()); diff != "" {
+				t.Errorf("Replay() sent messages got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReplay_Filter(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		want    []string
+		// wantTimes are the times at which the messages are sent, relative to the first one.
+		wantTimes []time.Duration
+	}{{
+		name:      "message type",
+		options:   Options{MessageTypes: []string{"ADT"}},
+		want:      []string{a01, a03, a34},
+		wantTimes: []time.Duration{0, 3 * time.Minute, 7 * time.Minute},
+	}, {
+		name:      "message type and trigger event",
+		options:   Options{MessageTypes: []string{"ADT^A03", "ORU^R01"}},
+		want:      []string{r01, a03},
+		wantTimes: []time.Duration{0, 2 * time.Minute},
+	}, {
+		name:      "MRN in PID and MRG",
+		options:   Options{MRNs: []string{"2222"}},
+		want:      []string{a03, a34},
+		wantTimes: []time.Duration{0, 4 * time.Minute},
+	}, {
+		name:      "message type and MRN",
+		options:   Options{MessageTypes: []string{"ADT^A01", "ADT^A03"}, MRNs: []string{"1111"}},
+		want:      []string{a01},
+		wantTimes: []time.Duration{0},
+	}, {
+		name:    "no matches",
+		options: Options{MRNs: []string{"4444"}},
+	}}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &testhl7.Sender{}
+			tc.options.Speed = 1
+			r, times := newTestReplayer(t, sender, tc.options)
+			if _, err := r.Replay(context.Background(), recording); err != nil {
+				t.Fatalf("Replay() failed with %v", err)
+			}
+			if diff := cmp.Diff(tc.want, sender.GetSentMessages()); diff != "" {
+				t.Errorf("Replay() sent messages got diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantTimes, *times); diff != "" {
+				t.Errorf("Replay() send times got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReplay_Filter_SkipsInvalidMessages(t *testing.T) {
+	sender := &testhl7.Sender{}
+	r, _ := newTestReplayer(t, sender, Options{MessageTypes: []string{"ADT"}})
+	invalid := "not an HL7 message"
+	if _, err := r.matches(invalid); err == nil {
+		t.Fatalf("matches(%q) got nil error, want error", invalid)
+	}
+	messages := []hl7.RecordedMessage{
+		{Time: recorded, Message: invalid},
+		{Time: recorded.Add(time.Minute), Message: a01},
+	}
+	sent, err := r.Replay(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("Replay() failed with %v", err)
+	}
+	if got, want := sent, 1; got != want {
+		t.Errorf("Replay() got %d messages sent, want %d", got, want)
+	}
+	if diff := cmp.Diff([]string{a01}, sender.GetSentMessages()); diff != "" {
+		t.Errorf("Replay() sent messages got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplay_RegenerateHeader(t *testing.T) {
+	sender := &testhl7.Sender{}
+	r, _ := newTestReplayer(t, sender, Options{Speed: 1, RegenerateHeader: true, ControlIDPrefix: "R1-"})
+	if _, err := r.Replay(context.Background(), recording[:2]); err != nil {
+		t.Fatalf("Replay() failed with %v", err)
+	}
+	want := []string{
+		strings.Join([]string{"MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20230601120000||ADT^A01|R1-1|T|2.3", "PID|1||1111^^^SIMULATOR MRN^MRN"}, message.SegmentTerminator),
+		strings.Join([]string{"MSH|^~\\&|SIMHOSP|SFAC|RAPP|RFAC|20230601120100||ORU^R01|R1-2|T|2.3", "PID|1||1111^^^SIMULATOR MRN^MRN"}, message.SegmentTerminator),
+	}
+	if diff := cmp.Diff(want, sender.GetSentMessages()); diff != "" {
+		t.Errorf("Replay() sent messages got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplay_RegenerateHeader_CustomDelimiters(t *testing.T) {
+	sender := &testhl7.Sender{}
+	r, _ := newTestReplayer(t, sender, Options{RegenerateHeader: true, ControlIDPrefix: "R1-"})
+	msg := strings.Join([]string{"MSH#^~\\&#SIMHOSP#SFAC#RAPP#RFAC#20200101000000##ADT^A01#1|2#T#2.3", "PID#1##1111"}, message.SegmentTerminator)
+	if _, err := r.Replay(context.Background(), []hl7.RecordedMessage{{Time: recorded, Message: msg}}); err != nil {
+		t.Fatalf("Replay() failed with %v", err)
+	}
+	want := []string{strings.Join([]string{"MSH#^~\\&#SIMHOSP#SFAC#RAPP#RFAC#20230601120000##ADT^A01#R1-1|2#T#2.3", "PID#1##1111"}, message.SegmentTerminator)}
+	if diff := cmp.Diff(want, sender.GetSentMessages()); diff != "" {
+		t.Errorf("Replay() sent messages got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestReplay_Errors(t *testing.T) {
+	t.Run("send", func(t *testing.T) {
+		r, _ := newTestReplayer(t, testhl7.SenderWithError(errors.New("cannot send")), Options{})
+		if _, err := r.Replay(context.Background(), recording); err == nil {
+			t.Error("Replay() got nil error, want error")
+		}
+	})
+	t.Run("no MSH", func(t *testing.T) {
+		r, _ := newTestReplayer(t, &testhl7.Sender{}, Options{RegenerateHeader: true, ControlIDPrefix: "R1-"})
+		invalid := []hl7.RecordedMessage{{Time: recorded, Message: "PID|1||1111"}}
+		if _, err := r.Replay(context.Background(), invalid); err == nil {
+			t.Error("Replay() got nil error, want error")
+		}
+	})
+	t.Run("control ID too long", func(t *testing.T) {
+		r, _ := newTestReplayer(t, &testhl7.Sender{}, Options{RegenerateHeader: true, ControlIDPrefix: "R1234567890123456-"})
+		long := []hl7.RecordedMessage{{Time: recorded, Message: testMessage("ADT^A01", "12345")}}
+		if sent, err := r.Replay(context.Background(), long); err == nil || sent != 0 {
+			t.Errorf("Replay() got (%d, %v), want (0, error)", sent, err)
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r, err := New(&testhl7.Sender{}, Options{Speed: 1})
+		if err != nil {
+			t.Fatalf("New() failed with %v", err)
+		}
+		if sent, err := r.Replay(ctx, recording); err == nil || sent != 0 {
+			t.Errorf("Replay() got (%d, %v), want (0, error)", sent, err)
+		}
+	})
+}
+
+func TestNew_MissingControlIDPrefix(t *testing.T) {
+	if _, err := New(&testhl7.Sender{}, Options{RegenerateHeader: true}); err == nil {
+		t.Error("New(RegenerateHeader: true) got nil error, want error")
+	}
+}
+
+func TestNew_LongControlIDPrefix(t *testing.T) {
+	prefix := strings.Repeat("R", maxControlIDLength)
+	if _, err := New(&testhl7.Sender{}, Options{RegenerateHeader: true, ControlIDPrefix: prefix}); err == nil {
+		t.Errorf("New(ControlIDPrefix: %q) got nil error, want error", prefix)
+	}
+}
@@ -17,6 +17,7 @@ package starter
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"regexp"
@@ -104,13 +105,6 @@ func (ps *PathwayStarter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// parseBytesAsHL7 parses the given bytes as a HL7 message.
-// parseBytesAsHL7 returns an error if the message is not parsable.
-func parseBytesAsHL7(b []byte) error {
-	_, err := hl7.ParseMessage(b)
-	return errors.Wrap(err, "cannot parse message")
-}
-
 // sendMessages sends the HL7 messages contained in the given text.
 // The format of the text needs to be as follows: (1) the text needs to start with "MSH", and
 // (2) every message is separated by the previous one by one or more empty lines.
@@ -121,16 +115,19 @@ func (ps *PathwayStarter) sendMessages(text string) ([]string, error) {
 	// The error is capitalized because it is displayed in the UI.
 	errStr := "Error sending messages: %v. Number of messages successfully sent: %d"
 	count := 0
-	for _, section := range strings.Split(text, "\n\n") {
-		if section == "" {
-			continue
+	r := hl7.NewReader(strings.NewReader(text), &hl7.ReaderOptions{Framing: hl7.FramingText})
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			break
 		}
-		m := strings.Replace(section, "\n", hl7.SegmentTerminatorStr, -1)
-		b := []byte(m)
-		if err := parseBytesAsHL7(b); err != nil {
-			return nil, fmt.Errorf(errStr, err, count)
+		if err != nil {
+			return nil, fmt.Errorf(errStr, errors.Wrap(err, "cannot read message"), count)
+		}
+		if m.Err != nil {
+			return nil, fmt.Errorf(errStr, errors.Wrap(m.Err, "cannot parse message"), count)
 		}
-		if err := ps.Sender.Send(b); err != nil {
+		if err := ps.Sender.Send(m.Raw); err != nil {
 			return nil, fmt.Errorf(errStr, err, count)
 		}
 		count++
@@ -165,6 +162,69 @@ func (ps *PathwayStarter) requestPathwayOrSendMessage(text string) ([]string, er
 		pathwayName, firstName, lastName := groups[1], groups[2], groups[3]
 		return ps.startPathwayWithPatient(pathwayName, &[2]string{firstName, lastName})
 	}
+	p, err := ps.parsePathway(text)
+	if err != nil {
+		return nil, err
+	}
+	return ps.startPathwayInHospital(p)
+}
+
+// PathwayRequest is a request to start a pathway.
+type PathwayRequest struct {
+	// Name is the name of a pathway known by the pathway manager.
+	// Exactly one of Name and Definition must be set.
+	Name string
+	// Definition is a pathway in YAML format as in the pathway config files.
+	Definition string
+	// MRN is the MRN of the patient to start the pathway for. If a patient with this MRN exists,
+	// the pathway is started for the existing patient. Optional.
+	MRN string
+	// FirstName and Surname are the names of the patient to start the pathway for. Optional, and
+	// ignored if MRN is set.
+	FirstName string
+	Surname   string
+}
+
+// StartPathway starts the pathway in the given request.
+// It returns the name of the pathway and the persons the pathway was started for, or an error.
+func (ps *PathwayStarter) StartPathway(r PathwayRequest) (string, []*ir.Person, error) {
+	var p *pathway.Pathway
+	var err error
+	switch {
+	case r.Name != "" && r.Definition != "":
+		return "", nil, errors.New("only one of the pathway name and the pathway definition can be set")
+	case r.Name != "":
+		p, err = ps.PathwayManager.GetPathway(r.Name)
+		if err != nil {
+			return "", nil, fmt.Errorf("pathway %q is not defined", r.Name)
+		}
+	case r.Definition != "":
+		p, err = ps.parsePathway(r.Definition)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, errors.New("either the pathway name or the pathway definition must be set")
+	}
+	switch {
+	case r.MRN != "":
+		err = ps.setMRN(p, r.MRN)
+	case r.FirstName != "" || r.Surname != "":
+		err = setPatient(p, &[2]string{r.FirstName, r.Surname})
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	persons, err := ps.Hospital.StartPathway(p)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot start pathway %v: %v", p.Name(), err)
+	}
+	return p.Name(), persons, nil
+}
+
+// parsePathway parses a pathway in YAML format, with or without the pathway name.
+// Pathways without a name are named DefaultPathwayNameFromUI.
+func (ps *PathwayStarter) parsePathway(text string) (*pathway.Pathway, error) {
 	p, err := ps.Parser.ParseSinglePathway([]byte(text))
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse pathway: %v", err)
@@ -172,8 +232,7 @@ func (ps *PathwayStarter) requestPathwayOrSendMessage(text string) ([]string, er
 	if p.Name() == pathway.UnknownPathwayName {
 		p.UpdateName(DefaultPathwayNameFromUI)
 	}
-
-	return ps.startPathwayInHospital(&p)
+	return &p, nil
 }
 
 // startPathwayWithMRN starts the given pathway name for a patient with the given MRN.
@@ -190,18 +249,26 @@ func (ps *PathwayStarter) startPathwayWithMRN(pathwayName string, mrn string) ([
 	if err != nil {
 		return nil, fmt.Errorf("pathway %q is not defined", pathwayName)
 	}
+	if err := ps.setMRN(p, mrn); err != nil {
+		return nil, err
+	}
+	return ps.startPathwayInHospital(p)
+}
 
+// setMRN sets the MRN of the only person in the given pathway.
+// It returns an error if the pathway refers to more than one person.
+func (ps *PathwayStarter) setMRN(p *pathway.Pathway, mrn string) error {
 	if !p.Persons.HasOnePerson() {
-		return nil, fmt.Errorf("pathway %q cannot be started with a single patient as it refers to more than one patient", pathwayName)
+		return fmt.Errorf("pathway %q cannot be started with a single patient as it refers to more than one patient", p.Name())
 	}
 	// If the MRN belongs to an existing patient, we set the MRN only. This is to avoid updating an existing
 	// patient with predefined fields from the Person section of the pathway (e.g., the patient name).
 	if !ps.Hospital.PatientExists(mrn) {
 		updateMRN(p, mrn)
 	} else if err := setMRNOnly(p, mrn); err != nil {
-		return nil, errors.Wrapf(err, "cannot set MRN to the person from the pathway %q", pathwayName)
+		return errors.Wrapf(err, "cannot set MRN to the person from the pathway %q", p.Name())
 	}
-	return ps.startPathwayInHospital(p)
+	return nil
 }
 
 func setMRNOnly(p *pathway.Pathway, mrn string) error {
@@ -242,9 +309,17 @@ func (ps *PathwayStarter) startPathwayWithPatient(pathwayName string, patient *[
 	if patient == nil {
 		return ps.startPathwayInHospital(p)
 	}
+	if err := setPatient(p, patient); err != nil {
+		return nil, err
+	}
+	return ps.startPathwayInHospital(p)
+}
 
+// setPatient sets the first and last names of the only person in the given pathway.
+// It returns an error if the pathway refers to more than one person.
+func setPatient(p *pathway.Pathway, patient *[2]string) error {
 	if !p.Persons.HasOnePerson() {
-		return nil, fmt.Errorf("pathway %q cannot be started with a single patient as it refers to more than one patient", pathwayName)
+		return fmt.Errorf("pathway %q cannot be started with a single patient as it refers to more than one patient", p.Name())
 	}
 	persons := *p.Persons
 	for k, person := range persons {
@@ -252,7 +327,7 @@ func (ps *PathwayStarter) startPathwayWithPatient(pathwayName string, patient *[
 		person.Surname = pathway.OptionalRandomString(patient[1])
 		persons[k] = person
 	}
-	return ps.startPathwayInHospital(p)
+	return nil
 }
 
 // startPathwayInHospital attempts to start the given pathway and returns the list of strings that describe the outcome
@@ -656,6 +656,86 @@ func TestServeHTTP_SendMessage(t *testing.T) {
 	}
 }
 
+func TestStartPathway(t *testing.T) {
+	ctx := context.Background()
+	pathways := map[string]pathway.Pathway{
+		"pathway1": pathway1,
+	}
+	yml := `
+pathway:
+  - admission:
+      loc: Ward 1`
+	tests := []struct {
+		name        string
+		req         PathwayRequest
+		wantName    string
+		wantPatient [3]string
+		wantErr     bool
+	}{{
+		name:        "by name",
+		req:         PathwayRequest{Name: "pathway1"},
+		wantName:    "pathway1",
+		wantPatient: [3]string{"John", "Doe", "1"},
+	}, {
+		name:        "by name with patient",
+		req:         PathwayRequest{Name: "pathway1", FirstName: "Jane", Surname: "Taylor"},
+		wantName:    "pathway1",
+		wantPatient: [3]string{"Jane", "Taylor", "1"},
+	}, {
+		name:        "by name with MRN",
+		req:         PathwayRequest{Name: "pathway1", MRN: "12345"},
+		wantName:    "pathway1",
+		wantPatient: [3]string{"John", "Doe", "12345"},
+	}, {
+		name:     "from definition",
+		req:      PathwayRequest{Definition: yml, FirstName: "Jane", Surname: "Taylor"},
+		wantName: DefaultPathwayNameFromUI,
+		// The MRN generator starts at 1.
+		wantPatient: [3]string{"Jane", "Taylor", "1"},
+	}, {
+		name:    "unknown pathway",
+		req:     PathwayRequest{Name: "unknown"},
+		wantErr: true,
+	}, {
+		name:    "invalid definition",
+		req:     PathwayRequest{Definition: "not a pathway"},
+		wantErr: true,
+	}, {
+		name:    "name and definition",
+		req:     PathwayRequest{Name: "pathway1", Definition: yml},
+		wantErr: true,
+	}, {
+		name:    "empty request",
+		req:     PathwayRequest{},
+		wantErr: true,
+	}}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ps := newTestPathwayStarter(ctx, t, pathways, hospital.Config{})
+			defer ps.Hospital.Close()
+			name, persons, err := ps.StartPathway(tc.req)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("StartPathway(%+v) got err=%v, want error? %t", tc.req, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got, want := name, tc.wantName; got != want {
+				t.Errorf("StartPathway(%+v) got name %q, want %q", tc.req, got, want)
+			}
+			if got, want := len(persons), 1; got != want {
+				t.Fatalf("StartPathway(%+v) got %d persons, want %d", tc.req, got, want)
+			}
+			if got := [3]string{persons[0].FirstName, persons[0].Surname, persons[0].MRN}; got != tc.wantPatient {
+				t.Errorf("StartPathway(%+v) got patient %v, want %v", tc.req, got, tc.wantPatient)
+			}
+			if got := ps.Hospital.EventsLen(); got == 0 {
+				t.Errorf("StartPathway(%+v) queued %d events, want > 0", tc.req, got)
+			}
+		})
+	}
+}
+
 // serveHTTP creates a http server for the PathwayStarter and does a POST request with the given reqStr.
 func serveHTTP(t *testing.T, ps *PathwayStarter, reqStr string) string {
 	ts := httptest.NewServer(ps)
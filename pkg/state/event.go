@@ -22,6 +22,7 @@ import (
 	"github.com/golang-collections/go-datastructures/queue"
 	"github.com/google/simhospital/pkg/pathway"
 	"github.com/google/simhospital/pkg/state/persist"
+	"github.com/google/simhospital/pkg/tracing"
 )
 
 // Event is a stateful object representing Simulated Hospital events currently in progress.
@@ -38,6 +39,9 @@ type Event struct {
 	Index          int
 	// PatientIDs is a map from PatientID to MRN; only set if the pathway this event belongs to had a Persons section.
 	PatientIDs map[pathway.PatientID]string
+	// Trace is the span of the pathway run this event belongs to; the span of the event is its child.
+	// It is the zero value if tracing is disabled.
+	Trace tracing.SpanContext
 }
 
 func (e Event) String() string {
@@ -16,6 +16,7 @@ package state
 
 import (
 	"encoding/json"
+	"sort"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -125,6 +126,23 @@ func (m *PatientsMap) Len() int {
 	return len(m.m)
 }
 
+// All returns the patients in the internal patients map, sorted by their identifier.
+// Patients that are only in the syncer are not returned.
+func (m *PatientsMap) All() []*Patient {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ids := make([]string, 0, len(m.m))
+	for id := range m.m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	patients := make([]*Patient, len(ids))
+	for i, id := range ids {
+		patients[i] = m.m[id]
+	}
+	return patients
+}
+
 // PatientUnmarshaller is an unmarshaller of patients.
 type PatientUnmarshaller struct{}
 
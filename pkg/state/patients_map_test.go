@@ -231,3 +231,14 @@ func TestPatientsMap_Len(t *testing.T) {
 		t.Errorf("pm.Len() = %d, want: %d", got, want)
 	}
 }
+
+func TestPatientsMap_All(t *testing.T) {
+	pm := NewPatientsMap(teststate.NewItemSyncer(), true)
+	pm.Put(testInfo2)
+	pm.Put(testInfo1)
+
+	want := []*Patient{testInfo1, testInfo2}
+	if diff := cmp.Diff(want, pm.All()); diff != "" {
+		t.Errorf("pm.All() got diff (-want +got):\n%s", diff)
+	}
+}
@@ -15,6 +15,9 @@
 package state
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/golang-collections/go-datastructures/queue"
@@ -184,6 +187,80 @@ func (q *WrappedQueue) Get() (*MarshallableQueueItem, error) {
 	return &item, nil
 }
 
+// Items returns a snapshot of the items in the queue, in the order in which they would be retrieved.
+// The items are not removed from the queue.
+func (q *WrappedQueue) Items() []MarshallableQueueItem {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	items := make([]MarshallableQueueItem, 0, len(q.m))
+	for _, i := range q.m {
+		items = append(items, i)
+	}
+	// Compare never returns 0, so items are compared in both directions to get a consistent order for
+	// items with the same priority.
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Compare(items[j]) < 0 && items[j].Compare(items[i]) > 0
+	})
+	return items
+}
+
+// Remove removes the items for which the remove function returns true from the queue, the internal
+// map and the syncer, and returns the number of items removed.
+// The items to keep are always put back in the queue, even if removing other items fails.
+func (q *WrappedQueue) Remove(remove func(MarshallableQueueItem) bool) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.q.Len() == 0 {
+		return 0, nil
+	}
+	// The priority queue doesn't support removing arbitrary items, so we consume all of them and put
+	// back the ones to keep.
+	all, err := q.q.Get(q.q.Len())
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot get items from the queue")
+	}
+	var keep []MarshallableQueueItem
+	var errs []string
+	removed := 0
+	for _, i := range all {
+		item := i.(MarshallableQueueItem)
+		if !remove(item) {
+			keep = append(keep, item)
+			continue
+		}
+		removed++
+		if q.syncer != nil {
+			if err := q.syncer.Delete(item); err != nil {
+				errs = append(errs, errors.Wrap(err, "cannot delete item from the syncer").Error())
+			}
+		}
+		id, err := item.ID()
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, "cannot get item ID").Error())
+			continue
+		}
+		if _, ok := q.m[id]; ok {
+			delete(q.m, id)
+			counters.SimulatedHospital.PendingItem.With(prometheus.Labels{
+				"item_type": q.itemType,
+			}).Dec()
+		}
+	}
+	for _, item := range keep {
+		if err := q.q.Put(item); err != nil {
+			errs = append(errs, errors.Wrap(err, "cannot put item back in the queue").Error())
+		}
+	}
+	if q.q.Len() != len(q.m) && q.consistent {
+		log.Warningf("Elements out of sync after Remove method: #priority queue: %d, #wrapped map: %d", q.q.Len(), len(q.m))
+		q.consistent = false
+	}
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("cannot remove items: %s", strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
+
 // Peek returns the next item in the queue without removing it from the queue.
 func (q *WrappedQueue) Peek() queue.Item {
 	q.mutex.Lock()
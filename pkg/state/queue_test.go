@@ -18,7 +18,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/golang-collections/go-datastructures/queue"
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
 	"github.com/google/simhospital/pkg/state/persist"
 	"github.com/google/simhospital/pkg/test/teststate"
 )
@@ -294,3 +296,131 @@ func TestWrappedQueue_IsConsistent_NonexistentItem(t *testing.T) {
 		t.Errorf("wq.IsConsistent() = %t, want: %t", got, want)
 	}
 }
+
+func TestWrappedQueue_Items(t *testing.T) {
+	wq, err := NewWrappedQueue(teststate.Type, nil)
+	if err != nil {
+		t.Fatalf("NewWrappedQueue(%s, nil) failed with %v", teststate.Type, err)
+	}
+	item3 := teststate.NewItem("3")
+	wq.Put(item3, teststate.Item1, teststate.Item2)
+
+	want := []MarshallableQueueItem{teststate.Item1, teststate.Item2, item3}
+	if diff := cmp.Diff(want, wq.Items()); diff != "" {
+		t.Errorf("wq.Items() got diff (-want +got):\n%s", diff)
+	}
+	if got, want := wq.Len(), 3; got != want {
+		t.Errorf("wq.Len() = %d, want: %d", got, want)
+	}
+}
+
+func TestWrappedQueue_Remove(t *testing.T) {
+	tests := []struct {
+		name   string
+		syncer persist.ItemSyncer
+	}{
+		{name: "no syncer", syncer: nil},
+		{name: "with syncer", syncer: teststate.NewItemSyncerWithDelete(true)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wq, err := NewWrappedQueue(teststate.Type, tt.syncer)
+			if err != nil {
+				t.Fatalf("NewWrappedQueue(%s, %v) failed with %v", teststate.Type, tt.syncer, err)
+			}
+			item3 := teststate.NewItem("3")
+			wq.Put(teststate.Item1, teststate.Item2, item3)
+
+			removed, err := wq.Remove(func(i MarshallableQueueItem) bool {
+				return i.(teststate.Item).I == "2"
+			})
+			if err != nil {
+				t.Fatalf("wq.Remove() failed with %v", err)
+			}
+			if got, want := removed, 1; got != want {
+				t.Errorf("wq.Remove() = %d, want: %d", got, want)
+			}
+			if got, want := wq.Len(), 2; got != want {
+				t.Errorf("wq.Len() = %d, want: %d", got, want)
+			}
+			if wq.syncer != nil {
+				if got, _ := wq.syncer.LoadByID("2"); got != nil {
+					t.Errorf("syncer LoadByID(%q) = %v, want: nil", "2", got)
+				}
+			}
+			for _, want := range []MarshallableQueueItem{teststate.Item1, item3} {
+				if got, _ := wq.Get(); !cmp.Equal(want, *got) {
+					t.Errorf("wq.Get() = %v, want: %v", *got, want)
+				}
+			}
+			if !wq.IsConsistent() {
+				t.Error("wq.IsConsistent() = false, want true")
+			}
+		})
+	}
+}
+
+// failingItem is an item whose ID fails once failID is set.
+type failingItem struct {
+	teststate.Item
+	failID *bool
+}
+
+func (i failingItem) ID() (string, error) {
+	if *i.failID {
+		return "", errors.New("no ID")
+	}
+	return i.Item.ID()
+}
+
+func (i failingItem) Compare(other queue.Item) int {
+	return i.Item.Compare(other.(failingItem).Item)
+}
+
+func TestWrappedQueue_Remove_Fails(t *testing.T) {
+	wq, err := NewWrappedQueue(teststate.Type, nil)
+	if err != nil {
+		t.Fatalf("NewWrappedQueue(%s, nil) failed with %v", teststate.Type, err)
+	}
+	failID := false
+	var items []MarshallableQueueItem
+	for _, id := range []string{"1", "2", "3", "4"} {
+		items = append(items, failingItem{Item: teststate.NewItem(id), failID: &failID})
+	}
+	wq.Put(items...)
+
+	// Removing item 2 fails because its ID cannot be read, but items 1, 3 and 4 must stay in the queue.
+	failID = true
+	if _, err := wq.Remove(func(i MarshallableQueueItem) bool {
+		return i.(failingItem).I == "2"
+	}); err == nil {
+		t.Error("wq.Remove() got nil error, want error")
+	}
+	failID = false
+	for _, want := range []MarshallableQueueItem{items[0], items[2], items[3]} {
+		got, err := wq.Get()
+		if err != nil {
+			t.Fatalf("wq.Get() failed with %v", err)
+		}
+		if *got != want {
+			t.Errorf("wq.Get() = %v, want: %v", *got, want)
+		}
+	}
+	if !wq.Empty() {
+		t.Error("wq.Empty() = false, want true")
+	}
+}
+
+func TestWrappedQueue_Remove_Empty(t *testing.T) {
+	wq, err := NewWrappedQueue(teststate.Type, nil)
+	if err != nil {
+		t.Fatalf("NewWrappedQueue(%s, nil) failed with %v", teststate.Type, err)
+	}
+	removed, err := wq.Remove(func(MarshallableQueueItem) bool { return true })
+	if err != nil {
+		t.Fatalf("wq.Remove() failed with %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("wq.Remove() = %d, want: 0", removed)
+	}
+}
@@ -82,12 +82,16 @@ var (
 	ProceduresConfigProd = path.Join(prodConfigDir, "hl7_messages", "procedures.csv")
 	// DiagnosesConfigProd is the path to the prod diagnoses config file.
 	DiagnosesConfigProd = path.Join(prodConfigDir, "hl7_messages", "diagnoses.csv")
+	// ComorbiditiesConfigProd is the path to the prod comorbidities config file.
+	ComorbiditiesConfigProd = path.Join(prodConfigDir, "hl7_messages", "comorbidities.yml")
 	// DoctorsConfigProd is the path to the prod doctors config file.
 	DoctorsConfigProd = path.Join(prodConfigDir, "hl7_messages", "doctors.yml")
 	// EthnicityConfigProd is the path to the prod ethnicities config file.
 	EthnicityConfigProd = path.Join(prodConfigDir, "hl7_messages", "ethnicity.csv")
 	// OrderProfilesConfigProd is the path to the prod config file with order profiles.
 	OrderProfilesConfigProd = path.Join(prodConfigDir, "hl7_messages", "order_profiles.yml")
+	// OrderProfilesLOINCConfigProd is the path to the prod config file with order profiles coded with LOINC.
+	OrderProfilesLOINCConfigProd = path.Join(prodConfigDir, "hl7_messages", "order_profiles_loinc.yml")
 	// PatientClassConfigProd is the path to the prod patient class config file.
 	PatientClassConfigProd = path.Join(prodConfigDir, "hl7_messages", "patient_class.csv")
 	// MessageConfigProd is the path to the prod message config file.
@@ -114,6 +118,8 @@ var (
 	PathwaysDirProd = path.Join(prodConfigDir, "pathways")
 	// HardcodedMessagesDirProd is the path to the prod directory with hardcoded messages.
 	HardcodedMessagesDirProd = path.Join(prodConfigDir, "hardcoded_messages")
+	// DeidPolicyConfigProd is the path to the prod de-identification policy.
+	DeidPolicyConfigProd = path.Join(prodConfigDir, "deid", "policy.yml")
 
 	// DataFiles contains sets of data files for testing.
 	DataFiles = map[ConfigType]config.DataFiles{
@@ -144,6 +150,7 @@ var (
 			PatientClass:      PatientClassConfigProd,
 			ClinicalNoteTypes: ClinicalNoteTypesConfigProd,
 			SampleNotesDir:    ClinicalNotesConfigProd,
+			Comorbidities:     ComorbiditiesConfigProd,
 		},
 	}
 )
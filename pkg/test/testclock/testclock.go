@@ -16,11 +16,14 @@
 package testclock
 
 import (
+	"sync"
 	"time"
 )
 
-// Clock is a clock used for testing.
+// Clock is a clock used for testing. It is safe for concurrent use.
 type Clock struct {
+	// mu guards now.
+	mu   sync.Mutex
 	now  time.Time
 	tick time.Duration
 }
@@ -39,12 +42,16 @@ func WithTick(now time.Time, tick time.Duration) *Clock {
 // Now returns the current time as seen by the Clock and advances the time
 // the duration of the tick.
 func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	nowToReturn := c.now
-	c.Advance(c.tick)
+	c.now = c.now.Add(c.tick)
 	return nowToReturn
 }
 
 // Advance advances the clock the specified duration.
 func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.now = c.now.Add(d)
 }
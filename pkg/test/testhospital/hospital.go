@@ -123,6 +123,18 @@ func WithTime(ctx context.Context, t *testing.T, cfg Config, now time.Time) *Hos
 	} else {
 		c.Sender = &testhl7.Sender{}
 	}
+	if cfg.MessageLog != nil {
+		c.MessageLog = cfg.MessageLog
+	}
+	if cfg.Tracer != nil {
+		c.Tracer = cfg.Tracer
+	}
+	if cfg.GroundTruth != nil {
+		c.GroundTruth = cfg.GroundTruth
+	}
+	if cfg.Provenance != nil {
+		c.Provenance = cfg.Provenance
+	}
 	if cfg.ResourceWriter != nil {
 		c.ResourceWriter = cfg.ResourceWriter
 	} else {
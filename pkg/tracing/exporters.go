@@ -0,0 +1,228 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// otlpTracesPath is the path of the OTLP/HTTP endpoint for traces.
+	otlpTracesPath = "/v1/traces"
+	// scopeName is the name of the instrumentation scope of the spans.
+	scopeName = "github.com/google/simhospital"
+
+	// OTLP span kind and status codes.
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// writerExporter writes spans as JSON, one span per line.
+type writerExporter struct {
+	// mu guards w.
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns an exporter that writes spans to w as JSON, one span per line.
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{w: w}
+}
+
+// Export writes the spans.
+func (e *writerExporter) Export(spans []Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			return errors.Wrapf(err, "cannot write span %s", s.Name)
+		}
+	}
+	return nil
+}
+
+// Close does nothing: the writer is owned by the caller.
+func (e *writerExporter) Close() error {
+	return nil
+}
+
+// otlpExporter sends spans to an OpenTelemetry collector, using OTLP over HTTP with the JSON
+// encoding.
+type otlpExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter returns an exporter that sends spans to the OpenTelemetry collector at endpoint,
+// e.g., "http://localhost:4318", using OTLP over HTTP with the JSON encoding.
+// The spans are sent to the "/v1/traces" path of endpoint, unless endpoint already contains it.
+// serviceName is the value of the "service.name" attribute of the spans' resource.
+func NewOTLPExporter(endpoint string, serviceName string) (Exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid OTLP endpoint %q", endpoint)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("invalid OTLP endpoint %q: the scheme must be http or https", endpoint)
+	}
+	if !strings.HasSuffix(u.Path, otlpTracesPath) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + otlpTracesPath
+	}
+	return &otlpExporter{
+		url:         u.String(),
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Export sends the spans to the collector.
+func (e *otlpExporter) Export(spans []Span) error {
+	b, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal spans")
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrapf(err, "cannot send spans to %s", e.url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("cannot send spans to %s: got status %s: %s", e.url, resp.Status, body)
+	}
+	return nil
+}
+
+// Close does nothing: spans are sent as soon as they are exported.
+func (e *otlpExporter) Close() error {
+	return nil
+}
+
+// The following types are the JSON encoding of an OTLP ExportTraceServiceRequest. See
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto.
+// As in the OTLP JSON encoding, IDs are in hexadecimal and 64 bit integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *otlpExporter) request(spans []Span) otlpRequest {
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		otlpSpans[i] = otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.Parent != (SpanID{}) {
+			otlpSpans[i].ParentSpanID = s.Parent.String()
+		}
+		if s.Error != "" {
+			otlpSpans[i].Status = &otlpStatus{Code: statusCodeError, Message: s.Error}
+		}
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes([]Attribute{String("service.name", e.serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: otlpSpans}},
+	}}}
+}
+
+func otlpAttributes(attributes []Attribute) []otlpAttribute {
+	var otlp []otlpAttribute
+	for _, a := range attributes {
+		var v otlpValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case bool:
+			v.BoolValue = &value
+		case float64:
+			v.DoubleValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		otlp = append(otlp, otlpAttribute{Key: a.Key, Value: v})
+	}
+	return otlp
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testSpans() []Span {
+	c := SpanContext{
+		TraceID: TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		SpanID:  SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+	}
+	return []Span{{
+		Name:       "Admission",
+		Context:    SpanContext{TraceID: c.TraceID, SpanID: SpanID{0x0a}},
+		Parent:     c.SpanID,
+		Start:      time.Unix(1, 0),
+		End:        time.Unix(2, 0),
+		Attributes: []Attribute{String("mrn", "1234"), Int("index", 0), Bool("historical", false), Float64("weight", 72.5)},
+		Error:      "failed",
+	}, {
+		Name:    "pathway",
+		Context: c,
+		Start:   time.Unix(1, 0),
+		End:     time.Unix(3, 0),
+	}}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var b bytes.Buffer
+	e := NewWriterExporter(&b)
+	if err := e.Export(testSpans()); err != nil {
+		t.Fatalf("Export() failed with %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if got, want := len(lines), 2; got != want {
+		t.Fatalf("Export() wrote %d lines, want %d:\n%s", got, want, b.String())
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s) failed with %v", lines[0], err)
+	}
+	want := map[string]interface{}{
+		"name":           "Admission",
+		"context":        map[string]interface{}{"trace_id": "0102030405060708090a0b0c0d0e0f10", "span_id": "0a00000000000000"},
+		"parent_span_id": "0102030405060708",
+		"start":          time.Unix(1, 0).Format(time.RFC3339Nano),
+		"end":            time.Unix(2, 0).Format(time.RFC3339Nano),
+		"attributes": []interface{}{
+			map[string]interface{}{"key": "mrn", "value": "1234"},
+			map[string]interface{}{"key": "index", "value": float64(0)},
+			map[string]interface{}{"key": "historical", "value": false},
+			map[string]interface{}{"key": "weight", "value": 72.5},
+		},
+		"error": "failed",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Export() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var gotPath, gotContentType string
+	var got otlpRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotContentType = r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Decode() failed with %v", err)
+		}
+	}))
+	defer s.Close()
+
+	e, err := NewOTLPExporter(s.URL, "simulated-hospital")
+	if err != nil {
+		t.Fatalf("NewOTLPExporter(%q) failed with %v", s.URL, err)
+	}
+	if err := e.Export(testSpans()); err != nil {
+		t.Fatalf("Export() failed with %v", err)
+	}
+	if got, want := gotPath, "/v1/traces"; got != want {
+		t.Errorf("Export() sent the request to path %q, want %q", got, want)
+	}
+	if got, want := gotContentType, "application/json"; got != want {
+		t.Errorf("Export() sent Content-Type %q, want %q", got, want)
+	}
+
+	service := "simulated-hospital"
+	mrn, index, historical, weight := "1234", "0", false, 72.5
+	want := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &service}}}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: scopeName},
+			Spans: []otlpSpan{{
+				TraceID:           "0102030405060708090a0b0c0d0e0f10",
+				SpanID:            "0a00000000000000",
+				ParentSpanID:      "0102030405060708",
+				Name:              "Admission",
+				Kind:              spanKindInternal,
+				StartTimeUnixNano: "1000000000",
+				EndTimeUnixNano:   "2000000000",
+				Attributes: []otlpAttribute{
+					{Key: "mrn", Value: otlpValue{StringValue: &mrn}},
+					{Key: "index", Value: otlpValue{IntValue: &index}},
+					{Key: "historical", Value: otlpValue{BoolValue: &historical}},
+					{Key: "weight", Value: otlpValue{DoubleValue: &weight}},
+				},
+				Status: &otlpStatus{Code: statusCodeError, Message: "failed"},
+			}, {
+				TraceID:           "0102030405060708090a0b0c0d0e0f10",
+				SpanID:            "0102030405060708",
+				Name:              "pathway",
+				Kind:              spanKindInternal,
+				StartTimeUnixNano: "1000000000",
+				EndTimeUnixNano:   "3000000000",
+			}},
+		}},
+	}}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Export() sent request diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestOTLPExporter_Errors(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "ftp://localhost", "://"} {
+		if _, err := NewOTLPExporter(endpoint, "service"); err == nil {
+			t.Errorf("NewOTLPExporter(%q) got nil error, want error", endpoint)
+		}
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	e, err := NewOTLPExporter(s.URL+"/v1/traces", "service")
+	if err != nil {
+		t.Fatalf("NewOTLPExporter(%q) failed with %v", s.URL, err)
+	}
+	if err := e.Export(testSpans()); err == nil {
+		t.Error("Export() to a failing collector got nil error, want error")
+	}
+}
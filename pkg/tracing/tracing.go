@@ -0,0 +1,324 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records spans for the pathways and events that Simulated Hospital runs, and
+// exports them following the OpenTelemetry data model, either to an OTLP collector or as JSON.
+//
+// All the methods of Tracer and Span can be called on nil values, in which case they do nothing.
+// This allows callers to trace unconditionally, and to disable tracing by using a nil Tracer.
+//
+// The spans are modelled here instead of with the OpenTelemetry SDK because the span of a pathway
+// outlives the events that run it: only its context is stored with the events while the pathway
+// runs, possibly across a restart from a saved state, and the span is created with that context
+// when the pathway ends. The SDK always generates the IDs of new spans, so it cannot end a span
+// whose ID was handed out earlier. The exporters write OTLP/JSON over HTTP, which any OTLP
+// collector accepts, so that the SDK and its gRPC and protobuf dependencies are not needed.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/google/simhospital/pkg/logging"
+	"github.com/pkg/errors"
+)
+
+var log = logging.ForCallerPackage()
+
+const (
+	// batchSize is the maximum number of spans exported at once.
+	batchSize = 100
+	// queueSize is the number of spans that can be waiting to be exported. Spans recorded when the
+	// queue is full are dropped, so that tracing never blocks the simulation.
+	queueSize = 2048
+)
+
+// flushInterval is how often the spans that are waiting to be exported are exported, even if there
+// are less than batchSize of them.
+var flushInterval = 5 * time.Second
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the ID in hexadecimal, as in OTLP.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// MarshalText marshals the ID in hexadecimal.
+func (id TraceID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText unmarshals an ID in hexadecimal.
+func (id *TraceID) UnmarshalText(b []byte) error {
+	return unmarshalHex(b, id[:])
+}
+
+// String returns the ID in hexadecimal, as in OTLP.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// MarshalText marshals the ID in hexadecimal.
+func (id SpanID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText unmarshals an ID in hexadecimal.
+func (id *SpanID) UnmarshalText(b []byte) error {
+	return unmarshalHex(b, id[:])
+}
+
+func unmarshalHex(b []byte, id []byte) error {
+	if len(b) == 0 {
+		for i := range id {
+			id[i] = 0
+		}
+		return nil
+	}
+	if hex.DecodedLen(len(b)) != len(id) {
+		return errors.Errorf("invalid ID %q: want %d hexadecimal characters", b, hex.EncodedLen(len(id)))
+	}
+	_, err := hex.Decode(id, b)
+	return errors.Wrapf(err, "invalid ID %q", b)
+}
+
+// SpanContext identifies a span. The zero value is not a valid context, and is used when tracing is
+// disabled.
+type SpanContext struct {
+	TraceID TraceID `json:"trace_id"`
+	SpanID  SpanID  `json:"span_id"`
+}
+
+// IsValid returns whether the context identifies a span.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != TraceID{} && c.SpanID != SpanID{}
+}
+
+// Attribute is a key-value pair that describes a span. Values can be strings, ints, booleans or
+// float64.
+type Attribute struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Float64 returns a floating-point attribute.
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is an operation that is being traced, e.g., running an event.
+type Span struct {
+	Name    string      `json:"name"`
+	Context SpanContext `json:"context"`
+	// Parent is the ID of the parent span, or the zero value if this is the root span of its trace.
+	Parent     SpanID      `json:"parent_span_id"`
+	Start      time.Time   `json:"start"`
+	End        time.Time   `json:"end"`
+	Attributes []Attribute `json:"attributes,omitempty"`
+	// Error describes why the operation failed, or is empty if it did not fail.
+	Error string `json:"error,omitempty"`
+
+	tracer *Tracer
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.Attributes = append(s.Attributes, attributes...)
+}
+
+// SetError marks the span as failed because of err.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Error = err.Error()
+}
+
+// Finish ends the span at the given time, and queues it to be exported.
+func (s *Span) Finish(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.End = end
+	s.tracer.record(*s)
+}
+
+// Exporter exports spans.
+type Exporter interface {
+	Export([]Span) error
+	Close() error
+}
+
+// Tracer creates spans and exports them in batches in the background.
+type Tracer struct {
+	exporter Exporter
+	// mu guards closed, so that spans are not recorded after spans is closed.
+	mu     sync.RWMutex
+	closed bool
+	spans  chan Span
+	done   chan struct{}
+}
+
+// NewTracer returns a tracer that exports the spans with the given exporter.
+// Close must be called to export the remaining spans when the tracer is no longer needed.
+func NewTracer(e Exporter) *Tracer {
+	t := &Tracer{
+		exporter: e,
+		spans:    make(chan Span, queueSize),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// NewTrace returns the context of the root span of a new trace. The span starts now, and it is
+// created with ResumeSpan when it ends, so that the context can be stored in the meantime.
+func (t *Tracer) NewTrace() SpanContext {
+	if t == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}
+}
+
+// ResumeSpan returns the root span with the given context, that started at the given time.
+// It returns nil if the tracer is nil or the context is not valid.
+func (t *Tracer) ResumeSpan(c SpanContext, name string, start time.Time) *Span {
+	if t == nil || !c.IsValid() {
+		return nil
+	}
+	return &Span{Name: name, Context: c, Start: start, tracer: t}
+}
+
+// StartSpan returns a new span that is a child of the span with the given context.
+// It returns nil if the tracer is nil or the context is not valid.
+func (t *Tracer) StartSpan(parent SpanContext, name string, start time.Time) *Span {
+	if t == nil || !parent.IsValid() {
+		return nil
+	}
+	return &Span{
+		Name:    name,
+		Context: SpanContext{TraceID: parent.TraceID, SpanID: newSpanID()},
+		Parent:  parent.SpanID,
+		Start:   start,
+		tracer:  t,
+	}
+}
+
+// Close exports the remaining spans and closes the exporter. Spans that finish after Close is called
+// are not exported.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.spans)
+	t.mu.Unlock()
+	<-t.done
+	return errors.Wrap(t.exporter.Close(), "cannot close the span exporter")
+}
+
+func (t *Tracer) record(s Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.spans <- s:
+	default:
+		log.WithField("span", s.Name).Warning("Too many spans waiting to be exported: dropping span")
+	}
+}
+
+// run exports the recorded spans in batches until spans is closed.
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			log.WithError(err).Warningf("Cannot export %d spans", len(batch))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	randomID(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	randomID(id[:])
+	return id
+}
+
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		// crypto/rand only fails if the OS cannot provide randomness, in which case nothing else works
+		// either.
+		log.WithError(err).Fatal("Cannot generate a random ID")
+	}
+}
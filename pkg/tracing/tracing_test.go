@@ -0,0 +1,161 @@
+// Copyright 2023 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+var start = time.Date(2020, 2, 12, 0, 0, 0, 0, time.UTC)
+
+// fakeExporter keeps the spans exported.
+type fakeExporter struct {
+	mu     sync.Mutex
+	spans  []Span
+	closed bool
+}
+
+func (e *fakeExporter) Export(spans []Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *fakeExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	e := &fakeExporter{}
+	tracer := NewTracer(e)
+
+	trace := tracer.NewTrace()
+	if !trace.IsValid() {
+		t.Fatalf("NewTrace() got invalid context %+v", trace)
+	}
+	child := tracer.StartSpan(trace, "child", start)
+	child.SetAttributes(String("mrn", "1234"), Int("index", 1))
+	child.SetError(errors.New("failed"))
+	child.Finish(start.Add(time.Second))
+	root := tracer.ResumeSpan(trace, "root", start)
+	root.Finish(start.Add(time.Hour))
+
+	if err := tracer.Close(); err != nil {
+		t.Fatalf("Close() failed with %v", err)
+	}
+	if !e.closed {
+		t.Error("Close() did not close the exporter")
+	}
+	want := []Span{{
+		Name:       "child",
+		Context:    SpanContext{TraceID: trace.TraceID, SpanID: child.Context.SpanID},
+		Parent:     trace.SpanID,
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: []Attribute{String("mrn", "1234"), Int("index", 1)},
+		Error:      "failed",
+	}, {
+		Name:    "root",
+		Context: trace,
+		Start:   start,
+		End:     start.Add(time.Hour),
+	}}
+	if diff := cmp.Diff(want, e.spans, cmpopts.IgnoreUnexported(Span{})); diff != "" {
+		t.Errorf("exported spans got diff (-want +got):\n%s", diff)
+	}
+	if child.Context.SpanID == trace.SpanID {
+		t.Errorf("StartSpan() got the span ID of the parent %v, want a new span ID", trace.SpanID)
+	}
+
+	// Spans that finish after closing the tracer are not exported.
+	tracer.StartSpan(trace, "late", start).Finish(start)
+	if got, want := len(e.spans), 2; got != want {
+		t.Errorf("len(exported spans) after Close() got %d, want %d", got, want)
+	}
+}
+
+func TestTracer_ExportsPeriodically(t *testing.T) {
+	defer func(d time.Duration) { flushInterval = d }(flushInterval)
+	flushInterval = 10 * time.Millisecond
+
+	e := &fakeExporter{}
+	tracer := NewTracer(e)
+	defer tracer.Close()
+	tracer.ResumeSpan(tracer.NewTrace(), "root", start).Finish(start)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mu.Lock()
+		n := len(e.spans)
+		e.mu.Unlock()
+		if n == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the span was not exported before closing the tracer")
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	trace := tracer.NewTrace()
+	if trace.IsValid() {
+		t.Errorf("NewTrace() on a nil tracer got valid context %+v, want invalid", trace)
+	}
+	span := tracer.StartSpan(trace, "span", start)
+	if span != nil {
+		t.Errorf("StartSpan() on a nil tracer got %+v, want nil", span)
+	}
+	// Calling the methods of nil spans and tracers does nothing.
+	span.SetAttributes(String("key", "value"))
+	span.SetError(errors.New("failed"))
+	span.Finish(start)
+	if err := tracer.Close(); err != nil {
+		t.Errorf("Close() on a nil tracer failed with %v", err)
+	}
+}
+
+func TestSpanContext_JSON(t *testing.T) {
+	tracer := NewTracer(&fakeExporter{})
+	defer tracer.Close()
+
+	for _, c := range []SpanContext{tracer.NewTrace(), {}} {
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Fatalf("json.Marshal(%+v) failed with %v", c, err)
+		}
+		var got SpanContext
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed with %v", b, err)
+		}
+		if diff := cmp.Diff(c, got); diff != "" {
+			t.Errorf("json.Unmarshal(%s) got diff (-want +got):\n%s", b, diff)
+		}
+	}
+
+	var c SpanContext
+	if err := json.Unmarshal([]byte(`{"trace_id":"1234","span_id":""}`), &c); err == nil {
+		t.Error("json.Unmarshal() with a short trace ID got nil error, want error")
+	}
+}
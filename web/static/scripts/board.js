@@ -0,0 +1,92 @@
+/**
+ * Copyright 2023 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+const BOARD_CONTAINER_ID = 'bed-board';
+const CENSUS_COUNTS = [
+  {key: 'total', label: 'Total'},
+  {key: 'inpatient', label: 'Inpatient'},
+  {key: 'ed', label: 'ED'},
+  {key: 'outpatient', label: 'Outpatient'},
+];
+
+/**
+ * Returns a human readable description of the patient in a bed.
+ * @param {?Object} patient
+ * @return {string}
+ */
+function describePatient(patient) {
+  if (!patient) {
+    return 'Occupied';
+  }
+  let text = `${patient.first_name} ${patient.surname} (${patient.mrn})`;
+  if (patient.pathway_name) {
+    text += `\nPathway: ${patient.pathway_name}`;
+  }
+  if (patient.next_event) {
+    const time = new Date(patient.next_event.time).toLocaleString();
+    text += `\nNext: ${patient.next_event.type} at ${time}`;
+  }
+  return text;
+}
+
+/**
+ * Displays the census and the wards of the specified board.
+ * @param {!Element} boardContainer
+ * @param {!Object} board
+ */
+function fillBoard(boardContainer, board) {
+  boardContainer.selectAll('*').remove();
+
+  const census = boardContainer.append('div').attr(HTML_ATTRIBUTES.class, 'census');
+  for (const count of CENSUS_COUNTS) {
+    census.append('span')
+        .attr(HTML_ATTRIBUTES.class, 'census-count')
+        .text(`${count.label}: ${board.census[count.key]}`);
+  }
+
+  for (const ward of board.wards || []) {
+    const w = boardContainer.append('div').attr(HTML_ATTRIBUTES.class, 'ward');
+    w.append('div')
+        .attr(HTML_ATTRIBUTES.class, 'ward-name')
+        .text(`${ward.name} (${ward.occupied} occupied, ${ward.free} free)`);
+    const beds = w.append('div').attr(HTML_ATTRIBUTES.class, 'beds');
+    for (const bed of ward.beds) {
+      const b = beds.append('div')
+          .attr(HTML_ATTRIBUTES.class, bed.occupied ? 'bed bed-occupied' : 'bed')
+          .attr('title', bed.occupied ? describePatient(bed.patient) : 'Free');
+      b.append('div').attr(HTML_ATTRIBUTES.class, 'bed-name').text(bed.name);
+      if (bed.patient) {
+        b.append('div')
+            .attr(HTML_ATTRIBUTES.class, 'bed-patient')
+            .text(`${bed.patient.first_name} ${bed.patient.surname}`);
+      }
+    }
+  }
+}
+
+/**
+ * Subscribes to the updates of the board and displays them.
+ * @param {!Element} boardContainer
+ */
+function subscribeToBoard(boardContainer) {
+  const source = new EventSource(boardContainer.node().dataset.events);
+  source.onmessage = function(event) {
+    fillBoard(boardContainer, JSON.parse(event.data));
+  };
+}
+
+// Select the board container and keep it up to date.
+subscribeToBoard(d3.select(`#${BOARD_CONTAINER_ID}`));
@@ -0,0 +1,132 @@
+/**
+ * Copyright 2023 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+const MESSAGE_LOG_CONTAINER_ID = 'message-log';
+const MESSAGE_LOG_RESULTS_CLASS = 'message-log-results';
+const MESSAGE_LOG_VIEW_CLASS = 'message-log-view';
+const MESSAGE_LOG_LIMIT = 100;
+const MESSAGE_LOG_FIELDS = [
+  {param: 'mrn', placeholder: 'MRN'},
+  {param: 'visit_id', placeholder: 'Visit ID'},
+  {param: 'type', placeholder: 'Type, e.g. ADT^A02'},
+  {param: 'control_id', placeholder: 'Control ID'},
+];
+
+/**
+ * Appends the search fields, the results table and the message view to the
+ * message log container.
+ * @param {!Element} messageLogContainer
+ */
+function appendMessageLogElements(messageLogContainer) {
+  const form = messageLogContainer.append('div')
+      .attr(HTML_ATTRIBUTES.class, 'message-log-search');
+  for (const field of MESSAGE_LOG_FIELDS) {
+    form.append('input')
+        .attr(HTML_ATTRIBUTES.type, 'text')
+        .attr(HTML_ATTRIBUTES.class, 'message-log-field')
+        .attr('name', field.param)
+        .attr(HTML_ATTRIBUTES.placeholder, field.placeholder);
+  }
+  form.append('input')
+      .attr(HTML_ATTRIBUTES.type, 'submit')
+      .attr(HTML_ATTRIBUTES.value, 'Search')
+      .attr(HTML_ATTRIBUTES.class, 'message-log-button')
+      .on('click', searchMessages);
+  messageLogContainer.append('table')
+      .attr(HTML_ATTRIBUTES.class, MESSAGE_LOG_RESULTS_CLASS);
+  messageLogContainer.append('pre')
+      .attr(HTML_ATTRIBUTES.class, MESSAGE_LOG_VIEW_CLASS);
+}
+
+/** Searches the message log with the values of the search fields. */
+function searchMessages() {
+  const params = new URLSearchParams({limit: MESSAGE_LOG_LIMIT});
+  d3.selectAll('.message-log-field').each(function() {
+    if (this.value) {
+      params.set(this.name, this.value);
+    }
+  });
+  const path =
+      document.getElementById(MESSAGE_LOG_CONTAINER_ID).dataset.path;
+  d3.request(`${path}?${params}`).get(function(error, data) {
+    if (error) {
+      fillMessageView(error.target.responseText);
+      return;
+    }
+    fillResults(JSON.parse(data.response).messages);
+  });
+}
+
+/**
+ * Displays the messages found, most recent first.
+ * @param {!Array<!Object>} messages
+ */
+function fillResults(messages) {
+  const table = d3.select(`.${MESSAGE_LOG_RESULTS_CLASS}`);
+  table.selectAll('*').remove();
+  fillMessageView(messages.length ? '' : 'No messages found');
+  if (!messages.length) {
+    return;
+  }
+  const header = table.append('tr');
+  for (const title of ['Sent', 'Type', 'MRNs', 'Visit IDs', 'Control ID', 'Pathway', '']) {
+    header.append('th').text(title);
+  }
+  for (const m of messages.slice().reverse()) {
+    const row = table.append('tr');
+    row.append('td').text(new Date(m.sent_time).toLocaleString());
+    row.append('td').text(m.message_type);
+    row.append('td').text((m.mrns || []).join(', '));
+    row.append('td').text((m.visit_ids || []).join(', '));
+    row.append('td').text(m.control_id);
+    row.append('td').text(m.pathway_name || '');
+    const view = row.append('td');
+    for (const format of ['raw', 'pretty']) {
+      view.append('a')
+          .attr('href', '#')
+          .attr(HTML_ATTRIBUTES.class, 'message-log-link')
+          .text(format)
+          .on('click', function() {
+            d3.event.preventDefault();
+            showMessage(m.id, format);
+          });
+    }
+  }
+}
+
+/**
+ * Requests a message in the given format and displays it.
+ * @param {number} id The ID of the message in the log.
+ * @param {string} format Either 'raw' or 'pretty'.
+ */
+function showMessage(id, format) {
+  const path =
+      document.getElementById(MESSAGE_LOG_CONTAINER_ID).dataset.path;
+  d3.request(`${path}?id=${id}&format=${format}`).get(function(error, data) {
+    fillMessageView(error ? error.target.responseText : data.response);
+  });
+}
+
+/**
+ * Displays the specified text in the message view.
+ * @param {string} text
+ */
+function fillMessageView(text) {
+  d3.select(`.${MESSAGE_LOG_VIEW_CLASS}`).text(text);
+}
+
+// Select the message log container and attach the search elements.
+appendMessageLogElements(d3.select(`#${MESSAGE_LOG_CONTAINER_ID}`));
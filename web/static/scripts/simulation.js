@@ -0,0 +1,84 @@
+/**
+ * Copyright 2023 Google LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+const SIMULATION_CONTAINER_ID = 'simulation';
+const SIMULATION_STATE_CLASS = 'simulation-state';
+const SIMULATION_ACTIONS = ['pause', 'resume', 'step', 'drain'];
+
+/**
+ * Appends one button per simulation action to the simulation container.
+ * @param {!Element} simulationContainer
+ */
+function appendSimulationButtons(simulationContainer) {
+  for (const action of SIMULATION_ACTIONS) {
+    simulationContainer.append('input')
+        .attr(HTML_ATTRIBUTES.type, 'submit')
+        .attr(HTML_ATTRIBUTES.value, action[0].toUpperCase() + action.slice(1))
+        .attr(HTML_ATTRIBUTES.class, 'simulation-button')
+        .on('click', function() {
+          sendAction(action);
+        });
+  }
+  simulationContainer.append('text').attr(
+      HTML_ATTRIBUTES.class, SIMULATION_STATE_CLASS);
+}
+
+/**
+ * Sends the specified action to the backend and displays the new state.
+ * @param {string} action One of SIMULATION_ACTIONS.
+ */
+function sendAction(action) {
+  d3.request(document.getElementById(SIMULATION_CONTAINER_ID).dataset.path)
+      .header('X-Requested-With', 'XMLHttpRequest')
+      .header('Content-Type', 'application/x-www-form-urlencoded')
+      .post('action=' + action, function(error, data) {
+        if (error) {
+          fillState(error.target.responseText);
+          return;
+        }
+        fillState(describeState(JSON.parse(data.response)));
+      });
+}
+
+/** Requests the state of the simulation from the backend and displays it. */
+function requestState() {
+  d3.request(document.getElementById(SIMULATION_CONTAINER_ID).dataset.path)
+      .get(function(data) {
+        fillState(describeState(JSON.parse(data.response)));
+      });
+}
+
+/**
+ * Returns a human readable description of the state of the simulation.
+ * @param {{paused: boolean, draining: boolean}} state
+ * @return {string}
+ */
+function describeState(state) {
+  const running = state.paused ? 'Paused' : 'Running';
+  return state.draining ? `${running}, draining` : running;
+}
+
+/**
+ * Displays the specified text as the state of the simulation.
+ * @param {string} text
+ */
+function fillState(text) {
+  d3.select(`.${SIMULATION_STATE_CLASS}`).text(text);
+}
+
+// Select the simulation container, attach the buttons and display the state.
+appendSimulationButtons(d3.select(`#${SIMULATION_CONTAINER_ID}`));
+requestState();